@@ -0,0 +1,115 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"log4jscanner/store"
+)
+
+func annotateUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner annotate [flag] [paths]
+
+Records the owner, ticket, and remediation status of vulnerable paths in a
+results store written by --store, to track remediation across runs. Only the
+provided fields are changed, and "query" lists the annotation of each path.
+
+Flags:
+
+    --store   SQLite database written by --store (required).
+    --host    Host of the paths (default this host).
+    --owner   Person or team responsible for the path.
+    --ticket  ID of the ticket tracking the remediation (e.g. SEC-123).
+    --status  One of `+strings.Join(store.Statuses, ", ")+`.
+    --note    Free form note, such as why a risk was accepted.
+    --clear   Remove the annotations of the paths.
+
+`)
+}
+
+func annotateCmd(args []string) {
+	var (
+		storePath string
+		host      string
+		remove    bool
+		fields    = map[string]*string{}
+		set       = map[string]bool{}
+	)
+	host, _ = os.Hostname()
+	flags := flag.NewFlagSet("annotate", flag.ExitOnError)
+	flags.StringVar(&storePath, "store", "", "")
+	flags.StringVar(&host, "host", host, "")
+	for _, name := range []string{"owner", "ticket", "status", "note"} {
+		fields[name] = flags.String(name, "", "")
+	}
+	flags.BoolVar(&remove, "clear", false, "")
+	flags.Usage = annotateUsage
+	flags.Parse(args)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	changed := set["owner"] || set["ticket"] || set["status"] || set["note"]
+	if storePath == "" || host == "" || flags.NArg() == 0 || remove == changed {
+		annotateUsage()
+		os.Exit(1)
+	}
+	if err := store.CheckStatus(*fields["status"]); err != nil {
+		log.Fatalf("Error: --status: %v", err)
+	}
+
+	// Don't create a database if the path is wrong.
+	requireStore(map[string]string{"store": storePath})
+	if _, err := os.Stat(storePath); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	s, err := store.Open(storePath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer s.Close()
+	for _, path := range flags.Args() {
+		if remove {
+			ok, err := s.DeleteAnnotation(host, path)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			if !ok {
+				log.Printf("Warning: %s on %s isn't annotated", path, host)
+			}
+			continue
+		}
+		a, err := s.Annotation(host, path)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if a == nil {
+			a = &store.Annotation{Host: host, Path: path}
+		}
+		for name, dst := range map[string]*string{"owner": &a.Owner, "ticket": &a.Ticket, "status": &a.Status, "note": &a.Note} {
+			if set[name] {
+				*dst = *fields[name]
+			}
+		}
+		a.UpdatedBy = operator()
+		a.Updated = time.Time{}
+		if err := s.SetAnnotation(a); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+}
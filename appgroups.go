@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"log4jscanner/approot"
+	"log4jscanner/results"
+)
+
+// appGroups is a results.Sink that holds findings until the scan completes,
+// then prints them grouped by the application they're deployed in.
+type appGroups struct {
+	w      io.Writer
+	format func(f results.Finding) string
+	finder *approot.Finder
+
+	mu sync.Mutex
+	// lines holds the output lines of findings, keyed by application root.
+	lines map[string][]string
+}
+
+func newAppGroups(w io.Writer, patterns []string, format func(f results.Finding) string) *appGroups {
+	return &appGroups{
+		w:      w,
+		format: format,
+		finder: &approot.Finder{Patterns: patterns},
+		lines:  map[string][]string{},
+	}
+}
+
+// Write records the output line of a finding.
+func (a *appGroups) Write(f results.Finding) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	line := a.format(f)
+	root := f.Path
+	if f.Path != "-" {
+		root = a.finder.Root(f.Path)
+	}
+	if root != f.Path {
+		// Print paths relative to the application.
+		if rel, err := filepath.Rel(root, f.Path); err == nil {
+			line = rel + strings.TrimPrefix(line, f.Path)
+		}
+	}
+	a.lines[root] = append(a.lines[root], line)
+	return nil
+}
+
+// Flush writes every application, followed by its findings indented.
+// Findings that are their own application root are printed on one line.
+func (a *appGroups) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var roots []string
+	for root := range a.lines {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		lines := a.lines[root]
+		if len(lines) == 1 && strings.HasPrefix(lines[0], root) {
+			fmt.Fprintln(a.w, lines[0])
+			continue
+		}
+		sort.Strings(lines)
+		fmt.Fprintf(a.w, "%s (%d vulnerable JARs)\n", root, len(lines))
+		for _, line := range lines {
+			fmt.Fprintf(a.w, "    %s\n", line)
+		}
+	}
+	a.lines = map[string][]string{}
+	return nil
+}
+
+func (a *appGroups) Close() error {
+	return a.Flush()
+}
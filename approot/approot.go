@@ -0,0 +1,101 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package approot maps vulnerable JARs to the application they're deployed
+// in, so findings can be reported once per application rather than once per
+// library.
+//
+// The root of an application is the outermost of:
+//
+//   - a directory matching one of the configured patterns,
+//   - an exploded WAR, a directory holding WEB-INF,
+//   - an exploded EAR, a directory holding META-INF/application.xml,
+//   - or a WAR or EAR archive.
+//
+// JARs that don't belong to any application are their own root.
+package approot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Finder finds the application roots of paths. A Finder caches the
+// filesystem checks it makes and is not safe for concurrent use.
+type Finder struct {
+	// Patterns holds glob patterns, in the syntax of filepath.Match, of
+	// directories that are application roots, such as "/srv/apps/*".
+	Patterns []string
+
+	isRoot map[string]bool
+}
+
+// Root returns the application root of a path.
+func (f *Finder) Root(path string) string {
+	path = filepath.Clean(path)
+	root := path
+	for p := path; ; {
+		if f.check(p) {
+			root = p
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			break
+		}
+		p = parent
+	}
+	return root
+}
+
+// check returns if a path is the root of an application.
+func (f *Finder) check(p string) bool {
+	if f.isRoot == nil {
+		f.isRoot = map[string]bool{}
+	}
+	ok, cached := f.isRoot[p]
+	if cached {
+		return ok
+	}
+	ok = f.match(p) || isArchive(p) || exists(filepath.Join(p, "WEB-INF")) ||
+		exists(filepath.Join(p, "META-INF", "application.xml"))
+	f.isRoot[p] = ok
+	return ok
+}
+
+func (f *Finder) match(p string) bool {
+	for _, pattern := range f.Patterns {
+		if ok, err := filepath.Match(filepath.Clean(pattern), p); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isArchive reports if a path is a WAR or EAR archive. Exploded archives are
+// also often named with the extension, but those are detected by their
+// contents.
+func isArchive(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	if ext != ".war" && ext != ".ear" {
+		return false
+	}
+	info, err := os.Stat(p)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
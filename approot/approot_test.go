@@ -0,0 +1,59 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approot
+
+import (
+	"path/filepath"
+	"testing"
+
+	"log4jscanner/testjar"
+)
+
+func TestRoot(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{
+		"tomcat/webapps/shop/WEB-INF/lib/log4j-core-2.14.1.jar",
+		"tomcat/lib/log4j-core-2.14.1.jar",
+		"wildfly/deployments/bank.ear/META-INF/application.xml",
+		"wildfly/deployments/bank.ear/web.war/WEB-INF/lib/log4j-core-2.14.1.jar",
+		"wildfly/deployments/bank.ear/lib/log4j-core-2.14.1.jar",
+		"wildfly/deployments/app.war",
+		"srv/apps/billing/lib/log4j-core-2.14.1.jar",
+		"srv/apps/billing/plugins/extra/log4j-core-2.14.1.jar",
+	} {
+		testjar.WriteFile(t, filepath.Join(dir, filepath.FromSlash(p)), nil)
+	}
+
+	f := &Finder{Patterns: []string{filepath.Join(dir, "srv", "apps", "*")}}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"tomcat/webapps/shop/WEB-INF/lib/log4j-core-2.14.1.jar", "tomcat/webapps/shop"},
+		{"tomcat/lib/log4j-core-2.14.1.jar", "tomcat/lib/log4j-core-2.14.1.jar"},
+		{"wildfly/deployments/bank.ear/web.war/WEB-INF/lib/log4j-core-2.14.1.jar", "wildfly/deployments/bank.ear"},
+		{"wildfly/deployments/bank.ear/lib/log4j-core-2.14.1.jar", "wildfly/deployments/bank.ear"},
+		{"wildfly/deployments/app.war", "wildfly/deployments/app.war"},
+		{"srv/apps/billing/lib/log4j-core-2.14.1.jar", "srv/apps/billing"},
+		{"srv/apps/billing/plugins/extra/log4j-core-2.14.1.jar", "srv/apps/billing"},
+	}
+	for _, tc := range tests {
+		path := filepath.Join(dir, filepath.FromSlash(tc.path))
+		want := filepath.Join(dir, filepath.FromSlash(tc.want))
+		if got := f.Root(path); got != want {
+			t.Errorf("Root(%s) = %s, want %s", tc.path, got, want)
+		}
+	}
+}
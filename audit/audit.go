@@ -0,0 +1,171 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit implements an append-only, tamper-evident log of remediation
+// actions.
+//
+// The log is a file of JSON entries, one per line. Each entry records the hash
+// of the entry before it, and its own hash over its contents, so modifying or
+// removing an entry breaks the chain for every entry that follows.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"log4jscanner/readonly"
+)
+
+// Entry is a single remediation action.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Operator string    `json:"operator"`
+	Host     string    `json:"host,omitempty"`
+	// Action is the remediation performed, such as "rewrite".
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	// SHA256Before and SHA256After are hex encoded hashes of the file before
+	// and after the action.
+	SHA256Before string `json:"sha256Before,omitempty"`
+	SHA256After  string `json:"sha256After,omitempty"`
+
+	// Prev is the Hash of the previous entry, or empty for the first entry.
+	Prev string `json:"prev"`
+	// Hash is the hex encoded SHA-256 of the entry with Hash unset.
+	Hash string `json:"hash"`
+}
+
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log is an open audit log. It's safe for concurrent use.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	last string
+}
+
+// Open opens or creates the audit log at path. The existing chain is verified
+// before any entries may be appended.
+func Open(path string) (*Log, error) {
+	if err := readonly.Check("opening audit log"); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %v", err)
+	}
+	last, _, err := verify(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("verifying audit log %s: %v", path, err)
+	}
+	return &Log{f: f, last: last}, nil
+}
+
+// Append writes an entry to the log, filling in its timestamp if unset, and
+// its position in the chain. The entry is synced to disk before returning.
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Prev = l.last
+	h, err := e.hash()
+	if err != nil {
+		return fmt.Errorf("hashing entry: %v", err)
+	}
+	e.Hash = h
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding entry: %v", err)
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("writing entry: %v", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("syncing audit log: %v", err)
+	}
+	l.last = h
+	return nil
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Verify checks the chain of an audit log, returning the number of entries.
+func Verify(r io.Reader) (int, error) {
+	_, n, err := verify(r)
+	return n, err
+}
+
+func verify(r io.Reader) (last string, n int, err error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		n++
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return "", n, fmt.Errorf("entry %d: decoding: %v", n, err)
+		}
+		if e.Prev != last {
+			return "", n, fmt.Errorf("entry %d: chain broken: previous hash %q, want %q", n, e.Prev, last)
+		}
+		h, err := e.hash()
+		if err != nil {
+			return "", n, fmt.Errorf("entry %d: hashing: %v", n, err)
+		}
+		if h != e.Hash {
+			return "", n, fmt.Errorf("entry %d: hash mismatch: recorded %q, computed %q", n, e.Hash, h)
+		}
+		last = h
+	}
+	if err := s.Err(); err != nil {
+		return "", n, fmt.Errorf("reading audit log: %v", err)
+	}
+	return last, n, nil
+}
+
+// HashFile returns the hex encoded SHA-256 of a file's contents.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
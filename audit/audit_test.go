@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(p)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	for _, path := range []string{"/a.jar", "/b.jar"} {
+		e := Entry{Operator: "root", Action: "rewrite", Path: path, SHA256Before: "00", SHA256After: "11"}
+		if err := l.Append(e); err != nil {
+			t.Fatalf("Append() failed: %v", err)
+		}
+	}
+	l.Close()
+
+	// Reopening should continue the existing chain.
+	l, err = Open(p)
+	if err != nil {
+		t.Fatalf("Open() on existing log failed: %v", err)
+	}
+	if err := l.Append(Entry{Operator: "root", Action: "rewrite", Path: "/c.jar"}); err != nil {
+		t.Fatalf("Append() failed: %v", err)
+	}
+	l.Close()
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("reading log: %v", err)
+	}
+	n, err := Verify(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Verify() returned %d entries, want 3", n)
+	}
+
+	tampered := bytes.Replace(b, []byte("/b.jar"), []byte("/x.jar"), 1)
+	if _, err := Verify(bytes.NewReader(tampered)); err == nil {
+		t.Errorf("Verify() succeeded on modified entry")
+	}
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	removed := append(append([]byte{}, lines[0]...), lines[2]...)
+	if _, err := Verify(bytes.NewReader(removed)); err == nil {
+		t.Errorf("Verify() succeeded with removed entry")
+	}
+	if err := os.WriteFile(p, tampered, 0600); err != nil {
+		t.Fatalf("writing log: %v", err)
+	}
+	if _, err := Open(p); err == nil {
+		t.Errorf("Open() succeeded on tampered log")
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditd parses file events from the Linux audit subsystem, so
+// changed files can be rescanned without watching every directory.
+//
+// Events are read from the raw log format written by auditd to
+// /var/log/audit/audit.log, which is also the format audisp plugins receive
+// on stdin. Directories are watched by audit rules such as:
+//
+//	-w /opt -p wa -k log4jscanner
+//
+// Only events of rules with a given key are reported.
+package auditd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a syscall that created or modified files.
+type Event struct {
+	// Serial identifies the event, and Time is when it occurred.
+	Serial string
+	Time   time.Time
+	// Key is the key of the audit rule that matched.
+	Key string
+	// Exe is the executable that made the syscall.
+	Exe string
+	// Paths holds the absolute paths of created or modified files. Parent
+	// directories and deleted paths are omitted.
+	Paths []string
+}
+
+// Rule returns an audit rule watching dir for writes and attribute changes,
+// in auditctl syntax.
+func Rule(dir, key string) string {
+	return fmt.Sprintf("-w %s -p wa -k %s", dir, key)
+}
+
+// Read parses the records of r, calling fn with every complete event whose
+// rule has the given key. It returns once r returns io.EOF.
+func Read(r io.Reader, key string, fn func(e *Event)) error {
+	p := &parser{key: key, fn: fn}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64<<10), 1<<20)
+	for s.Scan() {
+		p.line(s.Text())
+	}
+	p.flush()
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("reading audit records: %v", err)
+	}
+	return nil
+}
+
+// parser groups records into events. Records of an event share a serial
+// number, and end with an EOE record.
+type parser struct {
+	key string
+	fn  func(e *Event)
+
+	serial string
+	time   time.Time
+	evKey  string
+	exe    string
+	cwd    string
+	paths  []pathRecord
+}
+
+type pathRecord struct {
+	name     string
+	nametype string
+}
+
+func (p *parser) line(line string) {
+	typ, serial, t, fields, ok := parseRecord(line)
+	if !ok {
+		return
+	}
+	if serial != p.serial {
+		p.flush()
+		p.serial, p.time = serial, t
+	}
+	switch typ {
+	case "SYSCALL":
+		p.evKey = fields["key"]
+		p.exe = fields["exe"]
+	case "CWD":
+		p.cwd = fields["cwd"]
+	case "PATH":
+		p.paths = append(p.paths, pathRecord{name: fields["name"], nametype: fields["nametype"]})
+	case "EOE":
+		p.flush()
+	}
+}
+
+// flush reports the current event, if any.
+func (p *parser) flush() {
+	defer func() {
+		p.serial, p.time, p.evKey, p.exe, p.cwd, p.paths = "", time.Time{}, "", "", "", nil
+	}()
+	if p.serial == "" || !hasKey(p.evKey, p.key) {
+		return
+	}
+	e := &Event{Serial: p.serial, Time: p.time, Key: p.key, Exe: p.exe}
+	for _, r := range p.paths {
+		switch r.nametype {
+		case "PARENT", "DELETE":
+			continue
+		}
+		name := r.name
+		if name == "" {
+			continue
+		}
+		if !filepath.IsAbs(name) {
+			if p.cwd == "" {
+				continue
+			}
+			name = filepath.Join(p.cwd, name)
+		}
+		e.Paths = append(e.Paths, filepath.Clean(name))
+	}
+	if len(e.Paths) > 0 {
+		p.fn(e)
+	}
+}
+
+// hasKey reports if the keys of a record include key. Rules with several keys
+// separate them by \x01.
+func hasKey(keys, key string) bool {
+	for _, k := range strings.Split(keys, "\x01") {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRecord parses a record such as:
+//
+//	type=PATH msg=audit(1639999999.123:456): item=1 name="/opt/a.jar" nametype=CREATE
+func parseRecord(line string) (typ, serial string, t time.Time, fields map[string]string, ok bool) {
+	// Records forwarded by audisp may be prefixed with a node name.
+	if strings.HasPrefix(line, "node=") {
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			line = line[i+1:]
+		}
+	}
+	if !strings.HasPrefix(line, "type=") {
+		return "", "", time.Time{}, nil, false
+	}
+	i := strings.Index(line, " msg=audit(")
+	if i < 0 {
+		return "", "", time.Time{}, nil, false
+	}
+	typ = line[len("type="):i]
+	rest := line[i+len(" msg=audit("):]
+	j := strings.Index(rest, "):")
+	if j < 0 {
+		return "", "", time.Time{}, nil, false
+	}
+	stamp := rest[:j]
+	k := strings.IndexByte(stamp, ':')
+	if k < 0 {
+		return "", "", time.Time{}, nil, false
+	}
+	// Timestamps are seconds with millisecond precision.
+	secs, millis := stamp[:k], "0"
+	if d := strings.IndexByte(secs, '.'); d >= 0 {
+		secs, millis = secs[:d], secs[d+1:]
+	}
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return "", "", time.Time{}, nil, false
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return "", "", time.Time{}, nil, false
+	}
+	t = time.Unix(sec, ms*int64(time.Millisecond)).UTC()
+	return typ, stamp[k+1:], t, parseFields(rest[j+2:]), true
+}
+
+// parseFields parses space separated key=value pairs. Values are either
+// quoted, hex encoded if they contain special characters, or "(null)".
+func parseFields(s string) map[string]string {
+	fields := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return fields
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return fields
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return fields
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+			if value == "(null)" {
+				value = ""
+			} else if key == "name" || key == "cwd" || key == "key" || key == "exe" {
+				// Untrusted strings are hex encoded when not quoted.
+				if b, err := hex.DecodeString(value); err == nil {
+					value = string(b)
+				}
+			}
+		}
+		fields[key] = value
+	}
+}
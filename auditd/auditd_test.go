@@ -0,0 +1,141 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditd
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testLog = `type=SYSCALL msg=audit(1639999999.123:100): arch=c000003e syscall=257 success=yes exit=3 comm="cp" exe="/usr/bin/cp" key="log4jscanner"
+type=CWD msg=audit(1639999999.123:100): cwd="/root"
+type=PATH msg=audit(1639999999.123:100): item=0 name="/opt/app/" inode=1 nametype=PARENT
+type=PATH msg=audit(1639999999.123:100): item=1 name="/opt/app/log4j-core-2.14.1.jar" inode=2 nametype=CREATE
+type=PROCTITLE msg=audit(1639999999.123:100): proctitle=6370
+type=EOE msg=audit(1639999999.123:100):
+type=SYSCALL msg=audit(1640000000.000:101): arch=c000003e syscall=82 success=yes exit=0 comm="mv" exe="/usr/bin/mv" key="other"
+type=PATH msg=audit(1640000000.000:101): item=0 name="/srv/a.jar" nametype=CREATE
+type=EOE msg=audit(1640000000.000:101):
+type=SYSCALL msg=audit(1640000001.500:102): arch=c000003e syscall=82 success=yes exit=0 comm="mv" exe="/usr/bin/mv" key="log4jscanner"
+type=CWD msg=audit(1640000001.500:102): cwd="/opt/app"
+type=PATH msg=audit(1640000001.500:102): item=0 name="/opt/app/" nametype=PARENT
+type=PATH msg=audit(1640000001.500:102): item=1 name="upload.tmp" nametype=DELETE
+type=PATH msg=audit(1640000001.500:102): item=2 name="lib/app.jar" nametype=CREATE
+type=EOE msg=audit(1640000001.500:102):
+node=host1 type=SYSCALL msg=audit(1640000002.000:103): syscall=2 exe="/usr/bin/java" key=` + hex.EncodeToString([]byte("backup\x01log4jscanner")) + `
+node=host1 type=PATH msg=audit(1640000002.000:103): item=0 name=` + hex.EncodeToString([]byte("/opt/my app.jar")) + ` nametype=NORMAL
+node=host1 type=SYSCALL msg=audit(1640000003.000:104): syscall=2 exe="/usr/bin/vi" key=(null)
+node=host1 type=PATH msg=audit(1640000003.000:104): item=0 name="/opt/b.jar" nametype=NORMAL
+`
+
+func TestRead(t *testing.T) {
+	var got []*Event
+	if err := Read(strings.NewReader(testLog), "log4jscanner", func(e *Event) {
+		got = append(got, e)
+	}); err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	want := []*Event{
+		{
+			Serial: "100",
+			Time:   time.Date(2021, 12, 20, 11, 33, 19, 123e6, time.UTC),
+			Key:    "log4jscanner",
+			Exe:    "/usr/bin/cp",
+			Paths:  []string{"/opt/app/log4j-core-2.14.1.jar"},
+		},
+		{
+			Serial: "102",
+			Time:   time.Date(2021, 12, 20, 11, 33, 21, 500e6, time.UTC),
+			Key:    "log4jscanner",
+			Exe:    "/usr/bin/mv",
+			Paths:  []string{"/opt/app/lib/app.jar"},
+		},
+		{
+			Serial: "103",
+			Time:   time.Date(2021, 12, 20, 11, 33, 22, 0, time.UTC),
+			Key:    "log4jscanner",
+			Exe:    "/usr/bin/java",
+			Paths:  []string{"/opt/my app.jar"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Read() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestRule(t *testing.T) {
+	if got, want := Rule("/opt", "log4jscanner"), "-w /opt -p wa -k log4jscanner"; got != want {
+		t.Errorf("Rule() = %q, want %q", got, want)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(p, []byte("old\n"), 0600); err != nil {
+		t.Fatalf("writing log: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, err := Follow(ctx, p, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Follow() failed: %v", err)
+	}
+	defer f.Close()
+
+	appendLog := func(s string) {
+		lf, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatalf("opening log: %v", err)
+		}
+		defer lf.Close()
+		if _, err := lf.WriteString(s); err != nil {
+			t.Fatalf("writing log: %v", err)
+		}
+	}
+	read := func(want string) {
+		t.Helper()
+		b := make([]byte, len(want))
+		if _, err := io.ReadFull(f, b); err != nil {
+			t.Fatalf("reading log: %v", err)
+		}
+		if string(b) != want {
+			t.Errorf("read %q, want %q", b, want)
+		}
+	}
+
+	appendLog("first\n")
+	read("first\n")
+
+	// Rotate the log, leaving a record in the old one.
+	appendLog("second\n")
+	if err := os.Rename(p, p+".1"); err != nil {
+		t.Fatalf("rotating log: %v", err)
+	}
+	appendLog("third\n")
+	read("second\nthird\n")
+
+	cancel()
+	if n, err := f.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("Read() after cancel = %d, %v, want 0, EOF", n, err)
+	}
+}
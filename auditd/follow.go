@@ -0,0 +1,113 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditd
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Follower reads a log file as it grows, like tail -F. Reading starts at the
+// end of the file, and the file is reopened from its start when it's rotated
+// or truncated.
+type Follower struct {
+	path string
+	poll time.Duration
+	ctx  context.Context
+
+	f   *os.File
+	off int64
+	// rotated is set once the log was found rotated, so the remainder of
+	// the old log is read before switching.
+	rotated bool
+}
+
+// Follow opens the log at path. Reads block until the log grows, polling every
+// poll, and return io.EOF once ctx is done.
+func Follow(ctx context.Context, path string, poll time.Duration) (*Follower, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	off, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Follower{path: path, poll: poll, ctx: ctx, f: f, off: off}, nil
+}
+
+func (f *Follower) Read(b []byte) (int, error) {
+	for {
+		n, err := f.f.Read(b)
+		f.off += int64(n)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		if f.rotated {
+			if err := f.reopen(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err := f.checkRotated(); err != nil {
+			return 0, err
+		}
+		if f.rotated {
+			continue
+		}
+		select {
+		case <-f.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(f.poll):
+		}
+	}
+}
+
+// checkRotated sets rotated if the log was rotated or truncated. A missing log
+// is waited for, since it's briefly missing while rotated.
+func (f *Follower) checkRotated() error {
+	cur, err := f.f.Stat()
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f.rotated = !os.SameFile(cur, fi) || fi.Size() < f.off
+	return nil
+}
+
+// reopen opens the log again, from its start.
+func (f *Follower) reopen() error {
+	nf, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	f.f.Close()
+	f.f, f.off, f.rotated = nf, 0, false
+	return nil
+}
+
+// Close closes the log.
+func (f *Follower) Close() error {
+	return f.f.Close()
+}
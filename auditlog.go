@@ -0,0 +1,122 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+
+	"log4jscanner/audit"
+)
+
+func auditUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner audit verify [audit log]
+
+Verifies the hash chain of an audit log written with --audit-log, reporting
+the first entry that has been modified or removed.
+
+`)
+}
+
+func auditCmd(args []string) {
+	if len(args) != 2 || args[0] != "verify" {
+		auditUsage()
+		os.Exit(1)
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer f.Close()
+	n, err := audit.Verify(f)
+	if err != nil {
+		log.Fatalf("Error: %s: %v", args[1], err)
+	}
+	fmt.Printf("%s: %d entries verified\n", args[1], n)
+}
+
+// operator returns the user performing remediation actions. When run through
+// sudo, the invoking user is reported rather than root.
+func operator() string {
+	if u := os.Getenv("SUDO_USER"); u != "" {
+		return u
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// auditor records rewrites performed by the walker to an audit log.
+type auditor struct {
+	log      *audit.Log
+	operator string
+	host     string
+	// before holds the hashes of files reported as vulnerable, taken before
+	// they're rewritten.
+	before map[string]string
+}
+
+func newAuditor(path string) (*auditor, error) {
+	l, err := audit.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	return &auditor{
+		log:      l,
+		operator: operator(),
+		host:     host,
+		before:   map[string]string{},
+	}, nil
+}
+
+// reported must be called before a file is rewritten.
+func (a *auditor) reported(path string) {
+	h, err := audit.HashFile(path)
+	if err != nil {
+		log.Printf("Error: hashing %s for audit log: %v", path, err)
+		return
+	}
+	a.before[path] = h
+}
+
+func (a *auditor) record(action, path string) {
+	after, err := audit.HashFile(path)
+	if err != nil {
+		log.Printf("Error: hashing %s for audit log: %v", path, err)
+	}
+	e := audit.Entry{
+		Operator:     a.operator,
+		Host:         a.host,
+		Action:       action,
+		Path:         path,
+		SHA256Before: a.before[path],
+		SHA256After:  after,
+	}
+	delete(a.before, path)
+	if err := a.log.Append(e); err != nil {
+		// Remediation without evidence isn't acceptable, stop here.
+		log.Fatalf("Error: writing audit log: %v", err)
+	}
+}
+
+func (a *auditor) close() {
+	if err := a.log.Close(); err != nil {
+		log.Printf("Error: closing audit log: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"log4jscanner/results"
+)
+
+// baselineScope decides which JARs of --baseline missing from the scan are
+// reported fixed: those within the scanned directories, unless the scan was
+// incomplete or failed to scan them. Its methods are safe for concurrent use.
+type baselineScope struct {
+	pathFmt *results.PathFormat
+	dirs    []string
+
+	mu       sync.Mutex
+	failed   []string
+	complete bool
+}
+
+// failedPath records a path that couldn't be scanned, such as a directory
+// that couldn't be read.
+func (s *baselineScope) failedPath(path string) {
+	s.mu.Lock()
+	s.failed = append(s.failed, path)
+	s.mu.Unlock()
+}
+
+// done records if the scan completed, before the baseline is closed.
+func (s *baselineScope) done(complete bool) {
+	s.mu.Lock()
+	s.complete = complete
+	s.mu.Unlock()
+}
+
+// includes reports if a JAR of the baseline that wasn't found again is fixed.
+func (s *baselineScope) includes(f results.Finding) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.complete && withinDirs(s.pathFmt, s.dirs, f.Path) && !withinDirs(s.pathFmt, s.failed, f.Path)
+}
+
+// withinDirs reports if the path of a finding, formatted by pathFmt, is within
+// one of dirs. Paths that are relative to the scanned directories or hashed
+// can't be told apart, and are always within them.
+func withinDirs(pathFmt *results.PathFormat, dirs []string, path string) bool {
+	if pathFmt.Relative || len(pathFmt.HashKey) > 0 {
+		return true
+	}
+	if i := strings.Index(path, "!"); i >= 0 {
+		path = path[:i]
+	}
+	path = filepath.FromSlash(path)
+	for _, dir := range dirs {
+		if dir == "-" {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(pathFmt.Format(dir)), path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+func benchUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner bench [flag] [directories]
+
+Scans the candidate archives under the provided directories repeatedly and
+prints the throughput and memory allocations of each iteration, so the
+performance of releases can be compared on a corpus of your own. Archives are
+enumerated once, and results aren't printed. Run iterations on a warm page
+cache, or drop it between runs, to compare like with like.
+
+Flags:
+
+    -n, --iterations  Number of times to scan the corpus (default 3).
+    -p, --parallel    Number of archives to scan concurrently (default the
+                      number of CPUs).
+    --pprof           Serve runtime profiles on the given address, such as
+                      localhost:6060, while benchmarking.
+    --enable-rule     Only evaluate the rule with the given ID. May be
+                      provided multiple times.
+    --disable-rule    Don't evaluate the rule with the given ID. May be
+                      provided multiple times.
+
+`)
+}
+
+// benchResult holds the measurements of one scan of a corpus.
+type benchResult struct {
+	elapsed    time.Duration
+	files      int
+	bytes      int64
+	vulnerable int
+	errors     int
+	// allocBytes and allocs are the bytes and objects allocated on the heap.
+	allocBytes uint64
+	allocs     uint64
+}
+
+func (r benchResult) String() string {
+	secs := r.elapsed.Seconds()
+	perFile := int64(0)
+	if r.files > 0 {
+		perFile = int64(r.allocBytes) / int64(r.files)
+	}
+	return fmt.Sprintf("%d archives (%s) in %s: %.1f archives/s, %.1f MiB/s, %s allocated (%s/archive) in %d allocations, %d vulnerable, %d errors",
+		r.files, formatBytes(r.bytes), r.elapsed.Round(time.Millisecond),
+		float64(r.files)/secs, float64(r.bytes)/(1<<20)/secs,
+		formatBytes(int64(r.allocBytes)), formatBytes(perFile), r.allocs,
+		r.vulnerable, r.errors)
+}
+
+func bench(args []string) {
+	var (
+		iterations int
+		parallel   int
+		pprofAddr  string
+	)
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	flags.IntVar(&iterations, "iterations", 3, "")
+	flags.IntVar(&iterations, "n", 3, "")
+	flags.IntVar(&parallel, "parallel", runtime.NumCPU(), "")
+	flags.IntVar(&parallel, "p", runtime.NumCPU(), "")
+	flags.StringVar(&pprofAddr, "pprof", "", "")
+	flags.Func("enable-rule", "", func(id string) error {
+		scanConfig.EnableRules = append(scanConfig.EnableRules, id)
+		return scanConfig.Validate()
+	})
+	flags.Func("disable-rule", "", func(id string) error {
+		scanConfig.DisableRules = append(scanConfig.DisableRules, id)
+		return scanConfig.Validate()
+	})
+	flags.Usage = benchUsage
+	flags.Parse(args)
+	if flags.NArg() == 0 || iterations < 1 || parallel < 1 {
+		benchUsage()
+		os.Exit(1)
+	}
+	if pprofAddr != "" {
+		if err := servePprof(pprofAddr); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	var (
+		paths []string
+		sizes []int64
+	)
+	skipDir := func(path string, d fs.DirEntry) bool { return false }
+	for _, dir := range flags.Args() {
+		err := walkArchives(dir, skipDir, nil, func(path string, d fs.DirEntry) {
+			info, err := d.Info()
+			if err != nil {
+				log.Printf("Error: stat %s: %v", path, err)
+				return
+			}
+			paths = append(paths, path)
+			sizes = append(sizes, info.Size())
+		})
+		if err != nil {
+			log.Printf("Error: walking %s: %v", dir, err)
+		}
+	}
+	if len(paths) == 0 {
+		log.Fatalf("Error: no candidate archives found")
+	}
+	fmt.Printf("Corpus: %d archives, %d workers, %s %s/%s\n",
+		len(paths), parallel, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	var total benchResult
+	for i := 1; i <= iterations; i++ {
+		r := benchOnce(paths, sizes, parallel)
+		fmt.Printf("Iteration %d: %s\n", i, r)
+		total.elapsed += r.elapsed
+		total.files += r.files
+		total.bytes += r.bytes
+		total.vulnerable += r.vulnerable
+		total.errors += r.errors
+		total.allocBytes += r.allocBytes
+		total.allocs += r.allocs
+	}
+	if iterations > 1 {
+		n := iterations
+		mean := benchResult{
+			elapsed:    total.elapsed / time.Duration(n),
+			files:      total.files / n,
+			bytes:      total.bytes / int64(n),
+			vulnerable: total.vulnerable / n,
+			errors:     total.errors / n,
+			allocBytes: total.allocBytes / uint64(n),
+			allocs:     total.allocs / uint64(n),
+		}
+		fmt.Printf("Mean: %s\n", mean)
+	}
+}
+
+// benchOnce scans every path with parallel workers.
+func benchOnce(paths []string, sizes []int64, parallel int) benchResult {
+	// Start every iteration from a collected heap, so garbage of the
+	// previous one isn't attributed to it.
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	var (
+		mu  sync.Mutex
+		r   benchResult
+		wg  sync.WaitGroup
+		idx = make(chan int)
+	)
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				report, err := scanFile(paths[i])
+				mu.Lock()
+				r.files++
+				r.bytes += sizes[i]
+				switch {
+				case err != nil:
+					r.errors++
+				case report != nil && report.Vulnerable:
+					r.vulnerable++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range paths {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+
+	r.elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+	r.allocBytes = after.TotalAlloc - before.TotalAlloc
+	r.allocs = after.Mallocs - before.Mallocs
+	return r
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package canary generates benign archives that log4jscanner reports as
+// vulnerable.
+//
+// Canaries let teams check a deployment end to end: that the scanner runs
+// where expected, that exclusions don't hide real locations, and that
+// findings reach whatever consumes them. A canary holds the class file names
+// and byte patterns the scanner matches, but the class files aren't valid
+// Java classes and can't be loaded by a JVM.
+package canary
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Title is the Implementation-Title of every generated archive, so canaries
+// can be told apart from real findings.
+const Title = "log4jscanner canary"
+
+// Version is the Implementation-Version of every generated archive, reported
+// as the version of findings.
+const Version = "0.0.0-canary"
+
+const (
+	lookupClass  = "org/apache/logging/log4j/core/lookup/JndiLookup.class"
+	managerClass = "org/apache/logging/log4j/core/net/JndiManager.class"
+	notice       = "log4jscanner canary: this is not a Java class and contains no log4j code.\n"
+)
+
+// managerContent matches the JndiManager constructor of log4j versions before
+// 2.15.0: "<init>", a few bytes of the constant pool, then the descriptor
+// "(Ljava/lang/String;Ljavax/naming/Context;)V".
+var managerContent = []byte(notice + "<init>\x00\x00\x00(Ljava/lang/String;Ljavax/naming/Context;)V\n")
+
+// Write writes a canary archive to w. At depth zero the signatures are in the
+// archive itself, otherwise they're in an archive nested depth levels deep,
+// like a library inside a WAR inside an EAR.
+func Write(w io.Writer, depth int) error {
+	if depth < 0 {
+		return fmt.Errorf("invalid depth %d", depth)
+	}
+	var buf bytes.Buffer
+	if err := writeLevel(&buf, 0, nil); err != nil {
+		return err
+	}
+	for level := 1; level <= depth; level++ {
+		nested := buf.Bytes()
+		var next bytes.Buffer
+		if err := writeLevel(&next, level, nested); err != nil {
+			return err
+		}
+		buf = next
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type file struct {
+	name string
+	data []byte
+}
+
+// writeLevel writes a single archive. The innermost archive, at level zero,
+// holds the signatures, and every other level holds the previous one.
+func writeLevel(w io.Writer, level int, nested []byte) error {
+	files := []file{
+		{"META-INF/MANIFEST.MF", []byte("Manifest-Version: 1.0\r\n" +
+			"Implementation-Title: " + Title + "\r\n" +
+			"Implementation-Version: " + Version + "\r\n\r\n")},
+		{"CANARY.txt", []byte(notice)},
+	}
+	if level == 0 {
+		files = append(files, file{lookupClass, []byte(notice)}, file{managerClass, managerContent})
+	} else {
+		files = append(files, file{fmt.Sprintf("lib/canary-%d.jar", level-1), nested})
+	}
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return fmt.Errorf("creating %s: %v", f.name, err)
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return fmt.Errorf("writing %s: %v", f.name, err)
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package canary
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"log4jscanner/jar"
+)
+
+func TestWrite(t *testing.T) {
+	for _, depth := range []int{0, 1, 3} {
+		t.Run(fmt.Sprintf("depth%d", depth), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, depth); err != nil {
+				t.Fatalf("Write() failed: %v", err)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatalf("reading canary: %v", err)
+			}
+			r, err := jar.Parse(zr)
+			if err != nil {
+				t.Fatalf("jar.Parse() failed: %v", err)
+			}
+			if !r.Vulnerable {
+				t.Errorf("canary not reported as vulnerable")
+			}
+			if r.Version != Version {
+				t.Errorf("canary reported version %q, want %q", r.Version, Version)
+			}
+
+			// Rewriting must neutralize the canary like a real finding.
+			var patched bytes.Buffer
+			if err := jar.Rewrite(&patched, zr); err != nil {
+				t.Fatalf("jar.Rewrite() failed: %v", err)
+			}
+			pr, err := zip.NewReader(bytes.NewReader(patched.Bytes()), int64(patched.Len()))
+			if err != nil {
+				t.Fatalf("reading rewritten canary: %v", err)
+			}
+			r, err = jar.Parse(pr)
+			if err != nil {
+				t.Fatalf("jar.Parse() of rewritten canary failed: %v", err)
+			}
+			if r.Vulnerable {
+				t.Errorf("rewritten canary reported as vulnerable")
+			}
+		})
+	}
+}
+
+func TestWriteInvalidDepth(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, -1); err == nil {
+		t.Errorf("Write() with negative depth succeeded, expected error")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"log4jscanner/canary"
+)
+
+func canaryUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner canary [flag] [output]
+
+Writes a benign archive that log4jscanner reports as vulnerable, to validate
+that a deployment detects and reports findings end to end. The archive holds
+the file names and byte patterns the scanner matches, but no log4j code, and
+its findings report the version "`+canary.Version+`". If output is "-", the
+archive is written to stdout.
+
+Flags:
+
+    -d, --depth    Number of archives the signatures are nested within
+                   (default 0). For example, 2 is like a JAR inside a WAR
+                   inside an EAR.
+
+`)
+}
+
+func canaryCmd(args []string) {
+	var depth int
+	flags := flag.NewFlagSet("canary", flag.ExitOnError)
+	flags.IntVar(&depth, "depth", 0, "")
+	flags.IntVar(&depth, "d", 0, "")
+	flags.Usage = canaryUsage
+	flags.Parse(args)
+	if flags.NArg() != 1 || depth < 0 {
+		canaryUsage()
+		os.Exit(1)
+	}
+
+	out := flags.Arg(0)
+	if out == "-" {
+		if err := canary.Write(os.Stdout, depth); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := canary.Write(f, depth); err != nil {
+		f.Close()
+		log.Fatalf("Error: writing %s: %v", out, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Error: writing %s: %v", out, err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"log4jscanner/jar"
+)
+
+func carveUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner carve [flag] IMAGE...
+
+Finds JARs and loose log4j classes in raw disk images or block devices, such
+as /dev/sdb1, without reading their filesystem, for forensics on disks whose
+filesystem is damaged or was reformatted. JARs are found by their ZIP
+headers and recovered up to the first entry that's cut short, like with
+--salvage, and classes by their magic number. Prints the offset of each
+vulnerable JAR and the log4j classes found outside of any JAR.
+
+Exits with status 3 if a vulnerable JAR or class was found, and 4 if an
+image couldn't be read.
+
+Flags:
+
+    --output-dir  Write each vulnerable JAR recovered to the given directory
+                  as IMAGE-OFFSET.jar, with a central directory rebuilt for
+                  its entries, for analysis with other tools.
+    --all         Also print the JARs that aren't vulnerable.
+    --format      Output format, "text" (default) or "json", one object per
+                  JAR or set of loose classes.
+
+`)
+}
+
+// carveResult is a JAR or the loose classes carved from an image.
+type carveResult struct {
+	Image  string `json:"image"`
+	Offset int64  `json:"offset"`
+	// Size is the length of the JAR's entries, zero for loose classes.
+	Size       int64    `json:"size,omitempty"`
+	Vulnerable bool     `json:"vulnerable"`
+	CVEs       []string `json:"cves,omitempty"`
+	Rules      []string `json:"rules,omitempty"`
+	// Classes lists the offsets of the loose classes by path.
+	Classes map[string]int64 `json:"classes,omitempty"`
+	// Errors lists the entries that couldn't be scanned, and Error the
+	// error scanning the JAR as a whole.
+	Errors []string `json:"errors,omitempty"`
+	Error  string   `json:"error,omitempty"`
+	// Recovered is the file the JAR was written to with --output-dir.
+	Recovered string `json:"recovered,omitempty"`
+}
+
+func carveCmd(args []string) {
+	var (
+		outputDir string
+		all       bool
+		format    = "text"
+	)
+	flags := flag.NewFlagSet("carve", flag.ExitOnError)
+	flags.StringVar(&outputDir, "output-dir", "", "")
+	flags.BoolVar(&all, "all", false, "")
+	flags.StringVar(&format, "format", format, "")
+	flags.Usage = carveUsage
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		carveUsage()
+		os.Exit(exitStatusUsage)
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("Error: unknown --format %q, expected text or json", format)
+	}
+	if outputDir != "" {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			log.Fatalf("Error: creating output directory: %v", err)
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	var vulnerable, failed bool
+	for _, image := range flags.Args() {
+		err := carveImage(image, func(c *jar.Carved) error {
+			res := carveResult{Image: image, Offset: c.Offset, Size: c.Size, Classes: c.Classes}
+			if c.Err != nil {
+				res.Error = c.Err.Error()
+				failed = true
+			} else {
+				res.Vulnerable = c.Report.Vulnerable
+				res.CVEs = c.Report.CVEs
+				res.Rules = c.Report.Rules
+				for _, e := range c.Report.Errors {
+					res.Errors = append(res.Errors, e.Error())
+				}
+			}
+			if !res.Vulnerable && res.Error == "" && !all {
+				return nil
+			}
+			if res.Vulnerable {
+				vulnerable = true
+				if outputDir != "" && c.JAR() != nil {
+					path, err := writeCarved(outputDir, image, c)
+					if err != nil {
+						return err
+					}
+					res.Recovered = path
+				}
+			}
+			if format == "json" {
+				return enc.Encode(res)
+			}
+			printCarved(&res)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error: carving %s: %v", image, err)
+			failed = true
+		}
+	}
+	switch {
+	case vulnerable:
+		os.Exit(exitStatusFindings)
+	case failed:
+		os.Exit(exitStatusErrors)
+	}
+}
+
+// carveImage carves an image or block device. Its size is found by seeking
+// to its end, since block devices report a size of zero.
+func carveImage(image string, fn func(*jar.Carved) error) error {
+	f, err := os.Open(image)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("determining size: %v", err)
+	}
+	return scanConfig.Carve(context.Background(), f, size, fn)
+}
+
+// writeCarved writes a JAR recovered from an image to dir, returning its
+// path. Existing files aren't overwritten.
+func writeCarved(dir, image string, c *jar.Carved) (string, error) {
+	name := fmt.Sprintf("%s-%d.jar", filepath.Base(image), c.Offset)
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("writing recovered JAR: %v", err)
+	}
+	if _, err := io.Copy(f, c.JAR()); err != nil {
+		f.Close()
+		return "", fmt.Errorf("writing recovered JAR %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("writing recovered JAR %s: %v", path, err)
+	}
+	return path, nil
+}
+
+// printCarved prints a carved JAR or the loose classes as text.
+func printCarved(res *carveResult) {
+	status := "not vulnerable"
+	switch {
+	case res.Error != "":
+		status = "error: " + res.Error
+	case res.Vulnerable:
+		status = strings.Join(res.CVEs, ", ")
+	}
+	if res.Classes == nil {
+		fmt.Printf("%s@0x%x (%d bytes): %s\n", res.Image, res.Offset, res.Size, status)
+	} else {
+		fmt.Printf("%s loose classes: %s\n", res.Image, status)
+		var paths []string
+		for p := range res.Classes {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			fmt.Printf("    %s@0x%x\n", p, res.Classes[p])
+		}
+	}
+	for _, e := range res.Errors {
+		fmt.Printf("    error: %s\n", e)
+	}
+	if res.Recovered != "" {
+		fmt.Printf("    recovered to %s\n", res.Recovered)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"log4jscanner/readonly"
+)
+
+// coverage records the scope of a scan for --coverage-report: the roots and
+// mounts considered, every directory walked, and why paths were skipped. It
+// proves what a scan covered even if nothing was found.
+type coverage struct {
+	// roots and the paths of entries are absolute, so they can be
+	// compared to mount points.
+	roots []string
+	cwd   string
+
+	mu      sync.Mutex
+	entries map[string]*coverageEntry
+}
+
+type coverageEntry struct {
+	kind   string // "root", "mount", "directory", or "file"
+	status string // "scanned", "skipped", "error", or "out of scope"
+	reason string
+}
+
+func newCoverage(roots []string) *coverage {
+	c := &coverage{entries: map[string]*coverageEntry{}}
+	c.cwd, _ = os.Getwd()
+	for _, r := range roots {
+		if r != "-" {
+			c.roots = append(c.roots, c.abs(r))
+		}
+	}
+	return c
+}
+
+func (c *coverage) abs(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(c.cwd, path)
+}
+
+func (c *coverage) set(path, kind, status, reason string) {
+	path = c.abs(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = &coverageEntry{kind: kind, status: status, reason: reason}
+}
+
+// wrap returns skipDir, recording the directories it walks and the paths it
+// skips.
+func (c *coverage) wrap(skipDir func(path string, d fs.DirEntry) bool) func(path string, d fs.DirEntry) bool {
+	return func(path string, d fs.DirEntry) bool {
+		skip := skipDir(path, d)
+		if !skip && d.IsDir() {
+			c.set(path, "directory", "scanned", "")
+		}
+		return skip
+	}
+}
+
+// skipped records a path skipped by SkipDir.
+func (c *coverage) skipped(path, reason string) {
+	kind := "file"
+	if fi, err := os.Lstat(path); err == nil && fi.IsDir() {
+		kind = "directory"
+	}
+	c.set(path, kind, "skipped", reason)
+}
+
+// failed records a path that couldn't be scanned. Errors of files inside a
+// walked directory don't affect the directory's coverage.
+func (c *coverage) failed(path string, err error) {
+	kind := "file"
+	if fi, serr := os.Lstat(path); serr == nil && fi.IsDir() {
+		kind = "directory"
+	}
+	c.set(path, kind, "error", err.Error())
+}
+
+// inScope reports if path is one of the roots or inside one.
+func (c *coverage) inScope(path string) bool {
+	for _, r := range c.roots {
+		if rel, err := filepath.Rel(r, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes the report as CSV to path, sorted by path. Mounts that weren't
+// reached by the scan are listed as out of scope, or as not walked if they're
+// inside a root but were never visited.
+func (c *coverage) write(path string, mounts []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.roots {
+		e, ok := c.entries[r]
+		if !ok {
+			e = &coverageEntry{status: "error", reason: "not walked"}
+			c.entries[r] = e
+		}
+		e.kind = "root"
+	}
+	for _, m := range mounts {
+		e, ok := c.entries[m]
+		switch {
+		case ok:
+			if e.kind != "root" {
+				e.kind = "mount"
+			}
+		case c.inScope(m):
+			// Inside a skipped or unreadable directory.
+			c.entries[m] = &coverageEntry{kind: "mount", status: "skipped", reason: "parent not walked"}
+		default:
+			c.entries[m] = &coverageEntry{kind: "mount", status: "out of scope"}
+		}
+	}
+
+	var paths []string
+	for p := range c.entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	if err := readonly.Check("writing coverage report"); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating coverage report: %v", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"path", "kind", "status", "reason"})
+	for _, p := range paths {
+		e := c.entries[p]
+		w.Write([]string{p, e.kind, e.status, e.reason})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing coverage report: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing coverage report: %v", err)
+	}
+	return nil
+}
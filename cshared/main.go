@@ -0,0 +1,193 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The cshared program exposes the jar package through a C ABI so other
+// languages can embed the scanner through FFI. Build it with:
+//
+//	go build -buildmode=c-shared -o liblog4jscanner.so ./cshared
+//
+// All functions return a JSON document as a C string that must be released
+// with Log4jFree. The document has the form:
+//
+//	{
+//	  "results": [{
+//	    "path": "...", "vulnerable": true, "mainClass": "...", "version": "...",
+//	    "bundle": {"symbolicName": "...", "version": "...", "exportPackage": ["..."]}
+//	  }],
+//	  "errors": [{"path": "...", "error": "..."}]
+//	}
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+
+	"log4jscanner/jar"
+)
+
+type result struct {
+	Path       string  `json:"path"`
+	Vulnerable bool    `json:"vulnerable"`
+	MainClass  string  `json:"mainClass,omitempty"`
+	Version    string  `json:"version,omitempty"`
+	Bundle     *bundle `json:"bundle,omitempty"`
+}
+
+type bundle struct {
+	SymbolicName  string   `json:"symbolicName"`
+	Version       string   `json:"version,omitempty"`
+	ExportPackage []string `json:"exportPackage,omitempty"`
+}
+
+type scanError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type response struct {
+	Results []result    `json:"results"`
+	Errors  []scanError `json:"errors"`
+}
+
+func (r *response) addReport(path string, rep *jar.Report) {
+	res := result{
+		Path:       path,
+		Vulnerable: rep.Vulnerable,
+		MainClass:  rep.MainClass,
+		Version:    rep.Version,
+	}
+	if b := rep.Bundle; b.SymbolicName != "" {
+		res.Bundle = &bundle{
+			SymbolicName:  b.SymbolicName,
+			Version:       b.Version,
+			ExportPackage: b.ExportPackage,
+		}
+	}
+	r.Results = append(r.Results, res)
+}
+
+func (r *response) addError(path string, err error) {
+	r.Errors = append(r.Errors, scanError{Path: path, Error: err.Error()})
+}
+
+func (r *response) cString() *C.char {
+	if r.Results == nil {
+		r.Results = []result{}
+	}
+	if r.Errors == nil {
+		r.Errors = []scanError{}
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		// Only plain strings and bools are encoded, so this should never happen.
+		panic(fmt.Sprintf("encoding response: %v", err))
+	}
+	return C.CString(string(b))
+}
+
+// scanReaderAt parses a single archive. Files that aren't JARs are reported
+// as not vulnerable.
+func scanReaderAt(ra io.ReaderAt, size int64) (*jar.Report, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		if err == zip.ErrFormat {
+			return &jar.Report{}, nil
+		}
+		return nil, fmt.Errorf("opening file as a ZIP archive: %v", err)
+	}
+	if !jar.IsJAR(zr) {
+		return &jar.Report{}, nil
+	}
+	r, err := jar.Parse(zr)
+	if err != nil {
+		return nil, fmt.Errorf("scanning jar: %v", err)
+	}
+	return r, nil
+}
+
+// Log4jScanBuffer scans an in-memory archive of the given length.
+//
+//export Log4jScanBuffer
+func Log4jScanBuffer(buf unsafe.Pointer, n C.int) *C.char {
+	var resp response
+	if n < 0 {
+		resp.addError("", fmt.Errorf("invalid buffer length %d", n))
+		return resp.cString()
+	}
+	b := C.GoBytes(buf, n)
+	r, err := scanReaderAt(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		resp.addError("", err)
+	} else {
+		resp.addReport("", r)
+	}
+	return resp.cString()
+}
+
+// Log4jScanPath scans a single archive, or walks a directory reporting every
+// vulnerable JAR within it.
+//
+//export Log4jScanPath
+func Log4jScanPath(cpath *C.char) *C.char {
+	var resp response
+	path := C.GoString(cpath)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		resp.addError(path, err)
+		return resp.cString()
+	}
+	if !info.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			resp.addError(path, err)
+			return resp.cString()
+		}
+		defer f.Close()
+		r, err := scanReaderAt(f, info.Size())
+		if err != nil {
+			resp.addError(path, err)
+		} else {
+			resp.addReport(path, r)
+		}
+		return resp.cString()
+	}
+
+	w := jar.Walker{
+		HandleError:  resp.addError,
+		HandleReport: resp.addReport,
+	}
+	if err := w.Walk(path); err != nil {
+		resp.addError(path, err)
+	}
+	return resp.cString()
+}
+
+// Log4jFree releases a string returned by one of the scan functions.
+//
+//export Log4jFree
+func Log4jFree(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// main is required for -buildmode=c-shared but is never called.
+func main() {}
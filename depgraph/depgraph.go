@@ -0,0 +1,133 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package depgraph builds a dependency graph of the JARs of a directory tree
+// from their manifests' Class-Path attributes and jar indexes, and finds the
+// entry points that transitively reference a vulnerable JAR.
+//
+// A vulnerable library only matters if something loads it, so entry points
+// reaching one identify the applications to remediate first.
+package depgraph
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"log4jscanner/jar"
+)
+
+// Graph holds JARs and their references. It's safe for concurrent use.
+type Graph struct {
+	mu    sync.Mutex
+	nodes map[string]*node
+	// referenced holds the paths referenced by any JAR.
+	referenced map[string]bool
+}
+
+type node struct {
+	vulnerable bool
+	mainClass  string
+	refs       []string
+}
+
+// Add records a scanned JAR, such as from jar.Walker's HandleJAR.
+func (g *Graph) Add(path string, r *jar.Report) {
+	n := &node{vulnerable: r.Vulnerable, mainClass: r.MainClass}
+	for _, ref := range append(append([]string(nil), r.ClassPath...), r.Index...) {
+		if strings.HasSuffix(ref, "/") || strings.Contains(ref, ":") {
+			// Directories and absolute URLs don't reference JARs on disk.
+			continue
+		}
+		n.refs = append(n.refs, filepath.Join(filepath.Dir(path), filepath.FromSlash(ref)))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.nodes == nil {
+		g.nodes = map[string]*node{}
+		g.referenced = map[string]bool{}
+	}
+	g.nodes[path] = n
+	for _, ref := range n.refs {
+		g.referenced[ref] = true
+	}
+}
+
+// Reach is a vulnerable JAR referenced by an entry point.
+type Reach struct {
+	// Entry is the entry point: a JAR with a Main-Class or references of its
+	// own that no other JAR references.
+	Entry string
+	// Vulnerable is the vulnerable JAR.
+	Vulnerable string
+	// Via is the shortest chain of references from Entry to Vulnerable,
+	// including both.
+	Via []string
+}
+
+// Reaches returns every vulnerable JAR referenced by each entry point, sorted
+// by entry point then vulnerable JAR. Entry points that are vulnerable
+// themselves are included, with a chain of a single JAR. References to JARs
+// that weren't added are ignored, since whether they're vulnerable is
+// unknown.
+func (g *Graph) Reaches() []Reach {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var entries []string
+	for p, n := range g.nodes {
+		if g.referenced[p] || (n.mainClass == "" && len(n.refs) == 0) {
+			continue
+		}
+		entries = append(entries, p)
+	}
+	sort.Strings(entries)
+
+	var reaches []Reach
+	for _, entry := range entries {
+		// Breadth first, so the first chain found is the shortest.
+		prev := map[string]string{entry: ""}
+		queue := []string{entry}
+		var found []string
+		for len(queue) > 0 {
+			p := queue[0]
+			queue = queue[1:]
+			n, ok := g.nodes[p]
+			if !ok {
+				continue
+			}
+			if n.vulnerable {
+				found = append(found, p)
+			}
+			for _, ref := range n.refs {
+				if _, seen := prev[ref]; seen {
+					continue
+				}
+				prev[ref] = p
+				queue = append(queue, ref)
+			}
+		}
+		sort.Strings(found)
+		for _, v := range found {
+			var via []string
+			for p := v; p != ""; p = prev[p] {
+				via = append([]string{p}, via...)
+			}
+			reaches = append(reaches, Reach{Entry: entry, Vulnerable: v, Via: via})
+		}
+	}
+	return reaches
+}
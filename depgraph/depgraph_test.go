@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package depgraph
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func TestReaches(t *testing.T) {
+	g := &Graph{}
+	// app.jar -> lib/a.jar -> lib/log4j-core.jar, and app.jar indexes
+	// lib/b.jar -> lib/a.jar.
+	g.Add("/srv/app/app.jar", &jar.Report{
+		MainClass: "com.example.Main",
+		ClassPath: []string{"lib/a.jar", "lib/missing.jar", "conf/", "file:/etc/x.jar"},
+		Index:     []string{"lib/b.jar"},
+	})
+	g.Add("/srv/app/lib/a.jar", &jar.Report{ClassPath: []string{"log4j-core.jar"}})
+	g.Add("/srv/app/lib/b.jar", &jar.Report{ClassPath: []string{"a.jar"}})
+	g.Add("/srv/app/lib/log4j-core.jar", &jar.Report{Vulnerable: true})
+	// A vulnerable standalone tool.
+	g.Add("/opt/tool.jar", &jar.Report{Vulnerable: true, MainClass: "Tool"})
+	// Not an entry point: no Main-Class or references.
+	g.Add("/opt/unused.jar", &jar.Report{Vulnerable: true})
+	// Safe application.
+	g.Add("/opt/safe/safe.jar", &jar.Report{MainClass: "Safe", ClassPath: []string{"dep.jar"}})
+	g.Add("/opt/safe/dep.jar", &jar.Report{})
+
+	want := []Reach{
+		{
+			Entry:      "/opt/tool.jar",
+			Vulnerable: "/opt/tool.jar",
+			Via:        []string{"/opt/tool.jar"},
+		},
+		{
+			Entry:      "/srv/app/app.jar",
+			Vulnerable: "/srv/app/lib/log4j-core.jar",
+			Via:        []string{"/srv/app/app.jar", "/srv/app/lib/a.jar", "/srv/app/lib/log4j-core.jar"},
+		},
+	}
+	if diff := cmp.Diff(want, g.Reaches()); diff != "" {
+		t.Errorf("Reaches() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestReachesCycle(t *testing.T) {
+	g := &Graph{}
+	g.Add("/a/main.jar", &jar.Report{MainClass: "Main", ClassPath: []string{"x.jar"}})
+	g.Add("/a/x.jar", &jar.Report{ClassPath: []string{"y.jar"}})
+	g.Add("/a/y.jar", &jar.Report{Vulnerable: true, ClassPath: []string{"x.jar"}})
+	want := []Reach{{
+		Entry:      "/a/main.jar",
+		Vulnerable: "/a/y.jar",
+		Via:        []string{"/a/main.jar", "/a/x.jar", "/a/y.jar"},
+	}}
+	if diff := cmp.Diff(want, g.Reaches()); diff != "" {
+		t.Errorf("Reaches() returned diff (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/queue"
+	"log4jscanner/results"
+	"log4jscanner/tlsconfig"
+)
+
+// shutdownGrace is how long the coordinator keeps serving after the last
+// result, so idle workers are told there's no more work rather than finding
+// the coordinator gone.
+const shutdownGrace = 5 * time.Second
+
+func coordinatorUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner coordinator [flag] [directories]
+
+Walks the provided directories and serves every candidate archive to workers
+started with "log4jscanner worker". Paths must be readable by the workers at
+the same location, for example through a shared mount. Paths of vulnerable
+JARs are printed to stdout as workers report them, or once every path is
+scanned with --sort.
+
+Flags:
+
+    -l, --listen         Address to listen on (default ":8000").
+    --list               File containing additional paths to scan, one per
+                         line. Lines may be http:// or https:// URLs, such as
+                         signed object-store URLs, which workers download.
+    --lease-timeout      How long a worker has to scan a path before it's
+                         handed to another worker (default 10m).
+    -s, --skip           Glob pattern to skip when scanning (e.g. '/var/run/*').
+                         May be provided multiple times.
+    --sort               Hold paths of vulnerable JARs until every path is
+                         scanned, then print them sorted, so the output of
+                         runs can be diffed.
+    -v, --verbose        Print verbose logs to stderr.
+`+serverTLSUsage+`
+`)
+}
+
+func coordinator(args []string) {
+	var (
+		listen       string
+		list         string
+		leaseTimeout time.Duration
+		verbose      bool
+		sortOutput   bool
+		toSkip       []string
+		tlsOpts      tlsconfig.Options
+	)
+	appendSkip := func(dir string) error {
+		toSkip = append(toSkip, dir)
+		return nil
+	}
+	flags := flag.NewFlagSet("coordinator", flag.ExitOnError)
+	flags.StringVar(&listen, "listen", ":8000", "")
+	flags.StringVar(&listen, "l", ":8000", "")
+	flags.StringVar(&list, "list", "", "")
+	flags.DurationVar(&leaseTimeout, "lease-timeout", 10*time.Minute, "")
+	flags.BoolVar(&sortOutput, "sort", false, "")
+	flags.BoolVar(&verbose, "verbose", false, "")
+	flags.BoolVar(&verbose, "v", false, "")
+	flags.Func("s", "", appendSkip)
+	flags.Func("skip", "", appendSkip)
+	serverTLSFlags(flags, &tlsOpts)
+	flags.Usage = coordinatorUsage
+	flags.Parse(args)
+	dirs := flags.Args()
+	if len(dirs) == 0 && list == "" {
+		coordinatorUsage()
+		os.Exit(1)
+	}
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	logf := func(format string, v ...interface{}) {
+		if verbose {
+			log.Printf(format, v...)
+		}
+	}
+
+	var out results.Sink = results.NewText(os.Stdout)
+	if sortOutput {
+		out = results.Sorted(out)
+	}
+	c := &queue.Coordinator{
+		LeaseTimeout: leaseTimeout,
+		HandleResult: func(r queue.Result) {
+			if r.Error != "" {
+				log.Printf("Error: scanning %s on %s: %s", r.Path, r.Worker, r.Error)
+				return
+			}
+			if r.Vulnerable {
+				out.Write(results.Finding{Path: r.Path, Time: time.Now().UTC()})
+			}
+		},
+	}
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.Fatalf("Error: listening on %s: %v", listen, err)
+	}
+	srv := &http.Server{Handler: c}
+	if tlsOpts.Enabled() {
+		if srv.TLSConfig, err = tlsconfig.Server(tlsOpts); err != nil {
+			log.Fatalf("Error: configuring TLS: %v", err)
+		}
+		ln = tls.NewListener(ln, srv.TLSConfig)
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error: serving: %v", err)
+		}
+	}()
+	logf("Listening on %s", ln.Addr())
+
+	n := 0
+	skipDir := newSkipDir(toSkip, nil, nil, nil, logf, nil)
+	for _, dir := range dirs {
+		logf("Enumerating %s", dir)
+		err := walkArchives(dir, skipDir, nil, func(path string, d fs.DirEntry) {
+			c.Add(path)
+			n++
+		})
+		if err != nil {
+			log.Printf("Error: walking %s: %v", dir, err)
+		}
+	}
+	if list != "" {
+		if err := readList(list, func(path string) {
+			c.Add(path)
+			n++
+		}); err != nil {
+			log.Fatalf("Error: reading %s: %v", list, err)
+		}
+	}
+	c.Close()
+	logf("Queued %d paths", n)
+
+	<-c.Done()
+	if err := out.Close(); err != nil {
+		log.Printf("Error: writing results: %v", err)
+	}
+	time.Sleep(shutdownGrace)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+}
+
+// walkArchives calls fn for every regular file under dir that may be a JAR,
+// as selected by detect.
+func walkArchives(dir string, skipDir func(path string, d fs.DirEntry) bool, detect *jar.Detect, fn func(path string, d fs.DirEntry)) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error: walking %s: %v", p, err)
+			return nil
+		}
+		if skipDir(p, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && detect.Candidate(p) {
+			fn(p, d)
+		}
+		return nil
+	})
+}
+
+// readList calls fn for every non-empty line of a file.
+func readList(path string, fn func(line string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			fn(line)
+		}
+	}
+	return s.Err()
+}
+
+func workerUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner worker [flag]
+
+Leases archives from a coordinator started with "log4jscanner coordinator",
+scans them, and reports the results back. Exits once the coordinator has no
+more work. Requests to the coordinator are retried with backoff, so workers
+survive the coordinator restarting or being briefly unreachable.
+
+The TLS flags also apply to archives leased as https:// URLs.
+
+Flags:
+
+    -c, --coordinator  URL of the coordinator (e.g. http://host:8000).
+    --name             Name reported to the coordinator (default hostname).
+    -p, --parallel     Number of archives to scan concurrently (default 1).
+`+clientTLSUsage+`
+`)
+}
+
+func worker(args []string) {
+	var (
+		url      string
+		name     string
+		parallel int
+		tlsOpts  tlsconfig.Options
+	)
+	hostname, _ := os.Hostname()
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	flags.StringVar(&url, "coordinator", "", "")
+	flags.StringVar(&url, "c", "", "")
+	flags.StringVar(&name, "name", hostname, "")
+	flags.IntVar(&parallel, "parallel", 1, "")
+	flags.IntVar(&parallel, "p", 1, "")
+	clientTLSFlags(flags, &tlsOpts)
+	flags.Usage = workerUsage
+	flags.Parse(args)
+	if url == "" || parallel < 1 || flags.NArg() != 0 {
+		workerUsage()
+		os.Exit(1)
+	}
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	client, err := tlsconfig.HTTPClient(tlsOpts)
+	if err != nil {
+		log.Fatalf("Error: configuring TLS: %v", err)
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	for i := 0; i < parallel; i++ {
+		w := &queue.Worker{
+			URL:    url,
+			Name:   name,
+			Client: client,
+			Scan: func(ctx context.Context, path string) queue.Result {
+				return scanTask(ctx, client, path)
+			},
+			OnRetry: func(err error, delay time.Duration) {
+				log.Printf("Warning: %v, retrying in %s", err, delay)
+			},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Let the other workers finish the archives they're
+			// scanning rather than exiting immediately.
+			if err := w.Run(context.Background()); err != nil {
+				log.Printf("Error: %v", err)
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// scanTask scans a path leased from the coordinator. Paths may be local files
+// or URLs, which are fetched with client so they're subject to the same TLS
+// configuration as the coordinator.
+func scanTask(ctx context.Context, client *http.Client, path string) queue.Result {
+	var (
+		r   *jar.Report
+		err error
+	)
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		r, err = scanURL(ctx, client, path)
+	} else {
+		r, err = scanFile(path)
+	}
+	if err != nil {
+		return queue.Result{Error: err.Error()}
+	}
+	if r == nil {
+		return queue.Result{}
+	}
+	return queue.Result{
+		Vulnerable: r.Vulnerable,
+		MainClass:  r.MainClass,
+		Version:    r.Version,
+
+		BundleSymbolicName: r.Bundle.SymbolicName,
+		BundleVersion:      r.Bundle.Version,
+	}
+}
+
+func scanURL(ctx context.Context, client *http.Client, url string) (*jar.Report, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+	return scanStream(resp.Body)
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScanTaskURL(t *testing.T) {
+	srv := httptest.NewTLSServer(http.FileServer(http.Dir("jar/testdata")))
+	defer srv.Close()
+	url := srv.URL + "/log4j-core-2.14.0.jar"
+
+	// The worker's client trusts the server's certificate.
+	r := scanTask(context.Background(), srv.Client(), url)
+	if r.Error != "" {
+		t.Fatalf("scanTask(%s) returned error: %s", url, r.Error)
+	}
+	if !r.Vulnerable {
+		t.Errorf("scanTask(%s) didn't report vulnerable archive", url)
+	}
+
+	// Without the worker's TLS configuration the certificate isn't
+	// trusted.
+	if r := scanTask(context.Background(), &http.Client{}, url); r.Error == "" {
+		t.Errorf("scanTask(%s) with default client succeeded, want certificate error", url)
+	}
+}
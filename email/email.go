@@ -0,0 +1,279 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package email sends the summary of a scan to a list of recipients over
+// SMTP, for teams without a SIEM or log pipeline to collect results.
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// Config is the JSON configuration file format for email reports.
+type Config struct {
+	// Server is the host:port of the SMTP server, such as
+	// "smtp.example.com:587". STARTTLS is used if the server supports it.
+	Server string `json:"server"`
+	// From is the sender address.
+	From string `json:"from"`
+	// To holds the recipient addresses.
+	To []string `json:"to"`
+	// Username, if set, authenticates with the server using PLAIN
+	// authentication, which requires TLS unless the server is localhost.
+	Username string `json:"username,omitempty"`
+	// PasswordEnv names the environment variable holding the password, so
+	// the configuration file isn't a secret.
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+	// Subject overrides the default subject. "{{host}}" and "{{findings}}"
+	// are replaced by the hostname and number of findings.
+	Subject string `json:"subject,omitempty"`
+	// AttachHTML attaches the report as an HTML file.
+	AttachHTML bool `json:"attachHTML,omitempty"`
+	// OnlyFindings doesn't send a report if nothing was found.
+	OnlyFindings bool `json:"onlyFindings,omitempty"`
+}
+
+// LoadConfig reads a JSON email configuration file.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if c.Server == "" {
+		return nil, fmt.Errorf("parsing %s: no server", path)
+	}
+	if c.From == "" {
+		return nil, fmt.Errorf("parsing %s: no sender", path)
+	}
+	if len(c.To) == 0 {
+		return nil, fmt.Errorf("parsing %s: no recipients", path)
+	}
+	if c.PasswordEnv != "" && os.Getenv(c.PasswordEnv) == "" {
+		return nil, fmt.Errorf("parsing %s: $%s is not set", path, c.PasswordEnv)
+	}
+	return &c, nil
+}
+
+// Summary is the outcome of a scan.
+type Summary struct {
+	Host        string
+	Started     time.Time
+	Finished    time.Time
+	Directories []string
+	Findings    []Finding
+	// Errors counts the paths that couldn't be scanned.
+	Errors int
+}
+
+// Finding is a vulnerable JAR.
+type Finding struct {
+	Path     string
+	Version  string
+	CVEs     []string
+	Severity jar.Severity
+	// Rewritten is set if the JAR was patched by the scan.
+	Rewritten bool
+}
+
+const defaultSubject = "log4jscanner: {{findings}} vulnerable JARs on {{host}}"
+
+func (c *Config) subject(s *Summary) string {
+	subject := c.Subject
+	if subject == "" {
+		subject = defaultSubject
+	}
+	return strings.NewReplacer(
+		"{{host}}", s.Host,
+		"{{findings}}", fmt.Sprint(len(s.Findings)),
+	).Replace(subject)
+}
+
+// Send emails the summary to the configured recipients.
+func Send(c *Config, s *Summary) error {
+	if c.OnlyFindings && len(s.Findings) == 0 {
+		return nil
+	}
+	msg, err := Message(c, s, time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if c.Username != "" {
+		host, _, err := net.SplitHostPort(c.Server)
+		if err != nil {
+			return fmt.Errorf("invalid server %q: %v", c.Server, err)
+		}
+		auth = smtp.PlainAuth("", c.Username, os.Getenv(c.PasswordEnv), host)
+	}
+	if err := smtp.SendMail(c.Server, auth, c.From, c.To, msg); err != nil {
+		return fmt.Errorf("sending email through %s: %v", c.Server, err)
+	}
+	return nil
+}
+
+// Message returns the email of a summary, including headers.
+func Message(c *Config, s *Summary, date time.Time) ([]byte, error) {
+	for _, addr := range append([]string{c.From}, c.To...) {
+		if strings.ContainsAny(addr, "\r\n") {
+			return nil, errors.New("invalid address: contains a newline")
+		}
+	}
+	subject := c.subject(s)
+
+	var text bytes.Buffer
+	writeText(&text, s)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", c.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", encodeHeader(subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+
+	if !c.AttachHTML {
+		fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n")
+		fmt.Fprintf(&b, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQP(&b, text.Bytes()); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	var html bytes.Buffer
+	if err := reportTmpl.Execute(&html, s); err != nil {
+		return nil, fmt.Errorf("rendering report: %v", err)
+	}
+	mw := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+	parts := []struct {
+		header textproto.MIMEHeader
+		body   []byte
+	}{
+		{textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, text.Bytes()},
+		{textproto.MIMEHeader{
+			"Content-Type":              {"text/html; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+			"Content-Disposition":       {`attachment; filename="log4jscanner-report.html"`},
+		}, html.Bytes()},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(p.header)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQP(w, p.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// encodeHeader encodes non-ASCII header values, such as hostnames.
+func encodeHeader(s string) string {
+	for _, r := range s {
+		if r >= 0x80 || r == '\r' || r == '\n' {
+			return mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", " ", "\n", " ").Replace(s))
+		}
+	}
+	return s
+}
+
+func writeQP(w io.Writer, b []byte) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write(b); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeText(b *bytes.Buffer, s *Summary) {
+	fmt.Fprintf(b, "Host:        %s\n", s.Host)
+	fmt.Fprintf(b, "Directories: %s\n", strings.Join(s.Directories, ", "))
+	fmt.Fprintf(b, "Started:     %s\n", s.Started.Format(time.RFC3339))
+	fmt.Fprintf(b, "Duration:    %s\n", s.Finished.Sub(s.Started).Round(time.Second))
+	fmt.Fprintf(b, "Findings:    %d\n", len(s.Findings))
+	fmt.Fprintf(b, "Errors:      %d\n", s.Errors)
+	if len(s.Findings) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n")
+	for _, f := range s.Findings {
+		fmt.Fprintf(b, "%s\n", f.Path)
+		fmt.Fprintf(b, "    severity %s", f.Severity)
+		if len(f.CVEs) > 0 {
+			fmt.Fprintf(b, ", %s", strings.Join(f.CVEs, ", "))
+		}
+		if f.Version != "" {
+			fmt.Fprintf(b, ", version %s", f.Version)
+		}
+		if f.Rewritten {
+			fmt.Fprintf(b, ", rewritten")
+		}
+		fmt.Fprintf(b, "\n")
+	}
+}
+
+var reportTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"rfc3339": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>log4jscanner report for {{.Host}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.critical { color: #b00; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>log4jscanner report for {{.Host}}</h1>
+<p>Scanned {{join .Directories ", "}} at {{rfc3339 .Started}}, finding {{len .Findings}} vulnerable JARs. {{.Errors}} paths couldn't be scanned.</p>
+{{if .Findings}}<table>
+<tr><th>Path</th><th>Severity</th><th>CVEs</th><th>Version</th><th>Rewritten</th></tr>
+{{range .Findings}}<tr><td>{{.Path}}</td><td class="{{.Severity}}">{{.Severity}}</td><td>{{join .CVEs ", "}}</td><td>{{.Version}}</td><td>{{if .Rewritten}}yes{{end}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,270 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+var testSummary = &Summary{
+	Host:        "host1",
+	Started:     time.Date(2021, 12, 20, 10, 0, 0, 0, time.UTC),
+	Finished:    time.Date(2021, 12, 20, 10, 5, 0, 0, time.UTC),
+	Directories: []string{"/opt", "/srv"},
+	Findings: []Finding{
+		{
+			Path:     "/opt/app/<lib>/log4j-core-2.14.1.jar",
+			Version:  "2.14.1",
+			CVEs:     []string{jar.CVE202144228, jar.CVE202145046},
+			Severity: jar.SeverityCritical,
+		},
+	},
+	Errors: 2,
+}
+
+// parts returns the decoded bodies of a message, keyed by content type, with
+// line endings normalized.
+func parts(t *testing.T, msg []byte) (*mail.Message, map[string]string) {
+	t.Helper()
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("parsing message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("parsing content type: %v", err)
+	}
+	bodies := map[string]string{}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		b, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+		if err != nil {
+			t.Fatalf("reading body: %v", err)
+		}
+		bodies[mediaType] = strings.ReplaceAll(string(b), "\r\n", "\n")
+		return m, bodies
+	}
+	r := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		// NextPart decodes quoted-printable itself.
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		b, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		bodies[mediaType] = strings.ReplaceAll(string(b), "\r\n", "\n")
+	}
+	return m, bodies
+}
+
+func TestMessage(t *testing.T) {
+	c := &Config{From: "scanner@example.com", To: []string{"ops@example.com", "sec@example.com"}}
+	msg, err := Message(c, testSummary, time.Now())
+	if err != nil {
+		t.Fatalf("Message() failed: %v", err)
+	}
+	m, bodies := parts(t, msg)
+	if got, want := m.Header.Get("Subject"), "log4jscanner: 1 vulnerable JARs on host1"; got != want {
+		t.Errorf("Subject = %q, want %q", got, want)
+	}
+	if got, want := m.Header.Get("To"), "ops@example.com, sec@example.com"; got != want {
+		t.Errorf("To = %q, want %q", got, want)
+	}
+	text := bodies["text/plain"]
+	for _, want := range []string{
+		"Findings:    1",
+		"Errors:      2",
+		"Duration:    5m0s",
+		"/opt/app/<lib>/log4j-core-2.14.1.jar\n    severity critical, CVE-2021-44228, CVE-2021-45046, version 2.14.1",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Message() body doesn't contain %q:\n%s", want, text)
+		}
+	}
+	if len(bodies) != 1 {
+		t.Errorf("Message() returned %d parts without AttachHTML, want 1", len(bodies))
+	}
+}
+
+func TestMessageHTML(t *testing.T) {
+	c := &Config{
+		From:       "scanner@example.com",
+		To:         []string{"ops@example.com"},
+		Subject:    "[{{host}}] {{findings}} findings",
+		AttachHTML: true,
+	}
+	msg, err := Message(c, testSummary, time.Now())
+	if err != nil {
+		t.Fatalf("Message() failed: %v", err)
+	}
+	m, bodies := parts(t, msg)
+	if got, want := m.Header.Get("Subject"), "[host1] 1 findings"; got != want {
+		t.Errorf("Subject = %q, want %q", got, want)
+	}
+	if !strings.Contains(bodies["text/plain"], "Findings:    1") {
+		t.Errorf("Message() text part missing summary:\n%s", bodies["text/plain"])
+	}
+	html := bodies["text/html"]
+	if !strings.Contains(html, "/opt/app/&lt;lib&gt;/log4j-core-2.14.1.jar") {
+		t.Errorf("Message() HTML part doesn't contain escaped path:\n%s", html)
+	}
+}
+
+func TestMessageInvalidAddress(t *testing.T) {
+	c := &Config{From: "scanner@example.com", To: []string{"ops@example.com\r\nBcc: evil@example.com"}}
+	if _, err := Message(c, testSummary, time.Now()); err == nil {
+		t.Errorf("Message() with a newline in an address succeeded, want error")
+	}
+}
+
+// fakeSMTP accepts a single message without TLS or authentication.
+func fakeSMTP(t *testing.T) (addr string, received chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received = make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 Go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Unsupported")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSend(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	c := &Config{Server: addr, From: "scanner@example.com", To: []string{"ops@example.com"}}
+	if err := Send(c, testSummary); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	select {
+	case msg := <-received:
+		_, bodies := parts(t, []byte(msg))
+		if !strings.Contains(bodies["text/plain"], "log4j-core-2.14.1.jar") {
+			t.Errorf("Send() delivered message without finding:\n%s", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Send() didn't deliver a message")
+	}
+}
+
+func TestSendOnlyFindings(t *testing.T) {
+	// No server is listening, so sending would fail.
+	c := &Config{Server: "127.0.0.1:1", From: "scanner@example.com", To: []string{"ops@example.com"}, OnlyFindings: true}
+	if err := Send(c, &Summary{Host: "host1"}); err != nil {
+		t.Errorf("Send() of a clean scan with OnlyFindings failed: %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{
+			name:   "Valid",
+			config: `{"server": "smtp.example.com:587", "from": "a@example.com", "to": ["b@example.com"]}`,
+		},
+		{
+			name:    "NoServer",
+			config:  `{"from": "a@example.com", "to": ["b@example.com"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "NoRecipients",
+			config:  `{"server": "smtp.example.com:587", "from": "a@example.com"}`,
+			wantErr: true,
+		},
+		{
+			name:    "UnsetPassword",
+			config:  `{"server": "smtp.example.com:587", "from": "a@example.com", "to": ["b@example.com"], "passwordEnv": "LOG4JSCANNER_TEST_UNSET"}`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "email.json")
+			if err := os.WriteFile(path, []byte(tc.config), 0644); err != nil {
+				t.Fatalf("writing config: %v", err)
+			}
+			_, err := LoadConfig(path)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("LoadConfig() returned error %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"log4jscanner/email"
+	"log4jscanner/results"
+)
+
+// emailSink is a results.Sink collecting the summary of a scan, which is
+// emailed when it's closed.
+type emailSink struct {
+	config *email.Config
+
+	mu      sync.Mutex
+	summary *email.Summary
+}
+
+func newEmailSink(path string, dirs []string) (*emailSink, error) {
+	c, err := email.LoadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading email configuration: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	return &emailSink{
+		config:  c,
+		summary: &email.Summary{Host: hostname, Started: time.Now(), Directories: dirs},
+	}, nil
+}
+
+func (e *emailSink) Write(f results.Finding) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.summary.Findings = append(e.summary.Findings, email.Finding{
+		Path:      f.Path,
+		Version:   f.Version,
+		CVEs:      f.CVEs,
+		Severity:  f.Severity,
+		Rewritten: f.Rewritten,
+	})
+	return nil
+}
+
+// error counts a path that couldn't be scanned.
+func (e *emailSink) error() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.summary.Errors++
+}
+
+// Flush does nothing, the summary is only sent once the scan completes.
+func (e *emailSink) Flush() error {
+	return nil
+}
+
+// Close sends the summary.
+func (e *emailSink) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.summary.Finished = time.Now()
+	return email.Send(e.config, e.summary)
+}
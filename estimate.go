@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// defaultThroughput is the assumed scan rate in MiB/s used by --estimate. It
+// can be tuned with --throughput to match a host's storage.
+const defaultThroughput = 50
+
+// estimate enumerates candidate archives without opening them and prints the
+// expected duration of a full scan, given a throughput in MiB/s. Candidates
+// are selected by detect, like the archives the scan would open.
+func estimate(dirs []string, skipDir func(path string, d fs.DirEntry) bool, detect *jar.Detect, throughput float64) {
+	var (
+		files int
+		bytes int64
+	)
+	for _, dir := range dirs {
+		err := walkArchives(dir, skipDir, detect, func(path string, d fs.DirEntry) {
+			info, err := d.Info()
+			if err != nil {
+				log.Printf("Error: stat %s: %v", path, err)
+				return
+			}
+			files++
+			bytes += info.Size()
+		})
+		if err != nil {
+			log.Printf("Error: walking %s: %v", dir, err)
+		}
+	}
+	secs := float64(bytes) / (throughput * (1 << 20))
+	d := time.Duration(secs * float64(time.Second)).Round(time.Second)
+	fmt.Printf("Candidate archives: %d\n", files)
+	fmt.Printf("Total size:         %s\n", formatBytes(bytes))
+	fmt.Printf("Estimated duration: %s (at %g MiB/s)\n", d, throughput)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// parseBytes parses a size such as "512MiB", "4GiB", or a plain number of
+// bytes.
+func parseBytes(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		n      int64
+	}{
+		{"KiB", 1 << 10},
+		{"MiB", 1 << 20},
+		{"GiB", 1 << 30},
+		{"TiB", 1 << 40},
+		{"B", 1},
+	}
+	s = strings.TrimSpace(s)
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes or a size such as 512MiB", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"log4jscanner/jar"
+)
+
+func explainUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner explain [flag] [artifact]
+
+Scans a single JAR, WAR, EAR, or ZIP file and prints every rule evaluated,
+whether it matched, and the evidence found, such as the offsets of matched
+byte patterns and the manifest attributes versions are derived from. Use it to
+triage suspected false positives.
+
+Flags:
+
+    --enable-rule   Only evaluate the rule with the given ID. May be provided
+                    multiple times.
+    --disable-rule  Don't evaluate the rule with the given ID. May be provided
+                    multiple times.
+    --cve           Only evaluate the rules detecting the given CVE. May be
+                    provided multiple times.
+    --log4j1        Also evaluate the log4j 1.x rules.
+    --custom-rules  File of custom rules, in a subset of YARA, to evaluate
+                    alongside the built-in rules. Must precede the flags
+                    referencing them.
+    --vulndb        Vulnerability database, in the JSON format described in
+                    the README, to evaluate alongside the built-in rules.
+                    Must precede the flags referencing its rules.
+
+`)
+}
+
+func explain(args []string) {
+	cfg := &jar.Config{}
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	flags.Func("custom-rules", "", registerRules)
+	flags.Func("vulndb", "", registerVulnDB)
+	flags.Func("enable-rule", "", func(id string) error {
+		cfg.EnableRules = append(cfg.EnableRules, id)
+		return cfg.Validate()
+	})
+	flags.Func("disable-rule", "", func(id string) error {
+		cfg.DisableRules = append(cfg.DisableRules, id)
+		return cfg.Validate()
+	})
+	flags.Func("cve", "", func(cve string) error {
+		cfg.CVEs = append(cfg.CVEs, strings.ToUpper(cve))
+		return cfg.Validate()
+	})
+	flags.BoolVar(&cfg.Log4j1, "log4j1", false, "")
+	flags.Usage = explainUsage
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		explainUsage()
+		os.Exit(1)
+	}
+	path := flags.Arg(0)
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		log.Fatalf("Error: opening %s as a ZIP archive: %v", path, err)
+	}
+	defer zr.Close()
+	if !jar.IsJAR(&zr.Reader) {
+		log.Printf("Warning: %s doesn't look like a JAR and would be skipped by a scan", path)
+	}
+	e, err := cfg.Explain(&zr.Reader)
+	if err != nil {
+		log.Fatalf("Error: scanning %s: %v", path, err)
+	}
+	printExplanation(os.Stdout, path, e)
+}
+
+func printExplanation(w io.Writer, path string, e *jar.Explanation) {
+	fmt.Fprintf(w, "Artifact: %s\n\n", path)
+
+	fmt.Fprintf(w, "Rules:\n\n")
+	for _, r := range e.Rules {
+		result := "not matched"
+		switch {
+		case !r.Enabled:
+			result = "disabled"
+		case r.Matched:
+			result = "MATCHED"
+		}
+		fmt.Fprintf(w, "    %-24s %-15s %s\n", r.ID, r.CVE, result)
+		fmt.Fprintf(w, "        %s\n", r.Description)
+	}
+
+	fmt.Fprintf(w, "\nEvidence:\n\n")
+	if len(e.Evidence) == 0 {
+		fmt.Fprintf(w, "    none\n")
+	}
+	for _, ev := range e.Evidence {
+		fmt.Fprintf(w, "    %s\n", ev)
+	}
+
+	r := e.Report
+	if len(r.Matches) > 0 {
+		fmt.Fprintf(w, "\nMatched classes:\n\n")
+		for _, m := range r.Matches {
+			fmt.Fprintf(w, "    %-24s %s\n        sha256 %s\n", m.Rule, m.Path, m.SHA256)
+		}
+	}
+	if len(r.Artifacts) > 0 {
+		fmt.Fprintf(w, "\nLog4j:\n\n")
+		for _, a := range r.Artifacts {
+			where := a.Path
+			if where == "" {
+				where = "(this JAR)"
+			}
+			version := a.VersionRange
+			if a.Version != "" {
+				version = a.Version + " (" + a.VersionRange + ")"
+			} else if version == "" {
+				version = "unknown version"
+			}
+			lookup := "JndiLookup present"
+			if !a.JndiLookup {
+				lookup = "JndiLookup removed"
+			}
+			matched := "no rules matched"
+			if len(a.Rules) > 0 {
+				matched = "matched " + strings.Join(a.Rules, ", ")
+			}
+			fmt.Fprintf(w, "    %s: %s, %s, %s\n", where, version, lookup, matched)
+		}
+	}
+	if len(r.Bridges) > 0 {
+		fmt.Fprintf(w, "\nBridges:\n\n")
+		for _, b := range r.Bridges {
+			fmt.Fprintf(w, "    %s: %s\n", b, jar.BridgeAdvice(b))
+		}
+	}
+
+	fmt.Fprintf(w, "\nVersion: ")
+	if r.Version != "" {
+		fmt.Fprintf(w, "%s (Implementation-Version, see the manifest evidence above)\n", r.Version)
+	} else {
+		fmt.Fprintf(w, "unknown\n")
+	}
+	if !r.Vulnerable {
+		fmt.Fprintf(w, "Verdict: not vulnerable\n")
+		return
+	}
+	fmt.Fprintf(w, "Verdict: vulnerable to %s, severity %s\n", strings.Join(r.CVEs, ", "), r.Severity())
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"log4jscanner/jar"
+)
+
+func extractUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner extract [flag] [artifact] [nested-path] -o [output]
+
+Extracts a file nested within a JAR, WAR, EAR, or ZIP file, such as a
+vulnerable JAR embedded several archives deep, for offline analysis. Files of
+nested archives are separated from the archive by "!", as printed by the
+explain command:
+
+    log4jscanner extract app.ear 'lib/app.war!WEB-INF/lib/log4j-core-2.14.1.jar' -o log4j.jar
+
+Flags:
+
+    -o, --output   File to write, or "-" for stdout. Existing files aren't
+                   overwritten.
+    --zip-password-file
+                   Read passwords, one per line, to decrypt ZipCrypto or AES
+                   encrypted archives. May be provided multiple times.
+
+`)
+}
+
+func extractCmd(args []string) {
+	var (
+		cfg    = &jar.Config{}
+		output string
+	)
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	flags.StringVar(&output, "o", "", "")
+	flags.StringVar(&output, "output", "", "")
+	flags.Func("zip-password-file", "", func(path string) error {
+		passwords, err := readPasswords(path)
+		if err != nil {
+			return err
+		}
+		cfg.Passwords = append(cfg.Passwords, passwords...)
+		return nil
+	})
+	flags.Usage = extractUsage
+	// Flags may follow the arguments, as in the usage example.
+	var pos []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			break
+		}
+		pos = append(pos, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(pos) != 2 || output == "" {
+		extractUsage()
+		os.Exit(1)
+	}
+	path, nested := pos[0], pos[1]
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		log.Fatalf("Error: opening %s as a ZIP archive: %v", path, err)
+	}
+	defer zr.Close()
+	f, err := cfg.Extract(&zr.Reader, nested)
+	if err != nil {
+		log.Fatalf("Error: extracting from %s: %v", path, err)
+	}
+	defer f.Close()
+
+	if output == "-" {
+		if _, err := io.Copy(os.Stdout, f); err != nil {
+			log.Fatalf("Error: extracting %s: %v", nested, err)
+		}
+		return
+	}
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		log.Fatalf("Error: creating output: %v", err)
+	}
+	_, err = io.Copy(out, f)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		log.Fatalf("Error: extracting %s: %v", nested, err)
+	}
+}
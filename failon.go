@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"log4jscanner/jar"
+)
+
+// Exit statuses of a scan, a stable contract for scripts and CI documented
+// in the README. Scans that can't run exit with status 1, from log.Fatalf.
+const (
+	// exitStatusUsage is used for invalid flags and arguments, like the
+	// flag package does.
+	exitStatusUsage = 2
+	// exitStatusFindings is used if a finding matched --fail-on, or with
+	// --abort-on-first-critical.
+	exitStatusFindings = 3
+	// exitStatusErrors is used with --fail-on errors if archives couldn't
+	// be scanned, and no finding matched.
+	exitStatusErrors = 4
+)
+
+// failPolicy is the --fail-on policy, selecting the findings and errors
+// that fail a scan.
+type failPolicy struct {
+	// severity fails on findings of at least the severity, unless it's
+	// jar.SeverityNone.
+	severity jar.Severity
+	// cves fails on findings of any of the vulnerabilities.
+	cves map[string]bool
+	// errors fails on archives that couldn't be scanned, and filesystems
+	// that stalled.
+	errors bool
+}
+
+// set adds a comma separated list of severities, CVEs, and "errors" to the
+// policy, for --fail-on. The lowest severity given applies.
+func (p *failPolicy) set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		switch {
+		case strings.EqualFold(v, "errors"):
+			p.errors = true
+		case strings.HasPrefix(strings.ToUpper(v), "CVE-"):
+			cve := strings.ToUpper(v)
+			if jar.CVESeverity(cve) == jar.SeverityNone {
+				return fmt.Errorf("unknown CVE %q", v)
+			}
+			if p.cves == nil {
+				p.cves = map[string]bool{}
+			}
+			p.cves[cve] = true
+		default:
+			sev, err := jar.ParseSeverity(v)
+			if err != nil {
+				return fmt.Errorf("%v, a CVE, or errors", err)
+			}
+			if sev != jar.SeverityNone && (p.severity == jar.SeverityNone || sev < p.severity) {
+				p.severity = sev
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports if a finding fails the scan.
+func (p *failPolicy) matches(r *jar.Report) bool {
+	if p.severity != jar.SeverityNone && r.Severity() >= p.severity {
+		return true
+	}
+	for _, cve := range r.CVEs {
+		if p.cves[cve] {
+			return true
+		}
+	}
+	return false
+}
+
+// exitStatus returns the exit status and reason of a scan with the findings
+// that were left unresolved and the given number of errors, or 0 if it
+// succeeded. Findings take precedence over errors.
+func (p *failPolicy) exitStatus(unresolved map[string]*jar.Report, errors int) (int, string) {
+	for _, r := range unresolved {
+		if p.matches(r) {
+			return exitStatusFindings, exitFailOn
+		}
+	}
+	if p.errors && errors > 0 {
+		return exitStatusErrors, exitErrors
+	}
+	return 0, exitSuccess
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"log4jscanner/jar"
+)
+
+func TestFailPolicyExitStatus(t *testing.T) {
+	var (
+		critical = &jar.Report{Vulnerable: true, CVEs: []string{jar.CVE202144228, jar.CVE202145046}}
+		high     = &jar.Report{Vulnerable: true, CVEs: []string{jar.CVE20214104}}
+		medium   = &jar.Report{Vulnerable: true, CVEs: []string{jar.CVE202144832}}
+	)
+	tests := []struct {
+		name       string
+		failOn     []string
+		unresolved map[string]*jar.Report
+		errors     int
+		want       int
+		wantReason string
+	}{
+		{
+			name:       "NoPolicy",
+			unresolved: map[string]*jar.Report{"/a.jar": critical},
+			errors:     1,
+			want:       0,
+			wantReason: exitSuccess,
+		},
+		{
+			name:       "NoFindings",
+			failOn:     []string{"low"},
+			want:       0,
+			wantReason: exitSuccess,
+		},
+		{
+			name:       "LowMatchesMedium",
+			failOn:     []string{"low"},
+			unresolved: map[string]*jar.Report{"/a.jar": medium},
+			want:       exitStatusFindings,
+			wantReason: exitFailOn,
+		},
+		{
+			name:       "MediumMatchesMedium",
+			failOn:     []string{"medium"},
+			unresolved: map[string]*jar.Report{"/a.jar": medium},
+			want:       exitStatusFindings,
+			wantReason: exitFailOn,
+		},
+		{
+			name:       "HighIgnoresMedium",
+			failOn:     []string{"high"},
+			unresolved: map[string]*jar.Report{"/a.jar": medium},
+			want:       0,
+			wantReason: exitSuccess,
+		},
+		{
+			name:       "HighMatchesHigh",
+			failOn:     []string{"high"},
+			unresolved: map[string]*jar.Report{"/a.jar": medium, "/b.jar": high},
+			want:       exitStatusFindings,
+			wantReason: exitFailOn,
+		},
+		{
+			name:       "CriticalIgnoresHigh",
+			failOn:     []string{"critical"},
+			unresolved: map[string]*jar.Report{"/a.jar": high},
+			want:       0,
+			wantReason: exitSuccess,
+		},
+		{
+			name:       "CriticalMatchesCritical",
+			failOn:     []string{"critical"},
+			unresolved: map[string]*jar.Report{"/a.jar": critical},
+			want:       exitStatusFindings,
+			wantReason: exitFailOn,
+		},
+		{
+			name:       "None",
+			failOn:     []string{"none"},
+			unresolved: map[string]*jar.Report{"/a.jar": critical},
+			want:       0,
+			wantReason: exitSuccess,
+		},
+		{
+			name:       "LowestSeverityApplies",
+			failOn:     []string{"critical,medium", "high"},
+			unresolved: map[string]*jar.Report{"/a.jar": medium},
+			want:       exitStatusFindings,
+			wantReason: exitFailOn,
+		},
+		{
+			name:       "CVE",
+			failOn:     []string{"cve-2021-44832"},
+			unresolved: map[string]*jar.Report{"/a.jar": medium},
+			want:       exitStatusFindings,
+			wantReason: exitFailOn,
+		},
+		{
+			name:       "OtherCVE",
+			failOn:     []string{"CVE-2021-44832"},
+			unresolved: map[string]*jar.Report{"/a.jar": critical},
+			want:       0,
+			wantReason: exitSuccess,
+		},
+		{
+			name:       "Errors",
+			failOn:     []string{"errors"},
+			errors:     2,
+			want:       exitStatusErrors,
+			wantReason: exitErrors,
+		},
+		{
+			name:       "NoErrors",
+			failOn:     []string{"errors"},
+			want:       0,
+			wantReason: exitSuccess,
+		},
+		{
+			name:       "ErrorsWithUnmatchedFinding",
+			failOn:     []string{"high,errors"},
+			unresolved: map[string]*jar.Report{"/a.jar": medium},
+			errors:     1,
+			want:       exitStatusErrors,
+			wantReason: exitErrors,
+		},
+		{
+			name:       "FindingsBeforeErrors",
+			failOn:     []string{"errors,critical"},
+			unresolved: map[string]*jar.Report{"/a.jar": critical},
+			errors:     1,
+			want:       exitStatusFindings,
+			wantReason: exitFailOn,
+		},
+		{
+			name:   "UnknownSeverity",
+			failOn: []string{"severe"},
+			want:   exitStatusUsage,
+		},
+		{
+			name:   "UnknownCVE",
+			failOn: []string{"high,CVE-1999-0001"},
+			want:   exitStatusUsage,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Parse --fail-on like main, except that errors are returned
+			// rather than exiting with the flag package's status, 2.
+			var p failPolicy
+			flags := flag.NewFlagSet("log4jscanner", flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			flags.Func("fail-on", "", p.set)
+			var args []string
+			for _, v := range tc.failOn {
+				args = append(args, "--fail-on", v)
+			}
+			if err := flags.Parse(args); err != nil {
+				if tc.want != exitStatusUsage {
+					t.Fatalf("parsing --fail-on %v: %v", tc.failOn, err)
+				}
+				return
+			}
+			if tc.want == exitStatusUsage {
+				t.Fatalf("parsing --fail-on %v succeeded, want error", tc.failOn)
+			}
+
+			got, reason := p.exitStatus(tc.unresolved, tc.errors)
+			if got != tc.want || reason != tc.wantReason {
+				t.Errorf("exitStatus() = %d, %q, want %d, %q", got, reason, tc.want, tc.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fswatch reports files written within directory trees as they
+// change, using inotify on Linux.
+//
+// Unlike the audit subsystem, inotify needs a watch per directory, so it's
+// limited by the fs.inotify.max_user_watches sysctl, but it requires no
+// system configuration and works in containers.
+package fswatch
+
+// Watcher watches directory trees for files being written.
+type Watcher struct {
+	// HandleChange is called with the path of every file that's closed
+	// after being written, or moved into a watched tree. Files within
+	// directories created or moved into a tree are passed to it once the
+	// directories are watched, since they may have been written before,
+	// so a file may be passed more than once. It's also called with each
+	// root, a directory, if events were dropped because they overflowed
+	// the kernel's queue. It's called from one goroutine at a time.
+	HandleChange func(path string)
+	// HandleError, if provided, is called for directories within the trees
+	// that can't be watched, such as when there are more directories than
+	// the fs.inotify.max_user_watches sysctl allows.
+	HandleError func(path string, err error)
+}
+
+func (w *Watcher) handleError(path string, err error) {
+	if w.HandleError != nil {
+		w.HandleError(path, err)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package fswatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// watchMask selects the events of watched directories.
+	watchMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM |
+		unix.IN_CREATE | unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW
+	// pollMillis is how often the context is checked while waiting for
+	// events.
+	pollMillis = 250
+)
+
+// Watch watches the directory trees rooted at dirs, including directories
+// created in them later, until ctx is done. It returns an error if inotify
+// can't be initialized or one of dirs can't be watched.
+func (w *Watcher) Watch(ctx context.Context, dirs ...string) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("initializing inotify: %v", err)
+	}
+	n := &notifier{w: w, fd: fd, paths: map[int]string{}, wds: map[string]int{}}
+	defer unix.Close(fd)
+	for _, d := range dirs {
+		d = filepath.Clean(d)
+		if err := n.add(d); err != nil {
+			return fmt.Errorf("watching %s: %v", d, err)
+		}
+		n.addTree(d, false)
+	}
+	n.roots = dirs
+	return n.run(ctx)
+}
+
+// notifier is the state of a Watch.
+type notifier struct {
+	w     *Watcher
+	fd    int
+	roots []string
+	// paths holds the directory of each watch descriptor, and wds the
+	// reverse.
+	paths map[int]string
+	wds   map[string]int
+}
+
+func (n *notifier) add(dir string) error {
+	wd, err := unix.InotifyAddWatch(n.fd, dir, watchMask)
+	if err != nil {
+		if errors.Is(err, unix.ENOSPC) {
+			return fmt.Errorf("%v: raise the fs.inotify.max_user_watches sysctl", err)
+		}
+		return err
+	}
+	n.paths[wd] = dir
+	n.wds[dir] = wd
+	return nil
+}
+
+// addTree watches the directories within dir, and reports the files in
+// them if report is set. Directories removed concurrently are ignored.
+func (n *notifier) addTree(dir string, report bool) {
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				n.w.handleError(p, err)
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			if report && d.Type().IsRegular() {
+				n.w.HandleChange(p)
+			}
+			return nil
+		}
+		if p == dir {
+			return nil
+		}
+		if err := n.add(p); err != nil {
+			if !errors.Is(err, unix.ENOENT) {
+				n.w.handleError(p, err)
+			}
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
+
+// remove forgets the watches of dir and the directories within it, which
+// were moved elsewhere.
+func (n *notifier) remove(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for p, wd := range n.wds {
+		if p == dir || strings.HasPrefix(p, prefix) {
+			unix.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.wds, p)
+			delete(n.paths, wd)
+		}
+	}
+}
+
+func (n *notifier) run(ctx context.Context) error {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	fds := []unix.PollFd{{Fd: int32(n.fd), Events: unix.POLLIN}}
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if _, err := unix.Poll(fds, pollMillis); err != nil && err != unix.EINTR {
+			return fmt.Errorf("polling inotify: %v", err)
+		}
+		l, err := unix.Read(n.fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading inotify: %v", os.NewSyscallError("read", err))
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= l; {
+			e := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(e.Len)]
+			off += unix.SizeofInotifyEvent + int(e.Len)
+			n.handle(int(e.Wd), e.Mask, strings.TrimRight(string(name), "\x00"))
+		}
+	}
+}
+
+// handle handles an event of a watch descriptor.
+func (n *notifier) handle(wd int, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		for _, r := range n.roots {
+			n.w.HandleChange(r)
+		}
+		return
+	}
+	dir, ok := n.paths[wd]
+	if !ok {
+		return
+	}
+	if mask&unix.IN_IGNORED != 0 {
+		// The directory was removed.
+		delete(n.paths, wd)
+		if n.wds[dir] == wd {
+			delete(n.wds, dir)
+		}
+		return
+	}
+	if name == "" {
+		return
+	}
+	p := filepath.Join(dir, name)
+	isDir := mask&unix.IN_ISDIR != 0
+	switch {
+	case isDir && mask&unix.IN_MOVED_FROM != 0:
+		n.remove(p)
+	case isDir && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+		if err := n.add(p); err != nil {
+			if !errors.Is(err, unix.ENOENT) {
+				n.w.handleError(p, err)
+			}
+			return
+		}
+		n.addTree(p, true)
+	case !isDir && mask&(unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO) != 0:
+		n.w.HandleChange(p)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package fswatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "existing"), 0755); err != nil {
+		t.Fatalf("creating directory: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan string, 16)
+	w := &Watcher{
+		HandleChange: func(p string) { changed <- p },
+		HandleError:  func(p string, err error) { t.Errorf("HandleError(%s, %v)", p, err) },
+	}
+	done := make(chan error, 1)
+	go func() { done <- w.Watch(ctx, dir) }()
+	// Watch adds the watches in the background, give it time to.
+	time.Sleep(100 * time.Millisecond)
+
+	want := func(p string) {
+		t.Helper()
+		select {
+		case got := <-changed:
+			if got != p {
+				t.Errorf("HandleChange(%s), want %s", got, p)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("HandleChange(%s) not called", p)
+		}
+	}
+
+	p := filepath.Join(dir, "existing", "app.war")
+	if err := os.WriteFile(p, []byte("war"), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	want(p)
+
+	// Files of directories moved into the tree are reported.
+	moved := filepath.Join(t.TempDir(), "moved")
+	if err := os.Mkdir(moved, 0755); err != nil {
+		t.Fatalf("creating directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(moved, "old.jar"), []byte("jar"), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	sub := filepath.Join(dir, "new")
+	if err := os.Rename(moved, sub); err != nil {
+		t.Fatalf("moving directory: %v", err)
+	}
+	want(filepath.Join(sub, "old.jar"))
+	p = filepath.Join(sub, "lib.jar")
+	if err := os.WriteFile(p, []byte("jar"), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	want(p)
+
+	tmp := filepath.Join(dir, ".app.ear.tmp")
+	if err := os.WriteFile(tmp, []byte("ear"), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	want(tmp)
+	p = filepath.Join(sub, "app.ear")
+	if err := os.Rename(tmp, p); err != nil {
+		t.Fatalf("renaming file: %v", err)
+	}
+	want(p)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Watch() returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Watch() didn't return after its context was done")
+	}
+}
+
+func TestWatchMissing(t *testing.T) {
+	w := &Watcher{HandleChange: func(string) {}}
+	if err := w.Watch(context.Background(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("Watch() of a missing directory succeeded, want error")
+	}
+}
@@ -4,6 +4,7 @@ go 1.17
 
 require (
 	github.com/google/go-cmp v0.5.6
+	github.com/mattn/go-sqlite3 v1.14.16
 	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e
 )
 
@@ -0,0 +1,64 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"log4jscanner/depgraph"
+	"log4jscanner/readonly"
+)
+
+// writeGraph writes the entry points of the graph that reference vulnerable
+// JARs to path, or stdout if "-".
+func writeGraph(path string, g *depgraph.Graph) error {
+	if path == "-" {
+		return printReaches(os.Stdout, g)
+	}
+	if err := readonly.Check("writing class path graph"); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating class path graph: %v", err)
+	}
+	if err := printReaches(f, g); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing class path graph: %v", err)
+	}
+	return nil
+}
+
+// printReaches prints a line per chain of references from an entry point to a
+// vulnerable JAR:
+//
+//	/srv/app/app.jar -> /srv/app/lib/a.jar -> /srv/app/lib/log4j-core.jar
+func printReaches(w io.Writer, g *depgraph.Graph) error {
+	bw := bufio.NewWriter(w)
+	for _, r := range g.Reaches() {
+		fmt.Fprintln(bw, strings.Join(r.Via, " -> "))
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing class path graph: %v", err)
+	}
+	return nil
+}
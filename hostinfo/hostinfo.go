@@ -0,0 +1,243 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hostinfo describes the host a scan runs on, so findings aggregated
+// from a fleet can be routed to the owners of each host.
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Host describes a host.
+type Host struct {
+	Hostname string `json:"hostname,omitempty"`
+	// FQDN is the fully qualified domain name of the host, if it resolves.
+	FQDN string `json:"fqdn,omitempty"`
+	// Cloud is the provider the host runs on: "aws", "gcp", or "azure".
+	Cloud string `json:"cloud,omitempty"`
+	// InstanceID identifies the virtual machine within the provider.
+	InstanceID string `json:"instanceID,omitempty"`
+	// ImageID identifies the image, such as an AMI, the virtual machine
+	// was created from.
+	ImageID string `json:"imageID,omitempty"`
+	// Tags holds user provided key=value pairs, such as team=payments.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// TagString formats the tags as "key=value" pairs sorted by key and joined
+// by sep.
+func (h *Host) TagString(sep string) string {
+	var keys []string
+	for k := range h.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+h.Tags[k])
+	}
+	return strings.Join(pairs, sep)
+}
+
+// ParseTag parses a "key=value" tag.
+func ParseTag(s string) (key, value string, err error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid tag %q, expected key=value", s)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// Default metadata service endpoints.
+const (
+	awsBase   = "http://169.254.169.254/latest/"
+	gcpBase   = "http://metadata.google.internal/computeMetadata/v1/"
+	azureBase = "http://169.254.169.254/metadata/"
+)
+
+// Collector gathers metadata about the current host. The zero value queries
+// the real metadata services.
+type Collector struct {
+	// Timeout bounds the time spent querying metadata services. Defaults
+	// to 2 seconds, since hosts outside a cloud never answer.
+	Timeout time.Duration
+
+	// Endpoints and lookups, replaced by tests.
+	awsBase, gcpBase, azureBase string
+	hostname                    func() (string, error)
+	lookupCNAME                 func(host string) (string, error)
+}
+
+// Collect returns the metadata of the current host. Metadata that can't be
+// determined is left empty.
+func (c *Collector) Collect(ctx context.Context) *Host {
+	h := &Host{}
+	hostname := c.hostname
+	if hostname == nil {
+		hostname = os.Hostname
+	}
+	h.Hostname, _ = hostname()
+	h.FQDN = c.fqdn(h.Hostname)
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type cloud struct {
+		name              string
+		instance, imageID string
+	}
+	probes := []func(ctx context.Context) (string, string, error){c.aws, c.gcp, c.azure}
+	names := []string{"aws", "gcp", "azure"}
+	found := make([]cloud, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(i int, probe func(ctx context.Context) (string, string, error)) {
+			defer wg.Done()
+			id, image, err := probe(ctx)
+			if err == nil && id != "" {
+				found[i] = cloud{names[i], id, image}
+			}
+		}(i, probe)
+	}
+	wg.Wait()
+	for _, f := range found {
+		if f.name != "" {
+			h.Cloud, h.InstanceID, h.ImageID = f.name, f.instance, f.imageID
+			break
+		}
+	}
+	return h
+}
+
+func (c *Collector) fqdn(hostname string) string {
+	if hostname == "" {
+		return ""
+	}
+	lookup := c.lookupCNAME
+	if lookup == nil {
+		lookup = net.LookupCNAME
+	}
+	name, err := lookup(hostname)
+	if err != nil {
+		return ""
+	}
+	name = strings.TrimSuffix(name, ".")
+	if !strings.Contains(name, ".") {
+		return ""
+	}
+	return name
+}
+
+func get(ctx context.Context, method, url string, header http.Header) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header = header
+	// Metadata services are never behind a proxy.
+	client := &http.Client{Transport: &http.Transport{}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return strings.TrimSpace(string(b)), err
+}
+
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// aws queries the EC2 instance metadata service, using IMDSv2.
+func (c *Collector) aws(ctx context.Context) (id, image string, err error) {
+	base := or(c.awsBase, awsBase)
+	token, err := get(ctx, http.MethodPut, base+"api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"}})
+	if err != nil {
+		return "", "", err
+	}
+	h := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+	if id, err = get(ctx, http.MethodGet, base+"meta-data/instance-id", h); err != nil {
+		return "", "", err
+	}
+	image, _ = get(ctx, http.MethodGet, base+"meta-data/ami-id", h)
+	return id, image, nil
+}
+
+// gcp queries the Compute Engine metadata server.
+func (c *Collector) gcp(ctx context.Context) (id, image string, err error) {
+	base := or(c.gcpBase, gcpBase)
+	h := http.Header{"Metadata-Flavor": {"Google"}}
+	if id, err = get(ctx, http.MethodGet, base+"instance/id", h); err != nil {
+		return "", "", err
+	}
+	// The image is returned as "projects/<project>/global/images/<image>".
+	if image, _ = get(ctx, http.MethodGet, base+"instance/image", h); image != "" {
+		image = path.Base(image)
+	}
+	return id, image, nil
+}
+
+// azure queries the Azure instance metadata service.
+func (c *Collector) azure(ctx context.Context) (id, image string, err error) {
+	base := or(c.azureBase, azureBase)
+	b, err := get(ctx, http.MethodGet, base+"instance/compute?api-version=2021-02-01", http.Header{"Metadata": {"true"}})
+	if err != nil {
+		return "", "", err
+	}
+	var compute struct {
+		VMID           string `json:"vmId"`
+		StorageProfile struct {
+			ImageReference struct {
+				ID        string `json:"id"`
+				Publisher string `json:"publisher"`
+				Offer     string `json:"offer"`
+				SKU       string `json:"sku"`
+				Version   string `json:"version"`
+			} `json:"imageReference"`
+		} `json:"storageProfile"`
+	}
+	if err := json.Unmarshal([]byte(b), &compute); err != nil {
+		return "", "", fmt.Errorf("parsing compute metadata: %v", err)
+	}
+	ref := compute.StorageProfile.ImageReference
+	image = ref.ID
+	if image == "" && ref.Offer != "" {
+		image = strings.Join([]string{ref.Publisher, ref.Offer, ref.SKU, ref.Version}, ":")
+	}
+	return compute.VMID, image, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostinfo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		in         string
+		key, value string
+		wantErr    bool
+	}{
+		{in: "team=payments", key: "team", value: "payments"},
+		{in: "owner=a=b", key: "owner", value: "a=b"},
+		{in: "empty=", key: "empty", value: ""},
+		{in: "team", wantErr: true},
+		{in: "=payments", wantErr: true},
+	}
+	for _, tc := range tests {
+		key, value, err := ParseTag(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseTag(%q) succeeded, want error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTag(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if key != tc.key || value != tc.value {
+			t.Errorf("ParseTag(%q) = %q, %q, want %q, %q", tc.in, key, value, tc.key, tc.value)
+		}
+	}
+}
+
+// metadataServer serves the given paths, requiring header to be set.
+func metadataServer(t *testing.T, header, value string, paths map[string]string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(header) != value {
+			http.Error(w, "missing header", http.StatusForbidden)
+			return
+		}
+		body, ok := paths[r.Method+" "+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/"
+}
+
+func TestCollect(t *testing.T) {
+	// Hosts outside a cloud have no metadata service.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	none := closed.URL + "/"
+
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/api/token" {
+			w.Write([]byte("token"))
+			return
+		}
+		if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "token" {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/meta-data/instance-id":
+			w.Write([]byte("i-0123456789abcdef0"))
+		case "/meta-data/ami-id":
+			w.Write([]byte("ami-0abcdef1234567890"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer aws.Close()
+
+	gcp := metadataServer(t, "Metadata-Flavor", "Google", map[string]string{
+		"GET /instance/id":    "4520031799277581759",
+		"GET /instance/image": "projects/debian-cloud/global/images/debian-11-bullseye-v20211209",
+	})
+	azure := metadataServer(t, "Metadata", "true", map[string]string{
+		"GET /instance/compute": `{"vmId":"02aab8a4-74ef-476e-8182-f6d2ba4166a6",` +
+			`"storageProfile":{"imageReference":{"publisher":"Canonical","offer":"UbuntuServer","sku":"18.04-LTS","version":"latest"}}}`,
+	})
+
+	tests := []struct {
+		name             string
+		awsBase, gcpBase string
+		azureBase        string
+		want             Host
+	}{
+		{
+			name:    "none",
+			awsBase: none, gcpBase: none, azureBase: none,
+			want: Host{Hostname: "web1", FQDN: "web1.example.com"},
+		},
+		{
+			name:    "aws",
+			awsBase: aws.URL + "/", gcpBase: none, azureBase: none,
+			want: Host{
+				Hostname: "web1", FQDN: "web1.example.com", Cloud: "aws",
+				InstanceID: "i-0123456789abcdef0", ImageID: "ami-0abcdef1234567890",
+			},
+		},
+		{
+			name:    "gcp",
+			awsBase: none, gcpBase: gcp, azureBase: none,
+			want: Host{
+				Hostname: "web1", FQDN: "web1.example.com", Cloud: "gcp",
+				InstanceID: "4520031799277581759", ImageID: "debian-11-bullseye-v20211209",
+			},
+		},
+		{
+			name:    "azure",
+			awsBase: none, gcpBase: none, azureBase: azure,
+			want: Host{
+				Hostname: "web1", FQDN: "web1.example.com", Cloud: "azure",
+				InstanceID: "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+				ImageID:    "Canonical:UbuntuServer:18.04-LTS:latest",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Collector{
+				Timeout:     5 * time.Second,
+				awsBase:     tc.awsBase,
+				gcpBase:     tc.gcpBase,
+				azureBase:   tc.azureBase,
+				hostname:    func() (string, error) { return "web1", nil },
+				lookupCNAME: func(string) (string, error) { return "web1.example.com.", nil },
+			}
+			got := c.Collect(context.Background())
+			if diff := cmp.Diff(&tc.want, got); diff != "" {
+				t.Errorf("Collect() returned diff (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestFQDN(t *testing.T) {
+	tests := []struct {
+		name  string
+		cname string
+		err   error
+		want  string
+	}{
+		{name: "resolves", cname: "web1.example.com.", want: "web1.example.com"},
+		{name: "unqualified", cname: "web1.", want: ""},
+		{name: "error", err: errors.New("no such host"), want: ""},
+	}
+	for _, tc := range tests {
+		c := &Collector{lookupCNAME: func(string) (string, error) { return tc.cname, tc.err }}
+		if got := c.fqdn("web1"); got != tc.want {
+			t.Errorf("%s: fqdn() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTagString(t *testing.T) {
+	h := &Host{Tags: map[string]string{"team": "payments", "env": "prod"}}
+	if got, want := h.TagString(";"), "env=prod;team=payments"; got != want {
+		t.Errorf("TagString() = %q, want %q", got, want)
+	}
+}
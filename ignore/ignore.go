@@ -0,0 +1,232 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ignore implements path exclusion using gitignore syntax.
+//
+// The same Matcher backs the jar.Walker's SkipDir function, the command line
+// --ignore flag, and ignore files, so exclusions behave identically however
+// they're provided. Supported syntax:
+//
+//	# comment       Blank lines and lines starting with "#" are ignored.
+//	*.bak           Patterns without a "/" match a name at any depth.
+//	/var/run        A leading or middle "/" anchors the pattern to the root.
+//	cache/          A trailing "/" only matches directories.
+//	**/tmp, a/**    "**" matches any number of directories.
+//	!keep.jar       A leading "!" re-includes a previously excluded path.
+//
+// As with git, the last matching pattern wins, and paths can't be
+// re-included if a parent directory is excluded.
+//
+// Paths are matched relative to the root of the scan. Absolute paths have
+// their leading "/" (and any volume name) removed, so "/var/run" anchors to the
+// root of the filesystem when scanning "/".
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type rule struct {
+	pattern string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher holds a list of compiled patterns. A nil Matcher matches nothing.
+type Matcher struct {
+	rules []rule
+}
+
+// New compiles a list of patterns. Each pattern is the equivalent of a line in
+// a gitignore file.
+func New(patterns ...string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, p := range patterns {
+		if err := m.add(p); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Parse reads patterns from a gitignore formatted file.
+func Parse(r io.Reader) (*Matcher, error) {
+	m := &Matcher{}
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		if err := m.add(s.Text()); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add appends patterns to the matcher. Later patterns take precedence.
+func (m *Matcher) Add(patterns ...string) error {
+	for _, p := range patterns {
+		if err := m.add(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extend appends the patterns of another matcher, which take precedence.
+func (m *Matcher) Extend(other *Matcher) {
+	if other != nil {
+		m.rules = append(m.rules, other.rules...)
+	}
+}
+
+func (m *Matcher) add(line string) error {
+	orig := line
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	r := rule{pattern: orig}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return fmt.Errorf("invalid pattern %q", orig)
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr, err := compile(line)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", orig, err)
+	}
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", orig, err)
+	}
+	r.re = re
+	m.rules = append(m.rules, r)
+	return nil
+}
+
+// compile converts a glob into a regular expression.
+func compile(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			// Zero or more directories.
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && glob[i:] == "**" && i > 0 && glob[i-1] == '/':
+			// Everything within a directory.
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			j := strings.IndexByte(glob[i+1:], ']')
+			if j < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += j + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// normalize converts a path to the slash separated, root relative form
+// patterns are matched against.
+func normalize(path string) string {
+	path = filepath.ToSlash(strings.TrimPrefix(path, filepath.VolumeName(path)))
+	return strings.Trim(path, "/")
+}
+
+// matchEntry reports if a path is excluded, ignoring its parents.
+func (m *Matcher) matchEntry(path string, isDir bool) bool {
+	excluded := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(path) {
+			excluded = !r.negate
+		}
+	}
+	return excluded
+}
+
+// Match reports if a path is excluded, either directly or because one of its
+// parent directories is excluded.
+func (m *Matcher) Match(path string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	path = normalize(path)
+	if path == "" || path == "." {
+		return false
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && m.matchEntry(path[:i], true) {
+			return true
+		}
+	}
+	return m.matchEntry(path, isDir)
+}
+
+// SkipDir can be used as the SkipDir function of a jar.Walker. Because the
+// walker never descends into skipped directories, parents aren't re-checked.
+func (m *Matcher) SkipDir(path string, d fs.DirEntry) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	path = normalize(path)
+	if path == "" || path == "." {
+		return false
+	}
+	return m.matchEntry(path, d.IsDir())
+}
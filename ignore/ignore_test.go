@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{[]string{"*.bak"}, "a.bak", false, true},
+		{[]string{"*.bak"}, "dir/sub/a.bak", false, true},
+		{[]string{"*.bak"}, "a.jar", false, false},
+		{[]string{"# *.bak"}, "a.bak", false, false},
+		{[]string{`\#file`}, "#file", false, true},
+		{[]string{"/var/run"}, "/var/run", true, true},
+		{[]string{"/var/run"}, "/var/run/app.jar", false, true},
+		{[]string{"/var/run"}, "/data/var/run", true, false},
+		{[]string{"var/run"}, "/data/var/run", true, false},
+		{[]string{"run"}, "/data/var/run", true, true},
+		{[]string{"cache/"}, "/home/u/cache", true, true},
+		{[]string{"cache/"}, "/home/u/cache", false, false},
+		{[]string{"cache/"}, "/home/u/cache/a.jar", false, true},
+		{[]string{"**/tmp"}, "tmp", true, true},
+		{[]string{"**/tmp"}, "a/b/tmp", true, true},
+		{[]string{"a/**"}, "a/b/c.jar", false, true},
+		{[]string{"a/**"}, "a", true, false},
+		{[]string{"a/**/b"}, "a/b", true, true},
+		{[]string{"a/**/b"}, "a/x/y/b", true, true},
+		{[]string{"a/**/b"}, "x/a/b", true, false},
+		{[]string{"*.jar", "!keep.jar"}, "keep.jar", false, false},
+		{[]string{"*.jar", "!keep.jar"}, "drop.jar", false, true},
+		{[]string{"!keep.jar", "*.jar"}, "keep.jar", false, true},
+		// Files within an excluded directory can't be re-included.
+		{[]string{"build/", "!build/keep.jar"}, "build/keep.jar", false, true},
+		{[]string{"log4j-?.jar"}, "log4j-1.jar", false, true},
+		{[]string{"log4j-?.jar"}, "log4j-10.jar", false, false},
+		{[]string{"log4j-[0-9].jar"}, "log4j-1.jar", false, true},
+		{[]string{"log4j-[!0-9].jar"}, "log4j-1.jar", false, false},
+		{[]string{"*"}, ".", true, false},
+	}
+	for _, tc := range testCases {
+		name := strings.Join(tc.patterns, ",") + " " + tc.path
+		t.Run(name, func(t *testing.T) {
+			m, err := New(tc.patterns...)
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			if got := m.Match(tc.path, tc.isDir); got != tc.want {
+				t.Errorf("Match(%q, %t) = %t, want %t", tc.path, tc.isDir, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	file := `
+# Build output.
+build/
+*.jar.bak
+
+# But keep this one.
+!important.jar.bak
+`
+	m, err := Parse(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if !m.Match("a/build", true) {
+		t.Errorf("expected build/ to be excluded")
+	}
+	if !m.Match("x.jar.bak", false) {
+		t.Errorf("expected x.jar.bak to be excluded")
+	}
+	if m.Match("important.jar.bak", false) {
+		t.Errorf("expected important.jar.bak to be included")
+	}
+
+	if _, err := Parse(strings.NewReader("ok\n[bad\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Parse() with invalid pattern returned %v, want error for line 2", err)
+	}
+}
+
+func TestNilMatcher(t *testing.T) {
+	var m *Matcher
+	if m.Match("a", false) {
+		t.Errorf("nil Matcher matched path")
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the files of a layer marking files of lower layers deleted: a
+// whiteout hides the file it's named after, and an opaque whiteout every
+// file of its directory.
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// node is a file of the merged filesystem of an image.
+type node struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	// The contents of a regular file, at off in ra.
+	ra   io.ReaderAt
+	off  int64
+	size int64
+	// The files of a directory.
+	children map[string]*node
+}
+
+func newDir() *node {
+	return &node{mode: fs.ModeDir | 0755, children: map[string]*node{}}
+}
+
+// layerEntry is a file of a layer, at off in the layer.
+type layerEntry struct {
+	hdr *tar.Header
+	off int64
+}
+
+// addLayer merges the layer ra of the given size, an uncompressed tar
+// archive, into the filesystem. The files it deletes are removed first, then
+// its files are added in order, replacing those of lower layers.
+func (img *Image) addLayer(ra io.ReaderAt, size int64) error {
+	var entries []layerEntry
+	err := readTar(ra, size, func(hdr *tar.Header, off int64) error {
+		p := cleanPath(hdr.Name)
+		if p == "" {
+			return nil
+		}
+		dir, base := path.Split(p)
+		switch {
+		case base == opaqueWhiteout:
+			if d := img.lookup(strings.TrimSuffix(dir, "/")); d != nil && d.children != nil {
+				d.children = map[string]*node{}
+			}
+		case strings.HasPrefix(base, whiteoutPrefix):
+			img.remove(dir + base[len(whiteoutPrefix):])
+		default:
+			entries = append(entries, layerEntry{hdr, off})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		img.add(e.hdr, ra, e.off)
+	}
+	return nil
+}
+
+// add adds the file of a layer with the given header, whose contents are at
+// off in ra. Files other than regular files, directories, and hard links to
+// regular files are skipped, including symlinks, whose targets are found at
+// their own path.
+func (img *Image) add(hdr *tar.Header, ra io.ReaderAt, off int64) {
+	p := cleanPath(hdr.Name)
+	n := &node{name: path.Base(p), mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime}
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		n.ra, n.off, n.size = ra, off, hdr.Size
+	case tar.TypeLink:
+		target := img.lookup(cleanPath(hdr.Linkname))
+		if target == nil || !target.mode.IsRegular() {
+			return
+		}
+		n.mode = target.mode
+		n.ra, n.off, n.size = target.ra, target.off, target.size
+	case tar.TypeDir:
+		n.children = map[string]*node{}
+	default:
+		return
+	}
+	parent := img.mkdirAll(path.Dir(p))
+	if old := parent.children[n.name]; old != nil && old.children != nil && n.children != nil {
+		// A directory of an upper layer keeps the files of the lower
+		// ones, unless it's opaque.
+		n.children = old.children
+	}
+	parent.children[n.name] = n
+}
+
+// mkdirAll returns the directory at p, creating it and its parents if they
+// don't exist, or replacing the files in their way.
+func (img *Image) mkdirAll(p string) *node {
+	d := img.root
+	if p == "." {
+		return d
+	}
+	for _, name := range strings.Split(p, "/") {
+		c := d.children[name]
+		if c == nil || c.children == nil {
+			c = newDir()
+			c.name = name
+			d.children[name] = c
+		}
+		d = c
+	}
+	return d
+}
+
+// lookup returns the file at p, "" or "." for the root, or nil if it
+// doesn't exist.
+func (img *Image) lookup(p string) *node {
+	n := img.root
+	if p == "" || p == "." {
+		return n
+	}
+	for _, name := range strings.Split(p, "/") {
+		if n.children == nil {
+			return nil
+		}
+		if n = n.children[name]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// remove removes the file at p, with its files if it's a directory.
+func (img *Image) remove(p string) {
+	if d := img.lookup(path.Dir(p)); d != nil && d.children != nil {
+		delete(d.children, path.Base(p))
+	}
+}
+
+// Open opens the file name of the merged filesystem.
+func (img *Image) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	n := img.lookup(name)
+	switch {
+	case n == nil:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case n.children != nil:
+		return &dir{node: n}, nil
+	}
+	return &file{node: n, SectionReader: io.NewSectionReader(n.ra, n.off, n.size)}, nil
+}
+
+// fileInfo implements fs.FileInfo for a node.
+type fileInfo struct {
+	n *node
+}
+
+func (fi fileInfo) Name() string {
+	if fi.n.name == "" {
+		return "."
+	}
+	return fi.n.name
+}
+
+func (fi fileInfo) Size() int64        { return fi.n.size }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.n.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.n.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.n.children != nil }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+// file is an opened regular file.
+type file struct {
+	node *node
+	*io.SectionReader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return fileInfo{f.node}, nil }
+func (f *file) Close() error               { return nil }
+
+// dir is an opened directory, listing its files sorted by name.
+type dir struct {
+	node    *node
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return fileInfo{d.node}, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: fs.ErrInvalid}
+}
+
+func (d *dir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.read = true
+		for _, c := range d.node.children {
+			d.entries = append(d.entries, fs.FileInfoToDirEntry(fileInfo{c}))
+		}
+		sort.Slice(d.entries, func(i, j int) bool { return d.entries[i].Name() < d.entries[j].Name() })
+	}
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
@@ -0,0 +1,440 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package image reads container images, saved by "docker save" or in an OCI
+// image layout, as the filesystem of a container running them: their layers
+// merged in order, with the files deleted by upper layers removed.
+//
+// An Image implements fs.FS, so a jar.Walker scans it like a directory:
+//
+//	img, err := image.Open("app.tar")
+//	if err != nil {
+//		return err
+//	}
+//	defer img.Close()
+//	w := &jar.Walker{FS: func(string) fs.FS { return img }}
+//	err = w.Walk("app.tar")
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"log4jscanner/readonly"
+)
+
+// Image is the merged filesystem of a container image. Its files implement
+// io.ReaderAt. Symlinks are left out.
+type Image struct {
+	// Tags are the names the image was saved under, such as
+	// "example.com/app:1.0", if any.
+	Tags []string
+	// Layers is the number of layers of the image.
+	Layers int
+
+	root *node
+	// closers are the files holding the image, and the temporary files
+	// holding its decompressed layers.
+	closers []io.Closer
+	temps   []string
+}
+
+// maxLayerMemory bounds the decompressed size of a layer held in memory in
+// read-only mode, where it can't be written to a temporary file.
+var maxLayerMemory int64 = 512 << 20 // 512MiB
+
+// Magic numbers of the compressions of layers.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0}
+)
+
+// Open reads the image saved at path by "docker save", as a tar archive
+// optionally compressed with gzip, or the OCI image layout at path, a
+// directory or a tar archive of one. Compressed layers are decompressed to
+// temporary files, removed by Close, or to memory in read-only mode, see
+// package readonly. Archives holding more than one image aren't supported. Of
+// an OCI image index listing several platforms, the image for the platform of
+// the scanner is read, or else the first one for Linux or without a platform.
+func Open(path string) (*Image, error) {
+	img := &Image{root: newDir()}
+	if err := img.open(path); err != nil {
+		img.Close()
+		return nil, err
+	}
+	return img, nil
+}
+
+func (img *Image) open(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	var s store
+	if info.IsDir() {
+		s = &dirStore{img: img, dir: p}
+	} else {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		img.closers = append(img.closers, f)
+		ra, size, err := img.decompress(f, info.Size())
+		if err != nil {
+			return err
+		}
+		if s, err = newTarStore(ra, size); err != nil {
+			return fmt.Errorf("reading image archive: %v", err)
+		}
+	}
+	layers, err := img.resolve(s)
+	if err != nil {
+		return err
+	}
+	img.Layers = len(layers)
+	for _, l := range layers {
+		ra, size, err := s.open(l)
+		if err != nil {
+			return fmt.Errorf("opening layer %s: %v", l, err)
+		}
+		if ra, size, err = img.decompress(ra, size); err != nil {
+			return fmt.Errorf("decompressing layer %s: %v", l, err)
+		}
+		if err := img.addLayer(ra, size); err != nil {
+			return fmt.Errorf("reading layer %s: %v", l, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the files holding the image and removes its temporary files.
+func (img *Image) Close() error {
+	var first error
+	for _, c := range img.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	for _, t := range img.temps {
+		if err := os.Remove(t); err != nil && first == nil {
+			first = err
+		}
+	}
+	img.closers, img.temps = nil, nil
+	return first
+}
+
+// decompress returns the contents of ra of the given size, decompressed to
+// a temporary file if it's compressed with gzip, or to memory in read-only
+// mode.
+func (img *Image) decompress(ra io.ReaderAt, size int64) (io.ReaderAt, int64, error) {
+	h := make([]byte, 6)
+	n, err := ra.ReadAt(h, 0)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	h = h[:n]
+	switch {
+	case bytes.HasPrefix(h, zstdMagic):
+		return nil, 0, errors.New("zstd compression isn't supported")
+	case bytes.HasPrefix(h, xzMagic):
+		return nil, 0, errors.New("xz compression isn't supported")
+	case !bytes.HasPrefix(h, gzipMagic):
+		return ra, size, nil
+	}
+	zr, err := gzip.NewReader(io.NewSectionReader(ra, 0, size))
+	if err != nil {
+		return nil, 0, err
+	}
+	if readonly.Enabled() {
+		b, err := io.ReadAll(io.LimitReader(zr, maxLayerMemory+1))
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(b)) > maxLayerMemory {
+			return nil, 0, readonly.Check(fmt.Sprintf("decompressing layer over %d bytes to disk", maxLayerMemory))
+		}
+		return bytes.NewReader(b), int64(len(b)), nil
+	}
+	f, err := os.CreateTemp("", "log4jscanner-layer-")
+	if err != nil {
+		return nil, 0, err
+	}
+	img.closers = append(img.closers, f)
+	img.temps = append(img.temps, f.Name())
+	n64, err := io.Copy(f, zr)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, n64, nil
+}
+
+// store reads the files of a saved image, by their slash-separated paths.
+type store interface {
+	open(name string) (io.ReaderAt, int64, error)
+}
+
+// tarStore is the store of an image saved as a tar archive, whose files are
+// read in place.
+type tarStore struct {
+	ra    io.ReaderAt
+	files map[string]section
+}
+
+// section is the location of a file's contents in a tar archive.
+type section struct {
+	off, size int64
+}
+
+func newTarStore(ra io.ReaderAt, size int64) (*tarStore, error) {
+	s := &tarStore{ra: ra, files: map[string]section{}}
+	err := readTar(ra, size, func(hdr *tar.Header, off int64) error {
+		if hdr.Typeflag == tar.TypeReg {
+			s.files[cleanPath(hdr.Name)] = section{off, hdr.Size}
+		}
+		return nil
+	})
+	return s, err
+}
+
+func (s *tarStore) open(name string) (io.ReaderAt, int64, error) {
+	sec, ok := s.files[cleanPath(name)]
+	if !ok {
+		return nil, 0, fs.ErrNotExist
+	}
+	return io.NewSectionReader(s.ra, sec.off, sec.size), sec.size, nil
+}
+
+// dirStore is the store of an OCI image layout in a directory.
+type dirStore struct {
+	img *Image
+	dir string
+}
+
+func (s *dirStore) open(name string) (io.ReaderAt, int64, error) {
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(cleanPath(name))))
+	if err != nil {
+		return nil, 0, err
+	}
+	s.img.closers = append(s.img.closers, f)
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// readTar calls fn with the header of each entry of the tar archive ra of
+// the given size, and the offset of the entry's contents.
+func readTar(ra io.ReaderAt, size int64, fn func(hdr *tar.Header, off int64) error) error {
+	cr := &countReader{r: io.NewSectionReader(ra, 0, size)}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// The reader doesn't read past the header, so the contents
+		// follow what was read so far.
+		if err := fn(hdr, cr.n); err != nil {
+			return err
+		}
+	}
+}
+
+// countReader counts the bytes read from r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	return n, err
+}
+
+// cleanPath returns the path of a file of an archive relative to its root,
+// without a leading "/" or "./", or "" for the root itself.
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// dockerManifest is an image of the manifest.json file written by
+// "docker save".
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// descriptor describes a blob of an OCI image layout.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+// ociIndex is an OCI image index, or Docker manifest list, and ociManifest
+// an OCI or Docker image manifest.
+type (
+	ociIndex struct {
+		Manifests []descriptor `json:"manifests"`
+	}
+	ociManifest struct {
+		Layers []descriptor `json:"layers"`
+	}
+)
+
+// refAnnotation is the annotation of the tag of an image in an OCI image
+// layout.
+const refAnnotation = "org.opencontainers.image.ref.name"
+
+// maxIndexDepth bounds the nesting of image indexes.
+const maxIndexDepth = 4
+
+// resolve returns the paths of the layers of the image saved in s, from the
+// lowest to the uppermost, and sets the image's tags.
+func (img *Image) resolve(s store) ([]string, error) {
+	var images []dockerManifest
+	switch err := readJSON(s, "manifest.json", &images); {
+	case err == nil:
+		if len(images) != 1 {
+			return nil, fmt.Errorf("manifest.json lists %d images, only archives of one image are supported", len(images))
+		}
+		img.Tags = images[0].RepoTags
+		return images[0].Layers, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	var index ociIndex
+	if err := readJSON(s, "index.json", &index); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, errors.New("neither a docker save archive nor an OCI image layout, no manifest.json or index.json found")
+		}
+		return nil, err
+	}
+	for depth := 0; depth < maxIndexDepth; depth++ {
+		d, err := platformManifest(index.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		if tag := d.Annotations[refAnnotation]; tag != "" && img.Tags == nil {
+			img.Tags = []string{tag}
+		}
+		name, err := blobPath(d.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if isIndex(d.MediaType) {
+			index = ociIndex{}
+			if err := readJSON(s, name, &index); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var m ociManifest
+		if err := readJSON(s, name, &m); err != nil {
+			return nil, err
+		}
+		var layers []string
+		for _, l := range m.Layers {
+			p, err := blobPath(l.Digest)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, p)
+		}
+		return layers, nil
+	}
+	return nil, fmt.Errorf("image indexes nested more than %d levels", maxIndexDepth)
+}
+
+// isIndex reports whether a blob of the given media type is an image index.
+func isIndex(mediaType string) bool {
+	return mediaType == "application/vnd.oci.image.index.v1+json" ||
+		mediaType == "application/vnd.docker.distribution.manifest.list.v2+json"
+}
+
+// platformManifest returns the manifest of an index to read: its only one,
+// the one for the platform of the scanner, or else the first one for Linux
+// or of no given platform.
+func platformManifest(manifests []descriptor) (descriptor, error) {
+	if len(manifests) == 0 {
+		return descriptor{}, errors.New("image index lists no manifests")
+	}
+	if len(manifests) == 1 {
+		return manifests[0], nil
+	}
+	var fallback *descriptor
+	for i, d := range manifests {
+		if d.Platform != nil && d.Platform.OS == "linux" && d.Platform.Architecture == runtime.GOARCH {
+			return d, nil
+		}
+		if fallback == nil && (d.Platform == nil || d.Platform.OS == "linux") {
+			fallback = &manifests[i]
+		}
+	}
+	if fallback == nil {
+		return descriptor{}, fmt.Errorf("image index lists %d manifests, none for linux", len(manifests))
+	}
+	return *fallback, nil
+}
+
+// blobPath returns the path of the blob of an OCI image layout with the
+// given digest, such as "sha256:1234...".
+func blobPath(digest string) (string, error) {
+	i := strings.Index(digest, ":")
+	if i <= 0 || strings.ContainsAny(digest, "/\\") || digest[i+1:] == "" {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return "blobs/" + digest[:i] + "/" + digest[i+1:], nil
+}
+
+// maxJSONSize bounds the size of the manifests and indexes read.
+const maxJSONSize = 4 << 20
+
+// readJSON decodes the JSON file name of s into v.
+func readJSON(s store, name string, v interface{}) error {
+	ra, size, err := s.open(name)
+	if err != nil {
+		return err
+	}
+	if size > maxJSONSize {
+		return fmt.Errorf("%s is larger than %d bytes", name, maxJSONSize)
+	}
+	if err := json.NewDecoder(io.NewSectionReader(ra, 0, size)).Decode(v); err != nil {
+		return fmt.Errorf("parsing %s: %v", name, err)
+	}
+	return nil
+}
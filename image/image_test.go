@@ -0,0 +1,324 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+	"log4jscanner/testjar"
+)
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	return string(b)
+}
+
+// dockerSave returns an image of the given layers as written by
+// "docker save".
+func dockerSave(t *testing.T, layers ...[]byte) []byte {
+	t.Helper()
+	m := dockerManifest{Config: "config.json", RepoTags: []string{"example.com/app:1.0"}}
+	files := []testjar.Entry{testjar.File("config.json", "{}")}
+	for i, l := range layers {
+		name := strings.Repeat(string(rune('a'+i)), 8) + "/layer.tar"
+		m.Layers = append(m.Layers, name)
+		files = append(files, testjar.File(name, string(l)))
+	}
+	files = append(files, testjar.File("manifest.json", mustJSON(t, []dockerManifest{m})))
+	return testjar.Tar(t, files...)
+}
+
+// ociLayout returns the files of an OCI image layout of the given layers,
+// compressed with gzip, listed by an image index.
+func ociLayout(t *testing.T, layers ...[]byte) []testjar.Entry {
+	t.Helper()
+	files := []testjar.Entry{testjar.File("oci-layout", `{"imageLayoutVersion":"1.0.0"}`)}
+	blob := func(mediaType string, data []byte) descriptor {
+		sum := sha256.Sum256(data)
+		d := descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:])}
+		files = append(files, testjar.File("blobs/sha256/"+hex.EncodeToString(sum[:]), string(data)))
+		return d
+	}
+	var m ociManifest
+	for _, l := range layers {
+		m.Layers = append(m.Layers, blob("application/vnd.oci.image.layer.v1.tar+gzip", testjar.Gzip(t, l)))
+	}
+	md := blob("application/vnd.oci.image.manifest.v1+json", []byte(mustJSON(t, m)))
+	md.Annotations = map[string]string{refAnnotation: "1.0"}
+	other := md
+	other.Platform = &struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	}{"windows", "amd64"}
+	// An index of another platform's image, then of the image.
+	nested := blob("application/vnd.oci.image.index.v1+json", []byte(mustJSON(t, ociIndex{Manifests: []descriptor{other, md}})))
+	nested.Platform = other.Platform
+	files = append(files, testjar.File("index.json", mustJSON(t, ociIndex{Manifests: []descriptor{nested}})))
+	return files
+}
+
+// testLayers are the layers of a test image, the upper one deleting,
+// replacing, and linking files of the lower one.
+func testLayers(t *testing.T) [][]byte {
+	return [][]byte{
+		testjar.Tar(t,
+			testjar.Entry{Name: "opt/", Type: tar.TypeDir},
+			testjar.Entry{Name: "opt/app/", Type: tar.TypeDir},
+			testjar.File("opt/app/a.jar", "a"),
+			testjar.File("opt/app/b.jar", "b"),
+			testjar.File("opt/app/c.jar", "c"),
+			testjar.File("opt/old/d.jar", "d"),
+			testjar.File("etc/hostname", "old"),
+			testjar.File("lib/e.jar", "e"),
+		),
+		testjar.Tar(t,
+			testjar.File("./opt/app/.wh.a.jar", ""),
+			testjar.File("opt/old/.wh..wh..opq", ""),
+			testjar.File("opt/old/f.jar", "f"),
+			testjar.File("etc/hostname", "new"),
+			testjar.Entry{Name: "opt/app/g.jar", Type: tar.TypeLink, Link: "opt/app/b.jar"},
+			testjar.Entry{Name: "opt/app/h.jar", Type: tar.TypeSymlink, Link: "c.jar"},
+			testjar.File("/lib", "not a directory anymore"),
+		),
+	}
+}
+
+func readFiles(t *testing.T, fsys fs.FS) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, p)
+		got[p] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walking image: %v", err)
+	}
+	return got
+}
+
+func TestOpen(t *testing.T) {
+	layers := testLayers(t)
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		testjar.WriteFile(t, p, data)
+		return p
+	}
+	layout := ociLayout(t, layers...)
+	for _, f := range layout {
+		write(filepath.Join("layout", filepath.FromSlash(f.Name)), []byte(f.Contents))
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantTags []string
+	}{
+		{
+			name:     "docker save",
+			path:     write("app.tar", dockerSave(t, layers...)),
+			wantTags: []string{"example.com/app:1.0"},
+		},
+		{
+			name:     "compressed docker save",
+			path:     write("app.tar.gz", testjar.Gzip(t, dockerSave(t, layers...))),
+			wantTags: []string{"example.com/app:1.0"},
+		},
+		{
+			name:     "OCI image layout",
+			path:     filepath.Join(dir, "layout"),
+			wantTags: []string{"1.0"},
+		},
+		{
+			name:     "OCI image layout archive",
+			path:     write("layout.tar", testjar.Tar(t, layout...)),
+			wantTags: []string{"1.0"},
+		},
+	}
+	want := map[string]string{
+		"etc/hostname":  "new",
+		"lib":           "not a directory anymore",
+		"opt/app/b.jar": "b",
+		"opt/app/c.jar": "c",
+		"opt/app/g.jar": "b",
+		"opt/old/f.jar": "f",
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := Open(tc.path)
+			if err != nil {
+				t.Fatalf("Open(%s) failed: %v", tc.path, err)
+			}
+			defer img.Close()
+			if img.Layers != 2 {
+				t.Errorf("Open(%s) returned %d layers, want 2", tc.path, img.Layers)
+			}
+			if diff := cmp.Diff(tc.wantTags, img.Tags); diff != "" {
+				t.Errorf("Open(%s) returned tags diff (-want, +got):\n%s", tc.path, diff)
+			}
+			if diff := cmp.Diff(want, readFiles(t, img)); diff != "" {
+				t.Errorf("Open(%s) returned files diff (-want, +got):\n%s", tc.path, diff)
+			}
+			if err := fstest.TestFS(img, "etc/hostname", "opt/app/b.jar", "opt/old/f.jar"); err != nil {
+				t.Errorf("fstest.TestFS() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+	two := dockerManifest{Layers: []string{"a/layer.tar"}}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{
+			name:    "not an image",
+			data:    testjar.Tar(t, testjar.File("README", "hello")),
+			wantErr: "neither a docker save archive nor an OCI image layout",
+		},
+		{
+			name:    "two images",
+			data:    testjar.Tar(t, testjar.File("manifest.json", mustJSON(t, []dockerManifest{two, two}))),
+			wantErr: "manifest.json lists 2 images",
+		},
+		{
+			name:    "missing layer",
+			data:    testjar.Tar(t, testjar.File("manifest.json", mustJSON(t, []dockerManifest{two}))),
+			wantErr: "opening layer a/layer.tar",
+		},
+		{
+			name: "zstd layer",
+			data: testjar.Tar(t,
+				testjar.File("manifest.json", mustJSON(t, []dockerManifest{two})),
+				testjar.File("a/layer.tar", "\x28\xb5\x2f\xfdcompressed"),
+			),
+			wantErr: "zstd compression isn't supported",
+		},
+	}
+	for _, tc := range tests {
+		p := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "-")+".tar")
+		if err := os.WriteFile(p, tc.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		img, err := Open(p)
+		if err == nil {
+			img.Close()
+			t.Errorf("Open(%s) succeeded, want error %q", tc.name, tc.wantErr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("Open(%s) returned error %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestWalkImage(t *testing.T) {
+	vuln, err := testjar.Log4jCore("2.14.1").Bytes()
+	if err != nil {
+		t.Fatalf("building jar: %v", err)
+	}
+	base := testjar.Tar(t,
+		testjar.File("opt/app/lib/log4j-core.jar", string(vuln)),
+		testjar.File("opt/old/log4j-core.jar", string(vuln)),
+	)
+	upper := testjar.Tar(t, testjar.File("opt/old/.wh.log4j-core.jar", ""))
+	p := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(p, dockerSave(t, testjar.Gzip(t, base), upper), 0644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := Open(p)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer img.Close()
+
+	var got []string
+	w := &jar.Walker{
+		FS: func(string) fs.FS { return img },
+		HandleReport: func(path string, r *jar.Report) {
+			got = append(got, path)
+		},
+		HandleError: func(path string, err error) {
+			t.Errorf("walking %s: %v", path, err)
+		},
+	}
+	if err := w.Walk(p); err != nil {
+		t.Fatalf("Walk() failed: %v", err)
+	}
+	want := []string{filepath.Join(p, "opt", "app", "lib", "log4j-core.jar")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Walk() reported diff (-want, +got):\n%s", diff)
+	}
+}
+
+// Check that the temporary files of decompressed layers are removed.
+func TestClose(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	p := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(p, dockerSave(t, testjar.Gzip(t, testjar.Tar(t, testjar.File("a.jar", "a")))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := Open(p)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if _, err := io.ReadAll(io.NewSectionReader(mustOpen(t, img, "a.jar"), 0, 1)); err != nil {
+		t.Errorf("reading a.jar: %v", err)
+	}
+	if err := img.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	left, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("Close() left %d temporary files", len(left))
+	}
+}
+
+func mustOpen(t *testing.T, fsys fs.FS, name string) io.ReaderAt {
+	t.Helper()
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Fatalf("opening %s: %v", name, err)
+	}
+	return f.(io.ReaderAt)
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/readonly"
+	"log4jscanner/testjar"
+)
+
+// readOnlyEnv is set when the test binary re-executes itself to run
+// TestReadOnly in read-only mode, which can't be disabled once enabled.
+const readOnlyEnv = "LOG4JSCANNER_TEST_READ_ONLY"
+
+func TestReadOnly(t *testing.T) {
+	if os.Getenv(readOnlyEnv) != "1" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestReadOnly$", "-test.v")
+		cmd.Env = append(os.Environ(), readOnlyEnv+"=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("running TestReadOnly in read-only mode failed: %v\n%s", err, out)
+		}
+		return
+	}
+	readonly.Enable()
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "app.tar.gz")
+	layers := testLayers(t)
+	for i, l := range layers {
+		layers[i] = testjar.Gzip(t, l)
+	}
+	if err := os.WriteFile(p, testjar.Gzip(t, dockerSave(t, layers...)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	t.Run("memory", func(t *testing.T) {
+		img, err := Open(p)
+		if err != nil {
+			t.Fatalf("Open(%s) failed: %v", p, err)
+		}
+		defer img.Close()
+		want := map[string]string{
+			"etc/hostname":  "new",
+			"lib":           "not a directory anymore",
+			"opt/app/b.jar": "b",
+			"opt/app/c.jar": "c",
+			"opt/app/g.jar": "b",
+			"opt/old/f.jar": "f",
+		}
+		if diff := cmp.Diff(want, readFiles(t, img)); diff != "" {
+			t.Errorf("Open(%s) returned files diff (-want, +got):\n%s", p, diff)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		max := maxLayerMemory
+		defer func() { maxLayerMemory = max }()
+		maxLayerMemory = 16
+		if img, err := Open(p); err == nil {
+			img.Close()
+			t.Errorf("Open(%s) with layers over the memory limit succeeded, want error", p)
+		}
+	})
+
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatalf("reading temp directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Open() wrote %d files in read-only mode", len(entries))
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"log4jscanner/image"
+	"log4jscanner/jar"
+)
+
+// imageRoots are the paths of the images scanned with --image, whose files
+// aren't on the host.
+var imageRoots = map[string]bool{}
+
+// inImage reports whether path is in an image scanned with --image, so it
+// can't be inspected on the host.
+func inImage(path string) bool {
+	for root := range imageRoots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanImage walks the merged filesystem of the container image at path for
+// --image, reporting findings under path.
+func scanImage(w *jar.Walker, path string) error {
+	img, err := image.Open(path)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	imageRoots[path] = true
+	fsys := w.FS
+	w.FS = func(string) fs.FS { return img }
+	defer func() { w.FS = fsys }()
+	if err := w.Walk(path); err != nil && err != jar.ErrStopped {
+		return err
+	}
+	return nil
+}
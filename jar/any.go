@@ -0,0 +1,219 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// ErrUnknownFormat is returned by ParseAny for files that aren't an archive
+// of a supported format.
+var ErrUnknownFormat = errors.New("unknown archive format")
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ParseAny scans a file of any supported archive format, detected from its
+// contents rather than its name: a JAR or other ZIP archive, a JMOD file, a
+// tar archive, each optionally compressed with gzip or bzip2, or a Debian or
+// RPM package. The JARs within a container are scanned like JARs nested in a
+// JAR, as are the containers within it, such as the data.tar.gz of a Debian
+// package, and the container is reported vulnerable if any of them is. name
+// identifies the file in errors.
+//
+// ErrUnknownFormat is returned for files of other formats, and a
+// *TruncatedError for ZIP archives that were cut short. Containers compressed
+// with xz or zstd, such as most recent Debian packages, aren't supported.
+// Files that don't implement io.ReaderAt, and compressed archives, are read
+// into memory, or to a temporary file if they're larger than the spill
+// threshold.
+func ParseAny(name string, f fs.File) (*Report, error) {
+	return defaultConfig.ParseAny(name, f)
+}
+
+// ParseAnyContext is like ParseAny, but stops reading the file once ctx is
+// done, returning the context's error.
+func ParseAnyContext(ctx context.Context, name string, f fs.File) (*Report, error) {
+	return defaultConfig.ParseAnyContext(ctx, name, f)
+}
+
+// ParseAny scans a file like the ParseAny function, only evaluating the
+// rules enabled by the configuration.
+func (cfg *Config) ParseAny(name string, f fs.File) (*Report, error) {
+	return cfg.ParseAnyContext(context.Background(), name, f)
+}
+
+// ParseAnyContext is like ParseAny, but stops reading the file once ctx is
+// done, returning the context's error, or a *TimeoutError once the
+// configured Timeout has passed.
+func (cfg *Config) ParseAnyContext(ctx context.Context, name string, f fs.File) (*Report, error) {
+	start := time.Now()
+	c := cfg.newChecker()
+	var cancel context.CancelFunc
+	c.ctx, cancel = cfg.timeout(ctx)
+	defer cancel()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %v", name, err)
+	}
+	size := info.Size()
+	if !info.Mode().IsRegular() {
+		size = -1
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok || size < 0 {
+		var release func()
+		ra, size, release, err = c.buffer(f, size)
+		if err != nil {
+			if err := cfg.contextError(ctx, c.ctx); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("reading %s: %v", name, err)
+		}
+		defer release()
+	}
+	if err := c.checkAny(ra, size, 0, 0, false); err != nil {
+		if err := c.failure(); err != nil {
+			return nil, err
+		}
+		if err := cfg.contextError(ctx, c.ctx); err != nil {
+			return nil, err
+		}
+		var te *TruncatedError
+		if err == ErrUnknownFormat || errors.As(err, &te) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to check %s: %v", name, err)
+	}
+	rep := c.report()
+	rep.Stats.Duration = time.Since(start)
+	return rep, nil
+}
+
+// checkAny detects the format of an archive and checks it, at the given
+// depth of nesting, where held is the memory held by the archive and its
+// parents. compressed is set once the archive has been decompressed,
+// compressed data is only expected once.
+func (c *checker) checkAny(ra io.ReaderAt, size int64, depth int, held int64, compressed bool) error {
+	// The ustar magic of tar archives is at offset 257.
+	h := make([]byte, 262)
+	n, err := ra.ReadAt(h, 0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("reading header: %v", err)
+	}
+	h = h[:n]
+	sr := io.NewSectionReader(ra, 0, size)
+	switch {
+	case bytes.HasPrefix(h, gzipMagic) && !compressed:
+		zr, err := gzip.NewReader(sr)
+		if err != nil {
+			return fmt.Errorf("opening gzip stream: %v", err)
+		}
+		return c.checkCompressed("gzip stream", zr, size, depth, held)
+	case bytes.HasPrefix(h, bzip2Magic) && !compressed:
+		return c.checkCompressed("bzip2 stream", bzip2.NewReader(sr), size, depth, held)
+	case bytes.HasPrefix(h, xzMagic) || bytes.HasPrefix(h, zstdMagic):
+		return errUnsupportedCompression
+	case len(h) == 262 && string(h[257:262]) == "ustar":
+		return c.checkArchive(tarArchive{tar.NewReader(sr)}, depth, held)
+	case bytes.HasPrefix(h, arMagic):
+		a, err := newArArchive(sr)
+		if err != nil {
+			return fmt.Errorf("reading ar archive: %v", err)
+		}
+		return c.checkArchive(a, depth, held)
+	case bytes.HasPrefix(h, rpmMagic):
+		off, err := rpmPayload(ra, size)
+		if err != nil {
+			return err
+		}
+		return c.checkAny(io.NewSectionReader(ra, off, size-off), size-off, depth, held, false)
+	case bytes.HasPrefix(h, cpioMagic) || bytes.HasPrefix(h, cpioCRCMagic):
+		return c.checkArchive(newCPIOArchive(sr), depth, held)
+	}
+	return c.checkZip(ra, size, depth, held)
+}
+
+// checkCompressed checks the archive decompressed from r, read from a
+// compressed stream of the given size.
+func (c *checker) checkCompressed(name string, r io.Reader, size int64, depth int, held int64) error {
+	dr, err := c.limitRatio(name, r, -1, size)
+	if err != nil {
+		return err
+	}
+	ra, n, release, err := c.buffer(dr, -1)
+	if err != nil {
+		return fmt.Errorf("decompressing: %v", err)
+	}
+	defer release()
+	c.stats.DecompressedBytes += n
+	if _, ok := ra.(*bytes.Reader); ok {
+		held += n
+	}
+	return c.checkAny(ra, n, depth, held, true)
+}
+
+// checkZip checks a JAR, or a JMOD file, which is a JAR following a 4 byte
+// header.
+func (c *checker) checkZip(ra io.ReaderAt, size int64, depth int, held int64) error {
+	ra, size = openJMOD(ra, size)
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		if err == zip.ErrFormat {
+			if depth == 0 {
+				if err := CheckTruncated(ra, size); err != nil {
+					return err
+				}
+			}
+			return ErrUnknownFormat
+		}
+		return fmt.Errorf("parsing ZIP archive: %v", err)
+	}
+	return c.checkJAR(c.zipFSAt(zr, ra), depth, held)
+}
+
+// buffer reads an archive for random access, into memory if it's no larger
+// than the spill threshold and fits the memory budget, otherwise to a
+// temporary file. size is -1 if unknown. release frees the buffer.
+func (c *checker) buffer(r io.Reader, size int64) (ra io.ReaderAt, n int64, release func(), err error) {
+	r = &ctxReader{c.ctx, r}
+	limit := c.spill.threshold()
+	if size <= limit {
+		data, err := io.ReadAll(io.LimitReader(r, limit+1))
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		n := int64(len(data))
+		if n <= limit && c.spill.budget.reserve(n) {
+			return bytes.NewReader(data), n, func() { c.spill.budget.release(n) }, nil
+		}
+		r = io.MultiReader(bytes.NewReader(data), r)
+		size = n
+	}
+	tf, n, err := c.spill.file(r, size)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return tf, n, func() { tf.Close() }, nil
+}
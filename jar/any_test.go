@@ -0,0 +1,133 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"log4jscanner/testjar"
+)
+
+// tarOf returns a tar archive of test JARs, keyed by their name in the
+// archive.
+func tarOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var entries []testjar.Entry
+	for name, testdata := range files {
+		data := []byte("not a jar")
+		if testdata != "" {
+			var err error
+			if data, err = os.ReadFile(testdataPath(testdata)); err != nil {
+				t.Fatalf("reading %s: %v", testdata, err)
+			}
+		}
+		entries = append(entries, testjar.File(name, string(data)))
+	}
+	return testjar.Tar(t, entries...)
+}
+
+// streamFile hides the io.ReaderAt implementation of a file, like a file
+// read from a network stream.
+type streamFile struct {
+	fs.File
+}
+
+func TestParseAny(t *testing.T) {
+	vuln, err := os.ReadFile(testdataPath("bad_jar_in_jar.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	safe, err := os.ReadFile(testdataPath("safe1.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	app := tarOf(t, map[string]string{
+		"opt/app/README":                 "",
+		"opt/app/lib/safe.jar":           "safe1.jar",
+		"opt/app/lib/log4j-core.jar":     "log4j-core-2.14.0.jar",
+		"opt/app/lib/notarealjar.jar":    "notarealjar.jar",
+		"opt/app/lib/log4j-core.jar.bak": "log4j-core-2.14.0.jar",
+	})
+	safeApp := tarOf(t, map[string]string{"opt/app/lib/safe.jar": "safe1.jar"})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    bool
+		wantErr error
+	}{
+		{name: "app.jar", data: vuln, want: true},
+		{name: "safe.jar", data: safe, want: false},
+		{name: "java.base.jmod", data: append([]byte{'J', 'M', 1, 0}, vuln...), want: true},
+		{name: "app.jar.gz", data: testjar.Gzip(t, vuln), want: true},
+		{name: "app.tar", data: app, want: true},
+		{name: "app.tar.gz", data: testjar.Gzip(t, app), want: true},
+		{name: "safe.tar", data: safeApp, want: false},
+		{name: "README", data: []byte("hello"), wantErr: ErrUnknownFormat},
+		{name: "empty", data: nil, wantErr: ErrUnknownFormat},
+	}
+	for _, tc := range tests {
+		fsys := fstest.MapFS{tc.name: &fstest.MapFile{Data: tc.data}}
+		for _, stream := range []bool{false, true} {
+			f, err := fsys.Open(tc.name)
+			if err != nil {
+				t.Fatalf("opening %s: %v", tc.name, err)
+			}
+			if stream {
+				f = streamFile{f}
+			}
+			r, err := ParseAny(tc.name, f)
+			f.Close()
+			if tc.wantErr != nil {
+				if err != tc.wantErr {
+					t.Errorf("ParseAny(%s) (stream %v) returned error %v, want %v", tc.name, stream, err, tc.wantErr)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("ParseAny(%s) (stream %v) failed: %v", tc.name, stream, err)
+				continue
+			}
+			if r.Vulnerable != tc.want {
+				t.Errorf("ParseAny(%s) (stream %v) returned vulnerable %v, want %v", tc.name, stream, r.Vulnerable, tc.want)
+			}
+		}
+	}
+}
+
+func TestParseAnySpill(t *testing.T) {
+	app := tarOf(t, map[string]string{"lib/log4j-core.jar": "log4j-core-2.14.0.jar"})
+	fsys := fstest.MapFS{"app.tar.gz": &fstest.MapFile{Data: testjar.Gzip(t, app)}}
+	f, err := fsys.Open("app.tar.gz")
+	if err != nil {
+		t.Fatalf("opening: %v", err)
+	}
+	defer f.Close()
+	dir := t.TempDir()
+	cfg := &Config{SpillThreshold: 1024, SpillDir: dir}
+	r, err := cfg.ParseAny("app.tar.gz", f)
+	if err != nil {
+		t.Fatalf("ParseAny() failed: %v", err)
+	}
+	if !r.Vulnerable {
+		t.Errorf("ParseAny() returned not vulnerable, want vulnerable")
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("ParseAny() left %d temporary files (err %v), want 0", len(entries), err)
+	}
+}
@@ -0,0 +1,385 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"log4jscanner/manifest"
+)
+
+// Version ranges of log4j-core, as inferred from its JNDI classes. Finer
+// ranges can't be told apart by the classes the rules inspect.
+const (
+	// VersionBefore215 has the JndiManager constructor removed in 2.15.0.
+	VersionBefore215 = "<2.15"
+	// Version215 has neither that constructor nor the isJndiEnabled
+	// method added in 2.16.0.
+	Version215 = "2.15"
+	// VersionAtLeast216 has the isJndiEnabled method.
+	VersionAtLeast216 = ">=2.16"
+)
+
+// versionRanges orders the version ranges from oldest to newest.
+var versionRanges = []string{VersionBefore215, Version215, VersionAtLeast216}
+
+// Mitigations of copies of log4j-core in a vulnerable version range, applied
+// to the JAR rather than by upgrading it.
+const (
+	// MitigationLookupRemoved has the JndiLookup class deleted from the
+	// JAR, the mitigation recommended by Apache, so it's no longer found
+	// vulnerable.
+	MitigationLookupRemoved = "jndi-lookup-removed"
+	// MitigationMessageLookupsRemoved has a MessagePatternConverter
+	// patched to never look up messages, like log4j2.formatMsgNoLookups
+	// does, by a rebuilt or hot-patched JAR. The copy is still found
+	// vulnerable, since lookups elsewhere, such as thread context lookups
+	// in patterns (CVE-2021-45046), remain exploitable.
+	MitigationMessageLookupsRemoved = "message-lookups-removed"
+)
+
+// Artifact is a copy of log4j-core found in a JAR.
+type Artifact struct {
+	// Path is the archive holding the copy's classes within the JAR, with
+	// nested archives separated by "!" like Evidence paths, such as
+	// "WEB-INF/lib/log4j-core-2.14.1.jar". It's empty if the classes are in
+	// the JAR itself, such as log4j-core itself or a JAR shading it.
+	Path string
+	// VersionRange is the inferred range of log4j versions of the copy,
+	// such as VersionBefore215, or empty if it has no JndiManager class to
+	// infer it from.
+	VersionRange string
+	// Version is the exact version of the copy, such as "2.14.1", taken
+	// from its Maven pom.properties or its own manifest, or empty if it
+	// records neither. When set, VersionRange is derived from it rather
+	// than from the classes.
+	Version string
+	// JndiLookup reports if the copy includes the JndiLookup class. Copies
+	// without it were mitigated by removing the class.
+	JndiLookup bool
+	// Rules lists the IDs of the enabled rules the copy matched on its own.
+	Rules []string
+	// Mitigation is set if the copy is in a vulnerable version range but
+	// was mitigated, such as to MitigationLookupRemoved, telling patched
+	// copies apart from ones that were never affected.
+	Mitigation string
+}
+
+// artifactState holds what was found of a copy of log4j-core.
+type artifactState struct {
+	lookup         bool
+	oldConstructor bool
+	seenManager    bool
+	isJndiEnabled  bool
+	dataSource     bool
+	jndiJdbcCheck  bool
+	// version is the exact version of the copy, and fromPOM reports if it
+	// was read from pom.properties, which takes precedence over the
+	// manifest.
+	version string
+	fromPOM bool
+	// seenConverter is set once the MessagePatternConverter was read, and
+	// messageLookups if it looks up messages.
+	seenConverter  bool
+	messageLookups bool
+}
+
+// Classes of log4j-core opened to classify its mitigations.
+const (
+	jndiLookupClass              = "org/apache/logging/log4j/core/lookup/JndiLookup.class"
+	messagePatternConverterClass = "org/apache/logging/log4j/core/pattern/MessagePatternConverter.class"
+)
+
+// maxConverterSize bounds the bytes of the MessagePatternConverter read when
+// opened directly.
+const maxConverterSize = 1 << 20 // 1MiB
+
+// strSubstitutorCall is referenced by the MessagePatternConverter of log4j
+// versions before 2.15.0 to look up messages.
+var strSubstitutorCall = []byte("getStrSubstitutor")
+
+// converter records the MessagePatternConverter class of the copy of log4j in
+// the archive being checked.
+func (c *checker) converter(p string, content []byte) {
+	a := c.artifact()
+	a.seenConverter = true
+	if i := bytes.Index(content, strSubstitutorCall); i >= 0 {
+		a.messageLookups = true
+		c.evidence(p, int64(i), "MessagePatternConverter looks up messages")
+	} else {
+		c.evidence(p, -1, "MessagePatternConverter doesn't look up messages")
+	}
+}
+
+// checkMitigations opens the classes of the copy of log4j in the archive r
+// that its walk didn't reach, since reading stops once a JAR is found
+// vulnerable, so mitigated copies are told apart from vulnerable ones.
+// Shaded copies are only classified by the classes that were read.
+func (c *checker) checkMitigations(r fs.FS) {
+	a, ok := c.artifacts[strings.TrimSuffix(c.nested, "!")]
+	if !ok {
+		return
+	}
+	prefix := ""
+	if c.jmod {
+		prefix = jmodClassesDir
+	}
+	if !a.lookup {
+		if _, err := fs.Stat(r, prefix+jndiLookupClass); err == nil {
+			a.lookup = true
+		}
+	}
+	if !a.lookup || a.seenConverter {
+		return
+	}
+	f, err := r.Open(prefix + messagePatternConverterClass)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	buf, err := readClass(io.LimitReader(f, maxConverterSize))
+	if err != nil {
+		return
+	}
+	defer releaseClass(buf)
+	c.stats.DecompressedBytes += int64(buf.Len())
+	c.converter(prefix+messagePatternConverterClass, buf.Bytes())
+}
+
+// log4jCorePOM is the Maven metadata of log4j-core, which records its
+// version.
+const log4jCorePOM = "META-INF/maven/org.apache.logging.log4j/log4j-core/pom.properties"
+
+// log4jManifest holds the manifest attributes identifying log4j-core and its
+// version, collected from the main section of a manifest. They also identify
+// other components, see Config.Inventory.
+type log4jManifest struct {
+	title, symbolicName        string
+	implVersion, bundleVersion string
+}
+
+// newLog4jManifest collects the attributes of the main section of a
+// manifest.
+func newLog4jManifest(attrs manifest.Attributes) log4jManifest {
+	m := log4jManifest{
+		title:         attrs.Get("Implementation-Title"),
+		implVersion:   attrs.Get("Implementation-Version"),
+		bundleVersion: attrs.Get("Bundle-Version"),
+	}
+	m.symbolicName, _ = splitClause(attrs.Get("Bundle-SymbolicName"))
+	return m
+}
+
+// version returns the version of log4j-core the manifest describes, or "" if
+// it's the manifest of another JAR.
+func (m *log4jManifest) version() string {
+	if m.title != "Apache Log4j Core" && m.symbolicName != "org.apache.logging.log4j.core" {
+		return ""
+	}
+	if m.implVersion != "" {
+		return m.implVersion
+	}
+	return m.bundleVersion
+}
+
+// manifestVersion records the version of log4j-core from the manifest at path
+// p, unless pom.properties already provided it.
+func (c *checker) manifestVersion(p string, m *log4jManifest) {
+	v := m.version()
+	if v == "" {
+		return
+	}
+	a := c.artifact()
+	if a.fromPOM {
+		return
+	}
+	a.version = v
+	c.evidence(p, -1, "log4j-core version "+v+" in manifest")
+}
+
+// pomVersion records the version v of log4j-core from its pom.properties at
+// path p.
+func (c *checker) pomVersion(p, v string) {
+	if v == "" {
+		return
+	}
+	a := c.artifact()
+	a.version, a.fromPOM = v, true
+	c.evidence(p, -1, "log4j-core version "+v+" in pom.properties")
+}
+
+// versionRange returns the version range of an exact log4j 2 version, or ""
+// if it isn't one.
+func versionRange(v string) string {
+	n := versionNumbers(v)
+	if len(n) < 2 || n[0] != 2 {
+		return ""
+	}
+	switch {
+	case n[1] < 15:
+		return VersionBefore215
+	case n[1] == 15:
+		return Version215
+	}
+	return VersionAtLeast216
+}
+
+// versionNumbers returns the leading numbers of the dot separated components
+// of a version, such as [2 17 0] for "2.17.0-rc1", stopping at the first
+// component without one.
+func versionNumbers(v string) []int {
+	var n []int
+	for _, f := range strings.Split(v, ".") {
+		end := 0
+		for end < len(f) && f[end] >= '0' && f[end] <= '9' {
+			end++
+		}
+		i, err := strconv.Atoi(f[:end])
+		if err != nil {
+			break
+		}
+		n = append(n, i)
+		if end < len(f) {
+			break
+		}
+	}
+	return n
+}
+
+// compareVersions compares versions by their numbers, returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	na, nb := versionNumbers(a), versionNumbers(b)
+	for i := 0; i < len(na) && i < len(nb); i++ {
+		if na[i] != nb[i] {
+			if na[i] < nb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(na) < len(nb):
+		return -1
+	case len(na) > len(nb):
+		return 1
+	}
+	return 0
+}
+
+// artifact returns the state of the copy of log4j in the archive being
+// checked.
+func (c *checker) artifact() *artifactState {
+	p := strings.TrimSuffix(c.nested, "!")
+	a, ok := c.artifacts[p]
+	if !ok {
+		if c.artifacts == nil {
+			c.artifacts = map[string]*artifactState{}
+		}
+		a = &artifactState{}
+		c.artifacts[p] = a
+	}
+	return a
+}
+
+// artifactList returns the copies of log4j found, ordered by path.
+func (c *checker) artifactList() []Artifact {
+	var artifacts []Artifact
+	for p, a := range c.artifacts {
+		art := Artifact{Path: p, Version: a.version, JndiLookup: a.lookup}
+		switch {
+		case versionRange(a.version) != "":
+			art.VersionRange = versionRange(a.version)
+		case a.oldConstructor:
+			art.VersionRange = VersionBefore215
+		case a.seenManager && a.isJndiEnabled:
+			art.VersionRange = VersionAtLeast216
+		case a.seenManager:
+			art.VersionRange = Version215
+		}
+		// Copies before 2.16.0 look up JNDI names. Without JndiLookup
+		// they can't, unless it's only missing because the walk was cut
+		// short, or the copy was shaded with its Maven metadata alone.
+		switch {
+		case art.VersionRange != VersionBefore215 && art.VersionRange != Version215:
+		case !a.lookup && a.seenManager && !c.skipped:
+			art.Mitigation = MitigationLookupRemoved
+		case art.VersionRange == VersionBefore215 && a.seenConverter && !a.messageLookups:
+			art.Mitigation = MitigationMessageLookupsRemoved
+		}
+		for _, r := range Rules {
+			if !c.rules[r.ID] {
+				continue
+			}
+			switch {
+			case r.ID == RuleLog4j44228Constructor && a.lookup && a.oldConstructor,
+				r.ID == RuleLog4j216Heuristic && a.lookup && a.seenManager && !a.isJndiEnabled,
+				r.ID == RuleLog4j44832JDBC && a.dataSource && a.seenManager && !a.jndiJdbcCheck:
+				art.Rules = append(art.Rules, r.ID)
+			}
+		}
+		artifacts = append(artifacts, art)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Path < artifacts[j].Path
+	})
+	return artifacts
+}
+
+// Mitigated reports if the JAR holds copies of log4j-core in vulnerable
+// version ranges, and all of them were mitigated, see Artifact.Mitigation.
+// Such JARs may still be found vulnerable, depending on the mitigation.
+func (r *Report) Mitigated() bool {
+	mitigated := false
+	for _, a := range r.Artifacts {
+		if a.VersionRange != VersionBefore215 && a.VersionRange != Version215 {
+			continue
+		}
+		if a.Mitigation == "" {
+			return false
+		}
+		mitigated = true
+	}
+	return mitigated
+}
+
+// Log4jVersion returns the oldest exact version of the copies of log4j in the
+// JAR, such as "2.14.1", or "" if none records its version.
+func (r *Report) Log4jVersion() string {
+	oldest := ""
+	for _, a := range r.Artifacts {
+		if a.Version != "" && (oldest == "" || compareVersions(a.Version, oldest) < 0) {
+			oldest = a.Version
+		}
+	}
+	return oldest
+}
+
+// VersionRange returns the oldest version range of the copies of log4j in
+// the JAR, the one to patch first, or "" if none was inferred.
+func (r *Report) VersionRange() string {
+	for _, v := range versionRanges {
+		for _, a := range r.Artifacts {
+			if a.VersionRange == v {
+				return v
+			}
+		}
+	}
+	return ""
+}
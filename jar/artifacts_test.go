@@ -0,0 +1,290 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+func TestParseArtifacts(t *testing.T) {
+	both := []string{RuleLog4j44228Constructor, RuleLog4j216Heuristic}
+	tests := []struct {
+		filename    string
+		want        []Artifact
+		wantRange   string
+		wantVersion string
+	}{
+		{
+			filename:    "log4j-core-2.14.0.jar",
+			want:        []Artifact{{VersionRange: VersionBefore215, Version: "2.14.0", JndiLookup: true, Rules: both}},
+			wantRange:   VersionBefore215,
+			wantVersion: "2.14.0",
+		},
+		{
+			filename:    "log4j-core-2.14.0.jar.patched",
+			want:        []Artifact{{VersionRange: VersionBefore215, Version: "2.14.0", Mitigation: MitigationLookupRemoved}},
+			wantRange:   VersionBefore215,
+			wantVersion: "2.14.0",
+		},
+		{
+			filename:    "log4j-core-2.15.0.jar",
+			want:        []Artifact{{VersionRange: Version215, Version: "2.15.0", JndiLookup: true, Rules: []string{RuleLog4j216Heuristic}}},
+			wantRange:   Version215,
+			wantVersion: "2.15.0",
+		},
+		{
+			filename:    "log4j-core-2.16.0.jar",
+			want:        []Artifact{{VersionRange: VersionAtLeast216, Version: "2.16.0", JndiLookup: true}},
+			wantRange:   VersionAtLeast216,
+			wantVersion: "2.16.0",
+		},
+		{
+			filename:  "bad_jar_in_jar_in_jar.jar",
+			want:      []Artifact{{Path: "bad_jar_in_jar.jar!vuln-class.jar", VersionRange: VersionBefore215, JndiLookup: true, Rules: both}},
+			wantRange: VersionBefore215,
+		},
+		{
+			filename: "safe1.jar",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.filename, func(t *testing.T) {
+			zr, err := zip.OpenReader(testdataPath(tc.filename))
+			if err != nil {
+				t.Fatalf("zip.OpenReader failed: %v", err)
+			}
+			defer zr.Close()
+			report, err := Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, report.Artifacts); diff != "" {
+				t.Errorf("Parse() returned unexpected artifacts (-want, +got):\n%s", diff)
+			}
+			if got := report.VersionRange(); got != tc.wantRange {
+				t.Errorf("VersionRange() = %q, want %q", got, tc.wantRange)
+			}
+			if got := report.Log4jVersion(); got != tc.wantVersion {
+				t.Errorf("Log4jVersion() = %q, want %q", got, tc.wantVersion)
+			}
+		})
+	}
+}
+
+func TestParseArtifactVersion(t *testing.T) {
+	const pom = "META-INF/maven/org.apache.logging.log4j/log4j-core/pom.properties"
+	tests := []struct {
+		name  string
+		files []testjar.Entry
+		want  []Artifact
+	}{
+		{
+			name: "POM",
+			files: []testjar.Entry{
+				testjar.File(pom, "#Created by Apache Maven\nversion=2.12.1\ngroupId=org.apache.logging.log4j\n"),
+			},
+			want: []Artifact{{Version: "2.12.1", VersionRange: VersionBefore215}},
+		},
+		{
+			name: "Manifest",
+			files: []testjar.Entry{
+				testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\nImplementation-Title: Apache Log4j Core\nImplementation-Version: 2.17.1\n"),
+			},
+			want: []Artifact{{Version: "2.17.1", VersionRange: VersionAtLeast216}},
+		},
+		{
+			name: "BundleVersion",
+			files: []testjar.Entry{
+				testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\nBundle-SymbolicName: org.apache.logging.log4j.core\nBundle-Version: 2.15.0\n"),
+			},
+			want: []Artifact{{Version: "2.15.0", VersionRange: Version215}},
+		},
+		{
+			name: "POMOverridesManifest",
+			files: []testjar.Entry{
+				testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\nImplementation-Title: Apache Log4j Core\nImplementation-Version: 2.17.1\n"),
+				testjar.File(pom, "version=2.14.1\n"),
+			},
+			want: []Artifact{{Version: "2.14.1", VersionRange: VersionBefore215}},
+		},
+		{
+			name: "OtherManifest",
+			files: []testjar.Entry{
+				testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\nImplementation-Title: app\nImplementation-Version: 1.0\n"),
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := testjar.Zip(t, zip.Deflate, tc.files...)
+			zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatalf("zip.NewReader failed: %v", err)
+			}
+			report, err := Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, report.Artifacts); diff != "" {
+				t.Errorf("Parse() returned unexpected artifacts (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2.14.1", "2.14.1", 0},
+		{"2.9.1", "2.14.0", -1},
+		{"2.17.0", "2.17.0-rc1", 0},
+		{"2.17", "2.17.1", -1},
+		{"2.3.2", "2.3.1", 1},
+	}
+	for _, tc := range tests {
+		if got := compareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestReportVersionRange(t *testing.T) {
+	r := &Report{Artifacts: []Artifact{
+		{Path: "a.jar", VersionRange: VersionAtLeast216},
+		{Path: "b.jar"},
+		{Path: "c.jar", VersionRange: Version215},
+	}}
+	if got := r.VersionRange(); got != Version215 {
+		t.Errorf("VersionRange() = %q, want %q", got, Version215)
+	}
+}
+
+// replaceEntry returns a copy of the JAR filename, with the entry name
+// replaced by content.
+func replaceEntry(t *testing.T, filename, name string, content []byte) []byte {
+	t.Helper()
+	zr, err := zip.OpenReader(testdataPath(filename))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range zr.File {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatalf("creating %s: %v", f.Name, err)
+		}
+		if f.Name == name {
+			_, err = w.Write(content)
+		} else {
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err == nil {
+				_, err = io.Copy(w, rc)
+				rc.Close()
+			}
+		}
+		if err != nil {
+			t.Fatalf("copying %s: %v", f.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestParseMitigations(t *testing.T) {
+	// The MessagePatternConverter of 2.16.0 never looks up messages, like
+	// the patched classes of rebuilt JARs.
+	converter := readClasses(t, "log4j-core-2.16.0.jar")[messagePatternConverterClass]
+	noLookups := replaceEntry(t, "log4j-core-2.14.0.jar", messagePatternConverterClass, converter)
+	readFile := func(t *testing.T, filename string) []byte {
+		b, err := os.ReadFile(testdataPath(filename))
+		if err != nil {
+			t.Fatalf("reading testdata: %v", err)
+		}
+		return b
+	}
+	tests := []struct {
+		name           string
+		data           []byte
+		wantVulnerable bool
+		wantMitigation string
+		wantMitigated  bool
+	}{
+		{
+			name:           "Vulnerable",
+			data:           readFile(t, "log4j-core-2.14.0.jar"),
+			wantVulnerable: true,
+		},
+		{
+			name:           "LookupRemoved",
+			data:           readFile(t, "log4j-core-2.14.0.jar.patched"),
+			wantMitigation: MitigationLookupRemoved,
+			wantMitigated:  true,
+		},
+		{
+			name:           "LookupRemoved215",
+			data:           readFile(t, "log4j-core-2.15.0.jar.patched"),
+			wantMitigation: MitigationLookupRemoved,
+			wantMitigated:  true,
+		},
+		{
+			name:           "MessageLookupsRemoved",
+			data:           noLookups,
+			wantVulnerable: true,
+			wantMitigation: MitigationMessageLookupsRemoved,
+			wantMitigated:  true,
+		},
+		{
+			name: "Fixed",
+			data: readFile(t, "log4j-core-2.16.0.jar"),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			zr, err := zip.NewReader(bytes.NewReader(tc.data), int64(len(tc.data)))
+			if err != nil {
+				t.Fatalf("zip.NewReader failed: %v", err)
+			}
+			report, err := Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if report.Vulnerable != tc.wantVulnerable {
+				t.Errorf("Parse() returned vulnerable=%t, want %t", report.Vulnerable, tc.wantVulnerable)
+			}
+			if len(report.Artifacts) != 1 {
+				t.Fatalf("Parse() returned %d artifacts, want 1", len(report.Artifacts))
+			}
+			if got := report.Artifacts[0].Mitigation; got != tc.wantMitigation {
+				t.Errorf("Parse() returned mitigation %q, want %q", got, tc.wantMitigation)
+			}
+			if got := report.Mitigated(); got != tc.wantMitigated {
+				t.Errorf("Mitigated() = %t, want %t", got, tc.wantMitigated)
+			}
+		})
+	}
+}
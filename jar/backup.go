@@ -0,0 +1,205 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Backup keeps the originals of the JARs a Walker rewrites, and of the
+// classes it removes from exploded archives, so rewrites can be rolled back.
+// Originals are kept before the rewritten JAR replaces them, so the JAR is
+// never missing.
+type Backup struct {
+	// Suffix, if set, keeps the original next to the rewritten JAR, with the
+	// suffix appended to its name, such as ".bak". Files with the suffix
+	// aren't scanned, since it isn't an archive extension.
+	Suffix string
+	// QuarantineDir, if set, keeps the original within the directory
+	// instead, under its absolute path, so /opt/app/a.jar is kept as
+	// QuarantineDir/opt/app/a.jar. Originals are hard linked if the
+	// directory is on the same filesystem as the JAR, and copied
+	// otherwise. The directory shouldn't be scanned, or its vulnerable
+	// JARs would be rewritten too.
+	QuarantineDir string
+}
+
+// path returns where the original of the JAR at fp is kept.
+func (b *Backup) path(fp string) (string, error) {
+	if b.QuarantineDir == "" {
+		return fp + b.Suffix, nil
+	}
+	abs, err := filepath.Abs(fp)
+	if err != nil {
+		return "", err
+	}
+	vol := filepath.VolumeName(abs)
+	// Drive letters are kept as a directory, such as C:\a.jar as C\a.jar.
+	return filepath.Join(b.QuarantineDir, strings.TrimSuffix(vol, ":"), abs[len(vol):]), nil
+}
+
+// keep keeps the original of the JAR at fp, replacing an older original.
+func (b *Backup) keep(fp string, info fs.FileInfo) error {
+	dst, err := b.path(fp)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(fp, dst); err == nil {
+		return nil
+	}
+	return copyFile(dst, fp, info)
+}
+
+// copyFile copies the file at src, described by info, to dst, keeping its
+// mode and owner. dst is written to a temporary file first, so it's only
+// created once complete.
+func copyFile(dst, src string, info fs.FileInfo) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tf, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %v", err)
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+	if _, err := io.Copy(tf, f); err != nil {
+		return fmt.Errorf("copying %s: %v", src, err)
+	}
+	if err := tf.Sync(); err != nil {
+		return fmt.Errorf("syncing %s: %v", tf.Name(), err)
+	}
+	tf.Close()
+	if err := preserveMode(tf.Name(), info); err != nil {
+		return err
+	}
+	return os.Rename(tf.Name(), dst)
+}
+
+// preserveMode sets the mode and owner of the file at p to info's.
+func preserveMode(p string, info fs.FileInfo) error {
+	if err := os.Chmod(p, info.Mode()); err != nil {
+		return fmt.Errorf("chmod file: %v", err)
+	}
+	uid, gid, ok, err := fileOwner(info)
+	if err != nil {
+		return fmt.Errorf("determining file owner: %v", err)
+	}
+	if ok {
+		if err := os.Chown(p, int(uid), int(gid)); err != nil {
+			return fmt.Errorf("changing ownership of %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// Original is the kept original of a rewritten JAR or removed class.
+type Original struct {
+	// Path is the rewritten JAR or removed class, and Backup where its
+	// original is kept.
+	Path   string
+	Backup string
+}
+
+// Originals returns the originals kept of the rewritten JARs and removed
+// classes within dir, sorted by path.
+func (b *Backup) Originals(dir string) ([]Original, error) {
+	root := dir
+	if b.QuarantineDir != "" {
+		var err error
+		if root, err = b.path(dir); err != nil {
+			return nil, err
+		}
+	}
+	var originals []Original
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) && b.QuarantineDir != "" {
+				// Nothing was quarantined from dir.
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if b.QuarantineDir != "" {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			if HasArchiveExt(p) || removedClass(p) {
+				originals = append(originals, Original{Path: filepath.Join(dir, rel), Backup: p})
+			}
+			return nil
+		}
+		if orig := strings.TrimSuffix(p, b.Suffix); orig != p && (HasArchiveExt(orig) || removedClass(orig)) {
+			originals = append(originals, Original{Path: orig, Backup: p})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(originals, func(i, j int) bool { return originals[i].Path < originals[j].Path })
+	return originals, nil
+}
+
+// removedClass reports if p is a class, which rewriting an exploded archive
+// removes rather than rewrites.
+func removedClass(p string) bool {
+	return filepath.Ext(p) == ".class"
+}
+
+// Restore replaces the rewritten JAR with its original, removing the
+// backup. The rewritten JAR must still exist, so JARs removed since, such as
+// undeployed applications, aren't brought back. Removed classes are put
+// back if their directory still exists.
+func (o Original) Restore() error {
+	if removedClass(o.Path) {
+		if _, err := os.Stat(filepath.Dir(o.Path)); err != nil {
+			return fmt.Errorf("directory of removed class: %v", err)
+		}
+	} else if _, err := os.Lstat(o.Path); err != nil {
+		return fmt.Errorf("rewritten JAR: %v", err)
+	}
+	if err := os.Rename(o.Backup, o.Path); err == nil {
+		return nil
+	}
+	// The backup is on another filesystem.
+	info, err := os.Stat(o.Backup)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(o.Path, o.Backup, info); err != nil {
+		return fmt.Errorf("restoring %s: %v", o.Backup, err)
+	}
+	return os.Remove(o.Backup)
+}
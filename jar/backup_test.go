@@ -0,0 +1,128 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBackup(t *testing.T) {
+	quarantine := t.TempDir()
+	tests := []struct {
+		name   string
+		backup *Backup
+		// kept returns where the original of p is kept.
+		kept func(p string) string
+		// files is the number of files left in the JAR's directory.
+		files int
+	}{
+		{
+			name:   "suffix",
+			backup: &Backup{Suffix: ".bak"},
+			kept:   func(p string) string { return p + ".bak" },
+			files:  2,
+		},
+		{
+			name:   "quarantine",
+			backup: &Backup{QuarantineDir: quarantine},
+			kept:   func(p string) string { return filepath.Join(quarantine, p) },
+			files:  1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := filepath.Join(dir, "lib", "vuln-class.jar")
+			cpFile(t, p, testdataPath("vuln-class.jar"))
+			orig, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatalf("reading JAR: %v", err)
+			}
+
+			w := &Walker{Rewrite: true, Backup: tc.backup}
+			if err := w.Walk(dir); err != nil {
+				t.Fatalf("Walk() failed: %v", err)
+			}
+			kept, err := os.ReadFile(tc.kept(p))
+			if err != nil {
+				t.Fatalf("reading original: %v", err)
+			}
+			if !bytes.Equal(kept, orig) {
+				t.Errorf("original of %s wasn't kept unchanged", p)
+			}
+			if err := verifyRewrite(p); err != nil {
+				t.Errorf("rewritten JAR failed verification: %v", err)
+			}
+			entries, err := os.ReadDir(filepath.Dir(p))
+			if err != nil {
+				t.Fatalf("listing directory: %v", err)
+			}
+			if len(entries) != tc.files {
+				// Temporary files must be cleaned up.
+				t.Errorf("directory of rewritten JAR holds %d files, want %d", len(entries), tc.files)
+			}
+
+			originals, err := tc.backup.Originals(dir)
+			if err != nil {
+				t.Fatalf("Originals() failed: %v", err)
+			}
+			want := []Original{{Path: p, Backup: tc.kept(p)}}
+			if diff := cmp.Diff(want, originals); diff != "" {
+				t.Fatalf("Originals() returned diff (-want, +got):\n%s", diff)
+			}
+			if err := originals[0].Restore(); err != nil {
+				t.Fatalf("Restore() failed: %v", err)
+			}
+			restored, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatalf("reading restored JAR: %v", err)
+			}
+			if !bytes.Equal(restored, orig) {
+				t.Errorf("Restore() didn't restore the original")
+			}
+			if _, err := os.Stat(tc.kept(p)); !os.IsNotExist(err) {
+				t.Errorf("Restore() left the original kept: %v", err)
+			}
+			if originals, err := tc.backup.Originals(dir); err != nil || len(originals) != 0 {
+				t.Errorf("Originals() after Restore() returned %v, %v, want none", originals, err)
+			}
+		})
+	}
+}
+
+func TestRestoreRemoved(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "vuln-class.jar")
+	cpFile(t, p+".bak", testdataPath("vuln-class.jar"))
+	b := &Backup{Suffix: ".bak"}
+	originals, err := b.Originals(dir)
+	if err != nil {
+		t.Fatalf("Originals() failed: %v", err)
+	}
+	if len(originals) != 1 {
+		t.Fatalf("Originals() returned %v, want 1 original", originals)
+	}
+	if err := originals[0].Restore(); err == nil {
+		t.Errorf("Restore() of a removed JAR succeeded, want error")
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("Restore() of a removed JAR brought it back")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+const (
+	// defaultMaxRatio is the default Config.MaxRatio. DEFLATE can't
+	// compress better than about 1:1032, and the classes and archives of
+	// JARs compress far worse than 1:100.
+	defaultMaxRatio = 100
+	// defaultMaxDecompressed is the default Config.MaxDecompressedBytes.
+	defaultMaxDecompressed = 16 * maxZipSize
+	// minBombSize is the uncompressed size entries must reach before their
+	// compression ratio is checked, since small entries of repeated bytes
+	// legitimately compress well.
+	minBombSize = 1 << 20
+)
+
+// ErrZipBomb is matched, with errors.Is, by the error of an archive that
+// looks crafted to exhaust the memory or disk of the scanner: one with an
+// entry that decompresses to more than Config.MaxRatio times its compressed
+// size, that holds more than its declared size, or that decompresses to
+// more than Config.MaxDecompressedBytes in total. Such archives are
+// suspicious in themselves, unlike archives that fail to scan.
+var ErrZipBomb = errors.New("suspected zip bomb")
+
+// zipBombError describes the entry that made an archive a suspected zip
+// bomb.
+type zipBombError struct {
+	path   string
+	reason string
+}
+
+func (e *zipBombError) Error() string {
+	return fmt.Sprintf("%v: %s %s", ErrZipBomb, e.path, e.reason)
+}
+
+func (e *zipBombError) Is(target error) bool {
+	return target == ErrZipBomb
+}
+
+// bombLimits configures the checks of a checker against zip bombs. Limits
+// that aren't positive are disabled.
+type bombLimits struct {
+	ratio int64
+	total int64
+	// inflated counts the bytes decompressed so far, against total.
+	inflated int64
+}
+
+// limits returns the configured bombLimits, applying the defaults.
+func (c *Config) limits() bombLimits {
+	l := bombLimits{ratio: defaultMaxRatio, total: defaultMaxDecompressed}
+	if c.MaxRatio != 0 {
+		l.ratio = int64(c.MaxRatio)
+	}
+	if c.MaxDecompressedBytes != 0 {
+		l.total = c.MaxDecompressedBytes
+	}
+	return l
+}
+
+// zipBomb records that the archive is a suspected zip bomb because of the
+// entry p, returning the error to fail its scan with.
+func (c *checker) zipBomb(p, reason string) error {
+	err := &zipBombError{path: c.nested + p, reason: reason}
+	if c.bomb == nil {
+		c.bomb = err
+	}
+	return err
+}
+
+// inflate returns a reader of the entry p of an archive, opened as r, that
+// fails with an error matching ErrZipBomb once the entry exceeds the limits.
+// Entries of ZIP archives whose declared sizes already exceed them fail
+// before being read.
+func (c *checker) inflate(p string, r io.Reader, info fs.FileInfo) (io.Reader, error) {
+	fh, ok := info.Sys().(*zip.FileHeader)
+	switch {
+	case !ok:
+		return c.limitRatio(p, r, -1, -1)
+	case fh.Method == zip.Store:
+		return c.limitRatio(p, r, int64(fh.UncompressedSize64), -1)
+	}
+	return c.limitRatio(p, r, int64(fh.UncompressedSize64), int64(fh.CompressedSize64))
+}
+
+// limitRatio implements inflate for an entry of the declared uncompressed
+// and compressed sizes, -1 if unknown.
+func (c *checker) limitRatio(p string, r io.Reader, declared, compressed int64) (io.Reader, error) {
+	br := &bombReader{c: c, p: p, r: r, declared: declared, limit: -1}
+	if compressed < 0 || c.limits.ratio <= 0 {
+		return br, nil
+	}
+	br.limit = compressed * c.limits.ratio
+	if br.limit < minBombSize {
+		br.limit = minBombSize
+	}
+	if declared > br.limit {
+		return nil, c.zipBomb(p, fmt.Sprintf("declares %d bytes compressed to %d", declared, compressed))
+	}
+	return br, nil
+}
+
+// bombReader counts the bytes read from an entry, see checker.inflate. limit
+// and declared are -1 if unknown.
+type bombReader struct {
+	c        *checker
+	p        string
+	r        io.Reader
+	read     int64
+	declared int64
+	limit    int64
+}
+
+func (b *bombReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+	l := &b.c.limits
+	l.inflated += int64(n)
+	switch {
+	case b.declared >= 0 && (b.read > b.declared || err == zip.ErrFormat):
+		// archive/zip fails entries holding more than declared with
+		// zip.ErrFormat.
+		return n, b.c.zipBomb(b.p, fmt.Sprintf("holds more than its declared %d bytes", b.declared))
+	case b.limit >= 0 && b.read > b.limit:
+		return n, b.c.zipBomb(b.p, fmt.Sprintf("decompresses to more than %d times its compressed size", l.ratio))
+	case l.total > 0 && l.inflated > l.total:
+		return n, b.c.zipBomb(b.p, fmt.Sprintf("takes the archive over %d decompressed bytes", l.total))
+	}
+	return n, err
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"log4jscanner/testjar"
+)
+
+// lyingZip returns an archive holding a class of content whose header
+// declares it's only size bytes.
+func lyingZip(t *testing.T, content string, size uint64) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatalf("creating compressor: %v", err)
+	}
+	if _, err := fw.Write([]byte(content)); err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("closing compressor: %v", err)
+	}
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "com/example/Lie.class",
+		Method:             zip.Deflate,
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: size,
+	})
+	if err != nil {
+		t.Fatalf("creating entry: %v", err)
+	}
+	if _, err := w.Write(compressed.Bytes()); err != nil {
+		t.Fatalf("writing entry: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestParseZipBomb(t *testing.T) {
+	zeros := strings.Repeat("\x00", 4<<20)
+	text := strings.Repeat("class", 1<<20/5)
+	tests := []struct {
+		name     string
+		data     []byte
+		cfg      *Config
+		wantBomb bool
+	}{
+		{
+			name:     "Class",
+			data:     testjar.Zip(t, zip.Deflate, testjar.File("com/example/Bomb.class", zeros)),
+			wantBomb: true,
+		},
+		{
+			name:     "NestedArchive",
+			data:     testjar.Zip(t, zip.Deflate, testjar.File("lib/bomb.jar", zeros)),
+			wantBomb: true,
+		},
+		{
+			name: "RatioDisabled",
+			data: testjar.Zip(t, zip.Deflate, testjar.File("com/example/Bomb.class", zeros)),
+			cfg:  &Config{MaxRatio: -1},
+		},
+		{
+			// Entries under 1MiB aren't checked, however well they
+			// compress.
+			name: "SmallEntry",
+			data: testjar.Zip(t, zip.Deflate, testjar.File("com/example/Small.class", zeros[:1<<19])),
+		},
+		{
+			name: "Stored",
+			data: testjar.Zip(t, zip.Store, testjar.File("com/example/Large.class", text)),
+		},
+		{
+			name:     "Total",
+			data:     testjar.Zip(t, zip.Store, testjar.File("com/example/Large.class", text)),
+			cfg:      &Config{MaxDecompressedBytes: 1 << 19},
+			wantBomb: true,
+		},
+		{
+			name:     "LyingSize",
+			data:     lyingZip(t, zeros, 1000),
+			wantBomb: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			zr, err := zip.NewReader(bytes.NewReader(tc.data), int64(len(tc.data)))
+			if err != nil {
+				t.Fatalf("zip.NewReader failed: %v", err)
+			}
+			_, err = tc.cfg.Parse(zr)
+			if got := errors.Is(err, ErrZipBomb); got != tc.wantBomb {
+				t.Errorf("Parse() returned error %v, want zip bomb %t", err, tc.wantBomb)
+			}
+			if err != nil && !tc.wantBomb {
+				t.Errorf("Parse() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseAnyZipBomb(t *testing.T) {
+	data := testjar.Gzip(t, []byte(strings.Repeat("\x00", 4<<20)))
+	fsys := fstest.MapFS{"bomb.tar.gz": &fstest.MapFile{Data: data}}
+	f, err := fsys.Open("bomb.tar.gz")
+	if err != nil {
+		t.Fatalf("opening file: %v", err)
+	}
+	defer f.Close()
+	if _, err := ParseAny("bomb.tar.gz", f); !errors.Is(err, ErrZipBomb) {
+		t.Errorf("ParseAny() returned error %v, want ErrZipBomb", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import "strings"
+
+// Log4j bridges and adapters route logging between the log4j 2 API, log4j
+// 1.x, and SLF4J. They aren't vulnerable themselves, but which one an
+// application bundles changes how it's remediated.
+const (
+	// BridgeLog4j12API routes log4j 1.x API calls to log4j 2.
+	BridgeLog4j12API = "log4j-1.2-api"
+	// BridgeToSLF4J routes log4j 2 API calls to SLF4J instead of
+	// log4j-core.
+	BridgeToSLF4J = "log4j-to-slf4j"
+	// BridgeSLF4JImpl and BridgeSLF4J2Impl bind SLF4J 1.x and 2.x to
+	// log4j 2.
+	BridgeSLF4JImpl  = "log4j-slf4j-impl"
+	BridgeSLF4J2Impl = "log4j-slf4j2-impl"
+)
+
+// bridgeOrder is the order bridges are reported in.
+var bridgeOrder = []string{BridgeLog4j12API, BridgeToSLF4J, BridgeSLF4JImpl, BridgeSLF4J2Impl}
+
+// bridgeClasses are classes only found in a single bridge, so the bridge
+// can be detected when it's shaded into another JAR without its Maven
+// metadata.
+var bridgeClasses = map[string]string{
+	"org/apache/log4j/config/Log4j1ConfigurationFactory.class": BridgeLog4j12API,
+	"org/apache/logging/slf4j/SLF4JLoggerContext.class":        BridgeToSLF4J,
+	"org/apache/logging/slf4j/SLF4JServiceProvider.class":      BridgeSLF4J2Impl,
+	// Log4jLoggerFactory is also part of log4j-slf4j2-impl, which is
+	// told apart by its SLF4JServiceProvider.
+	"org/apache/logging/slf4j/Log4jLoggerFactory.class": BridgeSLF4JImpl,
+}
+
+// bridgeAdvice is the remediation of applications bundling each bridge.
+var bridgeAdvice = map[string]string{
+	BridgeLog4j12API: "log4j 1.x API calls are routed to log4j-core, so upgrading log4j-core also covers them; keep the bridge at the same version as log4j-api",
+	BridgeToSLF4J:    "log4j 2 API calls are routed to SLF4J rather than log4j-core; if log4j-core is bundled anyway it's unused, and can be removed instead of upgraded",
+	BridgeSLF4JImpl:  "SLF4J calls are routed to log4j-core, so log4j-core must be upgraded even if the application only logs through SLF4J",
+	BridgeSLF4J2Impl: "SLF4J calls are routed to log4j-core, so log4j-core must be upgraded even if the application only logs through SLF4J",
+}
+
+// BridgeAdvice returns the remediation advice for applications bundling a
+// bridge, such as BridgeToSLF4J, or "" for unknown bridges.
+func BridgeAdvice(bridge string) string {
+	return bridgeAdvice[bridge]
+}
+
+// bridgeOf returns the bridge a file of a JAR belongs to, or "".
+func bridgeOf(p string) string {
+	const pomPrefix = "META-INF/maven/org.apache.logging.log4j/"
+	if strings.HasPrefix(p, pomPrefix) && strings.HasSuffix(p, "/pom.properties") {
+		artifact := strings.TrimSuffix(strings.TrimPrefix(p, pomPrefix), "/pom.properties")
+		if _, ok := bridgeAdvice[artifact]; ok {
+			return artifact
+		}
+		return ""
+	}
+	return bridgeClasses[p]
+}
+
+// bridge records a file of a bridge.
+func (c *checker) bridge(p, bridge string) {
+	if c.bridges == nil {
+		c.bridges = map[string]bool{}
+	}
+	byPOM, seen := c.bridges[bridge]
+	if !seen || c.explanation != nil {
+		c.evidence(p, -1, bridge+" bridge present")
+	}
+	c.bridges[bridge] = byPOM || strings.HasSuffix(p, "/pom.properties")
+}
+
+// bridgeList returns the detected bridges.
+func (c *checker) bridgeList() []string {
+	var bridges []string
+	for _, b := range bridgeOrder {
+		byPOM, ok := c.bridges[b]
+		if !ok {
+			continue
+		}
+		// log4j-slf4j2-impl also includes the classes of
+		// log4j-slf4j-impl, but not its Maven metadata.
+		if _, ok := c.bridges[BridgeSLF4J2Impl]; b == BridgeSLF4JImpl && ok && !byPOM {
+			continue
+		}
+		bridges = append(bridges, b)
+	}
+	return bridges
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBridges(t *testing.T) {
+	var nested bytes.Buffer
+	zw := zip.NewWriter(&nested)
+	if _, err := zw.Create("META-INF/maven/org.apache.logging.log4j/log4j-to-slf4j/pom.properties"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		files []string
+		data  map[string][]byte
+		want  []string
+	}{
+		{
+			name:  "none",
+			files: []string{"org/example/App.class", "META-INF/maven/org.apache.logging.log4j/log4j-core/pom.properties"},
+		},
+		{
+			name:  "maven metadata",
+			files: []string{"META-INF/maven/org.apache.logging.log4j/log4j-1.2-api/pom.properties"},
+			want:  []string{BridgeLog4j12API},
+		},
+		{
+			name:  "shaded classes",
+			files: []string{"org/apache/logging/slf4j/SLF4JLoggerContext.class", "org/apache/logging/slf4j/Log4jLoggerFactory.class"},
+			want:  []string{BridgeToSLF4J, BridgeSLF4JImpl},
+		},
+		{
+			name:  "slf4j2",
+			files: []string{"org/apache/logging/slf4j/Log4jLoggerFactory.class", "org/apache/logging/slf4j/SLF4JServiceProvider.class"},
+			want:  []string{BridgeSLF4J2Impl},
+		},
+		{
+			name: "slf4j and slf4j2 merged",
+			files: []string{
+				"META-INF/maven/org.apache.logging.log4j/log4j-slf4j-impl/pom.properties",
+				"org/apache/logging/slf4j/Log4jLoggerFactory.class",
+				"org/apache/logging/slf4j/SLF4JServiceProvider.class",
+			},
+			want: []string{BridgeSLF4JImpl, BridgeSLF4J2Impl},
+		},
+		{
+			name: "nested",
+			data: map[string][]byte{"WEB-INF/lib/log4j-to-slf4j-2.14.1.jar": nested.Bytes()},
+			want: []string{BridgeToSLF4J},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, f := range tc.files {
+				fsys[f] = &fstest.MapFile{}
+			}
+			for f, data := range tc.data {
+				fsys[f] = &fstest.MapFile{Data: data}
+			}
+			r, err := Parse(fsys)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, r.Bridges); diff != "" {
+				t.Errorf("Parse() returned unexpected bridges (-want, +got):\n%s", diff)
+			}
+			if r.Vulnerable {
+				t.Errorf("Parse() reported a bridge as vulnerable")
+			}
+		})
+	}
+}
+
+func TestBridgeAdvice(t *testing.T) {
+	for _, b := range bridgeOrder {
+		if BridgeAdvice(b) == "" {
+			t.Errorf("BridgeAdvice(%q) returned no advice", b)
+		}
+	}
+	if got := BridgeAdvice("log4j-core"); got != "" {
+		t.Errorf("BridgeAdvice(%q) = %q, want none", "log4j-core", got)
+	}
+}
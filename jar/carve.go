@@ -0,0 +1,247 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Carved is a JAR recovered by Carve from raw bytes, or the loose log4j
+// classes found outside of any archive.
+type Carved struct {
+	// Offset is where the JAR starts in the bytes carved, and Size the
+	// length of the entries recovered from it.
+	Offset int64
+	Size   int64
+	// Classes, set for loose classes, lists the offsets of the classes,
+	// keyed by their path, such as
+	// "org/apache/logging/log4j/core/lookup/JndiLookup.class". Offset is
+	// the lowest of them, and Size zero.
+	Classes map[string]int64
+	// Report is the report of the JAR or classes, or Err the error
+	// scanning them.
+	Report *Report
+	Err    error
+
+	// jar is the JAR recovered, see JAR.
+	jar *salvaged
+}
+
+// JAR returns the JAR recovered, its entries followed by a central directory
+// rebuilt for them, or nil for loose classes. It's read from the bytes
+// carved.
+func (c *Carved) JAR() *io.SectionReader {
+	if c.jar == nil {
+		return nil
+	}
+	return io.NewSectionReader(c.jar.ra, 0, c.jar.size)
+}
+
+// Signatures Carve finds archives and classes by, the signature of a ZIP
+// local file header and the magic number of a class file.
+var (
+	localHeaderMagic = []byte("PK\x03\x04")
+	classFileMagic   = []byte{0xca, 0xfe, 0xba, 0xbe}
+)
+
+// carveChunk is the size of the reads of Carve, and maxCarvedClass bounds
+// the size of the loose classes it reads.
+const (
+	carveChunk     = 1 << 20
+	maxCarvedClass = 1 << 20
+)
+
+// log4jPackage is the package of log4j's classes, which Carve checks when
+// found loose.
+const log4jPackage = "org/apache/logging/log4j/"
+
+// Carve finds JARs and log4j classes in raw bytes of the given size, such as
+// a disk image or a block device whose filesystem is damaged, without
+// reading any filesystem. It calls fn with each JAR recovered, in order,
+// then once with the loose log4j classes if any were found, stopping at the
+// first error fn returns.
+//
+// JARs are found by their local file headers, and their entries are read
+// until the first one that's cut short, such as by a fragmented file, like
+// with Config.Salvage. The entries following it are carved as a JAR of
+// their own. ZIP archives that aren't JARs, see IsJAR, are skipped. Loose
+// classes are found by their magic number, and the ones of log4j, by their
+// name or their contents, are scanned together like the classes of an
+// exploded archive.
+func Carve(ctx context.Context, ra io.ReaderAt, size int64, fn func(*Carved) error) error {
+	return defaultConfig.Carve(ctx, ra, size, fn)
+}
+
+// Carve is like the Carve function, only evaluating the rules enabled by the
+// configuration. Entry errors are recorded in the reports, as with
+// BestEffort.
+func (cfg *Config) Carve(ctx context.Context, ra io.ReaderAt, size int64, fn func(*Carved) error) error {
+	cv := &carver{cfg: cfg, ctx: ctx, ra: ra, size: size, fn: fn}
+	cv.loose = cfg.newChecker()
+	cv.loose.ctx = ctx
+	cv.loose.exploded = true
+	buf := make([]byte, carveChunk)
+	for pos := int64(0); pos < size; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := ra.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("reading at offset %d: %v", pos, err)
+		}
+		if n < len(localHeaderMagic) {
+			break
+		}
+		chunk := buf[:n]
+		next := pos + int64(n)
+		if next < size {
+			// A signature may straddle the chunks.
+			next -= int64(len(localHeaderMagic) - 1)
+		}
+		for i := 0; ; {
+			j := firstIndex(chunk[i:], localHeaderMagic, classFileMagic)
+			if j < 0 {
+				break
+			}
+			off := pos + int64(i+j)
+			var end int64
+			if bytes.HasPrefix(chunk[i+j:], localHeaderMagic) {
+				end, err = cv.carveJAR(off)
+			} else {
+				end, err = cv.carveClass(off)
+			}
+			if err != nil {
+				return err
+			}
+			if end >= next {
+				next = end
+				break
+			}
+			i = int(end - pos)
+		}
+		pos = next
+	}
+	if len(cv.classes) == 0 {
+		return nil
+	}
+	c := &Carved{Offset: -1, Classes: cv.classes}
+	for _, off := range cv.classes {
+		if c.Offset < 0 || off < c.Offset {
+			c.Offset = off
+		}
+	}
+	c.Report = cv.loose.report()
+	return fn(c)
+}
+
+// firstIndex returns the index of the first of the seps in b, or -1 if
+// there's none.
+func firstIndex(b []byte, seps ...[]byte) int {
+	first := -1
+	for _, sep := range seps {
+		if i := bytes.Index(b, sep); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	return first
+}
+
+// carver implements Carve.
+type carver struct {
+	cfg  *Config
+	ctx  context.Context
+	ra   io.ReaderAt
+	size int64
+	fn   func(*Carved) error
+	// loose checks the loose classes, whose offsets are in classes.
+	loose   checker
+	classes map[string]int64
+	// buf holds the class read by carveClass.
+	buf []byte
+}
+
+// carveJAR carves the JAR whose first local file header is at off, and
+// returns the offset to carve from next: past the JAR, or past the
+// signature if there's no JAR at off.
+func (cv *carver) carveJAR(off int64) (int64, error) {
+	n := cv.size - off
+	if n > math.MaxUint32 {
+		n = math.MaxUint32
+	}
+	sr := io.NewSectionReader(cv.ra, off, n)
+	records, lost, end := readLocal(sr, 0, n, nil)
+	s, err := appendCentral(sr, end, records, lost)
+	if err != nil || !IsJAR(s.zr) {
+		// Not an archive, or an archive of something other than
+		// JARs, whose entries are carved on their own.
+		return off + 1, nil
+	}
+	c := &Carved{Offset: off, Size: end, jar: s}
+	c.Report, c.Err = cv.cfg.parseCarved(cv.ctx, s)
+	if err := cv.fn(c); err != nil {
+		return 0, err
+	}
+	return off + end, nil
+}
+
+// parseCarved scans a JAR recovered by Carve.
+func (cfg *Config) parseCarved(ctx context.Context, s *salvaged) (*Report, error) {
+	c := cfg.newChecker()
+	c.salvaged = true
+	c.bestEffort = true
+	c.errors = append(c.errors, s.lost...)
+	return cfg.check(ctx, &c, s.zr, s.ra)
+}
+
+// carveClass checks the class whose magic number is at off if it's one of
+// log4j, and returns the offset to carve from next: past the class, or past
+// the magic number if there's no class at off.
+func (cv *carver) carveClass(off int64) (int64, error) {
+	if cv.buf == nil {
+		cv.buf = make([]byte, maxCarvedClass)
+	}
+	b := cv.buf
+	n, err := cv.ra.ReadAt(b, off)
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("reading at offset %d: %v", off, err)
+	}
+	b = b[:n]
+	cf, err := parseClassFile(b)
+	if err != nil {
+		return off + 1, nil
+	}
+	size, err := cf.size(b)
+	if err != nil {
+		return off + 1, nil
+	}
+	content := b[:size]
+	if !strings.HasPrefix(cf.name, log4jPackage) && (!mayIdentify(content) || identifyClass(cf) == "") {
+		return off + int64(size), nil
+	}
+	p := cf.name + ".class"
+	if cv.classes == nil {
+		cv.classes = map[string]int64{}
+	}
+	if _, ok := cv.classes[p]; !ok {
+		cv.classes[p] = off
+	}
+	cv.loose.checkClass(p, content)
+	return off + int64(size), nil
+}
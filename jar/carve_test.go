@@ -0,0 +1,140 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+func TestClassFileSize(t *testing.T) {
+	for name, content := range readClasses(t, "log4j-core-2.14.0.jar") {
+		cf, err := parseClassFile(content)
+		if err != nil {
+			t.Fatalf("parseClassFile(%s) failed: %v", name, err)
+		}
+		got, err := cf.size(append(content, "trailing data"...))
+		if err != nil || got != len(content) {
+			t.Errorf("size(%s) = %d, %v, want %d", name, got, err, len(content))
+		}
+		if _, err := cf.size(content[:len(content)-1]); err == nil {
+			t.Errorf("size(%s) of a truncated class succeeded", name)
+		}
+	}
+}
+
+// diskImage lays out files in raw bytes, separated by noise, like the
+// blocks of a damaged filesystem.
+type diskImage struct {
+	bytes.Buffer
+	rnd *rand.Rand
+}
+
+// add writes noise then data, returning the offset of data.
+func (d *diskImage) add(data []byte) int64 {
+	noise := make([]byte, 4096+d.rnd.Intn(4096))
+	d.rnd.Read(noise)
+	d.Write(noise)
+	off := int64(d.Len())
+	d.Write(data)
+	return off
+}
+
+func TestCarve(t *testing.T) {
+	vuln, err := os.ReadFile(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	safe, err := os.ReadFile(testdataPath("safe1.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	classes := readClasses(t, "log4j-core-2.14.0.jar")
+	lookup := classes["org/apache/logging/log4j/core/lookup/JndiLookup.class"]
+	manager := classes["org/apache/logging/log4j/core/net/JndiManager.class"]
+	notJAR := testjar.Zip(t, zip.Deflate, testjar.File("word/document.xml", "<document/>"))
+
+	d := &diskImage{rnd: rand.New(rand.NewSource(1))}
+	vulnOff := d.add(vuln)
+	safeOff := d.add(safe)
+	d.add(notJAR)
+	lookupOff := d.add(lookup)
+	managerOff := d.add(manager)
+	// A copy of the vulnerable JAR cut short, like a fragmented file.
+	fragOff := d.add(vuln[:len(vuln)/2])
+	d.add(nil)
+
+	type result struct {
+		Offset     int64
+		Vulnerable bool
+		Classes    map[string]int64
+	}
+	var got []result
+	data := d.Bytes()
+	err = Carve(context.Background(), bytes.NewReader(data), int64(len(data)), func(c *Carved) error {
+		if c.Err != nil {
+			t.Errorf("carving at %d failed: %v", c.Offset, c.Err)
+			return nil
+		}
+		got = append(got, result{c.Offset, c.Report.Vulnerable, c.Classes})
+		if c.Offset == vulnOff {
+			zr, err := zip.NewReader(c.JAR(), c.JAR().Size())
+			if err != nil {
+				t.Fatalf("reading recovered JAR: %v", err)
+			}
+			if len(zr.File) == 0 || !IsJAR(zr) {
+				t.Errorf("recovered JAR has %d entries", len(zr.File))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Carve() failed: %v", err)
+	}
+	want := []result{
+		{Offset: vulnOff, Vulnerable: true},
+		{Offset: safeOff},
+		// Half of the JAR holds JndiLookup, but not JndiManager.
+		{Offset: fragOff},
+		{
+			Offset:     lookupOff,
+			Vulnerable: true,
+			Classes: map[string]int64{
+				"org/apache/logging/log4j/core/lookup/JndiLookup.class": lookupOff,
+				"org/apache/logging/log4j/core/net/JndiManager.class":   managerOff,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Carve() returned diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCarveCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := make([]byte, 1024)
+	err := Carve(ctx, bytes.NewReader(data), int64(len(data)), func(*Carved) error { return nil })
+	if err != context.Canceled {
+		t.Errorf("Carve() returned error %v, want %v", err, context.Canceled)
+	}
+}
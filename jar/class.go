@@ -0,0 +1,132 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// ClassFinding is what a single class reveals to the heuristics of Parse,
+// see CheckClass.
+type ClassFinding struct {
+	// JndiLookup is set for log4j's JndiLookup class, which the log4j 2
+	// rules require alongside a JndiManager of a vulnerable version.
+	JndiLookup bool
+	// JndiManager is set for log4j's JndiManager class. OldConstructor,
+	// JndiEnabledCheck, and JndiJdbcCheck describe its version: the
+	// constructor taking a javax.naming.Context was removed in 2.15.0,
+	// the isJndiEnabled method added in 2.16.0, and the isJndiJdbcEnabled
+	// method added in 2.17.1.
+	JndiManager      bool
+	OldConstructor   bool
+	JndiEnabledCheck bool
+	JndiJdbcCheck    bool
+	// DataSourceConnectionSource is set for the JDBC appender's class,
+	// which RuleLog4j44832JDBC requires alongside a JndiManager without
+	// isJndiJdbcEnabled.
+	DataSourceConnectionSource bool
+	// Rules lists the IDs of the enabled rules matched by the class alone,
+	// such as the log4j 1.x rules or custom rules with a Matcher.
+	Rules []string
+	// SHA256 is the hex encoded SHA-256 of the class file.
+	SHA256 string
+}
+
+// CheckClass checks a single class file, such as one extracted from a heap
+// dump, with the default rules. name is its path, such as
+// "org/apache/logging/log4j/core/net/JndiManager.class", and content its
+// bytes. It reports false if the class isn't relevant to any rule.
+//
+// The log4j 2 rules match combinations of classes, so a single class can't
+// be vulnerable on its own. See ClassScanner to check the classes of an
+// application together.
+func CheckClass(name string, content []byte) (ClassFinding, bool) {
+	return defaultConfig.CheckClass(name, content)
+}
+
+// CheckClass is like the CheckClass function, only evaluating the rules
+// enabled by the configuration.
+func (cfg *Config) CheckClass(name string, content []byte) (ClassFinding, bool) {
+	c := cfg.newChecker()
+	c.checkClass(name, content)
+	f := ClassFinding{
+		JndiLookup:                 c.hasLookupClass,
+		JndiManager:                c.seenJndiManagerClass,
+		OldConstructor:             c.hasOldJndiManagerConstructor,
+		JndiEnabledCheck:           c.isAtLeastTwoDotSixteen,
+		DataSourceConnectionSource: strings.HasSuffix(name, "/DataSourceConnectionSource.class"),
+	}
+	if f.JndiManager {
+		// Only checked by the checker if RuleLog4j44832JDBC is enabled.
+		f.JndiJdbcCheck = bytes.Contains(content, log4j2171Detector)
+	}
+	for _, r := range Rules {
+		if c.matcherClasses[r.ID] != nil {
+			f.Rules = append(f.Rules, r.ID)
+		}
+	}
+	if !f.JndiLookup && !f.JndiManager && !f.OldConstructor && !f.DataSourceConnectionSource && len(f.Rules) == 0 {
+		return ClassFinding{}, false
+	}
+	sum := sha256.Sum256(content)
+	f.SHA256 = hex.EncodeToString(sum[:])
+	return f, true
+}
+
+// ClassScanner checks classes extracted by other tools, such as from a heap
+// dump or by a custom unpacker, with the heuristics of Parse, as if they
+// were the entries of one JAR. It isn't safe for concurrent use.
+type ClassScanner struct {
+	c     checker
+	start time.Time
+}
+
+// NewClassScanner returns a ClassScanner evaluating the default rules.
+func NewClassScanner() *ClassScanner {
+	return defaultConfig.NewClassScanner()
+}
+
+// NewClassScanner returns a ClassScanner evaluating the rules enabled by
+// the configuration.
+func (cfg *Config) NewClassScanner() *ClassScanner {
+	return &ClassScanner{c: cfg.newChecker(), start: time.Now()}
+}
+
+// Add checks a class file, named by its path like CheckClass. Classes of
+// nested archives may be named like Match paths, such as
+// "lib/log4j-core.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class",
+// so each copy of log4j is reported as an Artifact.
+func (s *ClassScanner) Add(name string, content []byte) {
+	if s.c.decided() {
+		return
+	}
+	s.c.nested = ""
+	if i := strings.LastIndex(name, "!"); i >= 0 {
+		s.c.nested, name = name[:i+1], name[i+1:]
+	}
+	s.c.stats.DecompressedBytes += int64(len(content))
+	s.c.checkClass(name, content)
+}
+
+// Report returns the report of the classes added so far.
+func (s *ClassScanner) Report() *Report {
+	r := s.c.report()
+	r.Stats.Duration = time.Since(s.start)
+	return r
+}
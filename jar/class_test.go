@@ -0,0 +1,148 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// readClasses returns the contents of the classes of a JAR, by path.
+func readClasses(t *testing.T, filename string) map[string][]byte {
+	t.Helper()
+	zr, err := zip.OpenReader(testdataPath(filename))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	classes := map[string][]byte{}
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".class") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		classes[f.Name] = b
+	}
+	return classes
+}
+
+func TestCheckClass(t *testing.T) {
+	const (
+		lookup  = "org/apache/logging/log4j/core/lookup/JndiLookup.class"
+		manager = "org/apache/logging/log4j/core/net/JndiManager.class"
+		closer  = "org/apache/logging/log4j/core/util/JndiCloser.class"
+	)
+	tests := []struct {
+		filename string
+		class    string
+		want     ClassFinding
+		wantOK   bool
+	}{
+		{"log4j-core-2.14.0.jar", lookup, ClassFinding{JndiLookup: true}, true},
+		{"log4j-core-2.14.0.jar", manager, ClassFinding{JndiManager: true, OldConstructor: true}, true},
+		{"log4j-core-2.16.0.jar", manager, ClassFinding{JndiManager: true, JndiEnabledCheck: true}, true},
+		{"log4j-core-2.14.0.jar", closer, ClassFinding{}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.filename+"/"+tc.class, func(t *testing.T) {
+			content := readClasses(t, tc.filename)[tc.class]
+			if content == nil {
+				t.Fatalf("%s has no class %s", tc.filename, tc.class)
+			}
+			got, ok := CheckClass(tc.class, content)
+			if ok != tc.wantOK {
+				t.Errorf("CheckClass() returned ok=%t, want %t", ok, tc.wantOK)
+			}
+			if ok && got.SHA256 == "" {
+				t.Errorf("CheckClass() returned no SHA-256")
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreFields(ClassFinding{}, "SHA256")); diff != "" {
+				t.Errorf("CheckClass() returned unexpected finding (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClassScanner(t *testing.T) {
+	for _, filename := range []string{
+		"arara.jar",
+		"arara.jar.patched",
+		"log4j-core-2.1.jar",
+		"log4j-core-2.12.1.jar",
+		"log4j-core-2.14.0.jar",
+		"log4j-core-2.14.0.jar.patched",
+		"log4j-core-2.15.0.jar",
+		"log4j-core-2.16.0.jar",
+		"safe1.jar",
+		"similarbutnotvuln.jar",
+		"vuln-class.jar",
+	} {
+		t.Run(filename, func(t *testing.T) {
+			zr, err := zip.OpenReader(testdataPath(filename))
+			if err != nil {
+				t.Fatalf("zip.OpenReader failed: %v", err)
+			}
+			defer zr.Close()
+			want, err := Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+
+			s := NewClassScanner()
+			for name, content := range readClasses(t, filename) {
+				s.Add(name, content)
+			}
+			got := s.Report()
+			if got.Vulnerable != want.Vulnerable {
+				t.Errorf("Report() returned vulnerable=%t, Parse() returned %t", got.Vulnerable, want.Vulnerable)
+			}
+			if diff := cmp.Diff(want.Rules, got.Rules); diff != "" {
+				t.Errorf("Report() returned unexpected rules (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClassScannerNested(t *testing.T) {
+	s := NewClassScanner()
+	for name, content := range readClasses(t, "log4j-core-2.14.0.jar") {
+		s.Add("WEB-INF/lib/log4j-core-2.14.0.jar!"+name, content)
+	}
+	r := s.Report()
+	if !r.Vulnerable {
+		t.Fatalf("Report() returned a safe report, want vulnerable")
+	}
+	for _, m := range r.Matches {
+		if !strings.HasPrefix(m.Path, "WEB-INF/lib/log4j-core-2.14.0.jar!org/apache/logging/log4j/") {
+			t.Errorf("Report() returned match %s, want within the nested JAR", m.Path)
+		}
+	}
+	if len(r.Artifacts) != 1 || r.Artifacts[0].Path != "WEB-INF/lib/log4j-core-2.14.0.jar" {
+		t.Errorf("Report() returned artifacts %+v, want the nested JAR", r.Artifacts)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// classMagic starts every class file.
+const classMagic = 0xcafebabe
+
+// errClassFormat is returned for malformed class files.
+var errClassFormat = errors.New("malformed class file")
+
+// classFile holds the names and string constants of a class file, read from
+// its constant pool, as described by chapter 4 of the JVM specification.
+type classFile struct {
+	// name, super, and interfaces are the internal names of the class, its
+	// superclass, and the interfaces it implements, such as
+	// "org/apache/logging/log4j/core/lookup/JndiLookup".
+	name       string
+	super      string
+	interfaces []string
+	// utf8 holds the UTF-8 constants of the class, which include the names
+	// of the classes it references and its string literals.
+	utf8 map[string]bool
+	// end is the offset past the interfaces, where the fields start.
+	end int
+}
+
+// parseClassFile reads the constant pool and names of a class file.
+func parseClassFile(b []byte) (*classFile, error) {
+	if len(b) < 10 || binary.BigEndian.Uint32(b) != classMagic {
+		return nil, errClassFormat
+	}
+	n := int(binary.BigEndian.Uint16(b[8:]))
+	off := 10
+	// utf8s and classes are indexed by constant pool index, which starts
+	// at 1.
+	utf8s := make([]string, n)
+	classes := make([]int, n)
+	for i := 1; i < n; i++ {
+		if off >= len(b) {
+			return nil, errClassFormat
+		}
+		tag := b[off]
+		off++
+		size := 0
+		switch tag {
+		case 1: // CONSTANT_Utf8
+			if off+2 > len(b) {
+				return nil, errClassFormat
+			}
+			l := int(binary.BigEndian.Uint16(b[off:]))
+			off += 2
+			if off+l > len(b) {
+				return nil, errClassFormat
+			}
+			utf8s[i] = string(b[off : off+l])
+			size = l
+		case 7: // CONSTANT_Class
+			if off+2 > len(b) {
+				return nil, errClassFormat
+			}
+			classes[i] = int(binary.BigEndian.Uint16(b[off:]))
+			size = 2
+		case 8, 16, 19, 20: // String, MethodType, Module, Package
+			size = 2
+		case 15: // MethodHandle
+			size = 3
+		case 3, 4, 9, 10, 11, 12, 17, 18: // Integer, Float, refs, NameAndType, Dynamic, InvokeDynamic
+			size = 4
+		case 5, 6: // Long, Double, which take two entries
+			size = 8
+			i++
+		default:
+			return nil, errClassFormat
+		}
+		off += size
+	}
+	if off+8 > len(b) {
+		return nil, errClassFormat
+	}
+	className := func(i int) string {
+		if i <= 0 || i >= n || classes[i] <= 0 || classes[i] >= n {
+			return ""
+		}
+		return utf8s[classes[i]]
+	}
+	cf := &classFile{
+		name:  className(int(binary.BigEndian.Uint16(b[off+2:]))),
+		super: className(int(binary.BigEndian.Uint16(b[off+4:]))),
+		utf8:  make(map[string]bool, n),
+	}
+	if cf.name == "" {
+		return nil, errClassFormat
+	}
+	count := int(binary.BigEndian.Uint16(b[off+6:]))
+	off += 8
+	if off+2*count > len(b) {
+		return nil, errClassFormat
+	}
+	for j := 0; j < count; j++ {
+		cf.interfaces = append(cf.interfaces, className(int(binary.BigEndian.Uint16(b[off+2*j:]))))
+	}
+	cf.end = off + 2*count
+	for _, s := range utf8s {
+		if s != "" {
+			cf.utf8[s] = true
+		}
+	}
+	return cf, nil
+}
+
+// size returns the length of the class file b, whose constant pool and names
+// cf was read from, by skipping its fields, methods, and attributes. b may
+// continue past the class file.
+func (cf *classFile) size(b []byte) (int, error) {
+	off := cf.end
+	// skipAttributes skips the attributes at off, following their count.
+	skipAttributes := func() bool {
+		if off+2 > len(b) {
+			return false
+		}
+		n := int(binary.BigEndian.Uint16(b[off:]))
+		off += 2
+		for i := 0; i < n; i++ {
+			if off+6 > len(b) {
+				return false
+			}
+			l := int64(binary.BigEndian.Uint32(b[off+2:]))
+			if int64(off)+6+l > int64(len(b)) {
+				return false
+			}
+			off += 6 + int(l)
+		}
+		return true
+	}
+	// Fields and methods are a count of members, each of an access flags,
+	// name, and descriptor, followed by attributes.
+	for members := 0; members < 2; members++ {
+		if off+2 > len(b) {
+			return 0, errClassFormat
+		}
+		n := int(binary.BigEndian.Uint16(b[off:]))
+		off += 2
+		for i := 0; i < n; i++ {
+			off += 6
+			if !skipAttributes() {
+				return 0, errClassFormat
+			}
+		}
+	}
+	if !skipAttributes() {
+		return 0, errClassFormat
+	}
+	return off, nil
+}
+
+// simpleName returns the name of a class without its package.
+func simpleName(internal string) string {
+	return internal[strings.LastIndex(internal, "/")+1:]
+}
+
+// referencesClass reports whether the class references a class of the given
+// simple name, in any package.
+func (cf *classFile) referencesClass(simple string) bool {
+	for s := range cf.utf8 {
+		if strings.HasSuffix(s, "/"+simple) || strings.Contains(s, "/"+simple+";") {
+			return true
+		}
+	}
+	return false
+}
+
+// referencesPackage reports whether the class references a class of the
+// package with the given internal name, such as "javax/naming/".
+func (cf *classFile) referencesPackage(pkg string) bool {
+	for s := range cf.utf8 {
+		if strings.HasPrefix(s, pkg) || strings.Contains(s, "L"+pkg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// containerExts are the extensions of the containers, other than ZIP
+// archives, that the checker descends into: tar archives, optionally
+// compressed, Debian packages, which are ar archives of tar archives, and RPM
+// packages, whose payload is a compressed cpio archive. Compressed files are
+// named by their compression, such as data.tar.xz, and found by their
+// contents.
+var containerExts = map[string]bool{
+	".tar":  true,
+	".tgz":  true,
+	".tbz2": true,
+	".gz":   true,
+	".bz2":  true,
+	".xz":   true,
+	".zst":  true,
+	".deb":  true,
+	".rpm":  true,
+}
+
+// hasNestedExt reports if a file within an archive has an extension the
+// checker descends into, that of a JAR or of a container.
+func hasNestedExt(name string) bool {
+	ext := path.Ext(name)
+	return exts[ext] || containerExts[ext]
+}
+
+// Magic numbers of the formats of containers.
+var (
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	arMagic    = []byte("!<arch>\n")
+	rpmMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	// cpio archives of the "new" portable format, as in RPM packages,
+	// without and with checksums.
+	cpioMagic    = []byte("070701")
+	cpioCRCMagic = []byte("070702")
+)
+
+// errUnsupportedCompression is returned for containers compressed with a
+// method the checker can't decompress, such as the data.tar.xz of most
+// Debian packages.
+var errUnsupportedCompression = errors.New("unsupported compression, only gzip and bzip2 are supported")
+
+// archive iterates over the regular files of a container.
+type archive interface {
+	// Next advances to the next regular file, returning its name and
+	// size, or io.EOF at the end of the container.
+	Next() (name string, size int64, err error)
+	// Read reads the current file.
+	Read(b []byte) (int, error)
+}
+
+// checkArchive checks the files of the container a that the checker
+// descends into, see hasNestedExt, at the given depth of nesting, where held
+// is the memory held by the container and its parents. Other files are
+// ignored.
+func (c *checker) checkArchive(a archive, depth int, held int64) error {
+	if depth > 0 {
+		c.stats.NestedArchives++
+	}
+	if depth > c.stats.MaxDepth {
+		c.stats.MaxDepth = depth
+	}
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		if c.done() {
+			c.skipped = true
+			return nil
+		}
+		name, size, err := a.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %v", err)
+		}
+		if !hasNestedExt(name) {
+			continue
+		}
+		if depth+1 > maxZipDepth {
+			if err := c.entryError(name, ErrTooDeep, fmt.Errorf("reached max zip depth of %d", maxZipDepth)); err != nil {
+				return err
+			}
+			continue
+		}
+		ra, n, release, err := c.buffer(a, size)
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", name, err)
+		}
+		c.stats.DecompressedBytes += n
+		mem := held
+		if _, ok := ra.(*bytes.Reader); ok {
+			mem += n
+		}
+		nested := c.nested
+		c.nested += name + "!"
+		err = c.checkAny(ra, n, depth+1, mem, false)
+		c.nested = nested
+		release()
+		switch {
+		case err == errUnsupportedCompression:
+			if err := c.entryError(name, ErrCorruptEntry, err); err != nil {
+				return err
+			}
+		case err != nil && err != ErrUnknownFormat:
+			return fmt.Errorf("checking %s: %v", name, err)
+		}
+	}
+}
+
+// tarArchive is the archive of a tar archive.
+type tarArchive struct {
+	tr *tar.Reader
+}
+
+func (a tarArchive) Next() (string, int64, error) {
+	for {
+		hdr, err := a.tr.Next()
+		if err != nil {
+			return "", 0, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return hdr.Name, hdr.Size, nil
+		}
+	}
+}
+
+func (a tarArchive) Read(b []byte) (int, error) {
+	return a.tr.Read(b)
+}
+
+// Sizes of the headers of ar and cpio archives, and the longest name of
+// their files read.
+const (
+	arHeaderLen   = 60
+	cpioHeaderLen = 110
+	maxMemberName = 4096
+)
+
+// arArchive is the archive of an ar archive, such as a Debian package, with
+// the names of its files as written by GNU or BSD ar. Files with longer
+// names, listed in a table by GNU ar, are skipped.
+type arArchive struct {
+	r io.Reader
+	// cur is the rest of the current file, followed by pad bytes.
+	cur io.LimitedReader
+	pad int64
+}
+
+// newArArchive returns the archive of the ar archive r, starting with its
+// magic number.
+func newArArchive(r io.Reader) (*arArchive, error) {
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, arMagic) {
+		return nil, errors.New("invalid ar magic number")
+	}
+	return &arArchive{r: r, cur: io.LimitedReader{R: r}}, nil
+}
+
+func (a *arArchive) Next() (string, int64, error) {
+	for {
+		if _, err := io.CopyN(io.Discard, a.r, a.cur.N+a.pad); err != nil {
+			return "", 0, unexpectedEOF(err)
+		}
+		var h [arHeaderLen]byte
+		if _, err := io.ReadFull(a.r, h[:]); err != nil {
+			return "", 0, err
+		}
+		if string(h[58:60]) != "`\n" {
+			return "", 0, errors.New("invalid ar file header")
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(h[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return "", 0, fmt.Errorf("invalid ar file size %q", h[48:58])
+		}
+		a.cur = io.LimitedReader{R: a.r, N: size}
+		a.pad = size % 2
+		name := strings.TrimRight(string(h[:16]), " ")
+		switch {
+		case strings.HasPrefix(name, "#1/"):
+			// BSD ar writes long names after the header.
+			n, err := strconv.ParseInt(name[3:], 10, 64)
+			if err != nil || n < 0 || n > size || n > maxMemberName {
+				return "", 0, fmt.Errorf("invalid ar file name length %q", name[3:])
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(&a.cur, b); err != nil {
+				return "", 0, unexpectedEOF(err)
+			}
+			name = string(bytes.TrimRight(b, "\x00"))
+		case strings.HasPrefix(name, "/"):
+			// The symbol table, or GNU ar's table of long names.
+			continue
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+		return name, a.cur.N, nil
+	}
+}
+
+func (a *arArchive) Read(b []byte) (int, error) {
+	return a.cur.Read(b)
+}
+
+// cpioArchive is the archive of a cpio archive of the "new" portable format,
+// such as the payload of an RPM package. Files are named without their
+// leading "./".
+type cpioArchive struct {
+	r *countReader
+	// cur is the rest of the current file.
+	cur io.LimitedReader
+}
+
+func newCPIOArchive(r io.Reader) *cpioArchive {
+	cr := &countReader{r: r}
+	return &cpioArchive{r: cr, cur: io.LimitedReader{R: cr}}
+}
+
+func (a *cpioArchive) Next() (string, int64, error) {
+	for {
+		if _, err := io.Copy(io.Discard, &a.cur); err != nil {
+			return "", 0, err
+		}
+		if err := a.align(); err != nil {
+			return "", 0, err
+		}
+		var h [cpioHeaderLen]byte
+		if _, err := io.ReadFull(a.r, h[:]); err != nil {
+			return "", 0, err
+		}
+		if !bytes.HasPrefix(h[:], cpioMagic) && !bytes.HasPrefix(h[:], cpioCRCMagic) {
+			return "", 0, errors.New("invalid cpio file header")
+		}
+		var fields [13]int64
+		for i := range fields {
+			v, err := strconv.ParseUint(string(h[6+8*i:14+8*i]), 16, 32)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid cpio file header field %q", h[6+8*i:14+8*i])
+			}
+			fields[i] = int64(v)
+		}
+		mode, size, nameSize := fields[1], fields[6], fields[11]
+		if nameSize > maxMemberName {
+			return "", 0, fmt.Errorf("cpio file name of %d bytes too long", nameSize)
+		}
+		b := make([]byte, nameSize)
+		if _, err := io.ReadFull(a.r, b); err != nil {
+			return "", 0, unexpectedEOF(err)
+		}
+		if err := a.align(); err != nil {
+			return "", 0, err
+		}
+		name := string(bytes.TrimRight(b, "\x00"))
+		if name == "TRAILER!!!" {
+			return "", 0, io.EOF
+		}
+		a.cur = io.LimitedReader{R: a.r, N: size}
+		// Only the last of hard links to a file holds its data.
+		if mode&0170000 != 0100000 || size == 0 {
+			continue
+		}
+		return strings.TrimPrefix(name, "./"), size, nil
+	}
+}
+
+// align skips the padding aligning headers and data to 4 bytes.
+func (a *cpioArchive) align() error {
+	if pad := (4 - a.r.n%4) % 4; pad > 0 {
+		if _, err := io.CopyN(io.Discard, a.r, pad); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	return nil
+}
+
+func (a *cpioArchive) Read(b []byte) (int, error) {
+	return a.cur.Read(b)
+}
+
+// countReader counts the bytes read from r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	return n, err
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF for an archive ending within a
+// file, rather than io.EOF, which ends iterating over the archive.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Length of the lead of RPM packages, and magic number of their headers.
+const rpmLeadLen = 96
+
+var rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+
+// rpmPayload returns the offset of the payload of the RPM package ra of the
+// given size, which follows its lead, its signature, and its header.
+func rpmPayload(ra io.ReaderAt, size int64) (int64, error) {
+	off := int64(rpmLeadLen)
+	for _, what := range []string{"signature", "header"} {
+		var h [16]byte
+		if _, err := ra.ReadAt(h[:], off); err != nil {
+			return 0, fmt.Errorf("reading RPM %s: %v", what, err)
+		}
+		if !bytes.Equal(h[:4], rpmHeaderMagic) {
+			return 0, fmt.Errorf("invalid RPM %s", what)
+		}
+		entries := int64(binary.BigEndian.Uint32(h[8:12]))
+		data := int64(binary.BigEndian.Uint32(h[12:16]))
+		off += int64(len(h)) + 16*entries + data
+		if what == "signature" {
+			// The signature is padded to 8 bytes.
+			off = (off + 7) &^ 7
+		}
+	}
+	if off > size {
+		return 0, errors.New("RPM payload past end of file")
+	}
+	return off, nil
+}
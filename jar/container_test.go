@@ -0,0 +1,276 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+// arFiles returns an ar archive of the given files, with their names as
+// written by BSD ar if bsd is set, otherwise by GNU ar.
+func arFiles(bsd bool, files ...testjar.Entry) []byte {
+	b := bytes.NewBufferString("!<arch>\n")
+	// GNU ar starts with a symbol table, skipped by the checker.
+	fmt.Fprintf(b, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", "/", 0, 0, 0, 0644, 0)
+	for _, f := range files {
+		name, data := f.Name+"/", f.Contents
+		if bsd {
+			name = fmt.Sprintf("#1/%d", len(f.Name))
+			data = f.Name + data
+		}
+		fmt.Fprintf(b, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 0, 0, 0, 0100644, len(data))
+		b.WriteString(data)
+		if len(data)%2 == 1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+// debOf returns a Debian package whose data.tar.gz holds the given files.
+func debOf(t *testing.T, bsd bool, files ...testjar.Entry) []byte {
+	t.Helper()
+	control := testjar.Gzip(t, testjar.Tar(t, testjar.File("control", "Package: app\n")))
+	data := testjar.Gzip(t, testjar.Tar(t, files...))
+	return arFiles(bsd,
+		testjar.File("debian-binary", "2.0\n"),
+		testjar.File("control.tar.gz", string(control)),
+		testjar.File("data.tar.gz", string(data)),
+	)
+}
+
+// cpioFiles returns a cpio archive of the "new" portable format of the given
+// files, preceded by their directory like in RPM packages.
+func cpioFiles(files ...testjar.Entry) []byte {
+	var b bytes.Buffer
+	pad := func() {
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+	write := func(name string, mode int, data string) {
+		fmt.Fprintf(&b, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			1, mode, 0, 0, 1, 0, len(data), 0, 0, 0, 0, len(name)+1, 0)
+		b.WriteString(name + "\x00")
+		pad()
+		b.WriteString(data)
+		pad()
+	}
+	write("./opt/app", 040755, "")
+	for _, f := range files {
+		write("./"+f.Name, 0100644, f.Contents)
+	}
+	write("TRAILER!!!", 0, "")
+	return b.Bytes()
+}
+
+// rpmOf returns an RPM package whose gzip compressed payload holds the given
+// files.
+func rpmOf(t *testing.T, files ...testjar.Entry) []byte {
+	t.Helper()
+	b := bytes.NewBuffer(append([]byte{0xed, 0xab, 0xee, 0xdb}, make([]byte, rpmLeadLen-4)...))
+	header := func(entries, data int) {
+		b.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+		binary.Write(b, binary.BigEndian, uint32(entries))
+		binary.Write(b, binary.BigEndian, uint32(data))
+		b.Write(make([]byte, 16*entries+data))
+	}
+	// The signature is padded to 8 bytes, unlike the header.
+	header(1, 5)
+	b.Write(make([]byte, 3))
+	header(2, 3)
+	b.Write(testjar.Gzip(t, cpioFiles(files...)))
+	return b.Bytes()
+}
+
+func TestParseContainers(t *testing.T) {
+	vuln, err := os.ReadFile(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	safe, err := os.ReadFile(testdataPath("safe1.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	vulnFile := testjar.File("opt/app/lib/log4j-core.jar", string(vuln))
+	safeFile := testjar.File("opt/app/lib/safe.jar", string(safe))
+	layer := testjar.Tar(t, testjar.File("etc/hostname", "app\n"), vulnFile)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     bool
+		wantPath string
+	}{
+		{
+			name:     "app.deb",
+			data:     debOf(t, false, safeFile, vulnFile),
+			want:     true,
+			wantPath: "data.tar.gz!opt/app/lib/log4j-core.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class",
+		},
+		{
+			name:     "bsd.deb",
+			data:     debOf(t, true, vulnFile),
+			want:     true,
+			wantPath: "data.tar.gz!opt/app/lib/log4j-core.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class",
+		},
+		{name: "safe.deb", data: debOf(t, false, safeFile)},
+		{
+			name:     "app.rpm",
+			data:     rpmOf(t, safeFile, vulnFile),
+			want:     true,
+			wantPath: "opt/app/lib/log4j-core.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class",
+		},
+		{name: "safe.rpm", data: rpmOf(t, safeFile)},
+		{
+			name: "image.tar",
+			data: testjar.Tar(t,
+				testjar.File("manifest.json", "[]"),
+				testjar.File("0123abcd/layer.tar", string(layer)),
+			),
+			want:     true,
+			wantPath: "0123abcd/layer.tar!opt/app/lib/log4j-core.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class",
+		},
+		{
+			name: "app.jar",
+			data: testjar.Zip(t, zip.Store,
+				testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"),
+				testjar.File("dist/app.tar.gz", string(testjar.Gzip(t, testjar.Tar(t, vulnFile)))),
+			),
+			want:     true,
+			wantPath: "dist/app.tar.gz!opt/app/lib/log4j-core.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class",
+		},
+	}
+	for _, tc := range tests {
+		fsys := fstest.MapFS{tc.name: &fstest.MapFile{Data: tc.data}}
+		f, err := fsys.Open(tc.name)
+		if err != nil {
+			t.Fatalf("opening %s: %v", tc.name, err)
+		}
+		r, err := ParseAny(tc.name, f)
+		f.Close()
+		if err != nil {
+			t.Errorf("ParseAny(%s) failed: %v", tc.name, err)
+			continue
+		}
+		if r.Vulnerable != tc.want {
+			t.Errorf("ParseAny(%s) returned vulnerable %v, want %v", tc.name, r.Vulnerable, tc.want)
+		}
+		if !tc.want {
+			continue
+		}
+		var paths []string
+		found := false
+		for _, e := range r.Matches {
+			paths = append(paths, e.Path)
+			found = found || e.Path == tc.wantPath
+		}
+		if !found {
+			t.Errorf("ParseAny(%s) returned matches of %q, want %s", tc.name, paths, tc.wantPath)
+		}
+	}
+}
+
+func TestParseContainerErrors(t *testing.T) {
+	xzData := append([]byte{0xfd, '7', 'z', 'X', 'Z', 0}, "compressed"...)
+	deep := testjar.Tar(t, testjar.File("a.jar", string(deepJAR(t, 0))))
+	for i := 0; i < maxZipDepth; i++ {
+		deep = testjar.Tar(t, testjar.File("a.tar", string(deep)))
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantKind error
+		wantPath string
+	}{
+		{
+			name: "xz.deb",
+			data: arFiles(false,
+				testjar.File("debian-binary", "2.0\n"),
+				testjar.File("data.tar.xz", string(xzData)),
+			),
+			wantKind: ErrCorruptEntry,
+			wantPath: "data.tar.xz",
+		},
+		{
+			name:     "deep.tar",
+			data:     deep,
+			wantKind: ErrTooDeep,
+			wantPath: strings.Repeat("a.tar!", maxZipDepth) + "a.jar",
+		},
+	}
+	for _, tc := range tests {
+		fsys := fstest.MapFS{tc.name: &fstest.MapFile{Data: tc.data}}
+		for _, cfg := range []*Config{{}, {BestEffort: true}} {
+			f, err := fsys.Open(tc.name)
+			if err != nil {
+				t.Fatalf("opening %s: %v", tc.name, err)
+			}
+			r, err := cfg.ParseAny(tc.name, f)
+			f.Close()
+			if !cfg.BestEffort {
+				var ee *EntryError
+				if !errors.Is(err, tc.wantKind) || !errors.As(err, &ee) || ee.Path != tc.wantPath {
+					t.Errorf("ParseAny(%s) returned error %v, want %v of %s", tc.name, err, tc.wantKind, tc.wantPath)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("ParseAny(%s) in best-effort mode failed: %v", tc.name, err)
+				continue
+			}
+			if len(r.Errors) != 1 || r.Errors[0].Path != tc.wantPath || r.Errors[0].Kind != tc.wantKind {
+				t.Errorf("ParseAny(%s) in best-effort mode returned errors %v, want one %v of %s", tc.name, r.Errors, tc.wantKind, tc.wantPath)
+			}
+		}
+	}
+}
+
+func TestCPIOArchive(t *testing.T) {
+	data := cpioFiles(testjar.File("a.jar", "abc"), testjar.File("lib/b.jar", "defgh"))
+	a := newCPIOArchive(bytes.NewReader(data))
+	var got [][2]string
+	for {
+		name, size, err := a.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(a, b); err != nil {
+			t.Fatalf("Read() failed: %v", err)
+		}
+		got = append(got, [2]string{name, string(b)})
+	}
+	want := [][2]string{{"a.jar", "abc"}, {"lib/b.jar", "defgh"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("cpio archive returned files diff (-want, +got):\n%s", diff)
+	}
+}
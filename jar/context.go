@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// TimeoutError is returned for an archive whose scan took longer than
+// Config.Timeout, such as a pathological archive of deeply nested or highly
+// compressed entries. Unlike a cancelled scan, the rest of a walk goes on.
+type TimeoutError struct {
+	// Timeout is the configured Config.Timeout.
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("scan exceeded timeout of %v", e.Timeout)
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// timeout returns the context of one archive's scan, bounded by Timeout.
+func (c *Config) timeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c == nil || c.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+// contextError returns the error of a scan that failed with ctx, the
+// context returned by timeout for parent, done: a *TimeoutError if the
+// archive's own deadline passed, or the error of parent. It returns nil if
+// ctx isn't done, so the scan failed for another reason.
+func (c *Config) contextError(parent, ctx context.Context) error {
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	if ctx.Err() == context.DeadlineExceeded && c != nil && c.Timeout > 0 {
+		return &TimeoutError{Timeout: c.Timeout}
+	}
+	return ctx.Err()
+}
+
+// ctxReader is an io.Reader that fails once its context is done, so reading
+// a large nested archive stops when its scan is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
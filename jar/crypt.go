@@ -0,0 +1,424 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+)
+
+// Encrypted archives are supported using traditional PKWARE encryption
+// (ZipCrypto) or WinZip AES, as described by APPNOTE.TXT and
+// https://www.winzip.com/en/support/aes-encryption/.
+
+const (
+	// flagEncrypted is the general purpose bit flag of encrypted entries.
+	flagEncrypted = 0x1
+	// flagDataDescriptor is set if the CRC-32 follows the entry's data, in
+	// which case ZipCrypto headers are checked against the modified time.
+	flagDataDescriptor = 0x8
+	// methodAES is the compression method of WinZip AES entries. The actual
+	// method is stored in the AES extra field.
+	methodAES = 99
+	// aesExtraID identifies the WinZip AES extra field.
+	aesExtraID = 0x9901
+	// aesIterations is the PBKDF2 iteration count of WinZip AES.
+	aesIterations = 1000
+	// aesAuthLen is the length of the HMAC-SHA1 authentication code.
+	aesAuthLen = 10
+	// zipCryptoHeaderLen is the length of the ZipCrypto encryption header.
+	zipCryptoHeaderLen = 12
+)
+
+// errBadPassword is returned if none of the passwords decrypt an entry.
+var errBadPassword = errors.New("no matching password")
+
+// openEncrypted decrypts and decompresses an encrypted entry, trying each
+// password in turn. ZipCrypto headers only check one byte, so about one in
+// 256 wrong passwords pass them: while other passwords remain, the entry is
+// decrypted in full, buffered as configured by spill, to confirm its CRC-32
+// before the password is trusted.
+func openEncrypted(f *zip.File, passwords []string, spill spillConfig) (io.ReadCloser, error) {
+	if len(passwords) == 0 {
+		return nil, fmt.Errorf("entry is encrypted and no passwords were provided")
+	}
+	method := f.Method
+	var aesInfo *aesExtra
+	if method == methodAES {
+		var err error
+		if aesInfo, err = parseAESExtra(f.Extra); err != nil {
+			return nil, err
+		}
+		method = aesInfo.method
+	}
+	// confirmErr is the error of the last password whose CRC-32 didn't
+	// match, reported if no other password does.
+	var confirmErr error
+	for i, pw := range passwords {
+		raw, err := f.OpenRaw()
+		if err != nil {
+			return nil, err
+		}
+		var r io.Reader
+		if aesInfo != nil {
+			r, err = aesInfo.decrypt(raw, int64(f.CompressedSize64), []byte(pw))
+		} else {
+			r, err = zipCryptoDecrypt(raw, int64(f.CompressedSize64), []byte(pw), zipCryptoCheck(&f.FileHeader))
+		}
+		if err == errBadPassword {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decrypting: %v", err)
+		}
+		rc, err := decompress(r, method)
+		if err != nil {
+			return nil, err
+		}
+		if aesInfo != nil {
+			// Decompressors stop at the end of their stream, read any
+			// remaining data so the authentication code is checked.
+			rc = &drainReader{ReadCloser: rc, src: r}
+			// AE-2 entries don't store a CRC-32, the HMAC
+			// authenticates them.
+			if aesInfo.version == 2 {
+				return rc, nil
+			}
+		}
+		rc = &checksumReader{rc: rc, want: f.CRC32, hash: crc32.NewIEEE()}
+		if aesInfo == nil && i < len(passwords)-1 {
+			buf, err := spill.buffer(rc, f.UncompressedSize64)
+			if err != nil {
+				confirmErr = err
+				continue
+			}
+			return buf, nil
+		}
+		return rc, nil
+	}
+	if confirmErr != nil {
+		return nil, fmt.Errorf("decrypting: %v", confirmErr)
+	}
+	return nil, fmt.Errorf("decrypting: %v", errBadPassword)
+}
+
+func decompress(r io.Reader, method uint16) (io.ReadCloser, error) {
+	switch method {
+	case zip.Store:
+		return io.NopCloser(r), nil
+	case zip.Deflate:
+		return flate.NewReader(r), nil
+	}
+	return nil, zip.ErrAlgorithm
+}
+
+// drainReader reads src to its end once the ReadCloser returns io.EOF.
+type drainReader struct {
+	io.ReadCloser
+	src io.Reader
+}
+
+func (d *drainReader) Read(b []byte) (int, error) {
+	n, err := d.ReadCloser.Read(b)
+	if err == io.EOF {
+		if _, derr := io.Copy(io.Discard, d.src); derr != nil {
+			return n, derr
+		}
+	}
+	return n, err
+}
+
+// checksumReader verifies the CRC-32 of an entry once it's fully read.
+type checksumReader struct {
+	rc   io.ReadCloser
+	want uint32
+	hash hash.Hash32
+}
+
+func (c *checksumReader) Read(b []byte) (int, error) {
+	n, err := c.rc.Read(b)
+	c.hash.Write(b[:n])
+	if err == io.EOF && c.hash.Sum32() != c.want {
+		return n, zip.ErrChecksum
+	}
+	return n, err
+}
+
+func (c *checksumReader) Close() error {
+	return c.rc.Close()
+}
+
+// zipCryptoCheck returns the byte the last byte of a ZipCrypto header is
+// checked against.
+func zipCryptoCheck(fh *zip.FileHeader) byte {
+	if fh.Flags&flagDataDescriptor != 0 {
+		return byte(fh.ModifiedTime >> 8)
+	}
+	return byte(fh.CRC32 >> 24)
+}
+
+// zipCryptoKeys is the state of traditional PKWARE encryption.
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password []byte) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for _, b := range password {
+		k.update(b)
+	}
+	return k
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) stream() byte {
+	t := k[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+func (k *zipCryptoKeys) decrypt(b []byte) {
+	for i := range b {
+		b[i] ^= k.stream()
+		k.update(b[i])
+	}
+}
+
+// zipCryptoDecrypt returns the plaintext of a ZipCrypto entry of size bytes,
+// including its header. Only one byte of the header is checked, so about one
+// in 256 wrong passwords isn't detected until the CRC-32 is checked.
+func zipCryptoDecrypt(r io.Reader, size int64, password []byte, check byte) (io.Reader, error) {
+	if size < zipCryptoHeaderLen {
+		return nil, fmt.Errorf("entry too short for encryption header")
+	}
+	k := newZipCryptoKeys(password)
+	header := make([]byte, zipCryptoHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("reading encryption header: %v", err)
+	}
+	k.decrypt(header)
+	if header[zipCryptoHeaderLen-1] != check {
+		return nil, errBadPassword
+	}
+	return &zipCryptoReader{r: io.LimitReader(r, size-zipCryptoHeaderLen), keys: k}, nil
+}
+
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func (z *zipCryptoReader) Read(b []byte) (int, error) {
+	n, err := z.r.Read(b)
+	z.keys.decrypt(b[:n])
+	return n, err
+}
+
+// aesExtra is the WinZip AES extra field.
+type aesExtra struct {
+	version  uint16 // 1 for AE-1, 2 for AE-2.
+	keyLen   int
+	method   uint16
+	saltSize int
+}
+
+func parseAESExtra(extra []byte) (*aesExtra, error) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id != aesExtraID {
+			extra = extra[size:]
+			continue
+		}
+		b := extra[:size]
+		if size < 7 || b[2] != 'A' || b[3] != 'E' {
+			return nil, fmt.Errorf("invalid AES extra field")
+		}
+		a := &aesExtra{
+			version: binary.LittleEndian.Uint16(b),
+			method:  binary.LittleEndian.Uint16(b[5:]),
+		}
+		switch b[4] {
+		case 1:
+			a.keyLen = 16
+		case 2:
+			a.keyLen = 24
+		case 3:
+			a.keyLen = 32
+		default:
+			return nil, fmt.Errorf("invalid AES strength %d", b[4])
+		}
+		a.saltSize = a.keyLen / 2
+		return a, nil
+	}
+	return nil, fmt.Errorf("missing AES extra field")
+}
+
+// aesKeys derives the encryption key, authentication key, and password
+// verifier from a password.
+func (a *aesExtra) keys(password, salt []byte) (encKey, authKey, verifier []byte) {
+	dk := pbkdf2SHA1(password, salt, aesIterations, 2*a.keyLen+2)
+	return dk[:a.keyLen], dk[a.keyLen : 2*a.keyLen], dk[2*a.keyLen:]
+}
+
+// decrypt returns the plaintext of a WinZip AES entry of size bytes,
+// including its salt, password verifier, and authentication code.
+func (a *aesExtra) decrypt(r io.Reader, size int64, password []byte) (io.Reader, error) {
+	dataLen := size - int64(a.saltSize) - 2 - aesAuthLen
+	if dataLen < 0 {
+		return nil, fmt.Errorf("entry too short for AES header")
+	}
+	header := make([]byte, a.saltSize+2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("reading AES header: %v", err)
+	}
+	encKey, authKey, verifier := a.keys(password, header[:a.saltSize])
+	if !bytes.Equal(verifier, header[a.saltSize:]) {
+		return nil, errBadPassword
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	return &aesReader{
+		r:      io.LimitReader(r, dataLen),
+		src:    r,
+		stream: newWinZipCTR(block),
+		mac:    hmac.New(sha1.New, authKey),
+	}, nil
+}
+
+// aesReader decrypts a WinZip AES entry, and checks its authentication code
+// once fully read.
+type aesReader struct {
+	r      io.Reader
+	src    io.Reader
+	stream cipher.Stream
+	mac    hash.Hash
+	// verified is set once the authentication code was checked.
+	verified bool
+}
+
+func (a *aesReader) Read(b []byte) (int, error) {
+	n, err := a.r.Read(b)
+	a.mac.Write(b[:n])
+	a.stream.XORKeyStream(b[:n], b[:n])
+	if err == io.EOF && !a.verified {
+		a.verified = true
+		code := make([]byte, aesAuthLen)
+		if _, rerr := io.ReadFull(a.src, code); rerr != nil {
+			return n, fmt.Errorf("reading authentication code: %v", rerr)
+		}
+		if !hmac.Equal(code, a.mac.Sum(nil)[:aesAuthLen]) {
+			return n, fmt.Errorf("authentication code mismatch")
+		}
+	}
+	return n, err
+}
+
+// winZipCTR is AES in counter mode, with a little-endian counter starting
+// at 1, unlike crypto/cipher's big-endian CTR.
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	buf     [aes.BlockSize]byte
+	used    int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, used: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.buf[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.buf[c.used]
+		c.used++
+	}
+}
+
+// pbkdf2SHA1 implements PBKDF2 from RFC 8018 with HMAC-SHA1.
+func pbkdf2SHA1(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var dk []byte
+	for block := uint32(1); len(dk) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], block)
+		prf.Write(n[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		dk = append(dk, t...)
+	}
+	return dk[:keyLen]
+}
+
+// decryptFile is an open encrypted entry of a zipFS.
+type decryptFile struct {
+	info fs.FileInfo
+	rc   io.ReadCloser
+}
+
+func (d *decryptFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *decryptFile) Read(b []byte) (int, error) {
+	return d.rc.Read(b)
+}
+
+func (d *decryptFile) Close() error {
+	return d.rc.Close()
+}
@@ -0,0 +1,337 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestPBKDF2SHA1(t *testing.T) {
+	// Test vectors from RFC 6070.
+	tests := []struct {
+		iter int
+		want string
+	}{
+		{1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{4096, "4b007901b765489abead49d926f721d065a429c1"},
+	}
+	for _, tc := range tests {
+		got := hex.EncodeToString(pbkdf2SHA1([]byte("password"), []byte("salt"), tc.iter, 20))
+		if got != tc.want {
+			t.Errorf("pbkdf2SHA1(%d iterations) = %s, want %s", tc.iter, got, tc.want)
+		}
+	}
+}
+
+// encryption of test archives.
+const (
+	zipCrypto = iota
+	aes1
+	aes2
+)
+
+func (k *zipCryptoKeys) encrypt(b []byte) {
+	for i := range b {
+		p := b[i]
+		b[i] ^= k.stream()
+		k.update(p)
+	}
+}
+
+// writeEncrypted adds a deflated entry encrypted with password.
+func writeEncrypted(t *testing.T, zw *zip.Writer, name string, content []byte, password string, enc int) {
+	t.Helper()
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		t.Fatalf("creating flate writer: %v", err)
+	}
+	fw.Write(content)
+	fw.Close()
+
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		Flags:              flagEncrypted,
+		CRC32:              crc32.ChecksumIEEE(content),
+		UncompressedSize64: uint64(len(content)),
+	}
+	var data []byte
+	switch enc {
+	case zipCrypto:
+		header := make([]byte, zipCryptoHeaderLen)
+		header[zipCryptoHeaderLen-1] = byte(fh.CRC32 >> 24)
+		data = append(header, compressed.Bytes()...)
+		newZipCryptoKeys([]byte(password)).encrypt(data)
+	case aes1, aes2:
+		version := uint16(enc - aes1 + 1)
+		extra := make([]byte, 11)
+		binary.LittleEndian.PutUint16(extra, aesExtraID)
+		binary.LittleEndian.PutUint16(extra[2:], 7)
+		binary.LittleEndian.PutUint16(extra[4:], version)
+		copy(extra[6:], "AE")
+		extra[8] = 3 // AES-256
+		binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+		a, err := parseAESExtra(extra)
+		if err != nil {
+			t.Fatalf("parseAESExtra() failed: %v", err)
+		}
+		fh.Method = methodAES
+		fh.Extra = extra
+		if version == 2 {
+			fh.CRC32 = 0
+		}
+
+		salt := bytes.Repeat([]byte{0x5a}, a.saltSize)
+		encKey, authKey, verifier := a.keys([]byte(password), salt)
+		block, err := aes.NewCipher(encKey)
+		if err != nil {
+			t.Fatalf("creating cipher: %v", err)
+		}
+		ciphertext := make([]byte, compressed.Len())
+		newWinZipCTR(block).XORKeyStream(ciphertext, compressed.Bytes())
+		mac := hmac.New(sha1.New, authKey)
+		mac.Write(ciphertext)
+		data = append(append(append(salt, verifier...), ciphertext...), mac.Sum(nil)[:aesAuthLen]...)
+	}
+	fh.CompressedSize64 = uint64(len(data))
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		t.Fatalf("creating entry %s: %v", name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("writing entry %s: %v", name, err)
+	}
+}
+
+// encryptJAR returns a copy of a test JAR with every entry encrypted.
+func encryptJAR(t *testing.T, name, password string, enc int) []byte {
+	t.Helper()
+	zr, err := zip.OpenReader(testdataPath(name))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			if _, err := zw.Create(f.Name); err != nil {
+				t.Fatalf("creating directory %s: %v", f.Name, err)
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		writeEncrypted(t, zw, f.Name, content, password, enc)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestParseEncrypted(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		enc  int
+	}{
+		{"zipcrypto", zipCrypto},
+		{"ae-1", aes1},
+		{"ae-2", aes2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := encryptJAR(t, "vuln-class.jar", "secret", tc.enc)
+			zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatalf("zip.NewReader failed: %v", err)
+			}
+
+			cfg := &Config{Passwords: []string{"wrong", "secret"}}
+			r, err := cfg.Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if !r.Vulnerable {
+				t.Errorf("Parse() returned not vulnerable, want vulnerable")
+			}
+
+			for _, passwords := range [][]string{nil, {"wrong"}} {
+				cfg := &Config{Passwords: passwords}
+				if _, err := cfg.Parse(zr); err == nil {
+					t.Errorf("Parse() with passwords %q succeeded, want error", passwords)
+				}
+			}
+		})
+	}
+}
+
+func TestParseEncryptedNested(t *testing.T) {
+	// Delivery archives encrypt the JARs they contain.
+	inner, err := os.ReadFile(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	writeEncrypted(t, zw, "release/lib/log4j-core-2.14.0.jar", inner, "secret", aes2)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	if !IsJAR(zr) {
+		t.Errorf("IsJAR() = false for an archive of encrypted JARs, want true")
+	}
+	cfg := &Config{Passwords: []string{"secret"}}
+	r, err := cfg.Parse(zr)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if !r.Vulnerable {
+		t.Errorf("Parse() returned not vulnerable, want vulnerable")
+	}
+}
+
+func TestOpenEncryptedCorrupt(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		enc  int
+	}{
+		{"zipcrypto", zipCrypto},
+		{"ae-2", aes2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := encryptJAR(t, "vuln-class.jar", "secret", tc.enc)
+			zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatalf("zip.NewReader failed: %v", err)
+			}
+			var f *zip.File
+			for _, zf := range zr.File {
+				if zf.Name == "net/JndiManager.class" {
+					f = zf
+				}
+			}
+			if f == nil {
+				t.Fatalf("net/JndiManager.class not found")
+			}
+			read := func() error {
+				rc, err := openEncrypted(f, []string{"secret"}, spillConfig{})
+				if err != nil {
+					return err
+				}
+				defer rc.Close()
+				_, err = io.ReadAll(rc)
+				return err
+			}
+			if err := read(); err != nil {
+				t.Fatalf("reading entry failed: %v", err)
+			}
+
+			// Flip the last byte of the entry, part of the authentication
+			// code for AES and the compressed data for ZipCrypto.
+			off, err := f.DataOffset()
+			if err != nil {
+				t.Fatalf("DataOffset() failed: %v", err)
+			}
+			b[off+int64(f.CompressedSize64)-1] ^= 0xff
+			if err := read(); err == nil {
+				t.Errorf("reading a corrupted entry succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestOpenEncryptedCollidingPassword(t *testing.T) {
+	content := bytes.Repeat([]byte("org/apache/logging/log4j/core/lookup/JndiLookup"), 100)
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	writeEncrypted(t, zw, "JndiLookup.class", content, "secret", zipCrypto)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	f := zr.File[0]
+
+	// Find a wrong password passing the one byte check of the header.
+	var wrong string
+	for i := 0; i < 10000 && wrong == ""; i++ {
+		pw := fmt.Sprintf("wrong%d", i)
+		raw, err := f.OpenRaw()
+		if err != nil {
+			t.Fatalf("OpenRaw() failed: %v", err)
+		}
+		if _, err := zipCryptoDecrypt(raw, int64(f.CompressedSize64), []byte(pw), zipCryptoCheck(&f.FileHeader)); err != errBadPassword {
+			wrong = pw
+		}
+	}
+	if wrong == "" {
+		t.Fatalf("no password collides with the header check")
+	}
+
+	for _, tc := range []struct {
+		name  string
+		spill spillConfig
+	}{
+		{"memory", spillConfig{}},
+		{"spilled", spillConfig{maxMemory: 1, dir: t.TempDir()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, err := openEncrypted(f, []string{wrong, "secret"}, tc.spill)
+			if err != nil {
+				t.Fatalf("openEncrypted() failed: %v", err)
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("reading entry failed: %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("openEncrypted() with %q before the password returned wrong contents", wrong)
+			}
+
+			if rc, err := openEncrypted(f, []string{wrong, "other"}, tc.spill); err == nil {
+				rc.Close()
+				t.Errorf("openEncrypted() with wrong passwords succeeded, want error")
+			}
+		})
+	}
+}
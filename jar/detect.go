@@ -0,0 +1,99 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"io"
+	"path"
+)
+
+// archiveMagic holds the signatures a file scanned as an archive starts
+// with when sniffing, see Detect.Sniff: a ZIP local file header, the end of
+// central directory of an empty archive, the marker of a spanned archive,
+// the "#!" of a launch script prepended to an executable JAR, such as
+// those built by Spring Boot, and the header of a JMOD file.
+var archiveMagic = [][]byte{
+	zipLocalHeader,
+	[]byte("PK\x05\x06"),
+	[]byte("PK\x07\x08"),
+	[]byte("#!"),
+	jmodMagic,
+}
+
+// Detect selects the files a Walker scans as archives. A nil *Detect, like
+// the zero value, scans the files with an archive extension, see
+// HasArchiveExt.
+type Detect struct {
+	// Extensions lists extensions to scan in addition to the archive
+	// extensions, including the dot, such as ".par" or ".rar" for JARs
+	// renamed by some build tools.
+	Extensions []string
+	// Exclude lists extensions that are never scanned, even archive
+	// extensions or with All, such as ".zip" to skip backups.
+	Exclude []string
+	// All scans regular files of any extension, other than those
+	// excluded, for archives that were renamed. It's best combined with
+	// Sniff, so only the files that start like an archive are parsed.
+	All bool
+	// Sniff reads the first bytes of each file to scan, and only parses
+	// those that start with a ZIP signature or a launch script, so files
+	// that are merely named like archives are skipped without reading the
+	// end of the file for its central directory.
+	Sniff bool
+}
+
+// Candidate reports if the file name is scanned, by its extension. With
+// Sniff, its first bytes are checked before it's parsed.
+func (d *Detect) Candidate(name string) bool {
+	ext := path.Ext(name)
+	if d == nil {
+		return exts[ext]
+	}
+	for _, e := range d.Exclude {
+		if e == ext {
+			return false
+		}
+	}
+	if d.All || exts[ext] {
+		return true
+	}
+	for _, e := range d.Extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// sniff reports if the file read by ra is parsed, starting with one of the
+// archiveMagic signatures if Sniff is set.
+func (d *Detect) sniff(ra io.ReaderAt) bool {
+	if d == nil || !d.Sniff {
+		return true
+	}
+	h := make([]byte, len(zipLocalHeader))
+	n, err := ra.ReadAt(h, 0)
+	if err != nil && err != io.EOF {
+		// Reading the archive reports the error.
+		return true
+	}
+	for _, m := range archiveMagic {
+		if bytes.HasPrefix(h[:n], m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDetectCandidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		detect *Detect
+		file   string
+		want   bool
+	}{
+		{"Default", nil, "app/lib/log4j.jar", true},
+		{"DefaultOther", nil, "app/lib/log4j.par", false},
+		{"Zero", &Detect{}, "app.war", true},
+		{"Extension", &Detect{Extensions: []string{".par"}}, "app/lib/log4j.par", true},
+		{"Exclude", &Detect{Exclude: []string{".zip"}}, "backup.zip", false},
+		{"ExcludeOther", &Detect{Exclude: []string{".zip"}}, "app.jar", true},
+		{"All", &Detect{All: true}, "README", true},
+		{"AllExclude", &Detect{All: true, Exclude: []string{".log"}}, "app.log", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.detect.Candidate(tc.file); got != tc.want {
+				t.Errorf("Candidate(%q) = %t, want %t", tc.file, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWalkerDetect(t *testing.T) {
+	dir := t.TempDir()
+	cpFile(t, filepath.Join(dir, "vuln-class.jar"), testdataPath("vuln-class.jar"))
+	cpFile(t, filepath.Join(dir, "vuln-class.par"), testdataPath("vuln-class.jar"))
+	cpFile(t, filepath.Join(dir, "renamed"), testdataPath("vuln-class.jar"))
+	b, err := os.ReadFile(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("reading JAR: %v", err)
+	}
+	// A JAR behind a launch script, and one behind other data, which Go
+	// reads but the JVM doesn't.
+	if err := os.WriteFile(filepath.Join(dir, "launch.jar"), append([]byte("#!/bin/sh\nexit 0\n"), b...), 0755); err != nil {
+		t.Fatalf("writing JAR: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "prefixed.jar"), append([]byte("junk"), b...), 0644); err != nil {
+		t.Fatalf("writing JAR: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		detect *Detect
+		want   []string
+	}{
+		{
+			name: "Default",
+			want: []string{"launch.jar", "prefixed.jar", "vuln-class.jar"},
+		},
+		{
+			name:   "Extensions",
+			detect: &Detect{Extensions: []string{".par"}},
+			want:   []string{"launch.jar", "prefixed.jar", "vuln-class.jar", "vuln-class.par"},
+		},
+		{
+			name:   "Sniff",
+			detect: &Detect{Sniff: true},
+			want:   []string{"launch.jar", "vuln-class.jar"},
+		},
+		{
+			name:   "All",
+			detect: &Detect{All: true, Sniff: true, Exclude: []string{".par"}},
+			want:   []string{"launch.jar", "renamed", "vuln-class.jar"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			w := Walker{
+				Detect: tc.detect,
+				HandleError: func(path string, err error) {
+					t.Errorf("processing %s: %v", path, err)
+				},
+				HandleReport: func(path string, r *Report) {
+					got = append(got, filepath.Base(path))
+				},
+			}
+			if err := w.Walk(dir); err != nil {
+				t.Fatalf("walking filesystem: %v", err)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("walk reported unexpected JARs (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
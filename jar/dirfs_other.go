@@ -0,0 +1,38 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+
+package jar
+
+import (
+	"io/fs"
+	"os"
+)
+
+// dirFS returns the filesystem a directory is walked through.
+func dirFS(dir string) fs.FS {
+	return os.DirFS(dir)
+}
+
+// isLink reports if a directory entry is a symlink.
+func isLink(d fs.DirEntry) bool {
+	return d.Type()&fs.ModeSymlink != 0
+}
+
+// isLocked reports if err is the error of a locked file, which only
+// Windows prevents reading.
+func isLocked(err error) bool {
+	return false
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package jar
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// dirFS returns the filesystem a directory is walked through. Files are
+// opened by their extended-length path, see longPath.
+func dirFS(dir string) fs.FS {
+	return longPathFS(dir)
+}
+
+// longPathFS is a directory whose files are opened by their extended-length
+// path. Unlike os.DirFS, paths can be longer than MAX_PATH, and directories
+// given as extended-length paths, where forward slashes aren't separators,
+// can be walked.
+type longPathFS string
+
+func (dir longPathFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) || strings.ContainsAny(name, `\:`) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return longPath(filepath.Join(string(dir), filepath.FromSlash(name))), nil
+}
+
+func (dir longPathFS) Open(name string) (fs.File, error) {
+	p, err := dir.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (dir longPathFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := dir.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+// longPath returns the extended-length form of a path: absolute, with the
+// \\?\ prefix, or \\?\UNC\ for shares such as \\server\share, which lifts
+// the MAX_PATH limit of 260 characters. Paths that are already extended or
+// device paths are returned as is.
+func longPath(p string) string {
+	if strings.HasPrefix(p, `\\?\`) || strings.HasPrefix(p, `\\.\`) {
+		return p
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC` + abs[1:]
+	}
+	return `\\?\` + abs
+}
+
+// isLink reports if a directory entry is a symlink or another reparse point
+// that redirects to a directory, such as a junction (mount point), which
+// recent Go versions report as irregular files rather than symlinks.
+func isLink(d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink != 0 {
+		return true
+	}
+	if d.Type()&fs.ModeIrregular == 0 {
+		return false
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 &&
+		attrs.FileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0
+}
+
+// isLocked reports if err is the error of a file another process holds open
+// without sharing it, or has locked a range of.
+func isLocked(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
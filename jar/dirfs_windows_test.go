@@ -0,0 +1,152 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package jar
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/windows"
+)
+
+func TestLongPath(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getting working directory: %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`C:\app\lib`, `\\?\C:\app\lib`},
+		{`C:\app\..\lib\`, `\\?\C:\lib`},
+		{`\\server\share\app`, `\\?\UNC\server\share\app`},
+		{`\\?\C:\app\lib`, `\\?\C:\app\lib`},
+		{`\\?\UNC\server\share`, `\\?\UNC\server\share`},
+		{`\\.\C:`, `\\.\C:`},
+		{`lib`, `\\?\` + filepath.Join(wd, "lib")},
+	}
+	for _, test := range tests {
+		if got := longPath(test.path); got != test.want {
+			t.Errorf("longPath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+// walkJARs walks dir, returning the scanned JARs relative to dir and any
+// errors.
+func walkJARs(t *testing.T, w *Walker, dir string) (jars []string, errs map[string]error) {
+	t.Helper()
+	errs = map[string]error{}
+	w.HandleError = func(path string, err error) {
+		errs[path] = err
+	}
+	w.HandleJAR = func(path string, r *Report) {
+		p, err := filepath.Rel(dir, path)
+		if err != nil {
+			t.Errorf("path %s isn't under %s", path, dir)
+		}
+		jars = append(jars, filepath.ToSlash(p))
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking %s: %v", dir, err)
+	}
+	return jars, errs
+}
+
+func TestWalkerLongPaths(t *testing.T) {
+	dir := t.TempDir()
+	deep := dir
+	for len(deep) < 300 {
+		deep = filepath.Join(deep, strings.Repeat("d", 50))
+	}
+	cpFile(t, filepath.Join(deep, "vuln-class.jar"), testdataPath("vuln-class.jar"))
+	rel, err := filepath.Rel(dir, filepath.Join(deep, "vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("relative path: %v", err)
+	}
+	want := []string{filepath.ToSlash(rel)}
+
+	for _, root := range []string{dir, longPath(dir)} {
+		got, errs := walkJARs(t, &Walker{}, root)
+		for p, err := range errs {
+			t.Errorf("walking %s: processing %s: %v", root, p, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("walking %s returned unexpected JARs (-want, +got):\n%s", root, diff)
+		}
+	}
+}
+
+func TestWalkerLockedFile(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "vuln-class.jar")
+	cpFile(t, p, testdataPath("vuln-class.jar"))
+	name, err := windows.UTF16PtrFromString(p)
+	if err != nil {
+		t.Fatalf("converting path: %v", err)
+	}
+	// Open the file without sharing it, like a running service would.
+	h, err := windows.CreateFile(name, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		t.Fatalf("opening %s: %v", p, err)
+	}
+	defer windows.CloseHandle(h)
+
+	got, errs := walkJARs(t, &Walker{}, dir)
+	if len(got) != 0 {
+		t.Errorf("walk scanned locked JARs: %v", got)
+	}
+	if err := errs[p]; !errors.Is(err, ErrLocked) {
+		t.Errorf("walk returned error %v for locked file, want ErrLocked", err)
+	}
+}
+
+func TestWalkerJunctionLoop(t *testing.T) {
+	dir := t.TempDir()
+	cpFile(t, filepath.Join(dir, "app", "vuln-class.jar"), testdataPath("vuln-class.jar"))
+	// Junctions, unlike symlinks, don't need any privileges to create.
+	link := filepath.Join(dir, "app", "loop")
+	if out, err := exec.Command("cmd", "/c", "mklink", "/J", link, dir).CombinedOutput(); err != nil {
+		t.Skipf("creating junction: %v: %s", err, out)
+	}
+
+	tests := []struct {
+		name   string
+		follow bool
+		want   []string
+	}{
+		{"Skip", false, []string{"app/vuln-class.jar"}},
+		{"Follow", true, []string{"app/vuln-class.jar"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, errs := walkJARs(t, &Walker{FollowSymlinks: test.follow}, dir)
+			for p, err := range errs {
+				t.Errorf("processing %s: %v", p, err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("walk returned unexpected JARs (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
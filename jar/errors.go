@@ -0,0 +1,143 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Kinds of EntryError, matched with errors.Is.
+var (
+	// ErrTooDeep is the error of an archive nested deeper than 16 levels.
+	ErrTooDeep = errors.New("archives nested too deeply")
+	// ErrTooLarge is the error of an entry that would take the memory
+	// held by a scan over 4GiB.
+	ErrTooLarge = errors.New("entry too large")
+	// ErrCorruptEntry is the error of an entry that can't be read, such as
+	// one with invalid compressed data or an encrypted one without a
+	// matching password.
+	ErrCorruptEntry = errors.New("corrupt entry")
+)
+
+// PanicError is returned for an archive whose scan panicked, such as on a
+// malformed archive hitting a bug, rather than crashing the whole scan.
+type PanicError struct {
+	// Value is the value passed to panic, and Stack the stack of the
+	// goroutine that panicked.
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("internal error scanning archive: %v", e.Value)
+}
+
+// EntryError is the error of an entry of an archive that couldn't be
+// scanned. It's returned by Parse, or recorded in Report.Errors with
+// Config.BestEffort.
+type EntryError struct {
+	// Path is the entry, with nested archives separated by "!" like
+	// Evidence paths.
+	Path string
+	// Kind is ErrTooDeep, ErrTooLarge, or ErrCorruptEntry.
+	Kind error
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Is reports if target is the Kind of the error.
+func (e *EntryError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns Err.
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// entryErrorJSON is the JSON encoding of an EntryError, such as in caches
+// of reports.
+type entryErrorJSON struct {
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	Error string `json:"error"`
+}
+
+// MarshalJSON encodes the error with its Kind and Err as strings.
+func (e EntryError) MarshalJSON() ([]byte, error) {
+	j := entryErrorJSON{Path: e.Path}
+	if e.Kind != nil {
+		j.Kind = e.Kind.Error()
+	}
+	if e.Err != nil {
+		j.Error = e.Err.Error()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes an error encoded by MarshalJSON. Err only keeps the
+// message of the original error.
+func (e *EntryError) UnmarshalJSON(b []byte) error {
+	var j entryErrorJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*e = EntryError{Path: j.Path, Err: errors.New(j.Error)}
+	for _, kind := range []error{ErrTooDeep, ErrTooLarge, ErrCorruptEntry} {
+		if j.Kind == kind.Error() {
+			e.Kind = kind
+		}
+	}
+	return nil
+}
+
+// entryError handles the entry p of the archive being checked that couldn't
+// be scanned. With Config.BestEffort the error is recorded in the report and
+// nil is returned, so the scan goes on. Otherwise it returns the
+// *EntryError, which fails the scan. Zip bombs and cancelled scans always
+// fail, returning err as is.
+func (c *checker) entryError(p string, kind, err error) error {
+	if c.bomb != nil || c.ctx.Err() != nil {
+		return err
+	}
+	e := &EntryError{Path: c.nested + p, Kind: kind, Err: err}
+	if c.bestEffort {
+		c.errors = append(c.errors, *e)
+		return nil
+	}
+	if c.failed == nil {
+		c.failed = e
+	}
+	return e
+}
+
+// failure returns the typed error that failed a check, a zip bomb or an
+// *EntryError, so callers can tell them apart from other errors, or nil if
+// the check failed otherwise.
+func (c *checker) failure() error {
+	if c.bomb != nil {
+		return c.bomb
+	}
+	if c.failed != nil {
+		return c.failed
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"log4jscanner/testjar"
+)
+
+// corruptJAR returns a JAR holding a class that can't be decompressed,
+// followed by a vulnerable nested JAR.
+func corruptJAR(t *testing.T) []byte {
+	t.Helper()
+	vuln, err := os.ReadFile(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "com/example/Bad.class",
+		Method:             zip.Deflate,
+		CompressedSize64:   4,
+		UncompressedSize64: 16,
+	})
+	if err != nil {
+		t.Fatalf("creating entry: %v", err)
+	}
+	if _, err := w.Write([]byte{0xff, 0xff, 0xff, 0xff}); err != nil {
+		t.Fatalf("writing entry: %v", err)
+	}
+	w, err = zw.CreateHeader(&zip.FileHeader{Name: "lib/log4j-core-2.14.0.jar", Method: zip.Store})
+	if err != nil {
+		t.Fatalf("creating entry: %v", err)
+	}
+	if _, err := w.Write(vuln); err != nil {
+		t.Fatalf("writing entry: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	return b.Bytes()
+}
+
+// deepJAR returns a class nested in the given number of JARs, each named
+// "a.jar".
+func deepJAR(t *testing.T, depth int) []byte {
+	t.Helper()
+	data := testjar.Zip(t, zip.Deflate, testjar.File("com/example/Main.class", "class"))
+	for i := 0; i < depth; i++ {
+		data = testjar.Zip(t, zip.Store, testjar.File("a.jar", string(data)))
+	}
+	return data
+}
+
+func TestParseEntryErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantKind error
+		wantPath string
+		wantBad  bool
+	}{
+		{
+			name:     "Corrupt",
+			data:     corruptJAR(t),
+			wantKind: ErrCorruptEntry,
+			wantPath: "com/example/Bad.class",
+			wantBad:  true,
+		},
+		{
+			name:     "TooDeep",
+			data:     deepJAR(t, maxZipDepth+1),
+			wantKind: ErrTooDeep,
+			wantPath: strings.Repeat("a.jar!", maxZipDepth) + "a.jar",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			zr, err := zip.NewReader(bytes.NewReader(tc.data), int64(len(tc.data)))
+			if err != nil {
+				t.Fatalf("zip.NewReader failed: %v", err)
+			}
+
+			_, err = Parse(zr)
+			var ee *EntryError
+			if !errors.Is(err, tc.wantKind) || !errors.As(err, &ee) {
+				t.Fatalf("Parse() returned error %v, want %v", err, tc.wantKind)
+			}
+			if ee.Path != tc.wantPath {
+				t.Errorf("Parse() returned error of %s, want %s", ee.Path, tc.wantPath)
+			}
+
+			report, err := (&Config{BestEffort: true}).Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() in best-effort mode failed: %v", err)
+			}
+			if report.Vulnerable != tc.wantBad {
+				t.Errorf("Parse() in best-effort mode returned vulnerable %t, want %t", report.Vulnerable, tc.wantBad)
+			}
+			if len(report.Errors) != 1 || report.Errors[0].Path != tc.wantPath || report.Errors[0].Kind != tc.wantKind {
+				t.Errorf("Parse() in best-effort mode returned errors %v, want one %v of %s", report.Errors, tc.wantKind, tc.wantPath)
+			}
+		})
+	}
+}
+
+func TestEntryErrorJSON(t *testing.T) {
+	want := EntryError{Path: "lib/a.jar!A.class", Kind: ErrCorruptEntry, Err: errors.New("reading file: unexpected EOF")}
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	var got EntryError
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if got.Path != want.Path || got.Kind != want.Kind || got.Error() != want.Error() {
+		t.Errorf("json round trip returned %#v, want %#v", got, want)
+	}
+}
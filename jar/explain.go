@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// Explanation details how the rules evaluated a JAR, for triaging suspected
+// false positives.
+type Explanation struct {
+	// Report is the outcome of the scan, as returned by Parse.
+	Report *Report
+	// Rules holds the result of every built-in rule.
+	Rules []RuleResult
+	// Evidence holds the observations the rules and report are derived
+	// from, in the order they were found.
+	Evidence []Evidence
+}
+
+// RuleResult is the result of a single rule.
+type RuleResult struct {
+	Rule
+	// Enabled is false if the rule was disabled by the configuration.
+	Enabled bool
+	// Matched reports if the rule matched.
+	Matched bool
+}
+
+// Evidence is an observation made while scanning a JAR.
+type Evidence struct {
+	// Path is the file the observation was made in. Files of nested
+	// archives are separated from the archive by "!", such as
+	// "lib/inner.jar!org/apache/logging/log4j/core/net/JndiManager.class".
+	Path string
+	// Offset is the byte offset of the match within the file, or -1.
+	Offset int64
+	// Detail describes the observation.
+	Detail string
+}
+
+func (e Evidence) String() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Detail)
+	}
+	return fmt.Sprintf("%s @ 0x%x: %s", e.Path, e.Offset, e.Detail)
+}
+
+// Explain scans a JAR like Parse, recording evidence of every rule.
+func Explain(r fs.FS) (*Explanation, error) {
+	return defaultConfig.Explain(r)
+}
+
+// Explain scans a JAR like the Explain function, only evaluating the rules
+// enabled by the configuration. Unlike Parse, the whole JAR is always read.
+func (cfg *Config) Explain(r fs.FS) (*Explanation, error) {
+	e := &Explanation{}
+	c := cfg.newChecker()
+	c.explanation = e
+	if err := c.checkJAR(c.zipFS(r), 0, 0); err != nil {
+		if err := c.failure(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to check JAR: %v", err)
+	}
+	e.Report = c.report()
+	for _, rule := range Rules {
+		e.Rules = append(e.Rules, RuleResult{
+			Rule:    rule,
+			Enabled: c.rules[rule.ID],
+			Matched: c.match(rule.ID),
+		})
+	}
+	return e, nil
+}
+
+// evidence records an observation if the checker is explaining a JAR.
+func (c *checker) evidence(p string, offset int64, detail string) {
+	if c.explanation == nil {
+		return
+	}
+	c.explanation.Evidence = append(c.explanation.Evidence, Evidence{
+		Path:   c.nested + p,
+		Offset: offset,
+		Detail: detail,
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExplain(t *testing.T) {
+	zr, err := zip.OpenReader(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	cfg := &Config{DisableRules: []string{RuleLog4j216Heuristic}}
+	e, err := cfg.Explain(zr)
+	if err != nil {
+		t.Fatalf("Explain() failed: %v", err)
+	}
+	if !e.Report.Vulnerable {
+		t.Errorf("Explain() returned report that isn't vulnerable")
+	}
+
+	type result struct {
+		ID               string
+		Enabled, Matched bool
+	}
+	var got []result
+	for _, r := range e.Rules {
+		got = append(got, result{r.ID, r.Enabled, r.Matched})
+	}
+	want := []result{
+		{RuleLog4j44228Constructor, true, true},
+		{RuleLog4j216Heuristic, false, false},
+		{RuleLog4j44832JDBC, false, false},
+		{RuleLog4j1JMSAppender, false, false},
+		{RuleLog4j1SocketServer, false, false},
+		{RuleLog4j1JMSSink, false, false},
+		{RuleLog4j1JDBCAppender, false, false},
+		{RuleLog4j1Chainsaw, false, false},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Explain() returned unexpected rules (-want, +got): %s", diff)
+	}
+
+	var found []string
+	for _, ev := range e.Evidence {
+		if strings.HasPrefix(ev.Path, "org/apache/logging/log4j/core/net/JndiManager.class") && ev.Offset >= 0 {
+			found = append(found, ev.Detail)
+		}
+	}
+	if len(found) != 1 || !strings.Contains(found[0], "constructor") {
+		t.Errorf("Explain() returned JndiManager evidence with offsets %q, want the constructor match", found)
+	}
+}
+
+func TestExplainNested(t *testing.T) {
+	zr, err := zip.OpenReader(testdataPath("bad_jar_in_jar.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	e, err := Explain(zr)
+	if err != nil {
+		t.Fatalf("Explain() failed: %v", err)
+	}
+	if len(e.Evidence) == 0 {
+		t.Fatalf("Explain() returned no evidence")
+	}
+	for _, ev := range e.Evidence {
+		if !strings.HasPrefix(ev.Path, "vuln-class.jar!") {
+			t.Errorf("Explain() returned evidence for %s, want paths within vuln-class.jar!", ev.Path)
+		}
+	}
+}
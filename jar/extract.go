@@ -0,0 +1,66 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// Extract opens a file within a JAR. Files of nested archives are separated
+// from the archive by "!", like the paths of Evidence, such as
+// "WEB-INF/lib/app.jar!BOOT-INF/lib/log4j-core-2.14.1.jar". Names are
+// decoded as reported by EntryName.
+func Extract(r fs.FS, path string) (fs.File, error) {
+	return defaultConfig.Extract(r, path)
+}
+
+// Extract opens a file like the Extract function, decrypting encrypted
+// entries with the configured passwords. Archives enclosing the file are read
+// into memory.
+func (cfg *Config) Extract(r fs.FS, path string) (fs.File, error) {
+	path = strings.Trim(path, "!")
+	if path == "" {
+		return nil, fmt.Errorf("no path to extract")
+	}
+	c := cfg.newChecker()
+	z := c.zipFS(r)
+	parts := strings.Split(path, "!")
+	for i, p := range parts {
+		name := strings.Join(parts[:i+1], "!")
+		f, err := z.Open(strings.TrimPrefix(p, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("opening %s: %v", name, err)
+		}
+		if i == len(parts)-1 {
+			return f, nil
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", name, err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", name, err)
+		}
+		z = c.zipFS(zr)
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	zr, err := zip.OpenReader(testdataPath("bad_jar_in_jar_in_jar.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	want, err := os.ReadFile(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("reading vuln-class.jar: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "bad_jar_in_jar.jar!vuln-class.jar"},
+		{path: "bad_jar_in_jar.jar!vuln-class.jar!"},
+		{path: "bad_jar_in_jar.jar!missing.jar", wantErr: true},
+		{path: "META-INF/!vuln-class.jar", wantErr: true},
+		{path: "", wantErr: true},
+	}
+	for _, tc := range tests {
+		f, err := Extract(zr, tc.path)
+		if err != nil {
+			if !tc.wantErr {
+				t.Errorf("Extract(%q) failed: %v", tc.path, err)
+			}
+			continue
+		}
+		got, err := io.ReadAll(f)
+		f.Close()
+		if tc.wantErr {
+			t.Errorf("Extract(%q) succeeded, want error", tc.path)
+			continue
+		}
+		if err != nil {
+			t.Errorf("reading %q: %v", tc.path, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Extract(%q) returned %d bytes, want vuln-class.jar (%d bytes)", tc.path, len(got), len(want))
+		}
+	}
+}
+
+func TestExtractEncrypted(t *testing.T) {
+	inner, err := os.ReadFile(testdataPath("bad_jar_in_jar.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	writeEncrypted(t, zw, "release/lib/app.jar", inner, "secret", aes2)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+
+	const path = "release/lib/app.jar!vuln-class.jar"
+	if _, err := Extract(zr, path); err == nil {
+		t.Errorf("Extract(%q) without a password succeeded, want error", path)
+	}
+	cfg := &Config{Passwords: []string{"secret"}}
+	f, err := cfg.Extract(zr, path)
+	if err != nil {
+		t.Fatalf("Extract(%q) with the password failed: %v", path, err)
+	}
+	defer f.Close()
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("reading %q: %v", path, err)
+	}
+	want, err := os.ReadFile(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("reading vuln-class.jar: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Extract(%q) returned %d bytes, want vuln-class.jar (%d bytes)", path, len(got), len(want))
+	}
+}
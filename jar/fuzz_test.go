@@ -0,0 +1,62 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+
+package jar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// FuzzParse checks that scanning arbitrary bytes, such as truncated or
+// corrupt archives, returns an error rather than panicking, with and without
+// Config.Salvage. Run it with:
+//
+//	go test -fuzz=FuzzParse ./jar
+func FuzzParse(f *testing.F) {
+	for _, name := range []string{
+		"helloworld.jar",
+		"notarealjar.jar",
+		"vuln-class.jar",
+		"good_jar_in_jar.jar",
+		"bad_jar_in_jar.jar",
+	} {
+		data, err := os.ReadFile(testdataPath(name))
+		if err != nil {
+			f.Fatalf("reading seed: %v", err)
+		}
+		f.Add(data)
+		f.Add(data[:len(data)/2])
+		f.Add(data[len(data)/2:])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, cfg := range []*Config{
+			{Timeout: 10 * time.Second},
+			{Timeout: 10 * time.Second, Salvage: true},
+		} {
+			ra := bytes.NewReader(data)
+			_, err := cfg.ParseReaderAt(context.Background(), ra, ra.Size())
+			var pe *PanicError
+			if errors.As(err, &pe) {
+				t.Fatalf("ParseReaderAt(Salvage: %t) panicked: %v\n%s", cfg.Salvage, pe.Value, pe.Stack)
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync"
+)
+
+// hashChunk is the size of the reads filling the gaps detection skipped.
+const hashChunk = 1 << 20 // 1MiB
+
+// hashReaderAt computes the SHA-256 of a file from the reads of detection, so
+// the file is read once rather than by detection and hashing separately.
+// Reads that continue the hashed prefix of the file extend the hash, and small
+// gaps before them, such as entries no rule reads, are filled as they're
+// found. Larger gaps, and parts read out of order, such as the central
+// directory, are read by sum.
+type hashReaderAt struct {
+	ra   io.ReaderAt
+	size int64
+
+	mu     sync.Mutex
+	h      hash.Hash
+	hashed int64
+	// backfilled counts the bytes read for the hash alone.
+	backfilled int64
+}
+
+// newHashReaderAt hashes the first size bytes of ra as they're read.
+func newHashReaderAt(ra io.ReaderAt, size int64) *hashReaderAt {
+	return &hashReaderAt{ra: ra, size: size, h: sha256.New()}
+}
+
+func (r *hashReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ra.ReadAt(p, off)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if gap := off - r.hashed; gap > 0 && gap <= hashChunk && n > 0 {
+		// Fill small gaps, such as the entries between those detection
+		// reads, while the disk is reading nearby, rather than reading
+		// them out of order once detection completes.
+		r.fill(off)
+	}
+	if end := off + int64(n); off <= r.hashed && r.hashed < end {
+		if end > r.size {
+			end = r.size
+		}
+		r.h.Write(p[r.hashed-off : end-off])
+		r.hashed = end
+	}
+	return n, err
+}
+
+// fill hashes the file up to off, reading what detection didn't. Errors are
+// left for sum to report.
+func (r *hashReaderAt) fill(off int64) {
+	buf := make([]byte, off-r.hashed)
+	m, _ := r.ra.ReadAt(buf, r.hashed)
+	r.h.Write(buf[:m])
+	r.hashed += int64(m)
+	r.backfilled += int64(m)
+}
+
+// sum reads what detection didn't, and returns the hex encoded SHA-256 of
+// the file.
+func (r *hashReaderAt) sum() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var buf []byte
+	for r.hashed < r.size {
+		if buf == nil {
+			buf = make([]byte, hashChunk)
+		}
+		n := int64(len(buf))
+		if r.size-r.hashed < n {
+			n = r.size - r.hashed
+		}
+		m, err := r.ra.ReadAt(buf[:n], r.hashed)
+		r.h.Write(buf[:m])
+		r.hashed += int64(m)
+		r.backfilled += int64(m)
+		if int64(m) < n {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+	}
+	return hex.EncodeToString(r.h.Sum(nil)), nil
+}
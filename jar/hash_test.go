@@ -0,0 +1,182 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWalkerHash(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"log4j-core-2.14.0.jar", "vuln-class.jar", "safe1.jar", "notarealjar.jar"} {
+		cpFile(t, filepath.Join(dir, file), testdataPath(file))
+	}
+	got := map[string]string{}
+	w := Walker{
+		Hash: true,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleJAR: func(path string, r *Report) {
+			got[filepath.Base(path)] = r.SHA256
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	want := map[string]string{}
+	for _, file := range []string{"log4j-core-2.14.0.jar", "vuln-class.jar", "safe1.jar"} {
+		b, err := os.ReadFile(testdataPath(file))
+		if err != nil {
+			t.Fatalf("reading %s: %v", file, err)
+		}
+		sum := sha256.Sum256(b)
+		want[file] = hex.EncodeToString(sum[:])
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Walker hashed diff (-want, +got): %s", diff)
+	}
+}
+
+// countingFile counts the bytes read from a file.
+type countingFile struct {
+	*os.File
+	read int64
+}
+
+func (f *countingFile) ReadAt(b []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(b, off)
+	atomic.AddInt64(&f.read, int64(n))
+	return n, err
+}
+
+func TestWalkerHashSinglePass(t *testing.T) {
+	p := testdataPath("log4j-core-2.14.0.jar")
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("reading %s: %v", p, err)
+	}
+	sum := sha256.Sum256(b)
+	want := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name   string
+		config *Config
+		// maxRead is the most bytes of the file that may be read, beyond
+		// the few sniffed to detect a ZIP archive.
+		maxRead int64
+	}{
+		{name: "Memory", config: &Config{}, maxRead: int64(len(b))},
+		// Files larger than the spill threshold are read in place, and
+		// the gaps detection skips are read once scanning completes.
+		{name: "InPlace", config: &Config{SpillThreshold: 1}, maxRead: 2 * int64(len(b))},
+		{name: "OverBudget", config: &Config{MemoryBudget: NewMemoryBudget(1)}, maxRead: 2 * int64(len(b))},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := os.Open(p)
+			if err != nil {
+				t.Fatalf("opening %s: %v", p, err)
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatalf("stat %s: %v", p, err)
+			}
+			cf := &countingFile{File: f}
+			w := &walker{Walker: &Walker{Hash: true, Config: tc.config}, ctx: context.Background()}
+			r, err := w.parseFile(cf, info, time.Now())
+			if err != nil {
+				t.Fatalf("parseFile() returned error: %v", err)
+			}
+			if r.SHA256 != want {
+				t.Errorf("parseFile() returned SHA-256 %s, want %s", r.SHA256, want)
+			}
+			if cf.read > tc.maxRead+512 {
+				t.Errorf("scanning and hashing read %d bytes of a %d byte file, want at most %d", cf.read, len(b), tc.maxRead)
+			}
+		})
+	}
+}
+
+func TestHashReaderAt(t *testing.T) {
+	data := make([]byte, 3*hashChunk+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:])
+	size := int64(len(data))
+
+	type read struct{ off, n int64 }
+	tests := []struct {
+		name           string
+		reads          []read
+		wantBackfilled int64
+	}{
+		{name: "NoReads", wantBackfilled: size},
+		{name: "Sequential", reads: []read{{0, 100}, {100, hashChunk}, {100 + hashChunk, size - 100 - hashChunk}}},
+		{name: "Overlapping", reads: []read{{0, 200}, {100, 200}, {150, size - 150}}},
+		// Parts read out of order, like the central directory, are read again.
+		{name: "DirectoryFirst", reads: []read{{size - 50, 50}, {0, size - 50}}, wantBackfilled: 50},
+		{name: "SmallGap", reads: []read{{0, 100}, {200, 100}}, wantBackfilled: size - 200},
+		{name: "LargeGap", reads: []read{{0, 100}, {200 + hashChunk, 100}}, wantBackfilled: size - 100},
+		{name: "PastEnd", reads: []read{{0, size + 10}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newHashReaderAt(bytes.NewReader(data), size)
+			for _, r := range tc.reads {
+				b := make([]byte, r.n)
+				n, err := h.ReadAt(b, r.off)
+				if err != nil && err != io.EOF {
+					t.Fatalf("ReadAt(%d, %d) returned error: %v", r.off, r.n, err)
+				}
+				if !bytes.Equal(b[:n], data[r.off:r.off+int64(n)]) {
+					t.Fatalf("ReadAt(%d, %d) returned wrong data", r.off, r.n)
+				}
+			}
+			got, err := h.sum()
+			if err != nil {
+				t.Fatalf("sum() returned error: %v", err)
+			}
+			if got != want {
+				t.Errorf("sum() = %s, want %s", got, want)
+			}
+			if h.backfilled != tc.wantBackfilled {
+				t.Errorf("sum() read %d bytes, want %d", h.backfilled, tc.wantBackfilled)
+			}
+		})
+	}
+}
+
+func TestHashReaderAtShortFile(t *testing.T) {
+	// The file shrank after it was stat'd.
+	h := newHashReaderAt(bytes.NewReader(make([]byte, 10)), 20)
+	if _, err := h.sum(); err != io.ErrUnexpectedEOF {
+		t.Errorf("sum() returned error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
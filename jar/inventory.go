@@ -0,0 +1,178 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Component is a Java library found in a JAR with Config.Inventory, such as
+// the JAR itself or a library bundled in it, so scans can be reused as an
+// inventory for vulnerabilities other than log4j's.
+type Component struct {
+	// Path is the archive holding the component within the JAR, with
+	// nested archives separated by "!" like Evidence paths, such as
+	// "WEB-INF/lib/guava-31.0.1-jre.jar". It's empty for the JAR itself
+	// and the libraries shaded into it.
+	Path string
+	// Group, Artifact, and Version are the Maven coordinates of the
+	// component, taken from its pom.properties. Components without Maven
+	// metadata are identified by their manifest instead, with the
+	// Implementation-Title or Bundle-SymbolicName as Artifact, and no
+	// Group.
+	Group    string
+	Artifact string
+	Version  string
+	// SHA256 is the hex encoded SHA-256 of the nested archive at Path. It's
+	// empty for components of the JAR itself, see Report.SHA256.
+	SHA256 string
+}
+
+// pomPrefix and pomSuffix delimit the paths of the Maven metadata of the
+// libraries built or shaded into a JAR, such as
+// "META-INF/maven/com.google.guava/guava/pom.properties".
+const (
+	pomPrefix = "META-INF/maven/"
+	pomSuffix = "/pom.properties"
+)
+
+// isPOM reports if path p of a JAR is Maven metadata.
+func isPOM(p string) bool {
+	return strings.HasPrefix(p, pomPrefix) && strings.HasSuffix(p, pomSuffix)
+}
+
+// parseProperties returns the properties of a Java properties file. Escapes
+// aren't interpreted, since Maven metadata doesn't need them.
+func parseProperties(r io.Reader) (map[string]string, error) {
+	props := map[string]string{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			continue
+		}
+		props[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// maxPOMSize bounds the bytes of Maven metadata read.
+const maxPOMSize = 1 << 20 // 1MiB
+
+// pomComponent records the component described by the Maven metadata at path
+// p with Config.Inventory, and evaluates the rules with a ComponentMatcher
+// against it.
+func (c *checker) pomComponent(p string, content []byte, props map[string]string) {
+	name := rootName(p, c.jmod)
+	coords := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, pomPrefix), pomSuffix), "/")
+	comp := Component{
+		Path:     strings.TrimSuffix(c.nested, "!"),
+		Group:    props["groupId"],
+		Artifact: props["artifactId"],
+		Version:  props["version"],
+	}
+	// Older Maven versions only record the coordinates in the path.
+	if comp.Group == "" && len(coords) == 2 {
+		comp.Group = coords[0]
+	}
+	if comp.Artifact == "" && len(coords) == 2 {
+		comp.Artifact = coords[1]
+	}
+	if comp.Artifact == "" {
+		return
+	}
+	if c.inventory {
+		c.components = append(c.components, comp)
+		c.evidence(p, -1, "component "+comp.Group+":"+comp.Artifact+":"+comp.Version+" in pom.properties")
+	}
+	if c.componentRules {
+		c.matchComponent(p, comp, content)
+	}
+}
+
+// manifestComponent records the component described by a manifest, used for
+// archives without Maven metadata.
+func (c *checker) manifestComponent(m *log4jManifest) {
+	comp := Component{Path: strings.TrimSuffix(c.nested, "!"), Artifact: m.title, Version: m.implVersion}
+	if comp.Artifact == "" {
+		comp.Artifact, comp.Version = m.symbolicName, m.bundleVersion
+	}
+	if comp.Artifact == "" {
+		return
+	}
+	if c.manifestComponents == nil {
+		c.manifestComponents = map[string]Component{}
+	}
+	c.manifestComponents[comp.Path] = comp
+}
+
+// hashArchive records the SHA-256 of the nested archive at path p, read from
+// ra.
+func (c *checker) hashArchive(p string, ra io.ReaderAt, size int64) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(ra, 0, size)); err != nil {
+		return err
+	}
+	if c.archiveHashes == nil {
+		c.archiveHashes = map[string]string{}
+	}
+	c.archiveHashes[c.nested+p] = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// componentList returns the components found, ordered by path then
+// coordinates. Archives identified by their manifest only are included if
+// they have no Maven metadata.
+func (c *checker) componentList() []Component {
+	components := append([]Component(nil), c.components...)
+	byPOM := map[string]bool{}
+	for _, comp := range components {
+		byPOM[comp.Path] = true
+	}
+	for p, comp := range c.manifestComponents {
+		if !byPOM[p] {
+			components = append(components, comp)
+		}
+	}
+	for i := range components {
+		components[i].SHA256 = c.archiveHashes[components[i].Path]
+	}
+	sort.Slice(components, func(i, j int) bool {
+		a, b := components[i], components[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Artifact != b.Artifact {
+			return a.Artifact < b.Artifact
+		}
+		return a.Version < b.Version
+	})
+	return components
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+func TestParseInventory(t *testing.T) {
+	guava := testjar.Zip(t, zip.Deflate,
+		testjar.File("META-INF/maven/com.google.guava/guava/pom.properties", "#Generated by Maven\ngroupId=com.google.guava\nartifactId=guava\nversion=31.0.1-jre\n"),
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\nBundle-SymbolicName: com.google.guava\nBundle-Version: 31.0.1.jre\n"),
+	)
+	guavaSum := sha256.Sum256(guava)
+	bundle := testjar.Zip(t, zip.Store,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\nBundle-SymbolicName: org.example.bundle;singleton:=true\nBundle-Version: 1.2.0\n"),
+	)
+	bundleSum := sha256.Sum256(bundle)
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want []Component
+	}{
+		{
+			name: "none",
+			fsys: fstest.MapFS{"org/example/App.class": &fstest.MapFile{}},
+		},
+		{
+			name: "manifest",
+			fsys: fstest.MapFS{
+				"META-INF/MANIFEST.MF": &fstest.MapFile{Data: []byte("Manifest-Version: 1.0\nImplementation-Title: app\nImplementation-Version: 2.0\n")},
+			},
+			want: []Component{{Artifact: "app", Version: "2.0"}},
+		},
+		{
+			name: "shaded",
+			fsys: fstest.MapFS{
+				"META-INF/maven/org.example/app/pom.properties":     &fstest.MapFile{Data: []byte("groupId=org.example\nartifactId=app\nversion=1.0\n")},
+				"META-INF/maven/org.example/shaded/pom.properties":  &fstest.MapFile{Data: []byte("version=3.1\n")},
+				"META-INF/MANIFEST.MF":                              &fstest.MapFile{Data: []byte("Manifest-Version: 1.0\nImplementation-Title: app\n")},
+				"META-INF/maven/org.example/invalid/pom.properties": &fstest.MapFile{Data: []byte("# empty\n")},
+			},
+			want: []Component{
+				{Group: "org.example", Artifact: "app", Version: "1.0"},
+				{Group: "org.example", Artifact: "invalid"},
+				{Group: "org.example", Artifact: "shaded", Version: "3.1"},
+			},
+		},
+		{
+			name: "nested",
+			fsys: fstest.MapFS{
+				"WEB-INF/lib/guava-31.0.1-jre.jar": &fstest.MapFile{Data: guava},
+				"WEB-INF/lib/bundle.jar":           &fstest.MapFile{Data: bundle},
+			},
+			want: []Component{
+				{Path: "WEB-INF/lib/bundle.jar", Artifact: "org.example.bundle", Version: "1.2.0", SHA256: hex.EncodeToString(bundleSum[:])},
+				{Path: "WEB-INF/lib/guava-31.0.1-jre.jar", Group: "com.google.guava", Artifact: "guava", Version: "31.0.1-jre", SHA256: hex.EncodeToString(guavaSum[:])},
+			},
+		},
+		{
+			// Nested archives after the classes are still read once the
+			// JAR is known to be vulnerable.
+			name: "vulnerable",
+			fsys: fstest.MapFS{
+				"META-INF/MANIFEST.MF": &fstest.MapFile{Data: []byte("Manifest-Version: 1.0\nMain-Class: org.example.App\n")},
+				"org/apache/logging/log4j/core/lookup/JndiLookup.class": &fstest.MapFile{},
+				"org/apache/logging/log4j/core/net/JndiManager.class":   &fstest.MapFile{},
+				"zz/guava.jar": &fstest.MapFile{Data: guava},
+			},
+			want: []Component{
+				{Path: "zz/guava.jar", Group: "com.google.guava", Artifact: "guava", Version: "31.0.1-jre", SHA256: hex.EncodeToString(guavaSum[:])},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{EnableRules: []string{RuleLog4j216Heuristic}, Inventory: true}
+			r, err := cfg.Parse(tc.fsys)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, r.Components); diff != "" {
+				t.Errorf("Parse() returned unexpected components (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseInventoryDisabled(t *testing.T) {
+	fsys := fstest.MapFS{
+		"META-INF/maven/org.example/app/pom.properties": &fstest.MapFile{Data: []byte("version=1.0\n")},
+	}
+	r, err := Parse(fsys)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if len(r.Components) != 0 {
+		t.Errorf("Parse() returned components %v without Config.Inventory, want none", r.Components)
+	}
+}
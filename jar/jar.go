@@ -19,11 +19,18 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/fs"
 	"path"
+	"runtime/debug"
 	"strings"
+	"time"
+
+	"log4jscanner/manifest"
 )
 
 const (
@@ -47,24 +54,326 @@ type Report struct {
 	// Note that this package considers the 2.15.0 versions vulnerable.
 	Vulnerable bool
 
+	// CVEs lists the vulnerabilities of the log4j version included in the JAR,
+	// such as CVE202144228. It's only set if Vulnerable is true.
+	CVEs []string
+
+	// Rules lists the IDs of the rules that matched, such as
+	// RuleLog4j44228Constructor.
+	Rules []string
+
+	// Log4j1 lists the IDs of the log4j 1.x rules that matched, also
+	// listed in Rules. Log4j 1.x is end of life, so these findings are
+	// remediated by migrating rather than upgrading.
+	Log4j1 []string
+
+	// Matches lists the classes each matched rule was derived from, in the
+	// order of Rules, so findings can be verified and deduplicated
+	// independently of the scanner.
+	Matches []Match
+
 	// MainClass and Version are information taken from the MANIFEST.MF file.
 	// Version indicates the version of JAR, NOT the log4j package.
 	MainClass string
 	Version   string
+
+	// ClassPath holds the entries of the Class-Path manifest attribute. These
+	// are URLs relative to the JAR's location that the JVM also loads.
+	ClassPath []string
+
+	// Index holds the JARs listed by the META-INF/INDEX.LIST jar index,
+	// other than the JAR itself. Like ClassPath, these are URLs relative to
+	// the JAR's location.
+	Index []string
+
+	// Bundle holds OSGi metadata from the MANIFEST.MF file. Eclipse and Karaf
+	// deployments identify artifacts by bundle rather than file name.
+	Bundle Bundle
+
+	// Provenance describes the build that produced the JAR.
+	Provenance Provenance
+
+	// SHA256 is the hex encoded SHA-256 of the JAR file. It's only set by a
+	// Walker with Hash enabled.
+	SHA256 string
+
+	// SpringBoot is set if the JAR is a Spring Boot executable JAR or WAR,
+	// laid out with BOOT-INF/ or recording Spring-Boot-Version, whose
+	// dependencies are nested archives such as
+	// "BOOT-INF/lib/log4j-core-2.14.1.jar" (see Artifacts). Its MainClass
+	// is Spring Boot's launcher, and StartClass the Start-Class header
+	// naming the application's main class.
+	SpringBoot bool
+	StartClass string
+
+	// Salvaged is set if the JAR, or an archive nested in it, was corrupt
+	// and only the entries recovered with Config.Salvage were scanned.
+	Salvaged bool
+
+	// Signed is set if the JAR is signed, holding a signature file and
+	// signature block in META-INF. Rewriting it removes its signature.
+	Signed bool
+
+	// Exploded is set if the report is of an exploded archive, a directory
+	// of loose files found by a Walker with Exploded enabled, rather than
+	// a JAR file.
+	Exploded bool
+
+	// Artifacts lists the copies of log4j-core found in the JAR, identified
+	// by their JNDI classes, with the version range each was inferred to
+	// be. Like Bridges, they may be incomplete for vulnerable JARs. See
+	// VersionRange for the range of the JAR as a whole.
+	Artifacts []Artifact
+
+	// Bridges lists the log4j bridges and adapters found in the JAR or the
+	// JARs nested within it, such as BridgeToSLF4J. They're context for
+	// remediation rather than vulnerabilities, see BridgeAdvice. Bridges may
+	// be incomplete for vulnerable JARs, which are only read until the
+	// vulnerability and Main-Class are found.
+	Bridges []string
+
+	// Components lists the Java libraries found in the JAR with
+	// Config.Inventory, ordered by path.
+	Components []Component
+
+	// Errors lists the entries that couldn't be scanned with
+	// Config.BestEffort, in the order they were found. Vulnerabilities
+	// within them may be missed.
+	Errors []EntryError
+
+	// Stats describes the work scanning the JAR took, to find artifacts
+	// that dominate the time of a scan.
+	Stats Stats
+}
+
+// Match is a class a matched rule was derived from.
+type Match struct {
+	// Rule is the ID of the rule, such as RuleLog4j44228Constructor.
+	Rule string
+	// Path is the class within the JAR, with nested archives separated by
+	// "!" like Evidence paths, such as
+	// "WEB-INF/lib/log4j-core-2.14.1.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class".
+	// For rules with a ComponentMatcher, it's the matched pom.properties
+	// instead.
+	Path string
+	// SHA256 is the hex encoded SHA-256 of the class file, or of the
+	// pom.properties.
+	SHA256 string
+}
+
+// Stats describes the work of scanning a JAR. Like Bridges, they only cover
+// what was read before a vulnerable JAR's scan finished.
+type Stats struct {
+	// MaxDepth is the deepest nesting of archives reached, 0 if no nested
+	// archive was read.
+	MaxDepth int
+	// NestedArchives counts the archives read within the JAR, at any
+	// depth, and InPlaceArchives those among them stored without
+	// compression, such as the BOOT-INF/lib JARs of Spring Boot, which
+	// were read in place from the file holding them rather than copied.
+	NestedArchives  int
+	InPlaceArchives int
+	// DecompressedBytes is the total size of the classes and nested
+	// archives decompressed.
+	DecompressedBytes int64
+	// Duration is how long the scan took.
+	Duration time.Duration
+}
+
+// Bundle contains OSGi headers from a JAR's manifest. Fields are empty if the
+// JAR isn't an OSGi bundle.
+type Bundle struct {
+	// SymbolicName is the Bundle-SymbolicName header, without directives.
+	SymbolicName string
+	// Version is the Bundle-Version header.
+	Version string
+	// ExportPackage lists the packages named by the Export-Package header.
+	ExportPackage []string
+}
+
+// Provenance holds metadata identifying the build that produced a JAR, so
+// remediation can be routed to the team owning that build. Fields are empty
+// if the JAR doesn't record them.
+type Provenance struct {
+	// Comment is the ZIP archive comment, which some build tools set.
+	Comment string
+	// BuiltBy, BuildJdk, and CreatedBy are manifest headers, such as
+	// "jenkins", "11.0.13", and "Apache Maven 3.8.4". BuildJdk falls back
+	// to Build-Jdk-Spec.
+	BuiltBy   string
+	BuildJdk  string
+	CreatedBy string
+	// BuildTime is the build timestamp header of the manifest, as written:
+	// Build-Time, Build-Date, Build-Timestamp, or Bnd-LastModified.
+	BuildTime string
+	// ManifestModified is the modification time of the manifest's ZIP
+	// entry, usually when the JAR was packaged. Reproducible builds set it
+	// to a fixed date.
+	ManifestModified time.Time
 }
 
 // Parse traverses a JAR file, attempting to detect any usages of vulnerable
-// log4j versions.
+// log4j versions. r may also be a directory, such as an exploded WAR opened
+// with os.DirFS, whose loose class files are checked like the entries of a
+// JAR.
 func Parse(r fs.FS) (*Report, error) {
-	var c checker
-	if err := c.checkJAR(&zipFS{r}, 0, 0); err != nil {
+	return defaultConfig.Parse(r)
+}
+
+// ParseContext is like Parse, but stops reading the JAR once ctx is done,
+// returning the context's error.
+func ParseContext(ctx context.Context, r fs.FS) (*Report, error) {
+	return defaultConfig.ParseContext(ctx, r)
+}
+
+// ParseReader is like Parse, but reads the JAR of the given size from ra,
+// such as an *os.File or an object read by range requests, rather than from
+// an archive opened by the caller. See Config.ParseReaderAt.
+func ParseReader(ra io.ReaderAt, size int64) (*Report, error) {
+	return defaultConfig.ParseReaderAt(context.Background(), ra, size)
+}
+
+// Parse traverses a JAR file like the Parse function, only evaluating the
+// rules enabled by the configuration.
+func (cfg *Config) Parse(r fs.FS) (*Report, error) {
+	return cfg.ParseContext(context.Background(), r)
+}
+
+// ParseContext is like Parse, but stops reading the JAR once ctx is done,
+// returning the context's error, or a *TimeoutError once the configured
+// Timeout has passed.
+func (cfg *Config) ParseContext(ctx context.Context, r fs.FS) (*Report, error) {
+	return cfg.parse(ctx, r, nil)
+}
+
+// ParseReaderAt is like ParseContext, but reads the JAR of the given size
+// from ra, such as an *os.File. Unlike a *zip.Reader passed to Parse, this
+// lets nested archives stored without compression, such as the BOOT-INF/lib
+// JARs of Spring Boot, be read in place rather than copied to memory or disk.
+// JMOD files are read too. Like ParseAny, ErrUnknownFormat is returned if ra
+// isn't a ZIP archive, and a *TruncatedError if it was cut short.
+func (cfg *Config) ParseReaderAt(ctx context.Context, ra io.ReaderAt, size int64) (*Report, error) {
+	ra, size = openJMOD(cfg.limitReaderAt(ra), size)
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		if cfg != nil && cfg.Salvage {
+			if s, serr := salvage(ra, size); serr == nil {
+				return cfg.parseSalvaged(ctx, s)
+			}
+		}
+		if err == zip.ErrFormat {
+			if err := CheckTruncated(ra, size); err != nil {
+				return nil, err
+			}
+			return nil, ErrUnknownFormat
+		}
+		return nil, fmt.Errorf("reading zip: %v", err)
+	}
+	return cfg.parse(ctx, zr, ra)
+}
+
+// ParseBuffered is like ParseReaderAt, but reads the JAR from a stream, such
+// as stdin. ZIP archives require random access, so the stream is buffered
+// like a compressed nested archive: in memory if it's no larger than
+// SpillThreshold and fits MemoryBudget, otherwise to a temporary file in
+// SpillDir, which is removed once scanned. Unlike ParseStream, the archive
+// is read through its central directory, as it is on disk.
+func (cfg *Config) ParseBuffered(ctx context.Context, r io.Reader) (*Report, error) {
+	c := cfg.newChecker()
+	c.ctx = ctx
+	ra, size, release, err := c.buffer(r, -1)
+	if err != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("buffering stream: %v", err)
+	}
+	defer release()
+	if f, ok := ra.(*spillFile); ok {
+		// ParseReaderAt paces its reads, so the spill file needn't.
+		ra = f.File
+	}
+	return cfg.ParseReaderAt(ctx, ra, size)
+}
+
+// parseSalvaged is like parse for what salvage recovered of an archive.
+func (cfg *Config) parseSalvaged(ctx context.Context, s *salvaged) (*Report, error) {
+	c := cfg.newChecker()
+	c.salvaged = true
+	c.errors = append(c.errors, s.lost...)
+	return cfg.check(ctx, &c, s.zr, s.ra)
+}
+
+// parse implements ParseContext and ParseReaderAt. ra, if provided, is the file read by r, so
+// nested archives stored without compression are read in place.
+func (cfg *Config) parse(ctx context.Context, r fs.FS, ra io.ReaderAt) (*Report, error) {
+	c := cfg.newChecker()
+	return cfg.check(ctx, &c, r, ra)
+}
+
+// parseDir checks the loose files of an exploded archive, r, like the
+// entries of a JAR. Unlike Parse, archives within the directory aren't
+// opened, since a walk scans them as files of their own.
+func (cfg *Config) parseDir(ctx context.Context, r fs.FS) (*Report, error) {
+	c := cfg.newChecker()
+	c.exploded = true
+	rep, err := cfg.check(ctx, &c, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	rep.Exploded = true
+	return rep, nil
+}
+
+// check implements parse and parseDir with the checker c.
+func (cfg *Config) check(ctx context.Context, c *checker, r fs.FS, ra io.ReaderAt) (rep *Report, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			rep, err = nil, &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	start := time.Now()
+	var cancel context.CancelFunc
+	c.ctx, cancel = cfg.timeout(ctx)
+	defer cancel()
+	if err := c.checkJAR(c.zipFSAt(r, ra), 0, 0); err != nil {
+		if err := c.failure(); err != nil {
+			return nil, err
+		}
+		if err := cfg.contextError(ctx, c.ctx); err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to check JAR: %v", err)
 	}
+	rep = c.report()
+	rep.Stats.Duration = time.Since(start)
+	return rep, nil
+}
+
+// report returns the outcome of a completed check.
+func (c *checker) report() *Report {
 	return &Report{
 		Vulnerable: c.bad(),
+		CVEs:       c.cves(),
+		Rules:      c.matched(),
+		Log4j1:     c.matchedLog4j1(),
+		Matches:    c.matches(),
 		MainClass:  c.mainClass,
+		SpringBoot: c.springBoot,
+		StartClass: c.startClass,
+		Signed:     c.signed,
+		Salvaged:   c.salvaged,
 		Version:    c.version,
-	}, nil
+		ClassPath:  c.classPath,
+		Index:      c.index,
+		Bundle:     c.bundle,
+		Provenance: c.provenance,
+		Bridges:    c.bridgeList(),
+		Artifacts:  c.artifactList(),
+		Components: c.componentList(),
+		Errors:     c.errors,
+		Stats:      c.stats,
+	}
 }
 
 // zipFS exists because of bugs hit in encoding/zip that causes reading "."
@@ -74,6 +383,105 @@ func Parse(r fs.FS) (*Report, error) {
 // See: https://go.dev/issue/50179
 type zipFS struct {
 	fs.FS
+	// encrypted holds the encrypted entries of a *zip.Reader, by name, and
+	// passwords the passwords tried to decrypt them.
+	encrypted map[string]*zip.File
+	passwords []string
+	// spill buffers encrypted entries while their password is confirmed.
+	spill spillConfig
+	// ra is the file holding the archive, if known, and stored its
+	// uncompressed entries that may be nested archives, by name, which are
+	// read in place rather than copied.
+	ra     io.ReaderAt
+	stored map[string]*zip.File
+	// jmod is set if ra is a JMOD file.
+	jmod bool
+}
+
+// zipFS wraps a JAR, decrypting its encrypted entries with the checker's
+// passwords. Entries are named by EntryName, so names that aren't UTF-8 can
+// be opened and are reported decoded.
+func (c *checker) zipFS(r fs.FS) *zipFS {
+	z := &zipFS{FS: r, passwords: c.passwords, spill: c.spill}
+	if zr := zipReader(r); zr != nil {
+		if decoded := decodeNames(zr); decoded != zr {
+			z.FS = decoded
+			zr = decoded
+		}
+		for _, f := range zr.File {
+			if f.Flags&flagEncrypted == 0 {
+				continue
+			}
+			if z.encrypted == nil {
+				z.encrypted = map[string]*zip.File{}
+			}
+			z.encrypted[f.Name] = f
+		}
+	}
+	return z
+}
+
+// zipFSAt wraps a JAR like zipFS, where ra is the file holding it, or nil
+// if unknown.
+func (c *checker) zipFSAt(r fs.FS, ra io.ReaderAt) *zipFS {
+	z := c.zipFS(r)
+	zr := zipReader(z.FS)
+	if ra == nil || zr == nil {
+		return z
+	}
+	z.ra = ra
+	_, z.jmod = ra.(*jmodFile)
+	for _, f := range zr.File {
+		if f.Method != zip.Store || f.Flags&flagEncrypted != 0 || !exts[path.Ext(f.Name)] {
+			continue
+		}
+		if z.stored == nil {
+			z.stored = map[string]*zip.File{}
+		}
+		z.stored[f.Name] = f
+	}
+	return z
+}
+
+// section returns the contents of an entry stored without compression, read
+// in place from the archive's file, or nil if it's compressed or the file
+// isn't known.
+func (z *zipFS) section(name string) *io.SectionReader {
+	f := z.stored[name]
+	if f == nil {
+		return nil
+	}
+	off, err := f.DataOffset()
+	if err != nil {
+		return nil
+	}
+	return io.NewSectionReader(z.ra, off, int64(f.UncompressedSize64))
+}
+
+// zipReader returns the ZIP archive underlying a filesystem, or nil if it
+// isn't one.
+func zipReader(r fs.FS) *zip.Reader {
+	switch zr := r.(type) {
+	case *zip.Reader:
+		return zr
+	case *zip.ReadCloser:
+		return &zr.Reader
+	}
+	return nil
+}
+
+// Open overrides the zip.Reader behavior to decrypt encrypted entries, which
+// zip.Reader can't open.
+func (z *zipFS) Open(name string) (fs.File, error) {
+	zf, ok := z.encrypted[name]
+	if !ok {
+		return z.FS.Open(name)
+	}
+	rc, err := openEncrypted(zf, z.passwords, z.spill)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptFile{info: zf.FileInfo(), rc: rc}, nil
 }
 
 // ReadDir overrides the buggy zip.Reader behavior and removes any DirEntry
@@ -97,6 +505,42 @@ func (z *zipFS) ReadDir(name string) ([]fs.DirEntry, error) {
 }
 
 type checker struct {
+	// ctx ends the check once it's done, see Config.ParseContext.
+	ctx context.Context
+	// rules holds the IDs of the rules to evaluate.
+	rules map[string]bool
+	// explanation, if set, collects evidence and disables short circuiting
+	// once the JAR is known to be vulnerable.
+	explanation *Explanation
+	// nested is the path of the archive being checked within the outermost
+	// JAR, such as "lib/inner.jar!", used for evidence.
+	nested string
+	// jmod is set while the entries of a JMOD file are checked, see
+	// rootName.
+	jmod bool
+	// spill configures how large nested archives are read.
+	spill spillConfig
+	// passwords decrypt encrypted entries.
+	passwords []string
+	// limits bound the bytes decompressed, and bomb is set once the
+	// archive exceeded them, see ErrZipBomb.
+	limits bombLimits
+	bomb   *zipBombError
+	// bestEffort records the entries that can't be scanned in errors,
+	// rather than failing the check with the first of them, failed.
+	bestEffort bool
+	errors     []EntryError
+	failed     *EntryError
+	// salvage recovers corrupt archives, and salvaged is set once one was,
+	// see Config.Salvage.
+	salvage  bool
+	salvaged bool
+	// exploded is set when checking the loose files of a directory, see
+	// Config.parseDir.
+	exploded bool
+	// skipped is set once entries were skipped since the JAR was decided.
+	skipped bool
+
 	// Does the JAR contain the JNDI lookup class?
 	hasLookupClass bool
 	// Does the JAR contain JndiManager with the old constructor, a
@@ -105,29 +549,199 @@ type checker struct {
 	// Does the jar contain a string that was added in 2.16 and whether we've checked for it yet
 	seenJndiManagerClass   bool
 	isAtLeastTwoDotSixteen bool
+	// Does the JAR contain the JDBC appender's DataSourceConnectionSource,
+	// and a JndiManager with the isJndiJdbcEnabled method added in 2.17.1?
+	hasDataSourceConnectionSource bool
+	hasJndiJdbcCheck              bool
+	// The classes the rules matched, see Report.Matches. managerClass is
+	// the last JndiManager read, which the flags above describe.
+	lookupClass     *Match
+	oldManagerClass *Match
+	managerClass    *Match
+	dataSourceClass *Match
+	// matcherClasses holds the classes matched by rules with a Matcher,
+	// and the Maven metadata matched by rules with a ComponentMatcher,
+	// such as custom rules, by ID.
+	matcherClasses map[string]*Match
+	// componentRules reports if any enabled rule has a ComponentMatcher.
+	componentRules bool
 
 	mainClass string
 	version   string
+	// springBoot is set by Spring Boot's layout or manifest, see
+	// Report.SpringBoot.
+	springBoot bool
+	startClass string
+	// signed is set at depth 0, see Report.Signed.
+	signed    bool
+	classPath []string
+	index     []string
+	bundle    Bundle
+	// provenance is only collected from the outermost JAR.
+	provenance Provenance
+	// bridges holds the detected bridges, and if each was identified by
+	// its Maven metadata.
+	bridges map[string]bool
+	stats   Stats
+	// artifacts holds the state of each copy of log4j, by the path of the
+	// archive holding it within the outermost JAR.
+	artifacts map[string]*artifactState
+	// inventory collects the components of the JAR, disabling short
+	// circuiting once the JAR is decided: components holds those found
+	// by their Maven metadata, manifestComponents those found by their
+	// manifest, and archiveHashes the SHA-256 of nested archives, by
+	// path.
+	inventory          bool
+	components         []Component
+	manifestComponents map[string]Component
+	archiveHashes      map[string]string
 }
 
+// done reports if reading more of the JAR can't change the report.
 func (c *checker) done() bool {
-	return c.bad() && c.mainClass != ""
+	return c.decided() && c.mainClass != "" && !c.inventory
 }
 
+// bad reports if any enabled rule matched.
 func (c *checker) bad() bool {
-	return (c.hasLookupClass && c.hasOldJndiManagerConstructor) || (c.hasLookupClass && c.seenJndiManagerClass && !c.isAtLeastTwoDotSixteen)
+	for _, r := range Rules {
+		if c.match(r.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// decided reports if reading more classes can't change the report, since
+// every enabled rule matched.
+func (c *checker) decided() bool {
+	if c.explanation != nil {
+		return false
+	}
+	for id := range c.rules {
+		if !c.match(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports if an enabled rule matched.
+func (c *checker) match(rule string) bool {
+	if !c.rules[rule] {
+		return false
+	}
+	switch rule {
+	case RuleLog4j44228Constructor:
+		return c.hasLookupClass && c.hasOldJndiManagerConstructor
+	case RuleLog4j216Heuristic:
+		return c.hasLookupClass && c.seenJndiManagerClass && !c.isAtLeastTwoDotSixteen
+	case RuleLog4j44832JDBC:
+		return c.hasDataSourceConnectionSource && c.seenJndiManagerClass && !c.hasJndiJdbcCheck
+	}
+	return c.matcherClasses[rule] != nil
+}
+
+// matched returns the IDs of the rules that matched.
+func (c *checker) matched() []string {
+	var ids []string
+	for _, r := range Rules {
+		if c.match(r.ID) {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// matchedLog4j1 returns the IDs of the log4j 1.x rules that matched.
+func (c *checker) matchedLog4j1() []string {
+	var ids []string
+	for _, r := range Rules {
+		if r.Log4j1 && c.match(r.ID) {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// matches returns the classes of the rules that matched.
+func (c *checker) matches() []Match {
+	var matches []Match
+	for _, r := range Rules {
+		if !c.match(r.ID) {
+			continue
+		}
+		var classes []*Match
+		switch r.ID {
+		case RuleLog4j44228Constructor:
+			classes = []*Match{c.lookupClass, c.oldManagerClass}
+		case RuleLog4j216Heuristic:
+			classes = []*Match{c.lookupClass, c.managerClass}
+		case RuleLog4j44832JDBC:
+			classes = []*Match{c.dataSourceClass, c.managerClass}
+		default:
+			classes = []*Match{c.matcherClasses[r.ID]}
+		}
+		for _, m := range classes {
+			if m != nil {
+				matches = append(matches, Match{Rule: r.ID, Path: m.Path, SHA256: m.SHA256})
+			}
+		}
+	}
+	return matches
+}
+
+// classMatch returns the Match of a class a rule may be derived from, without
+// its rule.
+func (c *checker) classMatch(p string, content []byte) *Match {
+	sum := sha256.Sum256(content)
+	return &Match{Path: c.nested + p, SHA256: hex.EncodeToString(sum[:])}
+}
+
+// cves returns the vulnerabilities matched by the checker.
+func (c *checker) cves() []string {
+	var cves []string
+	seen := map[string]bool{}
+	for _, r := range Rules {
+		if c.match(r.ID) && !seen[r.CVE] {
+			seen[r.CVE] = true
+			cves = append(cves, r.CVE)
+		}
+	}
+	return cves
 }
 
 func (c *checker) checkJAR(r fs.FS, depth int, size int64) error {
 	if depth > maxZipDepth {
 		return fmt.Errorf("reached max zip depth of %d", maxZipDepth)
 	}
+	if depth > 0 {
+		c.stats.NestedArchives++
+	}
+	if depth > c.stats.MaxDepth {
+		c.stats.MaxDepth = depth
+	}
+
+	if z, ok := r.(*zipFS); ok && depth == 0 {
+		if zr := zipReader(z.FS); zr != nil {
+			c.provenance.Comment = zr.Comment
+		}
+		c.signed = signed(r)
+	}
+	jmod := c.jmod
+	z, ok := r.(*zipFS)
+	c.jmod = ok && z.jmod
+	defer func() { c.jmod = jmod }()
 
 	err := fs.WalkDir(r, ".", func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
+			return c.entryError(p, ErrCorruptEntry, err)
+		}
+		if err := c.ctx.Err(); err != nil {
 			return err
 		}
 		if c.done() {
+			c.skipped = true
 			if d.IsDir() {
 				return fs.SkipDir
 			}
@@ -137,119 +751,480 @@ func (c *checker) checkJAR(r fs.FS, depth int, size int64) error {
 		if !d.Type().IsRegular() {
 			return nil
 		}
-		if strings.HasSuffix(p, ".class") {
-			// Same logic as http://google3/security/tools/seam/cli/log4j_check.py
-			if c.bad() {
-				// Already determined that the content is bad, no
-				// need to check more.
-				return nil
-			}
-
-			f, err := r.Open(p)
-			if err != nil {
-				return fmt.Errorf("opening file %s: %v", p, err)
-			}
-			defer f.Close()
+		return c.checkEntry(r, p, d, depth, size)
+	})
+	if err != nil {
+		return err
+	}
+	c.checkMitigations(r)
+	return nil
+}
 
-			info, err := f.Stat()
-			if err != nil {
-				return fmt.Errorf("stat file %s: %v", p, err)
-			}
-			var r io.Reader = f
-			if fsize := info.Size(); fsize > 0 {
-				if fsize+size > maxZipSize {
-					return fmt.Errorf("reading %s would exceed memory limit: %v", p, err)
-				}
-				r = io.LimitReader(f, fsize)
-			}
+// isManifest reports whether the entry at path p of the archive r, whose
+// name is as in rootName, is the JAR's manifest. Some build tools write it as
+// a case variant of META-INF/MANIFEST.MF, which the JVM falls back to if the
+// archive has no entry of the exact name.
+func (c *checker) isManifest(r fs.FS, p, name string) bool {
+	if name == manifest.Path {
+		return true
+	}
+	if !strings.EqualFold(name, manifest.Path) {
+		return false
+	}
+	_, err := fs.Stat(r, p[:len(p)-len(name)]+manifest.Path)
+	return err != nil
+}
 
-			content, err := io.ReadAll(r)
-			if err != nil {
-				return fmt.Errorf("reading file %s: %v", p, err)
-			}
-			if !c.hasLookupClass {
-				if strings.Contains(p, "JndiLookup.class") {
-					c.hasLookupClass = true
-				}
-			}
-			if !c.hasOldJndiManagerConstructor {
-				c.hasOldJndiManagerConstructor = strings.Contains(p, "JndiManager") && matchesLog4JYARARule(content)
-			}
-			if strings.Contains(p, "JndiManager.class") {
-				c.seenJndiManagerClass = true
-				c.isAtLeastTwoDotSixteen = matchesTwoSixteen(content)
-			}
+// checkEntry checks the regular file at path p of the archive r, at the given
+// depth of nesting, where size is the memory held by the archive and its
+// parents.
+func (c *checker) checkEntry(r fs.FS, p string, d fs.DirEntry, depth int, size int64) error {
+	if depth == 0 && strings.HasPrefix(p, "BOOT-INF/") {
+		c.springBoot = true
+	}
+	name := rootName(p, c.jmod)
+	if b := bridgeOf(name); b != "" {
+		c.bridge(p, b)
+	}
+	if strings.HasSuffix(p, ".class") {
+		// Same logic as http://google3/security/tools/seam/cli/log4j_check.py
+		if c.decided() {
+			// Already determined that the content is bad, no
+			// need to check more.
+			c.skipped = true
 			return nil
 		}
-		if p == "META-INF/MANIFEST.MF" {
-			mf, err := r.Open(p)
-			if err != nil {
-				return fmt.Errorf("opening manifest file %s: %v", p, err)
-			}
-			defer mf.Close()
-			s := bufio.NewScanner(mf)
-			for s.Scan() {
-				// Use s.Bytes instead of s.Text to avoid a string allocation.
-				b := s.Bytes()
-				// Use IndexByte directly instead of strings.Split to avoid allocating a return slice.
-				i := bytes.IndexByte(b, ':')
-				if i < 0 {
-					continue
-				}
-				k, v := b[:i], b[i+1:]
-				if bytes.IndexByte(v, ':') >= 0 {
-					continue
-				}
-				if string(k) == "Main-Class" {
-					c.mainClass = strings.TrimSpace(string(v))
-				} else if string(k) == "Implementation-Version" {
-					c.version = strings.TrimSpace(string(v))
-				}
-			}
-			if err := s.Err(); err != nil {
-				return fmt.Errorf("scanning manifest file %s: %v", p, err)
+
+		f, err := r.Open(p)
+		if err != nil {
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("opening file: %v", err))
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("stat file: %v", err))
+		}
+		var r io.Reader = f
+		if fsize := info.Size(); fsize > 0 {
+			if fsize+size > maxZipSize {
+				return c.entryError(p, ErrTooLarge, fmt.Errorf("reading %d bytes would exceed memory limit", fsize))
 			}
-			return nil
+			// One more byte than declared is read, to detect
+			// entries holding more than they declare.
+			r = io.LimitReader(f, fsize+1)
+		}
+		if r, err = c.inflate(p, r, info); err != nil {
+			return err
 		}
 
-		// Scan for jars within jars.
-		if !exts[path.Ext(p)] {
-			return nil
+		buf, err := readClass(r)
+		if err != nil {
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("reading file: %v", err))
 		}
-		// We've found a jar in a jar. Open it!
-		fi, err := d.Info()
+		defer releaseClass(buf)
+		content := buf.Bytes()
+		c.stats.DecompressedBytes += int64(len(content))
+		c.checkClass(p, content)
+		return nil
+	}
+	if name == log4jCorePOM || ((c.inventory || c.componentRules) && isPOM(name)) {
+		f, err := r.Open(p)
 		if err != nil {
-			return fmt.Errorf("failed to get archive inside of archive %s: %v", p, err)
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("opening maven metadata: %v", err))
 		}
-		// If we're about to read more than the max size we've configure ahead of time then stop.
-		// Note that this only applies to embedded ZIPs/JARs. The outer ZIP/JAR can still be larger than the limit.
-		if size+fi.Size() > maxZipSize {
-			return fmt.Errorf("archive inside archive at %q is greater than 4GB, skipping", p)
+		defer f.Close()
+		content, err := io.ReadAll(io.LimitReader(f, maxPOMSize))
+		if err != nil {
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("reading maven metadata: %v", err))
 		}
+		props, err := parseProperties(bytes.NewReader(content))
+		if err != nil {
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("scanning maven metadata: %v", err))
+		}
+		if name == log4jCorePOM {
+			c.pomVersion(p, props["version"])
+		}
+		c.pomComponent(p, content, props)
+		return nil
+	}
+	if name == "META-INF/INDEX.LIST" && depth == 0 {
 		f, err := r.Open(p)
 		if err != nil {
-			return fmt.Errorf("open file %s: %v", p, err)
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("opening jar index: %v", err))
 		}
 		defer f.Close()
-		data, err := io.ReadAll(f)
+		if c.index, err = parseIndexList(f); err != nil {
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("scanning jar index: %v", err))
+		}
+		return nil
+	}
+	if c.isManifest(r, p, name) {
+		if depth == 0 {
+			if info, err := d.Info(); err == nil {
+				c.provenance.ManifestModified = info.ModTime().UTC()
+			}
+		}
+		mf, err := r.Open(p)
 		if err != nil {
-			return fmt.Errorf("read file %s: %v", p, err)
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("opening manifest file: %v", err))
 		}
-		br := bytes.NewReader(data)
-		r2, err := zip.NewReader(br, br.Size())
+		defer mf.Close()
+		m, err := manifest.Parse(mf)
 		if err != nil {
-			if err == zip.ErrFormat {
-				// Not a zip file.
-				return nil
-			}
-			return fmt.Errorf("parsing file %s: %v", p, err)
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("scanning manifest file: %v", err))
 		}
-		if err := c.checkJAR(&zipFS{r2}, depth+1, size+fi.Size()); err != nil {
-			return fmt.Errorf("checking sub jar %s: %v", p, err)
+		log4j := newLog4jManifest(m.Main)
+		c.manifestAttrs(p, m.Main, depth)
+		c.manifestVersion(p, &log4j)
+		if c.inventory {
+			c.manifestComponent(&log4j)
 		}
 		return nil
-	})
-	return err
+	}
+
+	// Scan for jars within jars, and containers of jars.
+	if !hasNestedExt(p) || (c.exploded && depth == 0) {
+		return nil
+	}
+	// We've found a jar in a jar. Open it!
+	if depth+1 > maxZipDepth {
+		return c.entryError(p, ErrTooDeep, fmt.Errorf("reached max zip depth of %d", maxZipDepth))
+	}
+	fi, err := d.Info()
+	if err != nil {
+		return c.entryError(p, ErrCorruptEntry, fmt.Errorf("failed to get archive inside of archive: %v", err))
+	}
+	f, err := r.Open(p)
+	if err != nil {
+		return c.entryError(p, ErrCorruptEntry, fmt.Errorf("open file: %v", err))
+	}
+	defer f.Close()
+	ir, err := c.inflate(p, f, fi)
+	if err != nil {
+		return err
+	}
+	nr := &ctxReader{c.ctx, ir}
+
+	// Archives stored without compression are read in place from
+	// the file holding this JAR, if it's known. Otherwise archives
+	// that would take the memory held by this JAR and its parents
+	// over the threshold, or that don't fit in the shared memory
+	// budget, are spilled to disk. Note that this only applies to
+	// embedded ZIPs/JARs. The outer ZIP/JAR is never read into
+	// memory.
+	var (
+		ra      io.ReaderAt
+		raSize  int64
+		memSize = size
+	)
+	var sr *io.SectionReader
+	if z, ok := r.(*zipFS); ok {
+		sr = z.section(p)
+	}
+	if sr != nil {
+		ra, raSize = sr, sr.Size()
+		c.stats.InPlaceArchives++
+	} else if size+fi.Size() > c.spill.threshold() || !c.spill.budget.reserve(fi.Size()) {
+		tf, n, err := c.spill.file(nr, fi.Size())
+		if err != nil {
+			return fmt.Errorf("spilling archive inside archive %s: %v", p, err)
+		}
+		defer tf.Close()
+		ra, raSize = tf, n
+		c.stats.DecompressedBytes += n
+	} else {
+		defer c.spill.budget.release(fi.Size())
+		data, err := io.ReadAll(nr)
+		if err != nil {
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("read file: %v", err))
+		}
+		ra, raSize = bytes.NewReader(data), int64(len(data))
+		memSize += fi.Size()
+		c.stats.DecompressedBytes += raSize
+	}
+	if !exts[path.Ext(p)] {
+		// A container, such as a tar archive.
+		nested := c.nested
+		c.nested += p + "!"
+		err := c.checkAny(ra, raSize, depth+1, memSize, false)
+		c.nested = nested
+		switch {
+		case err == errUnsupportedCompression:
+			return c.entryError(p, ErrCorruptEntry, err)
+		case err != nil && err != ErrUnknownFormat:
+			return fmt.Errorf("checking sub archive %s: %v", p, err)
+		}
+		return nil
+	}
+	zra, zsize := openJMOD(ra, raSize)
+	r2, err := zip.NewReader(zra, zsize)
+	if err != nil && c.salvage {
+		if s, serr := salvage(zra, zsize); serr == nil {
+			r2, zra, err = s.zr, s.ra, nil
+			c.salvaged = true
+			for _, e := range s.lost {
+				c.entryError(p+"!"+e.Path, e.Kind, e.Err)
+			}
+		}
+	}
+	if err != nil {
+		if err == zip.ErrFormat {
+			// Not a zip file.
+			return nil
+		}
+		return c.entryError(p, ErrCorruptEntry, fmt.Errorf("parsing file: %v", err))
+	}
+	if c.inventory {
+		if err := c.hashArchive(p, ra, raSize); err != nil {
+			return c.entryError(p, ErrCorruptEntry, fmt.Errorf("hashing file: %v", err))
+		}
+	}
+	nested := c.nested
+	c.nested += p + "!"
+	err = c.checkJAR(c.zipFSAt(r2, zra), depth+1, memSize)
+	c.nested = nested
+	if err != nil {
+		return fmt.Errorf("checking sub jar %s: %v", p, err)
+	}
+	return nil
+}
+
+// checkClass evaluates the rules against a class at path p with content.
+// Rules match the class by its name at the root of a plain JAR, see
+// rootName, while evidence names its path.
+func (c *checker) checkClass(p string, content []byte) {
+	name := rootName(p, c.jmod)
+	lookup, manager, byContent := log4jClass(name, content)
+	how := ""
+	if byContent {
+		how = ", identified by its contents"
+	}
+	if lookup {
+		c.artifact().lookup = true
+		if c.lookupClass == nil {
+			c.lookupClass = c.classMatch(p, content)
+		}
+		if !c.hasLookupClass || c.explanation != nil {
+			c.hasLookupClass = true
+			c.evidence(p, -1, "JndiLookup class present"+how)
+		}
+	}
+	if strings.HasSuffix(name, "/DataSourceConnectionSource.class") && c.rules[RuleLog4j44832JDBC] {
+		c.artifact().dataSource = true
+		if c.dataSourceClass == nil {
+			c.dataSourceClass = c.classMatch(p, content)
+		}
+		if !c.hasDataSourceConnectionSource || c.explanation != nil {
+			c.hasDataSourceConnectionSource = true
+			c.evidence(p, -1, "JDBC appender DataSourceConnectionSource class present")
+		}
+	}
+	if manager || strings.Contains(name, "JndiManager") {
+		// Each copy of log4j is checked, for its version range.
+		if a := c.artifact(); !a.oldConstructor || c.explanation != nil {
+			if i := indexLog4JYARARule(content); i >= 0 {
+				a.oldConstructor = true
+				c.hasOldJndiManagerConstructor = true
+				if c.oldManagerClass == nil {
+					c.oldManagerClass = c.classMatch(p, content)
+				}
+				c.evidence(p, int64(i), "JndiManager constructor taking a javax.naming.Context, removed in 2.15.0")
+			}
+		}
+	}
+	if manager {
+		c.seenJndiManagerClass = true
+		c.managerClass = c.classMatch(p, content)
+		i := bytes.Index(content, log4j216Detector)
+		c.isAtLeastTwoDotSixteen = i >= 0
+		a := c.artifact()
+		a.seenManager, a.isJndiEnabled = true, i >= 0
+		if c.rules[RuleLog4j44832JDBC] {
+			j := bytes.Index(content, log4j2171Detector)
+			c.hasJndiJdbcCheck = j >= 0
+			a.jndiJdbcCheck = j >= 0
+			if j >= 0 {
+				c.evidence(p, int64(j), "isJndiJdbcEnabled method present, added in 2.17.1")
+			} else {
+				c.evidence(p, -1, "isJndiJdbcEnabled method absent, added in 2.17.1")
+			}
+		}
+		if i >= 0 {
+			c.evidence(p, int64(i), "isJndiEnabled method present, added in 2.16.0")
+		} else {
+			c.evidence(p, -1, "isJndiEnabled method absent, added in 2.16.0")
+		}
+	}
+	if strings.HasSuffix(name, "/pattern/MessagePatternConverter.class") {
+		c.converter(p, content)
+	}
+	c.matchClass(p, name, content)
+}
+
+// matchClass evaluates the enabled rules with a Matcher against a class at
+// path p, named name.
+func (c *checker) matchClass(p, name string, content []byte) {
+	for _, r := range Rules {
+		if r.Matcher == nil || !c.rules[r.ID] || (c.matcherClasses[r.ID] != nil && c.explanation == nil) {
+			continue
+		}
+		i := r.Matcher.Match(name, content)
+		if i < 0 {
+			continue
+		}
+		if c.matcherClasses == nil {
+			c.matcherClasses = map[string]*Match{}
+		}
+		if c.matcherClasses[r.ID] == nil {
+			c.matcherClasses[r.ID] = c.classMatch(p, content)
+		}
+		c.evidence(p, int64(i), "matched rule "+r.ID)
+	}
+}
+
+// matchComponent evaluates the enabled rules with a ComponentMatcher against
+// the component described by the Maven metadata at path p.
+func (c *checker) matchComponent(p string, comp Component, content []byte) {
+	for _, r := range Rules {
+		if r.ComponentMatcher == nil || !c.rules[r.ID] || (c.matcherClasses[r.ID] != nil && c.explanation == nil) {
+			continue
+		}
+		if !r.ComponentMatcher.MatchComponent(comp) {
+			continue
+		}
+		if c.matcherClasses == nil {
+			c.matcherClasses = map[string]*Match{}
+		}
+		if c.matcherClasses[r.ID] == nil {
+			c.matcherClasses[r.ID] = c.classMatch(p, content)
+		}
+		c.evidence(p, -1, "matched rule "+r.ID+" by "+comp.Group+":"+comp.Artifact+":"+comp.Version)
+	}
+}
+
+// parseIndexList returns the JARs listed by a jar index, other than the
+// indexed JAR itself. The index is a header followed by a section per JAR,
+// separated by blank lines, each starting with the JAR's path:
+//
+//	JarIndex-Version: 1.0
+//
+//	app.jar
+//	com/example/app
+//
+//	lib/log4j-core.jar
+//	org/apache/logging/log4j/core
+func parseIndexList(r io.Reader) ([]string, error) {
+	var (
+		jars    []string
+		header  = true
+		section = false
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+			header, section = false, false
+		case header:
+		case !section:
+			jars = append(jars, line)
+			section = true
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(jars) <= 1 {
+		return nil, nil
+	}
+	// The first section describes the indexed JAR itself.
+	return jars[1:], nil
+}
+
+// manifestAttrs records the attributes of the main section of the manifest
+// at path p.
+func (c *checker) manifestAttrs(p string, attrs manifest.Attributes, depth int) {
+	// Values holding a colon aren't class names or versions.
+	if v := attrs.Get("Main-Class"); v != "" && !strings.Contains(v, ":") {
+		c.mainClass = v
+		c.evidence(p, -1, "Main-Class: "+v)
+	}
+	if v := attrs.Get("Implementation-Version"); v != "" && !strings.Contains(v, ":") {
+		c.version = v
+		c.evidence(p, -1, "Implementation-Version: "+v)
+	}
+
+	// The remaining attributes describe how the JVM or an OSGi framework
+	// loads the JAR, which only applies to the outermost JAR.
+	if depth != 0 {
+		return
+	}
+	if v, ok := attrs.Lookup("Class-Path"); ok {
+		c.classPath = strings.Fields(v)
+	}
+	if v, ok := attrs.Lookup("Bundle-SymbolicName"); ok {
+		// Strip directives, such as "org.example;singleton:=true".
+		c.bundle.SymbolicName, _ = splitClause(v)
+	}
+	if v, ok := attrs.Lookup("Start-Class"); ok {
+		c.startClass = v
+		c.springBoot = true
+	}
+	if _, ok := attrs.Lookup("Spring-Boot-Version"); ok {
+		c.springBoot = true
+	}
+	c.bundle.Version = attrs.Get("Bundle-Version")
+	c.provenance.BuiltBy = attrs.Get("Built-By")
+	c.provenance.BuildJdk = attrs.Get("Build-Jdk")
+	if c.provenance.BuildJdk == "" {
+		c.provenance.BuildJdk = attrs.Get("Build-Jdk-Spec")
+	}
+	c.provenance.CreatedBy = attrs.Get("Created-By")
+	for _, k := range []string{"Build-Time", "Build-Date", "Build-Timestamp", "Bnd-LastModified"} {
+		if v := attrs.Get(k); v != "" {
+			c.provenance.BuildTime = v
+			break
+		}
+	}
+	if v, ok := attrs.Lookup("Export-Package"); ok {
+		c.bundle.ExportPackage = nil
+		for _, clause := range splitClauses(v) {
+			if pkg, _ := splitClause(clause); pkg != "" {
+				c.bundle.ExportPackage = append(c.bundle.ExportPackage, pkg)
+			}
+		}
+	}
+}
+
+// splitClauses splits an OSGi header into its comma separated clauses,
+// ignoring commas within quoted parameters such as uses:="a,b".
+func splitClauses(s string) []string {
+	var (
+		clauses []string
+		quoted  bool
+		start   int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				clauses = append(clauses, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(clauses, s[start:])
+}
+
+// splitClause returns the path of an OSGi header clause, and its parameters.
+func splitClause(clause string) (path, params string) {
+	if i := strings.IndexByte(clause, ';'); i >= 0 {
+		return strings.TrimSpace(clause[:i]), clause[i+1:]
+	}
+	return strings.TrimSpace(clause), ""
 }
 
 var (
@@ -287,30 +1262,37 @@ var (
 	// Since this is so brittle, we're keeping the above rule that can reliably and
 	// non-brittle-ey detect <2.15 as a back up.
 	log4j216Detector = []byte("isJndiEnabled")
+
+	// In 2.17.1 the JDBC appender only looks up data sources through JNDI
+	// if the JndiManager method `isJndiJdbcEnabled` allows it, fixing
+	// CVE-2021-44832.
+	log4j2171Detector = []byte("isJndiJdbcEnabled")
 )
 
 func matchesLog4JYARARule(b []byte) bool {
+	return indexLog4JYARARule(b) >= 0
+}
+
+// indexLog4JYARARule returns the offset of the first match of the YARA rule,
+// or -1.
+func indexLog4JYARARule(b []byte) int {
 	start := 0
 	for {
 		i := bytes.Index(b[start:], log4JYARAPrefix)
 		if i < 0 {
-			return false
+			return -1
 		}
 		n := i + len(log4JYARAPrefix)
 		if len(b) <= n {
-			return false
+			return -1
 		}
 		j := bytes.Index(b[n:], log4JYARASuffix)
 		if j < 0 {
-			return false
+			return -1
 		}
 		if (j - i) <= 3 {
-			return true
+			return start + i
 		}
 		start = i + len(log4JYARAPrefix)
 	}
 }
-
-func matchesTwoSixteen(b []byte) bool {
-	return bytes.Contains(b, log4j216Detector)
-}
@@ -16,8 +16,17 @@ package jar
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
 )
 
 var testdataPath = func(p string) string {
@@ -78,6 +87,182 @@ func TestParse(t *testing.T) {
 	}
 }
 
+// unzip extracts the archive src into the directory dest, like an
+// application server exploding a WAR.
+func unzip(t *testing.T, dest, src string) {
+	t.Helper()
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		p := filepath.Join(dest, filepath.FromSlash(f.Name))
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatalf("creating directory: %v", err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("creating directory: %v", err)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		if err := os.WriteFile(p, b, 0644); err != nil {
+			t.Fatalf("writing %s: %v", p, err)
+		}
+	}
+}
+
+func TestParseDirectory(t *testing.T) {
+	testCases := []struct {
+		filename string
+		wantBad  bool
+	}{
+		{"arara.jar", true},
+		{"arara.jar.patched", false},
+		{"log4j-core-2.14.0.jar", true},
+		{"log4j-core-2.14.0.jar.patched", false},
+		{"log4j-core-2.16.0.jar", false},
+		{"similarbutnotvuln.jar", false},
+		{"vuln-class.jar", true},
+		{"bad_jar_in_jar.jar", true},
+		{"good_jar_in_jar.jar", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			dir := t.TempDir()
+			unzip(t, dir, testdataPath(tc.filename))
+			report, err := Parse(os.DirFS(dir))
+			if err != nil {
+				t.Fatalf("Parse() returned an unexpected error, got %v, want nil", err)
+			}
+			if got := report.Vulnerable; tc.wantBad != got {
+				t.Errorf("Parse() returned unexpected value, got bad=%t, want bad=%t", got, tc.wantBad)
+			}
+		})
+	}
+}
+
+// springBootJAR returns a Spring Boot executable JAR holding log4j-core
+// 2.14.0 under BOOT-INF/lib, stored without compression like Spring Boot's
+// build plugins do, after an optional launch script.
+func springBootJAR(t *testing.T, script string) []byte {
+	t.Helper()
+	lib, err := os.ReadFile(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatalf("reading testdata: %v", err)
+	}
+	b := bytes.NewBufferString(script)
+	zw := zip.NewWriter(b)
+	zw.SetOffset(int64(len(script)))
+	for _, f := range []struct {
+		name, content string
+		method        uint16
+	}{
+		{"BOOT-INF/classes/com/example/App.class", "class", zip.Deflate},
+		{"BOOT-INF/lib/log4j-core-2.14.0.jar", string(lib), zip.Store},
+		{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0\r\n" +
+			"Main-Class: org.springframework.boot.loader.JarLauncher\r\n" +
+			"Start-Class: com.example.App\r\n" +
+			"Spring-Boot-Version: 2.6.1\r\n", zip.Deflate},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: f.method})
+		if err != nil {
+			t.Fatalf("creating %s: %v", f.name, err)
+		}
+		if _, err := io.WriteString(w, f.content); err != nil {
+			t.Fatalf("writing %s: %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestParseSpringBoot(t *testing.T) {
+	for _, script := range []string{"", "#!/bin/bash\nexec java -jar \"$0\" \"$@\"\nexit 0\n"} {
+		data := springBootJAR(t, script)
+		ra := bytes.NewReader(data)
+		report, err := (&Config{}).ParseReaderAt(context.Background(), ra, ra.Size())
+		if err != nil {
+			t.Fatalf("ParseReaderAt() failed: %v", err)
+		}
+		if !report.Vulnerable || !report.SpringBoot {
+			t.Errorf("ParseReaderAt() returned vulnerable=%t, spring boot=%t, want true", report.Vulnerable, report.SpringBoot)
+		}
+		if got, want := report.StartClass, "com.example.App"; got != want {
+			t.Errorf("ParseReaderAt() returned start class %q, want %q", got, want)
+		}
+		var paths []string
+		for _, a := range report.Artifacts {
+			paths = append(paths, a.Path)
+		}
+		if diff := cmp.Diff([]string{"BOOT-INF/lib/log4j-core-2.14.0.jar"}, paths); diff != "" {
+			t.Errorf("ParseReaderAt() returned unexpected artifacts (-want, +got): %s", diff)
+		}
+		// The nested JAR is read in place, so only its classes are
+		// decompressed.
+		if got := report.Stats.InPlaceArchives; got != 1 {
+			t.Errorf("ParseReaderAt() read %d archives in place, want 1", got)
+		}
+
+		zr, err := zip.NewReader(ra, ra.Size())
+		if err != nil {
+			t.Fatalf("zip.NewReader() failed: %v", err)
+		}
+		copied, err := Parse(zr)
+		if err != nil {
+			t.Fatalf("Parse() failed: %v", err)
+		}
+		if copied.Stats.InPlaceArchives != 0 {
+			t.Errorf("Parse() read %d archives in place, want 0", copied.Stats.InPlaceArchives)
+		}
+		if report.Stats.DecompressedBytes >= copied.Stats.DecompressedBytes {
+			t.Errorf("ParseReaderAt() decompressed %d bytes, want fewer than the %d of Parse()",
+				report.Stats.DecompressedBytes, copied.Stats.DecompressedBytes)
+		}
+	}
+}
+
+func TestParseSigned(t *testing.T) {
+	tests := []struct {
+		name   string
+		signed bool
+	}{
+		{"arara.jar", false},
+		{"arara.signed.jar", true},
+		{"arara.signed.jar.patched", false},
+		{"helloworld.signed.jar", true},
+		{"safe1.signed.jar", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			zr, err := zip.OpenReader(testdataPath(tc.name))
+			if err != nil {
+				t.Fatalf("zip.OpenReader failed: %v", err)
+			}
+			defer zr.Close()
+			report, err := Parse(&zr.Reader)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if report.Signed != tc.signed {
+				t.Errorf("Parse() returned signed %t, want %t", report.Signed, tc.signed)
+			}
+		})
+	}
+}
+
 func BenchmarkParse(b *testing.B) {
 	filename := "safe1.jar"
 	p := testdataPath(filename)
@@ -110,3 +295,509 @@ func TestYARARule(t *testing.T) {
 		t.Errorf("expected to match YARA rule")
 	}
 }
+
+func TestParseBundle(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "bundle.jar")
+	testjar.WriteFile(t, p, testjar.Zip(t, zip.Deflate,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\r\n"+
+			"Bundle-SymbolicName: org.apache.logging.log4j.core;singleton:=true\r\n"+
+			"Bundle-Version: 2.14.0\r\n"+
+			"Export-Package: org.apache.logging.log4j.core;version=\"2.14.0\";uses:=\"o\r\n"+
+			" rg.apache.logging.log4j,org.apache.logging.log4j.message\",org.apache.l\r\n"+
+			" ogging.log4j.core.lookup;version=\"2.14.0\"\r\n"),
+		testjar.File("org/apache/logging/log4j/core/Logger.class", ""),
+	))
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	report, err := Parse(zr)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	want := Bundle{
+		SymbolicName: "org.apache.logging.log4j.core",
+		Version:      "2.14.0",
+		ExportPackage: []string{
+			"org.apache.logging.log4j.core",
+			"org.apache.logging.log4j.core.lookup",
+		},
+	}
+	if diff := cmp.Diff(want, report.Bundle); diff != "" {
+		t.Errorf("Parse() returned unexpected bundle (-want, +got): %s", diff)
+	}
+}
+
+func TestParseManifestCase(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []testjar.Entry
+		want  string
+	}{
+		{
+			name:  "exact",
+			files: []testjar.Entry{testjar.File("META-INF/MANIFEST.MF", "Main-Class: com.example.Main\r\n")},
+			want:  "com.example.Main",
+		},
+		{
+			name:  "lower case",
+			files: []testjar.Entry{testjar.File("meta-inf/manifest.mf", "Main-Class: com.example.Main\r\n")},
+			want:  "com.example.Main",
+		},
+		{
+			name:  "mixed case",
+			files: []testjar.Entry{testjar.File("META-INF/Manifest.mf", "Main-Class: com.example.Main\r\n")},
+			want:  "com.example.Main",
+		},
+		{
+			name: "exact preferred",
+			files: []testjar.Entry{
+				testjar.File("META-INF/manifest.mf", "Main-Class: com.example.Other\r\n"),
+				testjar.File("META-INF/MANIFEST.MF", "Main-Class: com.example.Main\r\n"),
+			},
+			want: "com.example.Main",
+		},
+		{
+			name:  "other file",
+			files: []testjar.Entry{testjar.File("META-INF/MANIFEST.MF.bak", "Main-Class: com.example.Main\r\n")},
+		},
+	}
+	for _, tc := range tests {
+		p := filepath.Join(t.TempDir(), "app.jar")
+		testjar.WriteFile(t, p, testjar.Zip(t, zip.Deflate, tc.files...))
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			t.Fatalf("zip.OpenReader failed: %v", err)
+		}
+		report, err := Parse(zr)
+		zr.Close()
+		if err != nil {
+			t.Fatalf("Parse(%s) failed: %v", tc.name, err)
+		}
+		if report.MainClass != tc.want {
+			t.Errorf("Parse(%s) returned main class %q, want %q", tc.name, report.MainClass, tc.want)
+		}
+	}
+}
+
+func TestParseCVEs(t *testing.T) {
+	testCases := []struct {
+		filename     string
+		wantCVEs     []string
+		wantSeverity Severity
+	}{
+		{"log4j-core-2.14.0.jar", []string{CVE202144228, CVE202145046}, SeverityCritical},
+		{"log4j-core-2.15.0.jar", []string{CVE202145046}, SeverityCritical},
+		{"log4j-core-2.16.0.jar", nil, SeverityNone},
+		{"log4j-core-2.14.0.jar.patched", nil, SeverityNone},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			zr, err := zip.OpenReader(testdataPath(tc.filename))
+			if err != nil {
+				t.Fatalf("zip.OpenReader failed: %v", err)
+			}
+			defer zr.Close()
+			report, err := Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantCVEs, report.CVEs); diff != "" {
+				t.Errorf("Parse() returned unexpected CVEs (-want, +got): %s", diff)
+			}
+			if got := report.Severity(); got != tc.wantSeverity {
+				t.Errorf("Severity() = %v, want %v", got, tc.wantSeverity)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	testCases := []struct {
+		name      string
+		filename  string
+		config    *Config
+		wantRules []string
+	}{
+		{
+			name:      "Default",
+			filename:  "log4j-core-2.14.0.jar",
+			wantRules: []string{RuleLog4j44228Constructor, RuleLog4j216Heuristic},
+		},
+		{
+			name:      "DisableHeuristic",
+			filename:  "log4j-core-2.15.0.jar",
+			config:    &Config{DisableRules: []string{RuleLog4j216Heuristic}},
+			wantRules: nil,
+		},
+		{
+			name:      "EnableOnly",
+			filename:  "log4j-core-2.14.0.jar",
+			config:    &Config{EnableRules: []string{RuleLog4j216Heuristic}},
+			wantRules: []string{RuleLog4j216Heuristic},
+		},
+		{
+			name:     "DisableTakesPrecedence",
+			filename: "log4j-core-2.14.0.jar",
+			config: &Config{
+				EnableRules:  []string{RuleLog4j44228Constructor},
+				DisableRules: []string{RuleLog4j44228Constructor},
+			},
+			wantRules: nil,
+		},
+		{
+			name:      "OptInNotDefault",
+			filename:  "log4j-core-2.16.0.jar",
+			wantRules: nil,
+		},
+		{
+			name:      "CVE44832",
+			filename:  "log4j-core-2.16.0.jar",
+			config:    &Config{CVEs: []string{CVE202144832}},
+			wantRules: []string{RuleLog4j44832JDBC},
+		},
+		{
+			name:      "CVEs",
+			filename:  "log4j-core-2.14.0.jar",
+			config:    &Config{CVEs: []string{CVE202145046, CVE202144832}},
+			wantRules: []string{RuleLog4j216Heuristic, RuleLog4j44832JDBC},
+		},
+		{
+			name:      "EnableOptIn",
+			filename:  "log4j-core-2.15.0.jar",
+			config:    &Config{EnableRules: []string{RuleLog4j44832JDBC}},
+			wantRules: []string{RuleLog4j44832JDBC},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			zr, err := zip.OpenReader(testdataPath(tc.filename))
+			if err != nil {
+				t.Fatalf("zip.OpenReader failed: %v", err)
+			}
+			defer zr.Close()
+			report, err := tc.config.Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantRules, report.Rules); diff != "" {
+				t.Errorf("Parse() returned unexpected rules (-want, +got): %s", diff)
+			}
+			if got, want := report.Vulnerable, len(tc.wantRules) > 0; got != want {
+				t.Errorf("Parse() returned vulnerable %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestParseMatches(t *testing.T) {
+	const (
+		lookup  = "84057480ba7da6fb6d9ea50c53a00848315833c1f34bf8f4a47f11a14499ae3f"
+		manager = "77323460255818f4cbfe180141d6001bfb575b429e00a07cbceabd59adf334d6"
+	)
+	testCases := []struct {
+		filename string
+		want     []Match
+	}{
+		{
+			filename: "log4j-core-2.14.0.jar",
+			want: []Match{
+				{RuleLog4j44228Constructor, "org/apache/logging/log4j/core/lookup/JndiLookup.class", lookup},
+				{RuleLog4j44228Constructor, "org/apache/logging/log4j/core/net/JndiManager.class", manager},
+				{RuleLog4j216Heuristic, "org/apache/logging/log4j/core/lookup/JndiLookup.class", lookup},
+				{RuleLog4j216Heuristic, "org/apache/logging/log4j/core/net/JndiManager.class", manager},
+			},
+		},
+		{
+			filename: "bad_jar_in_jar.jar",
+			want: []Match{
+				{RuleLog4j44228Constructor, "vuln-class.jar!lookup/JndiLookup.class", lookup},
+				{RuleLog4j44228Constructor, "vuln-class.jar!net/JndiManager.class", manager},
+				{RuleLog4j216Heuristic, "vuln-class.jar!lookup/JndiLookup.class", lookup},
+				{RuleLog4j216Heuristic, "vuln-class.jar!net/JndiManager.class", manager},
+			},
+		},
+		{
+			filename: "safe1.jar",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			zr, err := zip.OpenReader(testdataPath(tc.filename))
+			if err != nil {
+				t.Fatalf("zip.OpenReader failed: %v", err)
+			}
+			defer zr.Close()
+			report, err := Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, report.Matches); diff != "" {
+				t.Errorf("Parse() returned unexpected matches (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestParseLog4j1(t *testing.T) {
+	b := testjar.Zip(t, zip.Deflate,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"),
+		testjar.File("org/apache/log4j/Logger.class", "class"),
+		testjar.File("org/apache/log4j/jdbc/JDBCAppender.class", "class"),
+		testjar.File("org/apache/log4j/net/JMSAppender.class", "class"),
+	)
+	testCases := []struct {
+		name       string
+		config     *Config
+		wantRules  []string
+		wantLog4j1 []string
+	}{
+		{
+			name: "Default",
+		},
+		{
+			name:       "Log4j1",
+			config:     &Config{Log4j1: true},
+			wantRules:  []string{RuleLog4j1JMSAppender, RuleLog4j1JDBCAppender},
+			wantLog4j1: []string{RuleLog4j1JMSAppender, RuleLog4j1JDBCAppender},
+		},
+		{
+			name:       "CVE",
+			config:     &Config{CVEs: []string{CVE20214104}},
+			wantRules:  []string{RuleLog4j1JMSAppender},
+			wantLog4j1: []string{RuleLog4j1JMSAppender},
+		},
+		{
+			name:       "Disable",
+			config:     &Config{Log4j1: true, DisableRules: []string{RuleLog4j1JDBCAppender}},
+			wantRules:  []string{RuleLog4j1JMSAppender},
+			wantLog4j1: []string{RuleLog4j1JMSAppender},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatalf("zip.NewReader failed: %v", err)
+			}
+			report, err := tc.config.Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantRules, report.Rules); diff != "" {
+				t.Errorf("Parse() returned unexpected rules (-want, +got): %s", diff)
+			}
+			if diff := cmp.Diff(tc.wantLog4j1, report.Log4j1); diff != "" {
+				t.Errorf("Parse() returned unexpected log4j 1.x rules (-want, +got): %s", diff)
+			}
+			if got, want := report.Vulnerable, len(tc.wantRules) > 0; got != want {
+				t.Errorf("Parse() returned vulnerable %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestSharedConfig(t *testing.T) {
+	zr, err := zip.OpenReader(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+
+	s, err := NewSharedConfig(nil)
+	if err != nil {
+		t.Fatalf("NewSharedConfig() failed: %v", err)
+	}
+	if err := s.Store(&Config{EnableRules: []string{"UNKNOWN"}}); err == nil {
+		t.Errorf("Store() of unknown rule succeeded")
+	}
+
+	// Scans running while the rules are replaced use either set of rules,
+	// never a mix of both.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				report, err := s.Load().Parse(zr)
+				if err != nil {
+					t.Errorf("Parse() failed: %v", err)
+					return
+				}
+				if n := len(report.Rules); n != 1 && n != 2 {
+					t.Errorf("Parse() returned rules %v, want either configuration's", report.Rules)
+				}
+			}
+		}()
+	}
+	if err := s.Store(&Config{DisableRules: []string{RuleLog4j216Heuristic}}); err != nil {
+		t.Errorf("Store() failed: %v", err)
+	}
+	wg.Wait()
+
+	report, err := s.Load().Parse(zr)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if diff := cmp.Diff([]string{RuleLog4j44228Constructor}, report.Rules); diff != "" {
+		t.Errorf("Parse() returned unexpected rules after Store (-want, +got): %s", diff)
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	zr, err := zip.OpenReader(testdataPath("bad_jar_in_jar.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseContext(cancelled, zr); err != context.Canceled {
+		t.Errorf("ParseContext() of cancelled context returned %v, want context.Canceled", err)
+	}
+
+	_, err = (&Config{Timeout: time.Nanosecond}).ParseContext(context.Background(), zr)
+	if te, ok := err.(*TimeoutError); !ok || te.Timeout != time.Nanosecond {
+		t.Errorf("ParseContext() with expired timeout returned %v, want *TimeoutError", err)
+	}
+
+	report, err := (&Config{Timeout: time.Minute}).ParseContext(context.Background(), zr)
+	if err != nil {
+		t.Fatalf("ParseContext() failed: %v", err)
+	}
+	if !report.Vulnerable {
+		t.Errorf("ParseContext() returned report not vulnerable, want vulnerable")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (&Config{DisableRules: []string{RuleLog4j216Heuristic}}).Validate(); err != nil {
+		t.Errorf("Validate() of a built-in rule failed: %v", err)
+	}
+	if err := (&Config{EnableRules: []string{"LOG4J-UNKNOWN"}}).Validate(); err == nil {
+		t.Errorf("Validate() of an unknown rule succeeded, expected error")
+	}
+	if err := (&Config{CVEs: []string{CVE202144832}}).Validate(); err != nil {
+		t.Errorf("Validate() of a detected CVE failed: %v", err)
+	}
+	if err := (&Config{CVEs: []string{"CVE-2021-45105"}}).Validate(); err == nil {
+		t.Errorf("Validate() of an undetected CVE succeeded, expected error")
+	}
+}
+
+func TestConfigEnabledRules(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *Config
+		want []string
+	}{
+		{
+			name: "default",
+			cfg:  &Config{},
+			want: []string{RuleLog4j44228Constructor, RuleLog4j216Heuristic},
+		},
+		{
+			name: "disabled",
+			cfg:  &Config{DisableRules: []string{RuleLog4j216Heuristic}},
+			want: []string{RuleLog4j44228Constructor},
+		},
+		{
+			name: "opt in",
+			cfg:  &Config{EnableRules: []string{RuleLog4j44832JDBC}},
+			want: []string{RuleLog4j44832JDBC},
+		},
+	}
+	for _, tc := range tests {
+		if diff := cmp.Diff(tc.want, tc.cfg.EnabledRules()); diff != "" {
+			t.Errorf("EnabledRules() of %s config returned diff (-want, +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []Severity{SeverityNone, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical} {
+		got, err := ParseSeverity(s.String())
+		if err != nil {
+			t.Errorf("ParseSeverity(%q) failed: %v", s, err)
+			continue
+		}
+		if got != s {
+			t.Errorf("ParseSeverity(%q) = %v, want %v", s, got, s)
+		}
+	}
+	if _, err := ParseSeverity("severe"); err == nil {
+		t.Errorf("ParseSeverity(%q) succeeded, expected error", "severe")
+	}
+}
+
+func TestParseProvenance(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "app.jar")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("creating jar: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	zw.SetComment("build 1234 of ci.example.com/app")
+	modified := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "META-INF/MANIFEST.MF", Modified: modified})
+	if err != nil {
+		t.Fatalf("creating manifest: %v", err)
+	}
+	io.WriteString(w, "Manifest-Version: 1.0\r\n"+
+		"Created-By: Apache Maven 3.8.4\r\n"+
+		"Built-By: jenkins\r\n"+
+		"Build-Jdk-Spec: 11\r\n"+
+		"Build-Jdk: 11.0.13\r\n"+
+		"Build-Time: 2021-12-01T10:00:00Z\r\n")
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	f.Close()
+
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	report, err := Parse(zr)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	want := Provenance{
+		Comment:          "build 1234 of ci.example.com/app",
+		BuiltBy:          "jenkins",
+		BuildJdk:         "11.0.13",
+		CreatedBy:        "Apache Maven 3.8.4",
+		BuildTime:        "2021-12-01T10:00:00Z",
+		ManifestModified: modified,
+	}
+	if diff := cmp.Diff(want, report.Provenance); diff != "" {
+		t.Errorf("Parse() returned unexpected provenance (-want, +got): %s", diff)
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	zr, err := zip.OpenReader(testdataPath("good_jar_in_jar_in_jar.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	report, err := Parse(zr)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	s := report.Stats
+	if s.MaxDepth != 2 || s.NestedArchives != 2 {
+		t.Errorf("Parse() returned depth %d and %d nested archives, want 2 and 2", s.MaxDepth, s.NestedArchives)
+	}
+	// Both nested JARs are decompressed, along with the classes within.
+	if min := int64(10951 + 12691); s.DecompressedBytes <= min {
+		t.Errorf("Parse() returned %d decompressed bytes, want more than %d", s.DecompressedBytes, min)
+	}
+	if s.Duration <= 0 {
+		t.Errorf("Parse() returned duration %v, want it measured", s.Duration)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jmodMagic starts JMOD files, the packaged modules of the JDK and of
+// applications linked with jlink.
+var jmodMagic = []byte{'J', 'M', 1, 0}
+
+const (
+	// jmodClassesDir holds the classes and resources of a JMOD file, which
+	// are at the root of the JAR of the module.
+	jmodClassesDir = "classes/"
+	// versionsDir holds the classes of a multi-release JAR that are specific
+	// to a Java release, such as
+	// "META-INF/versions/11/org/apache/logging/log4j/core/lookup/JndiLookup.class",
+	// which the JVM loads instead of the class at the root of the JAR.
+	versionsDir = "META-INF/versions/"
+)
+
+// jmodFile is the ZIP archive of a JMOD file, which follows its header and
+// has offsets relative to the end of it.
+type jmodFile struct {
+	*io.SectionReader
+}
+
+// openJMOD returns the ZIP archive of the JMOD file of the given size read
+// by ra, or ra itself if it isn't one.
+func openJMOD(ra io.ReaderAt, size int64) (io.ReaderAt, int64) {
+	h := make([]byte, len(jmodMagic))
+	if size < int64(len(h)) {
+		return ra, size
+	}
+	if _, err := ra.ReadAt(h, 0); err != nil || !bytes.Equal(h, jmodMagic) {
+		return ra, size
+	}
+	size -= int64(len(h))
+	return &jmodFile{io.NewSectionReader(ra, int64(len(h)), size)}, size
+}
+
+// rootName returns the name an entry at path p of a JAR would have at the
+// root of a plain JAR, such as
+// "org/apache/logging/log4j/core/lookup/JndiLookup.class", which rules
+// match against. jmod is set for the entries of a JMOD file, whose classes/
+// prefix is removed, and the META-INF/versions/<N>/ prefix of the classes of
+// a multi-release JAR is removed too.
+func rootName(p string, jmod bool) string {
+	if jmod {
+		p = strings.TrimPrefix(p, jmodClassesDir)
+	}
+	if !strings.HasPrefix(p, versionsDir) {
+		return p
+	}
+	rest := p[len(versionsDir):]
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		return p
+	}
+	if release, err := strconv.Atoi(rest[:i]); err != nil || release <= 0 {
+		return p
+	}
+	return rest[i+1:]
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRootName(t *testing.T) {
+	tests := []struct {
+		p    string
+		jmod bool
+		want string
+	}{
+		{"org/apache/logging/log4j/core/lookup/JndiLookup.class", false, "org/apache/logging/log4j/core/lookup/JndiLookup.class"},
+		{"classes/org/apache/logging/log4j/core/lookup/JndiLookup.class", true, "org/apache/logging/log4j/core/lookup/JndiLookup.class"},
+		{"classes/org/apache/logging/log4j/core/lookup/JndiLookup.class", false, "classes/org/apache/logging/log4j/core/lookup/JndiLookup.class"},
+		{"classes/META-INF/MANIFEST.MF", true, "META-INF/MANIFEST.MF"},
+		{"lib/libjava.so", true, "lib/libjava.so"},
+		{"META-INF/versions/11/org/apache/logging/log4j/core/lookup/JndiLookup.class", false, "org/apache/logging/log4j/core/lookup/JndiLookup.class"},
+		{"classes/META-INF/versions/9/module-info.class", true, "module-info.class"},
+		{"META-INF/versions/latest/Foo.class", false, "META-INF/versions/latest/Foo.class"},
+		{"META-INF/versions/0/Foo.class", false, "META-INF/versions/0/Foo.class"},
+		{"META-INF/versions/11", false, "META-INF/versions/11"},
+	}
+	for _, tc := range tests {
+		if got := rootName(tc.p, tc.jmod); got != tc.want {
+			t.Errorf("rootName(%q, %v) = %q, want %q", tc.p, tc.jmod, got, tc.want)
+		}
+	}
+}
+
+// relayout returns a copy of the JAR at testdata path p with the entries
+// accepted by move prefixed by prefix, as a JMOD file if jmod is set.
+func relayout(t *testing.T, p, prefix string, move func(name string) bool, jmod bool) []byte {
+	t.Helper()
+	src, err := zip.OpenReader(testdataPath(p))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer src.Close()
+	var b bytes.Buffer
+	if jmod {
+		b.Write(jmodMagic)
+	}
+	zw := zip.NewWriter(&b)
+	for _, f := range src.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		name := f.Name
+		if move(name) {
+			name = prefix + name
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+		if _, err := io.Copy(w, rc); err != nil {
+			t.Fatalf("copying %s: %v", f.Name, err)
+		}
+		rc.Close()
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip writer: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestParseLayouts(t *testing.T) {
+	all := func(string) bool { return true }
+	classes := func(name string) bool { return strings.HasSuffix(name, ".class") }
+	layouts := []struct {
+		name   string
+		prefix string
+		move   func(string) bool
+		jmod   bool
+	}{
+		{"jmod", "classes/", all, true},
+		{"multi-release", "META-INF/versions/11/", classes, false},
+	}
+	files := []string{
+		"log4j-core-2.1.jar",
+		"log4j-core-2.14.0.jar",
+		"log4j-core-2.15.0.jar",
+		"log4j-core-2.16.0.jar",
+		"vuln-class.jar",
+		"safe1.jar",
+	}
+	type result struct {
+		Vulnerable bool
+		CVEs       []string
+		Rules      []string
+	}
+	for _, l := range layouts {
+		for _, p := range files {
+			t.Run(l.name+"/"+p, func(t *testing.T) {
+				plain := relayout(t, p, "", all, false)
+				want, err := defaultConfig.ParseReaderAt(context.Background(), bytes.NewReader(plain), int64(len(plain)))
+				if err != nil {
+					t.Fatalf("ParseReaderAt(%s) failed: %v", p, err)
+				}
+				data := relayout(t, p, l.prefix, l.move, l.jmod)
+				got, err := defaultConfig.ParseReaderAt(context.Background(), bytes.NewReader(data), int64(len(data)))
+				if err != nil {
+					t.Fatalf("ParseReaderAt(%s as %s) failed: %v", p, l.name, err)
+				}
+				if diff := cmp.Diff(result{want.Vulnerable, want.CVEs, want.Rules}, result{got.Vulnerable, got.CVEs, got.Rules}); diff != "" {
+					t.Errorf("ParseReaderAt(%s as %s) returned diff (-want, +got): %s", p, l.name, diff)
+				}
+				for _, m := range got.Matches {
+					if !strings.HasPrefix(m.Path, l.prefix) {
+						t.Errorf("ParseReaderAt(%s as %s) matched %s, want a path starting with %s", p, l.name, m.Path, l.prefix)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWalkerRewriteJMOD(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "log4j.jmod")
+	if err := os.WriteFile(fp, relayout(t, "log4j-core-2.14.0.jar", "classes/", func(string) bool { return true }, true), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	var rewritten []string
+	w := Walker{
+		Rewrite: true,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleRewrite: func(path string, r *Report) {
+			rewritten = append(rewritten, path)
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	if diff := cmp.Diff([]string{fp}, rewritten); diff != "" {
+		t.Errorf("walking filesystem returned diff (-want, +got): %s", diff)
+	}
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatalf("reading rewritten file: %v", err)
+	}
+	if !bytes.HasPrefix(data, jmodMagic) {
+		t.Errorf("rewritten file starts with %q, want the JMOD header %q", data[:len(jmodMagic)], jmodMagic)
+	}
+	r, err := defaultConfig.ParseReaderAt(context.Background(), bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReaderAt(rewritten) failed: %v", err)
+	}
+	if r.Vulnerable {
+		t.Errorf("rewritten JMOD file is still vulnerable")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLocked is matched, with errors.Is, by the error of a file that couldn't
+// be read because another process holds it open exclusively or has locked
+// it, such as a JAR of a running Windows service. Unlike other errors, the
+// file may be readable once the process exits.
+var ErrLocked = errors.New("file is locked by another process")
+
+// lockedError wraps the error of a locked file.
+type lockedError struct {
+	err error
+}
+
+func (e *lockedError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrLocked, e.err)
+}
+
+func (e *lockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+func (e *lockedError) Unwrap() error {
+	return e.err
+}
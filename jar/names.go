@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"unicode/utf8"
+)
+
+// flagUTF8 is the general purpose flag set by archivers that encode names in
+// UTF-8 (the "language encoding flag").
+const flagUTF8 = 0x800
+
+// extraUnicodePath is the ID of the Info-ZIP Unicode Path extra field, which
+// holds the UTF-8 name of an entry whose header name uses a legacy encoding.
+const extraUnicodePath = 0x7075
+
+// EntryName returns the name of a ZIP entry decoded to UTF-8. ZIP names are
+// CP437 unless the UTF-8 flag is set, but many archivers write UTF-8 names
+// without the flag, so names are decoded as follows:
+//
+//   - The Info-ZIP Unicode Path extra field, if its checksum matches the
+//     header name.
+//   - The header name if the UTF-8 flag is set or it's valid UTF-8.
+//   - The header name decoded from CP437.
+//
+// The header name, zip.FileHeader.Name, is still what identifies the entry
+// within the archive and must be kept when rewriting it.
+func EntryName(fh *zip.FileHeader) string {
+	if name, ok := unicodePath(fh); ok {
+		return name
+	}
+	if fh.Flags&flagUTF8 != 0 || utf8.ValidString(fh.Name) {
+		return fh.Name
+	}
+	return decodeCP437(fh.Name)
+}
+
+// unicodePath returns the name held by the Info-ZIP Unicode Path extra field.
+// The field is ignored if the name was changed by a tool unaware of it, which
+// is detected by a checksum of the header name.
+func unicodePath(fh *zip.FileHeader) (string, bool) {
+	extra := fh.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			return "", false
+		}
+		field := extra[:size]
+		extra = extra[size:]
+		if id != extraUnicodePath {
+			continue
+		}
+		// Version 1, the CRC-32 of the header name, and the UTF-8 name.
+		if len(field) < 5 || field[0] != 1 {
+			return "", false
+		}
+		if binary.LittleEndian.Uint32(field[1:]) != crc32.ChecksumIEEE([]byte(fh.Name)) {
+			return "", false
+		}
+		name := string(field[5:])
+		if !utf8.ValidString(name) {
+			return "", false
+		}
+		return name, true
+	}
+	return "", false
+}
+
+// cp437 maps the upper half of code page 437 to Unicode. The lower half is
+// ASCII.
+var cp437 = [128]rune{
+	'Ç', 'ü', 'é', 'â', 'ä', 'à', 'å', 'ç', 'ê', 'ë', 'è', 'ï', 'î', 'ì', 'Ä', 'Å',
+	'É', 'æ', 'Æ', 'ô', 'ö', 'ò', 'û', 'ù', 'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
+	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º', '¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
+	'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+	'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+	'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+	'α', 'ß', 'Γ', 'π', 'Σ', 'σ', 'µ', 'τ', 'Φ', 'Θ', 'Ω', 'δ', '∞', 'φ', 'ε', '∩',
+	'≡', '±', '≥', '≤', '⌠', '⌡', '÷', '≈', '°', '∙', '·', '√', 'ⁿ', '²', '■', ' ',
+}
+
+func decodeCP437(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x80 {
+			b.WriteByte(c)
+		} else {
+			b.WriteRune(cp437[c-0x80])
+		}
+	}
+	return b.String()
+}
+
+// decodeNames returns a reader of zr whose entries are named by EntryName.
+// zip.Reader refuses to open or list entries whose names aren't valid UTF-8,
+// so without decoding, a JAR with a single CP437 name couldn't be scanned.
+// The entries still read from zr.
+func decodeNames(zr *zip.Reader) *zip.Reader {
+	var files []*zip.File
+	for i, f := range zr.File {
+		name := EntryName(&f.FileHeader)
+		if name == f.Name {
+			if files != nil {
+				files = append(files, f)
+			}
+			continue
+		}
+		if files == nil {
+			files = append(make([]*zip.File, 0, len(zr.File)), zr.File[:i]...)
+		}
+		decoded := *f
+		decoded.Name = name
+		files = append(files, &decoded)
+	}
+	if files == nil {
+		return zr
+	}
+	return &zip.Reader{File: files, Comment: zr.Comment}
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// unicodePathExtra returns an Info-ZIP Unicode Path extra field naming an
+// entry whose header name is raw.
+func unicodePathExtra(raw, name string) []byte {
+	b := make([]byte, 9, 9+len(name))
+	binary.LittleEndian.PutUint16(b, extraUnicodePath)
+	binary.LittleEndian.PutUint16(b[2:], uint16(5+len(name)))
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[5:], crc32.ChecksumIEEE([]byte(raw)))
+	return append(b, name...)
+}
+
+func TestEntryName(t *testing.T) {
+	tests := []struct {
+		desc string
+		fh   zip.FileHeader
+		want string
+	}{
+		{"ascii", zip.FileHeader{Name: "a/b.class"}, "a/b.class"},
+		{"utf-8 flag", zip.FileHeader{Name: "café.txt", Flags: flagUTF8}, "café.txt"},
+		{"utf-8 without flag", zip.FileHeader{Name: "café.txt"}, "café.txt"},
+		{"cp437", zip.FileHeader{Name: "caf\x82/\x9c\xff.txt"}, "café/£ .txt"},
+		{
+			"unicode path",
+			zip.FileHeader{Name: "caf\x82.txt", Extra: unicodePathExtra("caf\x82.txt", "café.txt")},
+			"café.txt",
+		},
+		{
+			"stale unicode path",
+			zip.FileHeader{Name: "caf\x82.txt", Extra: unicodePathExtra("other.txt", "other.txt")},
+			"café.txt",
+		},
+		{
+			"truncated extra",
+			zip.FileHeader{Name: "caf\x82.txt", Extra: unicodePathExtra("caf\x82.txt", "café.txt")[:7]},
+			"café.txt",
+		},
+	}
+	for _, tc := range tests {
+		if got := EntryName(&tc.fh); got != tc.want {
+			t.Errorf("EntryName(%s) = %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+// cp437JAR returns a ZIP holding vuln-class.jar under a CP437 encoded name,
+// "lib/café.jar", along with a file named through the Unicode Path extra
+// field and a UTF-8 flagged one.
+func cp437JAR(t *testing.T) *zip.Reader {
+	t.Helper()
+	inner, err := os.ReadFile(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, fh := range []*zip.FileHeader{
+		{Name: "lib/caf\x82.jar", NonUTF8: true},
+		{Name: "r\x82sum\x82.txt", NonUTF8: true, Extra: unicodePathExtra("r\x82sum\x82.txt", "résumé.txt")},
+		{Name: "naïve.txt"},
+	} {
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatalf("creating %q: %v", fh.Name, err)
+		}
+		data := []byte(fh.Name)
+		if strings.HasSuffix(fh.Name, ".jar") {
+			data = inner
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("writing %q: %v", fh.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	return zr
+}
+
+func TestExplainCP437(t *testing.T) {
+	e, err := Explain(cp437JAR(t))
+	if err != nil {
+		t.Fatalf("Explain() failed: %v", err)
+	}
+	if !e.Report.Vulnerable {
+		t.Errorf("Explain() didn't find the JAR vulnerable")
+	}
+	if len(e.Evidence) == 0 {
+		t.Fatalf("Explain() returned no evidence")
+	}
+	for _, ev := range e.Evidence {
+		if !strings.HasPrefix(ev.Path, "lib/café.jar!") {
+			t.Errorf("Explain() returned evidence for %q, want paths within lib/café.jar!", ev.Path)
+		}
+	}
+
+	// The reported paths can be extracted.
+	p := e.Evidence[0].Path
+	f, err := Extract(cp437JAR(t), p)
+	if err != nil {
+		t.Fatalf("Extract(%q) failed: %v", p, err)
+	}
+	f.Close()
+}
+
+func TestRewriteNames(t *testing.T) {
+	zr := cp437JAR(t)
+	var b bytes.Buffer
+	if err := Rewrite(&b, zr); err != nil {
+		t.Fatalf("Rewrite() failed: %v", err)
+	}
+	got, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("reading rewritten zip: %v", err)
+	}
+	type entry struct {
+		Name    string
+		Decoded string
+		UTF8    bool
+	}
+	entries := func(zr *zip.Reader) []entry {
+		var es []entry
+		for _, f := range zr.File {
+			es = append(es, entry{f.Name, EntryName(&f.FileHeader), f.Flags&flagUTF8 != 0})
+		}
+		return es
+	}
+	// Entries keep their header names and encoding flags, so no entry is
+	// renamed or dropped.
+	if diff := cmp.Diff(entries(zr), entries(got)); diff != "" {
+		t.Errorf("Rewrite() changed entries (-want, +got): %s", diff)
+	}
+	r, err := Parse(got)
+	if err != nil {
+		t.Fatalf("Parse() of rewritten zip failed: %v", err)
+	}
+	if r.Vulnerable {
+		t.Errorf("rewritten zip is still vulnerable")
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !darwin && !windows
+
+package jar
+
+import "path/filepath"
+
+// PathKey returns the key identifying the file at path p on the host, so
+// that paths of the same file can be deduplicated. Filesystems are case
+// sensitive on this platform, so paths only differing by case are different
+// files.
+func PathKey(p string) string {
+	return filepath.Clean(p)
+}
@@ -0,0 +1,40 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPathKey(t *testing.T) {
+	fold := runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "app/lib/log4j.jar", b: "app/lib/log4j.jar", want: true},
+		{a: "app/lib/log4j.jar", b: "app/bin/../lib/log4j.jar", want: true},
+		{a: "app/lib/log4j.jar", b: "app/lib/", want: false},
+		{a: "app/lib/log4j.jar", b: "App/Lib/LOG4J.jar", want: fold},
+	}
+	for _, tc := range tests {
+		a, b := filepath.FromSlash(tc.a), filepath.FromSlash(tc.b)
+		if got := PathKey(a) == PathKey(b); got != tc.want {
+			t.Errorf("PathKey(%q) == PathKey(%q) is %v, want %v", a, b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+const (
+	// classBufferBytes is the initial size of a buffer classes are read
+	// into, which holds most classes without growing.
+	classBufferBytes = 64 << 10 // 64KiB
+	// maxPooledBytes is the size of the largest buffer that's reused.
+	// Larger buffers, from unusually large classes, are released so a
+	// long-running process doesn't hold onto them.
+	maxPooledBytes = 4 << 20 // 4MiB
+)
+
+// classBuffers holds the buffers classes are read into, reused between
+// classes and scans.
+var classBuffers = sync.Pool{
+	New: func() interface{} {
+		return bytes.NewBuffer(make([]byte, 0, classBufferBytes))
+	},
+}
+
+// Warm preallocates buffers for n concurrent scans, so the first scans of a
+// long-running service, such as a server scanning uploads, don't pay for
+// them. The buffers may still be released by the garbage collector if
+// they're unused.
+func Warm(n int) {
+	bufs := make([]*bytes.Buffer, n)
+	for i := range bufs {
+		bufs[i] = classBuffers.Get().(*bytes.Buffer)
+	}
+	for _, b := range bufs {
+		classBuffers.Put(b)
+	}
+}
+
+// readClass reads a class into a pooled buffer. The buffer must be released
+// with releaseClass once the content is no longer used.
+func readClass(r io.Reader) (*bytes.Buffer, error) {
+	b := classBuffers.Get().(*bytes.Buffer)
+	b.Reset()
+	if _, err := b.ReadFrom(r); err != nil {
+		releaseClass(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// releaseClass returns a buffer of readClass to the pool.
+func releaseClass(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBytes {
+		return
+	}
+	classBuffers.Put(b)
+}
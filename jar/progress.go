@@ -0,0 +1,111 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// WalkStats describes the progress of a Walker, such as to drive a progress
+// bar or export metrics. See Walker.HandleProgress and Walker.Stats.
+type WalkStats struct {
+	// Files and Dirs count the files and directories walked, archives or
+	// not. Entries skipped by SkipDir aren't counted.
+	Files int64
+	Dirs  int64
+	// Archives counts the archives scanned, and Cached the archives whose
+	// reports were taken from Cache or FileCache instead.
+	Archives int64
+	Cached   int64
+	// Bytes is the size of the archives scanned, and DecompressedBytes
+	// the bytes decompressed scanning them, see Stats.
+	Bytes             int64
+	DecompressedBytes int64
+	// Findings counts the vulnerable JARs reported, and Errors the errors
+	// of files and directories.
+	Findings int64
+	Errors   int64
+	// Elapsed is the time since the first walk started.
+	Elapsed time.Duration
+}
+
+// progress holds the WalkStats of a Walker. It's safe for concurrent use.
+type progress struct {
+	mu    sync.Mutex
+	start time.Time
+	stats WalkStats
+}
+
+// started records the start of a walk, unless an earlier walk started.
+func (p *progress) started() {
+	p.mu.Lock()
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	p.mu.Unlock()
+}
+
+// add updates the stats with f.
+func (p *progress) add(f func(s *WalkStats)) {
+	p.mu.Lock()
+	f(&p.stats)
+	p.mu.Unlock()
+}
+
+// snapshot returns the stats so far.
+func (p *progress) snapshot() WalkStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	if !p.start.IsZero() {
+		s.Elapsed = time.Since(p.start)
+	}
+	return s
+}
+
+// Stats returns the statistics of the walks of the Walker so far, totalled
+// across calls to Walk. It may be called concurrently with a walk, such as
+// from another goroutine polling it.
+func (w *Walker) Stats() WalkStats {
+	return w.progress.snapshot()
+}
+
+// walked records an entry of the walk, and passes the progress to
+// HandleProgress.
+func (w *walker) walked(d fs.DirEntry) {
+	w.progress.add(func(s *WalkStats) {
+		if d.IsDir() {
+			s.Dirs++
+		} else {
+			s.Files++
+		}
+	})
+	w.handleProgress()
+}
+
+// handleProgress passes the stats so far to HandleProgress, in order with
+// the reports of queued files.
+func (w *walker) handleProgress() {
+	if w.HandleProgress == nil {
+		return
+	}
+	if w.pool != nil {
+		w.pool.emit(func() { w.HandleProgress(w.Stats()) })
+		return
+	}
+	w.HandleProgress(w.Stats())
+}
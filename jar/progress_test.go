@@ -0,0 +1,85 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestWalkerProgress(t *testing.T) {
+	dir := t.TempDir()
+	cpFile(t, filepath.Join(dir, "lib", "log4j-core-2.14.0.jar"), testdataPath("log4j-core-2.14.0.jar"))
+	cpFile(t, filepath.Join(dir, "lib", "helloworld.jar"), testdataPath("helloworld.jar"))
+	cpFile(t, filepath.Join(dir, "notarealjar.jar"), testdataPath("notarealjar.jar"))
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, name := range []string{"lib/log4j-core-2.14.0.jar", "lib/helloworld.jar"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+	}
+
+	for _, workers := range []int{1, 4} {
+		var calls []WalkStats
+		w := &Walker{
+			Workers:        workers,
+			HandleProgress: func(s WalkStats) { calls = append(calls, s) },
+		}
+		if err := w.Walk(dir); err != nil {
+			t.Fatalf("Walk() failed: %v", err)
+		}
+		got := w.Stats()
+		if got.Elapsed <= 0 {
+			t.Errorf("Stats() with %d workers returned elapsed time %v, want positive", workers, got.Elapsed)
+		}
+		if got.DecompressedBytes <= 0 {
+			t.Errorf("Stats() with %d workers returned %d decompressed bytes, want positive", workers, got.DecompressedBytes)
+		}
+		// The root, lib, and 4 files.
+		want := WalkStats{Files: 4, Dirs: 2, Archives: 2, Bytes: size, Findings: 1}
+		ignore := cmpopts.IgnoreFields(WalkStats{}, "Elapsed", "DecompressedBytes")
+		if diff := cmp.Diff(want, got, ignore); diff != "" {
+			t.Errorf("Stats() with %d workers returned unexpected stats (-want, +got):\n%s", workers, diff)
+		}
+		if len(calls) == 0 {
+			t.Fatalf("HandleProgress() with %d workers wasn't called", workers)
+		}
+		if diff := cmp.Diff(want, calls[len(calls)-1], ignore); diff != "" {
+			t.Errorf("last HandleProgress() with %d workers got unexpected stats (-want, +got):\n%s", workers, diff)
+		}
+		for i := 1; i < len(calls); i++ {
+			if calls[i].Files < calls[i-1].Files || calls[i].Archives < calls[i-1].Archives {
+				t.Errorf("HandleProgress() with %d workers went backwards: %+v after %+v", workers, calls[i], calls[i-1])
+			}
+		}
+
+		// Stats are totalled across walks.
+		if err := w.Walk(filepath.Join(dir, "lib")); err != nil {
+			t.Fatalf("Walk() failed: %v", err)
+		}
+		if got := w.Stats(); got.Archives != 4 || got.Findings != 2 {
+			t.Errorf("Stats() after a second walk with %d workers returned %d archives and %d findings, want 4 and 2", workers, got.Archives, got.Findings)
+		}
+	}
+}
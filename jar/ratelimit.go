@@ -0,0 +1,76 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import "io"
+
+// RateLimiter paces the IO of scans, such as to spare the storage of
+// production hosts. See Config.RateLimit. Its methods are called
+// concurrently by the workers of a Walker.
+type RateLimiter interface {
+	// WaitFile is called before each archive is opened by a Walker.
+	WaitFile()
+	// WaitBytes is called with the number of bytes of each read of an
+	// archive, and each write and read of a nested archive spilled to
+	// disk.
+	WaitBytes(n int)
+}
+
+// waitFile paces opening a file with the configured RateLimit.
+func (c *Config) waitFile() {
+	if c != nil && c.RateLimit != nil {
+		c.RateLimit.WaitFile()
+	}
+}
+
+// limitReaderAt paces the reads of ra with the configured RateLimit.
+func (c *Config) limitReaderAt(ra io.ReaderAt) io.ReaderAt {
+	if c == nil || c.RateLimit == nil {
+		return ra
+	}
+	return &limitedReaderAt{ra: ra, limit: c.RateLimit}
+}
+
+// limitReader paces the reads of r with the configured RateLimit.
+func (c *Config) limitReader(r io.Reader) io.Reader {
+	if c == nil || c.RateLimit == nil {
+		return r
+	}
+	return &limitedReader{r: r, limit: c.RateLimit}
+}
+
+// limitedReaderAt paces reads of an io.ReaderAt.
+type limitedReaderAt struct {
+	ra    io.ReaderAt
+	limit RateLimiter
+}
+
+func (l *limitedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := l.ra.ReadAt(p, off)
+	l.limit.WaitBytes(n)
+	return n, err
+}
+
+// limitedReader paces reads of an io.Reader.
+type limitedReader struct {
+	r     io.Reader
+	limit RateLimiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.limit.WaitBytes(n)
+	return n, err
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"log4jscanner/readonly"
+)
+
+// readOnlyEnv is set when the test binary re-executes itself to run
+// TestReadOnly in read-only mode, which can't be disabled once enabled.
+const readOnlyEnv = "LOG4JSCANNER_TEST_READ_ONLY"
+
+func TestReadOnly(t *testing.T) {
+	if os.Getenv(readOnlyEnv) != "1" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestReadOnly$", "-test.v")
+		cmd.Env = append(os.Environ(), readOnlyEnv+"=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("running TestReadOnly in read-only mode failed: %v\n%s", err, out)
+		}
+		return
+	}
+	readonly.Enable()
+
+	t.Run("rewrite", func(t *testing.T) {
+		dir := t.TempDir()
+		p := filepath.Join(dir, "arara.jar")
+		cpFile(t, p, testdataPath("arara.jar"))
+		before, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("reading jar: %v", err)
+		}
+
+		var errs, found, rewritten int
+		w := Walker{
+			Rewrite:       true,
+			HandleError:   func(path string, err error) { errs++ },
+			HandleReport:  func(path string, r *Report) { found++ },
+			HandleRewrite: func(path string, r *Report) { rewritten++ },
+		}
+		if err := w.Walk(dir); err != nil {
+			t.Fatalf("walking filesystem: %v", err)
+		}
+		if found != 1 || rewritten != 0 || errs != 1 {
+			t.Errorf("Walk() reported %d findings, %d rewrites, %d errors, want 1, 0, 1", found, rewritten, errs)
+		}
+		after, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("reading jar: %v", err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Errorf("Walk() modified %s in read-only mode", p)
+		}
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := &Config{SpillThreshold: 1, SpillDir: dir}
+		zr, err := zip.OpenReader(testdataPath("bad_jar_in_jar.jar"))
+		if err != nil {
+			t.Fatalf("zip.OpenReader failed: %v", err)
+		}
+		defer zr.Close()
+		if _, err := cfg.Parse(zr); err == nil {
+			t.Errorf("Parse() spilling in read-only mode succeeded, expected error")
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("reading spill directory: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Parse() wrote %d files in read-only mode", len(entries))
+		}
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Shading tools, such as the Maven Shade Plugin, relocate the packages of
+// the libraries they bundle, so that vendors ship log4j as, for example,
+// org/elasticsearch/log4j/core/lookup/JndiLookup.class. The classes log4j's
+// rules depend on are also identified by their contents, which relocating
+// doesn't change, so relocated or renamed copies are detected and unrelated
+// classes sharing their names aren't.
+
+// Classes of log4j identified by identifyClass.
+const (
+	classJndiLookup  = "JndiLookup"
+	classJndiManager = "JndiManager"
+)
+
+var (
+	// jndiLookupMarker is the prefix JndiLookup adds to JNDI names without
+	// a scheme, in every release of log4j 2.
+	jndiLookupMarker = []byte("java:comp/env/")
+	// jndiManagerMarker is the InitialContext property JndiManager
+	// configures from its factory name.
+	jndiManagerMarker = []byte("java.naming.factory.initial")
+)
+
+// identifyClass returns classJndiLookup or classJndiManager if cf is a copy
+// of log4j's class of that name, wherever it was relocated to, otherwise "".
+func identifyClass(cf *classFile) string {
+	switch {
+	case cf.utf8[string(jndiLookupMarker)] && cf.utf8["jndi"] && cf.utf8["Lookup"] &&
+		(cf.referencesPackage("javax/naming/") || cf.referencesClass("JndiManager")):
+		// The JNDI lookup plugin, annotated with @Plugin(name = "jndi",
+		// category = "Lookup").
+		return classJndiLookup
+	case cf.utf8[string(jndiManagerMarker)] && cf.utf8["java.naming.provider.url"] &&
+		simpleName(cf.super) == "AbstractManager":
+		return classJndiManager
+	}
+	return ""
+}
+
+// loadable reports whether the JVM can load the class from the entry at path
+// p: classes are loaded from the path of their name, below the root of the
+// archive or a directory of its class path, such as WEB-INF/classes/.
+func (cf *classFile) loadable(p string) bool {
+	file := cf.name + ".class"
+	return p == file || strings.HasSuffix(p, "/"+file)
+}
+
+// log4jClass reports whether the class at path p, whose name is as in
+// rootName, is log4j's JndiLookup or JndiManager class. Classes are
+// identified by their name, as a backstop for copies modified beyond
+// recognition, but well formed class files sharing the name of one are only
+// identified as one if their contents are. Well formed classes of other names
+// are identified by their contents if they can be loaded from p, so relocated
+// copies are found, and byContent is set, but not disabled ones, such as a
+// JndiLookup.class renamed to JndiLookupOther.class.
+func log4jClass(p string, content []byte) (lookup, manager, byContent bool) {
+	lookup = strings.Contains(p, "JndiLookup.class")
+	manager = strings.Contains(p, "JndiManager.class")
+	if !lookup && !manager && !mayIdentify(content) {
+		return lookup, manager, false
+	}
+	cf, err := parseClassFile(content)
+	if err != nil {
+		return lookup, manager, false
+	}
+	id := identifyClass(cf)
+	if lookup || manager {
+		return id == classJndiLookup, id == classJndiManager, false
+	}
+	if id == "" || !cf.loadable(p) {
+		return false, false, false
+	}
+	return id == classJndiLookup, id == classJndiManager, true
+}
+
+// mayIdentify reports whether content may be a class identified by
+// identifyClass, to only parse the class files that may be.
+func mayIdentify(content []byte) bool {
+	return bytes.Contains(content, jndiLookupMarker) || bytes.Contains(content, jndiManagerMarker)
+}
+
+// relocatedLookup reports whether the class f is a relocated or renamed
+// JndiLookup, which Rewrite removes along with the ones skipSuffixes match.
+func relocatedLookup(f *zip.File) (bool, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return false, fmt.Errorf("failed to open class %q for auto-mitigation: %v", f.Name, err)
+	}
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return false, fmt.Errorf("failed to read class %q for auto-mitigation: %v", f.Name, err)
+	}
+	return isRelocatedLookup(f.Name, content), nil
+}
+
+// isRelocatedLookup reports whether the class at p with the given content is
+// a relocated or renamed JndiLookup.
+func isRelocatedLookup(p string, content []byte) bool {
+	if !mayIdentify(content) {
+		return false
+	}
+	lookup, _, byContent := log4jClass(p, content)
+	return lookup && byContent
+}
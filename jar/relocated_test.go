@@ -0,0 +1,282 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// relocateClass returns a class file with every UTF-8 constant rewritten by
+// r, like a shading tool relocating its package.
+func relocateClass(t *testing.T, content []byte, r *strings.Replacer) []byte {
+	t.Helper()
+	n := int(binary.BigEndian.Uint16(content[8:]))
+	out := append([]byte(nil), content[:10]...)
+	off := 10
+	for i := 1; i < n; i++ {
+		tag := content[off]
+		size := 0
+		switch tag {
+		case 1:
+			l := int(binary.BigEndian.Uint16(content[off+1:]))
+			s := r.Replace(string(content[off+3 : off+3+l]))
+			out = append(out, 1, byte(len(s)>>8), byte(len(s)))
+			out = append(out, s...)
+			off += 3 + l
+			continue
+		case 7, 8, 16, 19, 20:
+			size = 2
+		case 15:
+			size = 3
+		case 3, 4, 9, 10, 11, 12, 17, 18:
+			size = 4
+		case 5, 6:
+			size = 8
+			i++
+		default:
+			t.Fatalf("unexpected constant pool tag %d", tag)
+		}
+		out = append(out, content[off:off+1+size]...)
+		off += 1 + size
+	}
+	return append(out, content[off:]...)
+}
+
+// relocateJAR returns a copy of a test JAR with the names and contents of
+// its entries rewritten by r.
+func relocateJAR(t *testing.T, name string, r *strings.Replacer) []byte {
+	t.Helper()
+	zr, err := zip.OpenReader(testdataPath(name))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		if strings.HasSuffix(f.Name, ".class") {
+			content = relocateClass(t, content, r)
+		}
+		w, err := zw.Create(r.Replace(f.Name))
+		if err != nil {
+			t.Fatalf("creating %s: %v", f.Name, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatalf("writing %s: %v", f.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	return b.Bytes()
+}
+
+// readEntry returns the contents of an entry of a test JAR.
+func readEntry(t *testing.T, name, entry string) []byte {
+	t.Helper()
+	zr, err := zip.OpenReader(testdataPath(name))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	f, err := zr.Open(entry)
+	if err != nil {
+		t.Fatalf("opening %s: %v", entry, err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("reading %s: %v", entry, err)
+	}
+	return content
+}
+
+func TestParseClassFile(t *testing.T) {
+	content := readEntry(t, "log4j-core-2.14.0.jar", jndiLookupClass)
+	cf, err := parseClassFile(content)
+	if err != nil {
+		t.Fatalf("parseClassFile() failed: %v", err)
+	}
+	if want := "org/apache/logging/log4j/core/lookup/JndiLookup"; cf.name != want {
+		t.Errorf("parseClassFile() returned name %q, want %q", cf.name, want)
+	}
+	if want := "org/apache/logging/log4j/core/lookup/AbstractLookup"; cf.super != want {
+		t.Errorf("parseClassFile() returned super %q, want %q", cf.super, want)
+	}
+	for i := 0; i < len(content); i++ {
+		// Only the constant pool and names are read, truncated class
+		// files mustn't panic.
+		parseClassFile(content[:i])
+	}
+	if _, err := parseClassFile(content[:len(content)/2]); err == nil {
+		t.Errorf("parseClassFile() of a truncated constant pool succeeded, want error")
+	}
+}
+
+func TestLog4jClass(t *testing.T) {
+	lookup := readEntry(t, "log4j-core-2.14.0.jar", jndiLookupClass)
+	manager := readEntry(t, "log4j-core-2.14.0.jar", "org/apache/logging/log4j/core/net/JndiManager.class")
+	other := readEntry(t, "log4j-core-2.14.0.jar", "org/apache/logging/log4j/core/lookup/AbstractLookup.class")
+	elastic := strings.NewReplacer("org/apache/logging/log4j/", "org/elasticsearch/log4j/")
+	renamed := strings.NewReplacer("JndiLookup", "JndiResolver", "JndiManager", "JndiConnector")
+	unrelated := strings.NewReplacer("org/apache/logging/log4j/core/lookup/AbstractLookup", "com/example/JndiLookup")
+
+	type result struct{ Lookup, Manager, ByContent bool }
+	tests := []struct {
+		name    string
+		path    string
+		content []byte
+		want    result
+	}{
+		{
+			name:    "JndiLookup",
+			path:    jndiLookupClass,
+			content: lookup,
+			want:    result{Lookup: true},
+		},
+		{
+			name:    "JndiManager",
+			path:    "org/apache/logging/log4j/core/net/JndiManager.class",
+			content: manager,
+			want:    result{Manager: true},
+		},
+		{
+			name:    "relocated",
+			path:    "org/elasticsearch/log4j/core/lookup/JndiLookup.class",
+			content: relocateClass(t, lookup, elastic),
+			want:    result{Lookup: true},
+		},
+		{
+			name:    "renamed lookup",
+			path:    "org/apache/logging/log4j/core/lookup/JndiResolver.class",
+			content: relocateClass(t, lookup, renamed),
+			want:    result{Lookup: true, ByContent: true},
+		},
+		{
+			name:    "renamed manager",
+			path:    "org/apache/logging/log4j/core/net/JndiConnector.class",
+			content: relocateClass(t, manager, renamed),
+			want:    result{Manager: true, ByContent: true},
+		},
+		{
+			name:    "nested class path",
+			path:    "WEB-INF/classes/org/apache/logging/log4j/core/lookup/JndiResolver.class",
+			content: relocateClass(t, lookup, renamed),
+			want:    result{Lookup: true, ByContent: true},
+		},
+		{
+			name:    "not loadable",
+			path:    "org/apache/logging/log4j/core/lookup/JndiLookupOther.class",
+			content: lookup,
+		},
+		{
+			name:    "unrelated class of the same name",
+			path:    "com/example/JndiLookup.class",
+			content: relocateClass(t, other, unrelated),
+		},
+		{
+			name:    "not a class file",
+			path:    jndiLookupClass,
+			content: []byte("class"),
+			want:    result{Lookup: true},
+		},
+		{
+			name:    "other class",
+			path:    "org/apache/logging/log4j/core/lookup/AbstractLookup.class",
+			content: other,
+		},
+	}
+	for _, tc := range tests {
+		var got result
+		got.Lookup, got.Manager, got.ByContent = log4jClass(tc.path, tc.content)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("log4jClass(%s) returned diff (-want, +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestParseRelocated(t *testing.T) {
+	relocate := strings.NewReplacer(
+		"org/apache/logging/log4j/", "org/elasticsearch/log4j/",
+		"JndiLookup", "JndiResolver",
+		"JndiManager", "JndiConnector",
+	)
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "log4j-core-2.14.0.jar", want: []string{RuleLog4j44228Constructor, RuleLog4j216Heuristic}},
+		{name: "log4j-core-2.15.0.jar", want: []string{RuleLog4j216Heuristic}},
+		{name: "log4j-core-2.16.0.jar"},
+	}
+	for _, tc := range tests {
+		data := relocateJAR(t, tc.name, relocate)
+		r, err := ParseReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("ParseReader(%s) failed: %v", tc.name, err)
+		}
+		if diff := cmp.Diff(tc.want, r.Rules); diff != "" {
+			t.Errorf("ParseReader(%s) relocated returned rules diff (-want, +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestRewriteRelocated(t *testing.T) {
+	relocate := strings.NewReplacer(
+		"org/apache/logging/log4j/", "org/elasticsearch/log4j/",
+		"JndiLookup", "JndiResolver",
+	)
+	data := relocateJAR(t, "log4j-core-2.14.0.jar", relocate)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := Rewrite(buf, zr); err != nil {
+		t.Fatalf("Rewrite failed: %v", err)
+	}
+	zr, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader of rewritten JAR failed: %v", err)
+	}
+	var got []string
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "JndiResolver.class") {
+			got = append(got, f.Name)
+		}
+	}
+	if len(got) != 0 {
+		t.Errorf("Rewrite kept relocated JndiLookup classes: %q", got)
+	}
+	if len(zr.File) < 2 {
+		t.Errorf("Rewrite kept %d entries, want the other classes too", len(zr.File))
+	}
+}
@@ -18,33 +18,102 @@ import (
 	"archive/zip"
 	"bytes"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"path"
+	"sort"
 	"strings"
 )
 
 var skipSuffixes = [...]string{
 	// Skip copying the file over to the new jar so that the new jar is immune.
 	"JndiLookup.class",
-	// Remove signing keys from the JAR.
-	".RSA",
-	// Remove any signatures from the JAR.
-	".SF",
+}
+
+// RewriteRemediates reports whether Rewrite remediates the vulnerability
+// detected by the rule with the given ID: the log4j 2 rules requiring
+// JndiLookup, which it removes. Other vulnerabilities require upgrading the
+// library instead.
+func RewriteRemediates(id string) bool {
+	return id == RuleLog4j44228Constructor || id == RuleLog4j216Heuristic
+}
+
+// signatureExts are the extensions of the files signing a JAR in META-INF:
+// the signature file and the signature blocks of each key algorithm.
+var signatureExts = map[string]bool{
+	".SF":  true,
+	".RSA": true,
+	".DSA": true,
+	".EC":  true,
+}
+
+// signatureFile reports whether an entry is part of a JAR's signature.
+func signatureFile(name string) bool {
+	dir, base := path.Split(name)
+	if dir != "META-INF/" {
+		return false
+	}
+	return signatureExts[strings.ToUpper(path.Ext(base))] || strings.HasPrefix(strings.ToUpper(base), "SIG-")
+}
+
+// signed reports whether a JAR is signed, holding both a signature file and
+// a signature block in META-INF.
+func signed(r fs.FS) bool {
+	entries, err := fs.ReadDir(r, "META-INF")
+	if err != nil {
+		return false
+	}
+	var sf, block bool
+	for _, e := range entries {
+		switch ext := strings.ToUpper(path.Ext(e.Name())); {
+		case ext == ".SF":
+			sf = true
+		case signatureExts[ext]:
+			block = true
+		}
+	}
+	return sf && block
 }
 
 // Rewrite attempts to remove any JndiLookup.class files from a JAR.
+//
+// The signature files of the JAR and the archives nested in it are removed
+// too, since removing entries invalidates the signature. The rewritten JAR is
+// unsigned, see Report.Signed.
+//
+// Entries are written in their original order. Entries other than rewritten
+// nested archives are copied without recompression, and nested archives with
+// nothing to remove are copied byte for byte. Rewritten nested archives keep
+// their compression method, and stored ones are written without a data
+// descriptor, as some class loaders require.
 func Rewrite(w io.Writer, zr *zip.Reader) error {
+	_, err := rewrite(w, zr)
+	return err
+}
+
+// rewrite implements Rewrite, reporting whether any entry was removed.
+func rewrite(w io.Writer, zr *zip.Reader) (bool, error) {
+	changed := false
 	zw := zip.NewWriter(w)
 	for _, zipItem := range zr.File {
-		skip := false
+		skip := signatureFile(zipItem.Name)
 		for _, suffix := range skipSuffixes {
 			if strings.HasSuffix(zipItem.Name, suffix) {
 				skip = true
 				break
 			}
 		}
+		if !skip && path.Ext(zipItem.Name) == ".class" {
+			relocated, err := relocatedLookup(zipItem)
+			if err != nil {
+				return false, err
+			}
+			skip = relocated
+		}
 		if skip {
+			changed = true
 			continue
 		}
 
@@ -52,11 +121,11 @@ func Rewrite(w io.Writer, zr *zip.Reader) error {
 			// Nested jar! Recur on it to ensure that nested jars are immune
 			nestedReader, err := zipItem.Open()
 			if err != nil {
-				return fmt.Errorf("failed to open nested zip %q for auto-mitigation: %v; skipping", zipItem.Name, err)
+				return false, fmt.Errorf("failed to open nested zip %q for auto-mitigation: %v; skipping", zipItem.Name, err)
 			}
 			b, err := ioutil.ReadAll(nestedReader)
 			if err != nil {
-				return fmt.Errorf("failed to read nested zip %q for auto-mitigation: %v; skipping", zipItem.Name, err)
+				return false, fmt.Errorf("failed to read nested zip %q for auto-mitigation: %v; skipping", zipItem.Name, err)
 			}
 			nestedReaderAt := bytes.NewReader(b)
 			nestedZipReader, err := zip.NewReader(nestedReaderAt, int64(len(b)))
@@ -65,14 +134,19 @@ func Rewrite(w io.Writer, zr *zip.Reader) error {
 					// Not a zip file.
 					goto copyFile
 				}
-				return fmt.Errorf("failed to create nested zip %q reader for auto-mitigation: %v; skipping", zipItem.Name, err)
+				return false, fmt.Errorf("failed to create nested zip %q reader for auto-mitigation: %v; skipping", zipItem.Name, err)
 			}
-			writer, err := zw.CreateHeader(&zipItem.FileHeader)
+			buf := &bytes.Buffer{}
+			nestedChanged, err := rewrite(buf, nestedZipReader)
 			if err != nil {
-				return fmt.Errorf("failed to create nested zip %q item for auto-mitigation: %v", zipItem.Name, err)
+				return false, fmt.Errorf("rewriting nested zip %s: %v", zipItem.Name, err)
+			}
+			if !nestedChanged {
+				goto copyFile
 			}
-			if err := Rewrite(writer, nestedZipReader); err != nil {
-				return fmt.Errorf("rewriting nested zip %s: %v", zipItem.Name, err)
+			changed = true
+			if err := writeNested(zw, &zipItem.FileHeader, buf.Bytes()); err != nil {
+				return false, fmt.Errorf("failed to create nested zip %q item for auto-mitigation: %v", zipItem.Name, err)
 			}
 			continue
 		}
@@ -81,16 +155,100 @@ func Rewrite(w io.Writer, zr *zip.Reader) error {
 		if zipItem.Mode().IsDir() {
 			// Copy() only works on files.
 			if _, err := zw.CreateRaw(&zipItem.FileHeader); err != nil {
-				return fmt.Errorf("failed to copy zip directory %s: %v", zipItem.Name, err)
+				return false, fmt.Errorf("failed to copy zip directory %s: %v", zipItem.Name, err)
 			}
 		} else {
 			if err := zw.Copy(zipItem); err != nil {
-				return fmt.Errorf("failed to copy zip file %s: %v", zipItem.Name, err)
+				return false, fmt.Errorf("failed to copy zip file %s: %v", zipItem.Name, err)
 			}
 		}
 	}
 	if err := zw.Close(); err != nil {
-		return fmt.Errorf("finalize writer: %v", err)
+		return false, fmt.Errorf("finalize writer: %v", err)
+	}
+	return changed, nil
+}
+
+// writeNested adds a rewritten nested archive to zw using the original
+// entry's header. Stored entries are written raw with their size and checksum
+// in the local header rather than a trailing data descriptor.
+func writeNested(zw *zip.Writer, orig *zip.FileHeader, b []byte) error {
+	fh := *orig
+	if fh.Method != zip.Store {
+		w, err := zw.CreateHeader(&fh)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	fh.Flags &^= 0x8 // No data descriptor.
+	fh.CRC32 = crc32.ChecksumIEEE(b)
+	fh.CompressedSize64 = uint64(len(b))
+	fh.UncompressedSize64 = uint64(len(b))
+	w, err := zw.CreateRaw(&fh)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// lookupClasses returns the JndiLookup classes of an exploded archive, fsys,
+// which rewriting it removes: those skipSuffixes match, and the relocated
+// ones. They're sorted by path.
+func lookupClasses(fsys fs.FS) ([]string, error) {
+	var classes []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || path.Ext(p) != ".class" {
+			return nil
+		}
+		for _, suffix := range skipSuffixes {
+			if strings.HasSuffix(p, suffix) {
+				classes = append(classes, p)
+				return nil
+			}
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("failed to read class %q for auto-mitigation: %v", p, err)
+		}
+		if isRelocatedLookup(p, content) {
+			classes = append(classes, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(classes)
+	return classes, nil
+}
+
+// hiddenFS is a filesystem without the hidden files, to check an exploded
+// archive as it would be once they're removed.
+type hiddenFS struct {
+	fs.FS
+	hidden map[string]bool
+}
+
+func (h hiddenFS) Open(name string) (fs.File, error) {
+	if h.hidden[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return h.FS.Open(name)
+}
+
+func (h hiddenFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(h.FS, name)
+	kept := entries[:0]
+	for _, e := range entries {
+		if !h.hidden[path.Join(name, e.Name())] {
+			kept = append(kept, e)
+		}
 	}
-	return nil
+	return kept, err
 }
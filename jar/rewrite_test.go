@@ -22,9 +22,11 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
 )
 
 func cpFile(t *testing.T, dest, src string) {
@@ -238,3 +240,168 @@ func TestAutoMitigateSignedJAR(t *testing.T) {
 		})
 	}
 }
+
+func TestRewriteNested(t *testing.T) {
+	vuln := testjar.Zip(t, zip.Deflate,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"),
+		testjar.File("org/apache/logging/log4j/core/lookup/JndiLookup.class", "class"),
+		testjar.File("org/apache/logging/log4j/core/Logger.class", "class"),
+	)
+	safe := testjar.Zip(t, zip.Deflate,
+		testjar.File("com/example/Main.class", "class"),
+	)
+	outer := testjar.Zip(t, zip.Store,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"),
+		testjar.File("BOOT-INF/lib/log4j-core-2.14.1.jar", string(vuln)),
+		testjar.File("BOOT-INF/lib/safe.jar", string(safe)),
+	)
+	zr, err := zip.NewReader(bytes.NewReader(outer), int64(len(outer)))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	var b bytes.Buffer
+	if err := Rewrite(&b, zr); err != nil {
+		t.Fatalf("Rewrite() failed: %v", err)
+	}
+	got, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader on rewritten archive failed: %v", err)
+	}
+
+	var names []string
+	for _, f := range got.File {
+		names = append(names, f.Name)
+	}
+	wantNames := []string{
+		"META-INF/MANIFEST.MF",
+		"BOOT-INF/lib/log4j-core-2.14.1.jar",
+		"BOOT-INF/lib/safe.jar",
+	}
+	if diff := cmp.Diff(wantNames, names); diff != "" {
+		t.Errorf("Rewrite() entries returned diff (-want, +got):\n%s", diff)
+	}
+
+	nested := got.File[1]
+	if nested.Method != zip.Store {
+		t.Errorf("Rewrite() nested archive method = %d, want %d (stored)", nested.Method, zip.Store)
+	}
+	if nested.Flags&0x8 != 0 {
+		t.Errorf("Rewrite() wrote a data descriptor for a stored nested archive")
+	}
+	rc, err := nested.Open()
+	if err != nil {
+		t.Fatalf("opening nested archive: %v", err)
+	}
+	nb, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("reading nested archive: %v", err)
+	}
+	nzr, err := zip.NewReader(bytes.NewReader(nb), int64(len(nb)))
+	if err != nil {
+		t.Fatalf("zip.NewReader on nested archive failed: %v", err)
+	}
+	names = nil
+	for _, f := range nzr.File {
+		names = append(names, f.Name)
+	}
+	wantNames = []string{
+		"META-INF/MANIFEST.MF",
+		"org/apache/logging/log4j/core/Logger.class",
+	}
+	if diff := cmp.Diff(wantNames, names); diff != "" {
+		t.Errorf("Rewrite() nested entries returned diff (-want, +got):\n%s", diff)
+	}
+
+	rc, err = got.File[2].Open()
+	if err != nil {
+		t.Fatalf("opening unchanged nested archive: %v", err)
+	}
+	sb, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("reading unchanged nested archive: %v", err)
+	}
+	if !bytes.Equal(sb, safe) {
+		t.Errorf("Rewrite() modified a nested archive with nothing to remove")
+	}
+}
+
+func TestLookupClasses(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		jar  []byte
+		want []string
+	}{
+		{
+			name: "log4j-core",
+			jar:  relocateJAR(t, "log4j-core-2.14.0.jar", strings.NewReplacer()),
+			want: []string{"org/apache/logging/log4j/core/lookup/JndiLookup.class"},
+		},
+		{
+			name: "relocated",
+			jar: relocateJAR(t, "log4j-core-2.14.0.jar", strings.NewReplacer(
+				"org/apache/logging/log4j/", "org/elasticsearch/log4j/",
+				"JndiLookup", "JndiResolver",
+			)),
+			want: []string{"org/elasticsearch/log4j/core/lookup/JndiResolver.class"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			zr, err := zip.NewReader(bytes.NewReader(tc.jar), int64(len(tc.jar)))
+			if err != nil {
+				t.Fatalf("zip.NewReader failed: %v", err)
+			}
+			got, err := lookupClasses(zr)
+			if err != nil {
+				t.Fatalf("lookupClasses() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("lookupClasses() returned diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRewriteSignatureFiles(t *testing.T) {
+	data := testjar.Zip(t, zip.Deflate,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"),
+		testjar.File("META-INF/KEY.SF", "Signature-Version: 1.0\n"),
+		testjar.File("META-INF/KEY.DSA", "block"),
+		testjar.File("META-INF/OTHER.ec", "block"),
+		testjar.File("META-INF/SIG-KEY.XYZ", "block"),
+		testjar.File("META-INF/maven/org.example/app/pom.properties", "version=1.0\n"),
+		testjar.File("docs/notes.SF", "not a signature"),
+		testjar.File("org/apache/logging/log4j/core/lookup/JndiLookup.class", "class"),
+	)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	if !signed(zr) {
+		t.Errorf("signed() = false for a signed JAR")
+	}
+	var b bytes.Buffer
+	if err := Rewrite(&b, zr); err != nil {
+		t.Fatalf("Rewrite() failed: %v", err)
+	}
+	got, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader on rewritten archive failed: %v", err)
+	}
+	if signed(got) {
+		t.Errorf("signed() = true for a rewritten JAR")
+	}
+	var names []string
+	for _, f := range got.File {
+		names = append(names, f.Name)
+	}
+	want := []string{
+		"META-INF/MANIFEST.MF",
+		"META-INF/maven/org.example/app/pom.properties",
+		"docs/notes.SF",
+	}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("Rewrite() entries returned diff (-want, +got):\n%s", diff)
+	}
+}
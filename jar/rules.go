@@ -0,0 +1,477 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IDs of the built-in detection rules. IDs are stable across releases, so they
+// can be referenced by configuration and downstream tooling.
+const (
+	// RuleLog4j44228Constructor matches JndiLookup alongside a JndiManager
+	// with the constructor removed in 2.15.0.
+	RuleLog4j44228Constructor = "LOG4J-44228-CONSTRUCTOR"
+	// RuleLog4j216Heuristic matches JndiLookup alongside a JndiManager
+	// without the isJndiEnabled method added in 2.16.0. It's a heuristic
+	// that may misfire on repackaged or future versions of log4j.
+	RuleLog4j216Heuristic = "LOG4J-216-HEURISTIC"
+	// RuleLog4j44832JDBC matches the JDBC appender's
+	// DataSourceConnectionSource alongside a JndiManager without the
+	// isJndiJdbcEnabled method added in 2.17.1. It's opt-in.
+	RuleLog4j44832JDBC = "LOG4J-44832-JDBC"
+
+	// The log4j 1.x rules match classes of log4j 1.x components with
+	// vulnerabilities that won't be fixed, since log4j 1.x is end of life.
+	// They're opt-in, see Config.Log4j1.
+	RuleLog4j1JMSAppender  = "LOG4J1-4104-JMSAPPENDER"
+	RuleLog4j1SocketServer = "LOG4J1-17571-SOCKETSERVER"
+	RuleLog4j1JMSSink      = "LOG4J1-23302-JMSSINK"
+	RuleLog4j1JDBCAppender = "LOG4J1-23305-JDBCAPPENDER"
+	RuleLog4j1Chainsaw     = "LOG4J1-23307-CHAINSAW"
+)
+
+// Rule is a detection, either built-in or registered with RegisterRule.
+type Rule struct {
+	// ID is the stable identifier of the rule, such as
+	// "LOG4J-44228-CONSTRUCTOR".
+	ID string
+	// CVE is the vulnerability reported when the rule matches.
+	CVE string
+	// Description explains what the rule matches.
+	Description string
+	// OptIn rules are only evaluated if enabled by Config.EnableRules or
+	// Config.CVEs. They detect vulnerabilities of versions that are fixed
+	// for the default rules, which require an unusual configuration to
+	// exploit.
+	OptIn bool
+
+	// Log4j1 rules detect vulnerabilities of log4j 1.x, reported apart from
+	// log4j 2 in Report.Log4j1.
+	Log4j1 bool
+
+	// Matcher matches the classes of custom rules and of the log4j 1.x
+	// rules. It's nil for the other built-in rules, which are evaluated by
+	// the scanner itself.
+	Matcher Matcher
+	// ComponentMatcher matches the components of custom rules by their
+	// Maven metadata, such as to detect vulnerable versions of a library
+	// without fingerprinting its classes. Custom rules have a Matcher, a
+	// ComponentMatcher, or both.
+	ComponentMatcher ComponentMatcher
+	// Severity is the severity of a custom rule's CVE, if it isn't one of
+	// the vulnerabilities detected by this package.
+	Severity Severity
+}
+
+// Matcher matches the classes of a JAR, at any depth of nesting. It must be
+// safe for concurrent use, since rules are shared by every scan.
+type Matcher interface {
+	// Match returns the offset of the match in the content of the class
+	// at path p, or -1 if the class doesn't match. p is the path the class
+	// would have at the root of a plain JAR, such as
+	// "org/apache/log4j/net/JMSAppender.class" for the classes/ of a JMOD
+	// file or the META-INF/versions/<N>/ of a multi-release JAR too.
+	Match(p string, content []byte) int
+}
+
+// ComponentMatcher matches the components of a JAR identified by their Maven
+// metadata, at any depth of nesting. It must be safe for concurrent use, since
+// rules are shared by every scan.
+type ComponentMatcher interface {
+	// MatchComponent reports if the component matches. Its SHA256 isn't
+	// set.
+	MatchComponent(c Component) bool
+}
+
+// RegisterRule adds a custom rule, which is then evaluated like the
+// built-in rules, enabled by default unless it's OptIn. It must be called
+// before scanning, such as at startup, since Rules isn't safe to modify
+// concurrently with scans.
+func RegisterRule(r Rule) error {
+	if r.ID == "" {
+		return fmt.Errorf("rule has no ID")
+	}
+	if _, ok := LookupRule(r.ID); ok {
+		return fmt.Errorf("rule %s already exists", r.ID)
+	}
+	if r.Matcher == nil && r.ComponentMatcher == nil {
+		return fmt.Errorf("rule %s has no matcher", r.ID)
+	}
+	if r.CVE == "" {
+		return fmt.Errorf("rule %s has no CVE", r.ID)
+	}
+	if s := CVESeverity(r.CVE); s == SeverityNone {
+		if r.Severity == SeverityNone {
+			return fmt.Errorf("rule %s has no severity for %s", r.ID, r.CVE)
+		}
+		cveSeverity[r.CVE] = r.Severity
+	}
+	Rules = append(Rules, r)
+	return nil
+}
+
+// Rules holds the built-in detection rules.
+var Rules = []Rule{
+	{
+		ID:          RuleLog4j44228Constructor,
+		CVE:         CVE202144228,
+		Description: "JndiLookup.class and a JndiManager constructor taking a javax.naming.Context, removed in 2.15.0",
+	},
+	{
+		ID:          RuleLog4j216Heuristic,
+		CVE:         CVE202145046,
+		Description: "JndiLookup.class and a JndiManager without isJndiEnabled, added in 2.16.0",
+	},
+	{
+		ID:          RuleLog4j44832JDBC,
+		CVE:         CVE202144832,
+		Description: "The JDBC appender's DataSourceConnectionSource and a JndiManager without isJndiJdbcEnabled, added in 2.17.1",
+		OptIn:       true,
+	},
+	log4j1Rule(RuleLog4j1JMSAppender, CVE20214104, "org/apache/log4j/net/JMSAppender.class",
+		"log4j 1.x JMSAppender, which performs JNDI lookups of its configuration"),
+	log4j1Rule(RuleLog4j1SocketServer, CVE201917571, "org/apache/log4j/net/SocketServer.class",
+		"log4j 1.x SocketServer, which deserializes untrusted log events"),
+	log4j1Rule(RuleLog4j1JMSSink, CVE202223302, "org/apache/log4j/net/JMSSink.class",
+		"log4j 1.x JMSSink, which performs JNDI lookups of its configuration"),
+	log4j1Rule(RuleLog4j1JDBCAppender, CVE202223305, "org/apache/log4j/jdbc/JDBCAppender.class",
+		"log4j 1.x JDBCAppender, which is open to SQL injection through logged messages"),
+	log4j1Rule(RuleLog4j1Chainsaw, CVE202223307, "org/apache/log4j/chainsaw/LoggingReceiver.class",
+		"log4j 1.x Chainsaw, which deserializes untrusted log events"),
+}
+
+// log4j1Rule returns an opt-in log4j 1.x rule matching the presence of a
+// class.
+func log4j1Rule(id, cve, class, description string) Rule {
+	return Rule{
+		ID:          id,
+		CVE:         cve,
+		Description: description,
+		OptIn:       true,
+		Log4j1:      true,
+		Matcher:     classMatcher(class),
+	}
+}
+
+// classMatcher matches a class by its path.
+type classMatcher string
+
+func (m classMatcher) Match(p string, content []byte) int {
+	if p != string(m) {
+		return -1
+	}
+	return 0
+}
+
+// LookupRule returns the built-in rule with the given ID.
+func LookupRule(id string) (Rule, bool) {
+	for _, r := range Rules {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Config configures scanning. The zero value enables every rule that isn't
+// OptIn.
+//
+// The rules of a Config are compiled when it's first used to scan, and shared
+// read-only by every scan using it, such as concurrent workers or requests.
+// A Config mustn't be modified once used, see SharedConfig to change the
+// rules of a running process.
+type Config struct {
+	// EnableRules and CVEs, if either is non-empty, select the only rules
+	// to evaluate: the rules with the IDs of EnableRules, and the rules
+	// detecting the vulnerabilities of CVEs, such as CVE202144832.
+	EnableRules []string
+	CVEs        []string
+	// DisableRules holds the IDs of rules not to evaluate. It takes
+	// precedence over EnableRules.
+	DisableRules []string
+
+	// SpillThreshold is the number of bytes of nested archives held in
+	// memory while scanning a JAR. Nested archives that would exceed it are
+	// decompressed to a temporary file and scanned from disk instead.
+	// Defaults to 4GiB. Nested archives stored without compression are
+	// read in place from the file holding the JAR if it's known, as with
+	// ParseAny and the Walker, and neither held in memory nor spilled.
+	SpillThreshold int64
+	// SpillDir is the directory of temporary files. Defaults to
+	// os.TempDir.
+	SpillDir string
+	// MemoryBudget, if provided, bounds the bytes of nested archives held in
+	// memory across every JAR scanned with this configuration, such as by
+	// concurrent workers. Nested archives that don't fit in what's left of
+	// it are spilled to disk, as if over SpillThreshold.
+	MemoryBudget *MemoryBudget
+	// RateLimit, if provided, paces the archives opened by a Walker, and
+	// the bytes read from archives, including ParseReaderAt's, and written
+	// to and read from spilled nested archives.
+	RateLimit RateLimiter
+
+	// Log4j1 enables the log4j 1.x rules, in addition to the rules
+	// selected by the fields above.
+	Log4j1 bool
+
+	// Passwords are tried in turn to decrypt encrypted entries, using
+	// either ZipCrypto or WinZip AES.
+	Passwords []string
+
+	// MaxRatio is the largest ratio of the uncompressed to the compressed
+	// size of an entry over 1MiB, declared or read, and
+	// MaxDecompressedBytes the most bytes decompressed scanning an
+	// archive, nested archives included. Archives exceeding either fail
+	// with an error matching ErrZipBomb. They default to 100 and 64GiB,
+	// negative values disable them.
+	MaxRatio             int
+	MaxDecompressedBytes int64
+
+	// BestEffort records the entries that can't be scanned, such as
+	// corrupt or too deeply nested ones, in Report.Errors and goes on
+	// scanning the rest of the archive, rather than failing the scan with
+	// an *EntryError. Zip bombs and timeouts still fail the scan.
+	BestEffort bool
+
+	// Salvage scans what can be recovered of corrupt archives that
+	// archive/zip rejects, such as truncated ones or those whose central
+	// directory is partly overwritten, nested archives included, rather
+	// than failing their scan. The entries listed by the readable records
+	// of the central directory are scanned, and the entries found by their
+	// local file headers if it's missing. Report.Salvaged is set, and
+	// entries that couldn't be recovered are recorded in Report.Errors.
+	// Salvage implies BestEffort.
+	Salvage bool
+
+	// Inventory collects every Java library found in Report.Components,
+	// not only log4j, identified by its Maven metadata or manifest. JARs
+	// are then read in full even once known to be vulnerable.
+	Inventory bool
+
+	// Timeout, if positive, bounds the time Parse and ParseAny spend on an
+	// archive, including the archives nested in it. Scans that take longer
+	// fail with a *TimeoutError.
+	Timeout time.Duration
+
+	compileOnce sync.Once
+	compiled    *ruleSet
+}
+
+// ruleSet is the compiled form of the rules enabled by a Config. It's never
+// modified once compiled.
+type ruleSet struct {
+	enabled map[string]bool
+	// components reports if any enabled rule has a ComponentMatcher, so
+	// Maven metadata is read.
+	components bool
+	// key identifies the enabled rules, see Config.key.
+	key string
+}
+
+// spill returns where and when archives read by the configuration are
+// buffered.
+func (c *Config) spill() spillConfig {
+	if c == nil {
+		c = defaultConfig
+	}
+	return spillConfig{maxMemory: c.SpillThreshold, dir: c.SpillDir, budget: c.MemoryBudget, limit: c.RateLimit}
+}
+
+// newChecker returns a checker evaluating the configured rules.
+func (c *Config) newChecker() checker {
+	if c == nil {
+		c = defaultConfig
+	}
+	return checker{
+		ctx:            context.Background(),
+		rules:          c.enabled(),
+		componentRules: c.rules().components,
+		spill:          c.spill(),
+		passwords:      c.Passwords,
+		limits:         c.limits(),
+		bestEffort:     c.BestEffort || c.Salvage,
+		salvage:        c.Salvage,
+		inventory:      c.Inventory,
+	}
+}
+
+// defaultConfig is used by Parse.
+var defaultConfig = &Config{}
+
+// Validate returns an error if the configuration references unknown rules.
+func (c *Config) Validate() error {
+	for _, ids := range [][]string{c.EnableRules, c.DisableRules} {
+		for _, id := range ids {
+			if _, ok := LookupRule(id); !ok {
+				return fmt.Errorf("unknown rule %q, expected one of %s", id, strings.Join(ruleIDs(), ", "))
+			}
+		}
+	}
+	for _, cve := range c.CVEs {
+		if CVESeverity(cve) == SeverityNone {
+			return fmt.Errorf("unknown CVE %q, expected one of %s", cve, strings.Join(ruleCVEs(), ", "))
+		}
+	}
+	return nil
+}
+
+// EnabledRules returns the IDs of the rules the configuration evaluates, in
+// the order of Rules.
+func (c *Config) EnabledRules() []string {
+	enabled := c.enabled()
+	var ids []string
+	for _, r := range Rules {
+		if enabled[r.ID] {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// enabled returns the set of rules to evaluate. The set is shared, and
+// mustn't be modified.
+func (c *Config) enabled() map[string]bool {
+	return c.rules().enabled
+}
+
+// rules returns the compiled rules of the configuration, compiling them on
+// first use.
+func (c *Config) rules() *ruleSet {
+	if c == nil {
+		c = defaultConfig
+	}
+	c.compileOnce.Do(func() {
+		rules := c.compile()
+		var ids []string
+		for id := range rules {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		c.compiled = &ruleSet{enabled: rules, key: strings.Join(ids, ",")}
+		for _, r := range Rules {
+			if rules[r.ID] && r.ComponentMatcher != nil {
+				c.compiled.components = true
+			}
+		}
+	})
+	return c.compiled
+}
+
+// compile returns the set of rules enabled by the configuration.
+func (c *Config) compile() map[string]bool {
+	rules := map[string]bool{}
+	if len(c.EnableRules) == 0 && len(c.CVEs) == 0 {
+		for _, r := range Rules {
+			if !r.OptIn {
+				rules[r.ID] = true
+			}
+		}
+	}
+	for _, id := range c.EnableRules {
+		rules[id] = true
+	}
+	for _, cve := range c.CVEs {
+		for _, r := range Rules {
+			if r.CVE == cve {
+				rules[r.ID] = true
+			}
+		}
+	}
+	if c.Log4j1 {
+		for _, r := range Rules {
+			if r.Log4j1 {
+				rules[r.ID] = true
+			}
+		}
+	}
+	for _, id := range c.DisableRules {
+		delete(rules, id)
+	}
+	return rules
+}
+
+// key identifies the rules evaluated by the configuration, and if it collects
+// an inventory, so cached reports of other configurations aren't reused.
+func (c *Config) key() string {
+	if c != nil && c.Inventory {
+		return c.rules().key + ";inventory"
+	}
+	return c.rules().key
+}
+
+// SharedConfig holds the Config of a long running process, such as a server,
+// which can be replaced while scans are running. Scans keep the Config they
+// started with, and later scans use the replacement. It's safe for
+// concurrent use.
+type SharedConfig struct {
+	v atomic.Value
+}
+
+// NewSharedConfig returns a SharedConfig holding c, which mustn't be modified
+// afterwards. A nil Config is the zero Config.
+func NewSharedConfig(c *Config) (*SharedConfig, error) {
+	s := &SharedConfig{}
+	if err := s.Store(c); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load returns the current Config.
+func (s *SharedConfig) Load() *Config {
+	return s.v.Load().(*Config)
+}
+
+// Store validates c and compiles its rules, then replaces the current Config
+// with it. If c is invalid, the current Config is kept. c mustn't be modified
+// afterwards.
+func (s *SharedConfig) Store(c *Config) error {
+	if c == nil {
+		c = &Config{}
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	c.rules()
+	s.v.Store(c)
+	return nil
+}
+
+func ruleIDs() []string {
+	var ids []string
+	for _, r := range Rules {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func ruleCVEs() []string {
+	var cves []string
+	seen := map[string]bool{}
+	for _, r := range Rules {
+		if !seen[r.CVE] {
+			seen[r.CVE] = true
+			cves = append(cves, r.CVE)
+		}
+	}
+	return cves
+}
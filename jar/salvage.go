@@ -0,0 +1,352 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// ZIP record signatures and sizes, see APPNOTE.TXT.
+const (
+	localHeaderSig = 0x04034b50
+	centralSig     = 0x02014b50
+	endSig         = 0x06054b50
+	descriptorSig  = 0x08074b50
+	localHeaderLen = 30
+	centralLen     = 46
+	endLen         = 22
+	maxCommentLen  = 65535
+	flagDescriptor = 0x8
+)
+
+// centralDirEntry is the Path of an EntryError for records of the central
+// directory that couldn't be recovered, whose names aren't known.
+const centralDirEntry = "(central directory)"
+
+// maxSalvageRatio bounds the bytes decompressed to find the end of an entry
+// with a data descriptor, whose size isn't in its local header, to this many
+// times the bytes left in the file, like Config.MaxRatio's default. Without
+// a bound, a small zip bomb would be decompressed in full.
+const maxSalvageRatio = 100
+
+// salvaged is what could be recovered of a corrupt archive.
+type salvaged struct {
+	// zr reads the recovered entries from ra, which holds the original
+	// file followed by a central directory rebuilt for them.
+	zr *zip.Reader
+	ra io.ReaderAt
+	// size is the length of ra.
+	size int64
+	// lost are the entries that couldn't be recovered. Their Path is
+	// relative to the archive.
+	lost []EntryError
+}
+
+// salvage recovers the entries of an archive that zip.NewReader rejects, such
+// as a truncated one or one whose central directory is partly corrupt. The
+// records of the central directory that can be read are kept, and entries
+// are found by their local file headers if it's missing. A central directory
+// listing them is then appended to the file, so the entries are read by
+// archive/zip like any other's. zip.ErrFormat is returned if nothing could be
+// recovered.
+func salvage(ra io.ReaderAt, size int64) (*salvaged, error) {
+	if size > math.MaxUint32 {
+		return nil, fmt.Errorf("archive of %d bytes too large to salvage", size)
+	}
+	var records [][]byte
+	offsets := map[uint32]bool{}
+	declared := 0
+	if central, n, ok := readCentral(ra, size); ok {
+		declared = n
+		for _, rec := range central {
+			off := binary.LittleEndian.Uint32(rec[42:])
+			if !hasLocalHeader(ra, int64(off)) {
+				continue
+			}
+			offsets[off] = true
+			records = append(records, rec)
+		}
+	}
+	local, lost, _ := readLocal(ra, firstLocal(ra, offsets), size, offsets)
+	records = append(records, local...)
+	if found := len(records); declared > found {
+		lost = append(lost, EntryError{
+			Path: centralDirEntry,
+			Kind: ErrCorruptEntry,
+			Err:  fmt.Errorf("%d of %d entries couldn't be recovered", declared-found, declared),
+		})
+	}
+	return appendCentral(ra, size, records, lost)
+}
+
+// appendCentral returns the salvaged archive of the entries of ra listed by
+// the central directory records, by appending a central directory of them
+// to the size bytes of ra. zip.ErrFormat is returned if there are no records,
+// or more than a central directory without ZIP64 records can hold.
+func appendCentral(ra io.ReaderAt, size int64, records [][]byte, lost []EntryError) (*salvaged, error) {
+	if len(records) == 0 || len(records) > math.MaxUint16 {
+		return nil, zip.ErrFormat
+	}
+	var dir bytes.Buffer
+	for _, rec := range records {
+		dir.Write(rec)
+	}
+	end := make([]byte, endLen)
+	binary.LittleEndian.PutUint32(end[0:], endSig)
+	binary.LittleEndian.PutUint16(end[8:], uint16(len(records)))
+	binary.LittleEndian.PutUint16(end[10:], uint16(len(records)))
+	binary.LittleEndian.PutUint32(end[12:], uint32(dir.Len()))
+	binary.LittleEndian.PutUint32(end[16:], uint32(size))
+	dir.Write(end)
+	s := &salvaged{lost: lost, size: size + int64(dir.Len())}
+	s.ra = &appendedReaderAt{ra: ra, size: size, tail: dir.Bytes()}
+	zr, err := zip.NewReader(s.ra, s.size)
+	if err != nil {
+		return nil, fmt.Errorf("reading recovered entries: %v", err)
+	}
+	s.zr = zr
+	return s, nil
+}
+
+// readCentral returns the records of the central directory that can be read,
+// up to the first corrupt one, and the number of entries it declares. ok is
+// false if there's no end of central directory record.
+func readCentral(ra io.ReaderAt, size int64) (records [][]byte, declared int, ok bool) {
+	tailLen := int64(endLen + maxCommentLen)
+	if tailLen > size {
+		tailLen = size
+	}
+	tail := make([]byte, tailLen)
+	if _, err := ra.ReadAt(tail, size-tailLen); err != nil && err != io.EOF {
+		return nil, 0, false
+	}
+	i := bytes.LastIndex(tail, []byte("PK\x05\x06"))
+	if i < 0 || len(tail)-i < endLen {
+		return nil, 0, false
+	}
+	end := tail[i:]
+	declared = int(binary.LittleEndian.Uint16(end[10:]))
+	off := int64(binary.LittleEndian.Uint32(end[16:]))
+	for len(records) < declared && off+centralLen <= size {
+		fixed := make([]byte, centralLen)
+		if _, err := ra.ReadAt(fixed, off); err != nil || binary.LittleEndian.Uint32(fixed) != centralSig {
+			break
+		}
+		n := int64(binary.LittleEndian.Uint16(fixed[28:])) +
+			int64(binary.LittleEndian.Uint16(fixed[30:])) +
+			int64(binary.LittleEndian.Uint16(fixed[32:]))
+		if off+centralLen+n > size {
+			break
+		}
+		rec := make([]byte, centralLen+n)
+		copy(rec, fixed)
+		if _, err := ra.ReadAt(rec[centralLen:], off+centralLen); err != nil {
+			break
+		}
+		records = append(records, rec)
+		off += centralLen + n
+	}
+	return records, declared, true
+}
+
+// hasLocalHeader reports whether a local file header starts at off.
+func hasLocalHeader(ra io.ReaderAt, off int64) bool {
+	b := make([]byte, 4)
+	_, err := ra.ReadAt(b, off)
+	return err == nil && binary.LittleEndian.Uint32(b) == localHeaderSig
+}
+
+// firstLocal returns the offset of the first local file header: the start of
+// the file, or past a launch script or self-extractor stub the lowest of the
+// known offsets, or -1 if there's none.
+func firstLocal(ra io.ReaderAt, known map[uint32]bool) int64 {
+	if hasLocalHeader(ra, 0) {
+		return 0
+	}
+	first := int64(-1)
+	for off := range known {
+		if first < 0 || int64(off) < first {
+			first = int64(off)
+		}
+	}
+	return first
+}
+
+// readLocal walks the local file headers of an archive from off, returning
+// central directory records for the entries that aren't at one of the known
+// offsets, the entries that were cut short, and the offset the walk stopped
+// at, past the last entry read. The walk stops at the first entry whose end
+// can't be found.
+func readLocal(ra io.ReaderAt, off, size int64, known map[uint32]bool) (records [][]byte, lost []EntryError, end int64) {
+	if off < 0 {
+		return nil, nil, 0
+	}
+	for off+localHeaderLen <= size {
+		h := make([]byte, localHeaderLen)
+		if _, err := ra.ReadAt(h, off); err != nil || binary.LittleEndian.Uint32(h) != localHeaderSig {
+			break
+		}
+		nameLen := int64(binary.LittleEndian.Uint16(h[26:]))
+		extraLen := int64(binary.LittleEndian.Uint16(h[28:]))
+		name := make([]byte, nameLen)
+		if _, err := ra.ReadAt(name, off+localHeaderLen); err != nil {
+			break
+		}
+		data := off + localHeaderLen + nameLen + extraLen
+		flags := binary.LittleEndian.Uint16(h[6:])
+		method := binary.LittleEndian.Uint16(h[8:])
+		crc := binary.LittleEndian.Uint32(h[14:])
+		csize := int64(binary.LittleEndian.Uint32(h[18:]))
+		usize := binary.LittleEndian.Uint32(h[22:])
+		next := data + csize
+		if flags&flagDescriptor != 0 {
+			var err error
+			if csize, crc, usize, err = inflatedEntry(ra, data, size, method); err != nil {
+				lost = append(lost, EntryError{Path: string(name), Kind: ErrCorruptEntry, Err: err})
+				break
+			}
+			next = skipDescriptor(ra, data+csize)
+		} else if csize == math.MaxUint32 {
+			lost = append(lost, EntryError{Path: string(name), Kind: ErrCorruptEntry, Err: errors.New("ZIP64 entry without a central directory")})
+			break
+		}
+		if next > size {
+			lost = append(lost, EntryError{Path: string(name), Kind: ErrCorruptEntry, Err: fmt.Errorf("truncated, %d of %d bytes present", size-data, csize)})
+			break
+		}
+		if !known[uint32(off)] {
+			rec := make([]byte, centralLen+nameLen)
+			binary.LittleEndian.PutUint32(rec[0:], centralSig)
+			binary.LittleEndian.PutUint16(rec[4:], 20)
+			copy(rec[6:10], h[4:8])
+			// The checksum and sizes are in the record, so the data
+			// descriptor isn't read.
+			binary.LittleEndian.PutUint16(rec[8:], flags&^flagDescriptor)
+			copy(rec[10:16], h[8:14])
+			binary.LittleEndian.PutUint32(rec[16:], crc)
+			binary.LittleEndian.PutUint32(rec[20:], uint32(csize))
+			binary.LittleEndian.PutUint32(rec[24:], usize)
+			binary.LittleEndian.PutUint16(rec[28:], uint16(nameLen))
+			binary.LittleEndian.PutUint32(rec[42:], uint32(off))
+			copy(rec[centralLen:], name)
+			records = append(records, rec)
+		}
+		off = next
+	}
+	return records, lost, off
+}
+
+// inflatedEntry returns the compressed size, checksum, and uncompressed size
+// of an entry with a data descriptor starting at off, by decompressing it.
+// Only deflated entries can be measured, stored ones have no end marker.
+func inflatedEntry(ra io.ReaderAt, off, size int64, method uint16) (int64, uint32, uint32, error) {
+	if method != zip.Deflate {
+		return 0, 0, 0, fmt.Errorf("can't find the end of an entry with method %d and a data descriptor", method)
+	}
+	cr := &countingReader{r: bufio.NewReader(io.NewSectionReader(ra, off, size-off))}
+	fr := flate.NewReader(cr)
+	defer fr.Close()
+	limit := maxSalvageRatio * (size - off)
+	if limit > math.MaxUint32 {
+		limit = math.MaxUint32
+	}
+	h := crc32.NewIEEE()
+	n, err := io.Copy(h, io.LimitReader(fr, limit+1))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("decompressing: %v", err)
+	}
+	if n > limit {
+		return 0, 0, 0, fmt.Errorf("decompresses to over %d bytes", limit)
+	}
+	return cr.n, h.Sum32(), uint32(n), nil
+}
+
+// skipDescriptor returns the offset past the data descriptor at off, which
+// may or may not start with a signature.
+func skipDescriptor(ra io.ReaderAt, off int64) int64 {
+	b := make([]byte, 4)
+	if _, err := ra.ReadAt(b, off); err == nil && binary.LittleEndian.Uint32(b) == descriptorSig {
+		return off + 16
+	}
+	return off + 12
+}
+
+// countingReader counts the bytes read through it. It implements
+// io.ByteReader, so flate doesn't read past the end of the compressed data.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// appendedReaderAt reads size bytes of ra followed by tail.
+type appendedReaderAt struct {
+	ra   io.ReaderAt
+	size int64
+	tail []byte
+}
+
+func (a *appendedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < a.size {
+		m := p
+		if int64(len(m)) > a.size-off {
+			m = m[:a.size-off]
+		}
+		var err error
+		n, err = a.ra.ReadAt(m, off)
+		if n < len(m) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+	if n == len(p) {
+		return n, nil
+	}
+	toff := off + int64(n) - a.size
+	if toff >= int64(len(a.tail)) {
+		return n, io.EOF
+	}
+	m := copy(p[n:], a.tail[toff:])
+	n += m
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+// paddedJAR returns the entries of vuln-class.jar followed by an entry of n
+// incompressible bytes, named "zz/padding", and the offset of its data. Every
+// entry is written with a data descriptor, so its size isn't in its local
+// file header.
+func paddedJAR(t *testing.T, n int) ([]byte, int64) {
+	t.Helper()
+	src, err := zip.OpenReader(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer src.Close()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range src.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatalf("creating %s: %v", f.Name, err)
+		}
+		if _, err := io.Copy(w, rc); err != nil {
+			t.Fatalf("copying %s: %v", f.Name, err)
+		}
+		rc.Close()
+	}
+	w, err := zw.Create("zz/padding")
+	if err != nil {
+		t.Fatalf("creating padding: %v", err)
+	}
+	if _, err := io.CopyN(w, rand.New(rand.NewSource(1)), int64(n)); err != nil {
+		t.Fatalf("writing padding: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	data := b.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	off, err := zr.File[len(zr.File)-1].DataOffset()
+	if err != nil {
+		t.Fatalf("DataOffset() failed: %v", err)
+	}
+	return data, off
+}
+
+func TestSalvage(t *testing.T) {
+	data, padding := paddedJAR(t, 4096)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	entries := len(zr.File)
+
+	// Overwrite the start of the central directory, whose offset is in the
+	// end of central directory record.
+	corruptDir := append([]byte(nil), data...)
+	dir := binary.LittleEndian.Uint32(data[len(data)-endLen+16:])
+	copy(corruptDir[dir:], make([]byte, 200))
+
+	nested := testjar.Zip(t, zip.Store,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"),
+		testjar.File("lib/vuln.jar", string(data[:padding+100])),
+	)
+
+	tests := []struct {
+		name string
+		data []byte
+		// entries is the number of entries recovered, and errors the
+		// paths of those that weren't.
+		entries int
+		errors  []string
+	}{
+		{
+			name:    "Truncated",
+			data:    data[:padding+100],
+			entries: entries - 1,
+			errors:  []string{"zz/padding"},
+		},
+		{
+			name:    "CorruptCentralDirectory",
+			data:    corruptDir,
+			entries: entries,
+		},
+		{
+			name:    "Nested",
+			data:    nested,
+			entries: -1,
+			errors:  []string{"lib/vuln.jar!zz/padding"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ra := bytes.NewReader(tc.data)
+			if tc.entries >= 0 {
+				if _, err := zip.NewReader(ra, ra.Size()); err == nil {
+					t.Fatalf("zip.NewReader() accepted the corrupt archive")
+				}
+				if _, err := (&Config{}).ParseReaderAt(context.Background(), ra, ra.Size()); err == nil {
+					t.Errorf("ParseReaderAt() without Salvage succeeded, want error")
+				}
+				s, err := salvage(ra, ra.Size())
+				if err != nil {
+					t.Fatalf("salvage() failed: %v", err)
+				}
+				if got := len(s.zr.File); got != tc.entries {
+					t.Errorf("salvage() recovered %d entries, want %d", got, tc.entries)
+				}
+			}
+
+			r, err := (&Config{Salvage: true}).ParseReaderAt(context.Background(), ra, ra.Size())
+			if err != nil {
+				t.Fatalf("ParseReaderAt() with Salvage failed: %v", err)
+			}
+			if !r.Vulnerable || !r.Salvaged {
+				t.Errorf("ParseReaderAt() returned vulnerable %t, salvaged %t, want true, true", r.Vulnerable, r.Salvaged)
+			}
+			var got []string
+			for _, e := range r.Errors {
+				got = append(got, e.Path)
+			}
+			if diff := cmp.Diff(tc.errors, got); diff != "" {
+				t.Errorf("ParseReaderAt() returned errors diff (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestSalvageNotArchive(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		[]byte("not an archive"),
+		[]byte("PK\x03\x04 truncated header"),
+	} {
+		if _, err := salvage(bytes.NewReader(data), int64(len(data))); err != zip.ErrFormat {
+			t.Errorf("salvage(%q) returned %v, want %v", data, err, zip.ErrFormat)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Vulnerabilities detected by this package.
+const (
+	// CVE202144228 is remote code execution through JNDI lookups, fixed in
+	// 2.15.0.
+	CVE202144228 = "CVE-2021-44228"
+	// CVE202145046 is the incomplete fix of CVE-2021-44228 in 2.15.0, fixed
+	// in 2.16.0.
+	CVE202145046 = "CVE-2021-45046"
+	// CVE202144832 is remote code execution through a JNDI data source of
+	// the JDBC appender, by an attacker able to modify the logging
+	// configuration, fixed in 2.17.1.
+	CVE202144832 = "CVE-2021-44832"
+
+	// Vulnerabilities of log4j 1.x, which is end of life and won't be
+	// fixed. CVE20214104 is the JNDI lookup of JMSAppender's
+	// configuration, the counterpart of CVE-2021-44228.
+	CVE20214104  = "CVE-2021-4104"
+	CVE201917571 = "CVE-2019-17571"
+	CVE202223302 = "CVE-2022-23302"
+	CVE202223305 = "CVE-2022-23305"
+	CVE202223307 = "CVE-2022-23307"
+)
+
+// Severity ranks findings. Higher values are more severe.
+type Severity int
+
+// Severities, from least to most severe.
+const (
+	SeverityNone Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{
+	SeverityNone:     "none",
+	SeverityLow:      "low",
+	SeverityMedium:   "medium",
+	SeverityHigh:     "high",
+	SeverityCritical: "critical",
+}
+
+// String returns the lowercase name of the severity, such as "critical".
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses a severity name, as returned by Severity.String.
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q, expected one of %s", s, strings.Join(severityNames, ", "))
+}
+
+// MarshalText encodes the severity as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity name.
+func (s *Severity) UnmarshalText(b []byte) error {
+	sev, err := ParseSeverity(string(b))
+	if err != nil {
+		return err
+	}
+	*s = sev
+	return nil
+}
+
+// cveSeverity holds the severity of each vulnerability, taken from the CVSS
+// base scores assigned by the NVD.
+var cveSeverity = map[string]Severity{
+	CVE202144228: SeverityCritical,
+	CVE202145046: SeverityCritical,
+	CVE202144832: SeverityMedium,
+	CVE20214104:  SeverityHigh,
+	CVE201917571: SeverityCritical,
+	CVE202223302: SeverityHigh,
+	CVE202223305: SeverityCritical,
+	CVE202223307: SeverityHigh,
+}
+
+// CVESeverity returns the severity of a vulnerability detected by this
+// package, or SeverityNone if the CVE is unknown.
+func CVESeverity(cve string) Severity {
+	return cveSeverity[cve]
+}
+
+// Severity returns the highest severity of the report's vulnerabilities.
+func (r *Report) Severity() Severity {
+	s := SeverityNone
+	for _, cve := range r.CVEs {
+		if cs := CVESeverity(cve); cs > s {
+			s = cs
+		}
+	}
+	return s
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"log4jscanner/readonly"
+)
+
+// spillReserve is disk space left free when spilling, so a scan doesn't fill
+// the disk for other processes.
+const spillReserve = 1 << 30 // 1GiB
+
+// spillConfig configures when and where nested archives are written to disk.
+type spillConfig struct {
+	maxMemory int64
+	dir       string
+	budget    *MemoryBudget
+	// limit, if provided, paces writing and reading spilled archives.
+	limit RateLimiter
+}
+
+// MemoryBudget is a number of bytes of nested archives that may be held in
+// memory, shared by every scan using it. See Config.MemoryBudget.
+type MemoryBudget struct {
+	max  int64
+	used int64
+}
+
+// NewMemoryBudget returns a budget of n bytes.
+func NewMemoryBudget(n int64) *MemoryBudget {
+	return &MemoryBudget{max: n}
+}
+
+// reserve takes n bytes from the budget, reporting false without taking any
+// if fewer are left. A nil budget is unlimited.
+func (b *MemoryBudget) reserve(n int64) bool {
+	if b == nil {
+		return true
+	}
+	for {
+		used := atomic.LoadInt64(&b.used)
+		if used+n > b.max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.used, used, used+n) {
+			return true
+		}
+	}
+}
+
+// release returns n reserved bytes to the budget.
+func (b *MemoryBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+	atomic.AddInt64(&b.used, -n)
+}
+
+// Used returns the number of bytes currently reserved.
+func (b *MemoryBudget) Used() int64 {
+	return atomic.LoadInt64(&b.used)
+}
+
+func (s spillConfig) threshold() int64 {
+	if s.maxMemory <= 0 {
+		return maxZipSize
+	}
+	return s.maxMemory
+}
+
+// file decompresses a nested archive of the declared size to a temporary
+// file, which is removed once closed. The returned size is the number of
+// bytes written.
+func (s spillConfig) file(r io.Reader, size int64) (*spillFile, int64, error) {
+	if err := readonly.Check("spilling nested archive to disk"); err != nil {
+		return nil, 0, err
+	}
+	dir := s.dir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if free, ok, err := diskFree(dir); err != nil {
+		return nil, 0, fmt.Errorf("checking free space of %s: %v", dir, err)
+	} else if ok && free < uint64(size)+spillReserve {
+		return nil, 0, fmt.Errorf("%s has %d bytes free, need %d", dir, free, uint64(size)+spillReserve)
+	}
+
+	// CreateTemp creates files only readable by the current user.
+	f, err := os.CreateTemp(dir, "log4jscanner-nested-*.jar")
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating temp file: %v", err)
+	}
+	sf := &spillFile{File: f, limit: s.limit}
+	if s.limit != nil {
+		r = &limitedReader{r: r, limit: s.limit}
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		sf.Close()
+		return nil, 0, fmt.Errorf("writing temp file: %v", err)
+	}
+	return sf, n, nil
+}
+
+// buffer reads r to its end and closes it, returning its contents, which
+// were declared to be size bytes. They're held in memory, or in a temporary
+// file if they exceed the threshold or the memory budget.
+func (s spillConfig) buffer(r io.ReadCloser, size uint64) (io.ReadCloser, error) {
+	defer r.Close()
+	limit := s.threshold()
+	if size > uint64(limit) || !s.budget.reserve(int64(size)) {
+		f, n, err := s.file(r, int64(size))
+		if err != nil {
+			return nil, err
+		}
+		return &spillReader{SectionReader: io.NewSectionReader(f, 0, n), f: f}, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(data)) > limit {
+		err = fmt.Errorf("entry larger than its declared size of %d bytes", size)
+	}
+	if err != nil {
+		s.budget.release(int64(size))
+		return nil, err
+	}
+	return &bufferReader{Reader: bytes.NewReader(data), budget: s.budget, size: int64(size)}, nil
+}
+
+// bufferReader reads contents buffered in memory, returning the memory to
+// the budget once closed.
+type bufferReader struct {
+	*bytes.Reader
+	budget *MemoryBudget
+	size   int64
+}
+
+func (b *bufferReader) Close() error {
+	b.budget.release(b.size)
+	b.size = 0
+	return nil
+}
+
+// spillReader reads contents buffered in a spill file, removing it once
+// closed.
+type spillReader struct {
+	*io.SectionReader
+	f *spillFile
+}
+
+func (s *spillReader) Close() error {
+	return s.f.Close()
+}
+
+// spillFile is a temporary file that's removed when closed.
+type spillFile struct {
+	*os.File
+	limit RateLimiter
+}
+
+func (f *spillFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	if f.limit != nil {
+		f.limit.WaitBytes(n)
+	}
+	return n, err
+}
+
+func (f *spillFile) Close() error {
+	err := f.File.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
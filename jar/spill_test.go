@@ -0,0 +1,175 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSpill(t *testing.T) {
+	testCases := []struct {
+		filename string
+		wantBad  bool
+	}{
+		{"bad_jar_in_jar.jar", true},
+		{"bad_jar_in_jar_in_jar.jar", true},
+		{"good_jar_in_jar_in_jar.jar", false},
+		{"bad_jar_with_invalid_jar.jar", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &Config{SpillThreshold: 1, SpillDir: dir}
+			zr, err := zip.OpenReader(testdataPath(tc.filename))
+			if err != nil {
+				t.Fatalf("zip.OpenReader failed: %v", err)
+			}
+			defer zr.Close()
+			report, err := cfg.Parse(zr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if got := report.Vulnerable; tc.wantBad != got {
+				t.Errorf("Parse() returned vulnerable %t, want %t", got, tc.wantBad)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("reading spill directory: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Parse() left %d temp files behind", len(entries))
+			}
+		})
+	}
+}
+
+func TestParseSpillMissingDir(t *testing.T) {
+	cfg := &Config{SpillThreshold: 1, SpillDir: "testdata/does-not-exist"}
+	zr, err := zip.OpenReader(testdataPath("bad_jar_in_jar.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	if _, err := cfg.Parse(zr); err == nil {
+		t.Errorf("Parse() spilling to a missing directory succeeded, expected error")
+	}
+}
+
+func TestParseMemoryBudget(t *testing.T) {
+	testCases := []struct {
+		name    string
+		budget  int64
+		wantErr bool
+	}{
+		// Spilling to the missing directory fails, showing the nested JAR
+		// didn't fit in the budget.
+		{"Exhausted", 1, true},
+		{"Available", 1 << 30, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			budget := NewMemoryBudget(tc.budget)
+			cfg := &Config{MemoryBudget: budget, SpillDir: "testdata/does-not-exist"}
+			zr, err := zip.OpenReader(testdataPath("bad_jar_in_jar.jar"))
+			if err != nil {
+				t.Fatalf("zip.OpenReader failed: %v", err)
+			}
+			defer zr.Close()
+			_, err = cfg.Parse(zr)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Parse() returned error %v, want error %t", err, tc.wantErr)
+			}
+			if got := budget.Used(); got != 0 {
+				t.Errorf("Parse() left %d bytes of the budget reserved, want 0", got)
+			}
+		})
+	}
+}
+
+func TestParseStoredInPlace(t *testing.T) {
+	inner, err := os.ReadFile(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	p := filepath.Join(dir, "app.war")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	if _, err := zw.Create("META-INF/"); err != nil {
+		t.Fatal(err)
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "WEB-INF/lib/log4j-core-2.14.0.jar", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(inner); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Spilling to the missing directory fails, so the stored archive can
+	// only be scanned in place.
+	cfg := &Config{SpillThreshold: 1, SpillDir: "testdata/does-not-exist"}
+	f, err = os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	report, err := cfg.ParseAny(p, f)
+	if err != nil {
+		t.Fatalf("ParseAny() failed: %v", err)
+	}
+	if !report.Vulnerable {
+		t.Errorf("ParseAny() returned report not vulnerable, want vulnerable")
+	}
+
+	found := 0
+	walker := &Walker{
+		Config: cfg,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleReport: func(path string, r *Report) {
+			found++
+		},
+	}
+	if err := walker.Walk(dir); err != nil {
+		t.Fatalf("Walk() failed: %v", err)
+	}
+	if found != 1 {
+		t.Errorf("Walk() reported %d vulnerable JARs, want 1", found)
+	}
+
+	// Without the file, the stored archive is spilled like any other.
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	if _, err := cfg.Parse(zr); err == nil {
+		t.Errorf("Parse() spilling to a missing directory succeeded, expected error")
+	}
+}
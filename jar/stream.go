@@ -0,0 +1,339 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// extraZip64 identifies the ZIP64 extra field, which holds the sizes of
+// entries over 4GiB.
+const extraZip64 = 0x0001
+
+// ParseStream scans a JAR read sequentially from r, such as a network stream,
+// an object being downloaded or stdin, without random access to it. Nested
+// archives are buffered one at a time, in memory or spilled to disk like
+// those of Parse.
+//
+// Entries are read from their local file headers in the order they were
+// written, so the scan is best effort: the central directory at the end of
+// the archive isn't read, so Provenance.Comment isn't reported and entries
+// deleted by rewriting the archive in place are still scanned. Entries
+// stored without compression and followed by a data descriptor can't be
+// delimited without the central directory and fail the scan, and encrypted
+// entries are reported as errors.
+func ParseStream(r io.Reader) (*Report, error) {
+	return defaultConfig.ParseStream(context.Background(), r)
+}
+
+// ParseStream scans a JAR read from r like the ParseStream function, only
+// evaluating the rules enabled by the configuration. It stops reading r once
+// ctx is done, returning the context's error, or a *TimeoutError once the
+// configured Timeout has passed.
+func (cfg *Config) ParseStream(ctx context.Context, r io.Reader) (rep *Report, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			rep, err = nil, &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	start := time.Now()
+	c := cfg.newChecker()
+	var cancel context.CancelFunc
+	c.ctx, cancel = cfg.timeout(ctx)
+	defer cancel()
+	if err := c.checkStream(cfg.limitReader(r)); err != nil {
+		if err := c.failure(); err != nil {
+			return nil, err
+		}
+		if err := cfg.contextError(ctx, c.ctx); err != nil {
+			return nil, err
+		}
+		if err == ErrUnknownFormat {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to check JAR: %v", err)
+	}
+	rep = c.report()
+	rep.Stats.Duration = time.Since(start)
+	return rep, nil
+}
+
+// checkStream checks the entries of a JAR read sequentially from r.
+func (c *checker) checkStream(r io.Reader) error {
+	br := bufio.NewReader(&ctxReader{c.ctx, r})
+	if h, err := br.Peek(len(jmodMagic)); err == nil && bytes.Equal(h, jmodMagic) {
+		br.Discard(len(jmodMagic))
+		c.jmod = true
+	}
+	sfs := &streamFS{kept: map[string][]byte{}}
+	var sf, block bool
+	for entries := 0; ; entries++ {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		sig, err := br.Peek(4)
+		if err != nil && entries == 0 {
+			return ErrUnknownFormat
+		}
+		if err != nil {
+			return fmt.Errorf("reading entry %d: %v", entries+1, err)
+		}
+		switch binary.LittleEndian.Uint32(sig) {
+		case localHeaderSig:
+		case centralSig, endSig:
+			// The entries are followed by the central directory.
+			c.signed = sf && block
+			c.checkMitigations(sfs)
+			return nil
+		default:
+			if entries == 0 {
+				return ErrUnknownFormat
+			}
+			return fmt.Errorf("reading entry %d: %v", entries+1, zip.ErrFormat)
+		}
+		fh, err := readLocalHeader(br)
+		if err != nil {
+			return fmt.Errorf("reading entry %d: %v", entries+1, err)
+		}
+		name := EntryName(fh)
+		if dir, base := path.Split(name); dir == "META-INF/" {
+			switch ext := strings.ToUpper(path.Ext(base)); {
+			case ext == ".SF":
+				sf = true
+			case signatureExts[ext]:
+				block = true
+			}
+		}
+		if err := c.checkStreamEntry(br, sfs, fh, name); err != nil {
+			return err
+		}
+	}
+}
+
+// readLocalHeader reads a local file header from r.
+func readLocalHeader(r io.Reader) (*zip.FileHeader, error) {
+	b := make([]byte, localHeaderLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	fh := &zip.FileHeader{
+		ReaderVersion:      binary.LittleEndian.Uint16(b[4:]),
+		Flags:              binary.LittleEndian.Uint16(b[6:]),
+		Method:             binary.LittleEndian.Uint16(b[8:]),
+		ModifiedTime:       binary.LittleEndian.Uint16(b[10:]),
+		ModifiedDate:       binary.LittleEndian.Uint16(b[12:]),
+		CRC32:              binary.LittleEndian.Uint32(b[14:]),
+		CompressedSize64:   uint64(binary.LittleEndian.Uint32(b[18:])),
+		UncompressedSize64: uint64(binary.LittleEndian.Uint32(b[22:])),
+	}
+	name := make([]byte, binary.LittleEndian.Uint16(b[26:]))
+	fh.Extra = make([]byte, binary.LittleEndian.Uint16(b[28:]))
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, fh.Extra); err != nil {
+		return nil, err
+	}
+	fh.Name = string(name)
+	fh.Modified = msDosTime(fh.ModifiedDate, fh.ModifiedTime)
+	if u, c, ok := zip64Sizes(fh.Extra); ok {
+		fh.UncompressedSize64, fh.CompressedSize64 = u, c
+	}
+	return fh, nil
+}
+
+// zip64Sizes returns the uncompressed and compressed sizes held by the ZIP64
+// extra field of a local file header, whose sizes are then 0xffffffff, or 0
+// if they follow the entry's data.
+func zip64Sizes(extra []byte) (uncompressed, compressed uint64, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			return 0, 0, false
+		}
+		if id == extraZip64 && size >= 16 {
+			return binary.LittleEndian.Uint64(extra), binary.LittleEndian.Uint64(extra[8:]), true
+		}
+		extra = extra[size:]
+	}
+	return 0, 0, false
+}
+
+// msDosTime converts an MS-DOS date and time to a time.Time in UTC, like
+// archive/zip does.
+func msDosTime(d, t uint16) time.Time {
+	return time.Date(
+		int(d>>9+1980), time.Month(d>>5&0xf), int(d&0x1f),
+		int(t>>11), int(t>>5&0x3f), int(t&0x1f*2), 0, time.UTC)
+}
+
+// checkStreamEntry checks the entry of a stream whose local header, fh, was
+// just read from r, and reads past its data.
+func (c *checker) checkStreamEntry(r *bufio.Reader, sfs *streamFS, fh *zip.FileHeader, name string) error {
+	descriptor := fh.Flags&flagDataDescriptor != 0
+	var raw io.Reader = r
+	if !descriptor {
+		raw = io.LimitReader(r, int64(fh.CompressedSize64))
+	}
+	var data io.Reader
+	switch {
+	case fh.Flags&flagEncrypted != 0 && descriptor:
+		return fmt.Errorf("reading entry %s: encrypted entry followed by a data descriptor", name)
+	case fh.Flags&flagEncrypted != 0:
+		if err := c.entryError(name, ErrCorruptEntry, errors.New("encrypted entries can't be read from a stream")); err != nil {
+			return err
+		}
+	case fh.Method == zip.Deflate:
+		fr := flate.NewReader(raw)
+		defer fr.Close()
+		data = fr
+	case fh.Method == zip.Store && descriptor:
+		return fmt.Errorf("reading entry %s: stored entry followed by a data descriptor", name)
+	case fh.Method == zip.Store:
+		data = raw
+	case descriptor:
+		return fmt.Errorf("reading entry %s: entry of compression method %d followed by a data descriptor", name, fh.Method)
+	default:
+		if err := c.entryError(name, ErrCorruptEntry, fmt.Errorf("unsupported compression method %d", fh.Method)); err != nil {
+			return err
+		}
+	}
+
+	var info fs.FileInfo = fh.FileInfo()
+	if descriptor {
+		// The sizes aren't known until the data has been read.
+		info = unsizedInfo{info}
+	}
+	if data != nil && info.Mode().IsRegular() {
+		prefix := ""
+		if c.jmod {
+			prefix = jmodClassesDir
+		}
+		if name == prefix+jndiLookupClass || name == prefix+messagePatternConverterClass {
+			// Kept for checkMitigations, once the walk is over.
+			buf, err := io.ReadAll(io.LimitReader(data, maxConverterSize))
+			if err != nil {
+				return c.entryError(name, ErrCorruptEntry, fmt.Errorf("reading file: %v", err))
+			}
+			sfs.kept[name] = buf
+		}
+		if c.done() {
+			c.skipped = true
+		} else {
+			sfs.name, sfs.info, sfs.r = name, info, data
+			if buf, ok := sfs.kept[name]; ok {
+				sfs.r = bytes.NewReader(buf)
+			}
+			err := c.checkEntry(sfs, name, fs.FileInfoToDirEntry(info), 0, 0)
+			sfs.r = nil
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Entries followed by a data descriptor only end once they have been
+	// decompressed.
+	if !descriptor {
+		if _, err := io.Copy(io.Discard, raw); err != nil {
+			return fmt.Errorf("reading entry %s: %v", name, err)
+		}
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, data); err != nil {
+		return fmt.Errorf("reading entry %s: %v", name, err)
+	}
+	return readDescriptor(r, fh)
+}
+
+// readDescriptor reads past the data descriptor following the entry fh: its
+// CRC-32 and sizes, after an optional signature. The sizes take 8 bytes each
+// if the entry has a ZIP64 extra field, otherwise 4.
+func readDescriptor(r *bufio.Reader, fh *zip.FileHeader) error {
+	if sig, err := r.Peek(4); err == nil && binary.LittleEndian.Uint32(sig) == descriptorSig {
+		r.Discard(4)
+	}
+	n := 12
+	if _, _, ok := zip64Sizes(fh.Extra); ok {
+		n = 20
+	}
+	if _, err := r.Discard(n); err != nil {
+		return fmt.Errorf("reading data descriptor: %v", err)
+	}
+	return nil
+}
+
+// unsizedInfo is the fs.FileInfo of an entry whose sizes follow its data.
+type unsizedInfo struct {
+	fs.FileInfo
+}
+
+func (unsizedInfo) Size() int64 { return 0 }
+
+func (unsizedInfo) Sys() interface{} { return nil }
+
+// streamFS is the fs.FS checkEntry reads the entries of a stream from. It
+// opens the entry being read, once, and the entries kept for
+// checkMitigations.
+type streamFS struct {
+	name string
+	info fs.FileInfo
+	r    io.Reader
+	kept map[string][]byte
+}
+
+func (s *streamFS) Open(name string) (fs.File, error) {
+	if name == s.name && s.r != nil {
+		f := &streamEntry{info: s.info, r: s.r}
+		s.r = nil
+		return f, nil
+	}
+	if buf, ok := s.kept[name]; ok {
+		return &streamEntry{info: unsizedInfo{keptInfo(name)}, r: bytes.NewReader(buf)}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// keptInfo returns the fs.FileInfo of a kept entry.
+func keptInfo(name string) fs.FileInfo {
+	return (&zip.FileHeader{Name: name}).FileInfo()
+}
+
+// streamEntry is an entry of a streamFS.
+type streamEntry struct {
+	info fs.FileInfo
+	r    io.Reader
+}
+
+func (f *streamEntry) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *streamEntry) Read(b []byte) (int, error) { return f.r.Read(b) }
+
+func (f *streamEntry) Close() error { return nil }
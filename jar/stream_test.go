@@ -0,0 +1,130 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// streamReader hides the other methods of a reader, like a network stream.
+type streamReader struct {
+	r *bytes.Reader
+}
+
+func (s streamReader) Read(b []byte) (int, error) { return s.r.Read(b) }
+
+func TestParseStream(t *testing.T) {
+	padded, _ := paddedJAR(t, 4096)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "padded.jar", data: padded},
+	}
+	for _, name := range []string{
+		"arara.jar",
+		"arara.signed.jar",
+		"bad_jar_in_jar.jar",
+		"bad_jar_in_jar_in_jar.jar",
+		"bad_jar_with_invalid_jar.jar",
+		"good_jar_in_jar.jar",
+		"helloworld.signed.jar",
+		"log4j-core-2.1.jar",
+		"log4j-core-2.12.1.jar",
+		"log4j-core-2.14.0.jar",
+		"log4j-core-2.15.0.jar",
+		"log4j-core-2.16.0.jar",
+		"log4j-core-2.15.0.jar.patched",
+		"safe1.jar",
+		"similarbutnotvuln.jar",
+		"vuln-class.jar",
+	} {
+		data, err := os.ReadFile(testdataPath(name))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		tests = append(tests, struct {
+			name string
+			data []byte
+		}{name, data})
+	}
+	tests = append(tests, struct {
+		name string
+		data []byte
+	}{"jmod", append(append([]byte{}, jmodMagic...), tests[len(tests)-1].data...)})
+
+	ignore := cmpopts.IgnoreFields(Report{}, "Stats", "Provenance")
+	for _, tc := range tests {
+		want, err := ParseReader(bytes.NewReader(tc.data), int64(len(tc.data)))
+		if err != nil {
+			t.Fatalf("ParseReader(%s) failed: %v", tc.name, err)
+		}
+		got, err := ParseStream(streamReader{bytes.NewReader(tc.data)})
+		if err != nil {
+			t.Errorf("ParseStream(%s) failed: %v", tc.name, err)
+			continue
+		}
+		if diff := cmp.Diff(want, got, ignore); diff != "" {
+			t.Errorf("ParseStream(%s) returned diff (-want, +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestParseStreamErrors(t *testing.T) {
+	notJAR, err := os.ReadFile(testdataPath("notarealjar.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	vuln, err := os.ReadFile(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "empty", data: nil, wantErr: ErrUnknownFormat},
+		{name: "not a jar", data: notJAR, wantErr: ErrUnknownFormat},
+		{name: "truncated", data: vuln[:len(vuln)/2]},
+	} {
+		_, err := ParseStream(streamReader{bytes.NewReader(tc.data)})
+		if err == nil {
+			t.Errorf("ParseStream(%s) succeeded, want error", tc.name)
+			continue
+		}
+		if tc.wantErr != nil && err != tc.wantErr {
+			t.Errorf("ParseStream(%s) returned error %v, want %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestParseStreamCanceled(t *testing.T) {
+	data, err := os.ReadFile(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := defaultConfig.ParseStream(ctx, streamReader{bytes.NewReader(data)}); err != context.Canceled {
+		t.Errorf("ParseStream() returned error %v, want %v", err, context.Canceled)
+	}
+}
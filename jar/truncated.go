@@ -0,0 +1,48 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// zipLocalHeader is the signature of a ZIP archive's first entry.
+var zipLocalHeader = []byte("PK\x03\x04")
+
+// TruncatedError is returned for a file that starts like a ZIP archive but
+// has no end of central directory record, such as a JAR that's still being
+// written, or a partial upload or copy. Unlike files that aren't archives,
+// they can't be scanned, and are worth investigating.
+type TruncatedError struct {
+	// Size is the number of bytes of the file.
+	Size int64
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("truncated archive: %d bytes starting with a ZIP header but no end of central directory, possibly partially written", e.Size)
+}
+
+// CheckTruncated returns a *TruncatedError if an archive that zip.NewReader
+// rejected with zip.ErrFormat starts with a ZIP local file header, and nil if
+// it doesn't and so isn't a ZIP archive at all.
+func CheckTruncated(ra io.ReaderAt, size int64) error {
+	h := make([]byte, len(zipLocalHeader))
+	if _, err := ra.ReadAt(h, 0); err != nil || !bytes.Equal(h, zipLocalHeader) {
+		return nil
+	}
+	return &TruncatedError{Size: size}
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckTruncated(t *testing.T) {
+	full, err := os.ReadFile(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("reading JAR: %v", err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"Truncated", full[:len(full)/2], true},
+		{"Text", []byte("not an archive"), false},
+		{"Empty", nil, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckTruncated(bytes.NewReader(tc.data), int64(len(tc.data)))
+			var te *TruncatedError
+			if got := errors.As(err, &te); got != tc.want {
+				t.Fatalf("CheckTruncated() returned %v, want truncated %t", err, tc.want)
+			}
+			if tc.want && te.Size != int64(len(tc.data)) {
+				t.Errorf("CheckTruncated() returned size %d, want %d", te.Size, len(tc.data))
+			}
+		})
+	}
+}
+
+func TestWalkerTruncated(t *testing.T) {
+	full, err := os.ReadFile(testdataPath("vuln-class.jar"))
+	if err != nil {
+		t.Fatalf("reading JAR: %v", err)
+	}
+	dir := t.TempDir()
+	partial := filepath.Join(dir, "partial.jar")
+	if err := os.WriteFile(partial, full[:1000], 0644); err != nil {
+		t.Fatalf("writing partial JAR: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.jar"), []byte("not an archive"), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	var errs []error
+	w := Walker{
+		HandleError: func(path string, err error) {
+			if path != partial {
+				t.Errorf("unexpected error for %s: %v", path, err)
+			}
+			errs = append(errs, err)
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("walk returned %d errors, want 1", len(errs))
+	}
+	var te *TruncatedError
+	if !errors.As(errs[0], &te) || te.Size != 1000 {
+		t.Errorf("walk returned error %v, want a TruncatedError of 1000 bytes", errs[0])
+	}
+
+	f, err := os.Open(partial)
+	if err != nil {
+		t.Fatalf("opening partial JAR: %v", err)
+	}
+	defer f.Close()
+	if _, err := ParseAny(partial, f); !errors.As(err, &te) {
+		t.Errorf("ParseAny() returned error %v, want a TruncatedError", err)
+	}
+}
@@ -16,13 +16,24 @@ package jar
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"log4jscanner/readonly"
 )
 
 // IsJAR determines if a given ZIP reader is a JAR.
@@ -45,14 +56,36 @@ func IsJAR(zr *zip.Reader) bool {
 	return false
 }
 
+// HasArchiveExt reports if a file name has an extension the Walker considers
+// a potential JAR, such as ".jar" or ".war".
+func HasArchiveExt(name string) bool {
+	return exts[path.Ext(name)]
+}
+
+// ArchiveExts returns the extensions HasArchiveExt accepts, sorted, such as
+// to find candidate archives with other tools.
+func ArchiveExts() []string {
+	var l []string
+	for ext := range exts {
+		l = append(l, ext)
+	}
+	sort.Strings(l)
+	return l
+}
+
 // Walker implements a filesystem walker to scan for log4j vulnerable JARs
 // and optional rewrite them.
 type Walker struct {
 	// Rewrite indicates if the Walker should rewrite JARs in place as it
 	// iterates through the filesystem.
 	Rewrite bool
+	// Backup, if provided, keeps the originals of the JARs rewritten, so
+	// they can be restored.
+	Backup *Backup
 	// SkipDir, if provided, allows the walker to skip certain directories
-	// as it scans.
+	// as it scans. It's called for every entry, and returning true for a file
+	// skips only that file. See the ignore package for gitignore style
+	// exclusions.
 	SkipDir func(path string, de fs.DirEntry) bool
 	// HandleError can be used to handle errors for a given directory or
 	// JAR file.
@@ -62,32 +95,378 @@ type Walker struct {
 	HandleReport func(path string, r *Report)
 	// HandleRewrite is called when a JAR is rewritten successfully.
 	HandleRewrite func(path string, r *Report)
+	// SkipSigned leaves signed JARs unchanged when rewriting, reporting an
+	// error for them instead, since the rewrite removes their signature.
+	// See Report.Signed.
+	SkipSigned bool
+	// HandleJAR, if provided, is called for every scanned JAR, vulnerable
+	// or not, before HandleReport. The cache isn't used with HandleJAR,
+	// since it only holds vulnerable JARs.
+	HandleJAR func(path string, r *Report)
+	// HandleScanned, if provided, is called for every JAR that's read,
+	// vulnerable or not, such as to log its Report.Stats. Unlike HandleJAR
+	// it doesn't disable the cache, JARs of cached directories aren't read
+	// and aren't passed to it.
+	HandleScanned func(path string, r *Report)
+	// FollowClassPath causes the walker to also scan JARs referenced by the
+	// Class-Path attribute of a scanned JAR's manifest, or its jar index,
+	// resolved relative to the JAR's location. This covers launcher JARs that point at libraries
+	// outside of the directory being walked. Each JAR is scanned at most once
+	// per call to Walk.
+	FollowClassPath bool
+	// Hash computes the SHA-256 of every scanned JAR into Report.SHA256.
+	// Files are hashed from the reads of detection, in memory if they fit
+	// within the spill threshold and memory budget, so hashing doesn't read
+	// a file a second time.
+	Hash bool
+	// Config, if provided, selects the rules evaluated for each JAR.
+	Config *Config
+	// Detect, if provided, selects the files scanned as archives, by
+	// their extensions and optionally their first bytes. By default files
+	// with an archive extension are scanned, see HasArchiveExt. Archives
+	// nested within them are always found by their extension.
+	Detect *Detect
+	// Cache, if provided, remembers the vulnerable JARs of each directory
+	// between walks. A directory is keyed by the names, sizes, and
+	// modification times of its entries, and if its key is unchanged its
+	// JARs aren't opened, the cached reports are passed to HandleReport
+	// instead. Subdirectories are still walked and cached separately.
+	//
+	// The cache isn't used with FollowClassPath, FollowSymlinks, Exploded,
+	// HandleJAR, Hash, NewestFirst, or more than one worker, or with
+	// Rewrite for directories holding vulnerable JARs, since they require
+	// the JARs to be read.
+	Cache Cache
+	// FileCache, if provided, remembers the report of each file between
+	// walks, keyed by its size and modification time. Files with an
+	// unchanged key aren't parsed, their cached report is handled as if
+	// they were. Unlike Cache, it's used with every other option, and a
+	// changed JAR only causes that JAR to be parsed again. It must be safe
+	// for concurrent use if there's more than one worker.
+	FileCache FileCache
+	// FS, if provided, returns the filesystem of a walked directory instead
+	// of the os package, such as one that times out operations on network
+	// filesystems. Following class paths and symlinks, and rewriting, still
+	// use the os package.
+	FS func(dir string) fs.FS
+	// FollowSymlinks scans the archives that symlinks point to, and walks the
+	// directories they point to, under the symlink's path. Each symlinked
+	// directory is walked at most once per call to Walk, so cycles are
+	// broken, but files reached both directly and through a symlink are
+	// scanned under both paths. Dangling symlinks are ignored. By default
+	// symlinks are skipped.
+	// FollowSymlinks isn't supported with NewestFirst.
+	FollowSymlinks bool
+	// Exploded also scans exploded archives, the directories application
+	// servers such as Tomcat and WebLogic unpack WARs and EARs into, whose
+	// classes are loose files rather than entries of an archive. A
+	// directory holding a WEB-INF or META-INF directory, or log4j's
+	// org/apache/logging/log4j package, is checked like a JAR, and its
+	// report, with Exploded set, is handled under the directory's path.
+	// Directories within it aren't checked again, but the archives within
+	// it are still scanned as files of their own. With FollowClassPath,
+	// directories referenced by Class-Path are also checked. With
+	// Rewrite, the JndiLookup classes of vulnerable exploded archives are
+	// removed, and kept by Backup.
+	Exploded bool
+	// Workers is the number of JARs parsed concurrently, defaulting to one.
+	// The handlers are still called from one goroutine at a time, in the
+	// order the JARs were walked, so results are reported in the same order
+	// as a sequential walk. The cache isn't used with more than one worker.
+	// See Config.MemoryBudget to bound the memory used across workers.
+	Workers int
+	// MaxWorkers, if more than Workers, adapts the number of workers
+	// between Workers and MaxWorkers as the walk progresses. Workers are
+	// added while JARs are waiting to be parsed and either storage is slow
+	// to open files, such as network filesystems, or CPUs are idle. They're
+	// removed once storage is fast and there are more workers than CPUs, or
+	// the walk can't keep them busy.
+	MaxWorkers int
+	// NewestFirst lists the candidate archives of a walked directory before
+	// scanning any, then scans them from the most recently modified, so
+	// the archives of active deployments are found before old backups.
+	NewestFirst bool
+	// HandleProgress, if provided, is called with the statistics of the
+	// walks so far after every file and directory walked, and at the end
+	// of each walk. Like the other handlers, it's called from one
+	// goroutine at a time, so it should be quick, such as redrawing a
+	// progress bar at most every so often. See Stats to poll them
+	// instead.
+	HandleProgress func(s WalkStats)
+
+	// stopped is set by Stop.
+	stopped int32
+	// progress holds the statistics of the walks, see Stats.
+	progress progress
+}
+
+// ErrStopped is returned by Walk if the walk was ended by Stop.
+var ErrStopped = errors.New("walk stopped")
+
+// Stop ends the walk once the file being scanned is handled, such as after
+// HandleReport has seen enough, and causes later calls to Walk to return
+// ErrStopped immediately. No reports are passed to HandleReport after Stop.
+// Stop may be called from the handlers or from other goroutines.
+func (w *Walker) Stop() {
+	atomic.StoreInt32(&w.stopped, 1)
+}
+
+func (w *Walker) isStopped() bool {
+	return atomic.LoadInt32(&w.stopped) != 0
+}
+
+// Cache stores the reports of vulnerable JARs of directories between walks.
+// See Walker.Cache.
+type Cache interface {
+	// Get returns the reports of a directory, keyed by file name, if the
+	// directory was stored with the same key.
+	Get(dir, key string) (reports map[string]*Report, ok bool, err error)
+	// Put stores the reports of a directory, keyed by file name.
+	Put(dir, key string, reports map[string]*Report) error
+}
+
+// FileCache stores the reports of files between walks. See
+// Walker.FileCache.
+type FileCache interface {
+	// GetFile returns the report of a file, if it was stored with the
+	// same key. The report is nil if the file isn't a JAR.
+	GetFile(path, key string) (r *Report, ok bool, err error)
+	// PutFile stores the report of a file, nil if it isn't a JAR.
+	PutFile(path, key string, r *Report) error
+}
+
+// fileKey identifies the contents of a file for FileCache by its size and
+// modification time, along with the rules evaluated and if it's hashed.
+func fileKey(info fs.FileInfo, rules string, hash bool) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d %d %t\n", rules, info.Size(), info.ModTime().UnixNano(), hash)
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // Walk attempts to scan a directory for vulnerable JARs.
 func (w *Walker) Walk(dir string) error {
-	fsys := os.DirFS(dir)
-	wk := walker{w, fsys, dir}
+	return w.WalkContext(context.Background(), dir)
+}
+
+// WalkContext is like Walk, but ends the walk once ctx is done, returning the
+// context's error. The JARs being scanned stop being read, and errors
+// aren't passed to HandleError once ctx is done, since they're mostly of
+// scans that were cut short. See Config.Timeout to bound the scan of each
+// JAR instead.
+func (w *Walker) WalkContext(ctx context.Context, dir string) error {
+	if w.isStopped() {
+		return ErrStopped
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var links map[string]bool
+	if w.FollowSymlinks {
+		links = map[string]bool{}
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			links[PathKey(real)] = true
+		}
+	}
+	w.progress.started()
+	if w.HandleProgress != nil {
+		// Deferred first, so it's called once every file was handled.
+		defer func() { w.HandleProgress(w.Stats()) }()
+	}
+	var pool *scanPool
+	if min := w.minWorkers(); min > 1 || w.MaxWorkers > min {
+		pool = newScanPool(min, w.MaxWorkers)
+		defer pool.close()
+	}
+	return w.walk(ctx, dir, links, pool)
+}
 
-	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+// minWorkers returns the number of workers to start with.
+func (w *Walker) minWorkers() int {
+	if w.Workers < 1 {
+		return 1
+	}
+	return w.Workers
+}
+
+// walk implements WalkContext. links holds the resolved paths of the directories
+// walked so far when following symlinks, and is nil otherwise. pool is nil
+// unless scanning concurrently.
+func (w *Walker) walk(ctx context.Context, dir string, links map[string]bool, pool *scanPool) error {
+	var fsys fs.FS
+	if w.FS != nil {
+		fsys = w.FS(dir)
+	} else {
+		fsys = dirFS(dir)
+	}
+	wk := walker{Walker: w, ctx: ctx, fs: fsys, dir: dir, seen: map[string]bool{}, links: links, pool: pool}
+	if w.NewestFirst {
+		return wk.walkNewestFirst()
+	}
+	caching := w.Cache != nil && !w.FollowClassPath && !w.FollowSymlinks && !w.Exploded && w.HandleJAR == nil && !w.Hash && pool == nil
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if w.isStopped() {
+			// The directories being walked weren't fully scanned.
+			for _, ds := range wk.dirs {
+				ds.failed = true
+			}
+			return ErrStopped
+		}
+		if err := ctx.Err(); err != nil {
+			for _, ds := range wk.dirs {
+				ds.failed = true
+			}
+			return err
+		}
+		if caching {
+			wk.leaveDirs(p)
+		}
 		if err != nil {
 			wk.handleError(p, err)
+			if caching {
+				wk.dontCache(path.Dir(p))
+			}
+			return nil
+		}
+		// Files of cached directories were handled when entering it.
+		if caching && !d.IsDir() && wk.cached(path.Dir(p)) {
+			wk.walked(d)
 			return nil
 		}
 		if wk.skipDir(p, d) {
-			return fs.SkipDir
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			if caching {
+				wk.dontCache(path.Dir(p))
+			}
+			return nil
 		}
-		if err := wk.visit(p, d); err != nil {
+		defer wk.walked(d)
+		if caching && d.IsDir() {
+			wk.enterDir(p)
+			return nil
+		}
+		if links != nil && isLink(d) {
+			return wk.followSymlink(p)
+		}
+		r, err := wk.visit(p, d)
+		if err != nil {
 			wk.handleError(p, err)
+			if caching {
+				wk.dontCache(path.Dir(p))
+			}
+			return nil
+		}
+		if caching && r != nil && r.Vulnerable {
+			wk.dirReport(p, r)
+		}
+		return nil
+	})
+	if caching {
+		wk.leaveDirs("")
+	}
+	return err
+}
+
+// walkNewestFirst lists the candidate archives of the walk, then scans them
+// from the most recently modified.
+func (w *walker) walkNewestFirst() error {
+	type candidate struct {
+		p       string
+		d       fs.DirEntry
+		modTime time.Time
+	}
+	var files []candidate
+	err := fs.WalkDir(w.fs, ".", func(p string, d fs.DirEntry, err error) error {
+		if w.isStopped() {
+			return ErrStopped
 		}
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			w.handleError(p, err)
+			return nil
+		}
+		if w.skipDir(p, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && w.explodedRoot(p) {
+			// Listed like an archive, and walked for the archives within.
+		} else if d.IsDir() || !d.Type().IsRegular() || !w.Detect.Candidate(p) {
+			w.walked(d)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			w.handleError(p, err)
+			return nil
+		}
+		files = append(files, candidate{p, d, info.ModTime()})
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	for _, f := range files {
+		if w.isStopped() {
+			return ErrStopped
+		}
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		var err error
+		if f.d.IsDir() {
+			// Listed as an exploded archive.
+			_, err = w.visitExploded(f.p)
+		} else {
+			_, err = w.visit(f.p, f.d)
+		}
+		if err != nil {
+			w.handleError(f.p, err)
+		}
+		w.walked(f.d)
+	}
+	return nil
 }
 
 type walker struct {
 	*Walker
+	ctx context.Context
 	fs  fs.FS
 	dir string
+	// seen tracks files that have been scanned when following class paths,
+	// keyed by PathKey.
+	seen   map[string]bool
+	seenMu sync.Mutex
+	// dirs holds the directory being walked and its parents, when caching.
+	dirs []*dirState
+	// links holds the resolved paths of walked directories, keyed by PathKey,
+	// when following symlinks.
+	links map[string]bool
+	// pool scans files concurrently, if Workers is more than one.
+	pool *scanPool
+	// exploded is the last exploded archive found by the walk, whose
+	// directories aren't checked again.
+	exploded string
+}
+
+// dirState tracks the reports of a directory as it's walked.
+type dirState struct {
+	path string
+	key  string
+	// hit is set if the cached reports were used.
+	hit bool
+	// failed is set if the directory mustn't be cached.
+	failed  bool
+	reports map[string]*Report
 }
 
 func (w *walker) filepath(path string) string {
@@ -95,24 +474,42 @@ func (w *walker) filepath(path string) string {
 }
 
 func (w *walker) handleError(path string, err error) {
-	if w.HandleError == nil {
+	fp := w.filepath(path)
+	if w.pool != nil {
+		// Keep errors in order with the reports of queued files.
+		w.pool.emit(func() { w.handleFileError(fp, err) })
+		return
+	}
+	w.handleFileError(fp, err)
+}
+
+// handleFileError passes the error of fp, a path on the host filesystem, to
+// HandleError, unless the walk was cancelled.
+func (w *walker) handleFileError(fp string, err error) {
+	if w.ctx.Err() != nil {
 		return
 	}
-	w.HandleError(w.filepath(path), err)
+	w.progress.add(func(s *WalkStats) { s.Errors++ })
+	if w.HandleError != nil {
+		w.HandleError(fp, err)
+	}
 }
 
-func (w *walker) handleReport(path string, r *Report) {
-	if w.HandleReport == nil {
+func (w *walker) handleReport(fp string, r *Report) {
+	if w.isStopped() {
 		return
 	}
-	w.HandleReport(w.filepath(path), r)
+	w.progress.add(func(s *WalkStats) { s.Findings++ })
+	if w.HandleReport != nil {
+		w.HandleReport(fp, r)
+	}
 }
 
-func (w *walker) handleRewrite(path string, r *Report) {
+func (w *walker) handleRewrite(fp string, r *Report) {
 	if w.HandleRewrite == nil {
 		return
 	}
-	w.HandleRewrite(w.filepath(path), r)
+	w.HandleRewrite(fp, r)
 }
 
 func (w *walker) skipDir(path string, d fs.DirEntry) bool {
@@ -122,79 +519,600 @@ func (w *walker) skipDir(path string, d fs.DirEntry) bool {
 	return w.SkipDir(w.filepath(path), d)
 }
 
-func (w *walker) visit(p string, d fs.DirEntry) error {
+// visit scans a file found by the walk, returning its report if it's a JAR
+// and wasn't queued for the workers.
+func (w *walker) visit(p string, d fs.DirEntry) (*Report, error) {
+	if d.IsDir() && w.explodedRoot(p) {
+		return w.visitExploded(p)
+	}
 	if d.IsDir() || !d.Type().IsRegular() {
-		return nil
+		return nil, nil
 	}
-	if !exts[path.Ext(p)] {
-		return nil
+	if !w.Detect.Candidate(p) {
+		return nil, nil
 	}
-	f, err := w.fs.Open(p)
+	fp := w.filepath(p)
+	return w.submit(fp, func() (*Report, error) {
+		return w.parse(fp, func() (fs.File, error) {
+			return w.fs.Open(p)
+		})
+	})
+}
+
+// explodedMarkers are the directories that make a directory an exploded
+// archive, see Walker.Exploded.
+var explodedMarkers = []string{"WEB-INF", "META-INF", "org/apache/logging/log4j"}
+
+// explodedRoot reports if the directory p is an exploded archive to check,
+// rather than a directory within the last one found.
+func (w *walker) explodedRoot(p string) bool {
+	if !w.Exploded {
+		return false
+	}
+	if e := w.exploded; e != "" && (e == "." || p == e || strings.HasPrefix(p, e+"/")) {
+		return false
+	}
+	for _, m := range explodedMarkers {
+		if info, err := fs.Stat(w.fs, path.Join(p, m)); err == nil && info.IsDir() {
+			w.exploded = p
+			return true
+		}
+	}
+	return false
+}
+
+// parseExploded checks the exploded archive at p within fsys.
+func (w *walker) parseExploded(fsys fs.FS, p string) (*Report, error) {
+	sub, err := fs.Sub(fsys, p)
 	if err != nil {
-		return fmt.Errorf("open: %v", err)
+		return nil, fmt.Errorf("opening directory: %v", err)
+	}
+	r, err := w.Config.parseDir(w.ctx, sub)
+	if err != nil {
+		var ee *EntryError
+		if _, ok := err.(*TimeoutError); ok || errors.Is(err, ErrZipBomb) || errors.As(err, &ee) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scanning exploded archive: %v", err)
+	}
+	w.progress.add(func(s *WalkStats) {
+		s.Archives++
+		s.DecompressedBytes += r.Stats.DecompressedBytes
+	})
+	return r, nil
+}
+
+// visitExploded scans an exploded archive found by the walk, like visit.
+func (w *walker) visitExploded(p string) (*Report, error) {
+	return w.submit(w.filepath(p), func() (*Report, error) {
+		return w.parseExploded(w.fs, p)
+	})
+}
+
+// scan checks a single file, located at fp on the host filesystem, and
+// passes its report to the handlers. parse returns the file's report, or nil
+// if the file isn't a JAR.
+func (w *walker) scan(fp string, parse func() (*Report, error)) (*Report, error) {
+	if w.FollowClassPath && !w.markSeen(fp) {
+		return nil, nil
+	}
+	r, err := parse()
+	if err != nil || r == nil {
+		return nil, err
+	}
+	return r, w.handle(fp, r)
+}
+
+// submit scans a file like scan, or queues it for the workers if scanning
+// concurrently. Queued files are handled in the order they're submitted,
+// and their errors are passed to HandleError rather than returned.
+func (w *walker) submit(fp string, parse func() (*Report, error)) (*Report, error) {
+	if w.pool == nil {
+		return w.scan(fp, parse)
+	}
+	if w.FollowClassPath && !w.markSeen(fp) {
+		return nil, nil
+	}
+	var (
+		r   *Report
+		err error
+	)
+	w.pool.submit(func() {
+		if !w.isStopped() && w.ctx.Err() == nil {
+			r, err = parse()
+		}
+	}, func() {
+		if err == nil && r != nil {
+			err = w.handle(fp, r)
+		}
+		if err != nil {
+			w.handleFileError(fp, err)
+		}
+	})
+	return nil, nil
+}
+
+// markSeen records that a file was scanned when following class paths,
+// reporting false if it already was.
+func (w *walker) markSeen(fp string) bool {
+	w.seenMu.Lock()
+	defer w.seenMu.Unlock()
+	key := PathKey(fp)
+	if w.seen[key] {
+		return false
+	}
+	w.seen[key] = true
+	return true
+}
+
+// parse opens and scans the file at fp, returning a nil report if it isn't a
+// JAR. It doesn't call any handlers, so files may be parsed concurrently.
+func (w *walker) parse(fp string, open func() (fs.File, error)) (*Report, error) {
+	w.Config.waitFile()
+	start := time.Now()
+	f, err := open()
+	if err != nil {
+		if isLocked(err) {
+			return nil, &lockedError{err: err}
+		}
+		return nil, fmt.Errorf("open: %v", err)
 	}
 	defer f.Close()
 
 	info, err := f.Stat()
 	if err != nil {
-		return fmt.Errorf("stat: %v", err)
+		return nil, fmt.Errorf("stat: %v", err)
+	}
+	if w.FileCache == nil {
+		return w.parseFile(f, info, start)
 	}
+	key := fileKey(info, w.Config.key(), w.Hash)
+	r, ok, err := w.FileCache.GetFile(fp, key)
+	if err != nil {
+		return nil, fmt.Errorf("reading cache: %v", err)
+	}
+	if ok {
+		if r != nil {
+			w.progress.add(func(s *WalkStats) { s.Cached++ })
+		}
+		return r, nil
+	}
+	if r, err = w.parseFile(f, info, start); err != nil {
+		return nil, err
+	}
+	if err := w.FileCache.PutFile(fp, key, r); err != nil {
+		return nil, fmt.Errorf("writing cache: %v", err)
+	}
+	return r, nil
+}
+
+// parseFile scans an opened file for parse, which opened it at start.
+func (w *walker) parseFile(f fs.File, info fs.FileInfo, start time.Time) (*Report, error) {
 	ra, ok := f.(io.ReaderAt)
 	if !ok {
-		return fmt.Errorf("file doesn't implement reader at: %T", f)
+		return nil, fmt.Errorf("file doesn't implement reader at: %T", f)
+	}
+	ra = w.Config.limitReaderAt(ra)
+	if !w.Detect.sniff(ra) {
+		return nil, nil
+	}
+	var hash *hashReaderAt
+	if w.Hash {
+		// Hashing reads all of the file, so detection reads it through
+		// the hash. Files that fit within the spill threshold and memory
+		// budget are read in full up front, in a single pass feeding both.
+		hash = newHashReaderAt(ra, info.Size())
+		ra = hash
+		spill := w.Config.spill()
+		if n := info.Size(); n <= spill.threshold() && spill.budget.reserve(n) {
+			defer spill.budget.release(n)
+			data := make([]byte, n)
+			if _, err := io.ReadFull(io.NewSectionReader(hash, 0, n), data); err != nil {
+				return nil, fmt.Errorf("reading: %v", err)
+			}
+			ra = bytes.NewReader(data)
+		}
+	}
+	zra, size := openJMOD(ra, info.Size())
+	zr, err := zip.NewReader(zra, size)
+	if w.pool != nil {
+		// Reading the directory of an archive is bound by the latency of
+		// storage, unlike parsing it.
+		w.pool.observe(time.Since(start))
+	}
+	var recovered *salvaged
+	if err != nil && w.Config != nil && w.Config.Salvage {
+		if s, serr := salvage(zra, size); serr == nil {
+			zr, recovered, err = s.zr, s, nil
+		}
 	}
-	zr, err := zip.NewReader(ra, info.Size())
 	if err != nil {
 		if err == zip.ErrFormat {
-			// Not a JAR.
-			return nil
+			// Not a JAR, unless it was cut short.
+			return nil, CheckTruncated(ra, info.Size())
 		}
-		return fmt.Errorf("opennig file as a ZIP archive: %v", err)
+		return nil, fmt.Errorf("opennig file as a ZIP archive: %v", err)
 	}
 	if !IsJAR(zr) {
-		return nil
+		return nil, nil
+	}
+	var r *Report
+	if recovered != nil {
+		r, err = w.Config.parseSalvaged(w.ctx, recovered)
+	} else {
+		r, err = w.Config.parse(w.ctx, zr, zra)
 	}
-	r, err := Parse(zr)
 	if err != nil {
-		return fmt.Errorf("scanning jar: %v", err)
+		var ee *EntryError
+		if _, ok := err.(*TimeoutError); ok || errors.Is(err, ErrZipBomb) || errors.As(err, &ee) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scanning jar: %v", err)
+	}
+	if hash != nil {
+		if r.SHA256, err = hash.sum(); err != nil {
+			return nil, fmt.Errorf("hashing: %v", err)
+		}
+	}
+	w.progress.add(func(s *WalkStats) {
+		s.Archives++
+		s.Bytes += info.Size()
+		s.DecompressedBytes += r.Stats.DecompressedBytes
+	})
+	return r, nil
+}
+
+// handle passes the report of a parsed JAR to the handlers, and rewrites it
+// if it's vulnerable and Rewrite is set.
+func (w *walker) handle(fp string, r *Report) error {
+	if w.FollowClassPath {
+		defer w.followClassPath(fp, r)
 	}
 
-	if !r.Vulnerable {
+	if w.HandleScanned != nil {
+		w.HandleScanned(fp, r)
+	}
+	if w.HandleJAR != nil {
+		w.HandleJAR(fp, r)
+	}
+	if !r.Vulnerable || w.isStopped() {
 		return nil
 	}
-	w.handleReport(p, r)
+	w.handleReport(fp, r)
 
 	if !w.Rewrite {
 		return nil
 	}
+	if r.Salvaged {
+		return errors.New("not rewriting corrupt archive, replace it instead")
+	}
+	if err := readonly.Check("rewriting " + fp); err != nil {
+		return err
+	}
+	rewrite := w.rewriteFile
+	if r.Exploded {
+		rewrite = w.rewriteDir
+	}
+	if err := rewrite(fp); err != nil {
+		return err
+	}
+	w.handleRewrite(fp, r)
+	return nil
+}
 
-	tf, err := os.CreateTemp("", "")
+// rewriteFile replaces the JAR at fp with a rewritten copy, keeping its mode
+// and owner. The copy is written to a temporary file in the same directory
+// and verified before it atomically replaces the JAR, keeping the original
+// first if the walker has a Backup.
+func (w *Walker) rewriteFile(fp string) error {
+	f, err := os.Open(fp)
+	if err != nil {
+		return fmt.Errorf("open: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %v", err)
+	}
+	ra, size := openJMOD(f, info.Size())
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return fmt.Errorf("opennig file as a ZIP archive: %v", err)
+	}
+	if w.SkipSigned && signed(zr) {
+		return errors.New("not rewriting signed JAR, which would remove its signature")
+	}
+
+	// The temporary file is renamed over the JAR, so it must be on the same
+	// filesystem.
+	tf, err := os.CreateTemp(filepath.Dir(fp), "."+filepath.Base(fp)+".log4jscanner-")
 	if err != nil {
 		return fmt.Errorf("creating temp file: %v", err)
 	}
+	defer os.Remove(tf.Name())
 	defer tf.Close()
 
+	if _, ok := ra.(*jmodFile); ok {
+		// The archive of a JMOD file follows its header.
+		if _, err := tf.Write(jmodMagic); err != nil {
+			return fmt.Errorf("writing temp file: %v", err)
+		}
+	}
 	if err := Rewrite(tf, zr); err != nil {
-		return fmt.Errorf("failed to rewrite %s: %v", p, err)
+		return fmt.Errorf("failed to rewrite %s: %v", fp, err)
+	}
+	if err := tf.Sync(); err != nil {
+		return fmt.Errorf("syncing temp file: %v", err)
 	}
 	f.Close()
 	tf.Close()
-	if err := os.Chmod(tf.Name(), info.Mode()); err != nil {
-		return fmt.Errorf("chmod file: %v", err)
+	if err := verifyRewrite(tf.Name()); err != nil {
+		return fmt.Errorf("verifying rewrite of %s, leaving it unchanged: %v", fp, err)
 	}
+	if err := preserveMode(tf.Name(), info); err != nil {
+		return err
+	}
+	if w.Backup != nil {
+		if err := w.Backup.keep(fp, info); err != nil {
+			return fmt.Errorf("keeping original of %s, leaving it unchanged: %v", fp, err)
+		}
+	}
+	if err := os.Rename(tf.Name(), fp); err != nil {
+		return fmt.Errorf("overwriting %s: %v", fp, err)
+	}
+	return nil
+}
 
-	uid, gid, ok, err := fileOwner(info)
+// rewriteDir removes the JndiLookup classes from the exploded archive at fp,
+// see lookupClasses. The archive is first verified to no longer be
+// vulnerable without them, and the original of each is kept before it's
+// removed if the walker has a Backup. The archives within it are rewritten
+// as files of their own.
+func (w *Walker) rewriteDir(fp string) error {
+	fsys := dirFS(fp)
+	classes, err := lookupClasses(fsys)
 	if err != nil {
-		return fmt.Errorf("determining file owner: %v", err)
+		return fmt.Errorf("finding classes to remove: %v", err)
 	}
-	if ok {
-		if err := os.Chown(tf.Name(), int(uid), int(gid)); err != nil {
-			return fmt.Errorf("changing ownership of temporary file: %v", err)
+	if len(classes) == 0 {
+		return errors.New("no JndiLookup class to remove, replace log4j instead")
+	}
+	hidden := map[string]bool{}
+	for _, p := range classes {
+		hidden[p] = true
+	}
+	if err := verifyRemoval(hiddenFS{fsys, hidden}); err != nil {
+		return fmt.Errorf("verifying removal of classes from %s, leaving it unchanged: %v", fp, err)
+	}
+	for _, p := range classes {
+		cp := filepath.Join(fp, filepath.FromSlash(p))
+		if w.Backup != nil {
+			info, err := os.Lstat(cp)
+			if err != nil {
+				return fmt.Errorf("stat: %v", err)
+			}
+			if err := w.Backup.keep(cp, info); err != nil {
+				return fmt.Errorf("keeping original of %s, leaving it unchanged: %v", cp, err)
+			}
+		}
+		if err := os.Remove(cp); err != nil {
+			return fmt.Errorf("removing %s: %v", cp, err)
 		}
 	}
-	if err := os.Rename(tf.Name(), w.filepath(p)); err != nil {
-		return fmt.Errorf("overwriting %s: %v", p, err)
+	return nil
+}
+
+// verifyRemoval checks that an exploded archive, with its JndiLookup classes
+// hidden, is no longer found vulnerable by the rules enabled by default,
+// like verifyRewrite.
+func verifyRemoval(fsys fs.FS) error {
+	r, err := defaultConfig.parseDir(context.Background(), fsys)
+	if err != nil {
+		return fmt.Errorf("scanning exploded archive: %v", err)
+	}
+	if r.Vulnerable {
+		return fmt.Errorf("exploded archive is still vulnerable to %s", strings.Join(r.CVEs, ", "))
 	}
-	w.handleRewrite(p, r)
 	return nil
 }
+
+// verifyRewrite checks that a rewritten JAR can be read, and is no longer
+// found vulnerable by the rules the rewrite remediates, the rules enabled by
+// default.
+func verifyRewrite(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("reading rewritten JAR: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("reading rewritten JAR: %v", err)
+	}
+	r, err := defaultConfig.ParseReaderAt(context.Background(), f, info.Size())
+	if err != nil {
+		return fmt.Errorf("scanning rewritten JAR: %v", err)
+	}
+	if r.Vulnerable {
+		return fmt.Errorf("rewritten JAR is still vulnerable to %s", strings.Join(r.CVEs, ", "))
+	}
+	return nil
+}
+
+// followSymlink scans the archive or walks the directory a symlink points
+// to. Only ErrStopped is returned, other errors are passed to HandleError.
+func (w *walker) followSymlink(p string) error {
+	fp := w.filepath(p)
+	real, err := filepath.EvalSymlinks(fp)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			w.handleError(p, err)
+		}
+		return nil
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		w.handleError(p, err)
+		return nil
+	}
+	if info.IsDir() {
+		if w.links[PathKey(real)] {
+			return nil
+		}
+		w.links[PathKey(real)] = true
+		if err := w.Walker.walk(w.ctx, fp, w.links, w.pool); err == ErrStopped || err == w.ctx.Err() {
+			return err
+		} else if err != nil {
+			w.handleError(p, err)
+		}
+		return nil
+	}
+	if !info.Mode().IsRegular() || !(w.Detect.Candidate(p) || w.Detect.Candidate(real)) {
+		return nil
+	}
+	if _, err := w.submit(fp, func() (*Report, error) {
+		return w.parse(fp, func() (fs.File, error) {
+			return os.Open(fp)
+		})
+	}); err != nil {
+		w.handleError(p, err)
+	}
+	return nil
+}
+
+// followClassPath scans the JARs referenced by a JAR's Class-Path attribute
+// and jar index. References that don't exist are ignored, since it's common
+// for manifests to list optional libraries.
+func (w *walker) followClassPath(fp string, r *Report) {
+	for _, ref := range append(append([]string(nil), r.ClassPath...), r.Index...) {
+		if w.isStopped() || w.ctx.Err() != nil {
+			return
+		}
+		if strings.Contains(ref, ":") {
+			// Absolute URLs aren't followed.
+			continue
+		}
+		dir := strings.HasSuffix(ref, "/")
+		if dir && !w.Exploded {
+			continue
+		}
+		rp := filepath.Join(filepath.Dir(fp), filepath.FromSlash(ref))
+		info, err := os.Stat(rp)
+		if err != nil || info.IsDir() != dir || (!dir && !info.Mode().IsRegular()) {
+			continue
+		}
+		_, err = w.scan(rp, func() (*Report, error) {
+			if dir {
+				return w.parseExploded(dirFS(rp), ".")
+			}
+			return w.parse(rp, func() (fs.File, error) {
+				return os.Open(rp)
+			})
+		})
+		if err != nil {
+			w.handleFileError(rp, err)
+		}
+	}
+}
+
+// dirKey hashes the names, types, sizes, and modification times of the
+// entries of a directory, along with the rules used to scan them.
+func dirKey(entries []fs.DirEntry, rules string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", rules)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%q %d %d %d\n", e.Name(), info.Mode(), info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// enterDir starts tracking a directory, replaying its cached reports if its
+// key is unchanged.
+func (w *walker) enterDir(p string) {
+	ds := &dirState{path: p, reports: map[string]*Report{}}
+	w.dirs = append(w.dirs, ds)
+
+	entries, err := fs.ReadDir(w.fs, p)
+	if err != nil {
+		// The walk reports the error itself.
+		ds.failed = true
+		return
+	}
+	if ds.key, err = dirKey(entries, w.Config.key()); err != nil {
+		ds.failed = true
+		return
+	}
+	reports, ok, err := w.Cache.Get(w.filepath(p), ds.key)
+	if err != nil {
+		w.handleError(p, fmt.Errorf("reading cache: %v", err))
+		return
+	}
+	if !ok || (w.Rewrite && len(reports) > 0) {
+		return
+	}
+	ds.hit = true
+	for _, e := range entries {
+		r, ok := reports[e.Name()]
+		if !ok {
+			continue
+		}
+		fp := path.Join(p, e.Name())
+		if w.skipDir(fp, e) {
+			continue
+		}
+		w.progress.add(func(s *WalkStats) { s.Cached++ })
+		w.handleReport(w.filepath(fp), r)
+	}
+}
+
+// leaveDirs stops tracking the directories that don't contain p, storing
+// their reports. An empty path leaves every directory.
+func (w *walker) leaveDirs(p string) {
+	for len(w.dirs) > 0 {
+		ds := w.dirs[len(w.dirs)-1]
+		if p != "" && (ds.path == "." || p == ds.path || strings.HasPrefix(p, ds.path+"/")) {
+			return
+		}
+		w.dirs = w.dirs[:len(w.dirs)-1]
+		if ds.hit || ds.failed {
+			continue
+		}
+		if err := w.Cache.Put(w.filepath(ds.path), ds.key, ds.reports); err != nil {
+			w.handleError(ds.path, fmt.Errorf("writing cache: %v", err))
+		}
+	}
+}
+
+// dirState returns the state of a directory being walked.
+func (w *walker) dirState(dir string) *dirState {
+	for i := len(w.dirs) - 1; i >= 0; i-- {
+		if w.dirs[i].path == dir {
+			return w.dirs[i]
+		}
+	}
+	return nil
+}
+
+// cached reports if the files of a directory were replayed from the cache.
+func (w *walker) cached(dir string) bool {
+	ds := w.dirState(dir)
+	return ds != nil && ds.hit
+}
+
+// dontCache prevents a directory from being cached because some of its files
+// weren't scanned, due to errors or SkipDir, so they're scanned next time.
+func (w *walker) dontCache(dir string) {
+	if ds := w.dirState(dir); ds != nil {
+		ds.failed = true
+	}
+}
+
+func (w *walker) dirReport(p string, r *Report) {
+	if ds := w.dirState(path.Dir(p)); ds != nil {
+		ds.reports[path.Base(p)] = r
+	}
+}
@@ -15,10 +15,20 @@
 package jar
 
 import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
 )
 
 func TestWalker(t *testing.T) {
@@ -177,3 +187,940 @@ func TestWalkerRewrite(t *testing.T) {
 		t.Errorf("walking filesystem after rewrite returned diff (-want, +got): %s", diff)
 	}
 }
+
+func TestWalkerSkipSigned(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, file := range []string{"arara.jar", "arara.signed.jar"} {
+		cpFile(t, filepath.Join(tempDir, file), testdataPath(file))
+	}
+	var rewritten, failed []string
+	w := Walker{
+		Rewrite:    true,
+		SkipSigned: true,
+		HandleError: func(path string, err error) {
+			failed = append(failed, filepath.Base(path))
+		},
+		HandleRewrite: func(path string, r *Report) {
+			rewritten = append(rewritten, filepath.Base(path))
+		},
+	}
+	if err := w.Walk(tempDir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	if diff := cmp.Diff([]string{"arara.jar"}, rewritten); diff != "" {
+		t.Errorf("rewritten JARs returned diff (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff([]string{"arara.signed.jar"}, failed); diff != "" {
+		t.Errorf("JARs failing to rewrite returned diff (-want, +got): %s", diff)
+	}
+	zr, err := zip.OpenReader(filepath.Join(tempDir, "arara.signed.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	if !signed(&zr.Reader) {
+		t.Errorf("signed JAR was modified")
+	}
+}
+
+func TestWalkerFollowClassPath(t *testing.T) {
+	tempDir := t.TempDir()
+	appDir := filepath.Join(tempDir, "app")
+	libDir := filepath.Join(tempDir, "lib")
+
+	// The launcher's class path wraps onto a continuation line, references
+	// a missing JAR, and the vulnerable JAR twice.
+	testjar.WriteFile(t, filepath.Join(appDir, "launcher.jar"), testjar.Zip(t, zip.Deflate,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\r\n"+
+			"Main-Class: com.example.Main\r\n"+
+			"Class-Path: ../lib/missing.jar ../lib/vuln-cl\r\n"+
+			" ass.jar ../lib/\r\n"+
+			" vuln-class.jar\r\n"),
+		testjar.File("com/example/Main.class", ""),
+	))
+	cpFile(t, filepath.Join(libDir, "vuln-class.jar"), testdataPath("vuln-class.jar"))
+
+	var got []string
+	w := Walker{
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleReport: func(path string, r *Report) {
+			got = append(got, path)
+		},
+	}
+	if err := w.Walk(appDir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("walking without following class path reported %v, want none", got)
+	}
+
+	w.FollowClassPath = true
+	if err := w.Walk(appDir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	want := []string{filepath.Join(libDir, "vuln-class.jar")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("walking filesystem returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestWalkerSkipFile(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, file := range []string{"arara.jar", "log4j-core-2.1.jar", "vuln-class.jar"} {
+		cpFile(t, filepath.Join(tempDir, file), testdataPath(file))
+	}
+
+	var got []string
+	w := Walker{
+		// Skipping a file must not skip the rest of its directory.
+		SkipDir: func(path string, d fs.DirEntry) bool {
+			return filepath.Base(path) == "arara.jar"
+		},
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleReport: func(path string, r *Report) {
+			got = append(got, path)
+		},
+	}
+	if err := w.Walk(tempDir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	want := []string{
+		filepath.Join(tempDir, "log4j-core-2.1.jar"),
+		filepath.Join(tempDir, "vuln-class.jar"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("walking filesystem returned diff (-want, +got): %s", diff)
+	}
+}
+
+type mapCache map[string]struct {
+	key     string
+	reports map[string]*Report
+}
+
+func (c mapCache) Get(dir, key string) (map[string]*Report, bool, error) {
+	e, ok := c[dir]
+	if !ok || e.key != key {
+		return nil, false, nil
+	}
+	return e.reports, true, nil
+}
+
+func (c mapCache) Put(dir, key string, reports map[string]*Report) error {
+	c[dir] = struct {
+		key     string
+		reports map[string]*Report
+	}{key, reports}
+	return nil
+}
+
+func TestWalkerCache(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cpFile(t, filepath.Join(dir, "a", "vuln.jar"), testdataPath("vuln-class.jar"))
+	cpFile(t, filepath.Join(dir, "a", "safe.jar"), testdataPath("safe1.jar"))
+	cpFile(t, filepath.Join(dir, "b", "vuln.jar"), testdataPath("vuln-class.jar"))
+
+	cache := mapCache{}
+	// walk returns the reports of a walk, keyed by path relative to dir.
+	walk := func(skip string) map[string]*Report {
+		got := map[string]*Report{}
+		w := &Walker{
+			Cache: cache,
+			SkipDir: func(path string, de fs.DirEntry) bool {
+				return skip != "" && path == filepath.Join(dir, skip)
+			},
+			HandleError: func(path string, err error) {
+				t.Errorf("processing %s: %v", path, err)
+			},
+			HandleReport: func(path string, r *Report) {
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					t.Errorf("unexpected path %s", path)
+				}
+				got[filepath.ToSlash(rel)] = r
+			},
+		}
+		if err := w.Walk(dir); err != nil {
+			t.Fatalf("Walk() failed: %v", err)
+		}
+		return got
+	}
+	fromCache := func(dir string, r *Report) bool {
+		for _, cr := range cache[dir].reports {
+			if cr == r {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A skipped file prevents its directory from being cached, so it's
+	// scanned once it's no longer skipped.
+	if got := walk("b/vuln.jar"); len(got) != 1 || got["a/vuln.jar"] == nil {
+		t.Errorf("walk skipping b/vuln.jar reported %v, want only a/vuln.jar", got)
+	}
+	if _, ok := cache[filepath.Join(dir, "b")]; ok {
+		t.Errorf("directory with skipped file was cached")
+	}
+
+	first := walk("")
+	if len(first) != 2 {
+		t.Fatalf("first walk reported %v, want a/vuln.jar and b/vuln.jar", first)
+	}
+	second := walk("")
+	for _, p := range []string{"a/vuln.jar", "b/vuln.jar"} {
+		d := filepath.Join(dir, filepath.Dir(p))
+		if !fromCache(d, second[p]) {
+			t.Errorf("second walk didn't report %s from the cache", p)
+		}
+	}
+
+	// Changing a file invalidates only its directory.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a", "safe.jar"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	aReport := second["a/vuln.jar"]
+	third := walk("")
+	if third["a/vuln.jar"] == nil || third["a/vuln.jar"] == aReport {
+		t.Errorf("changed directory a wasn't rescanned")
+	}
+	if !fromCache(filepath.Join(dir, "b"), third["b/vuln.jar"]) {
+		t.Errorf("unchanged directory b was rescanned")
+	}
+}
+
+// mapFileCache is a FileCache safe for concurrent use.
+type mapFileCache struct {
+	mu    sync.Mutex
+	files map[string]fileCacheEntry
+	hits  int
+}
+
+type fileCacheEntry struct {
+	key    string
+	report *Report
+}
+
+func (c *mapFileCache) GetFile(path, key string) (*Report, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.files[path]
+	if !ok || e.key != key {
+		return nil, false, nil
+	}
+	c.hits++
+	return e.report, true, nil
+}
+
+func (c *mapFileCache) PutFile(path, key string, r *Report) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[path] = fileCacheEntry{key, r}
+	return nil
+}
+
+func TestWalkerFileCache(t *testing.T) {
+	dir := t.TempDir()
+	cpFile(t, filepath.Join(dir, "vuln.jar"), testdataPath("vuln-class.jar"))
+	cpFile(t, filepath.Join(dir, "safe.jar"), testdataPath("safe1.jar"))
+	cpFile(t, filepath.Join(dir, "notajar.jar"), testdataPath("notarealjar.jar"))
+
+	cache := &mapFileCache{files: map[string]fileCacheEntry{}}
+	walk := func(workers int) map[string]*Report {
+		got := map[string]*Report{}
+		w := &Walker{
+			FileCache: cache,
+			Workers:   workers,
+			HandleError: func(path string, err error) {
+				t.Errorf("processing %s: %v", path, err)
+			},
+			HandleReport: func(path string, r *Report) {
+				got[filepath.Base(path)] = r
+			},
+		}
+		if err := w.Walk(dir); err != nil {
+			t.Fatalf("Walk() failed: %v", err)
+		}
+		return got
+	}
+
+	first := walk(1)
+	if len(first) != 1 || first["vuln.jar"] == nil {
+		t.Fatalf("first walk reported %v, want vuln.jar", first)
+	}
+	if len(cache.files) != 3 || cache.hits != 0 {
+		t.Errorf("first walk cached %d files with %d hits, want 3 files and no hits", len(cache.files), cache.hits)
+	}
+	second := walk(4)
+	if second["vuln.jar"] != first["vuln.jar"] {
+		t.Errorf("second walk didn't report vuln.jar from the cache")
+	}
+	if cache.hits != 3 {
+		t.Errorf("second walk had %d cache hits, want 3", cache.hits)
+	}
+
+	// Changing a file only rescans that file.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "vuln.jar"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	third := walk(1)
+	if third["vuln.jar"] == nil || third["vuln.jar"] == first["vuln.jar"] {
+		t.Errorf("changed vuln.jar wasn't rescanned")
+	}
+	if cache.hits != 5 {
+		t.Errorf("third walk had %d cache hits, want 2 more", cache.hits-3)
+	}
+}
+
+func TestWalkerHandleJAR(t *testing.T) {
+	tempDir := t.TempDir()
+	testjar.WriteFile(t, filepath.Join(tempDir, "app.jar"), testjar.Zip(t, zip.Deflate,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\r\nMain-Class: com.example.Main\r\n"),
+		testjar.File("META-INF/INDEX.LIST", "JarIndex-Version: 1.0\r\n\r\n"+
+			"app.jar\r\ncom/example\r\n\r\n"+
+			"lib/vuln-class.jar\r\norg/apache/logging/log4j/jcl\r\n"),
+		testjar.File("com/example/Main.class", ""),
+	))
+	cpFile(t, filepath.Join(tempDir, "lib", "vuln-class.jar"), testdataPath("vuln-class.jar"))
+
+	got := map[string]*Report{}
+	w := Walker{
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleJAR: func(path string, r *Report) {
+			got[path] = r
+		},
+	}
+	if err := w.Walk(tempDir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	app, vuln := got[filepath.Join(tempDir, "app.jar")], got[filepath.Join(tempDir, "lib", "vuln-class.jar")]
+	if app == nil || vuln == nil {
+		t.Fatalf("HandleJAR wasn't called for every JAR, got %v", got)
+	}
+	if app.Vulnerable || !vuln.Vulnerable {
+		t.Errorf("HandleJAR reported vulnerable %t, %t, want false, true", app.Vulnerable, vuln.Vulnerable)
+	}
+	if diff := cmp.Diff([]string{"lib/vuln-class.jar"}, app.Index); diff != "" {
+		t.Errorf("jar index returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestWalkerHandleScanned(t *testing.T) {
+	dir := t.TempDir()
+	cpFile(t, filepath.Join(dir, "vuln-class.jar"), testdataPath("vuln-class.jar"))
+	cpFile(t, filepath.Join(dir, "safe1.jar"), testdataPath("safe1.jar"))
+
+	cache := mapCache{}
+	walk := func() []string {
+		var scanned []string
+		w := Walker{
+			Cache: cache,
+			HandleError: func(path string, err error) {
+				t.Errorf("processing %s: %v", path, err)
+			},
+			HandleScanned: func(path string, r *Report) {
+				scanned = append(scanned, filepath.Base(path))
+			},
+		}
+		if err := w.Walk(dir); err != nil {
+			t.Fatalf("walking filesystem: %v", err)
+		}
+		sort.Strings(scanned)
+		return scanned
+	}
+	if diff := cmp.Diff([]string{"safe1.jar", "vuln-class.jar"}, walk()); diff != "" {
+		t.Errorf("HandleScanned returned unexpected JARs (-want, +got):\n%s", diff)
+	}
+	if got := walk(); len(got) != 0 {
+		t.Errorf("HandleScanned was called for cached JARs %v", got)
+	}
+}
+
+// countingLimiter is a RateLimiter counting the files and bytes it paces.
+type countingLimiter struct {
+	mu    sync.Mutex
+	files int
+	bytes int
+}
+
+func (l *countingLimiter) WaitFile() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.files++
+}
+
+func (l *countingLimiter) WaitBytes(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bytes += n
+}
+
+func TestWalkerRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	cpFile(t, filepath.Join(dir, "vuln-class.jar"), testdataPath("vuln-class.jar"))
+	cpFile(t, filepath.Join(dir, "safe1.jar"), testdataPath("safe1.jar"))
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not an archive"), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	l := &countingLimiter{}
+	var got []string
+	w := Walker{
+		Config:  &Config{RateLimit: l},
+		Workers: 2,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleReport: func(path string, r *Report) {
+			got = append(got, filepath.Base(path))
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	if diff := cmp.Diff([]string{"vuln-class.jar"}, got); diff != "" {
+		t.Errorf("rate limited walk returned diff (-want, +got): %s", diff)
+	}
+	if l.files != 2 {
+		t.Errorf("WaitFile() called %d times, want 2", l.files)
+	}
+	if l.bytes == 0 {
+		t.Errorf("WaitBytes() wasn't called for the bytes read")
+	}
+}
+
+func TestWalkerSalvage(t *testing.T) {
+	dir := t.TempDir()
+	data, padding := paddedJAR(t, 4096)
+	if err := os.WriteFile(filepath.Join(dir, "truncated.jar"), data[:padding+100], 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	for _, salvage := range []bool{false, true} {
+		var reports []*Report
+		var errs []error
+		w := Walker{
+			Config: &Config{Salvage: salvage},
+			HandleError: func(path string, err error) {
+				errs = append(errs, err)
+			},
+			HandleReport: func(path string, r *Report) {
+				reports = append(reports, r)
+			},
+		}
+		if err := w.Walk(dir); err != nil {
+			t.Fatalf("walking filesystem: %v", err)
+		}
+		if !salvage {
+			var te *TruncatedError
+			if len(reports) != 0 || len(errs) != 1 || !errors.As(errs[0], &te) {
+				t.Errorf("walk without Salvage returned reports %v, errors %v, want a *TruncatedError", reports, errs)
+			}
+			continue
+		}
+		if len(errs) != 0 || len(reports) != 1 || !reports[0].Salvaged {
+			t.Errorf("walk with Salvage returned reports %v, errors %v, want a salvaged report", reports, errs)
+		}
+	}
+}
+
+func TestWalkerNewestFirst(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		path string
+		age  time.Duration
+	}{
+		{"backups/2012/vuln-class.jar", 10 * 365 * 24 * time.Hour},
+		{"app/lib/vuln-class.jar", time.Hour},
+		{"app/safe1.jar", 30 * time.Minute},
+		{"old/vuln-class.jar", 365 * 24 * time.Hour},
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f.path))
+		cpFile(t, p, testdataPath(filepath.Base(f.path)))
+		mtime := now.Add(-f.age)
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("setting modification time: %v", err)
+		}
+	}
+
+	var got []string
+	w := Walker{
+		NewestFirst: true,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleJAR: func(path string, r *Report) {
+			p, _ := filepath.Rel(dir, path)
+			got = append(got, filepath.ToSlash(p))
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	want := []string{"app/safe1.jar", "app/lib/vuln-class.jar", "old/vuln-class.jar", "backups/2012/vuln-class.jar"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("walk scanned JARs in an unexpected order (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWalkerFollowSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	cpFile(t, filepath.Join(dir, "app", "lib", "vuln-class.jar"), testdataPath("vuln-class.jar"))
+	cpFile(t, filepath.Join(outside, "lib", "arara.jar"), testdataPath("arara.jar"))
+	links := map[string]string{
+		"shared":       outside,
+		"loop":         dir,
+		"current.jar":  filepath.Join(dir, "app", "lib", "vuln-class.jar"),
+		"dangling.jar": filepath.Join(dir, "missing.jar"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("creating symlinks: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		follow bool
+		want   []string
+	}{
+		{"Skip", false, []string{"app/lib/vuln-class.jar"}},
+		{"Follow", true, []string{"app/lib/vuln-class.jar", "current.jar", "shared/lib/arara.jar"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			w := Walker{
+				FollowSymlinks: tc.follow,
+				HandleError: func(path string, err error) {
+					t.Errorf("processing %s: %v", path, err)
+				},
+				HandleJAR: func(path string, r *Report) {
+					p, _ := filepath.Rel(dir, path)
+					got = append(got, filepath.ToSlash(p))
+				},
+			}
+			if err := w.Walk(dir); err != nil {
+				t.Fatalf("walking filesystem: %v", err)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("walk scanned unexpected JARs (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWalkerExploded(t *testing.T) {
+	dir := t.TempDir()
+	unzip(t, filepath.Join(dir, "webapps", "app", "WEB-INF", "classes"), testdataPath("vuln-class.jar"))
+	cpFile(t, filepath.Join(dir, "webapps", "app", "WEB-INF", "lib", "vuln-class.jar"), testdataPath("vuln-class.jar"))
+	unzip(t, filepath.Join(dir, "webapps", "safe"), testdataPath("safe1.jar"))
+	unzip(t, filepath.Join(dir, "opt", "log4j"), testdataPath("log4j-core-2.14.0.jar"))
+	if err := os.MkdirAll(filepath.Join(dir, "empty", "WEB-INF"), 0755); err != nil {
+		t.Fatalf("creating directory: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		exploded    bool
+		newestFirst bool
+		workers     int
+		want        []string
+	}{
+		{
+			name: "Files",
+			want: []string{"webapps/app/WEB-INF/lib/vuln-class.jar vulnerable"},
+		},
+		{
+			name:     "Exploded",
+			exploded: true,
+			want: []string{
+				"empty exploded",
+				"opt/log4j exploded vulnerable",
+				"webapps/app exploded vulnerable",
+				"webapps/app/WEB-INF/lib/vuln-class.jar vulnerable",
+				"webapps/safe exploded",
+			},
+		},
+		{
+			name:        "NewestFirst",
+			exploded:    true,
+			newestFirst: true,
+			want: []string{
+				"empty exploded",
+				"opt/log4j exploded vulnerable",
+				"webapps/app exploded vulnerable",
+				"webapps/app/WEB-INF/lib/vuln-class.jar vulnerable",
+				"webapps/safe exploded",
+			},
+		},
+		{
+			name:     "Workers",
+			exploded: true,
+			workers:  4,
+			want: []string{
+				"empty exploded",
+				"opt/log4j exploded vulnerable",
+				"webapps/app exploded vulnerable",
+				"webapps/app/WEB-INF/lib/vuln-class.jar vulnerable",
+				"webapps/safe exploded",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			w := Walker{
+				Exploded:    tc.exploded,
+				NewestFirst: tc.newestFirst,
+				Workers:     tc.workers,
+				HandleError: func(path string, err error) {
+					t.Errorf("processing %s: %v", path, err)
+				},
+				HandleJAR: func(path string, r *Report) {
+					p, _ := filepath.Rel(dir, path)
+					s := filepath.ToSlash(p)
+					if r.Exploded {
+						s += " exploded"
+					}
+					if r.Vulnerable {
+						s += " vulnerable"
+					}
+					got = append(got, s)
+				},
+			}
+			if err := w.Walk(dir); err != nil {
+				t.Fatalf("walking filesystem: %v", err)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("walk scanned unexpected JARs (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWalkerExplodedRoot(t *testing.T) {
+	dir := t.TempDir()
+	unzip(t, filepath.Join(dir, "WEB-INF", "classes"), testdataPath("vuln-class.jar"))
+
+	var got []string
+	w := Walker{
+		Exploded: true,
+		Rewrite:  true,
+		HandleError: func(path string, err error) {
+			got = append(got, "error "+path)
+		},
+		HandleReport: func(path string, r *Report) {
+			got = append(got, "report "+path)
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	// Exploded archives are rewritten by removing their JndiLookup classes.
+	want := []string{"report " + dir}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("walk returned unexpected results (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWalkerRewriteExploded(t *testing.T) {
+	dir := t.TempDir()
+	app := filepath.Join(dir, "app")
+	unzip(t, filepath.Join(app, "WEB-INF", "classes"), testdataPath("log4j-core-2.14.0.jar"))
+	relocated := filepath.Join(t.TempDir(), "relocated.jar")
+	data := relocateJAR(t, "log4j-core-2.14.0.jar", strings.NewReplacer(
+		"org/apache/logging/log4j/", "org/elasticsearch/log4j/",
+		"JndiLookup", "JndiResolver",
+	))
+	if err := os.WriteFile(relocated, data, 0644); err != nil {
+		t.Fatalf("writing JAR: %v", err)
+	}
+	shaded := filepath.Join(dir, "shaded")
+	unzip(t, shaded, relocated)
+
+	lookup := filepath.Join(app, "WEB-INF", "classes", "org", "apache", "logging", "log4j", "core", "lookup", "JndiLookup.class")
+	resolver := filepath.Join(shaded, "org", "elasticsearch", "log4j", "core", "lookup", "JndiResolver.class")
+	b := &Backup{Suffix: ".bak"}
+	var rewritten []string
+	w := Walker{
+		Exploded: true,
+		Rewrite:  true,
+		Backup:   b,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleRewrite: func(path string, r *Report) {
+			rewritten = append(rewritten, path)
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	if diff := cmp.Diff([]string{app, shaded}, rewritten); diff != "" {
+		t.Errorf("walk rewrote unexpected directories (-want, +got):\n%s", diff)
+	}
+	for _, p := range []string{lookup, resolver} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("rewrite didn't remove %s: %v", p, err)
+		}
+	}
+	for _, d := range []string{app, shaded} {
+		if err := verifyRemoval(dirFS(d)); err != nil {
+			t.Errorf("rewritten directory %s failed verification: %v", d, err)
+		}
+	}
+
+	originals, err := b.Originals(dir)
+	if err != nil {
+		t.Fatalf("Originals() failed: %v", err)
+	}
+	want := []Original{
+		{Path: lookup, Backup: lookup + ".bak"},
+		{Path: resolver, Backup: resolver + ".bak"},
+	}
+	if diff := cmp.Diff(want, originals); diff != "" {
+		t.Fatalf("Originals() returned diff (-want, +got):\n%s", diff)
+	}
+	for _, o := range originals {
+		if err := o.Restore(); err != nil {
+			t.Fatalf("Restore() failed: %v", err)
+		}
+	}
+	for _, d := range []string{app, shaded} {
+		if err := verifyRemoval(dirFS(d)); err == nil {
+			t.Errorf("restored directory %s isn't vulnerable", d)
+		}
+	}
+}
+
+func TestWalkerExplodedClassPath(t *testing.T) {
+	dir := t.TempDir()
+	testjar.WriteFile(t, filepath.Join(dir, "bin", "launcher.jar"), testjar.Zip(t, zip.Deflate,
+		testjar.File("META-INF/MANIFEST.MF", "Manifest-Version: 1.0\r\n"+
+			"Main-Class: com.example.Main\r\n"+
+			"Class-Path: ../classes/ ../missing/\r\n"),
+		testjar.File("com/example/Main.class", ""),
+	))
+	unzip(t, filepath.Join(dir, "classes"), testdataPath("vuln-class.jar"))
+
+	var got []string
+	w := Walker{
+		Exploded:        true,
+		FollowClassPath: true,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleReport: func(path string, r *Report) {
+			got = append(got, path)
+		},
+	}
+	if err := w.Walk(filepath.Join(dir, "bin")); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	want := []string{filepath.Join(dir, "classes")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("walk returned unexpected reports (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWalkerWorkers(t *testing.T) {
+	walk := func(workers, max int) []string {
+		var got []string
+		w := Walker{
+			Workers:    workers,
+			MaxWorkers: max,
+			HandleError: func(path string, err error) {
+				got = append(got, "error "+path)
+			},
+			HandleReport: func(path string, r *Report) {
+				got = append(got, "report "+path)
+			},
+		}
+		if err := w.Walk("testdata"); err != nil {
+			t.Fatalf("walking filesystem: %v", err)
+		}
+		return got
+	}
+	want := walk(1, 0)
+	if len(want) == 0 {
+		t.Fatalf("sequential walk reported nothing")
+	}
+	for i := 0; i < 3; i++ {
+		if diff := cmp.Diff(want, walk(8, 0)); diff != "" {
+			t.Errorf("concurrent walk returned diff from sequential walk (-want, +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(want, walk(1, 16)); diff != "" {
+			t.Errorf("adaptive walk returned diff from sequential walk (-want, +got):\n%s", diff)
+		}
+	}
+}
+
+func TestWalkerWorkersRewrite(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"arara.jar", "vuln-class.jar", "safe1.jar"} {
+		cpFile(t, filepath.Join(dir, file), testdataPath(file))
+	}
+	var rewritten []string
+	w := Walker{
+		Workers: 4,
+		Rewrite: true,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleRewrite: func(path string, r *Report) {
+			rewritten = append(rewritten, filepath.Base(path))
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+	if diff := cmp.Diff([]string{"arara.jar", "vuln-class.jar"}, rewritten); diff != "" {
+		t.Errorf("walk rewrote unexpected JARs (-want, +got):\n%s", diff)
+	}
+
+	w = Walker{
+		Workers: 4,
+		HandleReport: func(path string, r *Report) {
+			t.Errorf("rewritten JAR %s still reported vulnerable", path)
+		},
+	}
+	if err := w.Walk(dir); err != nil {
+		t.Fatalf("walking filesystem: %v", err)
+	}
+}
+
+func TestWalkerStop(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, file := range []string{"arara.jar", "log4j-core-2.1.jar", "vuln-class.jar"} {
+		cpFile(t, filepath.Join(tempDir, "a", file), testdataPath(file))
+		cpFile(t, filepath.Join(tempDir, "b", file), testdataPath(file))
+	}
+
+	cache := mapCache{}
+	var got []string
+	w := &Walker{
+		Rewrite: true,
+		Cache:   cache,
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+	}
+	w.HandleReport = func(path string, r *Report) {
+		got = append(got, path)
+		if len(got) == 2 {
+			w.Stop()
+		}
+	}
+	if err := w.Walk(tempDir); err != ErrStopped {
+		t.Fatalf("Walk() returned %v, want ErrStopped", err)
+	}
+	want := []string{
+		filepath.Join(tempDir, "a", "arara.jar"),
+		filepath.Join(tempDir, "a", "log4j-core-2.1.jar"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("walking filesystem returned diff (-want, +got): %s", diff)
+	}
+	// The JAR the walk stopped at is still rewritten, later ones aren't.
+	for _, tc := range []struct {
+		file      string
+		rewritten bool
+	}{
+		{"a/log4j-core-2.1.jar", true},
+		{"a/vuln-class.jar", false},
+	} {
+		r, err := os.Open(filepath.Join(tempDir, tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		info, err := r.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(r, info.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep, err := Parse(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rep.Vulnerable == tc.rewritten {
+			t.Errorf("%s vulnerable after stopped walk: %v, want %v", tc.file, rep.Vulnerable, !tc.rewritten)
+		}
+	}
+	if len(cache) != 0 {
+		t.Errorf("stopped walk cached directories %v, want none", cache)
+	}
+	if err := w.Walk(tempDir); err != ErrStopped {
+		t.Errorf("Walk() after Stop() returned %v, want ErrStopped", err)
+	}
+}
+
+func TestWalkerContext(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, file := range []string{"arara.jar", "log4j-core-2.1.jar", "vuln-class.jar"} {
+		cpFile(t, filepath.Join(tempDir, file), testdataPath(file))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []string
+	w := &Walker{
+		HandleError: func(path string, err error) {
+			t.Errorf("processing %s: %v", path, err)
+		},
+		HandleReport: func(path string, r *Report) {
+			got = append(got, path)
+			cancel()
+		},
+	}
+	if err := w.WalkContext(ctx, tempDir); err != context.Canceled {
+		t.Fatalf("WalkContext() returned %v, want context.Canceled", err)
+	}
+	want := []string{filepath.Join(tempDir, "arara.jar")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("walking filesystem returned diff (-want, +got): %s", diff)
+	}
+
+	// Archives exceeding the timeout are reported as errors, and the walk
+	// goes on.
+	var timedOut []string
+	w = &Walker{
+		Config: &Config{Timeout: time.Nanosecond},
+		HandleError: func(path string, err error) {
+			if _, ok := err.(*TimeoutError); !ok {
+				t.Errorf("processing %s: %v", path, err)
+			}
+			timedOut = append(timedOut, path)
+		},
+		HandleReport: func(path string, r *Report) {
+			t.Errorf("unexpected report of %s", path)
+		},
+	}
+	if err := w.Walk(tempDir); err != nil {
+		t.Fatalf("Walk() failed: %v", err)
+	}
+	if len(timedOut) != 3 {
+		t.Errorf("Walk() timed out %v, want all 3 JARs", timedOut)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Thresholds of the time to open a file and read its ZIP directory, used to
+// adapt the number of workers to the latency of storage.
+const (
+	// slowOpen is the latency of network filesystems and spinning disks,
+	// where more workers keep more requests in flight.
+	slowOpen = time.Millisecond
+	// fastOpen is the latency of local SSDs and the page cache, where
+	// parsing is bound by the CPU.
+	fastOpen = 200 * time.Microsecond
+	// adaptInterval is how often the number of workers is adapted.
+	adaptInterval = 250 * time.Millisecond
+)
+
+// scanPool parses JARs on a number of worker goroutines, and calls the
+// handlers of each from a single goroutine in the order they were submitted,
+// so the output of a concurrent walk is the same as a sequential one.
+//
+// If max is more than min, the number of workers adapts between them to the
+// observed latency of opening files and the number of queued files.
+type scanPool struct {
+	jobs  chan *scanJob
+	order chan *scanJob
+
+	min, max int
+	// quit stops one worker, when shrinking the pool.
+	quit chan struct{}
+	stop chan struct{}
+
+	mu sync.Mutex
+	// running is the number of workers.
+	running int
+	// latency is a moving average of the time to open files.
+	latency time.Duration
+
+	workers sync.WaitGroup
+	adapter sync.WaitGroup
+	handled chan struct{}
+}
+
+type scanJob struct {
+	// work is run by a worker, and may be nil.
+	work func()
+	// done is closed once work returns.
+	done chan struct{}
+	// then is run by the handling goroutine once work returns.
+	then func()
+}
+
+// newScanPool starts min workers, adapting up to max, and the handling
+// goroutine.
+func newScanPool(min, max int) *scanPool {
+	if max < min {
+		max = min
+	}
+	p := &scanPool{
+		// Bound the number of parsed JARs waiting to be handled.
+		jobs:    make(chan *scanJob, max),
+		order:   make(chan *scanJob, 2*max),
+		min:     min,
+		max:     max,
+		quit:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		handled: make(chan struct{}),
+	}
+	for i := 0; i < min; i++ {
+		p.startWorker()
+	}
+	go func() {
+		defer close(p.handled)
+		for j := range p.order {
+			<-j.done
+			j.then()
+		}
+	}()
+	if max > min {
+		p.adapter.Add(1)
+		go p.adapt()
+	}
+	return p
+}
+
+func (p *scanPool) startWorker() {
+	p.mu.Lock()
+	p.running++
+	p.mu.Unlock()
+	p.workers.Add(1)
+	go func() {
+		defer p.workers.Done()
+		for {
+			select {
+			case <-p.quit:
+				return
+			case j, ok := <-p.jobs:
+				if !ok {
+					return
+				}
+				j.work()
+				close(j.done)
+			}
+		}
+	}()
+}
+
+// adapt adjusts the number of workers every adaptInterval until the pool is
+// closed.
+func (p *scanPool) adapt() {
+	defer p.adapter.Done()
+	t := time.NewTicker(adaptInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+		}
+		p.mu.Lock()
+		cur, latency := p.running, p.latency
+		p.mu.Unlock()
+		next := adaptWorkers(cur, p.min, p.max, len(p.jobs), latency, runtime.GOMAXPROCS(0))
+		for ; cur < next; cur++ {
+			p.startWorker()
+		}
+		for ; cur > next; cur-- {
+			select {
+			case p.quit <- struct{}{}:
+				p.mu.Lock()
+				p.running--
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}
+}
+
+// adaptWorkers returns the number of workers to run, given the current
+// number, the files queued for them, and the average latency of opening a
+// file. Workers are added while files are queued and either storage is slow,
+// since their time is spent waiting on it, or CPUs are idle. Workers are
+// removed once nothing is queued, as the walk is the bottleneck, or once
+// storage is fast and there are more workers than CPUs.
+func adaptWorkers(cur, min, max, queued int, latency time.Duration, cpus int) int {
+	next := cur
+	switch {
+	case queued > 0 && (latency >= slowOpen || cur < cpus):
+		next = cur + 1
+	case queued == 0:
+		next = cur - 1
+	case latency <= fastOpen && cur > cpus:
+		next = cur - 1
+	}
+	if next < min {
+		next = min
+	}
+	if next > max {
+		next = max
+	}
+	return next
+}
+
+// observe records the time it took to open a file.
+func (p *scanPool) observe(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.latency == 0 {
+		p.latency = d
+		return
+	}
+	// An exponentially weighted moving average, favoring recent files.
+	p.latency = (p.latency*7 + d) / 8
+}
+
+// submit queues work to be run by a worker, then then to be run by the
+// handling goroutine after every previously submitted job.
+func (p *scanPool) submit(work, then func()) {
+	j := &scanJob{work: work, done: make(chan struct{}), then: then}
+	p.order <- j
+	p.jobs <- j
+}
+
+// emit queues f to be run by the handling goroutine after every previously
+// submitted job, such as to report an error found by the walk in order.
+func (p *scanPool) emit(f func()) {
+	done := make(chan struct{})
+	close(done)
+	p.order <- &scanJob{done: done, then: f}
+}
+
+// close waits for every submitted job to be handled, and stops the pool.
+func (p *scanPool) close() {
+	close(p.stop)
+	p.adapter.Wait()
+	close(p.jobs)
+	close(p.order)
+	p.workers.Wait()
+	<-p.handled
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptWorkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		cur      int
+		min, max int
+		queued   int
+		latency  time.Duration
+		cpus     int
+		want     int
+	}{
+		{"SlowStorage", 8, 1, 32, 4, 10 * time.Millisecond, 4, 9},
+		{"SlowStorageAtMax", 32, 1, 32, 4, 10 * time.Millisecond, 4, 32},
+		{"IdleCPUs", 2, 1, 32, 4, 50 * time.Microsecond, 4, 3},
+		{"FastStorage", 8, 1, 32, 4, 50 * time.Microsecond, 4, 7},
+		{"FastStorageAtCPUs", 4, 1, 32, 4, 50 * time.Microsecond, 4, 4},
+		{"NothingQueued", 8, 1, 32, 0, 10 * time.Millisecond, 4, 7},
+		{"NothingQueuedAtMin", 2, 2, 32, 0, 10 * time.Millisecond, 4, 2},
+		{"ModerateStorage", 8, 1, 32, 4, 500 * time.Microsecond, 4, 8},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := adaptWorkers(tc.cur, tc.min, tc.max, tc.queued, tc.latency, tc.cpus)
+			if got != tc.want {
+				t.Errorf("adaptWorkers(%d, %d, %d, %d, %v, %d) = %d, want %d",
+					tc.cur, tc.min, tc.max, tc.queued, tc.latency, tc.cpus, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScanPoolAdapts(t *testing.T) {
+	p := newScanPool(1, 4)
+	defer p.close()
+	p.observe(10 * time.Millisecond)
+
+	// Keep files queued until the pool has grown.
+	release := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		p.submit(func() { <-release }, func() {})
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		p.mu.Lock()
+		running := p.running
+		p.mu.Unlock()
+		if running == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool has %d workers, want 4", running)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+}
@@ -0,0 +1,244 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReadRules reads custom rules written in a subset of the YARA language, to
+// be registered with RegisterRule. Each rule lists strings and a condition
+// on them, evaluated against the content of every class:
+//
+//	rule ACME-LOGGING-JNDI {
+//	    meta:
+//	        cve = "ACME-2022-0001"
+//	        severity = "high"
+//	        description = "ACME logging with JNDI lookups"
+//	        path = "com/acme/logging/"
+//	    strings:
+//	        $lookup = "JndiLookup"
+//	        $init = { 3c 69 6e 69 74 3e }
+//	    condition:
+//	        all of them
+//	}
+//
+// The meta section sets the rule's cve, the severity of a CVE unknown to this
+// package, its description, a path the class's path must contain, and
+// "optin = true" for opt-in rules. Strings are text, with \", \\, \n, \t and
+// \xNN escapes, or hex bytes without wildcards. The condition is "any of
+// them", "all of them", or a single string such as "$lookup". Lines starting
+// with "//" are comments.
+func ReadRules(r io.Reader) ([]Rule, error) {
+	var (
+		rules   []Rule
+		rule    *Rule
+		m       *stringMatcher
+		section string
+		n       int
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if rule == nil {
+			sub := ruleHeader.FindStringSubmatch(line)
+			if sub == nil {
+				return nil, fmt.Errorf("line %d: expected \"rule NAME {\", got %q", n, line)
+			}
+			rule, m, section = &Rule{ID: sub[1]}, &stringMatcher{}, ""
+			continue
+		}
+		switch line {
+		case "}":
+			if err := m.compile(); err != nil {
+				return nil, fmt.Errorf("line %d: rule %s: %v", n, rule.ID, err)
+			}
+			rule.Matcher = m
+			rules = append(rules, *rule)
+			rule = nil
+			continue
+		case "meta:", "strings:", "condition:":
+			section = strings.TrimSuffix(line, ":")
+			continue
+		}
+		var err error
+		switch section {
+		case "meta":
+			err = rule.setMeta(m, line)
+		case "strings":
+			err = m.addString(line)
+		case "condition":
+			if m.condition != "" {
+				err = fmt.Errorf("multiple conditions")
+			}
+			m.condition = line
+		default:
+			err = fmt.Errorf("expected a section, got %q", line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: rule %s: %v", n, rule.ID, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if rule != nil {
+		return nil, fmt.Errorf("line %d: rule %s isn't closed", n, rule.ID)
+	}
+	return rules, nil
+}
+
+var (
+	ruleHeader  = regexp.MustCompile(`^rule\s+([A-Za-z0-9_-]+)\s*\{$`)
+	metaLine    = regexp.MustCompile(`^([a-z]+)\s*=\s*(.+)$`)
+	stringLine  = regexp.MustCompile(`^\$([A-Za-z0-9_]+)\s*=\s*(.+)$`)
+	hexString   = regexp.MustCompile(`^\{([0-9A-Fa-f\s]+)\}$`)
+	conditionID = regexp.MustCompile(`^\$([A-Za-z0-9_]+)$`)
+)
+
+// setMeta sets a field of the rule from a line of its meta section.
+func (r *Rule) setMeta(m *stringMatcher, line string) error {
+	sub := metaLine.FindStringSubmatch(line)
+	if sub == nil {
+		return fmt.Errorf("expected \"key = value\", got %q", line)
+	}
+	key, raw := sub[1], sub[2]
+	if key == "optin" {
+		b, err := strconv.ParseBool(raw)
+		r.OptIn = b
+		return err
+	}
+	v, err := strconv.Unquote(raw)
+	if err != nil {
+		return fmt.Errorf("%s: expected a quoted string, got %s", key, raw)
+	}
+	switch key {
+	case "cve":
+		r.CVE = strings.ToUpper(v)
+	case "severity":
+		r.Severity, err = ParseSeverity(v)
+	case "description":
+		r.Description = v
+	case "path":
+		m.path = v
+	default:
+		err = fmt.Errorf("unknown meta %q", key)
+	}
+	return err
+}
+
+// stringMatcher is the Matcher of rules read by ReadRules.
+type stringMatcher struct {
+	// path, if set, must be contained in the path of matching classes.
+	path      string
+	names     []string
+	strings   [][]byte
+	condition string
+	// all reports if every string must be found, rather than any.
+	all bool
+}
+
+// addString adds a string from a line of the strings section.
+func (m *stringMatcher) addString(line string) error {
+	sub := stringLine.FindStringSubmatch(line)
+	if sub == nil {
+		return fmt.Errorf("expected \"$name = value\", got %q", line)
+	}
+	name, raw := sub[1], sub[2]
+	for _, n := range m.names {
+		if n == name {
+			return fmt.Errorf("duplicate string $%s", name)
+		}
+	}
+	var b []byte
+	if h := hexString.FindStringSubmatch(raw); h != nil {
+		var err error
+		if b, err = hex.DecodeString(strings.Join(strings.Fields(h[1]), "")); err != nil {
+			return fmt.Errorf("$%s: %v", name, err)
+		}
+	} else {
+		v, err := strconv.Unquote(raw)
+		if err != nil {
+			return fmt.Errorf("$%s: expected a quoted string or hex bytes, got %s", name, raw)
+		}
+		b = []byte(v)
+	}
+	if len(b) == 0 {
+		return fmt.Errorf("$%s is empty", name)
+	}
+	m.names = append(m.names, name)
+	m.strings = append(m.strings, b)
+	return nil
+}
+
+// compile checks the strings and condition of a complete rule.
+func (m *stringMatcher) compile() error {
+	if len(m.strings) == 0 {
+		return fmt.Errorf("no strings")
+	}
+	switch m.condition {
+	case "any of them":
+	case "all of them":
+		m.all = true
+	case "":
+		return fmt.Errorf("no condition")
+	default:
+		sub := conditionID.FindStringSubmatch(m.condition)
+		if sub == nil {
+			return fmt.Errorf("unsupported condition %q, expected \"any of them\", \"all of them\", or a string", m.condition)
+		}
+		for i, n := range m.names {
+			if n == sub[1] {
+				m.names, m.strings = m.names[i:i+1], m.strings[i:i+1]
+				return nil
+			}
+		}
+		return fmt.Errorf("condition references undefined string $%s", sub[1])
+	}
+	return nil
+}
+
+// Match returns the offset of the first string found, if the condition is
+// met.
+func (m *stringMatcher) Match(p string, content []byte) int {
+	if m.path != "" && !strings.Contains(p, m.path) {
+		return -1
+	}
+	first := -1
+	for _, s := range m.strings {
+		i := bytes.Index(content, s)
+		if i < 0 {
+			if m.all {
+				return -1
+			}
+			continue
+		}
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	return first
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testRules = `// Rules for testing.
+rule TEST-LOOKUP {
+    meta:
+        cve = "test-2022-0001"
+        severity = "high"
+        description = "JndiLookup class"
+        path = "core/lookup/"
+        optin = true
+    strings:
+        $name = "JndiLookup"
+        $init = { 3c 69 6e 69 74 3e }
+    condition:
+        all of them
+}
+
+rule TEST-MISSING {
+    meta:
+        cve = "CVE-2021-44228"
+        optin = true
+    strings:
+        $a = "org/acme/\x00missing"
+        $b = "JndiLookup"
+    condition:
+        $a
+}
+`
+
+func TestReadRules(t *testing.T) {
+	rules, err := ReadRules(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatalf("ReadRules() failed: %v", err)
+	}
+	var ids []string
+	for _, r := range rules {
+		ids = append(ids, r.ID)
+	}
+	if diff := cmp.Diff([]string{"TEST-LOOKUP", "TEST-MISSING"}, ids); diff != "" {
+		t.Fatalf("ReadRules() returned unexpected rules (-want, +got): %s", diff)
+	}
+	r := rules[0]
+	if r.CVE != "TEST-2022-0001" || r.Severity != SeverityHigh || !r.OptIn || r.Description != "JndiLookup class" {
+		t.Errorf("ReadRules() returned unexpected rule: %+v", r)
+	}
+
+	testCases := []struct {
+		name    string
+		matcher Matcher
+		path    string
+		content string
+		want    int
+	}{
+		{"All", rules[0].Matcher, "org/apache/logging/log4j/core/lookup/JndiLookup.class", "..<init>..JndiLookup", 2},
+		{"AllMissing", rules[0].Matcher, "org/apache/logging/log4j/core/lookup/JndiLookup.class", "JndiLookup", -1},
+		{"OtherPath", rules[0].Matcher, "com/example/JndiLookup.class", "<init>JndiLookup", -1},
+		{"Single", rules[1].Matcher, "A.class", "JndiLookup", -1},
+		{"SingleEscaped", rules[1].Matcher, "A.class", "org/acme/\x00missing", 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.matcher.Match(tc.path, []byte(tc.content)); got != tc.want {
+				t.Errorf("Match() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadRulesErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rules string
+	}{
+		{"NoHeader", "$a = \"x\"\n"},
+		{"Unclosed", "rule A {\nstrings:\n$a = \"x\"\ncondition:\nany of them\n"},
+		{"NoStrings", "rule A {\ncondition:\nany of them\n}\n"},
+		{"NoCondition", "rule A {\nstrings:\n$a = \"x\"\n}\n"},
+		{"UnknownMeta", "rule A {\nmeta:\nauthor = \"x\"\nstrings:\n$a = \"x\"\ncondition:\nany of them\n}\n"},
+		{"BadHex", "rule A {\nstrings:\n$a = { 3c 6 }\ncondition:\nany of them\n}\n"},
+		{"UndefinedString", "rule A {\nstrings:\n$a = \"x\"\ncondition:\n$b\n}\n"},
+		{"UnsupportedCondition", "rule A {\nstrings:\n$a = \"x\"\ncondition:\n#a > 2\n}\n"},
+		{"DuplicateString", "rule A {\nstrings:\n$a = \"x\"\n$a = \"y\"\ncondition:\nany of them\n}\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ReadRules(strings.NewReader(tc.rules)); err == nil {
+				t.Errorf("ReadRules() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	defer func(rules []Rule) { Rules = rules }(Rules)
+	defer delete(cveSeverity, "TEST-2022-0001")
+
+	rules, err := ReadRules(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatalf("ReadRules() failed: %v", err)
+	}
+	for _, r := range rules {
+		if err := RegisterRule(r); err != nil {
+			t.Fatalf("RegisterRule(%s) failed: %v", r.ID, err)
+		}
+	}
+	if err := RegisterRule(rules[0]); err == nil {
+		t.Errorf("RegisterRule() of a duplicate rule succeeded")
+	}
+	if err := RegisterRule(Rule{ID: "TEST-NO-SEVERITY", CVE: "TEST-2022-0002", Matcher: rules[0].Matcher}); err == nil {
+		t.Errorf("RegisterRule() of an unknown CVE without severity succeeded")
+	}
+
+	zr, err := zip.OpenReader(testdataPath("log4j-core-2.14.0.jar"))
+	if err != nil {
+		t.Fatalf("zip.OpenReader failed: %v", err)
+	}
+	defer zr.Close()
+	cfg := &Config{EnableRules: []string{"TEST-LOOKUP", "TEST-MISSING"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	report, err := cfg.Parse(zr)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if diff := cmp.Diff([]string{"TEST-LOOKUP"}, report.Rules); diff != "" {
+		t.Errorf("Parse() returned unexpected rules (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff([]string{"TEST-2022-0001"}, report.CVEs); diff != "" {
+		t.Errorf("Parse() returned unexpected CVEs (-want, +got): %s", diff)
+	}
+	if got := report.Severity(); got != SeverityHigh {
+		t.Errorf("Severity() = %s, want %s", got, SeverityHigh)
+	}
+}
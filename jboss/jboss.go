@@ -0,0 +1,124 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jboss understands the JBoss Modules layout used by JBoss EAP and
+// WildFly, where libraries are described by modules/**/module.xml files.
+package jboss
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Module is a module described by a module.xml file.
+type Module struct {
+	// Name and Slot identify the module, e.g. "org.apache.logging.log4j.api"
+	// and "main".
+	Name string
+	Slot string
+	// Path is the location of the module.xml file.
+	Path string
+	// Resources holds the paths of the module's resource roots, such as JARs,
+	// resolved relative to the module.xml file.
+	Resources []string
+}
+
+// ID returns the "name:slot" identifier of the module.
+func (m *Module) ID() string {
+	slot := m.Slot
+	if slot == "" {
+		slot = "main"
+	}
+	return m.Name + ":" + slot
+}
+
+type moduleXML struct {
+	XMLName   xml.Name `xml:"module"`
+	Name      string   `xml:"name,attr"`
+	Slot      string   `xml:"slot,attr"`
+	Resources struct {
+		Roots []struct {
+			Path string `xml:"path,attr"`
+		} `xml:"resource-root"`
+	} `xml:"resources"`
+}
+
+// ParseModule parses a module.xml file. Module aliases and other documents
+// that don't describe a module with resources return a nil Module.
+func ParseModule(path string) (*Module, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mx moduleXML
+	if err := xml.Unmarshal(b, &mx); err != nil {
+		if _, ok := err.(xml.UnmarshalError); ok {
+			// A different root element, such as <module-alias>.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if len(mx.Resources.Roots) == 0 {
+		return nil, nil
+	}
+	m := &Module{Name: mx.Name, Slot: mx.Slot, Path: path}
+	dir := filepath.Dir(path)
+	for _, root := range mx.Resources.Roots {
+		if root.Path == "" {
+			continue
+		}
+		p := filepath.FromSlash(root.Path)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		m.Resources = append(m.Resources, p)
+	}
+	return m, nil
+}
+
+// Find walks a directory, such as $JBOSS_HOME/modules, returning every module
+// found. Errors for individual module.xml files are passed to handleError, if
+// provided, and don't stop the walk.
+func Find(root string, handleError func(path string, err error)) ([]*Module, error) {
+	var mods []*Module
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			if handleError != nil {
+				handleError(p, err)
+			}
+			return nil
+		}
+		if d.IsDir() || d.Name() != "module.xml" {
+			return nil
+		}
+		m, err := ParseModule(p)
+		if err != nil {
+			if handleError != nil {
+				handleError(p, err)
+			}
+			return nil
+		}
+		if m != nil {
+			mods = append(mods, m)
+		}
+		return nil
+	})
+	return mods, err
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jboss
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	log4jDir := filepath.Join(root, "system/layers/base/org/apache/logging/log4j/api/main")
+	testjar.WriteFile(t, filepath.Join(log4jDir, "module.xml"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<module name="org.apache.logging.log4j.api" xmlns="urn:jboss:module:1.9">
+    <resources>
+        <resource-root path="log4j-api-2.14.0.jar"/>
+        <resource-root path="lib/log4j-core-2.14.0.jar"/>
+    </resources>
+    <dependencies>
+        <module name="java.base"/>
+    </dependencies>
+</module>
+`))
+	testjar.WriteFile(t, filepath.Join(root, "org/example/alias/main/module.xml"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<module-alias name="org.example.alias" target-name="org.apache.logging.log4j.api" xmlns="urn:jboss:module:1.9"/>
+`))
+	testjar.WriteFile(t, filepath.Join(root, "org/example/broken/main/module.xml"), []byte(`<module`))
+
+	var errs []string
+	got, err := Find(root, func(path string, err error) {
+		errs = append(errs, path)
+	})
+	if err != nil {
+		t.Fatalf("Find() failed: %v", err)
+	}
+	want := []*Module{
+		{
+			Name: "org.apache.logging.log4j.api",
+			Path: filepath.Join(log4jDir, "module.xml"),
+			Resources: []string{
+				filepath.Join(log4jDir, "log4j-api-2.14.0.jar"),
+				filepath.Join(log4jDir, "lib", "log4j-core-2.14.0.jar"),
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Find() returned diff (-want, +got): %s", diff)
+	}
+	if len(errs) != 1 || errs[0] != filepath.Join(root, "org/example/broken/main/module.xml") {
+		t.Errorf("Find() reported errors for %v, want only broken module", errs)
+	}
+	if id := got[0].ID(); id != "org.apache.logging.log4j.api:main" {
+		t.Errorf("ID() returned %q, want %q", id, "org.apache.logging.log4j.api:main")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"log4jscanner/jboss"
+)
+
+// jbossModules maps the resource roots of JBoss modules to their module.
+type jbossModules map[string]*jboss.Module
+
+// findJBossModules collects the modules described under the provided
+// directories.
+func findJBossModules(dirs []string, handleError func(path string, err error)) jbossModules {
+	mods := jbossModules{}
+	for _, dir := range dirs {
+		found, err := jboss.Find(dir, handleError)
+		if err != nil {
+			log.Printf("Error: finding JBoss modules in %s: %v", dir, err)
+			continue
+		}
+		for _, m := range found {
+			for _, r := range m.Resources {
+				mods[filepath.Clean(r)] = m
+			}
+		}
+	}
+	return mods
+}
+
+// module returns the module a path belongs to, or nil.
+func (j jbossModules) module(path string) *jboss.Module {
+	return j[filepath.Clean(path)]
+}
+
+// outside returns resource roots that aren't within any of the provided
+// directories, and so won't be found by walking them.
+func (j jbossModules) outside(dirs []string) []string {
+	var paths []string
+	for p := range j {
+		in := false
+		for _, dir := range dirs {
+			rel, err := filepath.Rel(dir, p)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package locations classifies where a JAR was found. JARs in temporary,
+// upload, or home directories often indicate payloads dropped by an attacker
+// rather than legitimate deployments, so findings there deserve priority.
+package locations
+
+import (
+	"path"
+	"strings"
+)
+
+// Reasons a location is unusual.
+const (
+	Temp   = "temp directory"
+	Upload = "upload directory"
+	Home   = "home directory"
+	Custom = "unusual directory"
+)
+
+// devCaches are directories of build tools that legitimately hold JARs inside
+// home directories.
+var devCaches = map[string]bool{
+	".m2":       true,
+	".gradle":   true,
+	".ivy2":     true,
+	".sbt":      true,
+	".coursier": true,
+	".jdks":     true,
+	".sdkman":   true,
+}
+
+// uploadDirs are directory names web applications commonly store uploads in.
+var uploadDirs = map[string]bool{
+	"upload":       true,
+	"uploads":      true,
+	"uploaded":     true,
+	"fileupload":   true,
+	"fileuploads":  true,
+	"user-uploads": true,
+}
+
+// tempPrefixes are temporary directories, in the normalized form of
+// normalize.
+var tempPrefixes = []string{
+	"/tmp/",
+	"/var/tmp/",
+	"/dev/shm/",
+	"/private/tmp/",
+	"/private/var/tmp/",
+	"/private/var/folders/",
+	"c:/windows/temp/",
+}
+
+// Classifier classifies the locations of JARs.
+type Classifier struct {
+	// Dirs holds additional glob patterns of unusual directories, such as
+	// the upload directory of an application ("/srv/app/files"). JARs in
+	// matching directories or their subdirectories are unusual.
+	Dirs []string
+}
+
+// Classify returns why a JAR's location is unusual, or "" if it isn't. Both
+// Unix and Windows paths are supported, regardless of the current platform.
+func (c *Classifier) Classify(p string) string {
+	n := normalize(p)
+	segs := strings.Split(strings.Trim(n, "/"), "/")
+	dirs := segs[:len(segs)-1]
+	lead := ""
+	if strings.HasPrefix(n, "/") {
+		lead = "/"
+	}
+
+	for _, pattern := range c.Dirs {
+		pattern = normalize(pattern)
+		for i := range dirs {
+			dir := lead + strings.Join(dirs[:i+1], "/")
+			if ok, err := path.Match(pattern, dir); err == nil && ok {
+				return Custom
+			}
+		}
+	}
+	for _, d := range dirs {
+		if devCaches[d] {
+			return ""
+		}
+	}
+	for _, prefix := range tempPrefixes {
+		if strings.HasPrefix(n, prefix) {
+			return Temp
+		}
+	}
+	for i, d := range dirs {
+		// %LOCALAPPDATA%\Temp.
+		if d == "appdata" && i+2 < len(dirs) && dirs[i+1] == "local" && dirs[i+2] == "temp" {
+			return Temp
+		}
+	}
+	for _, d := range dirs {
+		if uploadDirs[d] {
+			return Upload
+		}
+	}
+	switch {
+	case strings.HasPrefix(n, "/root/"),
+		len(dirs) >= 2 && (dirs[0] == "home" || dirs[0] == "users"),
+		len(dirs) >= 3 && dirs[0] == "c:" && dirs[1] == "users":
+		return Home
+	}
+	return ""
+}
+
+// normalize lowercases Windows paths and converts them to forward slashes, so
+// "C:\Users\a" becomes "c:/users/a". Unix paths are returned as is, except
+// for the "/Users" directory of macOS which is lowercased.
+func normalize(p string) string {
+	if isWindows(p) {
+		return strings.ToLower(strings.ReplaceAll(p, `\`, "/"))
+	}
+	if strings.HasPrefix(p, "/Users/") {
+		return "/users/" + p[len("/Users/"):]
+	}
+	return p
+}
+
+// isWindows reports if p is a Windows path with a drive letter, or a UNC
+// path.
+func isWindows(p string) bool {
+	if strings.HasPrefix(p, `\\`) {
+		return true
+	}
+	return len(p) >= 3 && p[1] == ':' && (p[2] == '\\' || p[2] == '/')
+}
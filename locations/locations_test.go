@@ -0,0 +1,53 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locations
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	c := &Classifier{Dirs: []string{"/srv/*/files", `D:\Shares\Drop`}}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/opt/app/lib/log4j-core-2.14.1.jar", ""},
+		{"/var/lib/tomcat9/webapps/app.war", ""},
+		{"/tmp/x.jar", Temp},
+		{"/tmp/hsperfdata/a/b.jar", Temp},
+		{"/var/tmp/payload.jar", Temp},
+		{"/dev/shm/.x/payload.jar", Temp},
+		{"/private/var/folders/zz/T/a.jar", Temp},
+		{`C:\Windows\Temp\payload.jar`, Temp},
+		{`C:\Users\alice\AppData\Local\Temp\payload.jar`, Temp},
+		{"/var/www/html/uploads/shell.jar", Upload},
+		{`C:\inetpub\wwwroot\Upload\a.jar`, Upload},
+		{"/home/alice/Downloads/a.jar", Home},
+		{"/root/a.jar", Home},
+		{"/Users/alice/a.jar", Home},
+		{`C:\Users\alice\Desktop\a.jar`, Home},
+		{"/home/alice/.m2/repository/org/apache/logging/log4j/log4j-core/2.14.1/log4j-core-2.14.1.jar", ""},
+		{`C:\Users\alice\.gradle\caches\a.jar`, ""},
+		{"/home/alice", ""},
+		{"/srv/app/files/a.jar", Custom},
+		{"/srv/app/files/sub/a.jar", Custom},
+		{"/srv/app/lib/a.jar", ""},
+		{`d:\shares\drop\a.jar`, Custom},
+	}
+	for _, tc := range tests {
+		if got := c.Classify(tc.path); got != tc.want {
+			t.Errorf("Classify(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
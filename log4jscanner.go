@@ -16,29 +16,416 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
+	"log4jscanner/depgraph"
+	"log4jscanner/hostinfo"
+	"log4jscanner/ignore"
 	"log4jscanner/jar"
+	"log4jscanner/locations"
+	"log4jscanner/logging"
+	"log4jscanner/maven"
+	"log4jscanner/netfs"
+	"log4jscanner/readonly"
+	"log4jscanner/results"
+	"log4jscanner/sbom"
+	"log4jscanner/store"
+	"log4jscanner/suppress"
+	"log4jscanner/throttle"
 )
 
 func usage() {
 	fmt.Fprint(os.Stderr, `Usage: log4jscanner [flag] [directories]
+       log4jscanner [command] [flag]
 
 A log4j vulnerability scanner. The scanner walks the provided directories
 attempting to find vulnerable JARs. Paths of vulnerable JARs are printed
 to stdout.
 
+If a directory is "-", a single archive is read from stdin and "-" is printed
+if it's vulnerable.
+
+Commands:
+
+    annotate       Track the owner and status of paths recorded by --store.
+    audit          Verify an audit log written by --audit-log.
+    bench          Measure scan throughput and allocations on a corpus.
+    canary         Write a benign archive that's reported as vulnerable.
+    carve          Find JARs and log4j classes in raw disk images.
+    explain        Print the rules and evidence behind a single scan result.
+    extract        Extract a JAR nested within an archive for offline analysis.
+    coordinator    Serve a queue of archives to scan to remote workers.
+    prune          Remove old runs from a --store database.
+    query          List vulnerable paths recorded by --store.
+    remote         Scan remote hosts over SSH, without installing the scanner.
+    report         Merge the findings of many hosts into a report per JAR.
+    rpc            Serve JSON-RPC requests on stdin for other languages.
+    rules test     Measure the precision and recall of the rules on a
+                   labeled corpus.
+    self-update    Replace this binary with the latest signed release.
+    serve          Run a multi-tenant HTTP service that scans uploads.
+    snapshot       Scan AWS EBS or GCP Persistent Disk snapshots.
+    verify         Re-scan the vulnerable JARs of a previous scan's findings.
+    watch          Rescan archives as they change (Linux only).
+    worker         Scan archives leased from a coordinator.
+
 Flags:
 
     -s, --skip     Glob pattern to skip when scanning (e.g. '/var/run/*'). May
                    be provided multiple times.
-    -w, --rewrite  Rewrite vulnerable JARs as they are detected.
-    -v, --verbose  Print verbose logs to stderr.
+    -i, --ignore   Exclude paths matching a gitignore style pattern (e.g.
+                   'backups/', '*.bak.jar', '!keep.jar'). May be provided
+                   multiple times.
+    --ignore-file  Read gitignore style exclusion patterns from a file.
+    --suppress     Read rules muting accepted findings from a file, which
+                   match JARs by path ("path /opt/legacy/**") or SHA-256
+                   ("sha256 HASH"), followed by the reason. Suppressed
+                   findings aren't reported or counted by --fail-on, but are
+                   counted apart by --summary-json and logged with -v. May be
+                   provided multiple times. Can't be used with --rewrite.
+    -w, --rewrite  Rewrite vulnerable JARs as they are detected. Each JAR
+                   is rewritten to a temporary file next to it, which is
+                   checked to be readable and no longer vulnerable before
+                   it atomically replaces the JAR.
+    --rewrite-signed
+                   With --rewrite, what to do with signed JARs, whose
+                   signature rewriting invalidates: strip removes their
+                   signature files, leaving them unsigned, with a warning
+                   (default), and skip leaves them unchanged and reports
+                   them as errors. Findings note signed JARs either way.
+    --backup       With --rewrite, keep the original of each rewritten JAR
+                   next to it with a .bak suffix.
+    --quarantine-dir
+                   With --rewrite, keep the original of each rewritten JAR
+                   in the given directory instead, under its absolute path
+                   (e.g. /opt/app/a.jar as DIR/opt/app/a.jar). The
+                   directory is never scanned.
+    --rollback     Restore the originals kept by --backup or
+                   --quarantine-dir of the JARs rewritten and the classes
+                   removed within the directories, instead of scanning, and
+                   print their paths. JARs removed since they were
+                   rewritten aren't restored.
+    --assert-read-only
+                   Guarantee the scan doesn't write to disk. Flags that write
+                   (--rewrite, --audit-log, --store, --dir-cache,
+                   --file-cache) are rejected, and nested archives or stdin
+                   larger than the memory limits are reported as errors
+                   rather than spilled to temporary files.
+    --follow-class-path
+                   Also scan JARs referenced by a JAR's manifest Class-Path,
+                   even if they're outside the scanned directories.
+    --follow-symlinks
+                   Scan the archives and walk the directories that symlinks
+                   point to, under the symlink's path. Each symlinked
+                   directory is walked once, so cycles are broken. By default
+                   symlinks are skipped.
+    --ext          Also scan files with the given extension (e.g. .par) as
+                   archives. May be repeated.
+    --exclude-ext  Never scan files with the given extension (e.g. .zip),
+                   even archive extensions. May be repeated.
+    --sniff        Only parse the files to scan that start with a ZIP
+                   signature or a launch script, skipping files merely named
+                   like archives.
+    --all-files    Scan files regardless of their extension, to find renamed
+                   archives. Best combined with --sniff.
+    --exploded     Also scan exploded archives, directories holding WEB-INF,
+                   META-INF, or log4j's org/apache/logging/log4j package,
+                   such as WARs unpacked by Tomcat or WebLogic. Their loose
+                   class files are checked like a JAR's, and findings are
+                   reported under the directory's path. With
+                   --follow-class-path, Class-Path directories are also
+                   scanned. --rewrite removes the JndiLookup classes of
+                   vulnerable exploded archives.
+    --one-file-system
+                   Don't descend into directories on other filesystems than
+                   the scanned directory they're in, such as mounts of /proc
+                   or network shares when scanning /. Linux only.
+    --newest-first Scan the most recently modified archives of each scanned
+                   directory first, after listing them, so active
+                   deployments are found before old backups.
+    --audit-log    Append every rewrite to a tamper-evident audit log at the
+                   given path.
+    --store        Record the run, its findings, and skipped paths in a
+                   SQLite database at the given path (e.g. results.db).
+    --retain       Remove runs older than the given age (e.g. 90d) from
+                   --store once the scan completes, compacting the database
+                   when a quarter of it is free. See also "prune".
+    --dir-cache    Cache the results of each directory in a SQLite database at
+                   the given path, and skip directories whose entries haven't
+                   changed since the last scan. May be the same path as
+                   --store. Ignored with --follow-class-path,
+                   --follow-symlinks, --exploded, and --newest-first.
+    --file-cache   Cache the report of each archive in a SQLite database at
+                   the given path, and don't parse archives whose size and
+                   modification time haven't changed since the last scan.
+                   Unlike --dir-cache, a changed archive only causes that
+                   archive to be parsed again, and it works with every other
+                   flag. May be the same path as --store and --dir-cache.
+
+                   SQLite requires cgo, so --store, --dir-cache,
+                   --file-cache, and the annotate, prune, and query commands
+                   are rejected by binaries built without it, such as those
+                   cross-compiled with CGO_ENABLED=0.
+    --format       Output format of findings. One of text, json (one object
+                   per line), csv, or sarif (a SARIF 2.1.0 log written once
+                   the scan completes, for code scanning dashboards)
+                   (default text).
+    --slash-paths  Separate the elements of reported paths with forward
+                   slashes on every platform, such as C:/app/lib/a.jar.
+    --absolute-paths
+                   Report absolute paths, even if the scanned directories
+                   are relative.
+    --relative-paths
+                   Report paths relative to the scanned directory holding
+                   them, such as lib/a.jar when scanning /opt/app.
+    --hash-paths   Report the hex HMAC-SHA256 of each normalized path, keyed
+                   by the contents of the given file, instead of the path.
+                   Hosts scanned with the same key report the same paths
+                   under the same hash.
+    --syslog       Also send findings to syslog. Either "local" or a URL such
+                   as udp://host:514.
+    --webhook      Also POST findings as JSON to the given URL.
+    --webhook-header
+                   Header to send with --webhook requests (e.g.
+                   "Authorization: Bearer TOKEN"). May be provided multiple
+                   times.
+`+clientTLSUsage+`    --host-metadata
+                   Annotate findings in json, csv, syslog, and webhook output
+                   with the host's FQDN and, on AWS, GCP, or Azure, its
+                   instance and image IDs.
+    --tag          Annotate findings with a key=value tag (e.g.
+                   team=payments), to route results to the host's owners.
+                   May be provided multiple times.
+    --email        Email a summary of the scan as configured by the given JSON
+                   file. See the email package for the format.
+    --profile      Also scan the deployment, extraction, and shared library
+                   directories of an application server. One of tomcat,
+                   jetty, weblogic, or websphere. May be provided multiple
+                   times.
+    --jboss        Treat the directories as JBoss/WildFly module trees, and
+                   report the module (name:slot) of each vulnerable resource
+                   root described by a modules/**/module.xml file.
+    --maven        Treat the directories as Maven local repositories or Gradle
+                   caches, and report the Maven coordinates
+                   (groupId:artifactId:version) of vulnerable JARs. JARs
+                   under .m2/repository or modules-2/files-2.1 are
+                   recognized wherever they're found.
+    --projects     Find the pom.xml, build.gradle, and build.gradle.kts files
+                   under the given directory, and report which of them
+                   declare each vulnerable artifact. Implies --maven. May be
+                   provided multiple times.
+    --processes    On Linux, also scan the archives loaded by running JVMs,
+                   found through /proc, including files that were deleted or
+                   replaced on disk since. Directories are optional with
+                   --processes. Reading other users' processes requires root.
+    --image        Also scan the filesystem of a container image, saved by
+                   "docker save" or in an OCI image layout, with its layers
+                   merged and the files deleted by upper layers left out.
+                   Findings are reported under the image's path, such as
+                   app.tar/opt/app/lib/log4j-core.jar. Images can't be
+                   rewritten. May be provided multiple times.
+    --wsl          On Windows, also scan the root filesystem of every WSL
+                   distribution installed for the current user.
+    --windows-apps On Windows, also scan the install directories and
+                   classpaths of registered Java applications: services
+                   running java.exe or a service wrapper, Procrun services
+                   such as Tomcat, installed JREs and JDKs, and installed
+                   programs that bundle Java.
+    --windows-drives
+                   Inside WSL, also scan the Windows drives mounted under
+                   /mnt, which are skipped by default since a scan on Windows
+                   already covers them.
+    --group-by-app Print findings once the scan completes, grouped by the
+                   application they're deployed in: the outermost exploded
+                   WAR or EAR, WAR or EAR archive, or --app-root directory.
+    --app-root     Glob pattern of directories to treat as application roots
+                   with --group-by-app (e.g. '/srv/apps/*'). May be provided
+                   multiple times.
+    --unusual-dir  Glob pattern of directories, such as an application's upload
+                   directory, where vulnerable JARs are reported with
+                   elevated priority. JARs in temp, upload, and home
+                   directories always are. May be provided multiple times.
+    --osgi         Report the OSGi Bundle-SymbolicName and Bundle-Version of
+                   each vulnerable JAR.
+    --hash         Include the SHA-256 of each vulnerable JAR found by
+                   walking in json, csv, syslog, and --webhook output. Files
+                   are hashed while they're scanned rather than read twice.
+                   Disables --dir-cache.
+    --estimate     Only enumerate candidate archives, including those selected
+                   by --ext and --all-files, and print their total size and
+                   the expected duration of a full scan.
+    --throughput   Scan rate in MiB/s used by --estimate (default 50).
+    --enable-rule  Only evaluate the detection rule with the given ID (e.g.
+                   LOG4J-44228-CONSTRUCTOR). May be provided multiple times.
+    --disable-rule Don't evaluate the detection rule with the given ID (e.g.
+                   LOG4J-216-HEURISTIC). May be provided multiple times.
+    --cve          Only evaluate the rules detecting the given CVE, one of
+                   CVE-2021-44228, CVE-2021-45046, or CVE-2021-44832. May be
+                   provided multiple times. CVE-2021-44832 is only detected
+                   if selected.
+    --log4j1       Also detect components of log4j 1.x with vulnerabilities
+                   that won't be fixed, such as JMSAppender
+                   (CVE-2021-4104). Their rules are listed under "log4j1" in
+                   JSON findings.
+    --custom-rules File of custom rules to evaluate alongside the built-in
+                   rules, in the subset of YARA described in the README.
+                   Must precede --enable-rule, --disable-rule, and --cve
+                   flags referencing them.
+    --vulndb       Vulnerability database to evaluate alongside the built-in
+                   rules, a JSON file of Maven coordinates with affected
+                   version ranges and class fingerprints described in the
+                   README. Must precede the flags referencing its rules.
+    --spill-threshold
+                   Memory used for archives nested in a JAR, or read from
+                   stdin (e.g. 512MiB). Larger archives are decompressed to
+                   a temporary file and scanned from disk (default 4GiB).
+    --temp-dir     Directory of temporary files (default the system's).
+    --workers      Number of JARs to scan concurrently (default 1), or "auto"
+                   to adapt the number to the latency of storage and the
+                   files waiting to be scanned, between --min-workers and
+                   --max-workers. Findings are still reported in the order
+                   they're found by the walk. --dir-cache is ignored with
+                   more than one worker.
+    --min-workers  Fewest workers with --workers auto (default 1).
+    --max-workers  Most workers with --workers auto (default 4 per CPU).
+    --memory-budget
+                   Bytes of nested archives held in memory across all
+                   workers (default 4GiB). Nested archives that don't fit
+                   are decompressed to a temporary file instead.
+    --max-ratio    Report archives holding an entry over 1MiB that
+                   decompresses to more than the given times its compressed
+                   size as suspected zip bombs, without scanning them
+                   further (default 100, 0 to disable).
+    --max-decompressed
+                   Report archives that decompress to more than the given
+                   size in total, nested archives included, as suspected zip
+                   bombs (default 64GiB, 0 to disable).
+    --best-effort  Skip the entries of an archive that can't be read, such
+                   as corrupt or too deeply nested ones, with a warning, and
+                   scan the rest of it. By default the archive is reported
+                   as an error.
+    --salvage      Scan what can be recovered of corrupt archives, such as
+                   truncated ones or those whose central directory is partly
+                   overwritten, from the readable records of the central
+                   directory or the entries' local headers. Entries that
+                   can't be recovered are skipped with a warning. Implies
+                   --best-effort.
+    --archive-timeout
+                   Give up on an archive, including the archives nested in
+                   it, once scanning it took the given duration, such as
+                   5m. The archive is reported as an error and the scan goes
+                   on. By default archives are scanned however long it takes.
+    --zip-password-file
+                   Read passwords, one per line, to decrypt ZipCrypto or AES
+                   encrypted archives. Each password is tried in turn. May be
+                   provided multiple times.
+    --fail-on      Exit with status 3 if any vulnerable JAR is left with at
+                   least the given severity: critical, high, medium, low, or
+                   none to never fail (default none), or with one of the
+                   given CVEs (e.g. CVE-2021-44228). "errors" exits with
+                   status 4 if archives couldn't be scanned and no finding
+                   failed the scan. Takes a comma separated list, and may be
+                   provided multiple times. With --rewrite, only JARs that
+                   couldn't be rewritten count.
+    --net-timeout  Time out operations on NFS, SMB, and other network
+                   filesystems after the given duration (default 30s), or 0
+                   to wait forever. Timeouts are retried, and a mount that
+                   keeps timing out is skipped for the rest of the scan.
+    --net-retries  Times to retry an operation on a network filesystem that
+                   timed out or failed with a transient error (default 2).
+    --max-findings Stop scanning once the given number of vulnerable JARs
+                   were found. Results are incomplete, for gatekeeping
+                   checks that only need to know whether to block.
+    --abort-on-first-critical
+                   Stop scanning once a vulnerable JAR of critical severity
+                   is found, and exit with status 3.
+    --detail-severity
+                   Only output the details of findings with at least the
+                   given severity (e.g. high), and aggregate counts of the
+                   others. Counts are written to stderr, and to json and
+                   --webhook output. --store and --email still record every
+                   finding.
+    --sort         Hold findings until the scan completes, then output them
+                   sorted by path, so the output of runs can be diffed.
+    --baseline     Compare findings against those of a previous scan written
+                   by --format json, labeling each as new or persisting, and
+                   reporting the JARs under the scanned directories that are
+                   no longer vulnerable as fixed once the scan completes.
+    --summary-json Write a line of JSON to stderr when the scan exits, with
+                   the exit code and reason, counts of findings, errors, and
+                   skipped paths, and whether the scan was complete,
+                   whatever the --format.
+    --progress     Log the progress of the scan to stderr every 5 seconds:
+                   the files and directories walked, archives and bytes
+                   scanned, findings, and errors so far.
+    `+logFormatHelp+`
+    --pprof        Serve runtime profiles on the given address, such as
+                   localhost:6060, while scanning.
+    --max-cpu-percent
+                   Limit the scan to a percentage of a single CPU (e.g. 25),
+                   to yield to production workloads.
+    --max-bytes-per-second
+                   Limit the rate archives are read at (e.g. 20MiB), nested
+                   archives spilled to disk included, to spare the storage
+                   of production hosts. Bursts of up to a second's worth are
+                   allowed after a pause.
+    --max-files-per-second
+                   Limit the rate archives are opened at (e.g. 50).
+    --low-priority On Linux, scan with the idle I/O scheduling class and the
+                   lowest CPU priority, like ionice -c3 nice -n19, so other
+                   processes' disk and CPU use comes first.
+    --class-path-graph
+                   Build a dependency graph of the scanned JARs from their
+                   manifests' Class-Path and jar indexes (INDEX.LIST), and
+                   write the entry points that transitively reference a
+                   vulnerable JAR to the given path, or stdout if "-".
+                   Disables --dir-cache.
+    --sbom         Write a software bill of materials of every Java component
+                   found to the given path, or stdout if "-": the scanned
+                   JARs and the libraries nested or shaded in them,
+                   identified by their Maven metadata or manifest, with
+                   their hashes and locations. Every JAR is then read in
+                   full. Disables --dir-cache.
+    --sbom-format  Format of --sbom: cyclonedx (default) or spdx.
+    --plan         Write a remediation plan of the vulnerable JARs to the
+                   given path, or stdout if "-", as JSON: batches of JARs
+                   to rewrite, to replace with a fixed version, or whose
+                   owner must act as they're signed, most severe first.
+    --bridges      Log every JAR bundling a log4j bridge or adapter, such as
+                   log4j-to-slf4j or log4j-slf4j-impl, with how it changes
+                   remediation, whether or not the JAR is vulnerable.
+                   Findings list their bridges regardless. Disables
+                   --dir-cache.
+    --coverage-report
+                   Write a CSV report of the scan's scope to the given path:
+                   every root and mount considered, each directory walked,
+                   and paths that were skipped and why. Combine with
+                   --estimate for a dry run.
+    -v, --verbose  Print verbose logs to stderr, including the nesting depth,
+                   nested archives, decompressed bytes, and time of every
+                   scanned JAR, which are also added to JSON findings.
+
+`+pauseHelp+`
+
+Exit status:
+
+    0  The scan completed, and nothing failed it.
+    1  The scan couldn't run, such as an unreadable configuration file.
+    2  The flags or arguments are invalid.
+    3  A vulnerable JAR matched --fail-on, or --abort-on-first-critical
+       found a critical one.
+    4  Archives couldn't be scanned or a network filesystem stalled, with
+       --fail-on errors, and no vulnerable JAR failed the scan.
 
 `)
 }
@@ -51,13 +438,286 @@ var skipDirs = map[string]bool{
 	// TODO(ericchiang): expand
 }
 
+// commands holds subcommands, keyed by the first argument.
+var commands = map[string]func(args []string){
+	"annotate":    annotateCmd,
+	"audit":       auditCmd,
+	"bench":       bench,
+	"canary":      canaryCmd,
+	"carve":       carveCmd,
+	"coordinator": coordinator,
+	"explain":     explain,
+	"extract":     extractCmd,
+	"prune":       pruneCmd,
+	"query":       query,
+	"remote":      remoteCmd,
+	"report":      reportCmd,
+	"rpc":         rpcCmd,
+	"rules":       rulesCmd,
+	"self-update": selfUpdate,
+	"serve":       serve,
+	"snapshot":    snapshotCmd,
+	"verify":      verifyCmd,
+	"watch":       watch,
+	"worker":      worker,
+}
+
+// newSkipDir returns a function for jar.Walker's SkipDir which skips paths
+// excluded by the ignore patterns, directories matching the glob patterns in
+// toSkip, well known directories that never hold JARs, and magic filesystems.
+// If skipped is non-nil, it's called with the reason for every skipped path.
+//
+// Files the walk would open as archives, as selected by detect, are skipped
+// if they're sparse without data at their end, as checked by sparseTail.
+//
+// Checks of paths within network mounts are timed out, and the paths of
+// mounts that stalled are skipped. mounts may be nil.
+func newSkipDir(toSkip []string, ignored *ignore.Matcher, mounts *netfs.Mounts, detect *jar.Detect, logf func(format string, v ...interface{}), skipped func(path, reason string)) func(path string, d fs.DirEntry) bool {
+	seen := 0
+	skip := func(path, reason string) bool {
+		if skipped != nil {
+			skipped(path, reason)
+		}
+		return true
+	}
+	return func(path string, d fs.DirEntry) bool {
+		seen++
+		if seen%5000 == 0 {
+			logf("Scanned %d files", seen)
+		}
+		if ignored.SkipDir(path, d) {
+			return skip(path, "ignore pattern")
+		}
+		if mounts.Stalled(path) {
+			return skip(path, "stalled network filesystem")
+		}
+		if !d.IsDir() {
+			if kind := specialFile(d.Type()); kind != "" {
+				return skip(path, "special file: "+kind)
+			}
+			if detect.Candidate(path) && !inImage(path) {
+				v, _ := mounts.Do(path, func() (interface{}, error) { return sparseTail(path, d), nil })
+				if sparse, _ := v.(bool); sparse {
+					return skip(path, "sparse file without data at its end")
+				}
+			}
+			return false
+		}
+		for _, pattern := range toSkip {
+			if ok, err := filepath.Match(pattern, path); err == nil && ok {
+				return skip(path, "skip pattern "+pattern)
+			}
+		}
+		if skipDirs[filepath.Base(path)] {
+			return skip(path, "well known directory")
+		}
+		if inImage(path) {
+			return false
+		}
+		v, err := mounts.Do(path, func() (interface{}, error) { return ignoreDir(path) })
+		if err != nil {
+			log.Printf("Error scanning %s: %v", path, err)
+		}
+		if ignore, _ := v.(bool); ignore {
+			return skip(path, "special filesystem")
+		}
+		return false
+	}
+}
+
+// specialFile returns the kind of a special file, such as "named pipe", or ""
+// for regular files, directories, and symlinks. Special files can never be
+// archives, and reading some, like FIFOs, blocks.
+func specialFile(m fs.FileMode) string {
+	switch {
+	case m&fs.ModeNamedPipe != 0:
+		return "named pipe"
+	case m&fs.ModeSocket != 0:
+		return "socket"
+	case m&fs.ModeDevice != 0:
+		return "device"
+	case m&fs.ModeIrregular != 0:
+		return "irregular file"
+	}
+	return ""
+}
+
+// dotExt returns an extension given to --ext or --exclude-ext with its
+// leading dot, so "par" and ".par" are the same.
+func dotExt(ext string) string {
+	if strings.HasPrefix(ext, ".") {
+		return ext
+	}
+	return "." + ext
+}
+
+// uniqueDirs returns dirs without the directories listed more than once,
+// such as by a profile and on the command line, keeping the first. Paths only
+// differing by case are the same directory on macOS and Windows, see
+// jar.PathKey.
+func uniqueDirs(dirs []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, dir := range dirs {
+		key := dir
+		if dir != "-" {
+			key = jar.PathKey(dir)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, dir)
+	}
+	return unique
+}
+
+// skipOtherDevices wraps skipDir to also skip directories on other devices
+// than the scanned directory they're in, for --one-file-system. The scanned
+// directories themselves are always walked.
+func skipOtherDevices(dirs []string, mounts *netfs.Mounts, skipDir func(path string, d fs.DirEntry) bool, skipped func(path, reason string)) func(path string, d fs.DirEntry) bool {
+	type root struct {
+		path string
+		dev  uint64
+	}
+	var roots []root
+	for _, dir := range dirs {
+		if dir == "-" {
+			continue
+		}
+		dev, err := deviceID(dir)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			continue
+		}
+		roots = append(roots, root{filepath.Clean(dir), dev})
+	}
+	// device returns the device of the scanned directory holding path,
+	// preferring the most specific one.
+	device := func(path string) (uint64, bool) {
+		best := -1
+		for i, r := range roots {
+			if path != r.path && !strings.HasPrefix(path, strings.TrimSuffix(r.path, string(filepath.Separator))+string(filepath.Separator)) {
+				continue
+			}
+			if best < 0 || len(r.path) > len(roots[best].path) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		return roots[best].dev, true
+	}
+	return func(path string, d fs.DirEntry) bool {
+		if skipDir(path, d) {
+			return true
+		}
+		if !d.IsDir() {
+			return false
+		}
+		want, ok := device(path)
+		if !ok {
+			return false
+		}
+		v, err := mounts.Do(path, func() (interface{}, error) { return deviceID(path) })
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return false
+		}
+		if dev, _ := v.(uint64); dev != want {
+			if skipped != nil {
+				skipped(path, "other filesystem")
+			}
+			return true
+		}
+		return false
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	var (
-		rewrite bool
-		w       bool
-		verbose bool
-		v       bool
-		toSkip  []string
+		rewrite       bool
+		backupOn      bool
+		rewriteSigned = "strip"
+		quarantineDir string
+		rollbackOn    bool
+		w             bool
+		verbose       bool
+		v             bool
+		toSkip        []string
+		auditLog      string
+		storePath     string
+		cachePath     string
+		fileCachePath string
+		retain        time.Duration
+		emailPath     string
+		format        string
+		syslogAddr    string
+		webhook       webhookFlags
+		hostMeta      bool
+		tags          map[string]string
+		estimateOn    bool
+		throughput    float64
+		followCP      bool
+		newestFirst   bool
+		followLinks   bool
+		exploded      bool
+		suppressions  *suppress.List
+		detect        jar.Detect
+		oneFS         bool
+		jbossOn       bool
+		mavenOn       bool
+		projectDirs   []string
+		procOn        bool
+		osgi          bool
+		imagePaths    []string
+		wslOn         bool
+		winAppsOn     bool
+		groupByApp    bool
+		appRoots      []string
+		winDrives     bool
+		maxCPU        float64
+		maxBytesRate  int64
+		maxFilesRate  float64
+		lowPriority   bool
+		failOn        failPolicy
+		netTimeout    = netfs.DefaultTimeout
+		netRetries    = netfs.DefaultRetries
+		maxFindings   int
+		abortCritical bool
+		detailSev     jar.Severity
+		sortOutput    bool
+		baselinePath  string
+		hashOn        bool
+		pprofAddr     string
+		readOnly      bool
+		coveragePath  string
+		graphPath     string
+		showBridges   bool
+		sbomPath      string
+		sbomFormat    = sbom.CycloneDX
+		planPath      string
+		summaryOn     bool
+		progressOn    bool
+		logFormat     string
+		pathFmt       = &results.PathFormat{}
+		workers       = 1
+		autoWorkers   bool
+		minWorkers    int
+		maxWorkers    int
+		memBudget     = int64(4 << 30)
+		unusual       = &locations.Classifier{}
+		profiles      []string
+		profDirs      []string
+		ignored       = &ignore.Matcher{}
 	)
 	appendSkip := func(dir string) error {
 		toSkip = append(toSkip, dir)
@@ -66,16 +726,246 @@ func main() {
 
 	flag.BoolVar(&rewrite, "rewrite", false, "")
 	flag.BoolVar(&w, "w", false, "")
+	flag.BoolVar(&backupOn, "backup", false, "")
+	flag.StringVar(&rewriteSigned, "rewrite-signed", rewriteSigned, "")
+	flag.StringVar(&quarantineDir, "quarantine-dir", "", "")
+	flag.BoolVar(&rollbackOn, "rollback", false, "")
+	flag.StringVar(&auditLog, "audit-log", "", "")
+	flag.StringVar(&storePath, "store", "", "")
+	flag.StringVar(&cachePath, "dir-cache", "", "")
+	flag.StringVar(&fileCachePath, "file-cache", "", "")
+	flag.Func("retain", "", func(s string) (err error) {
+		retain, err = store.ParseAge(s)
+		return err
+	})
+	flag.StringVar(&emailPath, "email", "", "")
+	flag.StringVar(&format, "format", "text", "")
+	flag.StringVar(&syslogAddr, "syslog", "", "")
+	webhook.register(flag.CommandLine)
+	flag.BoolVar(&hostMeta, "host-metadata", false, "")
+	flag.Func("tag", "", func(t string) error {
+		k, v, err := hostinfo.ParseTag(t)
+		if err != nil {
+			return err
+		}
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		tags[k] = v
+		return nil
+	})
+	flag.BoolVar(&readOnly, "assert-read-only", false, "")
+	flag.StringVar(&coveragePath, "coverage-report", "", "")
+	flag.StringVar(&graphPath, "class-path-graph", "", "")
+	flag.BoolVar(&showBridges, "bridges", false, "")
+	flag.StringVar(&sbomPath, "sbom", "", "")
+	flag.StringVar(&sbomFormat, "sbom-format", sbom.CycloneDX, "")
+	flag.StringVar(&planPath, "plan", "", "")
+	flag.BoolVar(&summaryOn, "summary-json", false, "")
+	flag.BoolVar(&progressOn, "progress", false, "")
+	logFormatFlag(flag.CommandLine, &logFormat)
+	flag.BoolVar(&pathFmt.Slash, "slash-paths", false, "")
+	flag.BoolVar(&pathFmt.Absolute, "absolute-paths", false, "")
+	flag.BoolVar(&pathFmt.Relative, "relative-paths", false, "")
+	flag.Func("hash-paths", "", func(path string) (err error) {
+		pathFmt.HashKey, err = os.ReadFile(path)
+		if err == nil && len(pathFmt.HashKey) == 0 {
+			err = fmt.Errorf("%s is empty", path)
+		}
+		return err
+	})
+	flag.Func("unusual-dir", "", func(pattern string) error {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return err
+		}
+		unusual.Dirs = append(unusual.Dirs, pattern)
+		return nil
+	})
+	flag.BoolVar(&followCP, "follow-class-path", false, "")
+	flag.BoolVar(&newestFirst, "newest-first", false, "")
+	flag.BoolVar(&followLinks, "follow-symlinks", false, "")
+	flag.BoolVar(&exploded, "exploded", false, "")
+	flag.Func("ext", "", func(ext string) error {
+		detect.Extensions = append(detect.Extensions, dotExt(ext))
+		return nil
+	})
+	flag.Func("exclude-ext", "", func(ext string) error {
+		detect.Exclude = append(detect.Exclude, dotExt(ext))
+		return nil
+	})
+	flag.BoolVar(&detect.Sniff, "sniff", false, "")
+	flag.BoolVar(&detect.All, "all-files", false, "")
+	flag.BoolVar(&oneFS, "one-file-system", false, "")
+	flag.Func("profile", "", func(name string) error {
+		d, err := profileDirs(name)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, name)
+		profDirs = append(profDirs, d...)
+		return nil
+	})
+	flag.BoolVar(&jbossOn, "jboss", false, "")
+	flag.BoolVar(&mavenOn, "maven", false, "")
+	flag.Func("projects", "", func(dir string) error {
+		projectDirs = append(projectDirs, dir)
+		return nil
+	})
+	flag.BoolVar(&procOn, "processes", false, "")
+	flag.BoolVar(&osgi, "osgi", false, "")
+	flag.Func("image", "", func(p string) error {
+		imagePaths = append(imagePaths, p)
+		return nil
+	})
+	flag.BoolVar(&wslOn, "wsl", false, "")
+	flag.BoolVar(&winAppsOn, "windows-apps", false, "")
+	flag.BoolVar(&groupByApp, "group-by-app", false, "")
+	flag.Func("app-root", "", func(pattern string) error {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return err
+		}
+		appRoots = append(appRoots, pattern)
+		return nil
+	})
+	flag.BoolVar(&winDrives, "windows-drives", false, "")
+	flag.BoolVar(&estimateOn, "estimate", false, "")
+	flag.Float64Var(&throughput, "throughput", defaultThroughput, "")
+	flag.Float64Var(&maxCPU, "max-cpu-percent", 0, "")
+	flag.Func("max-bytes-per-second", "", func(s string) (err error) {
+		maxBytesRate, err = parseBytes(s)
+		return err
+	})
+	flag.Float64Var(&maxFilesRate, "max-files-per-second", 0, "")
+	flag.BoolVar(&lowPriority, "low-priority", false, "")
+	flag.Func("spill-threshold", "", func(s string) (err error) {
+		scanConfig.SpillThreshold, err = parseBytes(s)
+		return err
+	})
+	flag.StringVar(&scanConfig.SpillDir, "temp-dir", "", "")
+	flag.Func("workers", "", func(s string) (err error) {
+		if s == "auto" {
+			autoWorkers = true
+			return nil
+		}
+		autoWorkers = false
+		workers, err = strconv.Atoi(s)
+		return err
+	})
+	flag.IntVar(&minWorkers, "min-workers", 1, "")
+	flag.IntVar(&maxWorkers, "max-workers", 4*runtime.GOMAXPROCS(0), "")
+	flag.Func("memory-budget", "", func(s string) (err error) {
+		memBudget, err = parseBytes(s)
+		return err
+	})
+	flag.Func("zip-password-file", "", func(path string) error {
+		passwords, err := readPasswords(path)
+		if err != nil {
+			return err
+		}
+		scanConfig.Passwords = append(scanConfig.Passwords, passwords...)
+		return nil
+	})
+	flag.Func("custom-rules", "", registerRules)
+	flag.Func("vulndb", "", registerVulnDB)
+	flag.Func("enable-rule", "", func(id string) error {
+		scanConfig.EnableRules = append(scanConfig.EnableRules, id)
+		return scanConfig.Validate()
+	})
+	flag.Func("disable-rule", "", func(id string) error {
+		scanConfig.DisableRules = append(scanConfig.DisableRules, id)
+		return scanConfig.Validate()
+	})
+	flag.Func("cve", "", func(cve string) error {
+		scanConfig.CVEs = append(scanConfig.CVEs, strings.ToUpper(cve))
+		return scanConfig.Validate()
+	})
+	flag.BoolVar(&scanConfig.Log4j1, "log4j1", false, "")
+	flag.DurationVar(&scanConfig.Timeout, "archive-timeout", 0, "")
+	flag.BoolVar(&scanConfig.BestEffort, "best-effort", false, "")
+	flag.BoolVar(&scanConfig.Salvage, "salvage", false, "")
+	flag.Func("max-ratio", "", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid ratio %q", s)
+		}
+		scanConfig.MaxRatio = n
+		if n == 0 {
+			scanConfig.MaxRatio = -1
+		}
+		return nil
+	})
+	flag.Func("max-decompressed", "", func(s string) error {
+		n, err := parseBytes(s)
+		if err != nil {
+			return err
+		}
+		scanConfig.MaxDecompressedBytes = n
+		if n == 0 {
+			scanConfig.MaxDecompressedBytes = -1
+		}
+		return nil
+	})
+	flag.Func("fail-on", "", failOn.set)
+	flag.DurationVar(&netTimeout, "net-timeout", netTimeout, "")
+	flag.IntVar(&netRetries, "net-retries", netRetries, "")
+	flag.IntVar(&maxFindings, "max-findings", 0, "")
+	flag.BoolVar(&abortCritical, "abort-on-first-critical", false, "")
+	flag.Func("detail-severity", "", func(s string) error {
+		sev, err := jar.ParseSeverity(s)
+		detailSev = sev
+		return err
+	})
+	flag.BoolVar(&sortOutput, "sort", false, "")
+	flag.StringVar(&baselinePath, "baseline", "", "")
+	flag.BoolVar(&hashOn, "hash", false, "")
+	flag.StringVar(&pprofAddr, "pprof", "", "")
 	flag.BoolVar(&verbose, "verbose", false, "")
 	flag.BoolVar(&v, "v", false, "")
 	flag.Func("s", "", appendSkip)
 	flag.Func("skip", "", appendSkip)
+	flag.Func("i", "", func(p string) error { return ignored.Add(p) })
+	flag.Func("ignore", "", func(p string) error { return ignored.Add(p) })
+	flag.Func("ignore-file", "", func(path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		m, err := ignore.Parse(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		ignored.Extend(m)
+		return nil
+	})
+	flag.Func("suppress", "", func(path string) error {
+		l, err := suppress.Load(path)
+		if err != nil {
+			return err
+		}
+		if suppressions == nil {
+			suppressions = l
+		} else {
+			suppressions.Extend(l)
+		}
+		return nil
+	})
 	flag.Usage = usage
 	flag.Parse()
-	dirs := flag.Args()
-	if len(dirs) == 0 {
+	dirs := append(flag.Args(), profDirs...)
+	if wslOn {
+		dirs = append(dirs, wslRoots()...)
+	}
+	if winAppsOn {
+		dirs = append(dirs, winAppRoots(v)...)
+	}
+	dirs = uniqueDirs(dirs)
+	if len(dirs) == 0 && len(profiles) > 0 {
+		log.Fatalf("Error: no directories found on this host for profile %s", strings.Join(profiles, ", "))
+	}
+	if len(dirs) == 0 && !procOn && len(imagePaths) == 0 {
 		usage()
-		os.Exit(1)
+		os.Exit(exitStatusUsage)
 	}
 	if v {
 		verbose = v
@@ -83,57 +973,776 @@ func main() {
 	if w {
 		rewrite = w
 	}
+	if rewrite && len(imagePaths) > 0 {
+		log.Fatalf("Error: --rewrite can't be used with --image, rebuild the image instead")
+	}
+	if rewriteSigned != "strip" && rewriteSigned != "skip" {
+		log.Fatalf("Error: unknown --rewrite-signed %q, expected strip or skip", rewriteSigned)
+	}
+	var backup *jar.Backup
+	switch {
+	case backupOn && quarantineDir != "":
+		log.Fatalf("Error: --backup can't be used with --quarantine-dir")
+	case backupOn:
+		backup = &jar.Backup{Suffix: ".bak"}
+	case quarantineDir != "":
+		backup = &jar.Backup{QuarantineDir: quarantineDir}
+	}
+	if rollbackOn && (rewrite || backup == nil) {
+		log.Fatalf("Error: --rollback requires --backup or --quarantine-dir, and can't be used with --rewrite")
+	}
+	if backup != nil && !rewrite && !rollbackOn {
+		log.Fatalf("Error: --backup and --quarantine-dir require --rewrite or --rollback")
+	}
+	if netTimeout < 0 || netRetries < 0 {
+		log.Fatalf("Error: --net-timeout and --net-retries must not be negative")
+	}
+	if maxFindings < 0 {
+		log.Fatalf("Error: --max-findings must not be negative")
+	}
+	if scanConfig.Timeout < 0 {
+		log.Fatalf("Error: --archive-timeout must not be negative")
+	}
+	if workers < 1 {
+		log.Fatalf("Error: --workers must be at least 1")
+	}
+	if autoWorkers {
+		if minWorkers < 1 || maxWorkers < minWorkers {
+			log.Fatalf("Error: --min-workers must be at least 1 and at most --max-workers")
+		}
+		workers = minWorkers
+	} else {
+		maxWorkers = 0
+	}
+	if memBudget <= 0 {
+		log.Fatalf("Error: --memory-budget must be positive")
+	}
+	scanConfig.MemoryBudget = jar.NewMemoryBudget(memBudget)
+	if pathFmt.Absolute && pathFmt.Relative {
+		log.Fatalf("Error: --absolute-paths can't be used with --relative-paths")
+	}
+	pathFmt.Roots = dirs
+	if followLinks && newestFirst {
+		log.Fatalf("Error: --follow-symlinks can't be used with --newest-first")
+	}
+	if suppressions != nil && rewrite {
+		log.Fatalf("Error: --suppress can't be used with --rewrite")
+	}
+	if suppressions.Hashes() {
+		// Rules matching by SHA-256 need the hashes of the JARs.
+		hashOn = true
+	}
+	if sbomPath != "" {
+		if !validSBOMFormat(sbomFormat) {
+			log.Fatalf("Error: unknown --sbom-format %q, expected one of %s", sbomFormat, strings.Join(sbom.Formats, ", "))
+		}
+		scanConfig.Inventory = true
+	}
+	requireStore(map[string]string{
+		"store":      storePath,
+		"dir-cache":  cachePath,
+		"file-cache": fileCachePath,
+	})
+	if readOnly {
+		if conflicts := writeFlags(rewrite, map[string]string{
+			"audit-log":        auditLog,
+			"store":            storePath,
+			"dir-cache":        cachePath,
+			"file-cache":       fileCachePath,
+			"coverage-report":  coveragePath,
+			"class-path-graph": graphPath,
+			"sbom":             sbomPath,
+			"plan":             planPath,
+			"quarantine-dir":   quarantineDir,
+		}); len(conflicts) > 0 || rollbackOn {
+			if rollbackOn {
+				conflicts = append(conflicts, "--rollback")
+			}
+			log.Fatalf("Error: --assert-read-only can't be used with %s", strings.Join(conflicts, ", "))
+		}
+		readonly.Enable()
+	}
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	setupLogging(logFormat)
 	logf := func(format string, v ...interface{}) {
 		if verbose {
 			log.Printf(format, v...)
 		}
 	}
-	seen := 0
-	walker := jar.Walker{
-		Rewrite: rewrite,
-		SkipDir: func(path string, d fs.DirEntry) bool {
-			seen++
-			if seen%5000 == 0 {
-				logf("Scanned %d files", seen)
-			}
-			if !d.IsDir() {
-				return false
-			}
-			for _, pattern := range toSkip {
-				if ok, err := filepath.Match(pattern, path); err == nil && ok {
-					return true
+	if retain > 0 && storePath == "" {
+		log.Fatalf("Error: --retain requires --store")
+	}
+	if maxCPU < 0 || maxCPU > 100 {
+		log.Fatalf("Error: --max-cpu-percent must be between 0 and 100")
+	}
+	if maxBytesRate < 0 || maxFilesRate < 0 {
+		log.Fatalf("Error: --max-bytes-per-second and --max-files-per-second can't be negative")
+	}
+	if lowPriority {
+		if err := lowerPriority(); err != nil {
+			log.Fatalf("Error: --low-priority: %v", err)
+		}
+	}
+	if pprofAddr != "" {
+		if err := servePprof(pprofAddr); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	th := &throttle.Throttle{
+		MaxPercent:        maxCPU,
+		MaxBytesPerSecond: float64(maxBytesRate),
+		MaxFilesPerSecond: maxFilesRate,
+	}
+	if maxBytesRate > 0 || maxFilesRate > 0 {
+		scanConfig.RateLimit = th
+	}
+	handlePause(th)
+
+	// netMounts times out operations on network filesystems.
+	var netMounts *netfs.Mounts
+	if netTimeout > 0 {
+		found, err := netfs.Detect(dirs)
+		if err != nil {
+			log.Printf("Warning: operations on network filesystems won't time out: %v", err)
+		}
+		netMounts = netfs.NewMounts(found)
+		netMounts.Timeout = netTimeout
+		netMounts.Retries = netRetries
+		netMounts.OnStall = func(m netfs.Mount) {
+			log.Printf("Error: %s filesystem %s stopped responding, skipping the rest of it", m.Kind, m.Path)
+		}
+		for _, m := range found {
+			logf("Timing out operations on %s filesystem %s after %v", m.Kind, m.Path, netTimeout)
+		}
+	}
+
+	var cov *coverage
+	if coveragePath != "" {
+		cov = newCoverage(dirs)
+	}
+	writeCoverage := func() {
+		if cov == nil {
+			return
+		}
+		mounts, err := mountPoints()
+		if err != nil {
+			log.Printf("Warning: coverage report won't list mounts: %v", err)
+		}
+		if err := cov.write(coveragePath, mounts); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
+
+	// newSkip returns the SkipDir of this scan. It's called before every
+	// file, so it also paces the scan.
+	newSkip := func(skipped func(path, reason string)) func(path string, d fs.DirEntry) bool {
+		if cov != nil {
+			next := skipped
+			skipped = func(path, reason string) {
+				cov.skipped(path, reason)
+				if next != nil {
+					next(path, reason)
 				}
 			}
-			if skipDirs[filepath.Base(path)] {
-				return true
+		}
+		skipDir := newSkipDir(toSkip, ignored, netMounts, &detect, logf, skipped)
+		if !winDrives {
+			skipDir = skipWindowsDrives(dirs, skipDir, skipped)
+		}
+		if oneFS {
+			skipDir = skipOtherDevices(dirs, netMounts, skipDir, skipped)
+		}
+		if quarantineDir != "" {
+			skipDir = skipQuarantine(quarantineDir, skipDir, skipped)
+		}
+		if cov != nil {
+			skipDir = cov.wrap(skipDir)
+		}
+		return func(path string, d fs.DirEntry) bool {
+			th.Wait()
+			return skipDir(path, d)
+		}
+	}
+	if estimateOn {
+		if throughput <= 0 {
+			log.Fatalf("Error: --throughput must be positive")
+		}
+		estimate(dirs, newSkip(nil), &detect, throughput)
+		writeCoverage()
+		return
+	}
+
+	// exitCode is set by --fail-on. Exiting is deferred until every other
+	// deferred call has flushed its output.
+	exitCode := 0
+	exitReason := exitSuccess
+	counter := newSummaryCounter()
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	var a *auditor
+	if auditLog != "" {
+		var err error
+		if a, err = newAuditor(auditLog); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer a.close()
+	}
+	if rollbackOn {
+		rollback(dirs, backup, a, logf)
+		return
+	}
+
+	var (
+		sinks   []results.Sink
+		rec     *recorder
+		skipped func(path, reason string)
+		mailer  *emailSink
+	)
+	if storePath != "" {
+		var err error
+		if rec, err = newRecorder(storePath, dirs); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		rec.retain = retain
+		sinks = append(sinks, rec)
+		skipped = rec.skipped
+	}
+	if summaryOn {
+		next := skipped
+		skipped = func(path, reason string) {
+			counter.skippedPath()
+			if next != nil {
+				next(path, reason)
+			}
+		}
+	}
+	if emailPath != "" {
+		var err error
+		if mailer, err = newEmailSink(emailPath, dirs); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		sinks = append(sinks, mailer)
+	}
+	if planPath != "" {
+		p, err := newPlanSink(planPath)
+		if err != nil {
+			log.Fatalf("Error: --plan: %v", err)
+		}
+		sinks = append(sinks, p)
+	}
+	// The store, email summary, and remediation plan record every finding,
+	// the remaining outputs may be sampled by --detail-severity.
+	recorded := len(sinks)
+	if syslogAddr != "" {
+		s, err := results.NewSyslog(syslogAddr, "log4jscanner")
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		sinks = append(sinks, s)
+	}
+	// host enriches every finding, if requested.
+	var host *hostinfo.Host
+	if hostMeta {
+		host = (&hostinfo.Collector{}).Collect(context.Background())
+		logf("Host %s (fqdn %q, cloud %q, instance %q, image %q)",
+			host.Hostname, host.FQDN, host.Cloud, host.InstanceID, host.ImageID)
+	} else if len(tags) > 0 {
+		host = &hostinfo.Host{}
+		host.Hostname, _ = os.Hostname()
+	}
+	if host != nil {
+		host.Tags = tags
+	}
+	if s := webhook.sink(); s != nil {
+		sinks = append(sinks, s)
+	}
+
+	var scope *baselineScope
+	if baselinePath != "" {
+		scope = &baselineScope{pathFmt: pathFmt, dirs: dirs}
+	}
+	handleError := func(path string, err error) {
+		logging.With("path", path, "error", err).Printf("Error: scanning %s: %v", path, err)
+		counter.failed(err)
+		if scope != nil {
+			scope.failedPath(path)
+		}
+		if cov != nil {
+			cov.failed(path, err)
+		}
+		if rec != nil {
+			rec.skipped(path, err.Error())
+		}
+		if mailer != nil {
+			mailer.error()
+		}
+	}
+	var modules jbossModules
+	if jbossOn {
+		modules = findJBossModules(dirs, handleError)
+		logf("Found %d JBoss module resources", len(modules))
+	}
+	var projects mavenProjects
+	if len(projectDirs) > 0 {
+		mavenOn = true
+		projects = findMavenProjects(projectDirs, handleError)
+		logf("Found %d dependencies declared by projects", len(projects))
+	}
+	var jvms jvmArchives
+	if procOn {
+		jvms = findJVMArchives()
+		logf("Found %d archives loaded by running JVMs", len(jvms))
+	}
+	// describe formats a finding for text output, annotating the path with
+	// any requested metadata.
+	describe := func(f results.Finding) string {
+		line := f.Path
+		if f.Baseline != "" {
+			line = fmt.Sprintf("%-10s  %s", f.Baseline, f.Path)
+		}
+		var notes []string
+		if f.Priority != "" {
+			notes = append(notes, f.Priority+" priority, "+f.UnusualLocation)
+		}
+		if f.Module != "" {
+			notes = append(notes, "module "+f.Module)
+		}
+		if f.Coordinates != "" {
+			note := "maven " + f.Coordinates
+			if len(f.Projects) > 0 {
+				note += ", declared in " + strings.Join(f.Projects, ", ")
+			}
+			notes = append(notes, note)
+		}
+		switch {
+		case f.Signed && f.Rewritten:
+			notes = append(notes, "signature removed")
+		case f.Signed:
+			notes = append(notes, "signed")
+		}
+		if f.Salvaged {
+			notes = append(notes, "salvaged")
+		}
+		if f.SpringBoot {
+			// Name the dependency to upgrade, such as
+			// BOOT-INF/lib/log4j-core-2.14.1.jar.
+			note := "spring boot"
+			for _, a := range f.Artifacts {
+				if a.Path != "" {
+					note += " " + a.Path
+				}
 			}
-			ignore, err := ignoreDir(path)
-			if err != nil {
-				log.Printf("Error scanning %s: %v", path, err)
+			notes = append(notes, note)
+		}
+		if osgi && f.BundleSymbolicName != "" {
+			notes = append(notes, "bundle "+f.BundleSymbolicName+" "+f.BundleVersion)
+		}
+		if len(notes) == 0 {
+			return line
+		}
+		return line + " (" + strings.Join(notes, ", ") + ")"
+	}
+	switch {
+	case groupByApp:
+		if format != "text" {
+			log.Fatalf("Error: --group-by-app requires --format text")
+		}
+		if pathFmt.Slash || pathFmt.Absolute || pathFmt.Relative || len(pathFmt.HashKey) > 0 {
+			log.Fatalf("Error: --group-by-app can't be used with --slash-paths, --absolute-paths, --relative-paths, or --hash-paths")
+		}
+		sinks = append(sinks, newAppGroups(os.Stdout, appRoots, describe))
+	case format == "text":
+		out := results.NewText(os.Stdout)
+		out.Format = describe
+		sinks = append(sinks, out)
+	case format == "json":
+		sinks = append(sinks, results.NewJSON(os.Stdout))
+	case format == "csv":
+		sinks = append(sinks, results.NewCSV(os.Stdout))
+	case format == "sarif":
+		sinks = append(sinks, results.NewSARIF(os.Stdout))
+	default:
+		log.Fatalf("Error: unknown --format %q, expected text, json, csv, or sarif", format)
+	}
+	// baseline labels the findings written to stdout against --baseline.
+	var baseline *results.Baseline
+	if scope != nil {
+		previous, err := readFindings(baselinePath)
+		if err != nil {
+			log.Fatalf("Error: --baseline: %v", err)
+		}
+		baseline = results.NewBaseline(sinks[len(sinks)-1], previous, scope.includes)
+		sinks[len(sinks)-1] = baseline
+	}
+	var sampler *results.Sampler
+	if detailSev != jar.SeverityNone {
+		sampler = results.NewSampler(results.Multi(sinks[recorded:]...), detailSev)
+		sinks = append(sinks[:recorded:recorded], sampler)
+	}
+	if sortOutput {
+		sorted := results.Sorted(results.Multi(sinks[recorded:]...))
+		sinks = append(sinks[:recorded:recorded], sorted)
+	}
+	sink := results.Multi(sinks...)
+
+	// emit writes a finding to every output.
+	emit := func(path string, r *jar.Report, rewritten bool) {
+		f := results.FromReport(pathFmt.Format(path), r)
+		f.Rewritten = rewritten
+		f.Host = host
+		if reason := unusual.Classify(path); reason != "" {
+			f.Priority, f.UnusualLocation = results.PriorityElevated, reason
+		}
+		if m := modules.module(path); m != nil {
+			f.Module = m.ID()
+		}
+		if mavenOn {
+			if c, ok := maven.Locate(path, dirs); ok {
+				f.Coordinates = c.String()
+				f.Projects = projects.declaring(c)
 			}
-			return ignore
-		},
-		HandleError: func(path string, err error) {
-			log.Printf("Error: scanning %s: %v", path, err)
-		},
+		}
+		if a := jvms.loaded(path); a != nil {
+			f.PIDs, f.Deleted = a.pids, a.Deleted
+		}
+		if verbose {
+			f.Stats = results.NewStats(r.Stats)
+		}
+		if err := sink.Write(f); err != nil {
+			log.Printf("Error: writing results: %v", err)
+		}
+	}
+
+	// unresolved holds the reports of vulnerable JARs that weren't
+	// rewritten, for --fail-on.
+	unresolved := map[string]*jar.Report{}
+	// stopReason is set once --max-findings or --abort-on-first-critical
+	// ends the scan early.
+	var (
+		findings   int
+		stopReason string
+	)
+	// suppressed reports if a finding is muted by --suppress, counting it
+	// apart from the findings.
+	var nSuppressed int
+	suppressed := func(path string, r *jar.Report) bool {
+		rule, ok := suppressions.Match(path, r.SHA256)
+		if !ok {
+			return false
+		}
+		nSuppressed++
+		counter.suppressedFinding()
+		logf("Suppressed %s by %s", path, rule)
+		return true
+	}
+	found := func(path string, r *jar.Report) {
+		unresolved[path] = r
+		counter.found(r.Severity())
+		findings++
+		switch {
+		case stopReason != "":
+		case abortCritical && r.Severity() >= jar.SeverityCritical:
+			stopReason = "found critical vulnerable JAR " + path
+			exitCode, exitReason = exitStatusFindings, exitCritical
+		case maxFindings > 0 && findings >= maxFindings:
+			stopReason = fmt.Sprintf("found %d vulnerable JARs", findings)
+			exitReason = exitMaxFindings
+		}
+	}
+
+	walker := jar.Walker{
+		Rewrite:         rewrite,
+		Backup:          backup,
+		SkipSigned:      rewriteSigned == "skip",
+		FollowClassPath: followCP,
+		NewestFirst:     newestFirst,
+		FollowSymlinks:  followLinks,
+		Exploded:        exploded,
+		Detect:          &detect,
+		Workers:         workers,
+		MaxWorkers:      maxWorkers,
+		Hash:            hashOn,
+		Config:          scanConfig,
+		SkipDir:         newSkip(skipped),
+		HandleError:     handleError,
 		HandleReport: func(path string, r *jar.Report) {
+			if suppressed(path, r) {
+				return
+			}
+			found(path, r)
 			if !rewrite {
-				fmt.Println(path)
+				emit(path, r, false)
+			} else if a != nil {
+				a.reported(path)
 			}
 		},
 		HandleRewrite: func(path string, r *jar.Report) {
+			if r.Signed {
+				log.Printf("Warning: removed the signature of %s, which is no longer signed", path)
+			}
+			delete(unresolved, path)
+			counter.rewrote()
 			if rewrite {
-				fmt.Println(path)
+				emit(path, r, true)
+			}
+			if a != nil {
+				a.record("rewrite", path)
 			}
 		},
 	}
+	if len(netMounts.Mounts()) > 0 {
+		walker.FS = netMounts.FS
+	}
+
+	if maxFindings > 0 || abortCritical {
+		handleReport := walker.HandleReport
+		walker.HandleReport = func(path string, r *jar.Report) {
+			handleReport(path, r)
+			if stopReason != "" {
+				walker.Stop()
+			}
+		}
+	}
+
+	var graph *depgraph.Graph
+	if graphPath != "" {
+		graph = &depgraph.Graph{}
+		walker.HandleJAR = graph.Add
+	}
+	var components *sbom.Collector
+	if sbomPath != "" {
+		components = &sbom.Collector{}
+		handleJAR := walker.HandleJAR
+		walker.HandleJAR = func(path string, r *jar.Report) {
+			if handleJAR != nil {
+				handleJAR(path, r)
+			}
+			components.Add(path, r)
+		}
+	}
+	if progressOn {
+		walker.HandleProgress = (&progressLogger{last: time.Now()}).handle
+	}
+	if verbose || summaryOn {
+		walker.HandleScanned = func(path string, r *jar.Report) {
+			counter.scannedArchive(r)
+			if verbose {
+				for _, a := range r.Artifacts {
+					if a.Mitigation == "" {
+						continue
+					}
+					p := path
+					if a.Path != "" {
+						p += "!" + a.Path
+					}
+					logf("Mitigated log4j-core %s: %s", p, a.Mitigation)
+				}
+				s := r.Stats
+				logging.With("path", path, "duration", s.Duration.Seconds(), "depth", s.MaxDepth,
+					"nestedArchives", s.NestedArchives, "inPlaceArchives", s.InPlaceArchives,
+					"decompressedBytes", s.DecompressedBytes,
+				).Printf("Scanned %s in %v: depth %d, %d nested archives (%d read in place), %d bytes decompressed",
+					path, s.Duration.Round(time.Millisecond), s.MaxDepth, s.NestedArchives, s.InPlaceArchives,
+					s.DecompressedBytes)
+			}
+		}
+	}
+	if scanConfig.BestEffort || scanConfig.Salvage {
+		handleScanned := walker.HandleScanned
+		walker.HandleScanned = func(path string, r *jar.Report) {
+			if handleScanned != nil {
+				handleScanned(path, r)
+			}
+			if r.Salvaged {
+				logging.With("path", path).Printf("Warning: %s is corrupt, scanned the entries that could be recovered", path)
+			}
+			for i := range r.Errors {
+				e := &r.Errors[i]
+				logging.With("path", path, "entry", e.Path, "error", e.Err).Printf("Warning: %s: skipped %v", path, e)
+			}
+		}
+	}
+	if showBridges {
+		handleJAR := walker.HandleJAR
+		walker.HandleJAR = func(path string, r *jar.Report) {
+			if handleJAR != nil {
+				handleJAR(path, r)
+			}
+			for _, b := range r.Bridges {
+				log.Printf("Bridge: %s bundles %s, %s", path, b, jar.BridgeAdvice(b))
+			}
+		}
+	}
+
+	var cacheStore *store.Store
+	if cachePath != "" {
+		st, err := store.Open(cachePath)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer st.Close()
+		cacheStore = st
+		dc := st.DirCache()
+		walker.Cache = dc
+		defer func() {
+			if err := dc.Flush(); err != nil {
+				log.Printf("Error: %v", err)
+			}
+		}()
+	}
+	if fileCachePath != "" {
+		st := cacheStore
+		if fileCachePath != cachePath {
+			var err error
+			if st, err = store.Open(fileCachePath); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			defer st.Close()
+		}
+		fc := st.FileCache()
+		walker.FileCache = fc
+		defer func() {
+			if err := fc.Flush(); err != nil {
+				log.Printf("Error: %v", err)
+			}
+		}()
+	}
 
 	for _, dir := range dirs {
+		if stopReason != "" {
+			break
+		}
+		if dir == "-" {
+			logf("Scanning stdin")
+			if rewrite {
+				log.Printf("Error: rewriting is not supported for stdin")
+				continue
+			}
+			r, err := scanStream(os.Stdin)
+			if err != nil {
+				handleError(dir, err)
+				continue
+			}
+			counter.scannedArchive(r)
+			if r != nil && r.Vulnerable && !suppressed(dir, r) {
+				emit(dir, r, false)
+				found(dir, r)
+			}
+			continue
+		}
 		logf("Scanning %s", dir)
-		if err := walker.Walk(dir); err != nil {
+		if err := walker.Walk(dir); err != nil && err != jar.ErrStopped {
 			log.Printf("Error: walking %s: %v", dir, err)
 		}
 	}
+
+	for _, path := range imagePaths {
+		if stopReason != "" {
+			break
+		}
+		logf("Scanning image %s", path)
+		if err := scanImage(&walker, path); err != nil {
+			handleError(path, err)
+		}
+	}
+
+	for _, path := range modules.outside(dirs) {
+		if stopReason != "" {
+			break
+		}
+		// Resource roots outside of the scanned directories can't be
+		// rewritten through the walker.
+		logf("Scanning module resource %s", path)
+		r, err := scanFile(path)
+		if err != nil {
+			handleError(path, err)
+			continue
+		}
+		counter.scannedArchive(r)
+		if r != nil && r.Vulnerable && !suppressed(path, r) {
+			emit(path, r, false)
+			found(path, r)
+		}
+	}
+	for _, path := range jvms.outside(dirs) {
+		if stopReason != "" {
+			break
+		}
+		// Archives loaded by JVMs are read through /proc, since the
+		// file on disk may have been replaced, and can't be rewritten.
+		a := jvms.loaded(path)
+		logf("Scanning %s loaded by process %d", a.Path, a.pids[0])
+		r, err := scanFile(a.Open)
+		if err != nil {
+			handleError(path, err)
+			continue
+		}
+		counter.scannedArchive(r)
+		if r != nil && r.Vulnerable && !suppressed(path, r) {
+			emit(path, r, false)
+			found(path, r)
+		}
+	}
+	var stalled []string
+	for _, m := range netMounts.Stalls() {
+		log.Printf("Warning: %s filesystem %s stalled, results are incomplete", m.Kind, m.Path)
+		stalled = append(stalled, m.Path)
+	}
+	if stopReason != "" {
+		log.Printf("Warning: stopped scanning early, results are incomplete: %s", stopReason)
+	}
+	if nSuppressed > 0 {
+		log.Printf("Suppressed %d findings matched by --suppress", nSuppressed)
+	}
+	if scope != nil {
+		scope.done(stopReason == "" && len(stalled) == 0)
+		if stopReason != "" || len(stalled) > 0 {
+			log.Printf("Warning: not reporting fixed findings of --baseline, since the scan was incomplete")
+		}
+	}
+	if err := sink.Close(); err != nil {
+		log.Printf("Error: writing results: %v", err)
+	}
+	if baseline != nil {
+		c := baseline.Counts()
+		log.Printf("Compared with --baseline: %d new, %d persisting, %d fixed", c.New, c.Persisting, c.Fixed)
+	}
+	writeCoverage()
+	if graph != nil {
+		if err := writeGraph(graphPath, graph); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
+	if components != nil {
+		if err := writeSBOM(sbomPath, sbomFormat, components); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
+	if sampler != nil {
+		if c := sampler.Counts(); len(c) > 0 {
+			log.Printf("Omitted details of findings below %s severity: %s", detailSev, c)
+		}
+	}
+
+	if exitCode == 0 {
+		errors := counter.failures() + len(stalled)
+		if code, reason := failOn.exitStatus(unresolved, errors); code != 0 {
+			exitCode, exitReason = code, reason
+		}
+	}
+	if progressOn {
+		logProgress(walker.Stats())
+	}
+	if summaryOn {
+		s := counter.summary(exitCode, exitReason, stopReason == "", len(dirs), len(unresolved), stalled)
+		s.addWalkStats(walker.Stats())
+		if err := s.write(os.Stderr); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
 }
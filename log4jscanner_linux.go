@@ -17,7 +17,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"golang.org/x/sys/unix"
 )
@@ -33,6 +39,35 @@ var toIgnore = map[int64]bool{
 	unix.TRACEFS_MAGIC:      true,
 }
 
+// mountPoints returns the mount points of the host, from /proc/self/mounts.
+func mountPoints() ([]string, error) {
+	b, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("reading mounts: %v", err)
+	}
+	// Whitespace and backslashes in mount points are octal escaped.
+	unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	var mounts []string
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		mounts = append(mounts, unescape.Replace(fields[1]))
+	}
+	return mounts, nil
+}
+
+// deviceID returns the ID of the device holding path, without following
+// symlinks.
+func deviceID(path string) (uint64, error) {
+	var stat unix.Stat_t
+	if err := unix.Lstat(path, &stat); err != nil {
+		return 0, fmt.Errorf("determining device of %s: %v", path, err)
+	}
+	return uint64(stat.Dev), nil
+}
+
 func ignoreDir(path string) (bool, error) {
 	var stat unix.Statfs_t
 	if err := unix.Statfs(path, &stat); err != nil {
@@ -40,3 +75,79 @@ func ignoreDir(path string) (bool, error) {
 	}
 	return toIgnore[stat.Type], nil
 }
+
+// zipTail is the size of the end of a file holding the end of a ZIP
+// archive's central directory: a 22 byte record followed by a comment of up
+// to 64KiB.
+const zipTail = 22 + 65535
+
+// sparseTail reports if a file is sparse and has no data where the end of a
+// ZIP archive's central directory would be, so it can't be an archive.
+// Reading it would only read holes.
+func sparseTail(path string, d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Blocks*512 >= info.Size() {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	start := info.Size() - zipTail
+	if start < 0 {
+		start = 0
+	}
+	// Seeking to data past the start fails with ENXIO if there's none.
+	// Filesystems without support for holes report the whole file as data.
+	_, err = f.Seek(start, unix.SEEK_DATA)
+	return err != nil && errors.Is(err, unix.ENXIO)
+}
+
+const (
+	// ioprioIdle is the idle I/O scheduling class, IOPRIO_CLASS_IDLE <<
+	// IOPRIO_CLASS_SHIFT, which only gets disk time when no other process
+	// needs it.
+	ioprioIdle = 3 << 13
+	// ioprioWhoProcess makes ioprio_set change a single thread.
+	ioprioWhoProcess = 1
+	// lowestNice is the lowest CPU scheduling priority.
+	lowestNice = 19
+)
+
+// lowerPriority moves the scan to the idle I/O scheduling class and the
+// lowest CPU priority, like running it with "ionice -c3 nice -n19". Both are
+// per thread on Linux, so every thread of the process is changed, and
+// threads started later inherit them.
+func lowerPriority() error {
+	done := map[int]bool{}
+	for {
+		tasks, err := os.ReadDir("/proc/self/task")
+		if err != nil {
+			return fmt.Errorf("listing threads: %v", err)
+		}
+		// Threads started while the others were changed are changed by
+		// the next pass.
+		changed := false
+		for _, t := range tasks {
+			tid, err := strconv.Atoi(t.Name())
+			if err != nil || done[tid] {
+				continue
+			}
+			done[tid], changed = true, true
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, lowestNice); err != nil && err != unix.ESRCH {
+				return fmt.Errorf("setting CPU priority: %v", err)
+			}
+			if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioIdle); errno != 0 && errno != unix.ESRCH {
+				return fmt.Errorf("setting I/O priority: %v", errno)
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/jar"
+)
+
+// writeSparse writes data at off of a new file of the given size, leaving
+// the rest of it a hole.
+func writeSparse(t *testing.T, path string, size, off int64, data []byte) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating file: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("truncating file: %v", err)
+	}
+	if _, err := f.WriteAt(data, off); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+}
+
+func TestSkipSpecialFiles(t *testing.T) {
+	const size = 1 << 20
+	data := []byte("PK\x03\x04")
+	dir := t.TempDir()
+	if err := syscall.Mkfifo(filepath.Join(dir, "pipe"), 0644); err != nil {
+		t.Fatalf("creating named pipe: %v", err)
+	}
+	// Files with data at their start only, and a hole where a ZIP
+	// archive's directory would be.
+	writeSparse(t, filepath.Join(dir, "hole.jar"), size, 0, data)
+	writeSparse(t, filepath.Join(dir, "hole.bin"), size, 0, data)
+	// A file with a hole at its start, but data at its end.
+	writeSparse(t, filepath.Join(dir, "tail.bin"), size, size-int64(len(data)), data)
+
+	info, err := os.Stat(filepath.Join(dir, "hole.jar"))
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if st := info.Sys().(*syscall.Stat_t); st.Blocks*512 >= info.Size() {
+		t.Skip("temporary directory doesn't support sparse files")
+	}
+
+	const (
+		pipe   = "special file: named pipe"
+		sparse = "sparse file without data at its end"
+	)
+	tests := []struct {
+		name   string
+		detect *jar.Detect
+		want   map[string]string
+	}{
+		{
+			name: "Default",
+			want: map[string]string{"pipe": pipe, "hole.jar": sparse},
+		},
+		{
+			name:   "Ext",
+			detect: &jar.Detect{Extensions: []string{".bin"}},
+			want:   map[string]string{"pipe": pipe, "hole.jar": sparse, "hole.bin": sparse},
+		},
+		{
+			name:   "AllFiles",
+			detect: &jar.Detect{All: true},
+			want:   map[string]string{"pipe": pipe, "hole.jar": sparse, "hole.bin": sparse},
+		},
+		{
+			name:   "Excluded",
+			detect: &jar.Detect{All: true, Exclude: []string{".bin"}},
+			want:   map[string]string{"pipe": pipe, "hole.jar": sparse},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := map[string]string{}
+			skipDir := newSkipDir(nil, nil, nil, tc.detect, t.Logf, func(path, reason string) {
+				got[filepath.Base(path)] = reason
+			})
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("reading directory: %v", err)
+			}
+			for _, d := range entries {
+				skipDir(filepath.Join(dir, d.Name()), d)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("newSkipDir() skipped unexpected files (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
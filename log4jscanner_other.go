@@ -16,6 +16,33 @@
 
 package main
 
+import (
+	"errors"
+	"io/fs"
+)
+
+// mountPoints isn't implemented on this platform, reports only list the
+// directories walked.
+func mountPoints() ([]string, error) {
+	return nil, nil
+}
+
+// deviceID isn't implemented on this platform, --one-file-system has no
+// effect.
+func deviceID(path string) (uint64, error) {
+	return 0, nil
+}
+
 func ignoreDir(path string) (bool, error) {
 	return false, nil
 }
+
+// sparseTail isn't implemented on this platform, sparse files are read.
+func sparseTail(path string, d fs.DirEntry) bool {
+	return false
+}
+
+// lowerPriority isn't implemented on this platform.
+func lowerPriority() error {
+	return errors.New("only supported on Linux")
+}
@@ -0,0 +1,383 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+// runMainEnv is set in the environment of the test binary when it's run by
+// runMain, so it runs main rather than the tests.
+const runMainEnv = "LOG4JSCANNER_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the scanner with args, returning what it wrote to stdout and
+// stderr, and its exit status.
+func runMain(t *testing.T, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var ee *exec.ExitError
+	switch {
+	case errors.As(err, &ee):
+		status = ee.ExitCode()
+	case err != nil:
+		t.Fatalf("running log4jscanner %s: %v", strings.Join(args, " "), err)
+	}
+	return out.String(), errOut.String(), status
+}
+
+// copyTestdata copies the JARs of jar/testdata to dir, keyed by their name
+// in dir, returning their total size.
+func copyTestdata(t *testing.T, dir string, files map[string]string) int64 {
+	t.Helper()
+	var size int64
+	for name, src := range files {
+		b, err := os.ReadFile(filepath.Join("jar", "testdata", src))
+		if err != nil {
+			t.Fatalf("reading test data: %v", err)
+		}
+		testjar.WriteFile(t, filepath.Join(dir, name), b)
+		size += int64(len(b))
+	}
+	return size
+}
+
+func TestEstimate(t *testing.T) {
+	dir := t.TempDir()
+	jars := copyTestdata(t, dir, map[string]string{
+		"vuln.jar":           "log4j-core-2.14.0.jar",
+		"lib/safe.jar":       "safe1.jar",
+		"node_modules/a.jar": "safe1.jar",
+	})
+	skipped, err := os.Stat(filepath.Join(dir, "node_modules", "a.jar"))
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	jars -= skipped.Size()
+	notes := []byte("not an archive\n")
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), notes, 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		// want holds the lines expected on stdout.
+		want       []string
+		wantStatus int
+	}{
+		{
+			name: "Default",
+			args: []string{"--estimate", dir},
+			want: []string{
+				"Candidate archives: 2",
+				"Total size:         " + formatBytes(jars),
+				fmt.Sprintf("Estimated duration: 0s (at %g MiB/s)", float64(defaultThroughput)),
+			},
+		},
+		{
+			name: "Throughput",
+			args: []string{"--estimate", "--throughput", "0.001", dir},
+			want: []string{
+				"Candidate archives: 2",
+				"Total size:         " + formatBytes(jars),
+				"Estimated duration: " + estimatedDuration(jars, 0.001) + " (at 0.001 MiB/s)",
+			},
+		},
+		{
+			name: "Ext",
+			args: []string{"--estimate", "--ext", "txt", dir},
+			want: []string{
+				"Candidate archives: 3",
+				"Total size:         " + formatBytes(jars+int64(len(notes))),
+				fmt.Sprintf("Estimated duration: 0s (at %g MiB/s)", float64(defaultThroughput)),
+			},
+		},
+		{
+			name:       "ZeroThroughput",
+			args:       []string{"--estimate", "--throughput", "0", dir},
+			wantStatus: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout, stderr, status := runMain(t, tc.args...)
+			if status != tc.wantStatus {
+				t.Fatalf("log4jscanner exited with status %d, want %d, stderr:\n%s", status, tc.wantStatus, stderr)
+			}
+			if tc.wantStatus != 0 {
+				return
+			}
+			// Estimating doesn't scan, so no findings are reported.
+			got := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("log4jscanner returned unexpected output (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// estimatedDuration returns the duration --estimate prints for size bytes at
+// throughput MiB/s.
+func estimatedDuration(size int64, throughput float64) string {
+	secs := float64(size) / (throughput * (1 << 20))
+	return time.Duration(secs * float64(time.Second)).Round(time.Second).String()
+}
+
+func TestCoverageReport(t *testing.T) {
+	dir := t.TempDir()
+	copyTestdata(t, dir, map[string]string{
+		"app/vuln.jar":          "log4j-core-2.14.0.jar",
+		"data/backup.jar":       "safe1.jar",
+		"node_modules/safe.jar": "safe1.jar",
+	})
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name string
+		args []string
+		// want holds the rows of the report within dir, without the
+		// header, with paths relative to dir.
+		want [][]string
+	}{
+		{
+			name: "Scan",
+			args: []string{"--skip", filepath.Join(dir, "data"), dir, missing},
+			want: [][]string{
+				{".", "root", "scanned", ""},
+				{"app", "directory", "scanned", ""},
+				{"data", "directory", "skipped", "skip pattern " + filepath.Join(dir, "data")},
+				{"missing", "root", "error", "stat .: no such file or directory"},
+				{"node_modules", "directory", "skipped", "well known directory"},
+			},
+		},
+		{
+			name: "Estimate",
+			args: []string{"--estimate", "--skip", filepath.Join(dir, "data"), dir},
+			want: [][]string{
+				{".", "root", "scanned", ""},
+				{"app", "directory", "scanned", ""},
+				{"data", "directory", "skipped", "skip pattern " + filepath.Join(dir, "data")},
+				{"node_modules", "directory", "skipped", "well known directory"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			report := filepath.Join(t.TempDir(), "coverage.csv")
+			args := append([]string{"--coverage-report", report}, tc.args...)
+			if _, stderr, status := runMain(t, args...); status != 0 {
+				t.Fatalf("log4jscanner exited with status %d, stderr:\n%s", status, stderr)
+			}
+			f, err := os.Open(report)
+			if err != nil {
+				t.Fatalf("opening coverage report: %v", err)
+			}
+			defer f.Close()
+			rows, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatalf("reading coverage report: %v", err)
+			}
+			if len(rows) == 0 || !cmp.Equal(rows[0], []string{"path", "kind", "status", "reason"}) {
+				t.Fatalf("coverage report has no header: %q", rows)
+			}
+			var got [][]string
+			for _, row := range rows[1:] {
+				rel, err := filepath.Rel(dir, row[0])
+				if err != nil || strings.HasPrefix(rel, "..") {
+					// Mounts outside of the scan.
+					continue
+				}
+				got = append(got, append([]string{rel}, row[1:]...))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("coverage report returned unexpected rows (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	clean, vuln := t.TempDir(), t.TempDir()
+	copyTestdata(t, clean, map[string]string{"safe.jar": "safe1.jar"})
+	copyTestdata(t, vuln, map[string]string{"safe.jar": "safe1.jar", "vuln.jar": "log4j-core-2.14.0.jar"})
+
+	tests := []struct {
+		name string
+		args []string
+		// format is --format, which doesn't change the summary.
+		format     string
+		want       runSummary
+		wantStatus int
+	}{
+		{
+			name: "Clean",
+			args: []string{clean},
+			want: runSummary{ExitReason: exitSuccess, Complete: true, Roots: 1, ArchivesScanned: 1},
+		},
+		{
+			name: "Vulnerable",
+			args: []string{vuln},
+			want: runSummary{
+				ExitReason: exitSuccess, Complete: true, Findings: 1, Unresolved: 1,
+				Severities: map[string]int{"critical": 1}, Roots: 1, ArchivesScanned: 2,
+			},
+		},
+		{
+			name:   "JSON",
+			args:   []string{vuln},
+			format: "json",
+			want: runSummary{
+				ExitReason: exitSuccess, Complete: true, Findings: 1, Unresolved: 1,
+				Severities: map[string]int{"critical": 1}, Roots: 1, ArchivesScanned: 2,
+			},
+		},
+		{
+			name: "FailOn",
+			args: []string{"--fail-on", "critical", vuln},
+			want: runSummary{
+				ExitCode: exitStatusFindings, ExitReason: exitFailOn, Complete: true, Findings: 1, Unresolved: 1,
+				Severities: map[string]int{"critical": 1}, Roots: 1, ArchivesScanned: 2,
+			},
+			wantStatus: exitStatusFindings,
+		},
+		{
+			name: "Roots",
+			args: []string{clean, vuln},
+			want: runSummary{
+				ExitReason: exitSuccess, Complete: true, Findings: 1, Unresolved: 1,
+				Severities: map[string]int{"critical": 1}, Roots: 2, ArchivesScanned: 3,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args := []string{"--summary-json"}
+			if tc.format != "" {
+				args = append(args, "--format", tc.format)
+			}
+			_, stderr, status := runMain(t, append(args, tc.args...)...)
+			if status != tc.wantStatus {
+				t.Fatalf("log4jscanner exited with status %d, want %d, stderr:\n%s", status, tc.wantStatus, stderr)
+			}
+			lines := strings.Split(strings.TrimSuffix(stderr, "\n"), "\n")
+			var got runSummary
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &got); err != nil {
+				t.Fatalf("last line of stderr isn't a summary: %v, stderr:\n%s", err, stderr)
+			}
+			// Sizes and timing depend on the test data and the host.
+			got.FilesWalked, got.BytesScanned, got.DecompressedBytes, got.DurationSeconds = 0, 0, 0, 0
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("--summary-json returned unexpected summary (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// after replaces the JARs found vulnerable before re-verifying,
+		// with the test data to copy or "" to remove them.
+		after      map[string]string
+		want       []string
+		wantStatus int
+	}{
+		{
+			name:       "StillVulnerable",
+			want:       []string{"vulnerable  a.jar", "vulnerable  b.jar"},
+			wantStatus: exitStatusFindings,
+		},
+		{
+			name:  "Fixed",
+			after: map[string]string{"a.jar": "safe1.jar", "b.jar": "safe1.signed.jar"},
+			want:  []string{"fixed       a.jar", "fixed       b.jar"},
+		},
+		{
+			name:  "Missing",
+			after: map[string]string{"a.jar": "", "b.jar": "safe1.jar"},
+			want:  []string{"missing     a.jar", "fixed       b.jar"},
+		},
+		{
+			name:       "Mixed",
+			after:      map[string]string{"a.jar": ""},
+			want:       []string{"missing     a.jar", "vulnerable  b.jar"},
+			wantStatus: exitStatusFindings,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			copyTestdata(t, dir, map[string]string{
+				"a.jar":    "log4j-core-2.14.0.jar",
+				"b.jar":    "log4j-core-2.14.0.jar",
+				"safe.jar": "safe1.jar",
+			})
+			findings, stderr, status := runMain(t, "--format", "json", dir)
+			if status != 0 {
+				t.Fatalf("scanning exited with status %d, stderr:\n%s", status, stderr)
+			}
+			from := filepath.Join(t.TempDir(), "findings.json")
+			if err := os.WriteFile(from, []byte(findings), 0644); err != nil {
+				t.Fatalf("writing findings: %v", err)
+			}
+			for name, src := range tc.after {
+				path := filepath.Join(dir, name)
+				if err := os.Remove(path); err != nil {
+					t.Fatalf("removing %s: %v", name, err)
+				}
+				if src != "" {
+					copyTestdata(t, dir, map[string]string{name: src})
+				}
+			}
+
+			stdout, stderr, status := runMain(t, "verify", "--from", from)
+			if status != tc.wantStatus {
+				t.Fatalf("verify exited with status %d, want %d, stderr:\n%s", status, tc.wantStatus, stderr)
+			}
+			got := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+			for i, line := range got {
+				got[i] = strings.Replace(line, dir+string(filepath.Separator), "", 1)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("verify returned unexpected output (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
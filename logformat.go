@@ -0,0 +1,55 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"log4jscanner/logging"
+	"log4jscanner/metrics"
+)
+
+const logFormatHelp = `--log-format   Format of the log written to stderr, text or json. JSON
+                   logs are one object per line with "time", "level",
+                   "msg", and per-file "path" and "error" fields, as read
+                   by slog and zap compatible log pipelines (default text).`
+
+// logFormatFlag defines the --log-format flag.
+func logFormatFlag(flags *flag.FlagSet, format *string) {
+	flags.StringVar(format, "log-format", logging.Text, "")
+}
+
+// setupLogging configures the log output for a --log-format. It must be
+// called after the log flags are set.
+func setupLogging(format string) {
+	if err := logging.Setup(format, os.Stderr); err != nil {
+		log.Fatalf("Error: --log-format: %v", err)
+	}
+}
+
+// serveMetrics serves the metrics of a registry under /metrics on addr.
+func serveMetrics(addr string, reg *metrics.Registry) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg)
+	log.Printf("Serving metrics on %s", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Fatalf("Error: serving metrics: %v", err)
+		}
+	}()
+}
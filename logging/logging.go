@@ -0,0 +1,198 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging writes the scanner's log output as structured JSON lines,
+// with the keys of log/slog's JSON handler ("time", "level", "msg") so they
+// can be ingested by slog or zap compatible pipelines, and per-file fields
+// such as "path" and "error".
+//
+// Messages are logged with the log package as usual. Their level is taken
+// from the "Error: " and "Warning: " prefixes the scanner uses.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats of the log output.
+const (
+	Text = "text"
+	JSON = "json"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{Text, JSON}
+
+var (
+	mu  sync.Mutex
+	std *Writer
+)
+
+// Setup configures the standard logger to write in format to w. The text
+// format leaves the log package's output as is.
+func Setup(format string, w io.Writer) error {
+	switch format {
+	case Text:
+		mu.Lock()
+		std = nil
+		mu.Unlock()
+		log.SetOutput(w)
+	case JSON:
+		jw := &Writer{W: w}
+		mu.Lock()
+		std = jw
+		mu.Unlock()
+		// The source of the message is parsed from the prefix, and its time
+		// is recorded by the writer.
+		log.SetFlags(log.Lshortfile)
+		log.SetOutput(jw)
+	default:
+		return fmt.Errorf("unknown log format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+	return nil
+}
+
+// Writer rewrites lines written by the log package, with the log.Lshortfile
+// flag, as JSON objects.
+type Writer struct {
+	W io.Writer
+
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// Write writes each line of p as a JSON object.
+func (w *Writer) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		source, msg := splitSource(line)
+		if err := w.write(source, msg, nil); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// splitSource splits the "file.go:123: " prefix of log.Lshortfile.
+func splitSource(line string) (source, msg string) {
+	i := strings.Index(line, ": ")
+	if i < 0 {
+		return "", line
+	}
+	prefix := line[:i]
+	j := strings.LastIndex(prefix, ":")
+	if j < 0 || !strings.HasSuffix(prefix[:j], ".go") {
+		return "", line
+	}
+	if _, err := strconv.Atoi(prefix[j+1:]); err != nil {
+		return "", line
+	}
+	return prefix, line[i+2:]
+}
+
+// level returns the level of a message and the message without its prefix.
+func level(msg string) (string, string) {
+	switch {
+	case strings.HasPrefix(msg, "Error: "):
+		return "ERROR", strings.TrimPrefix(msg, "Error: ")
+	case strings.HasPrefix(msg, "Warning: "):
+		return "WARN", strings.TrimPrefix(msg, "Warning: ")
+	}
+	return "INFO", msg
+}
+
+func (w *Writer) write(source, msg string, fields []interface{}) error {
+	now := time.Now
+	if w.now != nil {
+		now = w.now
+	}
+	lvl, msg := level(msg)
+	var b bytes.Buffer
+	b.WriteByte('{')
+	writeField(&b, "time", now().UTC().Format(time.RFC3339Nano))
+	b.WriteByte(',')
+	writeField(&b, "level", lvl)
+	if source != "" {
+		b.WriteByte(',')
+		writeField(&b, "source", source)
+	}
+	b.WriteByte(',')
+	writeField(&b, "msg", msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		b.WriteByte(',')
+		writeField(&b, fmt.Sprint(fields[i]), fields[i+1])
+	}
+	b.WriteString("}\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.W.Write(b.Bytes())
+	return err
+}
+
+func writeField(b *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	b.Write(k)
+	b.WriteByte(':')
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(v)
+}
+
+// Entry is a log message's structured fields.
+type Entry struct {
+	fields []interface{}
+}
+
+// With returns an entry with fields given as alternating keys and values,
+// such as With("path", p, "error", err). Errors and fmt.Stringers are
+// written as strings.
+func With(kv ...interface{}) *Entry {
+	return &Entry{fields: kv}
+}
+
+// Printf logs a message like log.Printf, with the entry's fields when the
+// output is JSON. The text output is the same as log.Printf's.
+func (e *Entry) Printf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	mu.Lock()
+	w := std
+	mu.Unlock()
+	if w == nil {
+		log.Output(2, msg)
+		return
+	}
+	source := ""
+	if _, file, line, ok := runtime.Caller(1); ok {
+		source = filepath.Base(file) + ":" + strconv.Itoa(line)
+	}
+	w.write(source, msg, e.fields)
+}
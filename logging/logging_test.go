@@ -0,0 +1,94 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriter(t *testing.T) {
+	now := time.Date(2021, 12, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		line string
+		want string
+	}{
+		{
+			line: "log4jscanner.go:12: Error: scanning a.jar: boom\n",
+			want: `{"time":"2021-12-10T00:00:00Z","level":"ERROR","source":"log4jscanner.go:12","msg":"scanning a.jar: boom"}` + "\n",
+		},
+		{
+			line: "Warning: \"quoted\"\n",
+			want: `{"time":"2021-12-10T00:00:00Z","level":"WARN","msg":"\"quoted\""}` + "\n",
+		},
+		{
+			line: "walked 3 files: done\nsecond\n",
+			want: `{"time":"2021-12-10T00:00:00Z","level":"INFO","msg":"walked 3 files: done"}` + "\n" +
+				`{"time":"2021-12-10T00:00:00Z","level":"INFO","msg":"second"}` + "\n",
+		},
+	}
+	for _, tc := range tests {
+		var b bytes.Buffer
+		w := &Writer{W: &b, now: func() time.Time { return now }}
+		if _, err := w.Write([]byte(tc.line)); err != nil {
+			t.Fatalf("Write(%q) failed: %v", tc.line, err)
+		}
+		if diff := cmp.Diff(tc.want, b.String()); diff != "" {
+			t.Errorf("Write(%q) returned diff (-want, +got):\n%s", tc.line, diff)
+		}
+	}
+}
+
+func TestEntry(t *testing.T) {
+	defer func(flags int, w *Writer) {
+		log.SetFlags(flags)
+		std = w
+	}(log.Flags(), std)
+	defer log.SetOutput(log.Writer())
+
+	var b bytes.Buffer
+	if err := Setup(Text, &b); err != nil {
+		t.Fatalf("Setup(%q) failed: %v", Text, err)
+	}
+	log.SetFlags(0)
+	With("path", "a.jar", "error", errors.New("boom")).Printf("Error: scanning %s: %v", "a.jar", "boom")
+	if got, want := b.String(), "Error: scanning a.jar: boom\n"; got != want {
+		t.Errorf("text Printf() wrote %q, want %q", got, want)
+	}
+
+	b.Reset()
+	if err := Setup(JSON, &b); err != nil {
+		t.Fatalf("Setup(%q) failed: %v", JSON, err)
+	}
+	std.now = func() time.Time { return time.Date(2021, 12, 10, 0, 0, 0, 0, time.UTC) }
+	_, _, line, _ := runtime.Caller(0)
+	With("path", "a.jar", "error", errors.New("boom"), "size", 3).Printf("Error: scanning %s: %v", "a.jar", "boom")
+	want := `{"time":"2021-12-10T00:00:00Z","level":"ERROR","source":"logging_test.go:` + strconv.Itoa(line+1) +
+		`","msg":"scanning a.jar: boom","path":"a.jar","error":"boom","size":3}` + "\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("json Printf() returned diff (-want, +got):\n%s", diff)
+	}
+
+	if err := Setup("xml", &b); err == nil {
+		t.Errorf("Setup(%q) succeeded, want error", "xml")
+	}
+}
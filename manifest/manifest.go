@@ -0,0 +1,198 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest parses JAR manifests, META-INF/MANIFEST.MF, following the
+// JAR File Specification: a main section of attributes describing the JAR,
+// then sections describing its entries, each starting with a Name attribute
+// and separated by blank lines. Values longer than a line continue onto the
+// following lines, which start with a single space.
+//
+// Parsing is lenient, since the manifests of JARs found in the wild don't
+// always follow the specification: lines that aren't attributes are ignored
+// rather than rejected.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Path is the path of the manifest within a JAR.
+const Path = "META-INF/MANIFEST.MF"
+
+// maxLineSize bounds a line of a manifest, which the specification limits to
+// 72 bytes.
+const maxLineSize = 64 << 10 // 64KiB
+
+// Attribute is an attribute of a section of a manifest, such as
+// "Main-Class: org.example.App".
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// Attributes are the attributes of a section, in the order they appear.
+type Attributes []Attribute
+
+// Get returns the value of the attribute with the given name, or "" if the
+// section doesn't have it. Names are matched case-insensitively, and the last
+// of repeated attributes is returned, like the JVM does.
+func (a Attributes) Get(name string) string {
+	v, _ := a.Lookup(name)
+	return v
+}
+
+// Lookup is like Get, but reports if the section has the attribute.
+func (a Attributes) Lookup(name string) (string, bool) {
+	for i := len(a) - 1; i >= 0; i-- {
+		if strings.EqualFold(a[i].Name, name) {
+			return a[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Section is a section of a manifest describing an entry of the JAR, or a
+// package when Name ends with a slash.
+type Section struct {
+	// Name is the value of the Name attribute starting the section, such as
+	// "org/apache/logging/log4j/core/lookup/JndiLookup.class".
+	Name string
+	// Attributes are the other attributes of the section.
+	Attributes Attributes
+}
+
+// Manifest is a parsed manifest.
+type Manifest struct {
+	// Main holds the attributes of the main section, describing the JAR.
+	// Sections without a Name attribute, such as those following a stray
+	// blank line, are merged into it.
+	Main Attributes
+	// Sections holds the sections describing entries, in the order they
+	// appear.
+	Sections []Section
+}
+
+// Entry returns the attributes of the sections describing the entry name,
+// merged if there are several.
+func (m *Manifest) Entry(name string) Attributes {
+	var attrs Attributes
+	for _, s := range m.Sections {
+		if s.Name == name {
+			attrs = append(attrs, s.Attributes...)
+		}
+	}
+	return attrs
+}
+
+// Parse parses the manifest read from r. Only errors reading r, and lines
+// longer than 64KiB, are returned.
+func Parse(r io.Reader) (*Manifest, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLineSize)
+	s.Split(scanLines)
+	m := &Manifest{}
+	var (
+		section *Section // nil for the main section
+		started bool     // set once an attribute of the section is read
+		value   *string  // the value continuation lines extend
+	)
+	add := func(line []byte) {
+		i := bytes.IndexByte(line, ':')
+		if i <= 0 {
+			value = nil
+			return
+		}
+		a := Attribute{Name: string(line[:i]), Value: string(line[i+1:])}
+		switch {
+		case !started && section != nil && strings.EqualFold(a.Name, "Name"):
+			m.Sections = append(m.Sections, Section{Name: a.Value})
+			section = &m.Sections[len(m.Sections)-1]
+			value = &section.Name
+		case section != nil && started:
+			section.Attributes = append(section.Attributes, a)
+			value = &section.Attributes[len(section.Attributes)-1].Value
+		default:
+			// The main section, or a section without a Name.
+			section = nil
+			m.Main = append(m.Main, a)
+			value = &m.Main[len(m.Main)-1].Value
+		}
+		started = true
+	}
+	for s.Scan() {
+		line := s.Bytes()
+		switch {
+		case len(line) == 0:
+			// A blank line ends the section.
+			if started {
+				section, started, value = &Section{}, false, nil
+			}
+		case line[0] == ' ':
+			if value != nil {
+				*value += string(line[1:])
+			}
+		default:
+			add(line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading manifest: %v", err)
+	}
+	trim(m.Main)
+	for i := range m.Sections {
+		m.Sections[i].Name = strings.TrimSpace(m.Sections[i].Name)
+		trim(m.Sections[i].Attributes)
+	}
+	return m, nil
+}
+
+// trim removes the space separating the values of attributes from their
+// names, and any trailing space.
+func trim(attrs Attributes) {
+	for i := range attrs {
+		attrs[i].Value = strings.TrimSpace(attrs[i].Value)
+	}
+}
+
+// scanLines is a bufio.SplitFunc splitting the lines of a manifest, which
+// may end with CR LF, LF, or CR alone.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A CR may be followed by an LF not read yet.
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want *Manifest
+	}{
+		{
+			name: "main section",
+			in:   "Manifest-Version: 1.0\r\nMain-Class: org.example.App\r\n",
+			want: &Manifest{Main: Attributes{{"Manifest-Version", "1.0"}, {"Main-Class", "org.example.App"}}},
+		},
+		{
+			name: "continuations",
+			in: "Manifest-Version: 1.0\r\n" +
+				"Class-Path: lib/log4j-api-2.14.1.jar lib/log4j-core-2.1\r\n" +
+				" 4.1.jar\r\n" +
+				"Export-Package: org.example;uses:=\"org.apache.logging.log4j\",org\r\n" +
+				" .example.api\r\n",
+			want: &Manifest{Main: Attributes{
+				{"Manifest-Version", "1.0"},
+				{"Class-Path", "lib/log4j-api-2.14.1.jar lib/log4j-core-2.14.1.jar"},
+				{"Export-Package", "org.example;uses:=\"org.apache.logging.log4j\",org.example.api"},
+			}},
+		},
+		{
+			name: "sections",
+			in: "Manifest-Version: 1.0\n" +
+				"Implementation-Version: 1.0\n" +
+				"\n" +
+				"Name: org/apache/logging/log4j/core/\n" +
+				"Implementation-Title: Apache Log4j Core\n" +
+				"Implementation-Version: 2.14.1\n" +
+				"\n" +
+				"\n" +
+				"Name: org/apache/logging/log4j/core/lookup/JndiLookup.cla\n" +
+				" ss\n" +
+				"SHA-256-Digest: 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=\n",
+			want: &Manifest{
+				Main: Attributes{{"Manifest-Version", "1.0"}, {"Implementation-Version", "1.0"}},
+				Sections: []Section{
+					{Name: "org/apache/logging/log4j/core/", Attributes: Attributes{
+						{"Implementation-Title", "Apache Log4j Core"},
+						{"Implementation-Version", "2.14.1"},
+					}},
+					{Name: "org/apache/logging/log4j/core/lookup/JndiLookup.class", Attributes: Attributes{
+						{"SHA-256-Digest", "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+					}},
+				},
+			},
+		},
+		{
+			name: "CR line endings",
+			in:   "Manifest-Version: 1.0\rMain-Class: org.example.App\r\rName: a.class\rX: y",
+			want: &Manifest{
+				Main:     Attributes{{"Manifest-Version", "1.0"}, {"Main-Class", "org.example.App"}},
+				Sections: []Section{{Name: "a.class", Attributes: Attributes{{"X", "y"}}}},
+			},
+		},
+		{
+			name: "section without a name",
+			in:   "Manifest-Version: 1.0\n\nMain-Class: org.example.App\n",
+			want: &Manifest{Main: Attributes{{"Manifest-Version", "1.0"}, {"Main-Class", "org.example.App"}}},
+		},
+		{
+			name: "malformed lines",
+			in:   "Manifest-Version: 1.0\nnot an attribute\n: no name\n continues nothing\nMain-Class: org.example.App\n",
+			want: &Manifest{Main: Attributes{{"Manifest-Version", "1.0"}, {"Main-Class", "org.example.App"}}},
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: &Manifest{},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Parse() returned diff (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestParseTooLong(t *testing.T) {
+	if _, err := Parse(strings.NewReader("Class-Path: " + strings.Repeat("a", maxLineSize))); err == nil {
+		t.Errorf("Parse() of a line over %d bytes succeeded, want error", maxLineSize)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	m, err := Parse(strings.NewReader("Manifest-Version: 1.0\nmain-class: org.example.Old\nMAIN-CLASS: org.example.App\nEmpty:\n\n" +
+		"Name: a/\nSealed: true\n\nName: a/\nSpecification-Version: 1\n"))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if got, want := m.Main.Get("Main-Class"), "org.example.App"; got != want {
+		t.Errorf("Get(Main-Class) = %q, want %q", got, want)
+	}
+	if v, ok := m.Main.Lookup("Empty"); v != "" || !ok {
+		t.Errorf("Lookup(Empty) = %q, %v, want \"\", true", v, ok)
+	}
+	if v, ok := m.Main.Lookup("Missing"); v != "" || ok {
+		t.Errorf("Lookup(Missing) = %q, %v, want \"\", false", v, ok)
+	}
+	want := Attributes{{"Sealed", "true"}, {"Specification-Version", "1"}}
+	if diff := cmp.Diff(want, m.Entry("a/")); diff != "" {
+		t.Errorf("Entry(a/) returned diff (-want, +got): %s", diff)
+	}
+}
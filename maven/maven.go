@@ -0,0 +1,317 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package maven understands the layouts of Maven local repositories and
+// Gradle caches, identifying the archives they hold by Maven coordinates, and
+// the pom.xml and build.gradle files of projects that declare them.
+package maven
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Coordinates identify an artifact in a Maven repository.
+type Coordinates struct {
+	Group    string
+	Artifact string
+	Version  string
+}
+
+// String returns the "groupId:artifactId:version" form of the coordinates.
+func (c Coordinates) String() string {
+	return c.Group + ":" + c.Artifact + ":" + c.Version
+}
+
+// Locate returns the coordinates of an archive in a Maven local repository,
+// such as
+//
+//	~/.m2/repository/org/apache/logging/log4j/log4j-core/2.14.1/log4j-core-2.14.1.jar
+//
+// or a Gradle cache, such as
+//
+//	~/.gradle/caches/modules-2/files-2.1/org.apache.logging.log4j/log4j-core/2.14.1/<sha1>/log4j-core-2.14.1.jar
+//
+// Maven repositories are recognized by their .m2/repository directory, or by
+// being one of the provided roots, for repositories kept elsewhere.
+func Locate(path string, roots []string) (Coordinates, bool) {
+	path = filepath.Clean(path)
+	elems := strings.Split(filepath.ToSlash(path), "/")
+	for i := len(elems) - 2; i > 0; i-- {
+		switch {
+		case elems[i-1] == ".m2" && elems[i] == "repository":
+			return mavenLayout(elems[i+1:])
+		case elems[i-1] == "modules-2" && elems[i] == "files-2.1":
+			return gradleLayout(elems[i+1:])
+		}
+	}
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if c, ok := mavenLayout(strings.Split(filepath.ToSlash(rel), "/")); ok {
+			return c, true
+		}
+	}
+	return Coordinates{}, false
+}
+
+// mavenLayout parses "group/path/artifact/version/file" elements.
+func mavenLayout(elems []string) (Coordinates, bool) {
+	n := len(elems)
+	if n < 4 {
+		return Coordinates{}, false
+	}
+	c := Coordinates{
+		Group:    strings.Join(elems[:n-3], "."),
+		Artifact: elems[n-3],
+		Version:  elems[n-2],
+	}
+	if !artifactFile(c, elems[n-1]) {
+		return Coordinates{}, false
+	}
+	return c, true
+}
+
+// gradleLayout parses "group/artifact/version/hash/file" elements.
+func gradleLayout(elems []string) (Coordinates, bool) {
+	if len(elems) != 5 {
+		return Coordinates{}, false
+	}
+	c := Coordinates{Group: elems[0], Artifact: elems[1], Version: elems[2]}
+	if !artifactFile(c, elems[4]) {
+		return Coordinates{}, false
+	}
+	return c, true
+}
+
+// artifactFile reports whether a file name is one of the artifact's files,
+// such as "log4j-core-2.14.1.jar" or "log4j-core-2.14.1-tests.jar". Snapshot
+// versions are stored with timestamped file names, so only their base
+// version is compared.
+func artifactFile(c Coordinates, name string) bool {
+	version := strings.TrimSuffix(c.Version, "-SNAPSHOT")
+	return strings.HasPrefix(name, c.Artifact+"-"+version)
+}
+
+// Dependency is a dependency declared by a build file.
+type Dependency struct {
+	Coordinates
+	// Path and Line locate the declaration.
+	Path string
+	Line int
+}
+
+// Location returns the "path:line" of the declaration.
+func (d Dependency) Location() string {
+	return fmt.Sprintf("%s:%d", d.Path, d.Line)
+}
+
+// Matches reports whether the dependency declares an artifact. Dependencies
+// whose version couldn't be resolved, such as those managed by a parent POM,
+// match any version.
+func (d Dependency) Matches(c Coordinates) bool {
+	if d.Group != c.Group || d.Artifact != c.Artifact {
+		return false
+	}
+	return d.Version == "" || strings.Contains(d.Version, "$") || d.Version == c.Version
+}
+
+type pomXML struct {
+	Version string `xml:"version"`
+	Parent  struct {
+		Version string `xml:"version"`
+	} `xml:"parent"`
+	Properties struct {
+		Props []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	} `xml:"properties"`
+}
+
+type dependencyXML struct {
+	Group    string `xml:"groupId"`
+	Artifact string `xml:"artifactId"`
+	Version  string `xml:"version"`
+}
+
+// ParsePOM returns the dependencies declared by a pom.xml file, including
+// those in <dependencyManagement> and plugin dependencies. Versions
+// referring to properties defined in the same file are resolved.
+func ParsePOM(path string) ([]Dependency, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pom pomXML
+	if err := xml.Unmarshal(b, &pom); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	props := map[string]string{}
+	for _, p := range pom.Properties.Props {
+		props[p.XMLName.Local] = strings.TrimSpace(p.Value)
+	}
+	version := pom.Version
+	if version == "" {
+		version = pom.Parent.Version
+	}
+	props["project.version"] = version
+	props["pom.version"] = version
+
+	var deps []Dependency
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "dependency" {
+			continue
+		}
+		var dep dependencyXML
+		if err := d.DecodeElement(&dep, &start); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+		deps = append(deps, Dependency{
+			Coordinates: Coordinates{
+				Group:    interpolate(strings.TrimSpace(dep.Group), props),
+				Artifact: interpolate(strings.TrimSpace(dep.Artifact), props),
+				Version:  interpolate(strings.TrimSpace(dep.Version), props),
+			},
+			Path: path,
+			Line: 1 + bytes.Count(b[:offset], []byte("\n")),
+		})
+	}
+	return deps, nil
+}
+
+var propertyRef = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// interpolate replaces references to known properties.
+func interpolate(s string, props map[string]string) string {
+	return propertyRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if v, ok := props[ref[2:len(ref)-1]]; ok && v != "" {
+			return v
+		}
+		return ref
+	})
+}
+
+var (
+	// gradleString matches dependencies declared as "group:artifact:version"
+	// strings, optionally with a classifier.
+	gradleString = regexp.MustCompile(`["']([\w.\-]+):([\w.\-]+):([\w.\-${}]+)(?::[\w.\-]+)?["']`)
+	// gradleMap matches dependencies declared as
+	// group: "...", name: "...", version: "..." maps, or their Kotlin
+	// group = "...", name = "...", version = "..." equivalent.
+	gradleMap = regexp.MustCompile(`group\s*[:=]\s*["']([^"']+)["']\s*,\s*name\s*[:=]\s*["']([^"']+)["']\s*(?:,\s*version\s*[:=]\s*["']([^"']+)["'])?`)
+)
+
+// ParseGradle returns the dependencies declared by a build.gradle or
+// build.gradle.kts file. Gradle builds are programs, so this recognizes the
+// common string and map notations rather than evaluating the build.
+func ParseGradle(path string) ([]Dependency, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var deps []Dependency
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		for _, m := range gradleString.FindAllStringSubmatch(text, -1) {
+			deps = append(deps, Dependency{
+				Coordinates: Coordinates{Group: m[1], Artifact: m[2], Version: m[3]},
+				Path:        path,
+				Line:        line,
+			})
+		}
+		for _, m := range gradleMap.FindAllStringSubmatch(text, -1) {
+			deps = append(deps, Dependency{
+				Coordinates: Coordinates{Group: m[1], Artifact: m[2], Version: m[3]},
+				Path:        path,
+				Line:        line,
+			})
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return deps, nil
+}
+
+// skipDirs holds directories that don't contain project sources.
+var skipDirs = map[string]bool{
+	".git":         true,
+	".gradle":      true,
+	".m2":          true,
+	"node_modules": true,
+	"target":       true,
+}
+
+// FindDependencies walks a directory for pom.xml, build.gradle and
+// build.gradle.kts files, returning the dependencies they declare. Errors for
+// individual build files are passed to handleError, if provided, and don't
+// stop the walk.
+func FindDependencies(root string, handleError func(path string, err error)) ([]Dependency, error) {
+	var deps []Dependency
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			if handleError != nil {
+				handleError(p, err)
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if p != root && skipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		var found []Dependency
+		switch d.Name() {
+		case "pom.xml":
+			found, err = ParsePOM(p)
+		case "build.gradle", "build.gradle.kts":
+			found, err = ParseGradle(p)
+		default:
+			return nil
+		}
+		if err != nil {
+			if handleError != nil {
+				handleError(p, err)
+			}
+			return nil
+		}
+		deps = append(deps, found...)
+		return nil
+	})
+	return deps, err
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maven
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+func TestLocate(t *testing.T) {
+	log4j := Coordinates{Group: "org.apache.logging.log4j", Artifact: "log4j-core", Version: "2.14.1"}
+	tests := []struct {
+		path  string
+		roots []string
+		want  Coordinates
+		ok    bool
+	}{
+		{
+			path: "/home/u/.m2/repository/org/apache/logging/log4j/log4j-core/2.14.1/log4j-core-2.14.1.jar",
+			want: log4j,
+			ok:   true,
+		},
+		{
+			path: "/home/u/.gradle/caches/modules-2/files-2.1/org.apache.logging.log4j/log4j-core/2.14.1/9141212b8507ab50a45525b545b39d224614528b/log4j-core-2.14.1.jar",
+			want: log4j,
+			ok:   true,
+		},
+		{
+			path:  "/srv/repo/org/apache/logging/log4j/log4j-core/2.14.1/log4j-core-2.14.1-tests.jar",
+			roots: []string{"/srv/repo"},
+			want:  log4j,
+			ok:    true,
+		},
+		{
+			path: "/home/u/.m2/repository/com/example/app/1.0-SNAPSHOT/app-1.0-20211215.101010-3.jar",
+			want: Coordinates{Group: "com.example", Artifact: "app", Version: "1.0-SNAPSHOT"},
+			ok:   true,
+		},
+		{
+			// Not in a repository.
+			path: "/opt/app/lib/log4j-core-2.14.1.jar",
+		},
+		{
+			// The file doesn't belong to the artifact directory.
+			path: "/home/u/.m2/repository/org/apache/logging/log4j/log4j-core/2.14.1/shaded.jar",
+		},
+		{
+			// Too few elements for the Gradle layout.
+			path: "/home/u/.gradle/caches/modules-2/files-2.1/log4j-core/2.14.1/log4j-core-2.14.1.jar",
+		},
+	}
+	for _, tc := range tests {
+		got, ok := Locate(filepath.FromSlash(tc.path), tc.roots)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Locate(%q) = %v, %v, want %v, %v", tc.path, got, ok, tc.want, tc.ok)
+		}
+	}
+	if s := log4j.String(); s != "org.apache.logging.log4j:log4j-core:2.14.1" {
+		t.Errorf("String() = %q, want %q", s, "org.apache.logging.log4j:log4j-core:2.14.1")
+	}
+}
+
+func TestFindDependencies(t *testing.T) {
+	root := t.TempDir()
+	pom := filepath.Join(root, "app", "pom.xml")
+	testjar.WriteFile(t, pom, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <groupId>com.example</groupId>
+  <artifactId>app</artifactId>
+  <version>1.0</version>
+  <properties>
+    <log4j.version>2.14.1</log4j.version>
+  </properties>
+  <dependencies>
+    <dependency>
+      <groupId>org.apache.logging.log4j</groupId>
+      <artifactId>log4j-core</artifactId>
+      <version>${log4j.version}</version>
+    </dependency>
+    <dependency>
+      <groupId>com.example</groupId>
+      <artifactId>lib</artifactId>
+      <version>${project.version}</version>
+    </dependency>
+    <dependency>
+      <groupId>org.apache.logging.log4j</groupId>
+      <artifactId>log4j-api</artifactId>
+    </dependency>
+  </dependencies>
+</project>
+`))
+	gradle := filepath.Join(root, "service", "build.gradle")
+	testjar.WriteFile(t, gradle, []byte(`dependencies {
+    implementation 'org.apache.logging.log4j:log4j-core:2.15.0'
+    runtimeOnly group: 'org.apache.logging.log4j', name: 'log4j-api', version: '2.15.0'
+}
+`))
+	testjar.WriteFile(t, filepath.Join(root, "service", "target", "pom.xml"), []byte(`<project>`))
+	broken := filepath.Join(root, "broken", "pom.xml")
+	testjar.WriteFile(t, broken, []byte(`<project>`))
+
+	var errs []string
+	got, err := FindDependencies(root, func(path string, err error) {
+		errs = append(errs, path)
+	})
+	if err != nil {
+		t.Fatalf("FindDependencies() failed: %v", err)
+	}
+	want := []Dependency{
+		{Coordinates{"org.apache.logging.log4j", "log4j-core", "2.14.1"}, pom, 10},
+		{Coordinates{"com.example", "lib", "1.0"}, pom, 15},
+		{Coordinates{"org.apache.logging.log4j", "log4j-api", ""}, pom, 20},
+		{Coordinates{"org.apache.logging.log4j", "log4j-core", "2.15.0"}, gradle, 2},
+		{Coordinates{"org.apache.logging.log4j", "log4j-api", "2.15.0"}, gradle, 3},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FindDependencies() returned diff (-want, +got): %s", diff)
+	}
+	if len(errs) != 1 || errs[0] != broken {
+		t.Errorf("FindDependencies() reported errors for %v, want only %s", errs, broken)
+	}
+
+	core := Coordinates{"org.apache.logging.log4j", "log4j-core", "2.14.1"}
+	api := Coordinates{"org.apache.logging.log4j", "log4j-api", "2.14.1"}
+	for _, tc := range []struct {
+		dep  Dependency
+		c    Coordinates
+		want bool
+	}{
+		{want[0], core, true},
+		{want[3], core, false},
+		{want[2], api, true},
+		{want[1], core, false},
+	} {
+		if got := tc.dep.Matches(tc.c); got != tc.want {
+			t.Errorf("%s Matches(%v) = %v, want %v", tc.dep.Location(), tc.c, got, tc.want)
+		}
+	}
+}
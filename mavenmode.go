@@ -0,0 +1,52 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+
+	"log4jscanner/maven"
+)
+
+// mavenProjects holds the dependencies declared by the build files found
+// under --projects directories.
+type mavenProjects []maven.Dependency
+
+// findMavenProjects collects the dependencies declared under the provided
+// directories.
+func findMavenProjects(dirs []string, handleError func(path string, err error)) mavenProjects {
+	var deps mavenProjects
+	for _, dir := range dirs {
+		found, err := maven.FindDependencies(dir, handleError)
+		if err != nil {
+			log.Printf("Error: finding projects in %s: %v", dir, err)
+			continue
+		}
+		deps = append(deps, found...)
+	}
+	return deps
+}
+
+// declaring returns the locations ("path:line") of the build files
+// declaring an artifact.
+func (m mavenProjects) declaring(c maven.Coordinates) []string {
+	var locs []string
+	for _, d := range m {
+		if d.Matches(c) {
+			locs = append(locs, d.Location())
+		}
+	}
+	return locs
+}
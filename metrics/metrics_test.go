@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/jar"
+)
+
+func TestRegistry(t *testing.T) {
+	r := &Registry{}
+	total := r.NewCounter("test_total", "Things.")
+	byKind := r.NewCounter("test_kinds_total", "Things by \"kind\".", "kind")
+	h := r.NewHistogram("test_seconds", "Latency.", 0.1, 1)
+
+	total.Inc()
+	total.Add(2)
+	byKind.Inc("b")
+	byKind.Inc("a\"quoted\"")
+	byKind.Inc("b")
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	want := `# HELP test_total Things.
+# TYPE test_total counter
+test_total 3
+# HELP test_kinds_total Things by "kind".
+# TYPE test_kinds_total counter
+test_kinds_total{kind="a\"quoted\""} 1
+test_kinds_total{kind="b"} 2
+# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 5.55
+test_seconds_count 3
+`
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if diff := cmp.Diff(want, rec.Body.String()); diff != "" {
+		t.Errorf("ServeHTTP() returned diff (-want, +got):\n%s", diff)
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("ServeHTTP() returned Content-Type %q, want text exposition format", got)
+	}
+}
+
+func TestEmptyCounter(t *testing.T) {
+	r := &Registry{}
+	r.NewCounter("unlabelled_total", "Unlabelled.")
+	r.NewCounter("labelled_total", "Labelled.", "kind")
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() failed: %v", err)
+	}
+	want := `# HELP unlabelled_total Unlabelled.
+# TYPE unlabelled_total counter
+unlabelled_total 0
+# HELP labelled_total Labelled.
+# TYPE labelled_total counter
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("WriteTo() returned diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestScans(t *testing.T) {
+	s := NewScans(&Registry{})
+	s.Record(time.Second, nil, nil)
+	s.Record(time.Second, &jar.Report{}, nil)
+	s.Record(time.Second, &jar.Report{Vulnerable: true, CVEs: []string{"CVE-2021-44228"}}, nil)
+	s.Record(time.Second, nil, &jar.TimeoutError{Timeout: time.Second})
+	s.Record(time.Second, nil, fmt.Errorf("scanning: %w", &jar.TruncatedError{Size: 4}))
+	s.Record(time.Second, nil, errors.New("permission denied"))
+
+	for _, tc := range []struct {
+		name string
+		c    *Counter
+		l    []string
+		want float64
+	}{
+		{"archives", s.Archives, nil, 3},
+		{"critical findings", s.Findings, []string{"critical"}, 1},
+		{"timeouts", s.Errors, []string{"timeout"}, 1},
+		{"truncated", s.Errors, []string{"truncated"}, 1},
+		{"other errors", s.Errors, []string{"other"}, 1},
+	} {
+		if got := tc.c.Value(tc.l...); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if s.Latency.count != 6 {
+		t.Errorf("Latency observed %d scans, want 6", s.Latency.count)
+	}
+}
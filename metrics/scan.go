@@ -0,0 +1,83 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// Scans holds the metrics of scanned archives.
+type Scans struct {
+	// Archives counts the archives scanned, JARs or not, and Findings the
+	// vulnerable JARs, by severity.
+	Archives *Counter
+	Findings *Counter
+	// Errors counts the archives that couldn't be scanned, by kind:
+	// "timeout", "zip_bomb", "truncated", or "other".
+	Errors *Counter
+	// Latency samples the time scans took, in seconds.
+	Latency *Histogram
+}
+
+// NewScans registers the metrics of scanned archives, named with the
+// "log4jscanner_" prefix.
+func NewScans(r *Registry) *Scans {
+	return &Scans{
+		Archives: r.NewCounter("log4jscanner_archives_scanned_total", "Archives scanned."),
+		Findings: r.NewCounter("log4jscanner_findings_total", "Vulnerable JARs found, by severity.", "severity"),
+		Errors:   r.NewCounter("log4jscanner_errors_total", "Archives that couldn't be scanned, by kind.", "kind"),
+		Latency:  r.NewHistogram("log4jscanner_scan_duration_seconds", "Time taken to scan an archive."),
+	}
+}
+
+// Record records the scan of an archive that took d, which reported r or
+// failed with err. r is nil for archives that aren't JARs.
+func (s *Scans) Record(d time.Duration, r *jar.Report, err error) {
+	s.Latency.Observe(d.Seconds())
+	if err != nil {
+		s.RecordError(err)
+		return
+	}
+	s.Archives.Inc()
+	if r != nil && r.Vulnerable {
+		s.Findings.Inc(r.Severity().String())
+	}
+}
+
+// RecordError records an archive that couldn't be scanned, when the time
+// its scan took isn't known.
+func (s *Scans) RecordError(err error) {
+	s.Errors.Inc(errorKind(err))
+}
+
+// errorKind classifies a scan error for the Errors counter.
+func errorKind(err error) string {
+	var (
+		te *jar.TimeoutError
+		tr *jar.TruncatedError
+	)
+	switch {
+	case errors.As(err, &te):
+		return "timeout"
+	case errors.Is(err, jar.ErrZipBomb):
+		return "zip_bomb"
+	case errors.As(err, &tr):
+		return "truncated"
+	}
+	return "other"
+}
@@ -0,0 +1,409 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netfs keeps a scan responsive when a network filesystem, such as an
+// NFS or SMB share, stops responding.
+//
+// Operations on a hung mount block in the kernel and can't be cancelled, so
+// Mounts runs the operations on paths within network mounts in a separate
+// goroutine and stops waiting once they time out. Timeouts and transient
+// errors are retried with exponential backoff. A mount whose operations keep
+// timing out is marked stalled, and later operations on it fail immediately
+// with ErrStalled, so a hung fileserver costs a bounded amount of time rather
+// than hanging the scan. Operations on other filesystems run directly.
+package netfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrStalled is returned for operations on a mount that stopped responding.
+var ErrStalled = errors.New("network filesystem stalled")
+
+// Defaults of Mounts.
+const (
+	DefaultTimeout = 30 * time.Second
+	DefaultRetries = 2
+	DefaultBackoff = time.Second
+)
+
+// Mount is a network filesystem mounted on the host.
+type Mount struct {
+	// Path is the mount point, or the root of a share or network drive.
+	Path string
+	// Kind is the type of the filesystem, such as "nfs4" or "cifs".
+	Kind string
+}
+
+// Mounts runs filesystem operations with timeouts on network mounts. It's
+// safe for concurrent use.
+type Mounts struct {
+	// Timeout is how long an operation may take before it's abandoned.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// Retries is how many times an operation that timed out or failed with
+	// a transient error, such as EIO, is retried before failing.
+	Retries int
+	// Backoff is the delay before the first retry, doubled for each of the
+	// following ones. Defaults to DefaultBackoff.
+	Backoff time.Duration
+	// OnStall, if provided, is called once for each mount that stalls.
+	OnStall func(m Mount)
+
+	mu sync.Mutex
+	// mounts is ordered by decreasing path length, so the first match of a
+	// path is its innermost mount.
+	mounts  []Mount
+	stalled map[string]bool
+}
+
+// NewMounts returns Mounts tracking the given network mounts.
+func NewMounts(mounts []Mount) *Mounts {
+	m := &Mounts{
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+		stalled: map[string]bool{},
+	}
+	for _, mt := range mounts {
+		mt.Path = filepath.Clean(mt.Path)
+		m.mounts = append(m.mounts, mt)
+	}
+	sort.SliceStable(m.mounts, func(i, j int) bool { return len(m.mounts[i].Path) > len(m.mounts[j].Path) })
+	return m
+}
+
+// Mounts returns the tracked mounts.
+func (m *Mounts) Mounts() []Mount {
+	if m == nil {
+		return nil
+	}
+	return append([]Mount(nil), m.mounts...)
+}
+
+// Lookup returns the network mount holding path, if any.
+func (m *Mounts) Lookup(path string) (Mount, bool) {
+	if m == nil {
+		return Mount{}, false
+	}
+	path = filepath.Clean(path)
+	for _, mt := range m.mounts {
+		if within(path, mt.Path) {
+			return mt, true
+		}
+	}
+	return Mount{}, false
+}
+
+// within reports if path is dir or within it.
+func within(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
+
+// Stalled reports if path is within a mount that stalled.
+func (m *Mounts) Stalled(path string) bool {
+	mt, ok := m.Lookup(path)
+	if !ok {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stalled[mt.Path]
+}
+
+// Stalls returns the mounts that stalled.
+func (m *Mounts) Stalls() []Mount {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stalls []Mount
+	for _, mt := range m.mounts {
+		if m.stalled[mt.Path] {
+			stalls = append(stalls, mt)
+		}
+	}
+	return stalls
+}
+
+func (m *Mounts) stall(mt Mount) {
+	m.mu.Lock()
+	first := !m.stalled[mt.Path]
+	m.stalled[mt.Path] = true
+	m.mu.Unlock()
+	if first && m.OnStall != nil {
+		m.OnStall(mt)
+	}
+}
+
+// Do runs an operation on path, returning its result. If path is within a
+// network mount, the operation is abandoned once it times out, and retried as
+// configured. An abandoned operation may still complete later, concurrently
+// with a retry, so op must only return results and not write to shared
+// variables.
+func (m *Mounts) Do(path string, op func() (interface{}, error)) (interface{}, error) {
+	retries := 0
+	if m != nil {
+		retries = m.Retries
+	}
+	return m.do(path, retries, op)
+}
+
+func (m *Mounts) do(path string, retries int, op func() (interface{}, error)) (interface{}, error) {
+	mt, ok := m.Lookup(path)
+	if !ok {
+		return op()
+	}
+	backoff := m.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		if m.Stalled(path) {
+			return nil, ErrStalled
+		}
+		v, err, timedOut := m.call(op)
+		if err == nil || !(timedOut || transient(err)) {
+			return v, err
+		}
+		if attempt >= retries {
+			if timedOut {
+				m.stall(mt)
+				return nil, ErrStalled
+			}
+			return v, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+type result struct {
+	v   interface{}
+	err error
+}
+
+// call runs op, returning once it completes or times out.
+func (m *Mounts) call(op func() (interface{}, error)) (v interface{}, err error, timedOut bool) {
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := op()
+		done <- result{v, err}
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case r := <-done:
+		return r.v, r.err, false
+	case <-t.C:
+		return nil, fmt.Errorf("timed out after %v", timeout), true
+	}
+}
+
+// transient reports if an error may succeed when retried.
+func transient(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EIO, syscall.ETIMEDOUT, syscall.EAGAIN, syscall.EINTR} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// FS returns the filesystem of dir, like os.DirFS, running the operations
+// on files within network mounts through Do. It can be used as the FS of a
+// jar.Walker.
+func (m *Mounts) FS(dir string) fs.FS {
+	return &dirFS{m: m, fsys: os.DirFS(dir), dir: dir}
+}
+
+type dirFS struct {
+	m    *Mounts
+	fsys fs.FS
+	dir  string
+}
+
+func (d *dirFS) path(name string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(name))
+}
+
+func (d *dirFS) Open(name string) (fs.File, error) {
+	p := d.path(name)
+	if _, ok := d.m.Lookup(p); !ok {
+		return d.fsys.Open(name)
+	}
+	v, err := d.m.Do(p, func() (interface{}, error) { return d.fsys.Open(name) })
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{m: d.m, f: v.(fs.File), path: p}, nil
+}
+
+func (d *dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	v, err := d.m.Do(d.path(name), func() (interface{}, error) { return fs.ReadDir(d.fsys, name) })
+	entries, _ := v.([]fs.DirEntry)
+	return entries, err
+}
+
+func (d *dirFS) Stat(name string) (fs.FileInfo, error) {
+	v, err := d.m.Do(d.path(name), func() (interface{}, error) { return fs.Stat(d.fsys, name) })
+	if err != nil {
+		return nil, err
+	}
+	return v.(fs.FileInfo), nil
+}
+
+// file is a file within a network mount.
+type file struct {
+	m    *Mounts
+	f    fs.File
+	path string
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	v, err := f.m.Do(f.path, func() (interface{}, error) { return f.f.Stat() })
+	if err != nil {
+		return nil, err
+	}
+	return v.(fs.FileInfo), nil
+}
+
+// read is the result of a read into a buffer of its own, since an abandoned
+// read could otherwise write to the caller's buffer after returning.
+type read struct {
+	buf []byte
+	err error
+}
+
+// read runs a read through Do. Reads that return data, or io.EOF, hold the
+// read's error in the result rather than failing, so they aren't retried.
+func (f *file) read(p []byte, retries int, fn func(buf []byte) (int, error)) (int, error) {
+	v, err := f.m.do(f.path, retries, func() (interface{}, error) {
+		buf := make([]byte, len(p))
+		n, err := fn(buf)
+		if err != nil && err != io.EOF && n == 0 {
+			return nil, err
+		}
+		return read{buf[:n], err}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	r := v.(read)
+	return copy(p, r.buf), r.err
+}
+
+// Read isn't retried, since a read that was abandoned may still move the
+// offset of the file. ReadAt is.
+func (f *file) Read(p []byte) (int, error) {
+	return f.read(p, 0, f.f.Read)
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	ra, ok := f.f.(io.ReaderAt)
+	if !ok {
+		return 0, fmt.Errorf("file doesn't implement reader at: %T", f.f)
+	}
+	return f.read(p, f.m.Retries, func(buf []byte) (int, error) { return ra.ReadAt(buf, off) })
+}
+
+// dirEntries is the result of reading a directory.
+type dirEntries struct {
+	entries []fs.DirEntry
+	err     error
+}
+
+func (f *file) ReadDir(count int) ([]fs.DirEntry, error) {
+	rd, ok := f.f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: errors.New("not implemented")}
+	}
+	// Like Read, reading a directory moves its offset and isn't retried.
+	v, err := f.m.do(f.path, 0, func() (interface{}, error) {
+		entries, err := rd.ReadDir(count)
+		if err != nil && err != io.EOF && len(entries) == 0 {
+			return nil, err
+		}
+		return dirEntries{entries, err}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d := v.(dirEntries)
+	return d.entries, d.err
+}
+
+func (f *file) Close() error {
+	_, err := f.m.do(f.path, 0, func() (interface{}, error) { return nil, f.f.Close() })
+	return err
+}
+
+// networkTypes are the filesystem types of /proc/self/mounts served over the
+// network.
+var networkTypes = map[string]bool{
+	"9p":             true,
+	"afs":            true,
+	"ceph":           true,
+	"cifs":           true,
+	"davfs":          true,
+	"fuse.davfs2":    true,
+	"fuse.glusterfs": true,
+	"fuse.sshfs":     true,
+	"glusterfs":      true,
+	"lustre":         true,
+	"ncpfs":          true,
+	"nfs":            true,
+	"nfs4":           true,
+	"smb3":           true,
+	"smbfs":          true,
+}
+
+// parseMounts returns the network mounts listed in the format of
+// /proc/self/mounts.
+func parseMounts(r io.Reader) ([]Mount, error) {
+	// Whitespace and backslashes in mount points are octal escaped.
+	unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	var mounts []Mount
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 3 || !networkTypes[fields[2]] {
+			continue
+		}
+		mounts = append(mounts, Mount{Path: unescape.Replace(fields[1]), Kind: fields[2]})
+	}
+	return mounts, s.Err()
+}
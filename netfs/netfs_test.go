@@ -0,0 +1,161 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMounts(t *testing.T) {
+	const mounts = `sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sda1 / ext4 rw,relatime 0 0
+fs1:/export/apps /mnt/apps nfs4 rw,relatime,vers=4.2 0 0
+//fs2/share /mnt/my\040share cifs rw,relatime 0 0
+user@host:/ /home/user/remote fuse.sshfs rw 0 0
+`
+	got, err := parseMounts(strings.NewReader(mounts))
+	if err != nil {
+		t.Fatalf("parseMounts() failed: %v", err)
+	}
+	want := []Mount{
+		{Path: "/mnt/apps", Kind: "nfs4"},
+		{Path: "/mnt/my share", Kind: "cifs"},
+		{Path: "/home/user/remote", Kind: "fuse.sshfs"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseMounts() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestDo(t *testing.T) {
+	dir := t.TempDir()
+	share := filepath.Join(dir, "share")
+	var stalls []Mount
+	m := NewMounts([]Mount{{Path: share, Kind: "nfs"}})
+	m.Timeout = 10 * time.Millisecond
+	m.Backoff = time.Millisecond
+	m.OnStall = func(mt Mount) { stalls = append(stalls, mt) }
+
+	// Operations outside of network mounts run without a timeout.
+	v, err := m.Do(filepath.Join(dir, "local"), func() (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "ok", nil
+	})
+	if err != nil || v != "ok" {
+		t.Errorf("Do() of a slow local operation = %v, %v, want ok", v, err)
+	}
+
+	// Transient errors are retried.
+	attempts := 0
+	v, err = m.Do(filepath.Join(share, "a"), func() (interface{}, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, &fs.PathError{Op: "read", Path: "a", Err: syscall.EIO}
+		}
+		return "ok", nil
+	})
+	if err != nil || v != "ok" || attempts != 3 {
+		t.Errorf("Do() of a transient failure = %v, %v after %d attempts, want ok after 3", v, err, attempts)
+	}
+	// Others aren't.
+	attempts = 0
+	if _, err := m.Do(filepath.Join(share, "a"), func() (interface{}, error) {
+		attempts++
+		return nil, fs.ErrNotExist
+	}); !errors.Is(err, fs.ErrNotExist) || attempts != 1 {
+		t.Errorf("Do() of a missing file = %v after %d attempts, want fs.ErrNotExist after 1", err, attempts)
+	}
+
+	// A hung operation stalls the mount once its retries time out.
+	hung := make(chan struct{})
+	defer close(hung)
+	if _, err := m.Do(filepath.Join(share, "a"), func() (interface{}, error) {
+		<-hung
+		return nil, nil
+	}); err != ErrStalled {
+		t.Errorf("Do() of a hung operation returned %v, want ErrStalled", err)
+	}
+	if !m.Stalled(filepath.Join(share, "b", "c")) || m.Stalled(filepath.Join(dir, "local")) {
+		t.Errorf("Stalled() doesn't only report paths within the stalled mount")
+	}
+	called := false
+	if _, err := m.Do(filepath.Join(share, "b"), func() (interface{}, error) {
+		called = true
+		return nil, nil
+	}); err != ErrStalled || called {
+		t.Errorf("Do() on a stalled mount = %v, called %v, want ErrStalled without calling", err, called)
+	}
+	want := []Mount{{Path: share, Kind: "nfs"}}
+	if diff := cmp.Diff(want, stalls); diff != "" {
+		t.Errorf("OnStall calls diff (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff(want, m.Stalls()); diff != "" {
+		t.Errorf("Stalls() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "share", "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "share", "lib", "a.jar"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewMounts([]Mount{{Path: filepath.Join(dir, "share"), Kind: "nfs"}})
+	fsys := m.FS(dir)
+
+	var paths []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking: %v", err)
+	}
+	if diff := cmp.Diff([]string{".", "share", "share/lib", "share/lib/a.jar"}, paths); diff != "" {
+		t.Errorf("walking returned diff (-want, +got): %s", diff)
+	}
+
+	f, err := fsys.Open("share/lib/a.jar")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer f.Close()
+	if _, ok := f.(*file); !ok {
+		t.Errorf("Open() within a network mount returned %T, want *file", f)
+	}
+	buf := make([]byte, 4)
+	if n, err := f.(io.ReaderAt).ReadAt(buf, 8); n != 2 || err != io.EOF || string(buf[:n]) != "89" {
+		t.Errorf("ReadAt() at the end = %d, %v, %q, want 2, io.EOF, \"89\"", n, err, buf[:n])
+	}
+	b, err := io.ReadAll(f)
+	if err != nil || string(b) != "0123456789" {
+		t.Errorf("reading = %q, %v, want the whole file", b, err)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfs
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// Detect returns the network shares and mapped network drives holding the
+// scanned roots.
+func Detect(roots []string) ([]Mount, error) {
+	var mounts []Mount
+	seen := map[string]bool{}
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		vol := filepath.VolumeName(abs)
+		if vol == "" || seen[vol] {
+			continue
+		}
+		seen[vol] = true
+		if strings.HasPrefix(vol, `\\`) {
+			mounts = append(mounts, Mount{Path: vol + `\`, Kind: "smb"})
+			continue
+		}
+		p, err := windows.UTF16PtrFromString(vol + `\`)
+		if err != nil {
+			continue
+		}
+		if windows.GetDriveType(p) == windows.DRIVE_REMOTE {
+			mounts = append(mounts, Mount{Path: vol + `\`, Kind: "network drive"})
+		}
+	}
+	return mounts, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"log4jscanner/throttle"
+)
+
+// pauseHelp describes how to pause and resume a scan on this platform.
+const pauseHelp = `Send SIGUSR1 to pause a scan and SIGUSR2 to resume it.`
+
+// handlePause pauses the throttle on SIGUSR1 and resumes it on SIGUSR2.
+func handlePause(t *throttle.Throttle) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range c {
+			if sig == syscall.SIGUSR1 {
+				log.Printf("Pausing scan")
+				t.Pause()
+			} else {
+				log.Printf("Resuming scan")
+				t.Resume()
+			}
+		}
+	}()
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+
+	"log4jscanner/throttle"
+)
+
+// pauseHelp describes how to pause and resume a scan on this platform.
+const pauseHelp = `Write "pause" or "resume" to the named pipe
+\\.\pipe\log4jscanner-PID to pause or resume a scan.`
+
+// handlePause serves a named pipe accepting "pause" and "resume" commands,
+// since Windows has no equivalent of SIGUSR1 and SIGUSR2.
+func handlePause(t *throttle.Throttle) {
+	name := fmt.Sprintf(`\\.\pipe\log4jscanner-%d`, os.Getpid())
+	go func() {
+		for {
+			if err := servePausePipe(name, t); err != nil {
+				log.Printf("Error: serving %s: %v", name, err)
+				return
+			}
+		}
+	}()
+}
+
+// servePausePipe handles the commands of a single client of the pipe.
+func servePausePipe(name string, t *throttle.Throttle) error {
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateNamedPipe(p,
+		windows.PIPE_ACCESS_INBOUND,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT,
+		1, 0, 512, 0, nil)
+	if err != nil {
+		return fmt.Errorf("creating pipe: %v", err)
+	}
+	f := os.NewFile(uintptr(h), name)
+	defer f.Close()
+	if err := windows.ConnectNamedPipe(h, nil); err != nil && err != windows.ERROR_PIPE_CONNECTED {
+		return fmt.Errorf("waiting for client: %v", err)
+	}
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		switch cmd := strings.ToLower(strings.TrimSpace(s.Text())); cmd {
+		case "pause":
+			log.Printf("Pausing scan")
+			t.Pause()
+		case "resume":
+			log.Printf("Resuming scan")
+			t.Resume()
+		case "":
+		default:
+			log.Printf("Error: unknown command %q on %s, expected pause or resume", cmd, name)
+		}
+	}
+	// Reading fails with ERROR_BROKEN_PIPE once the client disconnects.
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"log4jscanner/readonly"
+	"log4jscanner/results"
+)
+
+// planSink writes the remediation plan of the findings to a file, or stdout,
+// once the scan completes.
+type planSink struct {
+	*results.Plan
+	f *os.File
+}
+
+// newPlanSink returns a sink writing the remediation plan to path, or stdout
+// if "-".
+func newPlanSink(path string) (*planSink, error) {
+	if path == "-" {
+		return &planSink{Plan: results.NewPlan(os.Stdout)}, nil
+	}
+	if err := readonly.Check("writing remediation plan"); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating remediation plan: %v", err)
+	}
+	return &planSink{Plan: results.NewPlan(f), f: f}, nil
+}
+
+// Close writes the plan, and closes its file.
+func (p *planSink) Close() error {
+	err := p.Plan.Close()
+	if p.f == nil {
+		return err
+	}
+	if cerr := p.f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("writing remediation plan: %v", cerr)
+	}
+	return err
+}
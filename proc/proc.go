@@ -0,0 +1,250 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proc finds the archives loaded by running Java processes, from the
+// memory mappings and open files Linux lists under /proc. Scanning them
+// catches vulnerable code a JVM has loaded even if the file on disk was since
+// replaced or deleted, which a scan of the filesystem misses.
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// deletedSuffix is appended by the kernel to the paths of files that were
+// deleted or replaced since they were opened.
+const deletedSuffix = " (deleted)"
+
+// archiveExts are the extensions of the archives a JVM loads classes from.
+var archiveExts = map[string]bool{
+	".jar": true,
+	".war": true,
+	".ear": true,
+	".zip": true,
+}
+
+// Process is a running JVM.
+type Process struct {
+	PID int
+	// Cmdline holds the command line arguments of the process.
+	Cmdline []string
+	// Archives lists the archives the process has mapped or open, sorted by
+	// path.
+	Archives []Archive
+	// Err is set if the mappings and open files of the process couldn't
+	// be read, such as for the processes of other users when not running
+	// as root. The process is only known to be a JVM from its command line
+	// then, and Archives is empty.
+	Err error
+}
+
+// Archive is a file with an archive extension that a process has mapped or
+// open.
+type Archive struct {
+	// Path is the path the process opened the file with, within the mount
+	// namespace of the process.
+	Path string
+	// Deleted is set if the file was deleted or replaced since the process
+	// opened it.
+	Deleted bool
+	// Open is the path to read the file the process has from, such as
+	// /proc/1234/fd/5. It refers to the process's copy even if the file was
+	// deleted or the process runs in a container, as long as the process
+	// runs.
+	Open string
+}
+
+// mapping is a file mapped into the memory of a process.
+type mapping struct {
+	// addr is the address range of the mapping, such as
+	// "7f2c1e000000-7f2c1e021000".
+	addr    string
+	path    string
+	deleted bool
+}
+
+// parseMaps returns the files mapped by a process, listed in the format of
+// /proc/PID/maps. Anonymous mappings are skipped.
+func parseMaps(r io.Reader) ([]mapping, error) {
+	var maps []mapping
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		// The fields are the address range, permissions, offset,
+		// device, inode, and path, which may contain spaces.
+		rest := s.Text()
+		var fields []string
+		for i := 0; i < 5; i++ {
+			rest = strings.TrimLeft(rest, " ")
+			j := strings.IndexByte(rest, ' ')
+			if j < 0 {
+				fields, rest = append(fields, rest), ""
+				break
+			}
+			fields, rest = append(fields, rest[:j]), rest[j:]
+		}
+		p := strings.TrimLeft(rest, " ")
+		if len(fields) < 5 || !strings.HasPrefix(p, "/") {
+			continue
+		}
+		m := mapping{addr: fields[0], path: p}
+		if strings.HasSuffix(p, deletedSuffix) {
+			m.path, m.deleted = strings.TrimSuffix(p, deletedSuffix), true
+		}
+		maps = append(maps, m)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading mappings: %v", err)
+	}
+	return maps, nil
+}
+
+// isJVM reports if a process runs a JVM, from the files it maps or, if they
+// can't be read, its command line.
+func isJVM(maps []mapping, cmdline []string) bool {
+	for _, m := range maps {
+		if path.Base(m.path) == "libjvm.so" {
+			return true
+		}
+	}
+	return maps == nil && len(cmdline) > 0 && path.Base(cmdline[0]) == "java"
+}
+
+// parseCmdline splits the NUL separated arguments of /proc/PID/cmdline.
+func parseCmdline(b []byte) []string {
+	b = bytes.TrimSuffix(b, []byte{0})
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(string(b), "\x00")
+}
+
+// isArchive reports if a path has the extension of an archive a JVM may load.
+func isArchive(p string) bool {
+	return archiveExts[strings.ToLower(path.Ext(p))]
+}
+
+// processes returns the JVMs running according to the proc filesystem
+// mounted at root. Processes that exit while being read are skipped.
+func processes(root string) ([]Process, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("listing processes: %v", err)
+	}
+	var procs []Process
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		p, ok := readProcess(root, pid)
+		if ok {
+			procs = append(procs, p)
+		}
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+	return procs, nil
+}
+
+// readProcess reads a process from the proc filesystem at root, reporting
+// false if it isn't a JVM or has exited.
+func readProcess(root string, pid int) (Process, bool) {
+	dir := filepath.Join(root, strconv.Itoa(pid))
+	b, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return Process{}, false
+	}
+	p := Process{PID: pid, Cmdline: parseCmdline(b)}
+	f, err := os.Open(filepath.Join(dir, "maps"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Process{}, false
+		}
+		p.Err = fmt.Errorf("reading mappings: %v", err)
+		return p, isJVM(nil, p.Cmdline)
+	}
+	maps, err := parseMaps(f)
+	f.Close()
+	if err != nil {
+		p.Err = err
+		return p, isJVM(nil, p.Cmdline)
+	}
+	if maps == nil {
+		// Kernel threads and zombies map nothing.
+		maps = []mapping{}
+	}
+	if !isJVM(maps, p.Cmdline) {
+		return Process{}, false
+	}
+
+	// Archives are read through the open file if there's one, then
+	// through the process's view of the filesystem, or the mapping itself
+	// if the file was deleted.
+	type key struct {
+		path    string
+		deleted bool
+	}
+	archives := map[key]Archive{}
+	fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+	if err != nil && !os.IsNotExist(err) {
+		p.Err = fmt.Errorf("listing open files: %v", err)
+	}
+	for _, fd := range fds {
+		open := filepath.Join(dir, "fd", fd.Name())
+		target, err := os.Readlink(open)
+		if err != nil || !strings.HasPrefix(target, "/") {
+			continue
+		}
+		a := Archive{Path: target, Open: open}
+		if strings.HasSuffix(target, deletedSuffix) {
+			a.Path, a.Deleted = strings.TrimSuffix(target, deletedSuffix), true
+		}
+		if !isArchive(a.Path) {
+			continue
+		}
+		if _, ok := archives[key{a.Path, a.Deleted}]; !ok {
+			archives[key{a.Path, a.Deleted}] = a
+		}
+	}
+	for _, m := range maps {
+		k := key{m.path, m.deleted}
+		if _, ok := archives[k]; ok || !isArchive(m.path) {
+			continue
+		}
+		a := Archive{Path: m.path, Deleted: m.deleted, Open: filepath.Join(dir, "root", filepath.FromSlash(m.path))}
+		if m.deleted {
+			a.Open = filepath.Join(dir, "map_files", m.addr)
+		}
+		archives[k] = a
+	}
+	for _, a := range archives {
+		p.Archives = append(p.Archives, a)
+	}
+	sort.Slice(p.Archives, func(i, j int) bool {
+		ai, aj := p.Archives[i], p.Archives[j]
+		if ai.Path != aj.Path {
+			return ai.Path < aj.Path
+		}
+		return !ai.Deleted && aj.Deleted
+	})
+	return p, true
+}
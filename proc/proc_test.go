@@ -0,0 +1,122 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+func TestParseMaps(t *testing.T) {
+	maps := `55d0c2a00000-55d0c2a01000 r--p 00000000 08:01 1311           /usr/lib/jvm/java-11/bin/java
+7f2c1e000000-7f2c1e021000 r--s 00000000 08:01 2048           /opt/app/lib/log4j-core-2.14.1.jar
+7f2c1e100000-7f2c1e121000 r--s 00000000 08:01 2049           /opt/app/lib/old log4j.jar (deleted)
+7f2c1e200000-7f2c1e221000 rw-p 00000000 00:00 0 
+7ffd5b7e2000-7ffd5b803000 rw-p 00000000 00:00 0              [stack]
+`
+	got, err := parseMaps(strings.NewReader(maps))
+	if err != nil {
+		t.Fatalf("parseMaps() failed: %v", err)
+	}
+	want := []mapping{
+		{addr: "55d0c2a00000-55d0c2a01000", path: "/usr/lib/jvm/java-11/bin/java"},
+		{addr: "7f2c1e000000-7f2c1e021000", path: "/opt/app/lib/log4j-core-2.14.1.jar"},
+		{addr: "7f2c1e100000-7f2c1e121000", path: "/opt/app/lib/old log4j.jar", deleted: true},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(mapping{})); diff != "" {
+		t.Errorf("parseMaps() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestIsJVM(t *testing.T) {
+	tests := []struct {
+		name    string
+		maps    []mapping
+		cmdline []string
+		want    bool
+	}{
+		{"libjvm", []mapping{{path: "/usr/lib/jvm/java-17/lib/server/libjvm.so"}}, []string{"/opt/app/bin/launcher"}, true},
+		{"NoLibjvm", []mapping{{path: "/usr/bin/bash"}}, []string{"java"}, false},
+		{"CmdlineOnly", nil, []string{"/usr/bin/java", "-jar", "app.jar"}, true},
+		{"OtherCmdline", nil, []string{"/usr/bin/python3"}, false},
+	}
+	for _, tc := range tests {
+		if got := isJVM(tc.maps, tc.cmdline); got != tc.want {
+			t.Errorf("isJVM(%s) = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestProcesses(t *testing.T) {
+	root := t.TempDir()
+	write := func(p, content string) {
+		t.Helper()
+		testjar.WriteFile(t, filepath.Join(root, p), []byte(content))
+	}
+	link := func(target, p string) {
+		t.Helper()
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, p); err != nil {
+			t.Skipf("creating symlinks: %v", err)
+		}
+	}
+
+	// A JVM with a JAR open, one replaced since it was opened, and one only
+	// mapped.
+	write("100/cmdline", "/usr/bin/java\x00-jar\x00app.jar\x00")
+	write("100/maps", `7f2c1d000000-7f2c1d021000 r-xp 00000000 08:01 10 /usr/lib/jvm/lib/server/libjvm.so
+7f2c1e000000-7f2c1e021000 r--s 00000000 08:01 11 /opt/app/app.jar
+7f2c1e100000-7f2c1e121000 r--s 00000000 08:01 12 /opt/app/lib/mapped.jar
+7f2c1e200000-7f2c1e221000 r--s 00000000 08:01 13 /opt/app/lib/gone.jar (deleted)
+`)
+	link("/opt/app/app.jar", "100/fd/3")
+	link("/opt/app/lib/log4j-core-2.14.1.jar (deleted)", "100/fd/4")
+	link("/var/log/app.log", "100/fd/5")
+	link("socket:[1234]", "100/fd/6")
+	// A process that isn't a JVM, even if it has a JAR open.
+	write("200/cmdline", "/usr/bin/unzip\x00app.jar\x00")
+	write("200/maps", "55d0c2a00000-55d0c2a01000 r--p 00000000 08:01 14 /usr/bin/unzip\n")
+	link("/opt/app/app.jar", "200/fd/3")
+	// Files that aren't processes.
+	write("uptime", "1.0 1.0\n")
+	write("self/cmdline", "")
+
+	got, err := processes(root)
+	if err != nil {
+		t.Fatalf("processes() failed: %v", err)
+	}
+	dir := filepath.Join(root, "100")
+	want := []Process{{
+		PID:     100,
+		Cmdline: []string{"/usr/bin/java", "-jar", "app.jar"},
+		Archives: []Archive{
+			{Path: "/opt/app/app.jar", Open: filepath.Join(dir, "fd", "3")},
+			{Path: "/opt/app/lib/gone.jar", Deleted: true, Open: filepath.Join(dir, "map_files", "7f2c1e200000-7f2c1e221000")},
+			{Path: "/opt/app/lib/log4j-core-2.14.1.jar", Deleted: true, Open: filepath.Join(dir, "fd", "4")},
+			{Path: "/opt/app/lib/mapped.jar", Open: filepath.Join(dir, "root", "opt", "app", "lib", "mapped.jar")},
+		},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("processes() returned diff (-want, +got): %s", diff)
+	}
+}
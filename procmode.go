@@ -0,0 +1,111 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"log4jscanner/proc"
+)
+
+// jvmArchive is an archive loaded by running JVMs, see --processes.
+type jvmArchive struct {
+	proc.Archive
+	// pids lists the processes that loaded the archive.
+	pids []int
+	// onDisk is set if the file at Path on this host is the one the
+	// processes loaded, so walking a directory holding it finds it.
+	onDisk bool
+	info   os.FileInfo
+}
+
+// jvmArchives maps the archives loaded by running JVMs by the path they're
+// reported under. That's their path if it's the file on this host's disk,
+// otherwise the path is annotated with the process, such as for deleted files
+// or the files of containers.
+type jvmArchives map[string]*jvmArchive
+
+// findJVMArchives collects the archives loaded by running JVMs. Each file is
+// listed once, with every process that loaded it.
+func findJVMArchives() jvmArchives {
+	procs, err := proc.Processes()
+	if err != nil {
+		log.Fatalf("Error: --processes: %v", err)
+	}
+	archives := jvmArchives{}
+	for _, p := range procs {
+		if p.Err != nil {
+			log.Printf("Warning: reading JVM process %d: %v", p.PID, p.Err)
+			continue
+		}
+	next:
+		for _, a := range p.Archives {
+			info, err := os.Stat(a.Open)
+			if err != nil {
+				log.Printf("Warning: reading %s of JVM process %d: %v", a.Path, p.PID, err)
+				continue
+			}
+			for _, ja := range archives {
+				if os.SameFile(ja.info, info) {
+					ja.pids = append(ja.pids, p.PID)
+					continue next
+				}
+			}
+			ja := &jvmArchive{Archive: a, pids: []int{p.PID}, info: info}
+			path := fmt.Sprintf("%s (pid %d)", a.Path, p.PID)
+			if a.Deleted {
+				path = fmt.Sprintf("%s (pid %d, deleted)", a.Path, p.PID)
+			} else if host, err := os.Stat(a.Path); err == nil && os.SameFile(host, info) {
+				ja.onDisk = true
+				path = filepath.Clean(a.Path)
+			}
+			archives[path] = ja
+		}
+	}
+	return archives
+}
+
+// loaded returns the archive reported under path, or nil if no running JVM
+// loaded it.
+func (j jvmArchives) loaded(path string) *jvmArchive {
+	return j[filepath.Clean(path)]
+}
+
+// outside returns the paths of the archives that won't be found by walking
+// the provided directories: those that aren't on this host's disk, or that
+// aren't within any of the directories.
+func (j jvmArchives) outside(dirs []string) []string {
+	var paths []string
+	for p, a := range j {
+		in := false
+		for _, dir := range dirs {
+			rel, err := filepath.Rel(dir, p)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				in = true
+				break
+			}
+		}
+		if !in || !a.onDisk {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profiles hold glob patterns for where application servers keep deployments,
+// the directories they extract archives to, and their shared libraries.
+// Patterns may reference environment variables, and patterns using unset
+// variables are ignored.
+var profiles = map[string][]string{
+	"tomcat": {
+		"$CATALINA_HOME/lib",
+		"$CATALINA_HOME/webapps",
+		"$CATALINA_HOME/work",
+		"$CATALINA_HOME/temp",
+		"$CATALINA_BASE/lib",
+		"$CATALINA_BASE/webapps",
+		"$CATALINA_BASE/work",
+		"$CATALINA_BASE/temp",
+		"/usr/share/tomcat*/lib",
+		"/var/lib/tomcat*/webapps",
+		"/var/lib/tomcat*/work",
+		"/var/cache/tomcat*",
+		"/opt/tomcat*/lib",
+		"/opt/tomcat*/webapps",
+		"/opt/tomcat*/work",
+		"/opt/tomcat*/temp",
+		"/usr/local/tomcat*/lib",
+		"/usr/local/tomcat*/webapps",
+		"/usr/local/tomcat*/work",
+		"/usr/local/tomcat*/temp",
+		`C:\Program Files\Apache Software Foundation\Tomcat*\lib`,
+		`C:\Program Files\Apache Software Foundation\Tomcat*\webapps`,
+		`C:\Program Files\Apache Software Foundation\Tomcat*\work`,
+	},
+	"jetty": {
+		"$JETTY_HOME/lib",
+		"$JETTY_HOME/webapps",
+		"$JETTY_BASE/lib",
+		"$JETTY_BASE/webapps",
+		"$JETTY_BASE/work",
+		"/usr/share/jetty*/lib",
+		"/var/lib/jetty*/webapps",
+		"/opt/jetty*/lib",
+		"/opt/jetty*/webapps",
+		"/opt/jetty*/work",
+		// Jetty extracts WARs to java.io.tmpdir by default.
+		"/tmp/jetty-*",
+		"/var/tmp/jetty-*",
+	},
+	"weblogic": {
+		"$MW_HOME/wlserver/server/lib",
+		"$MW_HOME/oracle_common/modules",
+		"$DOMAIN_HOME/lib",
+		"$DOMAIN_HOME/autodeploy",
+		"$DOMAIN_HOME/servers/*/tmp",
+		"$DOMAIN_HOME/servers/*/stage",
+		"/u01/oracle/wlserver/server/lib",
+		"/u01/oracle/oracle_common/modules",
+		"/u01/oracle/user_projects/domains/*/lib",
+		"/u01/oracle/user_projects/domains/*/autodeploy",
+		"/u01/oracle/user_projects/domains/*/servers/*/tmp",
+		"/u01/oracle/user_projects/domains/*/servers/*/stage",
+		"/opt/oracle/middleware/wlserver/server/lib",
+		"/opt/oracle/middleware/user_projects/domains/*/servers/*/tmp",
+		"/opt/oracle/middleware/user_projects/domains/*/servers/*/stage",
+	},
+	"websphere": {
+		"$WAS_HOME/lib",
+		"$WAS_HOME/plugins",
+		"$WAS_HOME/profiles/*/installedApps",
+		"$WAS_HOME/profiles/*/temp",
+		"$WAS_HOME/profiles/*/wstemp",
+		"/opt/IBM/WebSphere/AppServer/lib",
+		"/opt/IBM/WebSphere/AppServer/plugins",
+		"/opt/IBM/WebSphere/AppServer/profiles/*/installedApps",
+		"/opt/IBM/WebSphere/AppServer/profiles/*/temp",
+		"/opt/IBM/WebSphere/AppServer/profiles/*/wstemp",
+		// WebSphere Liberty.
+		"/opt/ibm/wlp/lib",
+		"/opt/ibm/wlp/usr/servers/*/apps",
+		"/opt/ibm/wlp/usr/servers/*/dropins",
+		"/opt/ibm/wlp/usr/shared/resources",
+		"/opt/ibm/wlp/usr/servers/*/workarea",
+	},
+}
+
+// profileNames returns the supported profiles.
+func profileNames() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileDirs expands a profile into the directories that exist on this host.
+func profileDirs(name string) ([]string, error) {
+	patterns, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, expected one of: %s", name, strings.Join(profileNames(), ", "))
+	}
+	var dirs []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		unset := false
+		pattern = os.Expand(pattern, func(key string) string {
+			v := os.Getenv(key)
+			if v == "" {
+				unset = true
+			}
+			return v
+		})
+		if unset {
+			continue
+		}
+		matches, err := filepath.Glob(filepath.FromSlash(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		for _, m := range matches {
+			m = filepath.Clean(m)
+			if seen[m] {
+				continue
+			}
+			if info, err := os.Stat(m); err != nil || !info.IsDir() {
+				continue
+			}
+			seen[m] = true
+			dirs = append(dirs, m)
+		}
+	}
+	return dirs, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// progressInterval is how often --progress logs the progress of the scan.
+const progressInterval = 5 * time.Second
+
+// progressLogger logs the progress of the walks for --progress, at most every
+// progressInterval. It's passed to jar.Walker's HandleProgress, which is
+// called from one goroutine at a time.
+type progressLogger struct {
+	last time.Time
+}
+
+func (p *progressLogger) handle(s jar.WalkStats) {
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		logProgress(s)
+	}
+}
+
+// logProgress logs the statistics of the walks so far.
+func logProgress(s jar.WalkStats) {
+	log.Printf("Progress: walked %d files in %d directories, scanned %d archives (%s), %d cached, %d findings, %d errors in %v",
+		s.Files, s.Dirs, s.Archives, formatBytes(s.Bytes), s.Cached, s.Findings, s.Errors, s.Elapsed.Round(time.Second))
+}
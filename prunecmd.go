@@ -0,0 +1,96 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"log4jscanner/store"
+)
+
+// compactFraction is the fraction of free pages at which pruning also
+// compacts the store. Rebuilding is proportional to the size of the
+// database, so it isn't worth it for a few pruned runs.
+const compactFraction = 0.25
+
+func pruneUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner prune [flag]
+
+Removes runs older than a retention period from a results store written by
+--store, along with their findings and skipped paths, and the --dir-cache and
+--file-cache entries of directories and files that weren't scanned since. The
+database is then compacted to return the space to the filesystem.
+
+Flags:
+
+    --store   SQLite database written by --store, --dir-cache, or
+              --file-cache (required).
+    --retain  Age of the runs to keep, such as 90d, 2w, or 36h (required).
+
+`)
+}
+
+func pruneCmd(args []string) {
+	var (
+		storePath string
+		retain    time.Duration
+	)
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	flags.StringVar(&storePath, "store", "", "")
+	flags.Func("retain", "", func(s string) (err error) {
+		retain, err = store.ParseAge(s)
+		return err
+	})
+	flags.Usage = pruneUsage
+	flags.Parse(args)
+	if storePath == "" || retain == 0 || flags.NArg() != 0 {
+		pruneUsage()
+		os.Exit(1)
+	}
+
+	// Don't create a database if the path is wrong.
+	requireStore(map[string]string{"store": storePath})
+	if _, err := os.Stat(storePath); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	s, err := store.Open(storePath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer s.Close()
+	p, err := prune(s, retain, 0)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	fmt.Printf("Pruned %d runs, %d findings, %d skipped paths, %d cached directories, and %d cached files\n",
+		p.Runs, p.Findings, p.Skips, p.Dirs, p.Files)
+}
+
+// prune removes the runs of a store older than retain, then compacts it if
+// at least a fraction of its pages are free.
+func prune(s *store.Store, retain time.Duration, fraction float64) (store.Pruned, error) {
+	p, err := s.Prune(time.Now().Add(-retain))
+	if err != nil {
+		return p, err
+	}
+	if _, err := s.Compact(fraction); err != nil {
+		return p, err
+	}
+	return p, nil
+}
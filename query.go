@@ -0,0 +1,187 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/store"
+)
+
+func queryUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner query [flag]
+
+Lists the vulnerable paths recorded in a results store written by --store,
+one entry per host and path with the first and last time it was seen.
+
+Flags:
+
+    --store              SQLite database written by --store (required).
+    --host               Only list paths on this host.
+    --path               Only list paths matching a glob pattern (e.g.
+                         '/opt/*'). "*" also matches "/".
+    --cve                Only list paths vulnerable to a CVE (e.g.
+                         CVE-2021-44228).
+    --severity           Only list paths of at least this severity. One of
+                         critical, high, medium, or low.
+    --first-seen-after   Only list paths first seen after a date (YYYY-MM-DD
+                         or RFC 3339).
+    --first-seen-before  Only list paths first seen before a date.
+    --last-seen-after    Only list paths last seen after a date.
+    --last-seen-before   Only list paths last seen before a date.
+    --status             Only list paths with a remediation status set by
+                         "annotate". Paths without one are open.
+    --owner              Only list paths owned by someone, set by "annotate".
+    --format             Output format. One of json, csv, or table (default
+                         table).
+
+`)
+}
+
+func query(args []string) {
+	var (
+		storePath string
+		format    string
+		f         store.Filter
+	)
+	dateVar := func(t *time.Time) func(string) error {
+		return func(s string) (err error) {
+			*t, err = store.ParseTime(s)
+			return err
+		}
+	}
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	flags.StringVar(&storePath, "store", "", "")
+	flags.StringVar(&f.Host, "host", "", "")
+	flags.StringVar(&f.PathGlob, "path", "", "")
+	flags.StringVar(&f.CVE, "cve", "", "")
+	flags.Func("severity", "", func(s string) (err error) {
+		f.MinSeverity, err = jar.ParseSeverity(s)
+		return err
+	})
+	flags.Func("first-seen-after", "", dateVar(&f.FirstSeenAfter))
+	flags.Func("first-seen-before", "", dateVar(&f.FirstSeenBefore))
+	flags.Func("last-seen-after", "", dateVar(&f.LastSeenAfter))
+	flags.Func("last-seen-before", "", dateVar(&f.LastSeenBefore))
+	flags.StringVar(&f.Status, "status", "", "")
+	flags.StringVar(&f.Owner, "owner", "", "")
+	flags.StringVar(&format, "format", "table", "")
+	flags.Usage = queryUsage
+	flags.Parse(args)
+	if storePath == "" || flags.NArg() != 0 {
+		queryUsage()
+		os.Exit(1)
+	}
+	write, ok := queryFormats[format]
+	if !ok {
+		log.Fatalf("Error: unknown format %q, expected json, csv, or table", format)
+	}
+	f.CVE = strings.ToUpper(f.CVE)
+	if err := store.CheckStatus(f.Status); err != nil {
+		log.Fatalf("Error: --status: %v", err)
+	}
+
+	// Don't create a database if the path is wrong.
+	requireStore(map[string]string{"store": storePath})
+	if _, err := os.Stat(storePath); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	s, err := store.Open(storePath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer s.Close()
+	entries, err := s.Inventory(f)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := write(os.Stdout, entries); err != nil {
+		log.Fatalf("Error: writing results: %v", err)
+	}
+}
+
+// queryFormats holds the output formats of the query command.
+var queryFormats = map[string]func(w io.Writer, entries []store.Entry) error{
+	"csv":   writeEntriesCSV,
+	"json":  writeEntriesJSON,
+	"table": writeEntriesTable,
+}
+
+func writeEntriesJSON(w io.Writer, entries []store.Entry) error {
+	if entries == nil {
+		entries = []store.Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func writeEntriesCSV(w io.Writer, entries []store.Entry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"host", "path", "cves", "severity", "main_class", "version", "first_seen", "last_seen", "runs",
+		"status", "owner", "ticket", "note"})
+	for _, e := range entries {
+		a := e.Annotation
+		if a == nil {
+			a = &store.Annotation{}
+		}
+		cw.Write([]string{
+			e.Host,
+			e.Path,
+			strings.Join(e.CVEs, " "),
+			e.Severity.String(),
+			e.MainClass,
+			e.Version,
+			e.FirstSeen.Format(time.RFC3339),
+			e.LastSeen.Format(time.RFC3339),
+			strconv.Itoa(e.Runs),
+			e.Status(),
+			a.Owner,
+			a.Ticket,
+			a.Note,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeEntriesTable(w io.Writer, entries []store.Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tPATH\tCVES\tSEVERITY\tFIRST SEEN\tLAST SEEN\tSTATUS\tOWNER")
+	for _, e := range entries {
+		cves := strings.Join(e.CVEs, ",")
+		if cves == "" {
+			cves = "-"
+		}
+		owner := "-"
+		if e.Annotation != nil && e.Annotation.Owner != "" {
+			owner = e.Annotation.Owner
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Host, e.Path, cves, e.Severity,
+			e.FirstSeen.Format("2006-01-02 15:04"), e.LastSeen.Format("2006-01-02 15:04"), e.Status(), owner)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,394 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package queue distributes scans across multiple processes or hosts.
+//
+// A Coordinator holds a queue of paths to scan and serves them over HTTP.
+// Workers lease paths from the coordinator, scan them, and report the results
+// back. Leases that aren't reported within a timeout are handed to another
+// worker, so a crashed worker doesn't lose work.
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Task is a single path to be scanned by a worker.
+type Task struct {
+	ID   int64  `json:"id"`
+	Path string `json:"path"`
+}
+
+// Result is reported by a worker after scanning a Task.
+type Result struct {
+	TaskID     int64  `json:"taskId"`
+	Path       string `json:"path"`
+	Worker     string `json:"worker,omitempty"`
+	Vulnerable bool   `json:"vulnerable"`
+	MainClass  string `json:"mainClass,omitempty"`
+	Version    string `json:"version,omitempty"`
+	// BundleSymbolicName and BundleVersion identify OSGi bundles.
+	BundleSymbolicName string `json:"bundleSymbolicName,omitempty"`
+	BundleVersion      string `json:"bundleVersion,omitempty"`
+	// Error is set if the path couldn't be scanned.
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	leasePath  = "/v1/lease"
+	resultPath = "/v1/result"
+
+	defaultLeaseTimeout = 10 * time.Minute
+	maxBackoff          = time.Minute
+)
+
+// Defaults of Workers.
+const (
+	DefaultRetries = 8
+	DefaultBackoff = time.Second
+)
+
+type lease struct {
+	task    Task
+	expires time.Time
+}
+
+// Coordinator holds the queue of paths to scan. It implements http.Handler,
+// and must be served for workers to connect to it.
+type Coordinator struct {
+	// LeaseTimeout is how long a worker has to report a result before its
+	// task is handed to another worker. Defaults to 10 minutes.
+	LeaseTimeout time.Duration
+	// HandleResult is called for every result reported by a worker. Calls are
+	// serialized.
+	HandleResult func(r Result)
+
+	once    sync.Once
+	mu      sync.Mutex
+	nextID  int64
+	pending []Task
+	leased  map[int64]lease
+	closed  bool
+	done    chan struct{}
+	now     func() time.Time
+}
+
+func (c *Coordinator) init() {
+	c.once.Do(func() {
+		c.leased = map[int64]lease{}
+		c.done = make(chan struct{})
+		if c.now == nil {
+			c.now = time.Now
+		}
+	})
+}
+
+// Add enqueues a path to be scanned.
+func (c *Coordinator) Add(path string) {
+	c.init()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		panic("queue: Add called after Close")
+	}
+	c.nextID++
+	c.pending = append(c.pending, Task{ID: c.nextID, Path: path})
+}
+
+// Close indicates no more paths will be added. Once all queued paths have been
+// reported, Done is closed and workers are told to exit.
+func (c *Coordinator) Close() {
+	c.init()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.checkDone()
+}
+
+// Done returns a channel that's closed once Close has been called and every
+// task has been reported.
+func (c *Coordinator) Done() <-chan struct{} {
+	c.init()
+	return c.done
+}
+
+// checkDone must be called with mu held.
+func (c *Coordinator) checkDone() {
+	if !c.closed || len(c.pending) > 0 || len(c.leased) > 0 {
+		return
+	}
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
+
+func (c *Coordinator) leaseTimeout() time.Duration {
+	if c.LeaseTimeout > 0 {
+		return c.LeaseTimeout
+	}
+	return defaultLeaseTimeout
+}
+
+// next returns the next task to lease. finished is true if the queue is
+// closed and all tasks have been reported.
+func (c *Coordinator) next() (t Task, ok, finished bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	// Requeue any leases that have expired.
+	for id, l := range c.leased {
+		if now.After(l.expires) {
+			delete(c.leased, id)
+			c.pending = append(c.pending, l.task)
+		}
+	}
+	if len(c.pending) == 0 {
+		return Task{}, false, c.closed && len(c.leased) == 0
+	}
+	t = c.pending[0]
+	c.pending = c.pending[1:]
+	c.leased[t.ID] = lease{task: t, expires: now.Add(c.leaseTimeout())}
+	return t, true, false
+}
+
+// report records a result, returning false if the task wasn't leased. This
+// happens if a lease expired and the task was reported by another worker.
+func (c *Coordinator) report(r Result) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.leased[r.TaskID]
+	if !ok {
+		return false
+	}
+	delete(c.leased, r.TaskID)
+	r.Path = l.task.Path
+	if c.HandleResult != nil {
+		c.HandleResult(r)
+	}
+	c.checkDone()
+	return true
+}
+
+// ServeHTTP implements the worker protocol.
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.init()
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case leasePath:
+		t, ok, finished := c.next()
+		if finished {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	case resultPath:
+		var res Result
+		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+			http.Error(w, fmt.Sprintf("decoding result: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !c.report(res) {
+			// Stale result, ignore it.
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Worker leases tasks from a Coordinator and scans them.
+type Worker struct {
+	// URL is the base URL of the coordinator.
+	URL string
+	// Name identifies the worker in results.
+	Name string
+	// Client is used to connect to the coordinator. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+	// Scan scans a single path. It's required.
+	Scan func(ctx context.Context, path string) Result
+	// PollInterval is how long to wait before asking for more work when the
+	// coordinator's queue is empty. Defaults to 1 second.
+	PollInterval time.Duration
+	// Retries is how many times in a row a failed request to the
+	// coordinator is retried before Run gives up. Defaults to
+	// DefaultRetries, or no retries if negative.
+	Retries int
+	// Backoff is the delay before the first retry, doubled for each of the
+	// following ones up to a minute. Defaults to DefaultBackoff.
+	Backoff time.Duration
+	// OnRetry, if provided, is called with the error before each retry.
+	OnRetry func(err error, delay time.Duration)
+}
+
+func (w *Worker) client() *http.Client {
+	if w.Client != nil {
+		return w.Client
+	}
+	return http.DefaultClient
+}
+
+// Run processes tasks until the coordinator reports there's no more work or
+// the context is canceled.
+func (w *Worker) Run(ctx context.Context) error {
+	poll := w.PollInterval
+	if poll <= 0 {
+		poll = time.Second
+	}
+	for {
+		var (
+			t            Task
+			ok, finished bool
+		)
+		err := w.retry(ctx, func() (err error) {
+			t, ok, finished, err = w.lease(ctx)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if finished {
+			return nil
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(poll):
+			}
+			continue
+		}
+
+		res := w.Scan(ctx, t.Path)
+		res.TaskID = t.ID
+		res.Path = t.Path
+		res.Worker = w.Name
+		// Results are reported idempotently, so a report whose response
+		// was lost can be sent again.
+		if err := w.retry(ctx, func() error { return w.report(ctx, res) }); err != nil {
+			return err
+		}
+	}
+}
+
+// retry calls fn until it succeeds, the retries are exhausted, or the context
+// is canceled, so a coordinator that's restarting or briefly unreachable
+// doesn't stop the worker.
+func (w *Worker) retry(ctx context.Context, fn func() error) error {
+	retries := w.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt >= retries {
+			return err
+		}
+		if w.OnRetry != nil {
+			w.OnRetry(err, backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (w *Worker) post(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing coordinator URL: %v", err)
+	}
+	u = u.ResolveReference(&url.URL{Path: path})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting coordinator: %v", err)
+	}
+	return resp, nil
+}
+
+func (w *Worker) lease(ctx context.Context) (t Task, ok, finished bool, err error) {
+	resp, err := w.post(ctx, leasePath, nil)
+	if err != nil {
+		return t, false, false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+			return t, false, false, fmt.Errorf("decoding task: %v", err)
+		}
+		return t, true, false, nil
+	case http.StatusNoContent:
+		return t, false, false, nil
+	case http.StatusGone:
+		return t, false, true, nil
+	default:
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return t, false, false, fmt.Errorf("leasing task: unexpected status %s: %s", resp.Status, b)
+	}
+}
+
+func (w *Worker) report(ctx context.Context, r Result) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding result: %v", err)
+	}
+	resp, err := w.post(ctx, resultPath, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusConflict:
+		return nil
+	default:
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("reporting result: unexpected status %s: %s", resp.Status, b)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCoordinator(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	c := &Coordinator{
+		HandleResult: func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, fmt.Sprintf("%s %t %s", r.Path, r.Vulnerable, r.Error))
+		},
+	}
+	want := []string{}
+	for i := 0; i < 20; i++ {
+		p := fmt.Sprintf("/data/%02d.jar", i)
+		c.Add(p)
+		want = append(want, fmt.Sprintf("%s %t ", p, i%3 == 0))
+	}
+	c.Close()
+
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		w := &Worker{
+			URL:  srv.URL,
+			Name: fmt.Sprintf("worker-%d", i),
+			Scan: func(ctx context.Context, path string) Result {
+				var n int
+				fmt.Sscanf(path, "/data/%02d.jar", &n)
+				return Result{Vulnerable: n%3 == 0}
+			},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Run(context.Background()); err != nil {
+				t.Errorf("running worker: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-c.Done():
+	default:
+		t.Errorf("coordinator not done after workers exited")
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestCoordinatorLeaseExpiry(t *testing.T) {
+	now := time.Now()
+	var got []Result
+	c := &Coordinator{
+		LeaseTimeout: time.Minute,
+		HandleResult: func(r Result) { got = append(got, r) },
+		now:          func() time.Time { return now },
+	}
+	c.Add("/a.jar")
+	c.Close()
+
+	t1, ok, _ := c.next()
+	if !ok {
+		t.Fatalf("expected task to be leased")
+	}
+	if _, ok, finished := c.next(); ok || finished {
+		t.Fatalf("next() with outstanding lease returned ok=%t, finished=%t, want false, false", ok, finished)
+	}
+
+	now = now.Add(2 * time.Minute)
+	t2, ok, _ := c.next()
+	if !ok {
+		t.Fatalf("expected expired lease to be requeued")
+	}
+	if t1 != t2 {
+		t.Errorf("requeued task got %v, want %v", t2, t1)
+	}
+	if !c.report(Result{TaskID: t2.ID}) {
+		t.Errorf("reporting leased task failed")
+	}
+	if c.report(Result{TaskID: t1.ID}) {
+		t.Errorf("reporting task twice succeeded")
+	}
+	if len(got) != 1 || got[0].Path != "/a.jar" {
+		t.Errorf("unexpected results: %v", got)
+	}
+	if _, _, finished := c.next(); !finished {
+		t.Errorf("expected queue to be finished")
+	}
+}
+
+// flaky fails the first failures requests with a 503 before passing them to h.
+type flaky struct {
+	h http.Handler
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (f *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	fail := f.failures > 0
+	if fail {
+		f.failures--
+	}
+	f.mu.Unlock()
+	if fail {
+		http.Error(w, "restarting", http.StatusServiceUnavailable)
+		return
+	}
+	f.h.ServeHTTP(w, r)
+}
+
+func TestWorkerRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		retries     int
+		want        []string
+		wantRetries int
+		wantErr     bool
+	}{
+		{
+			name:        "Recovers",
+			failures:    3,
+			retries:     3,
+			want:        []string{"/a.jar", "/b.jar"},
+			wantRetries: 3,
+		},
+		{
+			name:        "GivesUp",
+			failures:    4,
+			retries:     3,
+			want:        []string{},
+			wantRetries: 3,
+			wantErr:     true,
+		},
+		{
+			name:     "NoRetries",
+			failures: 1,
+			retries:  -1,
+			want:     []string{},
+			wantErr:  true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := []string{}
+			c := &Coordinator{
+				HandleResult: func(r Result) { got = append(got, r.Path) },
+			}
+			c.Add("/a.jar")
+			c.Add("/b.jar")
+			c.Close()
+
+			srv := httptest.NewServer(&flaky{h: c, failures: tc.failures})
+			defer srv.Close()
+
+			var retried int
+			w := &Worker{
+				URL:     srv.URL,
+				Scan:    func(ctx context.Context, path string) Result { return Result{} },
+				Retries: tc.retries,
+				Backoff: time.Millisecond,
+				OnRetry: func(err error, delay time.Duration) { retried++ },
+			}
+			err := w.Run(context.Background())
+			if err != nil {
+				if !tc.wantErr {
+					t.Fatalf("running worker: %v", err)
+				}
+			} else if tc.wantErr {
+				t.Fatalf("running worker: expected error")
+			}
+			if retried != tc.wantRetries {
+				t.Errorf("worker retried %d times, want %d", retried, tc.wantRetries)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("results returned diff (-want, +got): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package readonly holds a process-wide guarantee that the scanner doesn't
+// write to disk.
+//
+// Once Enable is called, every code path capable of writing, such as
+// rewriting JARs, spilling archives to temporary files, or opening databases
+// and logs, calls Check first and fails instead of writing. The guarantee
+// can't be revoked for the lifetime of the process.
+package readonly
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var enabled int32
+
+// Enable forbids writes for the rest of the process.
+func Enable() {
+	atomic.StoreInt32(&enabled, 1)
+}
+
+// Enabled reports if writes are forbidden.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Check returns an error if writes are forbidden. op describes the refused
+// write, such as "rewriting /opt/app.jar".
+func Check(op string) error {
+	if Enabled() {
+		return fmt.Errorf("%s: refused in read-only mode", op)
+	}
+	return nil
+}
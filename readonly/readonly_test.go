@@ -0,0 +1,33 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readonly
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	if Enabled() {
+		t.Fatalf("Enabled() = true before Enable()")
+	}
+	if err := Check("writing"); err != nil {
+		t.Errorf("Check() before Enable() failed: %v", err)
+	}
+	Enable()
+	if !Enabled() {
+		t.Errorf("Enabled() = false after Enable()")
+	}
+	if err := Check("writing"); err == nil {
+		t.Errorf("Check() after Enable() succeeded, want error")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "sort"
+
+// writeFlags returns the flags that write to disk, and so conflict with
+// --assert-read-only. paths holds the values of flags naming output files,
+// keyed by flag, where "" disables the output and "-" writes to stdout.
+func writeFlags(rewrite bool, paths map[string]string) []string {
+	var flags []string
+	if rewrite {
+		flags = append(flags, "--rewrite")
+	}
+	for name, p := range paths {
+		if p != "" && p != "-" {
+			flags = append(flags, "--"+name)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
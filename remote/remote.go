@@ -0,0 +1,219 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote scans hosts over SSH without installing the scanner on them.
+//
+// Hosts are reached with the ssh command, so ~/.ssh/config, agents, jump
+// hosts, and known_hosts apply as they do interactively. Archives are either
+// streamed back to be scanned locally, which only requires find and GNU tar
+// on the host, or a scanner binary is pushed to the host and run there.
+package remote
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"log4jscanner/jar"
+)
+
+// Client runs commands on hosts over SSH.
+type Client struct {
+	// SSH is the ssh command and its options, such as
+	// []string{"ssh", "-o", "BatchMode=yes"}. The host and the remote
+	// command are appended to it. Defaults to DefaultSSH.
+	SSH []string
+	// Stderr, if provided, is called with each line the remote commands
+	// write to stderr, such as directories find can't read.
+	Stderr func(host, line string)
+}
+
+// DefaultSSH runs ssh without prompting for passwords or unknown host keys,
+// so a host that requires them fails instead of stalling the scan.
+var DefaultSSH = []string{"ssh", "-o", "BatchMode=yes"}
+
+func (c *Client) command(ctx context.Context, host, script string) *exec.Cmd {
+	args := c.SSH
+	if len(args) == 0 {
+		args = DefaultSSH
+	}
+	args = append(append([]string(nil), args...), host, script)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = &lineWriter{fn: func(line string) {
+		if c.Stderr != nil {
+			c.Stderr(host, line)
+		}
+	}}
+	return cmd
+}
+
+// run runs cmd, reading its stdout with read. If read fails, the command
+// is killed.
+func run(cmd *exec.Cmd, read func(r io.Reader) error) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("running %s: %v", cmd.Path, err)
+	}
+	if err := read(stdout); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	// Drain what wasn't read, so the command isn't blocked writing it.
+	io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("remote command failed: %v", err)
+	}
+	return nil
+}
+
+// Stream finds the candidate archives within dirs on host, by their
+// extension, and calls fn with the path and contents of each as they're
+// streamed back. Archives that fn returns an error for stop the stream.
+func (c *Client) Stream(ctx context.Context, host string, dirs []string, fn func(path string, r io.Reader) error) error {
+	cmd := c.command(ctx, host, streamScript(dirs))
+	return run(cmd, func(r io.Reader) error {
+		tr := tar.NewReader(r)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading archives: %v", err)
+			}
+			if h.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := fn(h.Name, tr); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// streamScript returns the shell command writing a tar archive of the
+// candidate archives within dirs to stdout. Paths are kept absolute, and
+// files removed between find and tar are skipped.
+func streamScript(dirs []string) string {
+	var b strings.Builder
+	b.WriteString("find")
+	for _, d := range dirs {
+		b.WriteString(" " + quote(d))
+	}
+	b.WriteString(` -type f \(`)
+	for i, ext := range jar.ArchiveExts() {
+		if i > 0 {
+			b.WriteString(" -o")
+		}
+		b.WriteString(" -name " + quote("*"+ext))
+	}
+	b.WriteString(` \) -print0 | tar --null --ignore-failed-read -cPf - -T -`)
+	return b.String()
+}
+
+// Push copies the executable at bin to a temporary file on host, runs it
+// with args, and calls fn with its stdout. The file is removed once it
+// exits. The host must share the executable's OS and architecture, and its
+// temporary directory must allow executing files.
+func (c *Client) Push(ctx context.Context, host, bin string, args []string, fn func(stdout io.Reader) error) error {
+	f, err := os.Open(bin)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var script strings.Builder
+	script.WriteString(`t=$(mktemp) && trap 'rm -f "$t"' EXIT && cat > "$t" && chmod 700 "$t" && "$t"`)
+	for _, a := range args {
+		script.WriteString(" " + quote(a))
+	}
+	cmd := c.command(ctx, host, script.String())
+	cmd.Stdin = f
+	return run(cmd, fn)
+}
+
+// quote quotes s for a POSIX shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// lineWriter calls fn with every line written to it.
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(bytes.TrimRight(w.buf[:i], "\r")))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// ReadHosts reads a list of hosts, one ssh destination per line, such as
+// user@host or an alias of ~/.ssh/config. Blank lines and lines starting
+// with "#" are ignored.
+func ReadHosts(r io.Reader) ([]string, error) {
+	var hosts []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := CheckHost(line); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, line)
+	}
+	return hosts, s.Err()
+}
+
+// CheckHost returns an error if host isn't a valid ssh destination, such as
+// one ssh would parse as an option.
+func CheckHost(host string) error {
+	if host == "" || strings.HasPrefix(host, "-") || strings.ContainsAny(host, " \t\n") {
+		return fmt.Errorf("invalid host %q", host)
+	}
+	return nil
+}
+
+// LoadHosts reads a list of hosts from a file, see ReadHosts.
+func LoadHosts(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hosts, err := ReadHosts(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return hosts, nil
+}
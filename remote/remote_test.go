@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"log4jscanner/testjar"
+)
+
+// localSSH runs remote commands locally, ignoring the host.
+var localSSH = []string{"sh", "-c", `shift; exec sh -c "$1"`, "ssh"}
+
+func TestStream(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.war":         "war",
+		"lib/a.jar":       "jar",
+		"lib/it's.jar":    "quoted",
+		"lib/notes.txt":   "skipped",
+		"modules/m.jmod":  "jmod",
+		"lib/empty/x.zip": "zip",
+	}
+	for name, content := range files {
+		testjar.WriteFile(t, filepath.Join(dir, name), []byte(content))
+	}
+
+	c := &Client{SSH: localSSH}
+	got := map[string]string{}
+	err := c.Stream(context.Background(), "host", []string{dir}, func(path string, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		got[path] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream() failed: %v", err)
+	}
+	want := map[string]string{}
+	for name, content := range files {
+		if !strings.HasSuffix(name, ".txt") {
+			want[filepath.Join(dir, name)] = content
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Stream() returned diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	var stderr []string
+	c := &Client{
+		SSH:    []string{"sh", "-c", `echo "connection refused" >&2; exit 255`, "ssh"},
+		Stderr: func(host, line string) { stderr = append(stderr, host+": "+line) },
+	}
+	err := c.Stream(context.Background(), "web1", []string{"/opt"}, func(string, io.Reader) error { return nil })
+	if err == nil {
+		t.Errorf("Stream() with a failing ssh succeeded, want error")
+	}
+	if diff := cmp.Diff([]string{"web1: connection refused"}, stderr); diff != "" {
+		t.Errorf("Stream() returned stderr diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestPush(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "scanner")
+	script := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\"; done\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatalf("writing executable: %v", err)
+	}
+	c := &Client{SSH: localSSH}
+	var out bytes.Buffer
+	err := c.Push(context.Background(), "host", bin, []string{"--format", "json", "/opt/it's here"}, func(r io.Reader) error {
+		_, err := io.Copy(&out, r)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Push() failed: %v", err)
+	}
+	if got, want := out.String(), "--format\njson\n/opt/it's here\n"; got != want {
+		t.Errorf("Push() ran the executable with %q, want %q", got, want)
+	}
+}
+
+func TestReadHosts(t *testing.T) {
+	in := `# web tier
+web1
+admin@web2.example.com
+
+db1 # trailing comments aren't supported
+`
+	if _, err := ReadHosts(strings.NewReader(in)); err == nil {
+		t.Errorf("ReadHosts() with an invalid host succeeded, want error")
+	}
+	got, err := ReadHosts(strings.NewReader("# web tier\nweb1\nadmin@web2.example.com\n\n  db1  \n"))
+	if err != nil {
+		t.Fatalf("ReadHosts() failed: %v", err)
+	}
+	if diff := cmp.Diff([]string{"web1", "admin@web2.example.com", "db1"}, got); diff != "" {
+		t.Errorf("ReadHosts() returned diff (-want, +got):\n%s", diff)
+	}
+	if err := CheckHost("-oProxyCommand=x"); err == nil {
+		t.Errorf("CheckHost() of an option succeeded, want error")
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"log4jscanner/hostinfo"
+	"log4jscanner/logging"
+	"log4jscanner/remote"
+	"log4jscanner/results"
+)
+
+func remoteUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner remote [flag] [directories]
+
+Scans the directories on remote hosts over SSH, without installing the scanner
+on them. By default, the archives within the directories are found with find
+and streamed back with GNU tar, then scanned locally. With --push, this binary
+is copied to each host and scanned there instead, which only sends findings
+back but requires the hosts to share its OS and architecture.
+
+Hosts are reached with the ssh command, so ~/.ssh/config, agents, and
+known_hosts apply. Findings are printed as host:path, or with the host's name
+in json output.
+
+    log4jscanner remote --hosts hosts.txt --parallel 20 /opt /srv
+
+Flags:
+
+    --hosts        File of hosts to scan, one ssh destination (e.g. web1 or
+                   admin@web1.example.com) per line. Blank lines and lines
+                   starting with "#" are ignored.
+    -H, --host     Host to scan. May be provided multiple times.
+    --parallel     Number of hosts scanned concurrently (default 10).
+    --push         Copy this binary to a temporary file on each host and scan
+                   there, instead of streaming archives back.
+    --ssh          The ssh command (default "ssh").
+    -o, --ssh-option
+                   Option passed to ssh with -o, such as
+                   StrictHostKeyChecking=yes. May be provided multiple times.
+                   BatchMode=yes is always passed, so hosts requiring a
+                   password fail rather than prompt.
+    --format       Output format of findings, text or json (default text).
+    --webhook      Also POST findings as JSON to the given URL.
+    --webhook-header
+                   Header to send with --webhook requests (e.g.
+                   "Authorization: Bearer TOKEN"). May be provided multiple
+                   times.
+`+clientTLSUsage+`    `+logFormatHelp+`
+    -v, --verbose  Print verbose logs to stderr.
+
+`)
+}
+
+func remoteCmd(args []string) {
+	var (
+		hostsFile string
+		hosts     []string
+		parallel  int
+		push      bool
+		sshCmd    string
+		sshOpts   []string
+		format    string
+		webhook   webhookFlags
+		logFmt    string
+		verbose   bool
+	)
+	appendHost := func(h string) error {
+		if err := remote.CheckHost(h); err != nil {
+			return err
+		}
+		hosts = append(hosts, h)
+		return nil
+	}
+	appendOpt := func(o string) error {
+		sshOpts = append(sshOpts, o)
+		return nil
+	}
+	flags := flag.NewFlagSet("remote", flag.ExitOnError)
+	flags.StringVar(&hostsFile, "hosts", "", "")
+	flags.Func("host", "", appendHost)
+	flags.Func("H", "", appendHost)
+	flags.IntVar(&parallel, "parallel", 10, "")
+	flags.BoolVar(&push, "push", false, "")
+	flags.StringVar(&sshCmd, "ssh", "ssh", "")
+	flags.Func("ssh-option", "", appendOpt)
+	flags.Func("o", "", appendOpt)
+	flags.StringVar(&format, "format", "text", "")
+	webhook.register(flags)
+	logFormatFlag(flags, &logFmt)
+	flags.BoolVar(&verbose, "verbose", false, "")
+	flags.BoolVar(&verbose, "v", false, "")
+	flags.Usage = remoteUsage
+	flags.Parse(args)
+	dirs := flags.Args()
+	if len(dirs) == 0 {
+		remoteUsage()
+		os.Exit(1)
+	}
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	setupLogging(logFmt)
+	logf := func(format string, v ...interface{}) {
+		if verbose {
+			log.Printf(format, v...)
+		}
+	}
+	if hostsFile != "" {
+		l, err := remote.LoadHosts(hostsFile)
+		if err != nil {
+			log.Fatalf("Error: reading hosts: %v", err)
+		}
+		hosts = append(hosts, l...)
+	}
+	if len(hosts) == 0 {
+		log.Fatalf("Error: no hosts provided, use --hosts or --host")
+	}
+	if parallel < 1 {
+		log.Fatalf("Error: --parallel must be at least 1")
+	}
+
+	var sink results.Sink
+	switch format {
+	case "text":
+		t := results.NewText(os.Stdout)
+		t.Format = func(f results.Finding) string {
+			return f.Host.Hostname + ":" + f.Path
+		}
+		sink = t
+	case "json":
+		sink = results.NewJSON(os.Stdout)
+	default:
+		log.Fatalf("Error: unknown --format %q, expected text or json", format)
+	}
+	if ws := webhook.sink(); ws != nil {
+		sink = results.Multi(sink, ws)
+	}
+	defer sink.Close()
+
+	ssh := []string{sshCmd, "-o", "BatchMode=yes"}
+	for _, o := range sshOpts {
+		ssh = append(ssh, "-o", o)
+	}
+	c := &remote.Client{
+		SSH: ssh,
+		Stderr: func(host, line string) {
+			logging.With("host", host).Printf("Warning: %s: %s", host, line)
+		},
+	}
+	var bin string
+	if push {
+		var err error
+		if bin, err = os.Executable(); err != nil {
+			log.Fatalf("Error: finding this binary to push: %v", err)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	var (
+		mu     sync.Mutex
+		failed []string
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, parallel)
+	)
+	for _, host := range hosts {
+		host := host
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			logf("Scanning %s", host)
+			write := func(f results.Finding) {
+				if f.Host == nil {
+					f.Host = &hostinfo.Host{}
+				}
+				if f.Host.Hostname == "" {
+					f.Host.Hostname = host
+				}
+				if err := sink.Write(f); err != nil {
+					log.Printf("Error: writing results: %v", err)
+				}
+			}
+			var err error
+			if push {
+				err = scanPushed(ctx, c, host, bin, dirs, write)
+			} else {
+				err = scanStreamed(ctx, c, host, dirs, write)
+			}
+			if err != nil {
+				logging.With("host", host, "error", err).Printf("Error: scanning host %s: %v", host, err)
+				mu.Lock()
+				failed = append(failed, host)
+				mu.Unlock()
+				return
+			}
+			logf("Scanned %s", host)
+		}()
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		log.Printf("Warning: %d of %d hosts couldn't be scanned, results are incomplete", len(failed), len(hosts))
+	}
+}
+
+// scanStreamed scans the archives of a host streamed back over SSH.
+func scanStreamed(ctx context.Context, c *remote.Client, host string, dirs []string, write func(f results.Finding)) error {
+	return c.Stream(ctx, host, dirs, func(path string, r io.Reader) error {
+		rep, err := scanStream(r)
+		if err != nil {
+			logging.With("host", host, "path", path, "error", err).Printf("Error: scanning %s:%s: %v", host, path, err)
+			return nil
+		}
+		if rep != nil && rep.Vulnerable {
+			write(results.FromReport(path, rep))
+		}
+		return nil
+	})
+}
+
+// scanPushed runs this binary on a host, reading its JSON findings.
+func scanPushed(ctx context.Context, c *remote.Client, host, bin string, dirs []string, write func(f results.Finding)) error {
+	args := append([]string{"--format", "json", "--"}, dirs...)
+	return c.Push(ctx, host, bin, args, func(stdout io.Reader) error {
+		d := results.NewDecoder(stdout)
+		for {
+			f, err := d.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if f.Time.IsZero() {
+				f.Time = time.Now().UTC()
+			}
+			write(f)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"log4jscanner/results"
+)
+
+func reportUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner report --from FILE [flag]
+
+Merges the findings of many scans, such as of every host of a fleet, into one
+report with an entry per distinct vulnerable JAR and the hosts and paths it
+was found at. JARs are identified by their SHA-256, so scan with --hash to
+tell apart JARs of the same name; findings without a hash are grouped by file
+name, Log4j version, and rules.
+
+Findings of the same host and path are deduplicated, keeping the most recent.
+Entries are sorted by severity, then by the number of hosts.
+
+Flags:
+
+    --from     Findings written by --format json, or "-" for stdin
+               (required). May be provided multiple times.
+    --format   Output format. One of text (default), json, or csv, with a
+               row per host and path of each JAR.
+
+`)
+}
+
+func reportCmd(args []string) {
+	var (
+		from   []string
+		format string
+	)
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	flags.Func("from", "", func(path string) error {
+		from = append(from, path)
+		return nil
+	})
+	flags.StringVar(&format, "format", "text", "")
+	flags.Usage = reportUsage
+	flags.Parse(args)
+	if len(from) == 0 || flags.NArg() != 0 {
+		reportUsage()
+		os.Exit(1)
+	}
+	write, ok := reportFormats[format]
+	if !ok {
+		log.Fatalf("Error: unknown --format %q, expected text, json, or csv", format)
+	}
+
+	var scans [][]results.Finding
+	for _, path := range from {
+		f, err := readFindings(path)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		scans = append(scans, f)
+	}
+	groups := results.Aggregate(scans...)
+	if err := write(os.Stdout, groups); err != nil {
+		log.Fatalf("Error: writing report: %v", err)
+	}
+	hosts := map[string]bool{}
+	paths := 0
+	for _, g := range groups {
+		for _, h := range g.Hosts {
+			hosts[h] = true
+		}
+		paths += len(g.Occurrences)
+	}
+	fmt.Fprintf(os.Stderr, "Found %d distinct JARs at %d paths on %d hosts\n", len(groups), paths, len(hosts))
+}
+
+// reportFormats holds the output formats of the report command.
+var reportFormats = map[string]func(w io.Writer, groups []results.Group) error{
+	"csv":  writeGroupsCSV,
+	"json": writeGroupsJSON,
+	"text": writeGroupsText,
+}
+
+func writeGroupsJSON(w io.Writer, groups []results.Group) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(groups)
+}
+
+func writeGroupsCSV(w io.Writer, groups []results.Group) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"sha256", "name", "severity", "cves", "rules", "log4j_version", "hosts", "host", "path", "time",
+		"rewritten"})
+	for _, g := range groups {
+		for _, o := range g.Occurrences {
+			rewritten := ""
+			if o.Rewritten {
+				rewritten = "true"
+			}
+			cw.Write([]string{
+				g.SHA256,
+				g.Name,
+				g.Severity.String(),
+				strings.Join(g.CVEs, " "),
+				strings.Join(g.Rules, " "),
+				g.Log4jVersion,
+				strconv.Itoa(len(g.Hosts)),
+				o.Host,
+				o.Path,
+				o.Time.Format(time.RFC3339),
+				rewritten,
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeGroupsText writes a line per JAR, followed by an indented line per
+// host and path it was found at:
+//
+//	critical  log4j-core.jar  2 hosts  CVE-2021-44228  sha256:ab12...
+//	    web-1:/opt/app/lib/log4j-core.jar
+func writeGroupsText(w io.Writer, groups []results.Group) error {
+	bw := bufio.NewWriter(w)
+	for _, g := range groups {
+		hosts := "1 host"
+		if len(g.Hosts) != 1 {
+			hosts = fmt.Sprintf("%d hosts", len(g.Hosts))
+		}
+		line := []string{fmt.Sprintf("%-8s", g.Severity), g.Name, hosts}
+		if len(g.CVEs) > 0 {
+			line = append(line, strings.Join(g.CVEs, ","))
+		}
+		if g.SHA256 != "" {
+			line = append(line, "sha256:"+g.SHA256)
+		}
+		fmt.Fprintln(bw, strings.Join(line, "  "))
+		for _, o := range g.Occurrences {
+			if o.Host != "" {
+				fmt.Fprintf(bw, "    %s:%s\n", o.Host, o.Path)
+			} else {
+				fmt.Fprintf(bw, "    %s\n", o.Path)
+			}
+		}
+	}
+	return bw.Flush()
+}
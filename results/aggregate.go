@@ -0,0 +1,143 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// Group is a vulnerable JAR found by one or more scans, such as of every
+// host of a fleet, with the places it was found.
+type Group struct {
+	// SHA256 is the hash of the JAR, empty if the scans didn't record one,
+	// in which case JARs are told apart by their file name, version of
+	// Log4j, and rules instead.
+	SHA256 string `json:"sha256,omitempty"`
+	// Name is the most common file name of the JAR.
+	Name         string       `json:"name"`
+	CVEs         []string     `json:"cves,omitempty"`
+	Severity     jar.Severity `json:"severity"`
+	Rules        []string     `json:"rules,omitempty"`
+	Log4jVersion string       `json:"log4j_version,omitempty"`
+	// Hosts lists the distinct hosts the JAR was found on, sorted. Findings
+	// without a host count as a host with an empty name.
+	Hosts []string `json:"hosts"`
+	// Occurrences lists every path the JAR was found at, sorted by host and
+	// path.
+	Occurrences []Occurrence `json:"occurrences"`
+}
+
+// Occurrence is a path a JAR was found at.
+type Occurrence struct {
+	Host      string    `json:"host,omitempty"`
+	Path      string    `json:"path"`
+	Time      time.Time `json:"time"`
+	Rewritten bool      `json:"rewritten,omitempty"`
+}
+
+// artifactKey identifies the JAR of a finding regardless of where it was
+// found.
+func (f Finding) artifactKey() string {
+	if f.SHA256 != "" {
+		return f.SHA256
+	}
+	return "\x00" + path.Base(f.Path) + "\x00" + f.Log4jVersion + "\x00" + strings.Join(f.Rules, ",")
+}
+
+// Aggregate groups the findings of several scans by JAR, identified by its
+// hash, after merging findings of the same host and path as Merge does. The
+// result is sorted by decreasing severity, then number of hosts, then name.
+func Aggregate(scans ...[]Finding) []Group {
+	byKey := map[string]*Group{}
+	names := map[string]map[string]int{}
+	var keys []string
+	for _, f := range Merge(scans...) {
+		k := f.artifactKey()
+		a, ok := byKey[k]
+		if !ok {
+			a = &Group{SHA256: f.SHA256, Log4jVersion: f.Log4jVersion}
+			byKey[k] = a
+			names[k] = map[string]int{}
+			keys = append(keys, k)
+		}
+		if f.Severity > a.Severity {
+			a.Severity = f.Severity
+		}
+		a.CVEs = union(a.CVEs, f.CVEs)
+		a.Rules = union(a.Rules, f.Rules)
+		if a.Log4jVersion == "" {
+			a.Log4jVersion = f.Log4jVersion
+		}
+		host := ""
+		if f.Host != nil {
+			host = f.Host.Hostname
+		}
+		if n := len(a.Hosts); n == 0 || a.Hosts[n-1] != host {
+			a.Hosts = append(a.Hosts, host)
+		}
+		a.Occurrences = append(a.Occurrences, Occurrence{
+			Host:      host,
+			Path:      f.Path,
+			Time:      f.Time,
+			Rewritten: f.Rewritten,
+		})
+		names[k][path.Base(f.Path)]++
+	}
+
+	groups := make([]Group, 0, len(keys))
+	for _, k := range keys {
+		a := byKey[k]
+		best := 0
+		for name, n := range names[k] {
+			if n > best || n == best && name < a.Name {
+				a.Name, best = name, n
+			}
+		}
+		groups = append(groups, *a)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if len(a.Hosts) != len(b.Hosts) {
+			return len(a.Hosts) > len(b.Hosts)
+		}
+		return a.Name < b.Name
+	})
+	return groups
+}
+
+// union returns the sorted, distinct values of a and b.
+func union(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	seen := map[string]bool{}
+	var u []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			u = append(u, s)
+		}
+	}
+	sort.Strings(u)
+	return u
+}
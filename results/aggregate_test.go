@@ -0,0 +1,91 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func TestAggregate(t *testing.T) {
+	hashed := func(host, path, hash string, hour int) Finding {
+		f := finding(host, path, hour)
+		f.SHA256 = hash
+		return f
+	}
+	medium := hashed("c", "/opt/old.jar", "bb", 10)
+	medium.Severity = jar.SeverityMedium
+	medium.CVEs = []string{jar.CVE202145046}
+	unhashed := finding("a", "/srv/log4j-core.jar", 10)
+	unhashed.Log4jVersion = "2.14.1"
+
+	got := Aggregate(
+		[]Finding{
+			hashed("b", "/opt/app/log4j-core.jar", "aa", 10),
+			hashed("a", "/opt/app/log4j-core.jar", "aa", 10),
+			medium,
+			unhashed,
+		},
+		[]Finding{
+			// Rescans of a path replace the earlier finding.
+			hashed("b", "/opt/app/log4j-core.jar", "aa", 12),
+			hashed("b", "/opt/other/renamed.jar", "aa", 12),
+		},
+	)
+	at := func(hour int) time.Time {
+		return time.Date(2021, 12, 20, hour, 0, 0, 0, time.UTC)
+	}
+	want := []Group{
+		{
+			SHA256:   "aa",
+			Name:     "log4j-core.jar",
+			CVEs:     []string{jar.CVE202144228},
+			Severity: jar.SeverityCritical,
+			Hosts:    []string{"a", "b"},
+			Occurrences: []Occurrence{
+				{Host: "a", Path: "/opt/app/log4j-core.jar", Time: at(10)},
+				{Host: "b", Path: "/opt/app/log4j-core.jar", Time: at(12)},
+				{Host: "b", Path: "/opt/other/renamed.jar", Time: at(12)},
+			},
+		},
+		{
+			Name:         "log4j-core.jar",
+			CVEs:         []string{jar.CVE202144228},
+			Severity:     jar.SeverityCritical,
+			Log4jVersion: "2.14.1",
+			Hosts:        []string{"a"},
+			Occurrences: []Occurrence{
+				{Host: "a", Path: "/srv/log4j-core.jar", Time: at(10)},
+			},
+		},
+		{
+			SHA256:   "bb",
+			Name:     "old.jar",
+			CVEs:     []string{jar.CVE202145046},
+			Severity: jar.SeverityMedium,
+			Hosts:    []string{"c"},
+			Occurrences: []Occurrence{
+				{Host: "c", Path: "/opt/old.jar", Time: at(10)},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Aggregate() returned diff (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"sync"
+)
+
+// Statuses of findings compared against a baseline, see Finding.Baseline.
+const (
+	// BaselineNew is a JAR that wasn't vulnerable in the baseline.
+	BaselineNew = "new"
+	// BaselinePersisting is a JAR that was already vulnerable in the
+	// baseline, whether or not its finding changed.
+	BaselinePersisting = "persisting"
+	// BaselineFixed is a JAR of the baseline that's no longer vulnerable,
+	// such as because it was patched or deleted. Its finding is the one of
+	// the baseline.
+	BaselineFixed = "fixed"
+)
+
+// BaselineCounts counts the findings of each status written by a Baseline.
+type BaselineCounts struct {
+	New        int
+	Persisting int
+	Fixed      int
+}
+
+// Baseline labels findings with their status against the findings of a
+// previous scan.
+type Baseline struct {
+	sink    Sink
+	inScope func(f Finding) bool
+
+	mu       sync.Mutex
+	previous map[string]Finding
+	seen     map[string]bool
+	counts   BaselineCounts
+}
+
+// NewBaseline returns a sink setting the Baseline status of each finding
+// against the previous findings, matching JARs by host and path like Diff,
+// before writing it to s. Once closed, it writes the previous findings of
+// the JARs that weren't found again as BaselineFixed, then closes s. Only
+// previous findings for which inScope returns true, such as those under the
+// scanned directories, are reported fixed. A nil inScope includes them all.
+func NewBaseline(s Sink, previous []Finding, inScope func(f Finding) bool) *Baseline {
+	b := &Baseline{sink: s, inScope: inScope, previous: map[string]Finding{}, seen: map[string]bool{}}
+	for _, f := range Merge(previous) {
+		b.previous[f.key()] = f
+	}
+	return b
+}
+
+func (b *Baseline) Write(f Finding) error {
+	b.mu.Lock()
+	f.Baseline = BaselineNew
+	if _, ok := b.previous[f.key()]; ok {
+		f.Baseline = BaselinePersisting
+	}
+	// JARs reported again once rewritten are only counted once.
+	if !b.seen[f.key()] {
+		b.seen[f.key()] = true
+		if f.Baseline == BaselineNew {
+			b.counts.New++
+		} else {
+			b.counts.Persisting++
+		}
+	}
+	b.mu.Unlock()
+	return b.sink.Write(f)
+}
+
+func (b *Baseline) Flush() error {
+	return b.sink.Flush()
+}
+
+// Close writes the fixed findings, ordered by host and path, then closes the
+// sink.
+func (b *Baseline) Close() error {
+	b.mu.Lock()
+	var fixed []Finding
+	for k, f := range b.previous {
+		if b.seen[k] || (b.inScope != nil && !b.inScope(f)) {
+			continue
+		}
+		f.Baseline = BaselineFixed
+		fixed = append(fixed, f)
+		b.seen[k] = true
+	}
+	b.counts.Fixed += len(fixed)
+	b.mu.Unlock()
+
+	sortFindings(fixed)
+	var err error
+	for _, f := range fixed {
+		if werr := b.sink.Write(f); err == nil {
+			err = werr
+		}
+	}
+	if cerr := b.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Counts returns the findings of each status written so far.
+func (b *Baseline) Counts() BaselineCounts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.counts
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBaseline(t *testing.T) {
+	type entry struct {
+		Path     string
+		Baseline string
+	}
+	var got []entry
+	previous := []Finding{
+		finding("", "/opt/kept.jar", 9),
+		finding("", "/opt/fixed.jar", 9),
+		finding("", "/srv/elsewhere.jar", 9),
+	}
+	b := NewBaseline(Func(func(f Finding) error {
+		got = append(got, entry{f.Path, f.Baseline})
+		return nil
+	}), previous, func(f Finding) bool {
+		return strings.HasPrefix(f.Path, "/opt/")
+	})
+	rewritten := finding("", "/opt/kept.jar", 10)
+	rewritten.Rewritten = true
+	for _, f := range []Finding{finding("", "/opt/kept.jar", 10), rewritten, finding("", "/opt/new.jar", 10)} {
+		if err := b.Write(f); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	want := []entry{
+		{"/opt/kept.jar", BaselinePersisting},
+		{"/opt/kept.jar", BaselinePersisting},
+		{"/opt/new.jar", BaselineNew},
+		{"/opt/fixed.jar", BaselineFixed},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Baseline wrote diff (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff(BaselineCounts{New: 1, Persisting: 1, Fixed: 1}, b.Counts()); diff != "" {
+		t.Errorf("Counts() returned diff (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"reflect"
+	"sort"
+)
+
+// key identifies the JAR of a finding across scans: its path, and the host
+// it was found on, if recorded.
+func (f Finding) key() string {
+	if f.Host == nil {
+		return "\x00" + f.Path
+	}
+	return f.Host.Hostname + "\x00" + f.Path
+}
+
+// sortFindings orders findings by host, then path.
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].key() < findings[j].key()
+	})
+}
+
+// Merge combines the findings of several scans, such as of different hosts
+// or directories, into one finding per JAR, keeping the most recent finding
+// of JARs found by several scans. The result is sorted by host and path.
+func Merge(scans ...[]Finding) []Finding {
+	latest := map[string]Finding{}
+	for _, findings := range scans {
+		for _, f := range findings {
+			if prev, ok := latest[f.key()]; ok && prev.Time.After(f.Time) {
+				continue
+			}
+			latest[f.key()] = f
+		}
+	}
+	merged := make([]Finding, 0, len(latest))
+	for _, f := range latest {
+		merged = append(merged, f)
+	}
+	sortFindings(merged)
+	return merged
+}
+
+// Delta is the difference between the findings of two scans.
+type Delta struct {
+	// Added holds findings of JARs that weren't vulnerable before.
+	Added []Finding
+	// Removed holds the previous findings of JARs that are no longer
+	// vulnerable, such as because they were patched or deleted.
+	Removed []Finding
+	// Changed holds the new findings of JARs whose CVEs, rules, hash, or
+	// rewritten state changed.
+	Changed []Finding
+}
+
+// Diff compares the findings of an old and the latest scan, matching JARs by host
+// and path. Each list of the delta is sorted by host and path.
+func Diff(old, latest []Finding) Delta {
+	before := map[string]Finding{}
+	for _, f := range Merge(old) {
+		before[f.key()] = f
+	}
+	var d Delta
+	for _, f := range Merge(latest) {
+		prev, ok := before[f.key()]
+		delete(before, f.key())
+		switch {
+		case !ok:
+			d.Added = append(d.Added, f)
+		case changed(prev, f):
+			d.Changed = append(d.Changed, f)
+		}
+	}
+	for _, f := range before {
+		d.Removed = append(d.Removed, f)
+	}
+	sortFindings(d.Removed)
+	return d
+}
+
+// changed reports if the vulnerability of a JAR differs between findings.
+func changed(a, b Finding) bool {
+	return a.Severity != b.Severity ||
+		a.SHA256 != b.SHA256 ||
+		a.Rewritten != b.Rewritten ||
+		!reflect.DeepEqual(a.CVEs, b.CVEs) ||
+		!reflect.DeepEqual(a.Rules, b.Rules)
+}
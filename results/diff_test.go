@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/hostinfo"
+	"log4jscanner/jar"
+)
+
+// finding returns a finding of a JAR on a host, found at the given hour.
+func finding(host, path string, hour int) Finding {
+	f := Finding{
+		Path:     path,
+		Time:     time.Date(2021, 12, 20, hour, 0, 0, 0, time.UTC),
+		CVEs:     []string{jar.CVE202144228},
+		Severity: jar.SeverityCritical,
+	}
+	if host != "" {
+		f.Host = &hostinfo.Host{Hostname: host}
+	}
+	return f
+}
+
+func TestMerge(t *testing.T) {
+	got := Merge(
+		[]Finding{finding("b", "/opt/a.jar", 10), finding("a", "/opt/b.jar", 10)},
+		[]Finding{finding("b", "/opt/a.jar", 12), finding("a", "/opt/a.jar", 9)},
+		[]Finding{finding("b", "/opt/a.jar", 11)},
+	)
+	want := []Finding{
+		finding("a", "/opt/a.jar", 9),
+		finding("a", "/opt/b.jar", 10),
+		finding("b", "/opt/a.jar", 12),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Merge() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	patched := finding("", "/opt/changed.jar", 12)
+	patched.Rewritten = true
+	old := []Finding{
+		finding("", "/opt/changed.jar", 10),
+		finding("", "/opt/removed.jar", 10),
+		finding("", "/opt/same.jar", 10),
+	}
+	latest := []Finding{
+		finding("", "/opt/added.jar", 12),
+		patched,
+		finding("", "/opt/same.jar", 12),
+	}
+	want := Delta{
+		Added:   []Finding{finding("", "/opt/added.jar", 12)},
+		Removed: []Finding{finding("", "/opt/removed.jar", 10)},
+		Changed: []Finding{patched},
+	}
+	if diff := cmp.Diff(want, Diff(old, latest)); diff != "" {
+		t.Errorf("Diff() returned diff (-want, +got): %s", diff)
+	}
+}
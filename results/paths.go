@@ -0,0 +1,92 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+)
+
+// PathFormat normalizes the paths of findings, so the results of hosts of
+// different platforms can be aggregated into one dataset. The zero value
+// leaves paths as they were found.
+type PathFormat struct {
+	// Slash separates the elements of paths with forward slashes, such as
+	// C:/Program Files/app/lib/log4j-core.jar on Windows. Paths within an
+	// archive always use forward slashes.
+	Slash bool
+	// Absolute makes relative paths absolute, and Relative makes paths
+	// relative to the most specific of Roots holding them, such as
+	// lib/log4j-core.jar when scanning C:\app or /opt/app. Paths outside
+	// of every root are left as they are.
+	Absolute bool
+	Relative bool
+	Roots    []string
+	// HashKey, if provided, replaces paths with the hex encoded HMAC-SHA256
+	// of the normalized path under the key, to aggregate findings without
+	// disclosing host layouts. Hosts scanned with the same key and options
+	// report the same JAR path under the same hash.
+	HashKey []byte
+}
+
+// Format returns the normalized form of a path found by a scan. Stdin, "-",
+// is never changed.
+func (p *PathFormat) Format(path string) string {
+	if p == nil || path == "-" {
+		return path
+	}
+	// Nested archives follow the "!" separating them from the file on disk.
+	file, nested := path, ""
+	if i := strings.Index(path, "!"); i >= 0 {
+		file, nested = path[:i], path[i:]
+	}
+	if p.Absolute {
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+	}
+	if p.Relative {
+		file = p.relative(file)
+	}
+	if p.Slash {
+		file = filepath.ToSlash(file)
+	}
+	path = file + nested
+	if len(p.HashKey) > 0 {
+		mac := hmac.New(sha256.New, p.HashKey)
+		mac.Write([]byte(path))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	return path
+}
+
+// relative returns path relative to the most specific root holding it.
+func (p *PathFormat) relative(path string) string {
+	best := ""
+	rel := path
+	for _, root := range p.Roots {
+		r, err := filepath.Rel(root, path)
+		if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if best == "" || len(root) > len(best) {
+			best, rel = root, r
+		}
+	}
+	return rel
+}
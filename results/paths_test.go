@@ -0,0 +1,61 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPathFormat(t *testing.T) {
+	native := filepath.FromSlash
+	tests := []struct {
+		name   string
+		format *PathFormat
+		path   string
+		want   string
+	}{
+		{"Nil", nil, native("/opt/app/a.jar"), native("/opt/app/a.jar")},
+		{"Zero", &PathFormat{}, native("/opt/app/a.jar!lib/b.jar"), native("/opt/app/a.jar") + "!lib/b.jar"},
+		{"Slash", &PathFormat{Slash: true}, native("/opt/app/a.jar!lib/b.jar"), "/opt/app/a.jar!lib/b.jar"},
+		{
+			"Relative",
+			&PathFormat{Relative: true, Slash: true, Roots: []string{native("/opt"), native("/opt/app")}},
+			native("/opt/app/lib/a.jar!b.jar"),
+			"lib/a.jar!b.jar",
+		},
+		{
+			"RelativeOutsideRoots",
+			&PathFormat{Relative: true, Roots: []string{native("/srv")}},
+			native("/opt/app/a.jar"),
+			native("/opt/app/a.jar"),
+		},
+		{"Stdin", &PathFormat{Relative: true, HashKey: []byte("key")}, "-", "-"},
+		{
+			"Hash",
+			&PathFormat{Slash: true, HashKey: []byte("key")},
+			native("/opt/app/a.jar"),
+			// HMAC-SHA256 of /opt/app/a.jar under "key".
+			"492480f52589054fad0a753e2157fbe8754e84909ee861479cc3a3d9a2e3c9fa",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.format.Format(tc.path); got != tc.want {
+				t.Errorf("Format(%q) = %q, want %q", tc.path, got, tc.want)
+			}
+		})
+	}
+}
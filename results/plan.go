@@ -0,0 +1,224 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"log4jscanner/jar"
+)
+
+// Remediation actions of a plan step.
+const (
+	// ActionRewrite removes JndiLookup.class from the JAR in place, such as
+	// with --rewrite.
+	ActionRewrite = "rewrite"
+	// ActionReplace replaces the JAR with a fixed version of the library,
+	// since rewriting it wouldn't remediate it or isn't possible.
+	ActionReplace = "replace"
+	// ActionOwner needs the owner of the JAR to decide, since rewriting it
+	// would break its signature.
+	ActionOwner = "owner"
+)
+
+// fixedLog4j is the log4j 2 release fixing every vulnerability of the
+// built-in log4j 2 rules.
+const fixedLog4j = "2.17.1"
+
+// PlanStep is the remediation of a vulnerable JAR.
+type PlanStep struct {
+	Path string `json:"path"`
+	// Reason explains the action, such as "signed JAR, rewriting it would
+	// remove its signature".
+	Reason   string       `json:"reason"`
+	CVEs     []string     `json:"cves,omitempty"`
+	Severity jar.Severity `json:"severity"`
+	// Log4jVersion is the version of log4j-core in the JAR, if known, and
+	// UpgradeTo the log4j release to replace it with.
+	Log4jVersion string `json:"log4jVersion,omitempty"`
+	UpgradeTo    string `json:"upgradeTo,omitempty"`
+	// Coordinates and Projects identify the Maven artifact to upgrade and
+	// the build files declaring it, see Finding.
+	Coordinates string   `json:"coordinates,omitempty"`
+	Projects    []string `json:"projects,omitempty"`
+	// Host is the host holding the JAR, if findings were enriched with it.
+	Host string `json:"host,omitempty"`
+}
+
+// PlanBatch is a batch of steps taking the same action on JARs of the same
+// severity, which automation can execute together.
+type PlanBatch struct {
+	Action   string       `json:"action"`
+	Severity jar.Severity `json:"severity"`
+	Steps    []PlanStep   `json:"steps"`
+}
+
+// RemediationPlan orders the remediation of the vulnerable JARs found by a
+// scan: by severity, most severe first, then by action, rewrites first as
+// they're the quickest to apply. JARs in unusual locations come first within a
+// batch, see Finding.Priority.
+type RemediationPlan struct {
+	Batches []PlanBatch `json:"batches"`
+}
+
+// actionOrder orders the actions of batches of the same severity.
+var actionOrder = map[string]int{ActionRewrite: 0, ActionReplace: 1, ActionOwner: 2}
+
+// Plan is a sink collecting findings, which writes a RemediationPlan as
+// JSON on Close. JARs found again, such as once rewritten, take the action of
+// their last finding, and rewritten JARs need none.
+type Plan struct {
+	w io.Writer
+
+	mu       sync.Mutex
+	findings map[string]Finding
+}
+
+// NewPlan returns a sink writing the plan of the findings to w on Close.
+func NewPlan(w io.Writer) *Plan {
+	return &Plan{w: w, findings: map[string]Finding{}}
+}
+
+func (p *Plan) Write(f Finding) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.findings[f.Path] = f
+	return nil
+}
+
+// Flush does nothing, as the plan is only complete once the scan is.
+func (p *Plan) Flush() error { return nil }
+
+// Close writes the plan.
+func (p *Plan) Close() error {
+	p.mu.Lock()
+	findings := make([]Finding, 0, len(p.findings))
+	for _, f := range p.findings {
+		findings = append(findings, f)
+	}
+	p.mu.Unlock()
+
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(NewRemediationPlan(findings)); err != nil {
+		return fmt.Errorf("writing remediation plan: %v", err)
+	}
+	return nil
+}
+
+// NewRemediationPlan returns the plan remediating the findings.
+func NewRemediationPlan(findings []Finding) *RemediationPlan {
+	findings = append([]Finding(nil), findings...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Priority != b.Priority {
+			return a.Priority == PriorityElevated
+		}
+		return a.Path < b.Path
+	})
+	type key struct {
+		action   string
+		severity jar.Severity
+	}
+	batches := map[key]*PlanBatch{}
+	plan := &RemediationPlan{Batches: []PlanBatch{}}
+	var keys []key
+	for _, f := range findings {
+		if f.Rewritten {
+			continue
+		}
+		action, reason := planAction(f)
+		step := PlanStep{
+			Path:         f.Path,
+			Reason:       reason,
+			CVEs:         f.CVEs,
+			Severity:     f.Severity,
+			Log4jVersion: f.Log4jVersion,
+			Coordinates:  f.Coordinates,
+			Projects:     f.Projects,
+		}
+		if action != ActionRewrite && log4j2(f) {
+			step.UpgradeTo = fixedLog4j
+		}
+		if f.Host != nil {
+			step.Host = f.Host.Hostname
+		}
+		k := key{action, f.Severity}
+		b, ok := batches[k]
+		if !ok {
+			b = &PlanBatch{Action: action, Severity: f.Severity}
+			batches[k] = b
+			keys = append(keys, k)
+		}
+		b.Steps = append(b.Steps, step)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.severity != b.severity {
+			return a.severity > b.severity
+		}
+		return actionOrder[a.action] < actionOrder[b.action]
+	})
+	for _, k := range keys {
+		plan.Batches = append(plan.Batches, *batches[k])
+	}
+	return plan
+}
+
+// planAction returns the action remediating a finding, and why.
+func planAction(f Finding) (action, reason string) {
+	for _, id := range f.Rules {
+		switch {
+		case jar.RewriteRemediates(id):
+		case contains(f.Log4j1, id):
+			return ActionReplace, "log4j 1.x is end of life, migrate to log4j 2"
+		default:
+			return ActionReplace, "rule " + id + " isn't remediated by removing JndiLookup"
+		}
+	}
+	switch {
+	case f.Salvaged:
+		return ActionReplace, "corrupt JAR, which can't be rewritten"
+	case len(f.Projects) > 0:
+		return ActionReplace, "declared by a build, which would download it again"
+	case f.Signed:
+		return ActionOwner, "signed JAR, rewriting it would remove its signature"
+	}
+	return ActionRewrite, "remove JndiLookup.class"
+}
+
+// log4j2 reports if a finding matched a built-in log4j 2 rule.
+func log4j2(f Finding) bool {
+	for _, id := range f.Rules {
+		if jar.RewriteRemediates(id) || id == jar.RuleLog4j44832JDBC {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports if ids holds id.
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
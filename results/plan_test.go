@@ -0,0 +1,128 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func TestRemediationPlan(t *testing.T) {
+	critical := func(path string) Finding {
+		return Finding{
+			Path:     path,
+			CVEs:     []string{jar.CVE202144228},
+			Severity: jar.SeverityCritical,
+			Rules:    []string{jar.RuleLog4j44228Constructor},
+		}
+	}
+	signed := critical("/opt/signed.jar")
+	signed.Signed = true
+	elevated := critical("/tmp/x.jar")
+	elevated.Priority = PriorityElevated
+	rewritten := critical("/opt/rewritten.jar")
+	rewritten.Rewritten = true
+	salvaged := critical("/opt/corrupt.jar")
+	salvaged.Salvaged = true
+	declared := critical("/home/u/.m2/repository/org/apache/logging/log4j/log4j-core/2.14.1/log4j-core-2.14.1.jar")
+	declared.Coordinates = "org.apache.logging.log4j:log4j-core:2.14.1"
+	declared.Projects = []string{"/src/app/pom.xml:12"}
+	jdbc := Finding{
+		Path:         "/opt/jdbc.jar",
+		CVEs:         []string{jar.CVE202144832},
+		Severity:     jar.SeverityMedium,
+		Rules:        []string{jar.RuleLog4j44832JDBC},
+		Log4jVersion: "2.17.0",
+	}
+	log4j1 := Finding{
+		Path:     "/opt/log4j-1.2.17.jar",
+		CVEs:     []string{jar.CVE20214104},
+		Severity: jar.SeverityHigh,
+		Rules:    []string{jar.RuleLog4j1JMSAppender},
+		Log4j1:   []string{jar.RuleLog4j1JMSAppender},
+	}
+
+	got := NewRemediationPlan([]Finding{
+		critical("/opt/b.jar"), signed, jdbc, salvaged, log4j1, critical("/opt/a.jar"),
+		declared, elevated, rewritten,
+	})
+	want := &RemediationPlan{Batches: []PlanBatch{
+		{Action: ActionRewrite, Severity: jar.SeverityCritical, Steps: []PlanStep{
+			{Path: "/tmp/x.jar", Reason: "remove JndiLookup.class", CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical},
+			{Path: "/opt/a.jar", Reason: "remove JndiLookup.class", CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical},
+			{Path: "/opt/b.jar", Reason: "remove JndiLookup.class", CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical},
+		}},
+		{Action: ActionReplace, Severity: jar.SeverityCritical, Steps: []PlanStep{
+			{
+				Path:        declared.Path,
+				Reason:      "declared by a build, which would download it again",
+				CVEs:        []string{jar.CVE202144228},
+				Severity:    jar.SeverityCritical,
+				UpgradeTo:   "2.17.1",
+				Coordinates: declared.Coordinates,
+				Projects:    declared.Projects,
+			},
+			{Path: "/opt/corrupt.jar", Reason: "corrupt JAR, which can't be rewritten", CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical, UpgradeTo: "2.17.1"},
+		}},
+		{Action: ActionOwner, Severity: jar.SeverityCritical, Steps: []PlanStep{
+			{Path: "/opt/signed.jar", Reason: "signed JAR, rewriting it would remove its signature", CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical, UpgradeTo: "2.17.1"},
+		}},
+		{Action: ActionReplace, Severity: jar.SeverityHigh, Steps: []PlanStep{
+			{Path: "/opt/log4j-1.2.17.jar", Reason: "log4j 1.x is end of life, migrate to log4j 2", CVEs: []string{jar.CVE20214104}, Severity: jar.SeverityHigh},
+		}},
+		{Action: ActionReplace, Severity: jar.SeverityMedium, Steps: []PlanStep{
+			{
+				Path:         "/opt/jdbc.jar",
+				Reason:       "rule LOG4J-44832-JDBC isn't remediated by removing JndiLookup",
+				CVEs:         []string{jar.CVE202144832},
+				Severity:     jar.SeverityMedium,
+				Log4jVersion: "2.17.0",
+				UpgradeTo:    "2.17.1",
+			},
+		}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("NewRemediationPlan() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	var b bytes.Buffer
+	p := NewPlan(&b)
+	f := testFinding
+	f.Path = "/opt/app.jar"
+	if err := p.Write(f); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	f.Rewritten = true
+	if err := p.Write(f); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	var got RemediationPlan
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("decoding plan: %v", err)
+	}
+	if diff := cmp.Diff(RemediationPlan{Batches: []PlanBatch{}}, got); diff != "" {
+		t.Errorf("plan of a rewritten JAR returned diff (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+
+	"log4jscanner/jar"
+)
+
+// Decoder reads the findings written by the JSON sink, so Go programs can
+// post-process scan output with the same types that produced it.
+type Decoder struct {
+	// Strict rejects objects with fields unknown to Finding, such as from a
+	// newer scanner, and findings that fail Validate.
+	Strict bool
+
+	s       *bufio.Scanner
+	line    int
+	omitted Counts
+}
+
+// NewDecoder returns a decoder reading JSON Lines from r.
+func NewDecoder(r io.Reader) *Decoder {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16<<20)
+	return &Decoder{s: s}
+}
+
+// Next returns the next finding, or io.EOF once every line was read. Blank
+// lines are ignored, and the counts of omitted findings written with
+// --detail-severity are returned by Omitted instead.
+func (d *Decoder) Next() (Finding, error) {
+	for d.s.Scan() {
+		d.line++
+		b := bytes.TrimSpace(d.s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var counts struct {
+			Omitted Counts `json:"omitted"`
+		}
+		if bytes.HasPrefix(b, []byte(`{"omitted":`)) {
+			if err := json.Unmarshal(b, &counts); err != nil {
+				return Finding{}, fmt.Errorf("line %d: decoding counts: %v", d.line, err)
+			}
+			if d.omitted == nil {
+				d.omitted = Counts{}
+			}
+			for sev, n := range counts.Omitted {
+				d.omitted[sev] += n
+			}
+			continue
+		}
+
+		var f Finding
+		dec := json.NewDecoder(bytes.NewReader(b))
+		if d.Strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(&f); err != nil {
+			return Finding{}, fmt.Errorf("line %d: decoding finding: %v", d.line, err)
+		}
+		if d.Strict {
+			if err := Validate(f); err != nil {
+				return Finding{}, fmt.Errorf("line %d: %v", d.line, err)
+			}
+		}
+		return f, nil
+	}
+	if err := d.s.Err(); err != nil {
+		return Finding{}, fmt.Errorf("reading findings: %v", err)
+	}
+	return Finding{}, io.EOF
+}
+
+// Omitted returns the counts of omitted findings read so far.
+func (d *Decoder) Omitted() Counts {
+	return d.omitted
+}
+
+// ReadJSON returns every finding of JSON Lines read from r.
+func ReadJSON(r io.Reader) ([]Finding, error) {
+	d := NewDecoder(r)
+	var findings []Finding
+	for {
+		f, err := d.Next()
+		if err == io.EOF {
+			return findings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+}
+
+var cvePattern = regexp.MustCompile(`^CVE-[0-9]{4}-[0-9]{4,}$`)
+
+// versionRanges holds the valid values of Finding.VersionRange.
+var versionRanges = map[string]bool{
+	"":                    true,
+	jar.VersionBefore215:  true,
+	jar.Version215:        true,
+	jar.VersionAtLeast216: true,
+}
+
+// Validate returns an error if a finding doesn't match the schema of the
+// findings written by this package, such as a missing path, a malformed CVE
+// ID, or an unknown version range.
+func Validate(f Finding) error {
+	if f.Path == "" {
+		return fmt.Errorf("finding has no path")
+	}
+	if f.Time.IsZero() {
+		return fmt.Errorf("finding %s has no time", f.Path)
+	}
+	if f.Severity < jar.SeverityNone || f.Severity > jar.SeverityCritical {
+		return fmt.Errorf("finding %s has invalid severity %d", f.Path, int(f.Severity))
+	}
+	for _, cve := range f.CVEs {
+		if !cvePattern.MatchString(cve) {
+			return fmt.Errorf("finding %s has invalid CVE %q", f.Path, cve)
+		}
+	}
+	if f.SHA256 != "" {
+		if b, err := hex.DecodeString(f.SHA256); err != nil || len(b) != 32 {
+			return fmt.Errorf("finding %s has invalid sha256 %q", f.Path, f.SHA256)
+		}
+	}
+	for _, m := range f.Matches {
+		if b, err := hex.DecodeString(m.SHA256); err != nil || len(b) != 32 {
+			return fmt.Errorf("finding %s has invalid sha256 %q for %q", f.Path, m.SHA256, m.Path)
+		}
+	}
+	if f.Priority != "" && f.Priority != PriorityElevated {
+		return fmt.Errorf("finding %s has unknown priority %q", f.Path, f.Priority)
+	}
+	if !versionRanges[f.VersionRange] {
+		return fmt.Errorf("finding %s has unknown version range %q", f.Path, f.VersionRange)
+	}
+	for _, a := range f.Artifacts {
+		if !versionRanges[a.VersionRange] {
+			return fmt.Errorf("finding %s has unknown version range %q for %q", f.Path, a.VersionRange, a.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func TestReadJSON(t *testing.T) {
+	other := testFinding
+	other.Path = "/opt/app/lib/vendor-sdk-1.2.jar"
+	other.Severity = jar.SeverityLow
+
+	var b bytes.Buffer
+	s := NewJSON(&b)
+	sampler := NewSampler(s, jar.SeverityHigh)
+	for _, f := range []Finding{testFinding, other, testFinding} {
+		if err := sampler.Write(f); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+	if err := sampler.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	d := NewDecoder(&b)
+	d.Strict = true
+	var got []Finding
+	for {
+		f, err := d.Next()
+		if err != nil {
+			break
+		}
+		got = append(got, f)
+	}
+	if diff := cmp.Diff([]Finding{testFinding, testFinding}, got); diff != "" {
+		t.Errorf("Decoder returned diff (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff(Counts{jar.SeverityLow: 1}, d.Omitted()); diff != "" {
+		t.Errorf("Omitted() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestReadJSONStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		strict  bool
+		wantErr bool
+	}{
+		{"Valid", `{"path":"/a.jar","time":"2021-12-20T10:00:00Z","severity":"critical"}`, true, false},
+		{"UnknownField", `{"path":"/a.jar","time":"2021-12-20T10:00:00Z","severity":"critical","new":1}`, true, true},
+		{"UnknownFieldLenient", `{"path":"/a.jar","time":"2021-12-20T10:00:00Z","severity":"critical","new":1}`, false, false},
+		{"Invalid", `{"path":"","time":"2021-12-20T10:00:00Z","severity":"critical"}`, true, true},
+		{"UnknownSeverity", `{"path":"/a.jar","time":"2021-12-20T10:00:00Z","severity":"dire"}`, false, true},
+		{"Malformed", `{"path":`, false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewDecoder(strings.NewReader("\n" + tc.input + "\n"))
+			d.Strict = tc.strict
+			_, err := d.Next()
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Next() returned error %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(f *Finding)
+		wantErr bool
+	}{
+		{"Valid", func(f *Finding) {}, false},
+		{"NoPath", func(f *Finding) { f.Path = "" }, true},
+		{"NoTime", func(f *Finding) { f.Time = time.Time{} }, true},
+		{"BadCVE", func(f *Finding) { f.CVEs = []string{"CVE-44228"} }, true},
+		{"BadSHA256", func(f *Finding) { f.SHA256 = "abc" }, true},
+		{"SHA256", func(f *Finding) { f.SHA256 = strings.Repeat("ab", 32) }, false},
+		{"BadPriority", func(f *Finding) { f.Priority = "urgent" }, true},
+		{"BadVersionRange", func(f *Finding) { f.VersionRange = "2.x" }, true},
+		{"BadArtifactRange", func(f *Finding) { f.Artifacts = []Artifact{{VersionRange: "2.x"}} }, true},
+		{"BadMatchSHA256", func(f *Finding) { f.Matches = []Match{{Rule: "R", Path: "A.class", SHA256: "abc"}} }, true},
+		{"Match", func(f *Finding) { f.Matches = []Match{{Rule: "R", Path: "A.class", SHA256: strings.Repeat("ab", 32)}} }, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := testFinding
+			tc.modify(&f)
+			err := Validate(f)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Validate() returned error %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
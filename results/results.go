@@ -0,0 +1,303 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package results writes scan findings to outputs such as stdout, JSON, CSV,
+// syslog, or a webhook.
+//
+// Every output implements Sink, and sinks are safe for concurrent use, so
+// scanners with many workers can share one. New output formats only need to
+// implement Sink.
+//
+// Programs post-processing scan output can read JSON findings back with
+// Decoder, check them against the schema with Validate, and combine or
+// compare scans with Merge and Diff.
+package results
+
+import (
+	"sync"
+	"time"
+
+	"log4jscanner/hostinfo"
+	"log4jscanner/jar"
+)
+
+// Finding is a vulnerable JAR.
+type Finding struct {
+	// Path is the location of the JAR, or "-" for stdin.
+	Path string `json:"path"`
+	// Time is when the JAR was found.
+	Time time.Time `json:"time"`
+	// CVEs lists the vulnerabilities of the JAR, such as CVE-2021-44228.
+	CVEs []string `json:"cves,omitempty"`
+	// Severity is the highest severity of the CVEs.
+	Severity jar.Severity `json:"severity"`
+	// Rules lists the IDs of the rules that matched.
+	Rules []string `json:"rules,omitempty"`
+	// Log4j1 lists the IDs of the log4j 1.x rules among Rules, so end of
+	// life log4j 1.x can be told apart from log4j 2 vulnerabilities.
+	Log4j1 []string `json:"log4j1,omitempty"`
+	// Matches lists the classes the rules matched, as evidence of the
+	// finding.
+	Matches []Match `json:"matches,omitempty"`
+	// SHA256 is the hex encoded SHA-256 of the JAR, if hashing is enabled.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// MainClass and Version are taken from the JAR's manifest. Version
+	// is the version of the JAR, not log4j.
+	MainClass string `json:"mainClass,omitempty"`
+	Version   string `json:"version,omitempty"`
+	// SpringBoot is set for Spring Boot executable JARs and WARs, whose
+	// MainClass is Spring Boot's launcher and StartClass the application's
+	// main class.
+	SpringBoot bool   `json:"springBoot,omitempty"`
+	StartClass string `json:"startClass,omitempty"`
+	// Signed is set for signed JARs, whose signature is removed by
+	// rewriting them.
+	Signed bool `json:"signed,omitempty"`
+	// Salvaged is set for corrupt JARs of which only the entries that
+	// could be recovered were scanned.
+	Salvaged bool `json:"salvaged,omitempty"`
+	// BundleSymbolicName and BundleVersion identify OSGi bundles.
+	BundleSymbolicName string `json:"bundleSymbolicName,omitempty"`
+	BundleVersion      string `json:"bundleVersion,omitempty"`
+	// Module is the JBoss module (name:slot) the JAR is a resource root of.
+	Module string `json:"module,omitempty"`
+	// Coordinates are the Maven coordinates (groupId:artifactId:version) of
+	// JARs in a Maven local repository or Gradle cache, and Projects the
+	// pom.xml or build.gradle files ("path:line") declaring them.
+	Coordinates string   `json:"coordinates,omitempty"`
+	Projects    []string `json:"projects,omitempty"`
+	// Rewritten is set if the JAR was patched by the scan.
+	Rewritten bool `json:"rewritten,omitempty"`
+	// Priority is PriorityElevated for JARs in unusual locations, such as
+	// temp or upload directories, which often hold payloads dropped by an
+	// attacker rather than legitimate deployments. UnusualLocation explains
+	// why, such as "temp directory".
+	Priority        string `json:"priority,omitempty"`
+	UnusualLocation string `json:"unusualLocation,omitempty"`
+	// Provenance identifies the build that produced the JAR, if the JAR
+	// records it.
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// Bridges lists the log4j bridges and adapters bundled with the JAR,
+	// such as "log4j-to-slf4j". See jar.BridgeAdvice.
+	Bridges []string `json:"bridges,omitempty"`
+	// VersionRange is the inferred log4j version range of the JAR, such as
+	// "<2.15", and Artifacts lists the copies of log4j-core within it. See
+	// jar.Artifact.
+	VersionRange string     `json:"versionRange,omitempty"`
+	Artifacts    []Artifact `json:"artifacts,omitempty"`
+	// Log4jVersion is the exact version of the oldest copy of log4j-core,
+	// if the copies record it. See jar.Report.Log4jVersion.
+	Log4jVersion string `json:"log4jVersion,omitempty"`
+	// PIDs lists the running processes that loaded the JAR, and Deleted is
+	// set if they loaded a file that was since deleted or replaced on disk.
+	// See the proc package.
+	PIDs    []int `json:"pids,omitempty"`
+	Deleted bool  `json:"deleted,omitempty"`
+	// Stats describes the work of scanning the JAR, if verbose reports are
+	// enabled.
+	Stats *Stats `json:"stats,omitempty"`
+	// Host describes the scanned host, if enrichment is enabled.
+	Host *hostinfo.Host `json:"host,omitempty"`
+	// Baseline is the status of the JAR against a previous scan, such as
+	// BaselineNew, if compared with one. See NewBaseline.
+	Baseline string `json:"baseline,omitempty"`
+}
+
+// Artifact is a copy of log4j-core within a JAR. See jar.Artifact.
+type Artifact struct {
+	// Path is the nested archive holding the copy, or empty if it's the
+	// JAR itself.
+	Path         string   `json:"path,omitempty"`
+	VersionRange string   `json:"versionRange,omitempty"`
+	Version      string   `json:"version,omitempty"`
+	JndiLookup   bool     `json:"jndiLookup"`
+	Rules        []string `json:"rules,omitempty"`
+	Mitigation   string   `json:"mitigation,omitempty"`
+}
+
+// Match is a class a rule matched. See jar.Match.
+type Match struct {
+	Rule string `json:"rule"`
+	// Path is the class within the JAR, such as
+	// "WEB-INF/lib/log4j-core-2.14.1.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class".
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// artifactPaths returns the paths of the copies of log4j-core within the
+// JAR, including the JAR's own path for classes in the JAR itself.
+func (f Finding) artifactPaths() []string {
+	var paths []string
+	for _, a := range f.Artifacts {
+		if a.Path == "" {
+			paths = append(paths, f.Path)
+		} else {
+			paths = append(paths, f.Path+"!"+a.Path)
+		}
+	}
+	return paths
+}
+
+// Stats describes the work of scanning a JAR. See jar.Stats.
+type Stats struct {
+	MaxDepth          int   `json:"maxDepth"`
+	NestedArchives    int   `json:"nestedArchives"`
+	InPlaceArchives   int   `json:"inPlaceArchives"`
+	DecompressedBytes int64 `json:"decompressedBytes"`
+	// DurationMillis is how long the scan took in milliseconds.
+	DurationMillis int64 `json:"durationMillis"`
+}
+
+// NewStats converts the stats of a jar.Report.
+func NewStats(s jar.Stats) *Stats {
+	return &Stats{
+		MaxDepth:          s.MaxDepth,
+		NestedArchives:    s.NestedArchives,
+		InPlaceArchives:   s.InPlaceArchives,
+		DecompressedBytes: s.DecompressedBytes,
+		DurationMillis:    s.Duration.Milliseconds(),
+	}
+}
+
+// Provenance is the build metadata of a JAR. See jar.Provenance.
+type Provenance struct {
+	Comment   string `json:"comment,omitempty"`
+	BuiltBy   string `json:"builtBy,omitempty"`
+	BuildJdk  string `json:"buildJdk,omitempty"`
+	CreatedBy string `json:"createdBy,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	// ManifestModified is formatted as RFC 3339, or empty.
+	ManifestModified string `json:"manifestModified,omitempty"`
+}
+
+// PriorityElevated is the Priority of findings in unusual locations.
+const PriorityElevated = "elevated"
+
+// FromReport returns the finding of a vulnerable JAR's report.
+func FromReport(path string, r *jar.Report) Finding {
+	var prov *Provenance
+	if p := r.Provenance; p != (jar.Provenance{}) {
+		prov = &Provenance{
+			Comment:   p.Comment,
+			BuiltBy:   p.BuiltBy,
+			BuildJdk:  p.BuildJdk,
+			CreatedBy: p.CreatedBy,
+			BuildTime: p.BuildTime,
+		}
+		if !p.ManifestModified.IsZero() {
+			prov.ManifestModified = p.ManifestModified.Format(time.RFC3339)
+		}
+	}
+	var artifacts []Artifact
+	for _, a := range r.Artifacts {
+		artifacts = append(artifacts, Artifact{
+			Path:         a.Path,
+			VersionRange: a.VersionRange,
+			Version:      a.Version,
+			JndiLookup:   a.JndiLookup,
+			Rules:        a.Rules,
+			Mitigation:   a.Mitigation,
+		})
+	}
+	var matches []Match
+	for _, m := range r.Matches {
+		matches = append(matches, Match{Rule: m.Rule, Path: m.Path, SHA256: m.SHA256})
+	}
+	return Finding{
+		Path:               path,
+		Time:               time.Now().UTC(),
+		CVEs:               r.CVEs,
+		Severity:           r.Severity(),
+		Rules:              r.Rules,
+		Log4j1:             r.Log4j1,
+		Matches:            matches,
+		SHA256:             r.SHA256,
+		MainClass:          r.MainClass,
+		Version:            r.Version,
+		SpringBoot:         r.SpringBoot,
+		StartClass:         r.StartClass,
+		Signed:             r.Signed,
+		Salvaged:           r.Salvaged,
+		BundleSymbolicName: r.Bundle.SymbolicName,
+		BundleVersion:      r.Bundle.Version,
+		Provenance:         prov,
+		Bridges:            r.Bridges,
+		VersionRange:       r.VersionRange(),
+		Artifacts:          artifacts,
+		Log4jVersion:       r.Log4jVersion(),
+	}
+}
+
+// Sink is an output of findings. Implementations are safe for concurrent
+// use.
+type Sink interface {
+	// Write outputs a finding. Sinks may buffer findings until Flush.
+	Write(f Finding) error
+	// Flush outputs buffered findings.
+	Flush() error
+	// Close flushes the sink and releases its resources.
+	Close() error
+}
+
+// multi writes to several sinks.
+type multi []Sink
+
+// Multi returns a sink writing every finding to each of the sinks. Errors of
+// one sink don't prevent writing to the others, the first error is returned.
+func Multi(sinks ...Sink) Sink {
+	return multi(sinks)
+}
+
+func (m multi) each(fn func(s Sink) error) error {
+	var first error
+	for _, s := range m {
+		if err := fn(s); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (m multi) Write(f Finding) error {
+	return m.each(func(s Sink) error { return s.Write(f) })
+}
+
+func (m multi) Flush() error {
+	return m.each(func(s Sink) error { return s.Flush() })
+}
+
+func (m multi) Close() error {
+	return m.each(func(s Sink) error { return s.Close() })
+}
+
+// Func adapts a function to a Sink, serializing calls to it. Flush and Close
+// do nothing.
+func Func(fn func(f Finding) error) Sink {
+	return &funcSink{fn: fn}
+}
+
+type funcSink struct {
+	mu sync.Mutex
+	fn func(f Finding) error
+}
+
+func (s *funcSink) Write(f Finding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fn(f)
+}
+
+func (s *funcSink) Flush() error { return nil }
+func (s *funcSink) Close() error { return nil }
@@ -0,0 +1,203 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+var testFinding = Finding{
+	Path:     "/opt/app/log4j-core-2.14.1.jar",
+	Time:     time.Date(2021, 12, 20, 10, 0, 0, 0, time.UTC),
+	CVEs:     []string{jar.CVE202144228, jar.CVE202145046},
+	Severity: jar.SeverityCritical,
+	Rules:    []string{jar.RuleLog4j44228Constructor},
+	Version:  "2.14.1",
+	Module:   "org.apache.log4j:main",
+	Provenance: &Provenance{
+		BuiltBy: "jenkins",
+	},
+	VersionRange: jar.VersionBefore215,
+	Artifacts:    []Artifact{{VersionRange: jar.VersionBefore215, Version: "2.14.1", JndiLookup: true}},
+	Log4jVersion: "2.14.1",
+	PIDs:         []int{1234},
+}
+
+func TestText(t *testing.T) {
+	var b bytes.Buffer
+	s := NewText(&b)
+	s.Write(testFinding)
+	s.Format = func(f Finding) string { return f.Path + " (" + f.Module + ")" }
+	s.Write(testFinding)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	want := "/opt/app/log4j-core-2.14.1.jar\n/opt/app/log4j-core-2.14.1.jar (org.apache.log4j:main)\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("Text wrote diff (-want, +got): %s", diff)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var b bytes.Buffer
+	s := NewJSON(&b)
+	if err := s.Write(testFinding); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	var got Finding
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("decoding output %q: %v", b.String(), err)
+	}
+	if diff := cmp.Diff(testFinding, got); diff != "" {
+		t.Errorf("JSON round trip returned diff (-want, +got): %s", diff)
+	}
+	if !strings.Contains(b.String(), `"severity":"critical"`) {
+		t.Errorf("JSON output doesn't encode severity by name: %s", b.String())
+	}
+}
+
+func TestCSV(t *testing.T) {
+	var b bytes.Buffer
+	s := NewCSV(&b)
+	if err := s.Write(testFinding); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	got, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing output: %v", err)
+	}
+	want := [][]string{
+		csvHeader,
+		{
+			"/opt/app/log4j-core-2.14.1.jar", "2021-12-20T10:00:00Z",
+			"CVE-2021-44228;CVE-2021-45046", "critical", "LOG4J-44228-CONSTRUCTOR",
+			"", "2.14.1", "", "", "org.apache.log4j:main", "",
+			"", "", "jenkins", "", "", "", "", "", "", "", "", "", "", "",
+			"<2.15", "/opt/app/log4j-core-2.14.1.jar", "2.14.1", "1234", "", "", "", "", "",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CSV wrote diff (-want, +got): %s", diff)
+	}
+}
+
+func TestCSVEmpty(t *testing.T) {
+	var b bytes.Buffer
+	if err := NewCSV(&b).Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if got, want := b.String(), strings.Join(csvHeader, ",")+"\n"; got != want {
+		t.Errorf("CSV without findings wrote %q, want %q", got, want)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	var got []string
+	failing := Func(func(f Finding) error { return errors.New("failed") })
+	recording := Func(func(f Finding) error {
+		got = append(got, f.Path)
+		return nil
+	})
+	s := Multi(failing, recording)
+	if err := s.Write(testFinding); err == nil {
+		t.Errorf("Write() succeeded with a failing sink, want error")
+	}
+	if diff := cmp.Diff([]string{testFinding.Path}, got); diff != "" {
+		t.Errorf("Multi didn't write to every sink (-want, +got): %s", diff)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads []WebhookPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("webhook request has Authorization %q, want %q", got, "Bearer token")
+		}
+		var p WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decoding webhook payload: %v", err)
+		}
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := &Webhook{
+		URL:       srv.URL,
+		Host:      "host1",
+		Header:    http.Header{"Authorization": {"Bearer token"}},
+		BatchSize: 2,
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Write(testFinding); err != nil {
+				t.Errorf("Write() failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	var sizes []int
+	for _, p := range payloads {
+		if p.Host != "host1" {
+			t.Errorf("webhook payload has host %q, want %q", p.Host, "host1")
+		}
+		sizes = append(sizes, len(p.Findings))
+	}
+	if diff := cmp.Diff([]int{2, 2, 1}, sizes); diff != "" {
+		t.Errorf("webhook batches diff (-want, +got): %s", diff)
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	s := &Webhook{URL: srv.URL}
+	s.Write(testFinding)
+	if err := s.Flush(); err == nil {
+		t.Errorf("Flush() succeeded with a failing endpoint, want error")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"log4jscanner/jar"
+)
+
+// Counts holds the number of findings of each severity.
+type Counts map[jar.Severity]int
+
+// String formats the counts as "severity=count" pairs, most severe first.
+func (c Counts) String() string {
+	var sevs []jar.Severity
+	for s := range c {
+		sevs = append(sevs, s)
+	}
+	sort.Slice(sevs, func(i, j int) bool { return sevs[i] > sevs[j] })
+	var pairs []string
+	for _, s := range sevs {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", s, c[s]))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// CountWriter is implemented by sinks that can output the counts of findings
+// omitted by a Sampler.
+type CountWriter interface {
+	WriteCounts(c Counts) error
+}
+
+// Sampler passes findings of at least a minimum severity to a sink, and only
+// counts the others. This keeps the volume of fleet-wide results manageable
+// without losing the critical ones.
+type Sampler struct {
+	sink Sink
+	min  jar.Severity
+
+	mu     sync.Mutex
+	counts Counts
+}
+
+// NewSampler returns a sink writing findings of at least severity min to s.
+func NewSampler(s Sink, min jar.Severity) *Sampler {
+	return &Sampler{sink: s, min: min, counts: Counts{}}
+}
+
+func (s *Sampler) Write(f Finding) error {
+	if f.Severity >= s.min {
+		return s.sink.Write(f)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[f.Severity]++
+	return nil
+}
+
+// Counts returns the number of omitted findings of each severity.
+func (s *Sampler) Counts() Counts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := Counts{}
+	for sev, n := range s.counts {
+		c[sev] = n
+	}
+	return c
+}
+
+func (s *Sampler) Flush() error {
+	return s.sink.Flush()
+}
+
+// Close writes the counts of omitted findings to the sink, if it implements
+// CountWriter and findings were omitted, then closes it.
+func (s *Sampler) Close() error {
+	var err error
+	if c := s.Counts(); len(c) > 0 {
+		if cw, ok := s.sink.(CountWriter); ok {
+			err = cw.WriteCounts(c)
+		}
+	}
+	if cerr := s.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WriteCounts writes the counts to every sink implementing CountWriter.
+func (m multi) WriteCounts(c Counts) error {
+	return m.each(func(s Sink) error {
+		if cw, ok := s.(CountWriter); ok {
+			return cw.WriteCounts(c)
+		}
+		return nil
+	})
+}
+
+// WriteCounts writes a {"omitted": {"low": 3}} object.
+func (j *JSON) WriteCounts(c Counts) error {
+	b, err := json.Marshal(struct {
+		Omitted Counts `json:"omitted"`
+	}{c})
+	if err != nil {
+		return fmt.Errorf("encoding counts: %v", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteCounts sends the counts with the next request.
+func (w *Webhook) WriteCounts(c Counts) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.omitted = c
+	return w.flush()
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func TestSampler(t *testing.T) {
+	var b bytes.Buffer
+	var paths []string
+	recording := Func(func(f Finding) error {
+		paths = append(paths, f.Path)
+		return nil
+	})
+	s := NewSampler(Multi(recording, NewJSON(&b)), jar.SeverityHigh)
+	for _, sev := range []jar.Severity{
+		jar.SeverityCritical, jar.SeverityLow, jar.SeverityHigh,
+		jar.SeverityNone, jar.SeverityLow, jar.SeverityMedium,
+	} {
+		f := testFinding
+		f.Path = sev.String() + ".jar"
+		f.Severity = sev
+		if err := s.Write(f); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"critical.jar", "high.jar"}, paths); diff != "" {
+		t.Errorf("Sampler wrote diff (-want, +got): %s", diff)
+	}
+	wantCounts := Counts{jar.SeverityNone: 1, jar.SeverityLow: 2, jar.SeverityMedium: 1}
+	if diff := cmp.Diff(wantCounts, s.Counts()); diff != "" {
+		t.Errorf("Counts() returned diff (-want, +got): %s", diff)
+	}
+	if got, want := s.Counts().String(), "medium=1, low=2, none=1"; got != want {
+		t.Errorf("Counts().String() = %q, want %q", got, want)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("JSON wrote %d lines, want 3: %s", len(lines), b.String())
+	}
+	if got, want := string(lines[2]), `{"omitted":{"low":2,"medium":1,"none":1}}`; got != want {
+		t.Errorf("JSON wrote counts %s, want %s", got, want)
+	}
+}
+
+func TestSamplerWebhook(t *testing.T) {
+	var payloads []WebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decoding webhook payload: %v", err)
+		}
+		payloads = append(payloads, p)
+	}))
+	defer srv.Close()
+
+	s := NewSampler(&Webhook{URL: srv.URL}, jar.SeverityCritical)
+	s.Write(testFinding)
+	low := testFinding
+	low.Severity = jar.SeverityLow
+	s.Write(low)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("webhook received %d requests, want 1", len(payloads))
+	}
+	if got := len(payloads[0].Findings); got != 1 {
+		t.Errorf("webhook payload has %d findings, want 1", got)
+	}
+	if diff := cmp.Diff(Counts{jar.SeverityLow: 1}, payloads[0].Omitted); diff != "" {
+		t.Errorf("webhook payload omitted diff (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"log4jscanner/jar"
+)
+
+// SARIF 2.1.0, the Static Analysis Results Interchange Format, is read by
+// GitHub code scanning, DefectDojo, and other security dashboards. See
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://docs.oasis-open.org/sarif/sarif/v2.1.0/errata01/os/schemas/sarif-schema-2.1.0.json"
+	// sarifToolURI is the informationUri of the scanner.
+	sarifToolURI = "https://github.com/google/log4jscanner"
+)
+
+// SARIFLog is a SARIF log holding a single run of the scanner. Only the
+// properties the scanner reports are defined.
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is a run of the scanner, its rules and results.
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool describes the scanner, along with the rules its results
+// reference.
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver is the scanner's tool component.
+type SARIFDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []SARIFRule `json:"rules"`
+}
+
+// SARIFRule is a detection rule, see jar.Rule.
+type SARIFRule struct {
+	ID               string            `json:"id"`
+	ShortDescription SARIFMessage      `json:"shortDescription"`
+	HelpURI          string            `json:"helpUri,omitempty"`
+	Properties       SARIFRuleProperty `json:"properties"`
+}
+
+// SARIFRuleProperty holds the properties of a rule. SecuritySeverity is
+// the CVSS-like score GitHub ranks results by, and Tags hold the CVE.
+type SARIFRuleProperty struct {
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+	Severity         string   `json:"severity,omitempty"`
+	Tags             []string `json:"tags"`
+}
+
+// SARIFMessage is a plain text message.
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFResult is a rule matching a vulnerable JAR.
+type SARIFResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   SARIFMessage    `json:"message"`
+	Locations []SARIFLocation `json:"locations"`
+	// PartialFingerprints identify the JAR by its SHA-256, if hashed, so
+	// dashboards can track it across moves.
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+// SARIFLocation is the JAR a result was found in, and the classes within it
+// the rule matched, such as "lib/app.war!WEB-INF/lib/log4j-core.jar!
+// org/apache/logging/log4j/core/lookup/JndiLookup.class", as logical
+// locations.
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+	LogicalLocations []SARIFLogical        `json:"logicalLocations,omitempty"`
+}
+
+// SARIFPhysicalLocation is the file of a location.
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+}
+
+// SARIFArtifactLocation is the URI of a file, relative for relative paths.
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SARIFLogical is a nested path within a JAR.
+type SARIFLogical struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifScores are the security-severity scores of severities, within the
+// ranges GitHub maps to the same severity.
+var sarifScores = map[jar.Severity]string{
+	jar.SeverityLow:      "3.0",
+	jar.SeverityMedium:   "5.0",
+	jar.SeverityHigh:     "8.0",
+	jar.SeverityCritical: "10.0",
+}
+
+// sarifLevel returns the SARIF level of a severity.
+func sarifLevel(s jar.Severity) string {
+	switch {
+	case s >= jar.SeverityHigh:
+		return "error"
+	case s == jar.SeverityMedium:
+		return "warning"
+	}
+	return "note"
+}
+
+// sarifURI returns the URI of a path: a file URI if it's absolute, otherwise
+// a relative reference with forward slashes.
+func sarifURI(p string) string {
+	if p == "-" {
+		return "stdin"
+	}
+	slash := filepath.ToSlash(p)
+	if !filepath.IsAbs(p) && !strings.HasPrefix(slash, "/") {
+		return (&url.URL{Path: slash}).String()
+	}
+	if !strings.HasPrefix(slash, "/") {
+		// Windows paths, such as C:/app/lib/a.jar.
+		slash = "/" + slash
+	}
+	return (&url.URL{Scheme: "file", Path: slash}).String()
+}
+
+// NewSARIFLog returns the SARIF log of the findings, with a result for each
+// rule matching each JAR, ordered by path. JARs rewritten by the scan are
+// left out.
+func NewSARIFLog(findings []Finding) *SARIFLog {
+	findings = append([]Finding(nil), findings...)
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Path < findings[j].Path })
+
+	used := map[string]bool{}
+	for _, f := range findings {
+		if f.Rewritten {
+			continue
+		}
+		for _, id := range f.Rules {
+			used[id] = true
+		}
+	}
+	driver := SARIFDriver{Name: "log4jscanner", InformationURI: sarifToolURI, Rules: []SARIFRule{}}
+	index := map[string]int{}
+	for _, r := range jar.Rules {
+		if !used[r.ID] {
+			continue
+		}
+		index[r.ID] = len(driver.Rules)
+		sev := jar.CVESeverity(r.CVE)
+		rule := SARIFRule{
+			ID:               r.ID,
+			ShortDescription: SARIFMessage{Text: r.Description},
+			Properties: SARIFRuleProperty{
+				SecuritySeverity: sarifScores[sev],
+				Tags:             []string{"security", r.CVE},
+			},
+		}
+		if sev != jar.SeverityNone {
+			rule.Properties.Severity = sev.String()
+		}
+		if strings.HasPrefix(r.CVE, "CVE-") {
+			rule.HelpURI = "https://nvd.nist.gov/vuln/detail/" + r.CVE
+		}
+		driver.Rules = append(driver.Rules, rule)
+	}
+
+	results := []SARIFResult{}
+	for _, f := range findings {
+		if f.Rewritten {
+			// Rewritten JARs are no longer vulnerable.
+			continue
+		}
+		for _, id := range f.Rules {
+			i, ok := index[id]
+			if !ok {
+				// Rules unknown to this build, such as in findings
+				// read back from another scanner's output.
+				continue
+			}
+			rule, _ := jar.LookupRule(id)
+			loc := SARIFLocation{PhysicalLocation: SARIFPhysicalLocation{
+				ArtifactLocation: SARIFArtifactLocation{URI: sarifURI(f.Path)},
+			}}
+			for _, m := range f.Matches {
+				if m.Rule == id {
+					loc.LogicalLocations = append(loc.LogicalLocations, SARIFLogical{FullyQualifiedName: m.Path, Kind: "type"})
+				}
+			}
+			res := SARIFResult{
+				RuleID:    id,
+				RuleIndex: i,
+				Level:     sarifLevel(jar.CVESeverity(rule.CVE)),
+				Message:   SARIFMessage{Text: sarifMessage(f, rule)},
+				Locations: []SARIFLocation{loc},
+			}
+			if f.SHA256 != "" {
+				res.PartialFingerprints = map[string]string{"sha256/v1": f.SHA256}
+			}
+			results = append(results, res)
+		}
+	}
+	return &SARIFLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []SARIFRun{{Tool: SARIFTool{Driver: driver}, Results: results}},
+	}
+}
+
+// sarifMessage describes a rule matching a JAR.
+func sarifMessage(f Finding, r jar.Rule) string {
+	msg := fmt.Sprintf("%s is vulnerable to %s: %s", f.Path, r.CVE, r.Description)
+	if f.Log4jVersion != "" {
+		msg += fmt.Sprintf(" (log4j %s)", f.Log4jVersion)
+	}
+	return msg
+}
+
+// SARIF is a sink writing a SARIF log of the findings on Close. Findings of
+// the same path replace each other.
+type SARIF struct {
+	w io.Writer
+
+	mu       sync.Mutex
+	findings map[string]Finding
+}
+
+// NewSARIF returns a sink writing a SARIF log of the findings to w on Close.
+func NewSARIF(w io.Writer) *SARIF {
+	return &SARIF{w: w, findings: map[string]Finding{}}
+}
+
+func (s *SARIF) Write(f Finding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.findings[f.Path] = f
+	return nil
+}
+
+// Flush does nothing, as a SARIF log is a single document written once the
+// scan is complete.
+func (s *SARIF) Flush() error { return nil }
+
+// Close writes the SARIF log.
+func (s *SARIF) Close() error {
+	s.mu.Lock()
+	findings := make([]Finding, 0, len(s.findings))
+	for _, f := range s.findings {
+		findings = append(findings, f)
+	}
+	s.mu.Unlock()
+
+	enc := json.NewEncoder(s.w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(NewSARIFLog(findings)); err != nil {
+		return fmt.Errorf("writing SARIF log: %v", err)
+	}
+	return nil
+}
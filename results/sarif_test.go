@@ -0,0 +1,171 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func TestSARIFLog(t *testing.T) {
+	vuln := Finding{
+		Path:     "lib/app.war",
+		CVEs:     []string{jar.CVE202144228, jar.CVE202145046},
+		Severity: jar.SeverityCritical,
+		Rules:    []string{jar.RuleLog4j44228Constructor, jar.RuleLog4j216Heuristic},
+		Matches: []Match{
+			{Rule: jar.RuleLog4j44228Constructor, Path: "WEB-INF/lib/log4j-core.jar!org/apache/logging/log4j/core/net/JndiManager.class"},
+			{Rule: jar.RuleLog4j216Heuristic, Path: "WEB-INF/lib/log4j-core.jar!org/apache/logging/log4j/core/lookup/JndiLookup.class"},
+		},
+		SHA256:       "abc",
+		Log4jVersion: "2.14.1",
+	}
+	jdbc := Finding{
+		Path:     "a b/jdbc.jar",
+		CVEs:     []string{jar.CVE202144832},
+		Severity: jar.SeverityMedium,
+		Rules:    []string{jar.RuleLog4j44832JDBC},
+	}
+	rewritten := vuln
+	rewritten.Path = "lib/rewritten.jar"
+	rewritten.Rewritten = true
+
+	constructor, _ := jar.LookupRule(jar.RuleLog4j44228Constructor)
+	heuristic, _ := jar.LookupRule(jar.RuleLog4j216Heuristic)
+	jdbcRule, _ := jar.LookupRule(jar.RuleLog4j44832JDBC)
+	want := &SARIFLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs: []SARIFRun{{
+			Tool: SARIFTool{Driver: SARIFDriver{
+				Name:           "log4jscanner",
+				InformationURI: sarifToolURI,
+				Rules: []SARIFRule{
+					{
+						ID:               jar.RuleLog4j44228Constructor,
+						ShortDescription: SARIFMessage{Text: constructor.Description},
+						HelpURI:          "https://nvd.nist.gov/vuln/detail/CVE-2021-44228",
+						Properties:       SARIFRuleProperty{SecuritySeverity: "10.0", Severity: "critical", Tags: []string{"security", jar.CVE202144228}},
+					},
+					{
+						ID:               jar.RuleLog4j216Heuristic,
+						ShortDescription: SARIFMessage{Text: heuristic.Description},
+						HelpURI:          "https://nvd.nist.gov/vuln/detail/CVE-2021-45046",
+						Properties:       SARIFRuleProperty{SecuritySeverity: "10.0", Severity: "critical", Tags: []string{"security", jar.CVE202145046}},
+					},
+					{
+						ID:               jar.RuleLog4j44832JDBC,
+						ShortDescription: SARIFMessage{Text: jdbcRule.Description},
+						HelpURI:          "https://nvd.nist.gov/vuln/detail/CVE-2021-44832",
+						Properties:       SARIFRuleProperty{SecuritySeverity: "5.0", Severity: "medium", Tags: []string{"security", jar.CVE202144832}},
+					},
+				},
+			}},
+			Results: []SARIFResult{
+				{
+					RuleID:    jar.RuleLog4j44832JDBC,
+					RuleIndex: 2,
+					Level:     "warning",
+					Message:   SARIFMessage{Text: "a b/jdbc.jar is vulnerable to CVE-2021-44832: " + jdbcRule.Description},
+					Locations: []SARIFLocation{{PhysicalLocation: SARIFPhysicalLocation{ArtifactLocation: SARIFArtifactLocation{URI: "a%20b/jdbc.jar"}}}},
+				},
+				{
+					RuleID:    jar.RuleLog4j44228Constructor,
+					RuleIndex: 0,
+					Level:     "error",
+					Message:   SARIFMessage{Text: "lib/app.war is vulnerable to CVE-2021-44228: " + constructor.Description + " (log4j 2.14.1)"},
+					Locations: []SARIFLocation{{
+						PhysicalLocation: SARIFPhysicalLocation{ArtifactLocation: SARIFArtifactLocation{URI: "lib/app.war"}},
+						LogicalLocations: []SARIFLogical{{FullyQualifiedName: vuln.Matches[0].Path, Kind: "type"}},
+					}},
+					PartialFingerprints: map[string]string{"sha256/v1": "abc"},
+				},
+				{
+					RuleID:    jar.RuleLog4j216Heuristic,
+					RuleIndex: 1,
+					Level:     "error",
+					Message:   SARIFMessage{Text: "lib/app.war is vulnerable to CVE-2021-45046: " + heuristic.Description + " (log4j 2.14.1)"},
+					Locations: []SARIFLocation{{
+						PhysicalLocation: SARIFPhysicalLocation{ArtifactLocation: SARIFArtifactLocation{URI: "lib/app.war"}},
+						LogicalLocations: []SARIFLogical{{FullyQualifiedName: vuln.Matches[1].Path, Kind: "type"}},
+					}},
+					PartialFingerprints: map[string]string{"sha256/v1": "abc"},
+				},
+			},
+		}},
+	}
+	got := NewSARIFLog([]Finding{rewritten, vuln, jdbc})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("NewSARIFLog() returned diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestSARIFURI(t *testing.T) {
+	abs, absURI := "/opt/app/lib/a.jar", "file:///opt/app/lib/a.jar"
+	if runtime.GOOS == "windows" {
+		abs, absURI = `C:\app\lib\a.jar`, "file:///C:/app/lib/a.jar"
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "-", want: "stdin"},
+		{path: "lib/a.jar", want: "lib/a.jar"},
+		{path: "lib/a b#1.jar", want: "lib/a%20b%231.jar"},
+		{path: abs, want: absURI},
+	}
+	for _, tc := range tests {
+		if got := sarifURI(tc.path); got != tc.want {
+			t.Errorf("sarifURI(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	var b bytes.Buffer
+	s := NewSARIF(&b)
+	f := Finding{
+		Path:     "/opt/app.jar",
+		CVEs:     []string{jar.CVE202144228},
+		Severity: jar.SeverityCritical,
+		Rules:    []string{jar.RuleLog4j44228Constructor},
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Write(f); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("decoding SARIF log: %v", err)
+	}
+	if got["version"] != "2.1.0" || got["$schema"] != sarifSchema {
+		t.Errorf("SARIF log has version %v and schema %v, want 2.1.0 and %s", got["version"], got["$schema"], sarifSchema)
+	}
+	runs := got["runs"].([]interface{})
+	results := runs[0].(map[string]interface{})["results"].([]interface{})
+	if len(results) != 1 {
+		t.Errorf("SARIF log has %d results, want 1 for the JAR written twice", len(results))
+	}
+}
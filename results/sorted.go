@@ -0,0 +1,73 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"sort"
+	"sync"
+)
+
+// sorted buffers findings until Close.
+type sorted struct {
+	sink Sink
+
+	mu       sync.Mutex
+	findings []Finding
+}
+
+// Sorted returns a sink holding every finding until Close, then writing them
+// to s ordered by path. Scanners with many workers report findings in an
+// order that varies between runs, sorting keeps the output of runs
+// comparable. Flush does nothing, as findings can't be output before the scan
+// completes.
+func Sorted(s Sink) Sink {
+	return &sorted{sink: s}
+}
+
+func (s *sorted) Write(f Finding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.findings = append(s.findings, f)
+	return nil
+}
+
+func (s *sorted) Flush() error { return nil }
+
+// Close writes the findings, rewritten JARs after their original report,
+// then closes the sink.
+func (s *sorted) Close() error {
+	s.mu.Lock()
+	findings := s.findings
+	s.findings = nil
+	s.mu.Unlock()
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return !a.Rewritten && b.Rewritten
+	})
+	var err error
+	for _, f := range findings {
+		if werr := s.sink.Write(f); err == nil {
+			err = werr
+		}
+	}
+	if cerr := s.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
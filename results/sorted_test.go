@@ -0,0 +1,67 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSorted(t *testing.T) {
+	type entry struct {
+		Path      string
+		Rewritten bool
+	}
+	var got []entry
+	s := Sorted(Func(func(f Finding) error {
+		got = append(got, entry{f.Path, f.Rewritten})
+		return nil
+	}))
+	in := []entry{
+		{"/opt/b.jar", true}, {"/opt/c.jar", false}, {"/opt/a.jar", false},
+		{"/opt/b.jar", false}, {"/opt/a/z.jar", false},
+	}
+	var wg sync.WaitGroup
+	for _, e := range in {
+		wg.Add(1)
+		go func(e entry) {
+			defer wg.Done()
+			f := testFinding
+			f.Path, f.Rewritten = e.Path, e.Rewritten
+			if err := s.Write(f); err != nil {
+				t.Errorf("Write() failed: %v", err)
+			}
+		}(e)
+	}
+	wg.Wait()
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Sorted wrote %d findings before Close, want 0", len(got))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	want := []entry{
+		{"/opt/a.jar", false}, {"/opt/a/z.jar", false}, {"/opt/b.jar", false},
+		{"/opt/b.jar", true}, {"/opt/c.jar", false},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Sorted wrote diff (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !plan9 && !js
+
+package results
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"strings"
+	"sync"
+
+	"log4jscanner/jar"
+)
+
+// Syslog sends a message per finding to syslog, with a priority derived from
+// its severity.
+type Syslog struct {
+	mu sync.Mutex
+	w  *syslog.Writer
+}
+
+// NewSyslog connects to syslog. An empty address or "local" uses the local
+// syslog daemon, otherwise the address is a URL such as "udp://host:514" or
+// "tcp://host:514".
+func NewSyslog(addr, tag string) (*Syslog, error) {
+	var network, raddr string
+	if addr != "" && addr != "local" {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, fmt.Errorf("invalid syslog address %q, expected \"local\" or a URL such as udp://host:514", addr)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_WARNING|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to syslog: %v", err)
+	}
+	return &Syslog{w: w}, nil
+}
+
+func (s *Syslog) Write(f Finding) error {
+	msg := syslogMessage(f)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch f.Severity {
+	case jar.SeverityCritical:
+		return s.w.Crit(msg)
+	case jar.SeverityHigh:
+		return s.w.Err(msg)
+	case jar.SeverityMedium:
+		return s.w.Warning(msg)
+	default:
+		return s.w.Notice(msg)
+	}
+}
+
+func (s *Syslog) Flush() error { return nil }
+
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Close()
+}
+
+// syslogMessage formats a finding as key=value pairs, which most log
+// pipelines parse without configuration.
+func syslogMessage(f Finding) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "vulnerable path=%q severity=%s", f.Path, f.Severity)
+	if len(f.CVEs) > 0 {
+		fmt.Fprintf(&b, " cves=%s", strings.Join(f.CVEs, ","))
+	}
+	if f.Version != "" {
+		fmt.Fprintf(&b, " version=%q", f.Version)
+	}
+	if f.Module != "" {
+		fmt.Fprintf(&b, " module=%q", f.Module)
+	}
+	if f.Coordinates != "" {
+		fmt.Fprintf(&b, " coordinates=%q", f.Coordinates)
+	}
+	if f.Rewritten {
+		fmt.Fprintf(&b, " rewritten=true")
+	}
+	if f.SHA256 != "" {
+		fmt.Fprintf(&b, " sha256=%s", f.SHA256)
+	}
+	if f.Priority != "" {
+		fmt.Fprintf(&b, " priority=%s location=%q", f.Priority, f.UnusualLocation)
+	}
+	if h := f.Host; h != nil {
+		if h.FQDN != "" {
+			fmt.Fprintf(&b, " fqdn=%s", h.FQDN)
+		}
+		if h.InstanceID != "" {
+			fmt.Fprintf(&b, " instance=%s", h.InstanceID)
+		}
+		if len(h.Tags) > 0 {
+			fmt.Fprintf(&b, " tags=%q", h.TagString(","))
+		}
+	}
+	return b.String()
+}
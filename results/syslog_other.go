@@ -0,0 +1,32 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows || plan9 || js
+
+package results
+
+import "errors"
+
+// Syslog sends a message per finding to syslog. It's unsupported on this
+// platform.
+type Syslog struct{}
+
+// NewSyslog returns an error, since syslog is unsupported on this platform.
+func NewSyslog(addr, tag string) (*Syslog, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (s *Syslog) Write(f Finding) error { return nil }
+func (s *Syslog) Flush() error          { return nil }
+func (s *Syslog) Close() error          { return nil }
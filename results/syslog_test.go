@@ -0,0 +1,54 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !plan9 && !js
+
+package results
+
+import (
+	"testing"
+
+	"log4jscanner/hostinfo"
+)
+
+func TestSyslogMessage(t *testing.T) {
+	got := syslogMessage(testFinding)
+	want := `vulnerable path="/opt/app/log4j-core-2.14.1.jar" severity=critical cves=CVE-2021-44228,CVE-2021-45046 version="2.14.1" module="org.apache.log4j:main"`
+	if got != want {
+		t.Errorf("syslogMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestSyslogMessageHost(t *testing.T) {
+	f := testFinding
+	f.Host = &hostinfo.Host{
+		Hostname:   "web1",
+		FQDN:       "web1.example.com",
+		InstanceID: "i-0123456789abcdef0",
+		Tags:       map[string]string{"team": "payments", "env": "prod"},
+	}
+	got := syslogMessage(f)
+	want := `vulnerable path="/opt/app/log4j-core-2.14.1.jar" severity=critical cves=CVE-2021-44228,CVE-2021-45046 version="2.14.1" module="org.apache.log4j:main" fqdn=web1.example.com instance=i-0123456789abcdef0 tags="env=prod,team=payments"`
+	if got != want {
+		t.Errorf("syslogMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestNewSyslogInvalid(t *testing.T) {
+	for _, addr := range []string{"host:514", "http://host:514", "udp://"} {
+		if _, err := NewSyslog(addr, "log4jscanner"); err == nil {
+			t.Errorf("NewSyslog(%q) succeeded, want error", addr)
+		}
+	}
+}
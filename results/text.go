@@ -0,0 +1,206 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"log4jscanner/hostinfo"
+)
+
+// Text writes a line per finding, by default only the path. Output is
+// written through as findings arrive, so it can be piped.
+type Text struct {
+	// Format, if provided, returns the line of a finding.
+	Format func(f Finding) string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewText returns a sink writing lines to w.
+func NewText(w io.Writer) *Text {
+	return &Text{w: w}
+}
+
+func (t *Text) Write(f Finding) error {
+	line := f.Path
+	if t.Format != nil {
+		line = t.Format(f)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := fmt.Fprintln(t.w, line)
+	return err
+}
+
+func (t *Text) Flush() error { return nil }
+func (t *Text) Close() error { return nil }
+
+// JSON writes a JSON object per line (JSON Lines).
+type JSON struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// NewJSON returns a sink writing JSON Lines to w.
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{w: bufio.NewWriter(w)}
+}
+
+func (j *JSON) Write(f Finding) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("encoding finding: %v", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (j *JSON) Flush() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.w.Flush()
+}
+
+func (j *JSON) Close() error {
+	return j.Flush()
+}
+
+// csvHeader holds the columns written by the CSV sink.
+var csvHeader = []string{
+	"path", "time", "cves", "severity", "rules", "main_class", "version",
+	"bundle_symbolic_name", "bundle_version", "module", "rewritten",
+	"priority", "unusual_location", "built_by", "build_jdk", "created_by",
+	"build_time", "zip_comment", "manifest_modified", "sha256",
+	"hostname", "fqdn", "instance_id", "image_id", "tags", "version_range",
+	"log4j_paths", "log4j_version", "pids", "deleted", "baseline",
+	"coordinates", "projects", "signed",
+}
+
+// CSV writes a header and a row per finding. Lists are separated by ";".
+type CSV struct {
+	mu     sync.Mutex
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSV returns a sink writing CSV to w.
+func NewCSV(w io.Writer) *CSV {
+	return &CSV{w: csv.NewWriter(w)}
+}
+
+func (c *CSV) Write(f Finding) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	rewritten := ""
+	if f.Rewritten {
+		rewritten = "true"
+	}
+	deleted := ""
+	if f.Deleted {
+		deleted = "true"
+	}
+	signed := ""
+	if f.Signed {
+		signed = "true"
+	}
+	var pids []string
+	for _, pid := range f.PIDs {
+		pids = append(pids, strconv.Itoa(pid))
+	}
+	host := f.Host
+	if host == nil {
+		host = &hostinfo.Host{}
+	}
+	prov := f.Provenance
+	if prov == nil {
+		prov = &Provenance{}
+	}
+	return c.w.Write([]string{
+		f.Path,
+		f.Time.Format(time.RFC3339),
+		strings.Join(f.CVEs, ";"),
+		f.Severity.String(),
+		strings.Join(f.Rules, ";"),
+		f.MainClass,
+		f.Version,
+		f.BundleSymbolicName,
+		f.BundleVersion,
+		f.Module,
+		rewritten,
+		f.Priority,
+		f.UnusualLocation,
+		prov.BuiltBy,
+		prov.BuildJdk,
+		prov.CreatedBy,
+		prov.BuildTime,
+		prov.Comment,
+		prov.ManifestModified,
+		f.SHA256,
+		host.Hostname,
+		host.FQDN,
+		host.InstanceID,
+		host.ImageID,
+		host.TagString(";"),
+		f.VersionRange,
+		strings.Join(f.artifactPaths(), ";"),
+		f.Log4jVersion,
+		strings.Join(pids, ";"),
+		deleted,
+		f.Baseline,
+		f.Coordinates,
+		strings.Join(f.Projects, ";"),
+		signed,
+	})
+}
+
+// writeHeader writes the header once, even if there are no findings.
+func (c *CSV) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.w.Write(csvHeader)
+}
+
+func (c *CSV) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *CSV) Close() error {
+	return c.Flush()
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// defaultBatchSize is the number of findings per webhook request.
+const defaultBatchSize = 100
+
+// WebhookPayload is the JSON body POSTed by the webhook sink.
+type WebhookPayload struct {
+	Host     string    `json:"host,omitempty"`
+	Findings []Finding `json:"findings"`
+	// Omitted counts the findings of each severity omitted by a Sampler.
+	// It's only set on the last request of a scan.
+	Omitted Counts `json:"omitted,omitempty"`
+}
+
+// Webhook POSTs findings as JSON to a URL, in batches.
+type Webhook struct {
+	// URL receives the requests.
+	URL string
+	// Host identifies the scanned host in payloads.
+	Host string
+	// Header holds additional request headers, such as Authorization.
+	Header http.Header
+	// Client sends requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// BatchSize is the number of findings per request. Defaults to 100.
+	BatchSize int
+
+	mu      sync.Mutex
+	pending []Finding
+	omitted Counts
+}
+
+func (w *Webhook) Write(f Finding) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, f)
+	batch := w.BatchSize
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+	if len(w.pending) < batch {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *Webhook) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *Webhook) Close() error {
+	return w.Flush()
+}
+
+func (w *Webhook) flush() error {
+	if len(w.pending) == 0 && w.omitted == nil {
+		return nil
+	}
+	b, err := json.Marshal(WebhookPayload{Host: w.Host, Findings: w.pending, Omitted: w.omitted})
+	if err != nil {
+		return fmt.Errorf("encoding findings: %v", err)
+	}
+	// Findings are dropped even if the request fails, so a down endpoint
+	// doesn't grow memory without bound.
+	w.pending = nil
+	w.omitted = nil
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("creating request: %v", err)
+	}
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting findings to %s: %v", w.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("posting findings to %s: unexpected status %s", w.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"log4jscanner/results"
+	"log4jscanner/store"
+)
+
+// requireStore exits with the usage status if any of the flags, mapped to
+// their values, are set in a binary built without the SQLite driver, which
+// requires cgo, rather than failing once the scan starts.
+func requireStore(paths map[string]string) {
+	if store.Supported {
+		return
+	}
+	var flags []string
+	for name, p := range paths {
+		if p != "" {
+			flags = append(flags, "--"+name)
+		}
+	}
+	if len(flags) == 0 {
+		return
+	}
+	sort.Strings(flags)
+	log.Printf("Error: %s can't be used: SQLite requires a binary built with cgo", strings.Join(flags, ", "))
+	os.Exit(exitStatusUsage)
+}
+
+// recorder is a results.Sink persisting the findings and skipped paths of a
+// run to a results store.
+type recorder struct {
+	store *store.Store
+	run   *store.Run
+	// retain, if set, prunes older runs once the run finishes.
+	retain time.Duration
+}
+
+func newRecorder(path string, dirs []string) (*recorder, error) {
+	s, err := store.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	run, err := s.StartRun(host, dirs)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return &recorder{store: s, run: run}, nil
+}
+
+// Write records a finding.
+func (rec *recorder) Write(f results.Finding) error {
+	sf := store.Finding{
+		RunID:              rec.run.ID,
+		Time:               f.Time,
+		Path:               f.Path,
+		MainClass:          f.MainClass,
+		Version:            f.Version,
+		BundleSymbolicName: f.BundleSymbolicName,
+		BundleVersion:      f.BundleVersion,
+		Module:             f.Module,
+		Rewritten:          f.Rewritten,
+		CVEs:               f.CVEs,
+		Severity:           f.Severity,
+	}
+	return rec.store.AddFinding(sf)
+}
+
+// Flush does nothing, findings are written as they're recorded.
+func (rec *recorder) Flush() error {
+	return nil
+}
+
+func (rec *recorder) skipped(path, reason string) {
+	sk := store.Skip{RunID: rec.run.ID, Path: path, Reason: reason}
+	if err := rec.store.AddSkip(sk); err != nil {
+		log.Printf("Error: writing results store: %v", err)
+	}
+}
+
+// Close marks the run as finished.
+func (rec *recorder) Close() error {
+	if err := rec.store.FinishRun(rec.run); err != nil {
+		rec.store.Close()
+		return fmt.Errorf("writing results store: %v", err)
+	}
+	if rec.retain > 0 {
+		if _, err := prune(rec.store, rec.retain, compactFraction); err != nil {
+			log.Printf("Error: pruning results store: %v", err)
+		}
+	}
+	if err := rec.store.Close(); err != nil {
+		return fmt.Errorf("closing results store: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+
+	"log4jscanner/jar"
+	"log4jscanner/logging"
+)
+
+// rollback restores the originals kept by b of the JARs rewritten and the
+// classes removed within dirs, recording each in the audit log if a is
+// non-nil. Restored files are printed to stdout.
+func rollback(dirs []string, b *jar.Backup, a *auditor, logf func(format string, v ...interface{})) {
+	restored, failed := 0, 0
+	for _, dir := range dirs {
+		originals, err := b.Originals(dir)
+		if err != nil {
+			log.Printf("Error: finding originals of %s: %v", dir, err)
+			failed++
+			continue
+		}
+		for _, o := range originals {
+			if a != nil {
+				a.reported(o.Path)
+			}
+			if err := o.Restore(); err != nil {
+				logging.With("path", o.Path, "error", err).Printf("Error: restoring %s from %s: %v", o.Path, o.Backup, err)
+				failed++
+				continue
+			}
+			if a != nil {
+				a.record("rollback", o.Path)
+			}
+			logf("Restored %s from %s", o.Path, o.Backup)
+			fmt.Println(o.Path)
+			restored++
+		}
+	}
+	log.Printf("Restored %d files, %d errors", restored, failed)
+}
+
+// skipQuarantine skips the quarantine directory of a backup, so originals
+// aren't rewritten again.
+func skipQuarantine(dir string, skipDir func(path string, d fs.DirEntry) bool, skipped func(path, reason string)) func(path string, d fs.DirEntry) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	return func(path string, d fs.DirEntry) bool {
+		if d.IsDir() {
+			if p, err := filepath.Abs(path); err == nil && p == abs {
+				if skipped != nil {
+					skipped(path, "quarantine directory")
+				}
+				return true
+			}
+		}
+		return skipDir(path, d)
+	}
+}
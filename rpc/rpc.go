@@ -0,0 +1,462 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpc implements a stable machine interface to the scanner: JSON-RPC
+// 2.0 over a pair of streams, such as the stdin and stdout of a "log4jscanner
+// rpc" subprocess. Tooling in other languages can drive the scanner through it
+// rather than parsing the command line tool's output.
+//
+// Messages are JSON objects, one per line. Requests are handled concurrently,
+// and responses may be written in any order:
+//
+//	-> {"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"path": "/srv"}}
+//	<- {"jsonrpc": "2.0", "method": "finding", "params": {"id": 1, "finding": {...}}}
+//	<- {"jsonrpc": "2.0", "id": 1, "result": {"findings": 1, "errors": 0}}
+//
+// The methods are:
+//
+//	version    Returns the Version of the protocol.
+//	scan       Scans the archive or directory at "path", sending a "finding"
+//	           notification for every vulnerable JAR and an "error"
+//	           notification for every file that couldn't be scanned. Returns
+//	           the number of each.
+//	scanBytes  Scans the archive in "data", encoded as base64, returning the
+//	           finding if it's vulnerable. "name" is used as its path.
+//	cancel     Stops the scan requested with "id", which fails with
+//	           CodeCancelled.
+//
+// Findings are encoded as results.Finding. Fields may be added to results and
+// notifications, but within a protocol version existing fields aren't removed
+// or changed. Batch requests aren't supported.
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/results"
+)
+
+// Version is the version of the protocol, incremented for incompatible
+// changes.
+const Version = 1
+
+// Error codes, beyond those defined by JSON-RPC 2.0.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeScanFailed is returned if the path of a scan can't be scanned at
+	// all, such as if it doesn't exist.
+	CodeScanFailed = -32000
+	// CodeCancelled is returned by scans that were cancelled.
+	CodeCancelled = -32800
+)
+
+// defaultMaxRequestBytes is the default size limit of a request, including
+// the base64 encoded data of scanBytes.
+const defaultMaxRequestBytes = 256 << 20 // 256MiB
+
+// Server serves JSON-RPC requests.
+type Server struct {
+	// Config selects the rules evaluated by scans. Defaults to all rules.
+	Config *jar.Config
+	// SkipDir, if set, is used by scans to skip paths, like jar.Walker's.
+	SkipDir func(path string, de fs.DirEntry) bool
+	// MaxRequestBytes limits the size of a request line. Defaults to
+	// 256MiB.
+	MaxRequestBytes int
+
+	mu      sync.Mutex
+	w       io.Writer
+	werr    error
+	running map[string]*jar.Walker
+}
+
+// Request is a JSON-RPC request, or a notification if ID is unset.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC response, or a notification sent by the server if
+// Method is set.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// VersionResult is the result of the version method.
+type VersionResult struct {
+	Protocol int      `json:"protocol"`
+	Methods  []string `json:"methods"`
+}
+
+// ScanParams are the parameters of the scan method.
+type ScanParams struct {
+	Path string `json:"path"`
+}
+
+// ScanResult is the result of the scan method.
+type ScanResult struct {
+	Findings int `json:"findings"`
+	Errors   int `json:"errors"`
+}
+
+// ScanBytesParams are the parameters of the scanBytes method.
+type ScanBytesParams struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+// ScanBytesResult is the result of the scanBytes method. Finding is nil if
+// the archive isn't vulnerable.
+type ScanBytesResult struct {
+	Finding *results.Finding `json:"finding"`
+}
+
+// CancelParams are the parameters of the cancel method.
+type CancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// CancelResult is the result of the cancel method. Cancelled is false if no
+// scan with the ID was running.
+type CancelResult struct {
+	Cancelled bool `json:"cancelled"`
+}
+
+// FindingParams are the parameters of "finding" notifications.
+type FindingParams struct {
+	ID      json.RawMessage `json:"id"`
+	Finding results.Finding `json:"finding"`
+}
+
+// ErrorParams are the parameters of "error" notifications.
+type ErrorParams struct {
+	ID    json.RawMessage `json:"id"`
+	Path  string          `json:"path"`
+	Error string          `json:"error"`
+}
+
+var methods = []string{"cancel", "scan", "scanBytes", "version"}
+
+// Serve reads requests from r and writes responses to w until r is
+// exhausted and every request has been answered. Scans in progress once r is
+// closed are completed. An error is returned if r or w fail.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.mu.Lock()
+	s.w = w
+	s.running = map[string]*jar.Walker{}
+	s.mu.Unlock()
+
+	max := s.MaxRequestBytes
+	if max <= 0 {
+		max = defaultMaxRequestBytes
+	}
+	br := bufio.NewReader(r)
+	var wg sync.WaitGroup
+	var rerr error
+	for {
+		line, err := readLine(br, max)
+		if err == errTooLarge {
+			s.send(&Response{Error: &Error{CodeInvalidRequest, fmt.Sprintf("request exceeds %d bytes", max)}})
+			continue
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var req Request
+			if err := json.Unmarshal(line, &req); err != nil {
+				s.send(&Response{Error: &Error{CodeParseError, fmt.Sprintf("parsing request: %v", err)}})
+			} else if req.JSONRPC != "2.0" || req.Method == "" {
+				s.send(&Response{ID: req.ID, Error: &Error{CodeInvalidRequest, `expected a "2.0" request with a method`}})
+			} else {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.handle(&req)
+				}()
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				rerr = fmt.Errorf("reading requests: %v", err)
+			}
+			break
+		}
+	}
+	wg.Wait()
+	if rerr != nil {
+		return rerr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.werr
+}
+
+var errTooLarge = errors.New("line too large")
+
+// readLine reads a line of at most max bytes. Longer lines are discarded,
+// returning errTooLarge.
+func readLine(br *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		b, err := br.ReadSlice('\n')
+		if len(line)+len(b) > max {
+			line = nil
+			for err == bufio.ErrBufferFull {
+				_, err = br.ReadSlice('\n')
+			}
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, errTooLarge
+		}
+		line = append(line, b...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+// send writes a message. Write errors are recorded and returned by Serve.
+func (s *Server) send(resp *Response) {
+	resp.JSONRPC = "2.0"
+	if resp.Method == "" && resp.ID == nil {
+		// Responses to requests whose ID couldn't be read have a null ID.
+		resp.ID = json.RawMessage("null")
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		b, _ = json.Marshal(&Response{JSONRPC: "2.0", ID: resp.ID, Error: &Error{CodeInternalError, fmt.Sprintf("encoding response: %v", err)}})
+	}
+	b = append(b, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.werr != nil {
+		return
+	}
+	if _, err := s.w.Write(b); err != nil {
+		s.werr = fmt.Errorf("writing response: %v", err)
+	}
+}
+
+// notify sends a notification.
+func (s *Server) notify(method string, params interface{}) {
+	s.send(&Response{Method: method, Params: params})
+}
+
+// handle answers a request. Notifications sent by clients aren't answered.
+func (s *Server) handle(req *Request) {
+	result, rerr := s.call(req)
+	if req.ID == nil {
+		return
+	}
+	if rerr != nil {
+		s.send(&Response{ID: req.ID, Error: rerr})
+		return
+	}
+	s.send(&Response{ID: req.ID, Result: result})
+}
+
+func (s *Server) call(req *Request) (interface{}, *Error) {
+	switch req.Method {
+	case "version":
+		return &VersionResult{Protocol: Version, Methods: methods}, nil
+	case "scan":
+		var p ScanParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.Path == "" {
+			return nil, &Error{CodeInvalidParams, "path is required"}
+		}
+		return s.scan(req.ID, p.Path)
+	case "scanBytes":
+		var p ScanBytesParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.scanBytes(p.Name, p.Data)
+	case "cancel":
+		var p CancelParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.ID == nil {
+			return nil, &Error{CodeInvalidParams, "id is required"}
+		}
+		s.mu.Lock()
+		wk, ok := s.running[idKey(p.ID)]
+		s.mu.Unlock()
+		if ok {
+			wk.Stop()
+		}
+		return &CancelResult{Cancelled: ok}, nil
+	}
+	return nil, &Error{CodeMethodNotFound, fmt.Sprintf("unknown method %q", req.Method)}
+}
+
+func decodeParams(params json.RawMessage, v interface{}) *Error {
+	if params == nil {
+		return &Error{CodeInvalidParams, "params are required"}
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{CodeInvalidParams, fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
+
+// idKey identifies a request by its ID, ignoring formatting.
+func idKey(id json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, id); err != nil {
+		return string(id)
+	}
+	return b.String()
+}
+
+func (s *Server) config() *jar.Config {
+	if s.Config != nil {
+		return s.Config
+	}
+	return &jar.Config{}
+}
+
+// scan scans a path, notifying the findings and errors of the request with
+// the given ID.
+func (s *Server) scan(id json.RawMessage, path string) (interface{}, *Error) {
+	var res ScanResult
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, &Error{CodeScanFailed, err.Error()}
+	}
+	if !info.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, &Error{CodeScanFailed, err.Error()}
+		}
+		defer f.Close()
+		r, err := s.config().ParseAny(path, f)
+		if err == jar.ErrUnknownFormat {
+			return &res, nil
+		}
+		if err != nil {
+			return nil, &Error{CodeScanFailed, err.Error()}
+		}
+		if r.Vulnerable {
+			res.Findings++
+			s.notify("finding", &FindingParams{ID: id, Finding: results.FromReport(path, r)})
+		}
+		return &res, nil
+	}
+
+	var mu sync.Mutex
+	wk := &jar.Walker{
+		Config:  s.config(),
+		SkipDir: s.SkipDir,
+		HandleError: func(path string, err error) {
+			mu.Lock()
+			res.Errors++
+			mu.Unlock()
+			s.notify("error", &ErrorParams{ID: id, Path: path, Error: err.Error()})
+		},
+		HandleReport: func(path string, r *jar.Report) {
+			mu.Lock()
+			res.Findings++
+			mu.Unlock()
+			s.notify("finding", &FindingParams{ID: id, Finding: results.FromReport(path, r)})
+		},
+	}
+	if id != nil {
+		key := idKey(id)
+		s.mu.Lock()
+		s.running[key] = wk
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, key)
+			s.mu.Unlock()
+		}()
+	}
+	if err := wk.Walk(path); err != nil {
+		if err == jar.ErrStopped {
+			return nil, &Error{CodeCancelled, "scan cancelled"}
+		}
+		return nil, &Error{CodeScanFailed, err.Error()}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return &res, nil
+}
+
+// scanBytes scans an in-memory archive.
+func (s *Server) scanBytes(name string, data []byte) (interface{}, *Error) {
+	f := &memFile{Reader: bytes.NewReader(data), name: name, size: int64(len(data))}
+	r, err := s.config().ParseAny(name, f)
+	if err == jar.ErrUnknownFormat {
+		return &ScanBytesResult{}, nil
+	}
+	if err != nil {
+		return nil, &Error{CodeScanFailed, err.Error()}
+	}
+	if !r.Vulnerable {
+		return &ScanBytesResult{}, nil
+	}
+	finding := results.FromReport(name, r)
+	return &ScanBytesResult{Finding: &finding}, nil
+}
+
+// memFile is an fs.File of an in-memory archive.
+type memFile struct {
+	*bytes.Reader
+	name string
+	size int64
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *memFile) Close() error               { return nil }
+
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return f.size }
+func (f *memFile) Mode() fs.FileMode  { return 0o444 }
+func (f *memFile) ModTime() time.Time { return time.Time{} }
+func (f *memFile) IsDir() bool        { return false }
+func (f *memFile) Sys() interface{}   { return nil }
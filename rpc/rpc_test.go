@@ -0,0 +1,164 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("..", "jar", "testdata", name))
+	if err != nil {
+		t.Fatalf("reading test data: %v", err)
+	}
+	return b
+}
+
+// message is a response or notification, with the fields compared by tests.
+type message struct {
+	ID         string
+	Method     string
+	Path       string
+	Result     string
+	Code       int
+	Vulnerable bool
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"vuln-class.jar", "safe1.jar"} {
+		if err := os.WriteFile(filepath.Join(dir, name), readTestdata(t, name), 0o644); err != nil {
+			t.Fatalf("writing test data: %v", err)
+		}
+	}
+	vulnPath := filepath.Join(dir, "vuln-class.jar")
+	data, err := json.Marshal(readTestdata(t, "vuln-class.jar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote := func(s string) string {
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+
+	requests := []string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "version"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "scan", "params": {"path": ` + quote(dir) + `}}`,
+		`{"jsonrpc": "2.0", "id": "file", "method": "scan", "params": {"path": ` + quote(vulnPath) + `}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "scanBytes", "params": {"name": "upload.jar", "data": ` + string(data) + `}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "scanBytes", "params": {"name": "notes.txt", "data": "aGVsbG8="}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "scan", "params": {"path": ` + quote(filepath.Join(dir, "missing")) + `}}`,
+		`{"jsonrpc": "2.0", "id": 6, "method": "scan", "params": {}}`,
+		`{"jsonrpc": "2.0", "id": 7, "method": "cancel", "params": {"id": 100}}`,
+		`{"jsonrpc": "2.0", "id": 8, "method": "explode"}`,
+		`{"jsonrpc": "1.0", "id": 9, "method": "version"}`,
+		`{"jsonrpc": "2.0", "method": "version"}`,
+		``,
+		`{not json`,
+	}
+	var out bytes.Buffer
+	s := &Server{}
+	if err := s.Serve(strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Serve() returned error: %v", err)
+	}
+
+	var got []message
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		var resp struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				ID      json.RawMessage `json:"id"`
+				Path    string          `json:"path"`
+				Finding struct {
+					Path string `json:"path"`
+				} `json:"finding"`
+			} `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *Error          `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("parsing response %q: %v", line, err)
+		}
+		m := message{ID: string(resp.ID), Method: resp.Method, Result: string(resp.Result)}
+		if resp.Method != "" {
+			m.ID = string(resp.Params.ID)
+			m.Path = resp.Params.Path + resp.Params.Finding.Path
+		}
+		if resp.Error != nil {
+			m.Code = resp.Error.Code
+		}
+		if strings.Contains(m.Result, `"finding":{`) {
+			m.Result, m.Vulnerable = "", true
+		}
+		got = append(got, m)
+	}
+	sort.Slice(got, func(i, j int) bool {
+		return fmt.Sprint(got[i]) < fmt.Sprint(got[j])
+	})
+
+	want := []message{
+		{ID: `"file"`, Result: `{"findings":1,"errors":0}`},
+		{ID: `"file"`, Method: "finding", Path: vulnPath},
+		{ID: "1", Result: `{"protocol":1,"methods":["cancel","scan","scanBytes","version"]}`},
+		{ID: "2", Result: `{"findings":1,"errors":0}`},
+		{ID: "2", Method: "finding", Path: vulnPath},
+		{ID: "3", Vulnerable: true},
+		{ID: "4", Result: `{"finding":null}`},
+		{ID: "5", Code: CodeScanFailed},
+		{ID: "6", Code: CodeInvalidParams},
+		{ID: "7", Result: `{"cancelled":false}`},
+		{ID: "8", Code: CodeMethodNotFound},
+		{ID: "9", Code: CodeInvalidRequest},
+		{ID: "null", Code: CodeParseError},
+	}
+	sort.Slice(want, func(i, j int) bool {
+		return fmt.Sprint(want[i]) < fmt.Sprint(want[j])
+	})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Serve() returned unexpected messages (-want, +got):\n%s", diff)
+	}
+}
+
+func TestServeMaxRequestBytes(t *testing.T) {
+	requests := `{"jsonrpc": "2.0", "id": 1, "method": "scanBytes", "params": {"name": "big.jar", "data": "` + strings.Repeat("A", 8192) + `"}}
+{"jsonrpc": "2.0", "id": 2, "method": "version"}
+`
+	var out bytes.Buffer
+	s := &Server{MaxRequestBytes: 1024}
+	if err := s.Serve(strings.NewReader(requests), &out); err != nil {
+		t.Fatalf("Serve() returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Serve() wrote %d messages, want 2: %s", len(lines), out.String())
+	}
+	if !strings.Contains(out.String(), `"id":null,"error":{"code":-32600`) {
+		t.Errorf("oversized request wasn't rejected: %s", out.String())
+	}
+	if !strings.Contains(out.String(), `"id":2,"result"`) {
+		t.Errorf("request after an oversized request wasn't answered: %s", out.String())
+	}
+}
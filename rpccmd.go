@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"log4jscanner/rpc"
+)
+
+func rpcUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner rpc [flag]
+
+Serves JSON-RPC 2.0 requests on stdin, writing responses to stdout, one JSON
+object per line. This is a stable interface for tooling in other languages:
+
+    {"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"path": "/srv"}}
+
+Methods:
+
+    version    The protocol version.
+    scan       Scan the archive or directory at "path", streaming "finding"
+               and "error" notifications.
+    scanBytes  Scan the base64 encoded archive in "data".
+    cancel     Stop the scan requested with "id".
+
+The scanner exits once stdin is closed and every request has been answered.
+Logs are written to stderr.
+
+Flags:
+
+    -v, --verbose      Log skipped paths.
+    --max-request-size Maximum size of a request line in bytes (default
+                       256MiB).
+
+`)
+}
+
+func rpcCmd(args []string) {
+	var (
+		verbose bool
+		maxSize int
+	)
+	flags := flag.NewFlagSet("rpc", flag.ExitOnError)
+	flags.BoolVar(&verbose, "verbose", false, "")
+	flags.BoolVar(&verbose, "v", false, "")
+	flags.IntVar(&maxSize, "max-request-size", 0, "")
+	flags.Usage = rpcUsage
+	flags.Parse(args)
+	if flags.NArg() != 0 || maxSize < 0 {
+		rpcUsage()
+		os.Exit(1)
+	}
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	logf := func(format string, v ...interface{}) {
+		if verbose {
+			log.Printf(format, v...)
+		}
+	}
+	s := &rpc.Server{
+		Config:          scanConfig,
+		SkipDir:         newSkipDir(nil, nil, nil, nil, logf, nil),
+		MaxRequestBytes: maxSize,
+	}
+	if err := s.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
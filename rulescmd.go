@@ -0,0 +1,266 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func rulesUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner rules test [flag] CORPUS
+
+Scans a labeled corpus of archives with the active rules and reports how well
+they classify it, to validate custom rules, vulnerability databases, and rule
+updates before rolling them out. CORPUS holds two directories:
+
+    vulnerable  Archives the rules are expected to report.
+    clean       Archives the rules are expected not to report.
+
+Both are walked like a scan, and archives nested in the ones found are
+scanned as part of them. Prints the true and false positives and negatives,
+the precision and recall of the rules, the misclassified archives, and how
+many archives of each directory every rule matched. Precision is 1 if no
+archive was reported, and recall is 1 if no archive is expected to be.
+
+Exits with status 3 if the precision or recall is below its minimum, and 4
+if an archive couldn't be scanned.
+
+Flags:
+
+    --custom-rules   File of custom rules to evaluate alongside the built-in
+                     rules. Must precede the flags referencing them.
+    --vulndb         Vulnerability database to evaluate alongside the
+                     built-in rules. Must precede the flags referencing its
+                     rules.
+    --enable-rule    Only evaluate the rule with the given ID. May be
+                     provided multiple times.
+    --disable-rule   Don't evaluate the rule with the given ID. May be
+                     provided multiple times.
+    --cve            Only evaluate the rules detecting the given CVE. May be
+                     provided multiple times.
+    --log4j1         Also evaluate the log4j 1.x rules.
+    --min-precision  Minimum precision, from 0 to 1 (default 1).
+    --min-recall     Minimum recall, from 0 to 1 (default 1).
+    --format         Output format, "text" (default) or "json".
+
+`)
+}
+
+// Directories of a rule test corpus, by the label of their archives.
+const (
+	corpusVulnerable = "vulnerable"
+	corpusClean      = "clean"
+)
+
+// ruleTest is the outcome of scanning a labeled corpus.
+type ruleTest struct {
+	// Rules lists the IDs of the rules evaluated.
+	Rules          []string `json:"rules"`
+	TruePositives  int      `json:"true_positives"`
+	FalsePositives int      `json:"false_positives"`
+	FalseNegatives int      `json:"false_negatives"`
+	TrueNegatives  int      `json:"true_negatives"`
+	Errors         int      `json:"errors"`
+	Precision      float64  `json:"precision"`
+	Recall         float64  `json:"recall"`
+	// Misclassified lists the archives reported contrary to their label,
+	// and the ones that couldn't be scanned.
+	Misclassified []ruleTestSample `json:"misclassified,omitempty"`
+	// PerRule counts the archives of each label every rule matched.
+	PerRule []ruleTestCounts `json:"per_rule"`
+}
+
+// ruleTestSample is an archive of a corpus.
+type ruleTestSample struct {
+	Path string `json:"path"`
+	// Label is the directory holding the archive, "vulnerable" or "clean".
+	Label string `json:"label"`
+	// Rules lists the rules that matched it.
+	Rules []string `json:"rules,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// ruleTestCounts counts the archives of a corpus a rule matched.
+type ruleTestCounts struct {
+	ID         string `json:"id"`
+	Vulnerable int    `json:"vulnerable"`
+	Clean      int    `json:"clean"`
+}
+
+func rulesCmd(args []string) {
+	if len(args) == 0 || args[0] != "test" {
+		rulesUsage()
+		os.Exit(exitStatusUsage)
+	}
+	var (
+		minPrecision = 1.0
+		minRecall    = 1.0
+		format       = "text"
+	)
+	flags := flag.NewFlagSet("rules test", flag.ExitOnError)
+	flags.Func("custom-rules", "", registerRules)
+	flags.Func("vulndb", "", registerVulnDB)
+	flags.Func("enable-rule", "", func(id string) error {
+		scanConfig.EnableRules = append(scanConfig.EnableRules, id)
+		return scanConfig.Validate()
+	})
+	flags.Func("disable-rule", "", func(id string) error {
+		scanConfig.DisableRules = append(scanConfig.DisableRules, id)
+		return scanConfig.Validate()
+	})
+	flags.Func("cve", "", func(cve string) error {
+		scanConfig.CVEs = append(scanConfig.CVEs, strings.ToUpper(cve))
+		return scanConfig.Validate()
+	})
+	flags.BoolVar(&scanConfig.Log4j1, "log4j1", false, "")
+	flags.Float64Var(&minPrecision, "min-precision", minPrecision, "")
+	flags.Float64Var(&minRecall, "min-recall", minRecall, "")
+	flags.StringVar(&format, "format", format, "")
+	flags.Usage = rulesUsage
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		rulesUsage()
+		os.Exit(exitStatusUsage)
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("Error: unknown --format %q, expected text or json", format)
+	}
+	if minPrecision < 0 || minPrecision > 1 || minRecall < 0 || minRecall > 1 {
+		log.Fatalf("Error: --min-precision and --min-recall must be from 0 to 1")
+	}
+
+	corpus := flags.Arg(0)
+	for _, label := range []string{corpusVulnerable, corpusClean} {
+		if info, err := os.Stat(filepath.Join(corpus, label)); err != nil || !info.IsDir() {
+			log.Fatalf("Error: corpus %s has no %s directory", corpus, label)
+		}
+	}
+	t := testRules(corpus)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(t); err != nil {
+			log.Fatalf("Error: writing output: %v", err)
+		}
+	} else {
+		printRuleTest(t)
+	}
+	switch {
+	case t.Precision < minPrecision || t.Recall < minRecall:
+		os.Exit(exitStatusFindings)
+	case t.Errors > 0:
+		os.Exit(exitStatusErrors)
+	}
+}
+
+// testRules scans the archives of a corpus with the active rules.
+func testRules(corpus string) *ruleTest {
+	t := &ruleTest{Rules: scanConfig.EnabledRules()}
+	perRule := map[string]*ruleTestCounts{}
+	for _, id := range t.Rules {
+		perRule[id] = &ruleTestCounts{ID: id}
+	}
+	skipDir := func(path string, d fs.DirEntry) bool { return false }
+	for _, label := range []string{corpusVulnerable, corpusClean} {
+		dir := filepath.Join(corpus, label)
+		err := walkArchives(dir, skipDir, nil, func(path string, d fs.DirEntry) {
+			s := ruleTestSample{Path: path, Label: label}
+			r, err := scanFile(path)
+			if err != nil {
+				s.Error = err.Error()
+				t.Errors++
+				t.Misclassified = append(t.Misclassified, s)
+				return
+			}
+			reported := r != nil && r.Vulnerable
+			if r != nil {
+				s.Rules = r.Rules
+				for _, id := range r.Rules {
+					if c, ok := perRule[id]; ok && label == corpusVulnerable {
+						c.Vulnerable++
+					} else if ok {
+						c.Clean++
+					}
+				}
+			}
+			switch {
+			case reported && label == corpusVulnerable:
+				t.TruePositives++
+			case reported:
+				t.FalsePositives++
+				t.Misclassified = append(t.Misclassified, s)
+			case label == corpusVulnerable:
+				t.FalseNegatives++
+				t.Misclassified = append(t.Misclassified, s)
+			default:
+				t.TrueNegatives++
+			}
+		})
+		if err != nil {
+			log.Printf("Error: walking %s: %v", dir, err)
+		}
+	}
+	t.Precision = ratio(t.TruePositives, t.TruePositives+t.FalsePositives)
+	t.Recall = ratio(t.TruePositives, t.TruePositives+t.FalseNegatives)
+	for _, id := range t.Rules {
+		t.PerRule = append(t.PerRule, *perRule[id])
+	}
+	return t
+}
+
+// ratio returns n/d, or 1 if d is 0.
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 1
+	}
+	return float64(n) / float64(d)
+}
+
+// printRuleTest prints the outcome of a rule test as text.
+func printRuleTest(t *ruleTest) {
+	fmt.Printf("Rules: %s\n", strings.Join(t.Rules, ", "))
+	fmt.Printf("True positives:  %d\n", t.TruePositives)
+	fmt.Printf("False positives: %d\n", t.FalsePositives)
+	fmt.Printf("False negatives: %d\n", t.FalseNegatives)
+	fmt.Printf("True negatives:  %d\n", t.TrueNegatives)
+	fmt.Printf("Errors:          %d\n", t.Errors)
+	fmt.Printf("Precision:       %.3f\n", t.Precision)
+	fmt.Printf("Recall:          %.3f\n", t.Recall)
+	if len(t.Misclassified) > 0 {
+		fmt.Printf("\nMisclassified:\n")
+		for _, s := range t.Misclassified {
+			switch {
+			case s.Error != "":
+				fmt.Printf("  error           %s: %s\n", s.Path, s.Error)
+			case s.Label == corpusVulnerable:
+				fmt.Printf("  false negative  %s\n", s.Path)
+			default:
+				fmt.Printf("  false positive  %s (%s)\n", s.Path, strings.Join(s.Rules, ", "))
+			}
+		}
+	}
+	fmt.Printf("\nMatches per rule:\n")
+	for _, c := range t.PerRule {
+		fmt.Printf("  %-28s %d vulnerable, %d clean\n", c.ID, c.Vulnerable, c.Clean)
+	}
+}
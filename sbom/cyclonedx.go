@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The CycloneDX 1.4 JSON format, see https://cyclonedx.org/docs/1.4/json/.
+type (
+	cdxBOM struct {
+		BOMFormat    string         `json:"bomFormat"`
+		SpecVersion  string         `json:"specVersion"`
+		SerialNumber string         `json:"serialNumber"`
+		Version      int            `json:"version"`
+		Metadata     cdxMetadata    `json:"metadata"`
+		Components   []cdxComponent `json:"components"`
+	}
+	cdxMetadata struct {
+		Timestamp string        `json:"timestamp"`
+		Tools     []cdxTool     `json:"tools"`
+		Component *cdxComponent `json:"component,omitempty"`
+	}
+	cdxTool struct {
+		Name string `json:"name"`
+	}
+	cdxComponent struct {
+		Type       string        `json:"type"`
+		BOMRef     string        `json:"bom-ref,omitempty"`
+		Group      string        `json:"group,omitempty"`
+		Name       string        `json:"name"`
+		Version    string        `json:"version,omitempty"`
+		Hashes     []cdxHash     `json:"hashes,omitempty"`
+		PURL       string        `json:"purl,omitempty"`
+		Properties []cdxProperty `json:"properties,omitempty"`
+	}
+	cdxHash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+	cdxProperty struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+)
+
+// locationProperty is the CycloneDX property holding the location of a
+// component.
+const locationProperty = "log4jscanner:location"
+
+// writeCycloneDX writes components as a CycloneDX document.
+func writeCycloneDX(w io.Writer, doc Document, components []Component) error {
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + doc.Serial,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: doc.Created.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Name: "log4jscanner"}},
+		},
+		Components: []cdxComponent{},
+	}
+	if doc.Name != "" {
+		bom.Metadata.Component = &cdxComponent{Type: "device", Name: doc.Name}
+	}
+	for i, c := range components {
+		cc := cdxComponent{
+			Type:       "library",
+			BOMRef:     fmt.Sprintf("component-%d", i+1),
+			Group:      c.Group,
+			Name:       c.Artifact,
+			Version:    c.Version,
+			PURL:       c.PURL(),
+			Properties: []cdxProperty{{Name: locationProperty, Value: c.Location}},
+		}
+		if c.SHA256 != "" {
+			cc.Hashes = []cdxHash{{Alg: "SHA-256", Content: c.SHA256}}
+		}
+		bom.Components = append(bom.Components, cc)
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	if err := e.Encode(bom); err != nil {
+		return fmt.Errorf("writing CycloneDX SBOM: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sbom writes software bills of materials of the Java components
+// found by scans with jar.Config.Inventory, as CycloneDX or SPDX JSON
+// documents.
+//
+// Scans already read the Maven metadata and manifests of every JAR, so
+// recording them turns a scan for log4j into an inventory that can be
+// checked against future vulnerabilities without scanning again.
+package sbom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// Formats of documents.
+const (
+	// CycloneDX is the CycloneDX 1.4 JSON format.
+	CycloneDX = "cyclonedx"
+	// SPDX is the SPDX 2.3 JSON format.
+	SPDX = "spdx"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{CycloneDX, SPDX}
+
+// Component is a Java component found by a scan.
+type Component struct {
+	jar.Component
+	// Location is the path of the scanned JAR followed by the Path of the
+	// component within it, separated by "!", such as
+	// "/srv/app.war!WEB-INF/lib/guava-31.0.1-jre.jar".
+	Location string
+}
+
+// PURL returns the package URL of the component, such as
+// "pkg:maven/com.google.guava/guava@31.0.1-jre", or "" for components
+// without Maven coordinates.
+func (c *Component) PURL() string {
+	if c.Group == "" {
+		return ""
+	}
+	purl := "pkg:maven/" + url.PathEscape(c.Group) + "/" + url.PathEscape(c.Artifact)
+	if c.Version != "" {
+		purl += "@" + url.PathEscape(c.Version)
+	}
+	return purl
+}
+
+// Collector collects the components of scanned JARs. It's safe for
+// concurrent use.
+type Collector struct {
+	mu         sync.Mutex
+	components []Component
+}
+
+// Add records the components of a scanned JAR, such as from jar.Walker's
+// HandleJAR. Components of the JAR itself take its Report.SHA256, if it was
+// hashed.
+func (c *Collector) Add(path string, r *jar.Report) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, comp := range r.Components {
+		loc := path
+		if comp.Path == "" {
+			comp.SHA256 = r.SHA256
+		} else {
+			loc += "!" + comp.Path
+		}
+		c.components = append(c.components, Component{Component: comp, Location: loc})
+	}
+}
+
+// Components returns the components collected, sorted by location then
+// coordinates.
+func (c *Collector) Components() []Component {
+	c.mu.Lock()
+	components := append([]Component(nil), c.components...)
+	c.mu.Unlock()
+	sort.SliceStable(components, func(i, j int) bool {
+		a, b := components[i], components[j]
+		if a.Location != b.Location {
+			return a.Location < b.Location
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.Artifact < b.Artifact
+	})
+	return components
+}
+
+// Document holds the metadata of a document.
+type Document struct {
+	// Name names the document, such as after the scanned host.
+	Name string
+	// Created is when the document was created. Defaults to now.
+	Created time.Time
+	// Serial is the UUID identifying the document, such as
+	// "3e671687-395b-41f5-a30f-a58921a69b79". Defaults to a random one.
+	Serial string
+}
+
+// Write writes the components collected as a document of the format, one of
+// Formats.
+func (c *Collector) Write(w io.Writer, format string, doc Document) error {
+	if doc.Created.IsZero() {
+		doc.Created = time.Now()
+	}
+	if doc.Serial == "" {
+		var err error
+		if doc.Serial, err = newUUID(); err != nil {
+			return err
+		}
+	}
+	switch format {
+	case CycloneDX:
+		return writeCycloneDX(w, doc, c.Components())
+	case SPDX:
+		return writeSPDX(w, doc, c.Components())
+	}
+	return fmt.Errorf("unknown SBOM format %q, expected one of %s or %s", format, CycloneDX, SPDX)
+}
+
+// newUUID returns a random, version 4 UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generating document serial number: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
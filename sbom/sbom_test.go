@@ -0,0 +1,188 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func testCollector() *Collector {
+	c := &Collector{}
+	c.Add("/srv/app.war", &jar.Report{
+		SHA256: "aa",
+		Components: []jar.Component{
+			{Group: "org.example", Artifact: "app", Version: "1.0"},
+			{Path: "WEB-INF/lib/guava.jar", Group: "com.google.guava", Artifact: "guava", Version: "31.0.1-jre", SHA256: "bb"},
+		},
+	})
+	c.Add("/srv/bundle.jar", &jar.Report{
+		Components: []jar.Component{{Artifact: "org.example.bundle", Version: "1.2.0"}},
+	})
+	c.Add("/srv/unknown.jar", &jar.Report{})
+	return c
+}
+
+func TestCollectorComponents(t *testing.T) {
+	want := []Component{
+		{Location: "/srv/app.war", Component: jar.Component{Group: "org.example", Artifact: "app", Version: "1.0", SHA256: "aa"}},
+		{Location: "/srv/app.war!WEB-INF/lib/guava.jar", Component: jar.Component{Path: "WEB-INF/lib/guava.jar", Group: "com.google.guava", Artifact: "guava", Version: "31.0.1-jre", SHA256: "bb"}},
+		{Location: "/srv/bundle.jar", Component: jar.Component{Artifact: "org.example.bundle", Version: "1.2.0"}},
+	}
+	if diff := cmp.Diff(want, testCollector().Components()); diff != "" {
+		t.Errorf("Components() returned unexpected components (-want, +got):\n%s", diff)
+	}
+}
+
+func TestPURL(t *testing.T) {
+	tests := []struct {
+		c    Component
+		want string
+	}{
+		{Component{Component: jar.Component{Group: "com.google.guava", Artifact: "guava", Version: "31.0.1-jre"}}, "pkg:maven/com.google.guava/guava@31.0.1-jre"},
+		{Component{Component: jar.Component{Group: "org.example", Artifact: "app"}}, "pkg:maven/org.example/app"},
+		{Component{Component: jar.Component{Group: "org.example", Artifact: "app", Version: "1.0 beta"}}, "pkg:maven/org.example/app@1.0%20beta"},
+		{Component{Component: jar.Component{Artifact: "org.example.bundle", Version: "1.2.0"}}, ""},
+	}
+	for _, tc := range tests {
+		if got := tc.c.PURL(); got != tc.want {
+			t.Errorf("PURL() of %+v = %q, want %q", tc.c, got, tc.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	doc := Document{
+		Name:    "host",
+		Created: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+		Serial:  "3e671687-395b-41f5-a30f-a58921a69b79",
+	}
+	tests := []struct {
+		format string
+		want   interface{}
+	}{
+		{
+			format: CycloneDX,
+			want: map[string]interface{}{
+				"bomFormat":    "CycloneDX",
+				"specVersion":  "1.4",
+				"serialNumber": "urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79",
+				"version":      1.0,
+				"metadata": map[string]interface{}{
+					"timestamp": "2022-01-02T03:04:05Z",
+					"tools":     []interface{}{map[string]interface{}{"name": "log4jscanner"}},
+					"component": map[string]interface{}{"type": "device", "name": "host"},
+				},
+				"components": []interface{}{
+					map[string]interface{}{
+						"type": "library", "bom-ref": "component-1", "group": "org.example", "name": "app", "version": "1.0",
+						"purl":       "pkg:maven/org.example/app@1.0",
+						"hashes":     []interface{}{map[string]interface{}{"alg": "SHA-256", "content": "aa"}},
+						"properties": []interface{}{map[string]interface{}{"name": "log4jscanner:location", "value": "/srv/app.war"}},
+					},
+					map[string]interface{}{
+						"type": "library", "bom-ref": "component-2", "group": "com.google.guava", "name": "guava", "version": "31.0.1-jre",
+						"purl":       "pkg:maven/com.google.guava/guava@31.0.1-jre",
+						"hashes":     []interface{}{map[string]interface{}{"alg": "SHA-256", "content": "bb"}},
+						"properties": []interface{}{map[string]interface{}{"name": "log4jscanner:location", "value": "/srv/app.war!WEB-INF/lib/guava.jar"}},
+					},
+					map[string]interface{}{
+						"type": "library", "bom-ref": "component-3", "name": "org.example.bundle", "version": "1.2.0",
+						"properties": []interface{}{map[string]interface{}{"name": "log4jscanner:location", "value": "/srv/bundle.jar"}},
+					},
+				},
+			},
+		},
+		{
+			format: SPDX,
+			want: map[string]interface{}{
+				"spdxVersion":       "SPDX-2.3",
+				"dataLicense":       "CC0-1.0",
+				"SPDXID":            "SPDXRef-DOCUMENT",
+				"name":              "host",
+				"documentNamespace": "https://spdx.org/spdxdocs/log4jscanner-3e671687-395b-41f5-a30f-a58921a69b79",
+				"creationInfo": map[string]interface{}{
+					"created":  "2022-01-02T03:04:05Z",
+					"creators": []interface{}{"Tool: log4jscanner"},
+				},
+				"packages": []interface{}{
+					map[string]interface{}{
+						"name": "app", "SPDXID": "SPDXRef-Package-1", "versionInfo": "1.0", "downloadLocation": "NOASSERTION", "filesAnalyzed": false,
+						"checksums":    []interface{}{map[string]interface{}{"algorithm": "SHA256", "checksumValue": "aa"}},
+						"externalRefs": []interface{}{map[string]interface{}{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:maven/org.example/app@1.0"}},
+						"sourceInfo":   "found at /srv/app.war",
+					},
+					map[string]interface{}{
+						"name": "guava", "SPDXID": "SPDXRef-Package-2", "versionInfo": "31.0.1-jre", "downloadLocation": "NOASSERTION", "filesAnalyzed": false,
+						"checksums":    []interface{}{map[string]interface{}{"algorithm": "SHA256", "checksumValue": "bb"}},
+						"externalRefs": []interface{}{map[string]interface{}{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:maven/com.google.guava/guava@31.0.1-jre"}},
+						"sourceInfo":   "found at /srv/app.war!WEB-INF/lib/guava.jar",
+					},
+					map[string]interface{}{
+						"name": "org.example.bundle", "SPDXID": "SPDXRef-Package-3", "versionInfo": "1.2.0", "downloadLocation": "NOASSERTION", "filesAnalyzed": false,
+						"sourceInfo": "found at /srv/bundle.jar",
+					},
+				},
+				"relationships": []interface{}{
+					map[string]interface{}{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-1"},
+					map[string]interface{}{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-2"},
+					map[string]interface{}{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-3"},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.format, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := testCollector().Write(&b, tc.format, doc); err != nil {
+				t.Fatalf("Write() failed: %v", err)
+			}
+			var got interface{}
+			if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+				t.Fatalf("parsing document: %v\n%s", err, b.String())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Write() returned unexpected document (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteDefaults(t *testing.T) {
+	var b bytes.Buffer
+	if err := (&Collector{}).Write(&b, CycloneDX, Document{}); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	var got struct {
+		SerialNumber string `json:"serialNumber"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("parsing document: %v", err)
+	}
+	uuid := regexp.MustCompile(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(got.SerialNumber) {
+		t.Errorf("Write() wrote serial number %q, want a random UUID", got.SerialNumber)
+	}
+	if err := (&Collector{}).Write(&b, "swid", Document{}); err == nil {
+		t.Errorf("Write() with an unknown format succeeded, want error")
+	}
+}
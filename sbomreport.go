@@ -0,0 +1,60 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"log4jscanner/readonly"
+	"log4jscanner/sbom"
+)
+
+// validSBOMFormat reports if format is one of sbom.Formats.
+func validSBOMFormat(format string) bool {
+	for _, f := range sbom.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSBOM writes the collected components as an SBOM of the format to path,
+// or stdout if "-". The document is named after the host.
+func writeSBOM(path, format string, c *sbom.Collector) error {
+	var doc sbom.Document
+	if host, err := os.Hostname(); err == nil {
+		doc.Name = host
+	}
+	if path == "-" {
+		return c.Write(os.Stdout, format, doc)
+	}
+	if err := readonly.Check("writing SBOM"); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating SBOM: %v", err)
+	}
+	if err := c.Write(f, format, doc); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing SBOM: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"log4jscanner/jar"
+	"log4jscanner/vulndb"
+)
+
+// scanConfig selects the rules evaluated by scanStream and scanFile. It's set
+// by flags.
+var scanConfig = &jar.Config{}
+
+// readPasswords reads the passwords of encrypted archives from a file, one per
+// line. Empty lines are ignored.
+func readPasswords(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading passwords: %v", err)
+	}
+	var passwords []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line != "" {
+			passwords = append(passwords, line)
+		}
+	}
+	if len(passwords) == 0 {
+		return nil, fmt.Errorf("no passwords in %s", path)
+	}
+	return passwords, nil
+}
+
+// registerRules registers the custom rules of a file, written in the subset
+// of YARA read by jar.ReadRules.
+func registerRules(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("reading rules: %v", err)
+	}
+	defer f.Close()
+	rules, err := jar.ReadRules(f)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for _, r := range rules {
+		if err := jar.RegisterRule(r); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// registerVulnDB registers the rules of a vulnerability database, in the JSON
+// format read by vulndb.Read.
+func registerVulnDB(path string) error {
+	db, err := vulndb.Load(path)
+	if err != nil {
+		return err
+	}
+	if err := db.Register(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// scanStream scans an archive provided as a stream, such as stdin. ZIP
+// archives require random access, so the stream is buffered like nested
+// archives, spilling to a temporary file if it's larger than --spill-threshold
+// or doesn't fit --memory-budget. A nil report is returned if the stream isn't
+// a JAR.
+func scanStream(r io.Reader) (*jar.Report, error) {
+	return scanResult(scanConfig.ParseBuffered(context.Background(), r))
+}
+
+// scanFile scans a single archive on disk. A nil report is returned if the
+// file isn't a JAR.
+func scanFile(path string) (*jar.Report, error) {
+	return scanFileConfig(scanConfig, path)
+}
+
+// scanFileConfig scans a single archive on disk like scanFile, evaluating the
+// rules of cfg.
+func scanFileConfig(cfg *jar.Config, path string) (*jar.Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat: %v", err)
+	}
+	return scanReaderAt(cfg, f, info.Size())
+}
+
+// scanReaderAt scans an archive with the rules of cfg. A nil report is
+// returned if the archive isn't a ZIP archive, or a JMOD file.
+func scanReaderAt(cfg *jar.Config, ra io.ReaderAt, size int64) (*jar.Report, error) {
+	return scanResult(cfg.ParseReaderAt(context.Background(), ra, size))
+}
+
+// scanResult returns the outcome of scanning an archive, with a nil report if
+// it isn't a ZIP archive or JMOD file.
+func scanResult(r *jar.Report, err error) (*jar.Report, error) {
+	var te *jar.TruncatedError
+	switch {
+	case err == jar.ErrUnknownFormat:
+		return nil, nil
+	case errors.As(err, &te):
+		return nil, err
+	case err != nil:
+		return nil, fmt.Errorf("scanning jar: %v", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"log4jscanner/jar"
+)
+
+func TestScanStream(t *testing.T) {
+	vuln, err := os.ReadFile("jar/testdata/log4j-core-2.14.0.jar")
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	safe, err := os.ReadFile("jar/testdata/safe1.jar")
+	if err != nil {
+		t.Fatalf("reading jar: %v", err)
+	}
+	jmod := append([]byte{'J', 'M', 1, 0}, vuln...)
+
+	tests := []struct {
+		name string
+		data []byte
+		// limit is the spill threshold, the amount of the stream
+		// buffered in memory.
+		limit int64
+		// budget, if set, is the memory budget.
+		budget int64
+		// spillDir, if set, overrides the directory streams are spilled
+		// to.
+		spillDir string
+		want     bool
+		wantNil  bool
+		wantErr  bool
+	}{
+		{name: "Memory", data: vuln, limit: 64 << 20, want: true},
+		{name: "Spilled", data: vuln, limit: 1024, want: true},
+		{name: "AtLimit", data: vuln, limit: int64(len(vuln)), want: true},
+		{name: "OverLimit", data: vuln, limit: int64(len(vuln)) - 1, want: true},
+		{name: "Safe", data: safe, limit: 1024, want: false},
+		{name: "JMOD", data: jmod, limit: 64 << 20, want: true},
+		{name: "SpilledJMOD", data: jmod, limit: 1024, want: true},
+		{name: "NotAnArchive", data: bytes.Repeat([]byte("hello\n"), 1024), limit: 1024, wantNil: true},
+		// A spill directory that doesn't exist shows which streams
+		// were spilled.
+		{name: "MemoryIgnoresSpillDir", data: vuln, limit: 64 << 20, spillDir: "missing", want: true},
+		{name: "SpilledToSpillDir", data: vuln, limit: 1024, spillDir: "missing", wantErr: true},
+		{name: "WithinBudget", data: vuln, limit: 64 << 20, budget: 64 << 20, spillDir: "missing", want: true},
+		{name: "OverBudget", data: vuln, limit: 64 << 20, budget: 1024, want: true},
+		{name: "OverBudgetToSpillDir", data: vuln, limit: 64 << 20, budget: 1024, spillDir: "missing", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func(n int64) { scanConfig.SpillThreshold = n }(scanConfig.SpillThreshold)
+			scanConfig.SpillThreshold = tc.limit
+			defer func(b *jar.MemoryBudget) { scanConfig.MemoryBudget = b }(scanConfig.MemoryBudget)
+			scanConfig.MemoryBudget = nil
+			if tc.budget > 0 {
+				scanConfig.MemoryBudget = jar.NewMemoryBudget(tc.budget)
+				defer func() {
+					if n := scanConfig.MemoryBudget.Used(); n != 0 {
+						t.Errorf("%d bytes of the memory budget are still used", n)
+					}
+				}()
+			}
+			defer func(dir string) { scanConfig.SpillDir = dir }(scanConfig.SpillDir)
+			scanConfig.SpillDir = t.TempDir()
+			if tc.spillDir != "" {
+				scanConfig.SpillDir = filepath.Join(scanConfig.SpillDir, tc.spillDir)
+			}
+
+			r, err := scanStream(bytes.NewReader(tc.data))
+			if err != nil {
+				if !tc.wantErr {
+					t.Fatalf("scanStream() returned unexpected error: %v", err)
+				}
+				return
+			}
+			if tc.wantErr {
+				t.Fatalf("scanStream() expected error")
+			}
+			if r == nil {
+				if !tc.wantNil {
+					t.Fatalf("scanStream() returned nil report")
+				}
+				return
+			}
+			if tc.wantNil {
+				t.Fatalf("scanStream() returned report, want nil")
+			}
+			if r.Vulnerable != tc.want {
+				t.Errorf("scanStream() returned vulnerable %t, want %t", r.Vulnerable, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/metrics"
+	"log4jscanner/server"
+	"log4jscanner/store"
+	"log4jscanner/tlsconfig"
+)
+
+func serveUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner serve [flag]
+
+Runs an HTTP service that scans uploaded archives:
+
+    curl -H "Authorization: Bearer $TOKEN" --data-binary @app.war \
+        "https://scanner:8443/v1/scan?name=app.war"
+
+Tenants with "fetchURLs" may have the service download an archive with
+"?url=URL", and tenants with "paths" scan an archive of the service's
+filesystem within them with "?path=PATH". Responses hold the full "report" of
+JARs, in the format of --format json findings.
+
+Flags:
+
+    -l, --listen   Address to listen on (default ":8443").
+    --tenants      JSON file of tenants allowed to use the service. Without
+                   it, authentication is disabled.
+    --store        SQLite database written by "log4jscanner --store" to serve
+                   read-only under /v1/history/ to tenants with
+                   "readHistory". It must already exist, and is opened
+                   read-only unless --retain is set or a tenant may
+                   "annotate".
+    --retain       Hourly remove runs older than the given age (e.g. 90d)
+                   from --store, compacting the database when a quarter of
+                   it is free. Unlike serving history, this writes to the
+                   database.
+    --warm         Number of concurrent scans to preallocate buffers for at
+                   startup, so the first uploads under load aren't slowed
+                   by allocating them (default the number of CPUs, 0
+                   disables it).
+    --rules        JSON file selecting the rules uploads are scanned with,
+                   with the "enableRules", "disableRules", "cves" and
+                   "log4j1" of log4jscanner's --enable-rule, --disable-rule,
+                   --cve and --log4j1.
+                   `+reloadHelp+`
+    --metrics      Serve Prometheus metrics of the scans of uploads, their
+                   findings by severity, errors, and latency, under /metrics
+                   without authentication.
+    `+logFormatHelp+`
+`+serverTLSUsage+`
+Client certificates authenticate tenants by their "clientNames".
+
+`)
+}
+
+func serve(args []string) {
+	var (
+		listen  string
+		tenants string
+		dbPath  string
+		retain  time.Duration
+		warm    = runtime.GOMAXPROCS(0)
+		rules   string
+		metric  bool
+		logFmt  string
+		tlsOpts tlsconfig.Options
+	)
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&listen, "listen", ":8443", "")
+	flags.StringVar(&listen, "l", ":8443", "")
+	flags.StringVar(&tenants, "tenants", "", "")
+	flags.StringVar(&dbPath, "store", "", "")
+	flags.Func("retain", "", func(s string) (err error) {
+		retain, err = store.ParseAge(s)
+		return err
+	})
+	flags.IntVar(&warm, "warm", warm, "")
+	flags.StringVar(&rules, "rules", "", "")
+	flags.BoolVar(&metric, "metrics", false, "")
+	logFormatFlag(flags, &logFmt)
+	serverTLSFlags(flags, &tlsOpts)
+	flags.Usage = serveUsage
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		serveUsage()
+		os.Exit(1)
+	}
+	if warm < 0 {
+		log.Fatalf("Error: --warm must not be negative")
+	}
+	if retain > 0 && dbPath == "" {
+		log.Fatalf("Error: --retain requires --store")
+	}
+	requireStore(map[string]string{"store": dbPath})
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	setupLogging(logFmt)
+	s := &server.Server{Warm: warm}
+	if warm == 0 {
+		s.Warm = -1
+	}
+	if metric {
+		s.Metrics = &metrics.Registry{}
+	}
+	if tenants != "" {
+		c, err := server.LoadConfig(tenants)
+		if err != nil {
+			log.Fatalf("Error: loading tenants: %v", err)
+		}
+		s.Tenants = c.Tenants
+	} else {
+		log.Printf("Warning: no --tenants provided, authentication is disabled")
+	}
+	if rules != "" {
+		c, err := loadRules(rules)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if s.Rules, err = jar.NewSharedConfig(c); err != nil {
+			log.Fatalf("Error: %s: %v", rules, err)
+		}
+		handleReload(func() { reloadRules(s.Rules, rules) })
+	}
+	if dbPath != "" {
+		// Serving history only reads the database, so it's opened
+		// read-only unless pruning or annotations write to it.
+		open := store.OpenReadOnly
+		if retain > 0 || annotators(s.Tenants) {
+			open = store.Open
+		}
+		st, err := open(dbPath)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer st.Close()
+		s.Store = st
+		if retain > 0 {
+			go pruneEvery(st, retain, time.Hour)
+		}
+	}
+
+	s.Start()
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           s,
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+	log.Fatal(listenAndServe(srv, tlsOpts))
+}
+
+// Timeouts of serve's connections, so idle or slow clients can't hold them
+// open. The read timeout covers a whole request body, so it allows uploads
+// of the default 1GiB limit over slow links.
+const (
+	serveReadHeaderTimeout = 10 * time.Second
+	serveReadTimeout       = 30 * time.Minute
+	serveIdleTimeout       = 2 * time.Minute
+)
+
+// annotators reports if any tenant may change annotations, which are stored
+// in the results store.
+func annotators(tenants []*server.Tenant) bool {
+	for _, t := range tenants {
+		if t.Annotate {
+			return true
+		}
+	}
+	return false
+}
+
+// listenAndServe serves TLS if any TLS options are set, and plaintext HTTP
+// otherwise.
+func listenAndServe(srv *http.Server, o tlsconfig.Options) error {
+	if !o.Enabled() {
+		log.Printf("Listening on %s", srv.Addr)
+		return srv.ListenAndServe()
+	}
+	c, err := tlsconfig.Server(o)
+	if err != nil {
+		return fmt.Errorf("configuring TLS: %v", err)
+	}
+	srv.TLSConfig = c
+	log.Printf("Listening on %s with TLS", srv.Addr)
+	return srv.ListenAndServeTLS("", "")
+}
+
+// rulesFile is the format of serve's --rules.
+type rulesFile struct {
+	EnableRules  []string `json:"enableRules"`
+	DisableRules []string `json:"disableRules"`
+	CVEs         []string `json:"cves"`
+	Log4j1       bool     `json:"log4j1"`
+}
+
+// loadRules reads the rules selected by a --rules file.
+func loadRules(path string) (*jar.Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rules: %v", err)
+	}
+	var f rulesFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	c := &jar.Config{EnableRules: f.EnableRules, DisableRules: f.DisableRules, Log4j1: f.Log4j1}
+	for _, cve := range f.CVEs {
+		c.CVEs = append(c.CVEs, strings.ToUpper(cve))
+	}
+	return c, nil
+}
+
+// reloadRules replaces the rules of a running server with the current
+// contents of a --rules file, keeping the previous rules if it's invalid.
+func reloadRules(s *jar.SharedConfig, path string) {
+	c, err := loadRules(path)
+	if err == nil {
+		err = s.Store(c)
+	}
+	if err != nil {
+		log.Printf("Error: reloading rules, keeping the previous rules: %v", err)
+		return
+	}
+	log.Printf("Reloaded rules from %s", path)
+}
+
+// pruneEvery prunes a store on an interval, starting immediately.
+func pruneEvery(s *store.Store, retain, interval time.Duration) {
+	for {
+		p, err := prune(s, retain, compactFraction)
+		if err != nil {
+			log.Printf("Error: pruning results store: %v", err)
+		} else if p.Runs > 0 {
+			log.Printf("Pruned %d runs older than %s", p.Runs, retain)
+		}
+		time.Sleep(interval)
+	}
+}
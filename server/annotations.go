@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"log4jscanner/store"
+)
+
+// maxAnnotationBytes limits the size of an annotation request body.
+const maxAnnotationBytes = 64 << 10 // 64KiB
+
+// annotations serves the remediation annotations of the results store.
+// Listing requires ReadHistory, and changing them Annotate.
+func (s *Server) annotations(w http.ResponseWriter, r *http.Request, t *Tenant) {
+	if s.Store == nil {
+		http.NotFound(w, r)
+		return
+	}
+	allowed := t == anonymous || t.ReadHistory
+	if r.Method != http.MethodGet {
+		allowed = t == anonymous || t.Annotate
+	}
+	if !allowed {
+		http.Error(w, "tenant may not access annotations", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodGet && s.Store.ReadOnly() {
+		http.Error(w, "results store is read-only", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		as, err := s.Store.Annotations()
+		if err != nil {
+			log.Printf("Error: querying results store: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if as == nil {
+			as = []store.Annotation{}
+		}
+		writeJSON(w, http.StatusOK, as)
+	case http.MethodPut:
+		var a store.Annotation
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnotationBytes)).Decode(&a); err != nil {
+			http.Error(w, "decoding annotation: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if a.Host == "" || a.Path == "" {
+			http.Error(w, "annotation requires a host and path", http.StatusBadRequest)
+			return
+		}
+		if err := store.CheckStatus(a.Status); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.UpdatedBy = t.Name
+		a.Updated = s.now().UTC()
+		if err := s.Store.SetAnnotation(&a); err != nil {
+			log.Printf("Error: updating results store: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, a)
+	case http.MethodDelete:
+		q := r.URL.Query()
+		ok, err := s.Store.DeleteAnnotation(q.Get("host"), q.Get("path"))
+		if err != nil {
+			log.Printf("Error: updating results store: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/store"
+)
+
+// defaultTrendDays is how far back trends go without a "since" parameter.
+const defaultTrendDays = 30
+
+// history serves the read-only endpoints over the results store.
+func (s *Server) history(w http.ResponseWriter, r *http.Request, t *Tenant) {
+	if s.Store == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if t != anonymous && !t.ReadHistory {
+		http.Error(w, "tenant may not read history", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	var (
+		v   interface{}
+		err error
+	)
+	switch strings.TrimPrefix(r.URL.Path, "/v1/history/") {
+	case "findings":
+		f, ferr := parseFilter(q)
+		if ferr != nil {
+			http.Error(w, ferr.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, ierr := s.Store.Inventory(f)
+		if entries == nil {
+			entries = []store.Entry{}
+		}
+		v, err = entries, ierr
+	case "trends":
+		since := s.now().AddDate(0, 0, -defaultTrendDays)
+		if p := q.Get("since"); p != "" {
+			if since, err = store.ParseTime(p); err != nil {
+				http.Error(w, "since: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		points, terr := s.Store.Trend(since)
+		if points == nil {
+			points = []store.TrendPoint{}
+		}
+		v, err = points, terr
+	case "coverage":
+		coverage, cerr := s.Store.Coverage()
+		if coverage == nil {
+			coverage = []store.Coverage{}
+		}
+		v, err = coverage, cerr
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error: querying results store: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// parseFilter parses the query parameters of the findings endpoint.
+func parseFilter(q url.Values) (store.Filter, error) {
+	f := store.Filter{
+		Host:     q.Get("host"),
+		PathGlob: q.Get("path"),
+		CVE:      strings.ToUpper(q.Get("cve")),
+		Status:   q.Get("status"),
+		Owner:    q.Get("owner"),
+	}
+	if err := store.CheckStatus(f.Status); err != nil {
+		return f, err
+	}
+	if p := q.Get("severity"); p != "" {
+		sev, err := jar.ParseSeverity(p)
+		if err != nil {
+			return f, err
+		}
+		f.MinSeverity = sev
+	}
+	times := []struct {
+		param string
+		t     *time.Time
+	}{
+		{"firstSeenAfter", &f.FirstSeenAfter},
+		{"firstSeenBefore", &f.FirstSeenBefore},
+		{"lastSeenAfter", &f.LastSeenAfter},
+		{"lastSeenBefore", &f.LastSeenBefore},
+	}
+	for _, pt := range times {
+		p := q.Get(pt.param)
+		if p == "" {
+			continue
+		}
+		t, err := store.ParseTime(p)
+		if err != nil {
+			return f, fmt.Errorf("%s: %v", pt.param, err)
+		}
+		*pt.t = t
+	}
+	return f, nil
+}
@@ -0,0 +1,600 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server implements a shared HTTP scanning service.
+//
+// Clients upload an archive and receive a scan report:
+//
+//	POST /v1/scan?name=app.war   Scan the request body.
+//	POST /v1/scan?url=URL        Download and scan an archive, such as one
+//	                             an artifact repository notified of, for
+//	                             tenants with FetchURLs.
+//	POST /v1/scan?path=PATH      Scan an archive on the server's
+//	                             filesystem, within one of the tenant's
+//	                             Paths.
+//	GET  /v1/results             List the tenant's recent results.
+//	GET  /v1/results/{id}        Get a single result.
+//
+// If the server has a results store, tenants with ReadHistory may also query
+// the fleet-wide history recorded by "log4jscanner --store":
+//
+//	GET  /v1/history/findings    List vulnerable paths, filtered by the host,
+//	                             path, cve, severity, firstSeenAfter,
+//	                             firstSeenBefore, lastSeenAfter,
+//	                             lastSeenBefore, status, and owner
+//	                             parameters.
+//	GET  /v1/history/trends      Daily counts of runs and findings since the
+//	                             "since" parameter (default 30 days ago).
+//	GET  /v1/history/coverage    The latest run of every host.
+//	GET  /v1/annotations         List the remediation annotations of paths.
+//
+// Tenants with Annotate may track remediation by annotating vulnerable paths
+// with an owner, ticket, and status:
+//
+//	PUT    /v1/annotations       Create or replace the store.Annotation in
+//	                             the request body.
+//	DELETE /v1/annotations       Remove the annotation of the host and path
+//	                             parameters.
+//
+// If the server has metrics, they're served without authentication, for
+// Prometheus to scrape:
+//
+//	GET  /metrics                Scans, findings, errors, and scan latency.
+//
+// The server can be shared by many teams. Each request is authenticated as a
+// Tenant, either by an API token passed as "Authorization: Bearer <token>", or
+// by a verified TLS client certificate. Tenants are subject to their own
+// quotas, and can only see their own results.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/metrics"
+	"log4jscanner/results"
+	"log4jscanner/store"
+)
+
+const (
+	defaultMaxUploadBytes = 1 << 30 // 1GiB
+	// maxMemoryBytes is the size of an upload that's held in memory before
+	// spilling to a temporary file.
+	maxMemoryBytes = 32 << 20 // 32MiB
+	// maxResults is the number of results retained per tenant.
+	maxResults = 1000
+	// uploadBufferBytes is the initial size of a buffer uploads are read
+	// into, which holds small JARs without growing.
+	uploadBufferBytes = 1 << 20 // 1MiB
+	// maxPooledBytes is the size of the largest upload buffer that's
+	// reused. Buffers grown by larger uploads are released.
+	maxPooledBytes = 8 << 20 // 8MiB
+)
+
+// uploadBuffers holds the buffers uploads are read into, reused between
+// requests.
+var uploadBuffers = sync.Pool{
+	New: func() interface{} {
+		return bytes.NewBuffer(make([]byte, 0, uploadBufferBytes))
+	},
+}
+
+// Tenant is a team using the server.
+type Tenant struct {
+	// Name identifies the tenant in results.
+	Name string `json:"name"`
+	// TokenSHA256 holds hex encoded SHA-256 hashes of the tenant's API
+	// tokens. Only hashes are stored so the configuration isn't a secret.
+	TokenSHA256 []string `json:"tokenSHA256,omitempty"`
+	// ClientNames holds the subject common names or DNS names of TLS client
+	// certificates that authenticate as the tenant.
+	ClientNames []string `json:"clientNames,omitempty"`
+	// RequestsPerMinute limits how many scans the tenant may request. Zero
+	// means unlimited.
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+	// MaxUploadBytes limits the size of a single upload. Defaults to 1GiB.
+	MaxUploadBytes int64 `json:"maxUploadBytes,omitempty"`
+	// ReadHistory allows the tenant to query the results store, which holds
+	// the results of every scanned host rather than only the tenant's own.
+	ReadHistory bool `json:"readHistory,omitempty"`
+	// Annotate allows the tenant to change the annotations of paths in the
+	// results store.
+	Annotate bool `json:"annotate,omitempty"`
+	// FetchURLs allows the tenant to have the server download archives
+	// over HTTP or HTTPS, up to MaxUploadBytes. The server fetches them
+	// from its own network, so only trusted tenants should be allowed.
+	FetchURLs bool `json:"fetchURLs,omitempty"`
+	// Paths holds the directories of the server's filesystem the tenant
+	// may scan archives within by path, such as a mounted artifact
+	// repository.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// Config is the JSON configuration file format for tenants.
+type Config struct {
+	Tenants []*Tenant `json:"tenants"`
+}
+
+// LoadConfig reads a JSON tenant configuration file.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	// Each name, token, and client name must identify a single tenant, so
+	// one tenant's results are never attributed to another.
+	names := map[string]bool{}
+	tokens := map[string]string{}
+	clients := map[string]string{}
+	for i, t := range c.Tenants {
+		if t.Name == "" {
+			return nil, fmt.Errorf("parsing %s: tenant %d has no name", path, i)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("parsing %s: duplicate tenant %s", path, t.Name)
+		}
+		names[t.Name] = true
+		if len(t.TokenSHA256) == 0 && len(t.ClientNames) == 0 {
+			return nil, fmt.Errorf("parsing %s: tenant %s has no tokens or client names", path, t.Name)
+		}
+		for _, token := range t.TokenSHA256 {
+			// Tokens are compared in lower case.
+			token = strings.ToLower(token)
+			if other, ok := tokens[token]; ok {
+				return nil, fmt.Errorf("parsing %s: tenants %s and %s share a token", path, other, t.Name)
+			}
+			tokens[token] = t.Name
+		}
+		for _, name := range t.ClientNames {
+			if other, ok := clients[name]; ok {
+				return nil, fmt.Errorf("parsing %s: tenants %s and %s share client name %s", path, other, t.Name, name)
+			}
+			clients[name] = t.Name
+		}
+	}
+	return &c, nil
+}
+
+// HashToken returns the value to use in TokenSHA256 for a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Result is the outcome of scanning an uploaded archive.
+type Result struct {
+	ID     string    `json:"id"`
+	Tenant string    `json:"tenant,omitempty"`
+	Name   string    `json:"name,omitempty"`
+	Time   time.Time `json:"time"`
+	Size   int64     `json:"size"`
+	// JAR is set once the upload was scanned. Uploads that aren't a JAR
+	// are rejected with 415 Unsupported Media Type.
+	JAR        bool   `json:"jar"`
+	Vulnerable bool   `json:"vulnerable"`
+	MainClass  string `json:"mainClass,omitempty"`
+	Version    string `json:"version,omitempty"`
+
+	BundleSymbolicName string `json:"bundleSymbolicName,omitempty"`
+	BundleVersion      string `json:"bundleVersion,omitempty"`
+
+	// Report is the full report of a JAR, in the format of the scanner's
+	// JSON findings, with the name as its path.
+	Report *results.Finding `json:"report,omitempty"`
+}
+
+// Server is an http.Handler scanning uploaded archives.
+type Server struct {
+	// Tenants authorized to use the server. If empty, authentication is
+	// disabled and all requests share a single anonymous tenant.
+	Tenants []*Tenant
+
+	// TempDir is where large uploads are spilled. Defaults to os.TempDir.
+	TempDir string
+
+	// Store, if set, is served through the history endpoints, which are
+	// read-only, and the annotation endpoints.
+	Store *store.Store
+
+	// Warm is the number of concurrent scans buffers are preallocated for
+	// when the server starts, so the latency of the first uploads under
+	// load doesn't include allocating them. Defaults to GOMAXPROCS, a
+	// negative value disables it.
+	Warm int
+
+	// Rules, if set, selects the rules uploads are scanned with. It may be
+	// replaced while the server is running, uploads being scanned keep the
+	// rules they started with.
+	Rules *jar.SharedConfig
+
+	// Metrics, if set, records the scans of uploads, and is served under
+	// /metrics.
+	Metrics *metrics.Registry
+
+	// Client downloads the archives of tenants with FetchURLs. Defaults to
+	// a client that times out after 10 minutes and won't connect to
+	// link-local or cloud metadata addresses. Redirects are checked against
+	// the same policy as the requested URL whichever client is used.
+	Client *http.Client
+
+	scans   *metrics.Scans
+	once    sync.Once
+	mu      sync.Mutex
+	results map[string][]*Result
+	windows map[string]*window
+	now     func() time.Time
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+var anonymous = &Tenant{}
+
+// config returns the configuration to scan an upload with.
+func (s *Server) config() *jar.Config {
+	if s.Rules == nil {
+		return nil
+	}
+	return s.Rules.Load()
+}
+
+func (s *Server) init() {
+	s.once.Do(func() {
+		s.results = map[string][]*Result{}
+		s.windows = map[string]*window{}
+		if s.now == nil {
+			s.now = time.Now
+		}
+		if s.Metrics != nil {
+			s.scans = metrics.NewScans(s.Metrics)
+		}
+		n := s.Warm
+		if n == 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		if n > 0 {
+			jar.Warm(n)
+			bufs := make([]interface{}, n)
+			for i := range bufs {
+				bufs[i] = uploadBuffers.Get()
+			}
+			for _, b := range bufs {
+				uploadBuffers.Put(b)
+			}
+		}
+	})
+}
+
+// Start preallocates the server's buffers, which otherwise happens on the
+// first request.
+func (s *Server) Start() {
+	s.init()
+}
+
+// authenticate returns the tenant making a request, or nil.
+func (s *Server) authenticate(r *http.Request) *Tenant {
+	if len(s.Tenants) == 0 {
+		return anonymous
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+		for _, t := range s.Tenants {
+			for _, want := range t.ClientNames {
+				for _, name := range names {
+					if name != "" && name == want {
+						return t
+					}
+				}
+			}
+		}
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil
+	}
+	got := HashToken(strings.TrimPrefix(auth, "Bearer "))
+	var match *Tenant
+	for _, t := range s.Tenants {
+		for _, want := range t.TokenSHA256 {
+			// Compare every token to avoid leaking which tenant matched
+			// through timing.
+			if subtle.ConstantTimeCompare([]byte(got), []byte(strings.ToLower(want))) == 1 {
+				match = t
+			}
+		}
+	}
+	return match
+}
+
+// allow enforces the tenant's request quota.
+func (s *Server) allow(t *Tenant) bool {
+	if t.RequestsPerMinute <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	w, ok := s.windows[t.Name]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		w = &window{start: now}
+		s.windows[t.Name] = w
+	}
+	if w.count >= t.RequestsPerMinute {
+		return false
+	}
+	w.count++
+	return true
+}
+
+func (s *Server) record(t *Tenant, res *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs := append(s.results[t.Name], res)
+	if len(rs) > maxResults {
+		rs = rs[len(rs)-maxResults:]
+	}
+	s.results[t.Name] = rs
+}
+
+// ServeHTTP implements the scanning API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.init()
+	if r.URL.Path == "/metrics" && s.Metrics != nil {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.Metrics.ServeHTTP(w, r)
+		return
+	}
+	t := s.authenticate(r)
+	if t == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.URL.Path == "/v1/scan":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.scan(w, r, t)
+	case r.URL.Path == "/v1/results":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.mu.Lock()
+		rs := s.results[t.Name]
+		list := make([]*Result, len(rs))
+		// Newest first.
+		for i, res := range rs {
+			list[len(rs)-1-i] = res
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, list)
+	case strings.HasPrefix(r.URL.Path, "/v1/results/"):
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/v1/results/")
+		s.mu.Lock()
+		var found *Result
+		for _, res := range s.results[t.Name] {
+			if res.ID == id {
+				found = res
+			}
+		}
+		s.mu.Unlock()
+		if found == nil {
+			// Results of other tenants are indistinguishable from missing
+			// results.
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, found)
+	case strings.HasPrefix(r.URL.Path, "/v1/history/"):
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.history(w, r, t)
+	case r.URL.Path == "/v1/annotations":
+		s.annotations(w, r, t)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) scan(w http.ResponseWriter, r *http.Request, t *Tenant) {
+	if !s.allow(t) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "request quota exceeded", http.StatusTooManyRequests)
+		return
+	}
+	limit := t.MaxUploadBytes
+	if limit <= 0 {
+		limit = defaultMaxUploadBytes
+	}
+	if r.ContentLength > limit {
+		http.Error(w, fmt.Sprintf("upload exceeds %d bytes", limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("url") != "" && q.Get("path") != "" {
+		http.Error(w, "only one of url and path may be provided", http.StatusBadRequest)
+		return
+	}
+	id, err := newID()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	res := &Result{
+		ID:     id,
+		Tenant: t.Name,
+		Name:   q.Get("name"),
+		Time:   s.now().UTC(),
+	}
+	switch {
+	case q.Get("url") != "":
+		if res.Name == "" {
+			res.Name = q.Get("url")
+		}
+		err = s.scanURL(w, r, t, q.Get("url"), limit, res)
+	case q.Get("path") != "":
+		if res.Name == "" {
+			res.Name = q.Get("path")
+		}
+		err = s.scanPath(r.Context(), t, q.Get("path"), res)
+	default:
+		err = s.scanBody(r.Context(), http.MaxBytesReader(w, r.Body, limit), res)
+	}
+	if err != nil {
+		var se *statusError
+		if errors.As(err, &se) {
+			http.Error(w, se.Error(), se.code)
+			return
+		}
+		if strings.Contains(err.Error(), "request body too large") {
+			http.Error(w, fmt.Sprintf("upload exceeds %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	s.record(t, res)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// scanBody buffers an upload, spilling to disk if it's large, and scans it
+// until ctx, the context of the request, is done.
+func (s *Server) scanBody(ctx context.Context, body io.Reader, res *Result) error {
+	b := uploadBuffers.Get().(*bytes.Buffer)
+	b.Reset()
+	defer func() {
+		if b.Cap() <= maxPooledBytes {
+			uploadBuffers.Put(b)
+		}
+	}()
+	if _, err := b.ReadFrom(io.LimitReader(body, maxMemoryBytes+1)); err != nil {
+		return fmt.Errorf("reading upload: %v", err)
+	}
+	buf := b.Bytes()
+	var (
+		ra   io.ReaderAt
+		size int64
+	)
+	if len(buf) <= maxMemoryBytes {
+		ra, size = bytes.NewReader(buf), int64(len(buf))
+	} else {
+		tf, err := os.CreateTemp(s.TempDir, "log4jscanner-upload-")
+		if err != nil {
+			return fmt.Errorf("creating temp file: %v", err)
+		}
+		defer os.Remove(tf.Name())
+		defer tf.Close()
+		if _, err := tf.Write(buf); err != nil {
+			return fmt.Errorf("writing temp file: %v", err)
+		}
+		buf = nil
+		n, err := io.Copy(tf, body)
+		if err != nil {
+			return fmt.Errorf("reading upload: %v", err)
+		}
+		ra, size = tf, maxMemoryBytes+1+n
+	}
+	return s.scanReaderAt(ctx, ra, size, res)
+}
+
+// scanReaderAt scans an archive of the given size, recording the outcome in
+// res.
+func (s *Server) scanReaderAt(ctx context.Context, ra io.ReaderAt, size int64, res *Result) error {
+	res.Size = size
+	rep, err := s.parse(ctx, ra, size)
+	if err != nil {
+		return err
+	}
+	res.JAR = true
+	res.Vulnerable = rep.Vulnerable
+	res.MainClass = rep.MainClass
+	res.Version = rep.Version
+	res.BundleSymbolicName = rep.Bundle.SymbolicName
+	res.BundleVersion = rep.Bundle.Version
+	f := results.FromReport(res.Name, rep)
+	f.Time = res.Time
+	res.Report = &f
+	return nil
+}
+
+// parse scans an upload, and records the scan in the server's metrics. The
+// upload's central directory is only read once, by ParseReaderAt, and uploads
+// that aren't a ZIP archive or JMOD file are rejected.
+func (s *Server) parse(ctx context.Context, ra io.ReaderAt, size int64) (*jar.Report, error) {
+	start := time.Now()
+	rep, err := s.config().ParseReaderAt(ctx, ra, size)
+	if err == jar.ErrUnknownFormat {
+		s.observe(start, nil, nil)
+		return nil, &statusError{http.StatusUnsupportedMediaType, "not a JAR: expected a ZIP archive or JMOD file"}
+	}
+	s.observe(start, rep, err)
+	if err != nil {
+		return nil, fmt.Errorf("scanning jar: %v", err)
+	}
+	return rep, nil
+}
+
+func (s *Server) observe(start time.Time, rep *jar.Report, err error) {
+	if s.scans != nil {
+		s.scans.Record(time.Since(start), rep, err)
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,689 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/metrics"
+	"log4jscanner/store"
+	"log4jscanner/testjar"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("..", "jar", "testdata", name))
+	if err != nil {
+		t.Fatalf("reading test data: %v", err)
+	}
+	return b
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{
+			name:   "Valid",
+			config: `{"tenants": [{"name": "a", "tokenSHA256": ["aa"]}, {"name": "b", "tokenSHA256": ["bb"], "clientNames": ["b.example.com"]}]}`,
+		},
+		{
+			name:    "NoName",
+			config:  `{"tenants": [{"tokenSHA256": ["aa"]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "NoCredentials",
+			config:  `{"tenants": [{"name": "a"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "DuplicateName",
+			config:  `{"tenants": [{"name": "a", "tokenSHA256": ["aa"]}, {"name": "a", "tokenSHA256": ["bb"]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "DuplicateToken",
+			config:  `{"tenants": [{"name": "a", "tokenSHA256": ["aa"]}, {"name": "b", "tokenSHA256": ["AA"]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "DuplicateClientName",
+			config:  `{"tenants": [{"name": "a", "clientNames": ["c.example.com"]}, {"name": "b", "clientNames": ["c.example.com"]}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tenants.json")
+			if err := os.WriteFile(path, []byte(tc.config), 0644); err != nil {
+				t.Fatalf("writing config: %v", err)
+			}
+			_, err := LoadConfig(path)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("LoadConfig() returned error %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+type client struct {
+	t     *testing.T
+	url   string
+	token string
+}
+
+func (c *client) do(method, path string, body []byte, v interface{}) int {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		c.t.Fatalf("creating request: %v", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			c.t.Fatalf("decoding response: %v", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	s := &Server{
+		Tenants: []*Tenant{
+			{Name: "payments", TokenSHA256: []string{HashToken("payments-token")}},
+			{Name: "search", TokenSHA256: []string{HashToken("search-token")}, RequestsPerMinute: 1},
+		},
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	payments := &client{t, srv.URL, "payments-token"}
+	search := &client{t, srv.URL, "search-token"}
+	anon := &client{t, srv.URL, ""}
+	bad := &client{t, srv.URL, "wrong"}
+
+	vuln := readTestdata(t, "vuln-class.jar")
+	if code := anon.do("POST", "/v1/scan", vuln, nil); code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated scan returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := bad.do("POST", "/v1/scan", vuln, nil); code != http.StatusUnauthorized {
+		t.Errorf("scan with invalid token returned %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	var res Result
+	if code := payments.do("POST", "/v1/scan?name=vuln-class.jar", vuln, &res); code != http.StatusOK {
+		t.Fatalf("scan returned %d, want %d", code, http.StatusOK)
+	}
+	if !res.JAR || !res.Vulnerable || res.Tenant != "payments" || res.Name != "vuln-class.jar" {
+		t.Errorf("unexpected scan result: %+v", res)
+	}
+
+	var safe Result
+	if code := search.do("POST", "/v1/scan", readTestdata(t, "safe1.jar"), &safe); code != http.StatusOK {
+		t.Fatalf("scan returned %d, want %d", code, http.StatusOK)
+	}
+	if safe.Vulnerable {
+		t.Errorf("safe JAR reported as vulnerable")
+	}
+	if code := search.do("POST", "/v1/scan", vuln, nil); code != http.StatusTooManyRequests {
+		t.Errorf("scan over quota returned %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Results are isolated between tenants.
+	var got Result
+	if code := payments.do("GET", "/v1/results/"+res.ID, nil, &got); code != http.StatusOK || got.ID != res.ID {
+		t.Errorf("getting own result returned %d, %+v", code, got)
+	}
+	if code := search.do("GET", "/v1/results/"+res.ID, nil, nil); code != http.StatusNotFound {
+		t.Errorf("getting another tenant's result returned %d, want %d", code, http.StatusNotFound)
+	}
+	var list []Result
+	if code := search.do("GET", "/v1/results", nil, &list); code != http.StatusOK {
+		t.Fatalf("listing results returned %d", code)
+	}
+	if len(list) != 1 || list[0].ID != safe.ID {
+		t.Errorf("listing results returned %+v, want only %s", list, safe.ID)
+	}
+}
+
+func TestServerQuotaWindow(t *testing.T) {
+	now := time.Now()
+	s := &Server{now: func() time.Time { return now }}
+	s.init()
+	tenant := &Tenant{Name: "t", RequestsPerMinute: 2}
+	for i := 0; i < 2; i++ {
+		if !s.allow(tenant) {
+			t.Fatalf("request %d denied", i)
+		}
+	}
+	if s.allow(tenant) {
+		t.Errorf("request over quota allowed")
+	}
+	now = now.Add(time.Minute)
+	if !s.allow(tenant) {
+		t.Errorf("request in new window denied")
+	}
+}
+
+func TestServerUploadLimit(t *testing.T) {
+	s := &Server{
+		Tenants: []*Tenant{
+			{Name: "small", TokenSHA256: []string{HashToken("small")}, MaxUploadBytes: 10},
+		},
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := &client{t, srv.URL, "small"}
+	if code := c.do("POST", "/v1/scan", readTestdata(t, "vuln-class.jar"), nil); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large upload returned %d, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestServerHistory(t *testing.T) {
+	if !store.Supported {
+		t.Skip("SQLite requires cgo")
+	}
+	st, err := store.Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	defer st.Close()
+	for _, host := range []string{"host1", "host2"} {
+		run, err := st.StartRun(host, []string{"/opt"})
+		if err != nil {
+			t.Fatalf("StartRun() failed: %v", err)
+		}
+		f := store.Finding{RunID: run.ID, Path: "/opt/" + host + ".jar",
+			CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical}
+		if err := st.AddFinding(f); err != nil {
+			t.Fatalf("AddFinding() failed: %v", err)
+		}
+		if err := st.FinishRun(run); err != nil {
+			t.Fatalf("FinishRun() failed: %v", err)
+		}
+	}
+
+	s := &Server{
+		Tenants: []*Tenant{
+			{Name: "dashboard", TokenSHA256: []string{HashToken("dashboard-token")}, ReadHistory: true},
+			{Name: "payments", TokenSHA256: []string{HashToken("payments-token")}},
+		},
+		Store: st,
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	dashboard := &client{t, srv.URL, "dashboard-token"}
+	payments := &client{t, srv.URL, "payments-token"}
+
+	if code := payments.do("GET", "/v1/history/findings", nil, nil); code != http.StatusForbidden {
+		t.Errorf("history without permission returned %d, want %d", code, http.StatusForbidden)
+	}
+
+	var entries []store.Entry
+	if code := dashboard.do("GET", "/v1/history/findings?host=host2&severity=high", nil, &entries); code != http.StatusOK {
+		t.Fatalf("listing findings returned %d", code)
+	}
+	if len(entries) != 1 || entries[0].Path != "/opt/host2.jar" || entries[0].Severity != jar.SeverityCritical {
+		t.Errorf("listing findings returned %+v, want only /opt/host2.jar", entries)
+	}
+	if code := dashboard.do("GET", "/v1/history/findings?severity=severe", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("invalid severity returned %d, want %d", code, http.StatusBadRequest)
+	}
+
+	var points []store.TrendPoint
+	if code := dashboard.do("GET", "/v1/history/trends", nil, &points); code != http.StatusOK {
+		t.Fatalf("getting trends returned %d", code)
+	}
+	if len(points) != 1 || points[0].Runs != 2 || points[0].Findings != 2 || points[0].VulnerableHosts != 2 {
+		t.Errorf("getting trends returned %+v, want a single day with 2 runs and findings", points)
+	}
+
+	var coverage []store.Coverage
+	if code := dashboard.do("GET", "/v1/history/coverage", nil, &coverage); code != http.StatusOK {
+		t.Fatalf("getting coverage returned %d", code)
+	}
+	if len(coverage) != 2 || coverage[0].Host != "host1" || coverage[0].Findings != 1 || coverage[0].LastFinished.IsZero() {
+		t.Errorf("getting coverage returned %+v, want both hosts", coverage)
+	}
+}
+
+func TestServerAnnotations(t *testing.T) {
+	if !store.Supported {
+		t.Skip("SQLite requires cgo")
+	}
+	st, err := store.Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	defer st.Close()
+	run, err := st.StartRun("host1", []string{"/opt"})
+	if err != nil {
+		t.Fatalf("StartRun() failed: %v", err)
+	}
+	for _, p := range []string{"/opt/a.jar", "/opt/b.jar"} {
+		f := store.Finding{RunID: run.ID, Path: p, CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical}
+		if err := st.AddFinding(f); err != nil {
+			t.Fatalf("AddFinding() failed: %v", err)
+		}
+	}
+
+	s := &Server{
+		Tenants: []*Tenant{
+			{Name: "secops", TokenSHA256: []string{HashToken("secops-token")}, ReadHistory: true, Annotate: true},
+			{Name: "dashboard", TokenSHA256: []string{HashToken("dashboard-token")}, ReadHistory: true},
+		},
+		Store: st,
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	secops := &client{t, srv.URL, "secops-token"}
+	dashboard := &client{t, srv.URL, "dashboard-token"}
+
+	body := []byte(`{"host": "host1", "path": "/opt/a.jar", "owner": "payments", "ticket": "SEC-1", "status": "in-progress"}`)
+	if code := dashboard.do("PUT", "/v1/annotations", body, nil); code != http.StatusForbidden {
+		t.Errorf("annotating without permission returned %d, want %d", code, http.StatusForbidden)
+	}
+	var a store.Annotation
+	if code := secops.do("PUT", "/v1/annotations", body, &a); code != http.StatusOK {
+		t.Fatalf("annotating returned %d", code)
+	}
+	if a.UpdatedBy != "secops" || a.Updated.IsZero() {
+		t.Errorf("annotating returned %+v, want updated by secops", a)
+	}
+	invalid := []byte(`{"host": "host1", "path": "/opt/b.jar", "status": "done"}`)
+	if code := secops.do("PUT", "/v1/annotations", invalid, nil); code != http.StatusBadRequest {
+		t.Errorf("annotating with an invalid status returned %d, want %d", code, http.StatusBadRequest)
+	}
+
+	var entries []store.Entry
+	if code := dashboard.do("GET", "/v1/history/findings?status=open", nil, &entries); code != http.StatusOK {
+		t.Fatalf("listing findings returned %d", code)
+	}
+	if len(entries) != 1 || entries[0].Path != "/opt/b.jar" {
+		t.Errorf("listing open findings returned %+v, want only /opt/b.jar", entries)
+	}
+	if code := dashboard.do("GET", "/v1/history/findings?owner=payments", nil, &entries); code != http.StatusOK {
+		t.Fatalf("listing findings returned %d", code)
+	}
+	if len(entries) != 1 || entries[0].Annotation == nil || entries[0].Annotation.Ticket != "SEC-1" {
+		t.Errorf("listing payments' findings returned %+v, want /opt/a.jar with its annotation", entries)
+	}
+
+	var as []store.Annotation
+	if code := dashboard.do("GET", "/v1/annotations", nil, &as); code != http.StatusOK {
+		t.Fatalf("listing annotations returned %d", code)
+	}
+	if len(as) != 1 || as[0].Path != "/opt/a.jar" {
+		t.Errorf("listing annotations returned %+v, want /opt/a.jar", as)
+	}
+	if code := secops.do("DELETE", "/v1/annotations?host=host1&path=/opt/a.jar", nil, nil); code != http.StatusNoContent {
+		t.Errorf("deleting annotation returned %d, want %d", code, http.StatusNoContent)
+	}
+	if code := secops.do("DELETE", "/v1/annotations?host=host1&path=/opt/a.jar", nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleting a deleted annotation returned %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestServerReadOnlyStore(t *testing.T) {
+	if !store.Supported {
+		t.Skip("SQLite requires cgo")
+	}
+	path := filepath.Join(t.TempDir(), "results.db")
+	st, err := store.Open(path)
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	st.Close()
+	if st, err = store.OpenReadOnly(path); err != nil {
+		t.Fatalf("opening store read-only: %v", err)
+	}
+	defer st.Close()
+
+	s := &Server{Store: st}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := &client{t, srv.URL, ""}
+	if code := c.do("GET", "/v1/annotations", nil, nil); code != http.StatusOK {
+		t.Errorf("listing annotations returned %d, want %d", code, http.StatusOK)
+	}
+	body := []byte(`{"host": "host1", "path": "/opt/a.jar", "status": "open"}`)
+	if code := c.do("PUT", "/v1/annotations", body, nil); code != http.StatusForbidden {
+		t.Errorf("annotating read-only store returned %d, want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestServerWarm(t *testing.T) {
+	s := &Server{Warm: 2}
+	s.Start()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := &client{t, srv.URL, ""}
+
+	// Buffers are reused between uploads, so alternate the results.
+	vuln, safe := readTestdata(t, "vuln-class.jar"), readTestdata(t, "safe1.jar")
+	for i := 0; i < 4; i++ {
+		for _, tc := range []struct {
+			data []byte
+			want bool
+		}{{vuln, true}, {safe, false}} {
+			var res Result
+			if code := c.do("POST", "/v1/scan", tc.data, &res); code != http.StatusOK {
+				t.Fatalf("scan returned %d, want %d", code, http.StatusOK)
+			}
+			if res.Vulnerable != tc.want || res.Size != int64(len(tc.data)) {
+				t.Errorf("scan returned vulnerable %t and size %d, want %t and %d", res.Vulnerable, res.Size, tc.want, len(tc.data))
+			}
+		}
+	}
+}
+
+func TestServerFormats(t *testing.T) {
+	vuln := readTestdata(t, "vuln-class.jar")
+	tests := []struct {
+		name           string
+		data           []byte
+		want           int
+		wantVulnerable bool
+	}{
+		{name: "JAR", data: vuln, want: http.StatusOK, wantVulnerable: true},
+		{name: "JMOD", data: append([]byte{'J', 'M', 1, 0}, vuln...), want: http.StatusOK, wantVulnerable: true},
+		{name: "NotAnArchive", data: []byte(strings.Repeat("not a jar\n", 100)), want: http.StatusUnsupportedMediaType},
+		{name: "Truncated", data: vuln[:len(vuln)/2], want: http.StatusUnprocessableEntity},
+	}
+	s := &Server{}
+	s.Start()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := &client{t, srv.URL, ""}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var res Result
+			if code := c.do("POST", "/v1/scan", tc.data, &res); code != tc.want {
+				t.Fatalf("scan returned %d, want %d", code, tc.want)
+			}
+			if tc.want == http.StatusOK && (!res.JAR || res.Vulnerable != tc.wantVulnerable) {
+				t.Errorf("scan returned jar %t and vulnerable %t, want true and %t", res.JAR, res.Vulnerable, tc.wantVulnerable)
+			}
+		})
+	}
+}
+
+func TestServerReusesBuffers(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations aren't representative with the race detector")
+	}
+	// Incompressible padding makes the upload buffer dominate what a scan
+	// allocates.
+	padding := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(padding)
+	data, err := (&testjar.Archive{Log4j: "2.14.1", Files: map[string][]byte{"padding.bin": padding}}).Bytes()
+	if err != nil {
+		t.Fatalf("generating upload: %v", err)
+	}
+	s := &Server{Warm: 1}
+	s.Start()
+	scan := func() {
+		req := httptest.NewRequest("POST", "/v1/scan", bytes.NewReader(data))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("scan returned %d, want %d", w.Code, http.StatusOK)
+		}
+	}
+	scan()
+
+	const n = 20
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < n; i++ {
+		scan()
+	}
+	runtime.ReadMemStats(&after)
+	// Allocating a buffer for each upload would cost at least its size.
+	if got := (after.TotalAlloc - before.TotalAlloc) / n; got > uint64(len(data))/2 {
+		t.Errorf("scans allocated %d bytes each for a %d byte upload, want buffers to be reused", got, len(data))
+	}
+}
+
+func BenchmarkServerScan(b *testing.B) {
+	data, err := os.ReadFile(filepath.Join("..", "jar", "testdata", "safe1.jar"))
+	if err != nil {
+		b.Fatalf("reading test data: %v", err)
+	}
+	s := &Server{}
+	s.Start()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("POST", "/v1/scan", bytes.NewReader(data))
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				b.Errorf("scan returned %d, want %d", w.Code, http.StatusOK)
+			}
+		}
+	})
+}
+
+func TestServerRules(t *testing.T) {
+	rules, err := jar.NewSharedConfig(&jar.Config{EnableRules: []string{jar.RuleLog4j44832JDBC}})
+	if err != nil {
+		t.Fatalf("NewSharedConfig() failed: %v", err)
+	}
+	s := &Server{Rules: rules}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := &client{t, srv.URL, ""}
+
+	vuln := readTestdata(t, "vuln-class.jar")
+	var res Result
+	if code := c.do("POST", "/v1/scan", vuln, &res); code != http.StatusOK {
+		t.Fatalf("scan returned %d, want %d", code, http.StatusOK)
+	}
+	if res.Vulnerable {
+		t.Errorf("scan with only the JDBC rule reported vulnerable")
+	}
+
+	if err := rules.Store(nil); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	if code := c.do("POST", "/v1/scan", vuln, &res); code != http.StatusOK {
+		t.Fatalf("scan returned %d, want %d", code, http.StatusOK)
+	}
+	if !res.Vulnerable {
+		t.Errorf("scan after replacing rules not reported vulnerable")
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	reg := &metrics.Registry{}
+	s := &Server{
+		Tenants: []*Tenant{{Name: "t", TokenSHA256: []string{HashToken("token")}}},
+		Metrics: reg,
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := &client{t, srv.URL, "token"}
+	anon := &client{t, srv.URL, ""}
+
+	for _, tc := range []struct {
+		name string
+		want int
+	}{
+		{"vuln-class.jar", http.StatusOK},
+		{"safe1.jar", http.StatusOK},
+		{"notarealjar.jar", http.StatusUnsupportedMediaType},
+	} {
+		if code := c.do("POST", "/v1/scan", readTestdata(t, tc.name), nil); code != tc.want {
+			t.Fatalf("scan of %s returned %d, want %d", tc.name, code, tc.want)
+		}
+	}
+
+	req, err := http.NewRequest("GET", srv.URL+"/metrics", nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unauthenticated /metrics returned %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	for _, want := range []string{
+		"log4jscanner_archives_scanned_total 3\n",
+		`log4jscanner_findings_total{severity="critical"} 1` + "\n",
+		"log4jscanner_scan_duration_seconds_count 3\n",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("/metrics doesn't contain %q:\n%s", want, b)
+		}
+	}
+	if code := anon.do("GET", "/v1/results", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated results returned %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestCheckDial(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{"127.0.0.1:80", false},
+		{"[2001:db8::1]:443", false},
+		{"169.254.169.254:80", true},
+		{"[fe80::1]:80", true},
+		{"[fd00:ec2::254]:80", true},
+		{"100.100.100.200:80", true},
+		{"0.0.0.0:80", true},
+	}
+	for _, tc := range tests {
+		err := checkDial("tcp", tc.address, nil)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("checkDial(%q) returned error %v, want error %t", tc.address, err, tc.wantErr)
+		}
+	}
+}
+
+func TestServerSources(t *testing.T) {
+	vuln := readTestdata(t, "vuln-class.jar")
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/vuln-class.jar" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(vuln)
+	}))
+	defer files.Close()
+	redirects := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	}))
+	defer redirects.Close()
+	redirect := func(to string) string {
+		return "url=" + url.QueryEscape(redirects.URL+"/?to="+url.QueryEscape(to))
+	}
+
+	dir, outside := t.TempDir(), t.TempDir()
+	for _, d := range []string{dir, outside} {
+		if err := os.WriteFile(filepath.Join(d, "vuln-class.jar"), vuln, 0644); err != nil {
+			t.Fatalf("writing test data: %v", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "vuln-class.jar"), filepath.Join(dir, "link.jar")); err != nil {
+		t.Fatalf("creating symlink: %v", err)
+	}
+
+	s := &Server{
+		Tenants: []*Tenant{
+			{Name: "repo", TokenSHA256: []string{HashToken("repo-token")}, FetchURLs: true, Paths: []string{dir}},
+			{Name: "ci", TokenSHA256: []string{HashToken("ci-token")}},
+		},
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	repo := &client{t, srv.URL, "repo-token"}
+	ci := &client{t, srv.URL, "ci-token"}
+
+	tests := []struct {
+		name     string
+		client   *client
+		query    string
+		wantCode int
+	}{
+		{"URL", repo, "url=" + files.URL + "/vuln-class.jar", http.StatusOK},
+		{"URLNotFound", repo, "url=" + files.URL + "/missing.jar", http.StatusBadGateway},
+		{"URLScheme", repo, "url=file:///etc/passwd", http.StatusBadRequest},
+		{"URLForbidden", ci, "url=" + files.URL + "/vuln-class.jar", http.StatusForbidden},
+		{"URLLinkLocal", repo, "url=http://169.254.169.254/latest/meta-data/", http.StatusBadRequest},
+		{"URLLinkLocalIPv6", repo, "url=" + url.QueryEscape("http://[fe80::1]/a.jar"), http.StatusBadRequest},
+		{"URLMetadataHost", repo, "url=http://metadata.google.internal/computeMetadata/v1/", http.StatusBadRequest},
+		{"URLRedirect", repo, redirect(files.URL + "/vuln-class.jar"), http.StatusOK},
+		{"URLRedirectLinkLocal", repo, redirect("http://169.254.169.254/latest/meta-data/"), http.StatusBadRequest},
+		{"URLRedirectMetadataHost", repo, redirect("http://metadata.google.internal/"), http.StatusBadRequest},
+		{"URLRedirectScheme", repo, redirect("file:///etc/passwd"), http.StatusBadRequest},
+		{"Path", repo, "path=" + filepath.Join(dir, "vuln-class.jar"), http.StatusOK},
+		{"PathOutside", repo, "path=" + filepath.Join(outside, "vuln-class.jar"), http.StatusNotFound},
+		{"PathTraversal", repo, "path=" + dir + "/../" + filepath.Base(outside) + "/vuln-class.jar", http.StatusNotFound},
+		{"PathSymlink", repo, "path=" + filepath.Join(dir, "link.jar"), http.StatusNotFound},
+		{"PathRelative", repo, "path=vuln-class.jar", http.StatusBadRequest},
+		{"PathForbidden", ci, "path=" + filepath.Join(dir, "vuln-class.jar"), http.StatusNotFound},
+		{"URLAndPath", repo, "url=" + files.URL + "/vuln-class.jar&path=" + dir, http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var res Result
+			if code := tc.client.do("POST", "/v1/scan?"+tc.query, nil, &res); code != tc.wantCode {
+				t.Fatalf("scan returned %d, want %d", code, tc.wantCode)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			if !res.Vulnerable || res.Report == nil || len(res.Report.CVEs) == 0 {
+				t.Errorf("unexpected scan result: %+v", res)
+			}
+			if res.Name == "" || res.Report.Path != res.Name {
+				t.Errorf("scan result named %q, report path %q, want the url or path", res.Name, res.Report.Path)
+			}
+		})
+	}
+}
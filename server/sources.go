@@ -0,0 +1,229 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fetchTimeout bounds downloading an archive for a tenant with FetchURLs,
+// including reading its body.
+const fetchTimeout = 10 * time.Minute
+
+// errForbiddenURL is returned for URLs tenants may not have the server fetch.
+var errForbiddenURL = errors.New("url must be an http or https URL of a host other than a link-local or metadata address")
+
+// metadataHosts are the names of cloud metadata services, which hand out
+// the credentials of the server's instance.
+var metadataHosts = map[string]bool{
+	"metadata":                 true,
+	"metadata.google.internal": true,
+	"metadata.goog":            true,
+	"instance-data":            true,
+}
+
+// metadataIPs are the addresses of cloud metadata services outside of the
+// link-local ranges.
+var metadataIPs = []net.IP{
+	net.ParseIP("fd00:ec2::254"),   // AWS over IPv6.
+	net.ParseIP("100.100.100.200"), // Alibaba Cloud.
+}
+
+// fetchClient is the default Server.Client. Besides checking URLs and
+// redirects, it refuses to connect to forbidden addresses once host names
+// are resolved.
+var fetchClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   checkDial,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+	CheckRedirect: checkRedirect,
+	Timeout:       fetchTimeout,
+}
+
+// checkURL returns errForbiddenURL if tenants may not have the server fetch
+// u.
+func checkURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errForbiddenURL
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if metadataHosts[host] {
+		return errForbiddenURL
+	}
+	if ip := net.ParseIP(host); ip != nil && forbiddenIP(ip) {
+		return errForbiddenURL
+	}
+	return nil
+}
+
+// forbiddenIP reports if ip is a link-local or metadata address.
+func forbiddenIP(ip net.IP) bool {
+	if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, m := range metadataIPs {
+		if ip.Equal(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect applies checkURL to each redirect, and otherwise follows
+// http.Client's default of at most 10 redirects.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if err := checkURL(req.URL); err != nil {
+		return err
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// checkDial refuses connections to forbidden addresses, which host names
+// may resolve to.
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+		return errForbiddenURL
+	}
+	return nil
+}
+
+// statusError is an error of a scan request to reply with, and its HTTP
+// status code.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// scanURL downloads an archive for a tenant with FetchURLs and scans it,
+// like an upload of at most limit bytes.
+func (s *Server) scanURL(w http.ResponseWriter, r *http.Request, t *Tenant, rawURL string, limit int64, res *Result) error {
+	if !t.FetchURLs {
+		return &statusError{http.StatusForbidden, "tenant may not scan URLs"}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || checkURL(u) != nil {
+		return &statusError{http.StatusBadRequest, errForbiddenURL.Error()}
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return &statusError{http.StatusBadRequest, fmt.Sprintf("invalid url: %v", err)}
+	}
+	client := fetchClient
+	if s.Client != nil {
+		// Copy the client to check its redirects too.
+		c := *s.Client
+		next := c.CheckRedirect
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if next == nil {
+				return checkRedirect(req, via)
+			}
+			if err := checkURL(req.URL); err != nil {
+				return err
+			}
+			return next(req, via)
+		}
+		client = &c
+	}
+	resp, err := client.Do(req)
+	if errors.Is(err, errForbiddenURL) {
+		return &statusError{http.StatusBadRequest, fmt.Sprintf("fetching url: %v", errForbiddenURL)}
+	}
+	if err != nil {
+		return &statusError{http.StatusBadGateway, fmt.Sprintf("fetching url: %v", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{http.StatusBadGateway, fmt.Sprintf("fetching url: %s", resp.Status)}
+	}
+	if resp.ContentLength > limit {
+		return &statusError{http.StatusRequestEntityTooLarge, fmt.Sprintf("archive exceeds %d bytes", limit)}
+	}
+	return s.scanBody(r.Context(), http.MaxBytesReader(w, resp.Body, limit), res)
+}
+
+// scanPath scans an archive on the server's filesystem within one of the
+// tenant's Paths. Symbolic links are resolved first, so they can't lead out
+// of those directories.
+func (s *Server) scanPath(ctx context.Context, t *Tenant, path string, res *Result) error {
+	if !filepath.IsAbs(path) {
+		return &statusError{http.StatusBadRequest, "path must be absolute"}
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil || !t.allowsPath(resolved) {
+		// Paths outside of the tenant's directories are indistinguishable
+		// from missing paths.
+		return &statusError{http.StatusNotFound, "path not found"}
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return &statusError{http.StatusNotFound, "path not found"}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return &statusError{http.StatusBadRequest, "path isn't a file"}
+	}
+	return s.scanReaderAt(ctx, f, info.Size(), res)
+}
+
+// allowsPath reports if the tenant may scan path, which is within one of its
+// Paths.
+func (t *Tenant) allowsPath(path string) bool {
+	for _, dir := range t.Paths {
+		dir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AWS restores EBS snapshots.
+type AWS struct {
+	// Run executes the aws command. Defaults to Exec.
+	Run Runner
+	// InstanceID and Zone identify the current instance. They default to
+	// the values of the instance metadata service.
+	InstanceID string
+	Zone       string
+	// DeviceName is the name the volume is attached as. Defaults to
+	// /dev/sdf.
+	DeviceName string
+	// DeviceDir is where the kernel exposes block devices by ID. Defaults to
+	// /dev/disk/by-id.
+	DeviceDir string
+	// Timeout bounds how long to wait for the volume to become available.
+	// Defaults to 10 minutes.
+	Timeout time.Duration
+}
+
+// Attach implements Provider.
+func (a *AWS) Attach(ctx context.Context, snapshot string) (*Volume, error) {
+	run := a.Run
+	if run == nil {
+		run = Exec
+	}
+	if a.InstanceID == "" || a.Zone == "" {
+		id, zone, err := awsInstance(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("looking up instance: %v", err)
+		}
+		if a.InstanceID == "" {
+			a.InstanceID = id
+		}
+		if a.Zone == "" {
+			a.Zone = zone
+		}
+	}
+	deviceName := a.DeviceName
+	if deviceName == "" {
+		deviceName = "/dev/sdf"
+	}
+	deviceDir := a.DeviceDir
+	if deviceDir == "" {
+		deviceDir = "/dev/disk/by-id"
+	}
+	timeout := a.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Minute
+	}
+
+	out, err := run(ctx, "aws", "ec2", "create-volume",
+		"--snapshot-id", snapshot,
+		"--availability-zone", a.Zone,
+		"--volume-type", "gp3",
+		"--tag-specifications", "ResourceType=volume,Tags=[{Key=log4jscanner-snapshot,Value="+snapshot+"}]",
+		"--query", "VolumeId", "--output", "text")
+	if err != nil {
+		return nil, fmt.Errorf("creating volume from %s: %v", snapshot, err)
+	}
+	id := strings.TrimSpace(string(out))
+	v := &Volume{ID: id}
+	deleteVolume := func(ctx context.Context) error {
+		if _, err := run(ctx, "aws", "ec2", "delete-volume", "--volume-id", id); err != nil {
+			return fmt.Errorf("deleting volume %s: %v", id, err)
+		}
+		return nil
+	}
+	v.release = deleteVolume
+	fail := func(err error) (*Volume, error) {
+		if rerr := v.release(ctx); rerr != nil {
+			err = fmt.Errorf("%v (cleanup failed: %v)", err, rerr)
+		}
+		return nil, err
+	}
+
+	if _, err := run(ctx, "aws", "ec2", "wait", "volume-available", "--volume-ids", id); err != nil {
+		return fail(fmt.Errorf("waiting for volume %s: %v", id, err))
+	}
+	if _, err := run(ctx, "aws", "ec2", "attach-volume",
+		"--volume-id", id, "--instance-id", a.InstanceID, "--device", deviceName); err != nil {
+		return fail(fmt.Errorf("attaching volume %s: %v", id, err))
+	}
+	v.release = func(ctx context.Context) error {
+		if _, err := run(ctx, "aws", "ec2", "detach-volume", "--volume-id", id); err != nil {
+			return fmt.Errorf("detaching volume %s: %v", id, err)
+		}
+		if _, err := run(ctx, "aws", "ec2", "wait", "volume-available", "--volume-ids", id); err != nil {
+			return fmt.Errorf("waiting for volume %s to detach: %v", id, err)
+		}
+		return deleteVolume(ctx)
+	}
+
+	// Nitro instances expose EBS volumes as NVMe devices named by volume ID,
+	// Xen instances use the requested name with an "xvd" prefix.
+	wctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dev, err := waitForDevice(wctx, []string{
+		filepath.Join(deviceDir, "nvme-Amazon_Elastic_Block_Store_"+strings.ReplaceAll(id, "-", "")),
+		strings.Replace(deviceName, "/dev/sd", "/dev/xvd", 1),
+	})
+	if err != nil {
+		return fail(err)
+	}
+	v.Device = dev
+	return v, nil
+}
+
+// awsInstance returns the ID and availability zone of the current instance
+// from the instance metadata service, using IMDSv2.
+func awsInstance(ctx context.Context) (id, zone string, err error) {
+	const base = "http://169.254.169.254/latest/"
+	client := &http.Client{Timeout: 5 * time.Second}
+	do := func(method, path string, header http.Header) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, method, base+path, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header = header
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%s: unexpected status %s", path, resp.Status)
+		}
+		b, err := io.ReadAll(resp.Body)
+		return strings.TrimSpace(string(b)), err
+	}
+	token, err := do(http.MethodPut, "api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"}})
+	if err != nil {
+		return "", "", err
+	}
+	h := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+	if id, err = do(http.MethodGet, "meta-data/instance-id", h); err != nil {
+		return "", "", err
+	}
+	if zone, err = do(http.MethodGet, "meta-data/placement/availability-zone", h); err != nil {
+		return "", "", err
+	}
+	return id, zone, nil
+}
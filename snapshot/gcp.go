@@ -0,0 +1,160 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// GCP restores Persistent Disk snapshots.
+type GCP struct {
+	// Run executes the gcloud command. Defaults to Exec.
+	Run Runner
+	// Project, Instance, and Zone identify the current instance. They
+	// default to the values of the metadata server.
+	Project  string
+	Instance string
+	Zone     string
+	// DeviceDir is where the kernel exposes block devices by ID. Defaults to
+	// /dev/disk/by-id.
+	DeviceDir string
+	// Timeout bounds how long to wait for the attached disk to appear.
+	// Defaults to 10 minutes.
+	Timeout time.Duration
+}
+
+// Attach implements Provider. Disks are attached read-only.
+func (g *GCP) Attach(ctx context.Context, snapshot string) (*Volume, error) {
+	run := g.Run
+	if run == nil {
+		run = Exec
+	}
+	if g.Project == "" || g.Instance == "" || g.Zone == "" {
+		project, instance, zone, err := gcpInstance(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("looking up instance: %v", err)
+		}
+		if g.Project == "" {
+			g.Project = project
+		}
+		if g.Instance == "" {
+			g.Instance = instance
+		}
+		if g.Zone == "" {
+			g.Zone = zone
+		}
+	}
+	deviceDir := g.DeviceDir
+	if deviceDir == "" {
+		deviceDir = "/dev/disk/by-id"
+	}
+	timeout := g.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Minute
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	name := "log4jscanner-" + hex.EncodeToString(suffix)
+	common := []string{"--project", g.Project, "--zone", g.Zone, "--quiet"}
+	gcloud := func(ctx context.Context, args ...string) error {
+		_, err := run(ctx, "gcloud", append(args, common...)...)
+		return err
+	}
+
+	if err := gcloud(ctx, "compute", "disks", "create", name,
+		"--source-snapshot", snapshot, "--labels", "log4jscanner-snapshot=true"); err != nil {
+		return nil, fmt.Errorf("creating disk from %s: %v", snapshot, err)
+	}
+	deleteDisk := func(ctx context.Context) error {
+		if err := gcloud(ctx, "compute", "disks", "delete", name); err != nil {
+			return fmt.Errorf("deleting disk %s: %v", name, err)
+		}
+		return nil
+	}
+	v := &Volume{ID: name, release: deleteDisk}
+	fail := func(err error) (*Volume, error) {
+		if rerr := v.release(ctx); rerr != nil {
+			err = fmt.Errorf("%v (cleanup failed: %v)", err, rerr)
+		}
+		return nil, err
+	}
+
+	if err := gcloud(ctx, "compute", "instances", "attach-disk", g.Instance,
+		"--disk", name, "--device-name", name, "--mode", "ro"); err != nil {
+		return fail(fmt.Errorf("attaching disk %s: %v", name, err))
+	}
+	v.release = func(ctx context.Context) error {
+		if err := gcloud(ctx, "compute", "instances", "detach-disk", g.Instance, "--disk", name); err != nil {
+			return fmt.Errorf("detaching disk %s: %v", name, err)
+		}
+		return deleteDisk(ctx)
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dev, err := waitForDevice(wctx, []string{filepath.Join(deviceDir, "google-"+name)})
+	if err != nil {
+		return fail(err)
+	}
+	v.Device = dev
+	return v, nil
+}
+
+// gcpInstance returns the project, name, and zone of the current instance
+// from the metadata server.
+func gcpInstance(ctx context.Context) (project, instance, zone string, err error) {
+	const base = "http://metadata.google.internal/computeMetadata/v1/"
+	client := &http.Client{Timeout: 5 * time.Second}
+	get := func(p string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+p, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%s: unexpected status %s", p, resp.Status)
+		}
+		b, err := io.ReadAll(resp.Body)
+		return strings.TrimSpace(string(b)), err
+	}
+	if project, err = get("project/project-id"); err != nil {
+		return "", "", "", err
+	}
+	if instance, err = get("instance/name"); err != nil {
+		return "", "", "", err
+	}
+	// The zone is returned as "projects/<number>/zones/<zone>".
+	if zone, err = get("instance/zone"); err != nil {
+		return "", "", "", err
+	}
+	return project, instance, path.Base(zone), nil
+}
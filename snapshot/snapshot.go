@@ -0,0 +1,216 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshot exposes the filesystems of cloud disk snapshots for
+// scanning, without booting the instance they were taken from.
+//
+// A snapshot is restored to a new volume, attached to the instance running the
+// scanner, and its filesystems are mounted read-only. Releasing the snapshot
+// unmounts, detaches, and deletes the volume. The snapshot itself is never
+// modified.
+//
+// Cloud APIs are driven through the aws and gcloud command line tools, which
+// must be installed and authorized to manage volumes. Mounting requires Linux
+// and root privileges.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Runner runs a command, returning its stdout.
+type Runner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// Exec is a Runner executing commands on the host.
+func Exec(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Provider restores snapshots of a cloud.
+type Provider interface {
+	// Attach restores a snapshot to a new volume attached to the current
+	// instance. The volume must be detached and deleted by calling Release.
+	Attach(ctx context.Context, snapshot string) (*Volume, error)
+}
+
+// Volume is a restored snapshot attached to the current instance.
+type Volume struct {
+	// ID is the cloud's identifier of the volume.
+	ID string
+	// Device is the block device of the volume, such as /dev/nvme1n1.
+	Device string
+
+	release func(ctx context.Context) error
+}
+
+// Release detaches and deletes the volume.
+func (v *Volume) Release(ctx context.Context) error {
+	return v.release(ctx)
+}
+
+// waitForDevice polls for one of the device paths to exist, returning the
+// block device it resolves to.
+func waitForDevice(ctx context.Context, paths []string) (string, error) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		for _, p := range paths {
+			if dev, err := filepath.EvalSymlinks(p); err == nil {
+				return dev, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("waiting for device %s: %v", strings.Join(paths, " or "), ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// Mounter mounts the filesystems of a volume read-only.
+type Mounter struct {
+	// Run executes mount and umount. Defaults to Exec.
+	Run Runner
+	// Dir is where filesystems are mounted. Defaults to a directory in
+	// os.TempDir.
+	Dir string
+	// SysBlock is the sysfs directory describing block devices. Defaults to
+	// /sys/class/block.
+	SysBlock string
+}
+
+// Mount is a set of mounted filesystems of a volume.
+type Mount struct {
+	// Paths holds the mount point of every filesystem that could be mounted.
+	Paths []string
+	// Errors holds the partitions that couldn't be mounted, such as swap.
+	Errors []error
+
+	m *Mounter
+}
+
+// Mount mounts every partition of a block device read-only, or the device
+// itself if it isn't partitioned.
+func (m *Mounter) Mount(ctx context.Context, device string) (*Mount, error) {
+	run := m.Run
+	if run == nil {
+		run = Exec
+	}
+	sys := m.SysBlock
+	if sys == "" {
+		sys = "/sys/class/block"
+	}
+	dir := m.Dir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "log4jscanner-snapshots")
+	}
+
+	parts, err := partitions(sys, device)
+	if err != nil {
+		return nil, err
+	}
+	mnt := &Mount{m: &Mounter{Run: run, Dir: dir, SysBlock: sys}}
+	for _, part := range parts {
+		target := filepath.Join(dir, filepath.Base(part))
+		if err := os.MkdirAll(target, 0700); err != nil {
+			mnt.Unmount(ctx)
+			return nil, fmt.Errorf("creating mount point: %v", err)
+		}
+		if err := mountReadOnly(ctx, run, part, target); err != nil {
+			os.Remove(target)
+			mnt.Errors = append(mnt.Errors, err)
+			continue
+		}
+		mnt.Paths = append(mnt.Paths, target)
+	}
+	if len(mnt.Paths) == 0 {
+		return nil, fmt.Errorf("no filesystems of %s could be mounted: %v", device, mnt.Errors)
+	}
+	return mnt, nil
+}
+
+// mountOptions are tried in order. Journaled filesystems of a crashed or
+// running instance can't be replayed without writing, which "noload" and
+// "norecovery" skip.
+var mountOptions = []string{
+	"ro,noexec,nosuid,nodev",
+	"ro,noexec,nosuid,nodev,noload",
+	"ro,noexec,nosuid,nodev,norecovery,nouuid",
+}
+
+func mountReadOnly(ctx context.Context, run Runner, device, target string) error {
+	var errs []string
+	for _, opts := range mountOptions {
+		_, err := run(ctx, "mount", "-o", opts, device, target)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return fmt.Errorf("mounting %s: %s", device, strings.Join(errs, "; "))
+}
+
+// partitions returns the partitions of a block device according to sysfs, or
+// the device itself if it has none.
+func partitions(sys, device string) ([]string, error) {
+	name := filepath.Base(device)
+	if _, err := os.Stat(filepath.Join(sys, name)); err != nil {
+		return nil, fmt.Errorf("looking up block device %s: %v", device, err)
+	}
+	matches, err := filepath.Glob(filepath.Join(sys, name, name+"*", "partition"))
+	if err != nil {
+		return nil, err
+	}
+	var parts []string
+	for _, m := range matches {
+		parts = append(parts, filepath.Join(filepath.Dir(device), filepath.Base(filepath.Dir(m))))
+	}
+	if len(parts) == 0 {
+		return []string{device}, nil
+	}
+	sort.Strings(parts)
+	return parts, nil
+}
+
+// Unmount unmounts the filesystems and removes their mount points.
+func (mnt *Mount) Unmount(ctx context.Context) error {
+	var errs []string
+	for _, p := range mnt.Paths {
+		if _, err := mnt.m.Run(ctx, "umount", p); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		os.Remove(p)
+	}
+	mnt.Paths = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("unmounting: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
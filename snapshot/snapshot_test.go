@@ -0,0 +1,202 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeRunner records commands, returning canned output for commands with a
+// matching prefix.
+type fakeRunner struct {
+	cmds    []string
+	outputs map[string]string
+	fail    func(cmd string) bool
+}
+
+func (f *fakeRunner) run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	f.cmds = append(f.cmds, cmd)
+	if f.fail != nil && f.fail(cmd) {
+		return nil, fmt.Errorf("%s failed", cmd)
+	}
+	for prefix, out := range f.outputs {
+		if strings.HasPrefix(cmd, prefix) {
+			return []byte(out), nil
+		}
+	}
+	return nil, nil
+}
+
+// fakeDevice creates a block device and a by-id symlink to it.
+func fakeDevice(t *testing.T, dir, link string) string {
+	t.Helper()
+	dev := filepath.Join(t.TempDir(), "nvme1n1")
+	if err := os.WriteFile(dev, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dev, filepath.Join(dir, link)); err != nil {
+		t.Fatal(err)
+	}
+	return dev
+}
+
+func TestAWS(t *testing.T) {
+	dir := t.TempDir()
+	dev := fakeDevice(t, dir, "nvme-Amazon_Elastic_Block_Store_vol0abc")
+	r := &fakeRunner{outputs: map[string]string{"aws ec2 create-volume": "vol-0abc\n"}}
+	a := &AWS{Run: r.run, InstanceID: "i-123", Zone: "us-east-1a", DeviceDir: dir}
+
+	ctx := context.Background()
+	v, err := a.Attach(ctx, "snap-1")
+	if err != nil {
+		t.Fatalf("Attach() failed: %v", err)
+	}
+	if v.ID != "vol-0abc" || v.Device != dev {
+		t.Errorf("Attach() returned volume %s at %s, want vol-0abc at %s", v.ID, v.Device, dev)
+	}
+	if err := v.Release(ctx); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+	want := []string{
+		"aws ec2 create-volume --snapshot-id snap-1 --availability-zone us-east-1a --volume-type gp3 " +
+			"--tag-specifications ResourceType=volume,Tags=[{Key=log4jscanner-snapshot,Value=snap-1}] --query VolumeId --output text",
+		"aws ec2 wait volume-available --volume-ids vol-0abc",
+		"aws ec2 attach-volume --volume-id vol-0abc --instance-id i-123 --device /dev/sdf",
+		"aws ec2 detach-volume --volume-id vol-0abc",
+		"aws ec2 wait volume-available --volume-ids vol-0abc",
+		"aws ec2 delete-volume --volume-id vol-0abc",
+	}
+	if diff := cmp.Diff(want, r.cmds); diff != "" {
+		t.Errorf("Attach() and Release() ran unexpected commands (-want, +got): %s", diff)
+	}
+}
+
+func TestAWSAttachFailure(t *testing.T) {
+	r := &fakeRunner{
+		outputs: map[string]string{"aws ec2 create-volume": "vol-0abc\n"},
+		fail:    func(cmd string) bool { return strings.HasPrefix(cmd, "aws ec2 attach-volume") },
+	}
+	a := &AWS{Run: r.run, InstanceID: "i-123", Zone: "us-east-1a", DeviceDir: t.TempDir()}
+	if _, err := a.Attach(context.Background(), "snap-1"); err == nil {
+		t.Fatalf("Attach() succeeded, expected error")
+	}
+	// The volume must not be leaked.
+	if last := r.cmds[len(r.cmds)-1]; last != "aws ec2 delete-volume --volume-id vol-0abc" {
+		t.Errorf("Attach() failure ran %q last, want volume deleted", last)
+	}
+}
+
+func TestGCP(t *testing.T) {
+	dir := t.TempDir()
+	r := &fakeRunner{}
+	g := &GCP{Project: "p", Instance: "scanner", Zone: "us-central1-a", DeviceDir: dir}
+	// The disk name is random, so create its device once it's known.
+	var dev string
+	g.Run = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if len(args) > 3 && args[2] == "create" {
+			dev = fakeDevice(t, dir, "google-"+args[3])
+		}
+		return r.run(ctx, name, args...)
+	}
+
+	ctx := context.Background()
+	v, err := g.Attach(ctx, "snap-1")
+	if err != nil {
+		t.Fatalf("Attach() failed: %v", err)
+	}
+	if !strings.HasPrefix(v.ID, "log4jscanner-") || v.Device != dev {
+		t.Errorf("Attach() returned disk %s at %s, want log4jscanner-* at %s", v.ID, v.Device, dev)
+	}
+	if err := v.Release(ctx); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+	common := " --project p --zone us-central1-a --quiet"
+	want := []string{
+		"gcloud compute disks create " + v.ID + " --source-snapshot snap-1 --labels log4jscanner-snapshot=true" + common,
+		"gcloud compute instances attach-disk scanner --disk " + v.ID + " --device-name " + v.ID + " --mode ro" + common,
+		"gcloud compute instances detach-disk scanner --disk " + v.ID + common,
+		"gcloud compute disks delete " + v.ID + common,
+	}
+	if diff := cmp.Diff(want, r.cmds); diff != "" {
+		t.Errorf("Attach() and Release() ran unexpected commands (-want, +got): %s", diff)
+	}
+}
+
+func TestMount(t *testing.T) {
+	sys := t.TempDir()
+	for _, p := range []string{"nvme1n1p1", "nvme1n1p2"} {
+		d := filepath.Join(sys, "nvme1n1", p)
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "partition"), []byte("1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	r := &fakeRunner{fail: func(cmd string) bool {
+		// The first partition needs its journal skipped, the second isn't
+		// a filesystem.
+		if !strings.HasPrefix(cmd, "mount ") {
+			return false
+		}
+		return (strings.Contains(cmd, "/dev/nvme1n1p1") && !strings.Contains(cmd, "noload")) ||
+			strings.Contains(cmd, "/dev/nvme1n1p2")
+	}}
+	m := &Mounter{Run: r.run, Dir: dir, SysBlock: sys}
+
+	ctx := context.Background()
+	mnt, err := m.Mount(ctx, "/dev/nvme1n1")
+	if err != nil {
+		t.Fatalf("Mount() failed: %v", err)
+	}
+	target := filepath.Join(dir, "nvme1n1p1")
+	if diff := cmp.Diff([]string{target}, mnt.Paths); diff != "" {
+		t.Errorf("Mount() returned unexpected paths (-want, +got): %s", diff)
+	}
+	if len(mnt.Errors) != 1 {
+		t.Errorf("Mount() returned errors %v, want one for nvme1n1p2", mnt.Errors)
+	}
+	if err := mnt.Unmount(ctx); err != nil {
+		t.Fatalf("Unmount() failed: %v", err)
+	}
+	if last := r.cmds[len(r.cmds)-1]; last != "umount "+target {
+		t.Errorf("Unmount() ran %q, want umount %s", last, target)
+	}
+}
+
+func TestMountUnpartitioned(t *testing.T) {
+	sys := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(sys, "xvdf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRunner{}
+	m := &Mounter{Run: r.run, Dir: t.TempDir(), SysBlock: sys}
+	mnt, err := m.Mount(context.Background(), "/dev/xvdf")
+	if err != nil {
+		t.Fatalf("Mount() failed: %v", err)
+	}
+	if len(mnt.Paths) != 1 || !strings.Contains(r.cmds[0], " /dev/xvdf ") {
+		t.Errorf("Mount() of an unpartitioned device ran %v, want the device mounted", r.cmds)
+	}
+}
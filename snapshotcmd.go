@@ -0,0 +1,184 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"log4jscanner/jar"
+	"log4jscanner/snapshot"
+)
+
+func snapshotUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner snapshot [flag] [snapshots]
+
+Scans cloud disk snapshots without booting the instances they were taken
+from. Each snapshot is restored to a temporary volume, attached to this
+instance, and its filesystems are mounted read-only and scanned. The volume is
+deleted afterwards. Vulnerable JARs are printed as "<snapshot>:<path>".
+
+Requires Linux, root, and the aws or gcloud command authorized to create,
+attach, and delete volumes. This instance must be in the snapshot's cloud,
+and for AWS, its region.
+
+Flags:
+
+    --provider     Cloud holding the snapshots: aws (EBS snapshot IDs) or
+                   gcp (Persistent Disk snapshot names).
+    --zone         Zone of this instance. Defaults to the metadata server.
+    --instance     ID (aws) or name (gcp) of this instance. Defaults to the
+                   metadata server.
+    --project      Project of this instance (gcp). Defaults to the metadata
+                   server.
+    --mount-dir    Where filesystems are mounted (default a temporary
+                   directory).
+    -s, --skip     Glob pattern to skip, relative to the snapshot's root
+                   (e.g. '/var/cache/*'). May be provided multiple times.
+    -v, --verbose  Print verbose logs to stderr.
+
+`)
+}
+
+func snapshotCmd(args []string) {
+	var (
+		provider string
+		zone     string
+		instance string
+		project  string
+		mountDir string
+		verbose  bool
+		toSkip   []string
+	)
+	appendSkip := func(dir string) error {
+		toSkip = append(toSkip, dir)
+		return nil
+	}
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	flags.StringVar(&provider, "provider", "", "")
+	flags.StringVar(&zone, "zone", "", "")
+	flags.StringVar(&instance, "instance", "", "")
+	flags.StringVar(&project, "project", "", "")
+	flags.StringVar(&mountDir, "mount-dir", "", "")
+	flags.BoolVar(&verbose, "verbose", false, "")
+	flags.BoolVar(&verbose, "v", false, "")
+	flags.Func("s", "", appendSkip)
+	flags.Func("skip", "", appendSkip)
+	flags.Usage = snapshotUsage
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		snapshotUsage()
+		os.Exit(1)
+	}
+
+	var p snapshot.Provider
+	switch provider {
+	case "aws":
+		p = &snapshot.AWS{InstanceID: instance, Zone: zone}
+	case "gcp":
+		p = &snapshot.GCP{Project: project, Instance: instance, Zone: zone}
+	default:
+		log.Fatalf("Error: --provider must be aws or gcp")
+	}
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	logf := func(format string, v ...interface{}) {
+		if verbose {
+			log.Printf(format, v...)
+		}
+	}
+	// Interrupting stops the current scan, but volumes are still released.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	failed := false
+	for _, snap := range flags.Args() {
+		if err := scanSnapshot(ctx, p, &snapshot.Mounter{Dir: mountDir}, snap, toSkip, logf); err != nil {
+			log.Printf("Error: scanning snapshot %s: %v", snap, err)
+			failed = true
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func scanSnapshot(ctx context.Context, p snapshot.Provider, m *snapshot.Mounter, snap string, toSkip []string, logf func(format string, v ...interface{})) error {
+	logf("Restoring snapshot %s", snap)
+	v, err := p.Attach(ctx, snap)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		logf("Releasing volume %s", v.ID)
+		if err := v.Release(context.Background()); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}()
+
+	logf("Mounting %s", v.Device)
+	mnt, err := m.Mount(ctx, v.Device)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := mnt.Unmount(context.Background()); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}()
+	for _, err := range mnt.Errors {
+		logf("Skipping partition: %v", err)
+	}
+
+	for _, root := range mnt.Paths {
+		// Patterns and output refer to paths within the snapshot.
+		var skip []string
+		for _, pattern := range toSkip {
+			skip = append(skip, filepath.Join(root, pattern))
+		}
+		rel := func(path string) string {
+			r, err := filepath.Rel(root, path)
+			if err != nil {
+				return path
+			}
+			return snap + ":/" + filepath.ToSlash(r)
+		}
+		walker := jar.Walker{
+			SkipDir: newSkipDir(skip, nil, nil, nil, logf, nil),
+			HandleError: func(path string, err error) {
+				log.Printf("Error: scanning %s: %v", rel(path), err)
+			},
+			HandleReport: func(path string, r *jar.Report) {
+				fmt.Println(rel(path))
+			},
+		}
+		logf("Scanning %s", root)
+		if err := walker.Walk(root); err != nil {
+			log.Printf("Error: walking %s: %v", rel(root), err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Statuses of the remediation of a vulnerable path. Paths without an
+// annotation, or without a status, are open.
+const (
+	StatusOpen       = "open"
+	StatusInProgress = "in-progress"
+	StatusResolved   = "resolved"
+	// StatusAccepted marks a risk that was accepted, such as a JAR that
+	// can't be exploited in its deployment.
+	StatusAccepted = "accepted"
+)
+
+// Statuses lists the valid statuses of an annotation.
+var Statuses = []string{StatusOpen, StatusInProgress, StatusResolved, StatusAccepted}
+
+// Annotation tracks the remediation of a vulnerable path on a host. Unlike
+// findings, annotations aren't tied to a run, so they apply to the path
+// across every run that reports it.
+type Annotation struct {
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	Owner  string `json:"owner,omitempty"`
+	Ticket string `json:"ticket,omitempty"`
+	Status string `json:"status,omitempty"`
+	Note   string `json:"note,omitempty"`
+	// UpdatedBy is the user or tenant that last changed the annotation.
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+	Updated   time.Time `json:"updated"`
+}
+
+// CheckStatus returns an error if s isn't one of Statuses or empty.
+func CheckStatus(s string) error {
+	if s == "" {
+		return nil
+	}
+	for _, status := range Statuses {
+		if s == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid status %q, expected one of %s", s, strings.Join(Statuses, ", "))
+}
+
+// SetAnnotation creates or replaces the annotation of a path. If Updated is
+// unset, the current time is used.
+func (s *Store) SetAnnotation(a *Annotation) error {
+	if a.Host == "" || a.Path == "" {
+		return fmt.Errorf("annotation requires a host and path")
+	}
+	if err := CheckStatus(a.Status); err != nil {
+		return err
+	}
+	if a.Updated.IsZero() {
+		a.Updated = time.Now().UTC()
+	}
+	_, err := s.db.Exec(`INSERT INTO annotations (host, path, owner, ticket, status, note, updated_by, updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (host, path) DO UPDATE SET owner = excluded.owner, ticket = excluded.ticket,
+			status = excluded.status, note = excluded.note, updated_by = excluded.updated_by, updated = excluded.updated`,
+		a.Host, a.Path, a.Owner, a.Ticket, a.Status, a.Note, a.UpdatedBy, a.Updated)
+	if err != nil {
+		return fmt.Errorf("annotating %s on %s: %v", a.Path, a.Host, err)
+	}
+	return nil
+}
+
+// Annotation returns the annotation of a path, or nil if it has none.
+func (s *Store) Annotation(host, path string) (*Annotation, error) {
+	as, err := s.annotations("WHERE host = ? AND path = ?", host, path)
+	if err != nil || len(as) == 0 {
+		return nil, err
+	}
+	return &as[0], nil
+}
+
+// DeleteAnnotation removes the annotation of a path, reporting whether it
+// had one.
+func (s *Store) DeleteAnnotation(host, path string) (bool, error) {
+	res, err := s.db.Exec("DELETE FROM annotations WHERE host = ? AND path = ?", host, path)
+	if err != nil {
+		return false, fmt.Errorf("deleting annotation of %s on %s: %v", path, host, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("deleting annotation of %s on %s: %v", path, host, err)
+	}
+	return n > 0, nil
+}
+
+// Annotations returns every annotation, ordered by host and path.
+func (s *Store) Annotations() ([]Annotation, error) {
+	return s.annotations("")
+}
+
+func (s *Store) annotations(where string, args ...interface{}) ([]Annotation, error) {
+	rows, err := s.db.Query(`SELECT host, path, owner, ticket, status, note, updated_by, updated
+		FROM annotations `+where+` ORDER BY host, path`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying annotations: %v", err)
+	}
+	defer rows.Close()
+	var as []Annotation
+	for rows.Next() {
+		var a Annotation
+		if err := rows.Scan(&a.Host, &a.Path, &a.Owner, &a.Ticket, &a.Status, &a.Note, &a.UpdatedBy, &a.Updated); err != nil {
+			return nil, fmt.Errorf("scanning annotation: %v", err)
+		}
+		as = append(as, a)
+	}
+	return as, rows.Err()
+}
+
+// annotationKey identifies the annotation of an Entry.
+type annotationKey struct{ host, path string }
+
+// annotate sets the annotations of entries.
+func (s *Store) annotate(entries []Entry) error {
+	as, err := s.Annotations()
+	if err != nil {
+		return err
+	}
+	byKey := make(map[annotationKey]*Annotation, len(as))
+	for i := range as {
+		byKey[annotationKey{as[i].Host, as[i].Path}] = &as[i]
+	}
+	for i := range entries {
+		entries[i].Annotation = byKey[annotationKey{entries[i].Host, entries[i].Path}]
+	}
+	return nil
+}
+
+// Status returns the status of an entry, StatusOpen if it isn't annotated
+// with one.
+func (e Entry) Status() string {
+	if e.Annotation == nil || e.Annotation.Status == "" {
+		return StatusOpen
+	}
+	return e.Annotation.Status
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func TestAnnotations(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer s.Close()
+	run, err := s.StartRun("host1", []string{"/"})
+	if err != nil {
+		t.Fatalf("StartRun() failed: %v", err)
+	}
+	for _, p := range []string{"/opt/a.jar", "/opt/b.jar", "/opt/c.jar"} {
+		f := Finding{RunID: run.ID, Path: p, CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical}
+		if err := s.AddFinding(f); err != nil {
+			t.Fatalf("AddFinding() failed: %v", err)
+		}
+	}
+
+	ts := time.Date(2021, 12, 20, 10, 0, 0, 0, time.UTC)
+	a := &Annotation{Host: "host1", Path: "/opt/a.jar", Owner: "alice", Ticket: "SEC-1",
+		Status: StatusInProgress, UpdatedBy: "bob", Updated: ts}
+	b := &Annotation{Host: "host1", Path: "/opt/b.jar", Owner: "carol", Status: StatusOpen}
+	for _, an := range []*Annotation{a, b} {
+		if err := s.SetAnnotation(an); err != nil {
+			t.Fatalf("SetAnnotation() failed: %v", err)
+		}
+	}
+	if b.Updated.IsZero() {
+		t.Errorf("SetAnnotation() didn't set the update time")
+	}
+	// Replacing an annotation replaces every field.
+	a.Status, a.Note = StatusAccepted, "not reachable"
+	if err := s.SetAnnotation(a); err != nil {
+		t.Fatalf("SetAnnotation() failed: %v", err)
+	}
+	if err := s.SetAnnotation(&Annotation{Host: "host1", Path: "/opt/c.jar", Status: "done"}); err == nil {
+		t.Errorf("SetAnnotation() with an invalid status succeeded, want error")
+	}
+
+	got, err := s.Annotation("host1", "/opt/a.jar")
+	if err != nil {
+		t.Fatalf("Annotation() failed: %v", err)
+	}
+	if diff := cmp.Diff(a, got); diff != "" {
+		t.Errorf("Annotation() returned diff (-want, +got): %s", diff)
+	}
+	if got, err := s.Annotation("host2", "/opt/a.jar"); err != nil || got != nil {
+		t.Errorf("Annotation() of an unannotated path returned %v, %v, want nil", got, err)
+	}
+
+	paths := func(f Filter) []string {
+		entries, err := s.Inventory(f)
+		if err != nil {
+			t.Fatalf("Inventory() failed: %v", err)
+		}
+		var ps []string
+		for _, e := range entries {
+			ps = append(ps, e.Path)
+		}
+		return ps
+	}
+	if diff := cmp.Diff([]string{"/opt/b.jar", "/opt/c.jar"}, paths(Filter{Status: StatusOpen})); diff != "" {
+		t.Errorf("Inventory() of open paths returned diff (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff([]string{"/opt/a.jar"}, paths(Filter{Owner: "alice"})); diff != "" {
+		t.Errorf("Inventory() of alice's paths returned diff (-want, +got): %s", diff)
+	}
+	entries, err := s.Inventory(Filter{PathGlob: "/opt/a.jar"})
+	if err != nil {
+		t.Fatalf("Inventory() failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Status() != StatusAccepted || entries[0].Annotation.Ticket != "SEC-1" {
+		t.Errorf("Inventory() returned %+v, want a.jar annotated as accepted", entries)
+	}
+
+	if ok, err := s.DeleteAnnotation("host1", "/opt/a.jar"); err != nil || !ok {
+		t.Errorf("DeleteAnnotation() = %v, %v, want true", ok, err)
+	}
+	if ok, err := s.DeleteAnnotation("host1", "/opt/a.jar"); err != nil || ok {
+		t.Errorf("DeleteAnnotation() of a deleted annotation = %v, %v, want false", ok, err)
+	}
+	as, err := s.Annotations()
+	if err != nil {
+		t.Fatalf("Annotations() failed: %v", err)
+	}
+	if len(as) != 1 || as[0].Path != "/opt/b.jar" {
+		t.Errorf("Annotations() returned %+v, want only b.jar", as)
+	}
+}
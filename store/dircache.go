@@ -0,0 +1,110 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// dirCacheBatch is the number of directories written per transaction.
+// Committing each directory separately would dominate the cost of a walk.
+const dirCacheBatch = 1000
+
+// DirCache is a jar.Cache persisted in the store's dir_cache table. Writes
+// are batched, so Flush must be called once walking completes.
+type DirCache struct {
+	s *Store
+
+	mu      sync.Mutex
+	pending []cachedDir
+}
+
+type cachedDir struct {
+	path, key string
+	reports   []byte
+}
+
+// DirCache returns the store's directory cache.
+func (s *Store) DirCache() *DirCache {
+	return &DirCache{s: s}
+}
+
+// Get implements jar.Cache.
+func (c *DirCache) Get(dir, key string) (map[string]*jar.Report, bool, error) {
+	var stored, b string
+	err := c.s.db.QueryRow("SELECT key, reports FROM dir_cache WHERE path = ?", dir).Scan(&stored, &b)
+	if err == sql.ErrNoRows || (err == nil && stored != key) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("querying cache: %v", err)
+	}
+	var reports map[string]*jar.Report
+	if err := json.Unmarshal([]byte(b), &reports); err != nil {
+		return nil, false, fmt.Errorf("decoding cached reports of %s: %v", dir, err)
+	}
+	return reports, true, nil
+}
+
+// Put implements jar.Cache.
+func (c *DirCache) Put(dir, key string, reports map[string]*jar.Report) error {
+	b, err := json.Marshal(reports)
+	if err != nil {
+		return fmt.Errorf("encoding reports of %s: %v", dir, err)
+	}
+	c.mu.Lock()
+	c.pending = append(c.pending, cachedDir{dir, key, b})
+	full := len(c.pending) >= dirCacheBatch
+	c.mu.Unlock()
+	if full {
+		return c.Flush()
+	}
+	return nil
+}
+
+// Flush writes pending directories to the store.
+func (c *DirCache) Flush() error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx, err := c.s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("writing cache: %v", err)
+	}
+	now := time.Now().UTC()
+	for _, d := range pending {
+		_, err := tx.Exec("INSERT OR REPLACE INTO dir_cache (path, key, reports, updated) VALUES (?, ?, ?, ?)",
+			d.path, d.key, string(d.reports), now)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("writing cache of %s: %v", d.path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("writing cache: %v", err)
+	}
+	return nil
+}
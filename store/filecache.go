@@ -0,0 +1,110 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// fileCacheBatch is the number of files written per transaction.
+const fileCacheBatch = 1000
+
+// FileCache is a jar.FileCache persisted in the store's file_cache table. Like
+// DirCache, writes are batched, so Flush must be called once walking
+// completes. It's safe for concurrent use.
+type FileCache struct {
+	s *Store
+
+	mu      sync.Mutex
+	pending []cachedFile
+}
+
+type cachedFile struct {
+	path, key string
+	report    []byte
+}
+
+// FileCache returns the store's file cache.
+func (s *Store) FileCache() *FileCache {
+	return &FileCache{s: s}
+}
+
+// GetFile implements jar.FileCache.
+func (c *FileCache) GetFile(path, key string) (*jar.Report, bool, error) {
+	var stored, b string
+	err := c.s.db.QueryRow("SELECT key, report FROM file_cache WHERE path = ?", path).Scan(&stored, &b)
+	if err == sql.ErrNoRows || (err == nil && stored != key) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("querying cache: %v", err)
+	}
+	var r *jar.Report
+	if err := json.Unmarshal([]byte(b), &r); err != nil {
+		return nil, false, fmt.Errorf("decoding cached report of %s: %v", path, err)
+	}
+	return r, true, nil
+}
+
+// PutFile implements jar.FileCache.
+func (c *FileCache) PutFile(path, key string, r *jar.Report) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding report of %s: %v", path, err)
+	}
+	c.mu.Lock()
+	c.pending = append(c.pending, cachedFile{path, key, b})
+	full := len(c.pending) >= fileCacheBatch
+	c.mu.Unlock()
+	if full {
+		return c.Flush()
+	}
+	return nil
+}
+
+// Flush writes pending files to the store.
+func (c *FileCache) Flush() error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx, err := c.s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("writing cache: %v", err)
+	}
+	now := time.Now().UTC()
+	for _, f := range pending {
+		_, err := tx.Exec("INSERT OR REPLACE INTO file_cache (path, key, report, updated) VALUES (?, ?, ?, ?)",
+			f.path, f.key, string(f.report), now)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("writing cache of %s: %v", f.path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("writing cache: %v", err)
+	}
+	return nil
+}
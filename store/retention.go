@@ -0,0 +1,109 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ParseAge parses a retention period, such as "90d", "2w", or any
+// time.ParseDuration string, such as "36h".
+func ParseAge(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid age %q, expected a positive duration such as 90d, 2w, or 36h", s)
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	if n := len(s); n > 1 {
+		if unit, ok := units[s[n-1:]]; ok {
+			count, err := strconv.Atoi(s[:n-1])
+			if err != nil || count <= 0 {
+				return 0, invalid
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, invalid
+	}
+	return d, nil
+}
+
+// Pruned counts the rows removed by Prune.
+type Pruned struct {
+	Runs     int64
+	Findings int64
+	Skips    int64
+	// Dirs are directories of the DirCache that weren't scanned since.
+	Dirs int64
+	// Files are files of the FileCache that weren't scanned since.
+	Files int64
+}
+
+// Prune removes the runs that finished before a time, or started before it
+// if they never finished, along with their findings and skipped paths, and
+// cache entries not updated since.
+func (s *Store) Prune(before time.Time) (Pruned, error) {
+	var p Pruned
+	before = before.UTC()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return p, fmt.Errorf("pruning: %v", err)
+	}
+	defer tx.Rollback()
+	const old = "SELECT id FROM runs WHERE COALESCE(finished, started) < ?"
+	for _, stmt := range []struct {
+		query string
+		n     *int64
+	}{
+		{"DELETE FROM findings WHERE run_id IN (" + old + ")", &p.Findings},
+		{"DELETE FROM skips WHERE run_id IN (" + old + ")", &p.Skips},
+		{"DELETE FROM runs WHERE id IN (" + old + ")", &p.Runs},
+		{"DELETE FROM dir_cache WHERE updated < ?", &p.Dirs},
+		{"DELETE FROM file_cache WHERE updated < ?", &p.Files},
+	} {
+		res, err := tx.Exec(stmt.query, before)
+		if err != nil {
+			return p, fmt.Errorf("pruning: %v", err)
+		}
+		if *stmt.n, err = res.RowsAffected(); err != nil {
+			return p, fmt.Errorf("pruning: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return p, fmt.Errorf("pruning: %v", err)
+	}
+	return p, nil
+}
+
+// Compact rebuilds the database, returning the space of removed rows to the
+// filesystem, if at least a fraction of its pages are free, such as 0.25.
+// A fraction of 0 always rebuilds it. It reports if the database was rebuilt.
+func (s *Store) Compact(fraction float64) (bool, error) {
+	var pages, free int64
+	if err := s.db.QueryRow("PRAGMA page_count").Scan(&pages); err != nil {
+		return false, fmt.Errorf("reading page count: %v", err)
+	}
+	if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&free); err != nil {
+		return false, fmt.Errorf("reading free page count: %v", err)
+	}
+	if fraction > 0 && (pages == 0 || float64(free)/float64(pages) < fraction) {
+		return false, nil
+	}
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return false, fmt.Errorf("compacting: %v", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "90d", want: 90 * 24 * time.Hour},
+		{in: "2w", want: 14 * 24 * time.Hour},
+		{in: "36h", want: 36 * time.Hour},
+		{in: "0d", wantErr: true},
+		{in: "-1h", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "1.5d", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := ParseAge(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseAge(%q) returned error %v, want error %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseAge(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now().UTC()
+	// Runs are backdated, an unfinished one is aged by its start.
+	for _, r := range []struct {
+		host     string
+		age      time.Duration
+		finished bool
+	}{
+		{"old", 100 * 24 * time.Hour, true},
+		{"abandoned", 95 * 24 * time.Hour, false},
+		{"recent", 24 * time.Hour, true},
+		{"running", 0, false},
+	} {
+		run, err := s.StartRun(r.host, []string{"/opt"})
+		if err != nil {
+			t.Fatalf("StartRun() failed: %v", err)
+		}
+		for _, p := range []string{"/opt/a.jar", "/opt/b.jar"} {
+			if err := s.AddFinding(Finding{RunID: run.ID, Path: p}); err != nil {
+				t.Fatalf("AddFinding() failed: %v", err)
+			}
+		}
+		if err := s.AddSkip(Skip{RunID: run.ID, Path: "/opt/.git", Reason: "excluded"}); err != nil {
+			t.Fatalf("AddSkip() failed: %v", err)
+		}
+		ts := now.Add(-r.age)
+		var finished interface{}
+		if r.finished {
+			finished = ts
+		}
+		if _, err := s.DB().Exec("UPDATE runs SET started = ?, finished = ? WHERE id = ?", ts, finished, run.ID); err != nil {
+			t.Fatalf("backdating run: %v", err)
+		}
+	}
+	dc := s.DirCache()
+	if err := dc.Put("/opt", "key", nil); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if err := dc.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	if _, err := s.DB().Exec("UPDATE dir_cache SET updated = ?", now.Add(-200*24*time.Hour)); err != nil {
+		t.Fatalf("backdating cache: %v", err)
+	}
+
+	got, err := s.Prune(now.Add(-90 * 24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Prune() failed: %v", err)
+	}
+	want := Pruned{Runs: 2, Findings: 4, Skips: 2, Dirs: 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Prune() returned diff (-want, +got): %s", diff)
+	}
+	runs, err := s.Runs()
+	if err != nil {
+		t.Fatalf("Runs() failed: %v", err)
+	}
+	var hosts []string
+	for _, r := range runs {
+		hosts = append(hosts, r.Host)
+	}
+	if diff := cmp.Diff([]string{"recent", "running"}, hosts); diff != "" {
+		t.Errorf("Runs() after Prune() returned diff (-want, +got): %s", diff)
+	}
+
+	if ok, err := s.Compact(0.99); err != nil || ok {
+		t.Errorf("Compact(0.99) = %v, %v, want false, nil", ok, err)
+	}
+	if ok, err := s.Compact(0); err != nil || !ok {
+		t.Errorf("Compact(0) = %v, %v, want true, nil", ok, err)
+	}
+}
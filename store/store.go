@@ -0,0 +1,689 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store persists scan results to a SQLite database, so history
+// survives across runs and can be queried with standard SQLite tools.
+//
+// The database holds these tables:
+//
+//	runs
+//	  id          INTEGER PRIMARY KEY
+//	  host        TEXT       Hostname of the machine that performed the scan.
+//	  started     TIMESTAMP
+//	  finished    TIMESTAMP  NULL until the run completes.
+//	  directories TEXT       Newline separated directories that were scanned.
+//
+//	findings
+//	  id                   INTEGER PRIMARY KEY
+//	  run_id               INTEGER REFERENCES runs(id)
+//	  time                 TIMESTAMP
+//	  path                 TEXT
+//	  main_class           TEXT  Main-Class of the JAR's manifest.
+//	  version              TEXT  Implementation-Version of the JAR's manifest.
+//	  bundle_symbolic_name TEXT  OSGi Bundle-SymbolicName.
+//	  bundle_version       TEXT  OSGi Bundle-Version.
+//	  module               TEXT  JBoss module (name:slot) holding the JAR.
+//	  rewritten            BOOLEAN
+//	  cves                 TEXT  Comma separated CVEs, such as CVE-2021-44228.
+//	  severity             TEXT  Highest severity of the CVEs, such as "critical".
+//
+//	skips
+//	  id      INTEGER PRIMARY KEY
+//	  run_id  INTEGER REFERENCES runs(id)
+//	  time    TIMESTAMP
+//	  path    TEXT
+//	  reason  TEXT  Why the path wasn't scanned, such as an exclusion or error.
+//
+//	dir_cache
+//	  path     TEXT PRIMARY KEY  Directory cached by DirCache.
+//	  key      TEXT       Hash of the names, sizes, and times of its entries.
+//	  reports  TEXT       JSON object of the reports of its vulnerable JARs.
+//	  updated  TIMESTAMP
+//
+//	file_cache
+//	  path     TEXT PRIMARY KEY  File cached by FileCache.
+//	  key      TEXT       Hash of its size and modification time.
+//	  report   TEXT       JSON report of the file, null if it isn't a JAR.
+//	  updated  TIMESTAMP
+//
+//	annotations
+//	  host        TEXT  Host and path of the annotated finding, the primary
+//	  path        TEXT  key. See Annotation.
+//	  owner       TEXT
+//	  ticket      TEXT
+//	  status      TEXT  One of Statuses, or empty.
+//	  note        TEXT
+//	  updated_by  TEXT
+//	  updated     TIMESTAMP
+//
+// The schema version is tracked with SQLite's user_version pragma, and older
+// databases are upgraded when opened.
+//
+// The SQLite driver requires cgo. In binaries built without it, Supported is
+// false and Open returns ErrUnsupported.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/readonly"
+)
+
+// migrations upgrade the schema. The database's user_version is the number
+// of migrations that have been applied.
+var migrations = []string{
+	`CREATE TABLE runs (
+		id          INTEGER PRIMARY KEY,
+		host        TEXT NOT NULL,
+		started     TIMESTAMP NOT NULL,
+		finished    TIMESTAMP,
+		directories TEXT NOT NULL
+	);
+	CREATE TABLE findings (
+		id                   INTEGER PRIMARY KEY,
+		run_id               INTEGER NOT NULL REFERENCES runs(id),
+		time                 TIMESTAMP NOT NULL,
+		path                 TEXT NOT NULL,
+		main_class           TEXT NOT NULL,
+		version              TEXT NOT NULL,
+		bundle_symbolic_name TEXT NOT NULL,
+		bundle_version       TEXT NOT NULL,
+		module               TEXT NOT NULL,
+		rewritten            BOOLEAN NOT NULL
+	);
+	CREATE INDEX findings_path ON findings(path);
+	CREATE TABLE skips (
+		id     INTEGER PRIMARY KEY,
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		time   TIMESTAMP NOT NULL,
+		path   TEXT NOT NULL,
+		reason TEXT NOT NULL
+	);`,
+	// Every finding recorded before CVEs were tracked matched a critical
+	// vulnerability.
+	`ALTER TABLE findings ADD COLUMN cves TEXT NOT NULL DEFAULT '';
+	ALTER TABLE findings ADD COLUMN severity TEXT NOT NULL DEFAULT '';
+	UPDATE findings SET severity = 'critical';`,
+	`CREATE TABLE dir_cache (
+		path    TEXT PRIMARY KEY,
+		key     TEXT NOT NULL,
+		reports TEXT NOT NULL,
+		updated TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE annotations (
+		host       TEXT NOT NULL,
+		path       TEXT NOT NULL,
+		owner      TEXT NOT NULL,
+		ticket     TEXT NOT NULL,
+		status     TEXT NOT NULL,
+		note       TEXT NOT NULL,
+		updated_by TEXT NOT NULL,
+		updated    TIMESTAMP NOT NULL,
+		PRIMARY KEY (host, path)
+	);`,
+	`CREATE TABLE file_cache (
+		path    TEXT PRIMARY KEY,
+		key     TEXT NOT NULL,
+		report  TEXT NOT NULL,
+		updated TIMESTAMP NOT NULL
+	);`,
+}
+
+// ErrUnsupported is returned by Open in binaries built without cgo.
+var ErrUnsupported = errors.New("SQLite databases require a binary built with cgo")
+
+// Store is an open results database. It's safe for concurrent use.
+type Store struct {
+	db       *sql.DB
+	readOnly bool
+}
+
+// Open opens or creates the database at path, upgrading its schema if
+// necessary.
+func Open(path string) (*Store, error) {
+	if !Supported {
+		return nil, ErrUnsupported
+	}
+	if err := readonly.Check("opening " + path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=10000&_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	// SQLite allows a single writer, serialize access rather than
+	// surfacing "database is locked" errors.
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %v", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// OpenReadOnly opens the existing database at path for queries. Unlike Open,
+// it neither creates nor upgrades the database, and never takes SQLite's
+// write lock, so it doesn't compete with scans writing to the database.
+// Methods changing the database fail.
+func OpenReadOnly(path string) (*Store, error) {
+	if !Supported {
+		return nil, ErrUnsupported
+	}
+	// SQLite would report a missing file as "unable to open database
+	// file".
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_query_only=1&_busy_timeout=10000")
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("reading schema version of %s: %v", path, err)
+	}
+	switch {
+	case version > len(migrations):
+		db.Close()
+		return nil, fmt.Errorf("%s: schema version %d is newer than supported version %d", path, version, len(migrations))
+	case version < len(migrations):
+		db.Close()
+		return nil, fmt.Errorf("%s: schema version %d is older than version %d, scan with --store to upgrade it", path, version, len(migrations))
+	}
+	return &Store{db: db, readOnly: true}, nil
+}
+
+// ReadOnly reports if the database was opened with OpenReadOnly.
+func (s *Store) ReadOnly() bool {
+	return s.readOnly
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %v", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than supported version %d", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %v", i+1, err)
+		}
+		// PRAGMA doesn't support bound parameters.
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("updating schema version: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DB returns the underlying database, for queries this package doesn't
+// provide.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Run is a single invocation of the scanner.
+type Run struct {
+	ID          int64
+	Host        string
+	Started     time.Time
+	Finished    time.Time
+	Directories []string
+}
+
+// Finding is a vulnerable JAR discovered during a run.
+type Finding struct {
+	RunID              int64
+	Time               time.Time
+	Path               string
+	MainClass          string
+	Version            string
+	BundleSymbolicName string
+	BundleVersion      string
+	Module             string
+	Rewritten          bool
+	CVEs               []string
+	Severity           jar.Severity
+}
+
+// Skip is a path that wasn't scanned during a run.
+type Skip struct {
+	RunID  int64
+	Time   time.Time
+	Path   string
+	Reason string
+}
+
+// StartRun records the start of a run, returning it with its ID set.
+func (s *Store) StartRun(host string, dirs []string) (*Run, error) {
+	r := &Run{
+		Host:        host,
+		Started:     time.Now().UTC(),
+		Directories: dirs,
+	}
+	res, err := s.db.Exec("INSERT INTO runs (host, started, directories) VALUES (?, ?, ?)",
+		r.Host, r.Started, strings.Join(dirs, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("inserting run: %v", err)
+	}
+	if r.ID, err = res.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("inserting run: %v", err)
+	}
+	return r, nil
+}
+
+// FinishRun records the completion of a run.
+func (s *Store) FinishRun(r *Run) error {
+	r.Finished = time.Now().UTC()
+	if _, err := s.db.Exec("UPDATE runs SET finished = ? WHERE id = ?", r.Finished, r.ID); err != nil {
+		return fmt.Errorf("updating run %d: %v", r.ID, err)
+	}
+	return nil
+}
+
+// AddFinding records a finding. If Time is unset, the current time is used.
+func (s *Store) AddFinding(f Finding) error {
+	if f.Time.IsZero() {
+		f.Time = time.Now().UTC()
+	}
+	_, err := s.db.Exec(`INSERT INTO findings
+		(run_id, time, path, main_class, version, bundle_symbolic_name, bundle_version, module, rewritten, cves, severity)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.RunID, f.Time, f.Path, f.MainClass, f.Version, f.BundleSymbolicName, f.BundleVersion, f.Module, f.Rewritten,
+		strings.Join(f.CVEs, ","), f.Severity.String())
+	if err != nil {
+		return fmt.Errorf("inserting finding %s: %v", f.Path, err)
+	}
+	return nil
+}
+
+// AddSkip records a skipped path. If Time is unset, the current time is used.
+func (s *Store) AddSkip(sk Skip) error {
+	if sk.Time.IsZero() {
+		sk.Time = time.Now().UTC()
+	}
+	_, err := s.db.Exec("INSERT INTO skips (run_id, time, path, reason) VALUES (?, ?, ?, ?)",
+		sk.RunID, sk.Time, sk.Path, sk.Reason)
+	if err != nil {
+		return fmt.Errorf("inserting skip %s: %v", sk.Path, err)
+	}
+	return nil
+}
+
+// Runs returns all runs, oldest first.
+func (s *Store) Runs() ([]Run, error) {
+	rows, err := s.db.Query("SELECT id, host, started, finished, directories FROM runs ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("querying runs: %v", err)
+	}
+	defer rows.Close()
+	var runs []Run
+	for rows.Next() {
+		var (
+			r        Run
+			finished sql.NullTime
+			dirs     string
+		)
+		if err := rows.Scan(&r.ID, &r.Host, &r.Started, &finished, &dirs); err != nil {
+			return nil, fmt.Errorf("scanning run: %v", err)
+		}
+		r.Finished = finished.Time
+		r.Directories = splitList(dirs, "\n")
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// Findings returns the findings of a run, ordered by path.
+func (s *Store) Findings(runID int64) ([]Finding, error) {
+	rows, err := s.db.Query(`SELECT run_id, time, path, main_class, version, bundle_symbolic_name, bundle_version, module, rewritten, cves, severity
+		FROM findings WHERE run_id = ? ORDER BY path`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("querying findings: %v", err)
+	}
+	defer rows.Close()
+	var findings []Finding
+	for rows.Next() {
+		var (
+			f              Finding
+			cves, severity string
+		)
+		if err := rows.Scan(&f.RunID, &f.Time, &f.Path, &f.MainClass, &f.Version,
+			&f.BundleSymbolicName, &f.BundleVersion, &f.Module, &f.Rewritten, &cves, &severity); err != nil {
+			return nil, fmt.Errorf("scanning finding: %v", err)
+		}
+		f.CVEs = splitList(cves, ",")
+		f.Severity = parseSeverity(severity)
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// Skips returns the skipped paths of a run, ordered by path.
+func (s *Store) Skips(runID int64) ([]Skip, error) {
+	rows, err := s.db.Query("SELECT run_id, time, path, reason FROM skips WHERE run_id = ? ORDER BY path", runID)
+	if err != nil {
+		return nil, fmt.Errorf("querying skips: %v", err)
+	}
+	defer rows.Close()
+	var skips []Skip
+	for rows.Next() {
+		var sk Skip
+		if err := rows.Scan(&sk.RunID, &sk.Time, &sk.Path, &sk.Reason); err != nil {
+			return nil, fmt.Errorf("scanning skip: %v", err)
+		}
+		skips = append(skips, sk)
+	}
+	return skips, rows.Err()
+}
+
+// Filter restricts the entries returned by Inventory. Zero fields match
+// everything.
+type Filter struct {
+	Host string
+	// PathGlob is a SQLite GLOB pattern matched against the path, such as
+	// "/opt/*". Unlike filepath.Match, "*" also matches "/".
+	PathGlob string
+	CVE      string
+	// MinSeverity excludes findings less severe than it.
+	MinSeverity jar.Severity
+	// Status and Owner match the annotation of an entry. Entries without a
+	// status have StatusOpen.
+	Status string
+	Owner  string
+
+	FirstSeenAfter  time.Time
+	FirstSeenBefore time.Time
+	LastSeenAfter   time.Time
+	LastSeenBefore  time.Time
+}
+
+// ParseTime parses a time for a Filter, in YYYY-MM-DD or RFC 3339 format.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// Entry is a vulnerable path on a host, aggregated across every run that
+// reported it. Details are taken from the most recent finding.
+type Entry struct {
+	Host      string       `json:"host"`
+	Path      string       `json:"path"`
+	CVEs      []string     `json:"cves"`
+	Severity  jar.Severity `json:"severity"`
+	MainClass string       `json:"mainClass,omitempty"`
+	Version   string       `json:"version,omitempty"`
+	FirstSeen time.Time    `json:"firstSeen"`
+	LastSeen  time.Time    `json:"lastSeen"`
+	// Runs is the number of runs that reported the path.
+	Runs int `json:"runs"`
+	// Annotation tracks the remediation of the path, if it's annotated.
+	Annotation *Annotation `json:"annotation,omitempty"`
+}
+
+// Inventory returns the vulnerable paths matching the filter, ordered by host
+// and path.
+func (s *Store) Inventory(f Filter) ([]Entry, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if f.Host != "" {
+		where = append(where, "runs.host = ?")
+		args = append(args, f.Host)
+	}
+	if f.PathGlob != "" {
+		where = append(where, "findings.path GLOB ?")
+		args = append(args, f.PathGlob)
+	}
+	if f.CVE != "" {
+		where = append(where, "(',' || findings.cves || ',') LIKE ?")
+		args = append(args, "%,"+f.CVE+",%")
+	}
+	if f.MinSeverity > jar.SeverityNone {
+		var in []string
+		for sev := f.MinSeverity; sev <= jar.SeverityCritical; sev++ {
+			in = append(in, "?")
+			args = append(args, sev.String())
+		}
+		where = append(where, "findings.severity IN ("+strings.Join(in, ", ")+")")
+	}
+	q := `SELECT runs.host, findings.path, findings.time, findings.cves, findings.severity, findings.main_class, findings.version
+		FROM findings JOIN runs ON runs.id = findings.run_id`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY runs.host, findings.path, findings.time"
+
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying findings: %v", err)
+	}
+	defer rows.Close()
+	var (
+		entries []Entry
+		e       *Entry
+	)
+	for rows.Next() {
+		var (
+			host, path, cves, severity string
+			mainClass, version         string
+			t                          time.Time
+		)
+		if err := rows.Scan(&host, &path, &t, &cves, &severity, &mainClass, &version); err != nil {
+			return nil, fmt.Errorf("scanning finding: %v", err)
+		}
+		if e == nil || e.Host != host || e.Path != path {
+			entries = append(entries, Entry{Host: host, Path: path, FirstSeen: t})
+			e = &entries[len(entries)-1]
+		}
+		// Rows are ordered by time, so the last one holds the latest details.
+		e.LastSeen = t
+		e.CVEs = splitList(cves, ",")
+		e.Severity = parseSeverity(severity)
+		e.MainClass = mainClass
+		e.Version = version
+		e.Runs++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying findings: %v", err)
+	}
+	if err := s.annotate(entries); err != nil {
+		return nil, err
+	}
+
+	filtered := entries[:0]
+	for _, e := range entries {
+		if !f.FirstSeenAfter.IsZero() && !e.FirstSeen.After(f.FirstSeenAfter) {
+			continue
+		}
+		if !f.FirstSeenBefore.IsZero() && !e.FirstSeen.Before(f.FirstSeenBefore) {
+			continue
+		}
+		if !f.LastSeenAfter.IsZero() && !e.LastSeen.After(f.LastSeenAfter) {
+			continue
+		}
+		if !f.LastSeenBefore.IsZero() && !e.LastSeen.Before(f.LastSeenBefore) {
+			continue
+		}
+		if f.Status != "" && e.Status() != f.Status {
+			continue
+		}
+		if f.Owner != "" && (e.Annotation == nil || e.Annotation.Owner != f.Owner) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered, nil
+}
+
+// parseSeverity parses a severity column, treating unknown values as none.
+func parseSeverity(s string) jar.Severity {
+	sev, err := jar.ParseSeverity(s)
+	if err != nil {
+		return jar.SeverityNone
+	}
+	return sev
+}
+
+// splitList splits a column holding a list, returning nil for an empty one.
+func splitList(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, sep)
+}
+
+// TrendPoint summarizes the runs and findings of a single UTC day.
+type TrendPoint struct {
+	Day string `json:"day"`
+	// Runs and Hosts count the runs started that day, and the hosts they
+	// scanned.
+	Runs  int `json:"runs"`
+	Hosts int `json:"hosts"`
+	// Findings and VulnerableHosts count the distinct vulnerable paths found
+	// that day, and the hosts they were found on.
+	Findings        int `json:"findings"`
+	VulnerableHosts int `json:"vulnerableHosts"`
+}
+
+// Trend returns a point for every day since the given time with at least one
+// run, oldest first.
+func (s *Store) Trend(since time.Time) ([]TrendPoint, error) {
+	since = since.UTC()
+	// Times are stored in UTC as "YYYY-MM-DD HH:MM:SS...", so the first ten
+	// characters are the day.
+	rows, err := s.db.Query(`SELECT substr(started, 1, 10) AS day, COUNT(*), COUNT(DISTINCT host)
+		FROM runs WHERE started >= ? GROUP BY day ORDER BY day`, since)
+	if err != nil {
+		return nil, fmt.Errorf("querying runs: %v", err)
+	}
+	defer rows.Close()
+	var (
+		points []TrendPoint
+		byDay  = map[string]*TrendPoint{}
+	)
+	for rows.Next() {
+		var p TrendPoint
+		if err := rows.Scan(&p.Day, &p.Runs, &p.Hosts); err != nil {
+			return nil, fmt.Errorf("scanning runs: %v", err)
+		}
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying runs: %v", err)
+	}
+	for i := range points {
+		byDay[points[i].Day] = &points[i]
+	}
+
+	rows, err = s.db.Query(`SELECT substr(findings.time, 1, 10) AS day,
+			COUNT(DISTINCT runs.host || char(0) || findings.path), COUNT(DISTINCT runs.host)
+		FROM findings JOIN runs ON runs.id = findings.run_id
+		WHERE findings.time >= ? GROUP BY day`, since)
+	if err != nil {
+		return nil, fmt.Errorf("querying findings: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			day             string
+			findings, hosts int
+		)
+		if err := rows.Scan(&day, &findings, &hosts); err != nil {
+			return nil, fmt.Errorf("scanning findings: %v", err)
+		}
+		// Findings of runs spanning midnight may land on a day without a
+		// run start.
+		if p, ok := byDay[day]; ok {
+			p.Findings = findings
+			p.VulnerableHosts = hosts
+		}
+	}
+	return points, rows.Err()
+}
+
+// Coverage describes the most recent run on a host.
+type Coverage struct {
+	Host string `json:"host"`
+	// Runs is the number of runs recorded for the host.
+	Runs int `json:"runs"`
+	// LastStarted and LastFinished are the times of the host's latest run.
+	// LastFinished is zero if the run didn't complete.
+	LastStarted  time.Time `json:"lastStarted"`
+	LastFinished time.Time `json:"lastFinished"`
+	Directories  []string  `json:"directories"`
+	// Findings and Skips count the vulnerable and skipped paths of the
+	// latest run.
+	Findings int `json:"findings"`
+	Skips    int `json:"skips"`
+}
+
+// Coverage returns the latest run of every host, ordered by host.
+func (s *Store) Coverage() ([]Coverage, error) {
+	rows, err := s.db.Query(`SELECT r.host, r.started, r.finished, r.directories,
+			(SELECT COUNT(*) FROM runs WHERE runs.host = r.host),
+			(SELECT COUNT(*) FROM findings WHERE findings.run_id = r.id),
+			(SELECT COUNT(*) FROM skips WHERE skips.run_id = r.id)
+		FROM runs r WHERE r.id IN (SELECT MAX(id) FROM runs GROUP BY host)
+		ORDER BY r.host`)
+	if err != nil {
+		return nil, fmt.Errorf("querying coverage: %v", err)
+	}
+	defer rows.Close()
+	var coverage []Coverage
+	for rows.Next() {
+		var (
+			c        Coverage
+			finished sql.NullTime
+			dirs     string
+		)
+		if err := rows.Scan(&c.Host, &c.LastStarted, &finished, &dirs, &c.Runs, &c.Findings, &c.Skips); err != nil {
+			return nil, fmt.Errorf("scanning coverage: %v", err)
+		}
+		c.LastFinished = finished.Time
+		c.Directories = splitList(dirs, "\n")
+		coverage = append(coverage, c)
+	}
+	return coverage, rows.Err()
+}
@@ -0,0 +1,376 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"log4jscanner/jar"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	run, err := s.StartRun("host1", []string{"/opt", "/srv"})
+	if err != nil {
+		t.Fatalf("StartRun() failed: %v", err)
+	}
+	ts := time.Date(2021, 12, 17, 10, 0, 0, 0, time.UTC)
+	findings := []Finding{
+		{RunID: run.ID, Time: ts, Path: "/srv/b.jar", Module: "org.b:main", Rewritten: true,
+			CVEs: []string{jar.CVE202144228, jar.CVE202145046}, Severity: jar.SeverityCritical},
+		{RunID: run.ID, Time: ts, Path: "/opt/a.jar", MainClass: "com.a.Main", Version: "1.0",
+			BundleSymbolicName: "com.a", BundleVersion: "1.0.0"},
+	}
+	for _, f := range findings {
+		if err := s.AddFinding(f); err != nil {
+			t.Fatalf("AddFinding() failed: %v", err)
+		}
+	}
+	skip := Skip{RunID: run.ID, Time: ts, Path: "/opt/.git", Reason: "excluded"}
+	if err := s.AddSkip(skip); err != nil {
+		t.Fatalf("AddSkip() failed: %v", err)
+	}
+	if err := s.FinishRun(run); err != nil {
+		t.Fatalf("FinishRun() failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	// Reopen to check the schema isn't reapplied.
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopening store: %v", err)
+	}
+	defer s.Close()
+
+	runs, err := s.Runs()
+	if err != nil {
+		t.Fatalf("Runs() failed: %v", err)
+	}
+	approx := cmpopts.EquateApproxTime(time.Second)
+	if diff := cmp.Diff([]Run{*run}, runs, approx); diff != "" {
+		t.Errorf("Runs() returned diff (-want, +got): %s", diff)
+	}
+	got, err := s.Findings(run.ID)
+	if err != nil {
+		t.Fatalf("Findings() failed: %v", err)
+	}
+	want := []Finding{findings[1], findings[0]}
+	if diff := cmp.Diff(want, got, approx); diff != "" {
+		t.Errorf("Findings() returned diff (-want, +got): %s", diff)
+	}
+	skips, err := s.Skips(run.ID)
+	if err != nil {
+		t.Fatalf("Skips() failed: %v", err)
+	}
+	if diff := cmp.Diff([]Skip{skip}, skips, approx); diff != "" {
+		t.Errorf("Skips() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestOpenNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if _, err := s.DB().Exec("PRAGMA user_version = 1000"); err != nil {
+		t.Fatalf("setting user_version: %v", err)
+	}
+	s.Close()
+	if s, err := Open(path); err == nil {
+		s.Close()
+		t.Errorf("Open() of database with newer schema succeeded, expected error")
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.db")
+	if s, err := OpenReadOnly(missing); err == nil {
+		s.Close()
+		t.Errorf("OpenReadOnly() of missing database succeeded, expected error")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("OpenReadOnly() of missing database created it: %v", err)
+	}
+
+	path := filepath.Join(dir, "results.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	run, err := s.StartRun("host1", []string{"/opt"})
+	if err != nil {
+		t.Fatalf("StartRun() failed: %v", err)
+	}
+	if err := s.AddFinding(Finding{RunID: run.ID, Path: "/opt/a.jar", CVEs: []string{jar.CVE202144228}, Severity: jar.SeverityCritical}); err != nil {
+		t.Fatalf("AddFinding() failed: %v", err)
+	}
+
+	// Scans may keep writing while the database is served.
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly() failed: %v", err)
+	}
+	defer ro.Close()
+	if !ro.ReadOnly() || s.ReadOnly() {
+		t.Errorf("ReadOnly() returned %t and %t for read-only and read-write stores, want true and false", ro.ReadOnly(), s.ReadOnly())
+	}
+	if err := s.FinishRun(run); err != nil {
+		t.Fatalf("FinishRun() while open read-only failed: %v", err)
+	}
+	entries, err := ro.Inventory(Filter{})
+	if err != nil {
+		t.Fatalf("Inventory() failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/opt/a.jar" {
+		t.Errorf("Inventory() returned %+v, want /opt/a.jar", entries)
+	}
+	if _, err := ro.StartRun("host2", nil); err == nil {
+		t.Errorf("StartRun() on read-only store succeeded, expected error")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+}
+
+func TestOpenReadOnlyOlderSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if _, err := s.DB().Exec("PRAGMA user_version = 1"); err != nil {
+		t.Fatalf("setting user_version: %v", err)
+	}
+	s.Close()
+	if s, err := OpenReadOnly(path); err == nil {
+		s.Close()
+		t.Errorf("OpenReadOnly() of database with older schema succeeded, expected error")
+	}
+}
+
+func TestInventory(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer s.Close()
+
+	day := func(d int) time.Time {
+		return time.Date(2021, 12, d, 0, 0, 0, 0, time.UTC)
+	}
+	add := func(host string, d int, findings ...Finding) {
+		run, err := s.StartRun(host, []string{"/"})
+		if err != nil {
+			t.Fatalf("StartRun() failed: %v", err)
+		}
+		for _, f := range findings {
+			f.RunID = run.ID
+			f.Time = day(d)
+			if err := s.AddFinding(f); err != nil {
+				t.Fatalf("AddFinding() failed: %v", err)
+			}
+		}
+	}
+	a := Finding{Path: "/opt/a.jar", CVEs: []string{jar.CVE202144228, jar.CVE202145046}, Severity: jar.SeverityCritical, Version: "1.0"}
+	a2 := Finding{Path: "/opt/a.jar", CVEs: []string{jar.CVE202145046}, Severity: jar.SeverityCritical, Version: "1.1"}
+	b := Finding{Path: "/srv/b.jar", CVEs: []string{jar.CVE202145046}, Severity: jar.SeverityMedium}
+	add("host1", 10, a, b)
+	add("host1", 11, a2)
+	add("host2", 12, b)
+
+	entryA := Entry{Host: "host1", Path: "/opt/a.jar", CVEs: a2.CVEs, Severity: jar.SeverityCritical,
+		Version: "1.1", FirstSeen: day(10), LastSeen: day(11), Runs: 2}
+	entryB1 := Entry{Host: "host1", Path: "/srv/b.jar", CVEs: b.CVEs, Severity: jar.SeverityMedium,
+		FirstSeen: day(10), LastSeen: day(10), Runs: 1}
+	entryB2 := Entry{Host: "host2", Path: "/srv/b.jar", CVEs: b.CVEs, Severity: jar.SeverityMedium,
+		FirstSeen: day(12), LastSeen: day(12), Runs: 1}
+
+	testCases := []struct {
+		name   string
+		filter Filter
+		want   []Entry
+	}{
+		{"all", Filter{}, []Entry{entryA, entryB1, entryB2}},
+		{"host", Filter{Host: "host2"}, []Entry{entryB2}},
+		{"path", Filter{PathGlob: "/opt/*"}, []Entry{entryA}},
+		// Only the first run of a.jar reported CVE-2021-44228.
+		{"cve", Filter{CVE: jar.CVE202144228}, []Entry{{Host: "host1", Path: "/opt/a.jar", CVEs: a.CVEs,
+			Severity: jar.SeverityCritical, Version: "1.0", FirstSeen: day(10), LastSeen: day(10), Runs: 1}}},
+		{"severity", Filter{MinSeverity: jar.SeverityHigh}, []Entry{entryA}},
+		{"first seen after", Filter{FirstSeenAfter: day(11)}, []Entry{entryB2}},
+		{"first seen before", Filter{FirstSeenBefore: day(11)}, []Entry{entryA, entryB1}},
+		{"last seen after", Filter{LastSeenAfter: day(10)}, []Entry{entryA, entryB2}},
+		{"last seen before", Filter{LastSeenBefore: day(11)}, []Entry{entryB1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.Inventory(tc.filter)
+			if err != nil {
+				t.Fatalf("Inventory() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Inventory() returned diff (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestTrendAndCoverage(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer s.Close()
+
+	// Runs are timestamped when started, so backdate them directly.
+	day := func(d int) time.Time {
+		return time.Date(2021, 12, d, 12, 0, 0, 0, time.UTC)
+	}
+	add := func(host string, d int, paths ...string) {
+		res, err := s.DB().Exec("INSERT INTO runs (host, started, finished, directories) VALUES (?, ?, ?, ?)",
+			host, day(d), day(d).Add(time.Hour), "/opt\n/srv")
+		if err != nil {
+			t.Fatalf("inserting run: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		for _, p := range paths {
+			if err := s.AddFinding(Finding{RunID: id, Time: day(d), Path: p}); err != nil {
+				t.Fatalf("AddFinding() failed: %v", err)
+			}
+		}
+		if err := s.AddSkip(Skip{RunID: id, Time: day(d), Path: "/opt/.git", Reason: "excluded"}); err != nil {
+			t.Fatalf("AddSkip() failed: %v", err)
+		}
+	}
+	add("host1", 10, "/opt/a.jar", "/opt/b.jar")
+	add("host2", 10, "/opt/a.jar")
+	add("host1", 11)
+
+	points, err := s.Trend(day(9))
+	if err != nil {
+		t.Fatalf("Trend() failed: %v", err)
+	}
+	wantPoints := []TrendPoint{
+		{Day: "2021-12-10", Runs: 2, Hosts: 2, Findings: 3, VulnerableHosts: 2},
+		{Day: "2021-12-11", Runs: 1, Hosts: 1},
+	}
+	if diff := cmp.Diff(wantPoints, points); diff != "" {
+		t.Errorf("Trend() returned diff (-want, +got): %s", diff)
+	}
+	if points, err := s.Trend(day(11).Add(-time.Hour)); err != nil || len(points) != 1 {
+		t.Errorf("Trend() since the last day returned %+v, %v, want a single point", points, err)
+	}
+
+	coverage, err := s.Coverage()
+	if err != nil {
+		t.Fatalf("Coverage() failed: %v", err)
+	}
+	wantCoverage := []Coverage{
+		{Host: "host1", Runs: 2, LastStarted: day(11), LastFinished: day(11).Add(time.Hour),
+			Directories: []string{"/opt", "/srv"}, Skips: 1},
+		{Host: "host2", Runs: 1, LastStarted: day(10), LastFinished: day(10).Add(time.Hour),
+			Directories: []string{"/opt", "/srv"}, Findings: 1, Skips: 1},
+	}
+	if diff := cmp.Diff(wantCoverage, coverage); diff != "" {
+		t.Errorf("Coverage() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestDirCache(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer s.Close()
+
+	c := s.DirCache()
+	reports := map[string]*jar.Report{
+		"vuln.jar": {Vulnerable: true, CVEs: []string{jar.CVE202144228}, Version: "1.0"},
+	}
+	if err := c.Put("/opt/a", "key1", reports); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if _, ok, err := c.Get("/opt/a", "key1"); err != nil || ok {
+		t.Errorf("Get() before Flush() returned %t, %v, want a miss", ok, err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	got, ok, err := c.Get("/opt/a", "key1")
+	if err != nil || !ok {
+		t.Fatalf("Get() returned %t, %v, want a hit", ok, err)
+	}
+	if diff := cmp.Diff(reports, got); diff != "" {
+		t.Errorf("Get() returned diff (-want, +got): %s", diff)
+	}
+	if _, ok, err := c.Get("/opt/a", "key2"); err != nil || ok {
+		t.Errorf("Get() with a different key returned %t, %v, want a miss", ok, err)
+	}
+	if _, ok, err := c.Get("/opt/b", "key1"); err != nil || ok {
+		t.Errorf("Get() of an unknown directory returned %t, %v, want a miss", ok, err)
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer s.Close()
+
+	c := s.FileCache()
+	vuln := &jar.Report{Vulnerable: true, CVEs: []string{jar.CVE202144228}, Version: "1.0"}
+	if err := c.PutFile("/opt/a/vuln.jar", "key1", vuln); err != nil {
+		t.Fatalf("PutFile() failed: %v", err)
+	}
+	if err := c.PutFile("/opt/a/notajar.zip", "key1", nil); err != nil {
+		t.Fatalf("PutFile() failed: %v", err)
+	}
+	if _, ok, err := c.GetFile("/opt/a/vuln.jar", "key1"); err != nil || ok {
+		t.Errorf("GetFile() before Flush() returned %t, %v, want a miss", ok, err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	got, ok, err := c.GetFile("/opt/a/vuln.jar", "key1")
+	if err != nil || !ok {
+		t.Fatalf("GetFile() returned %t, %v, want a hit", ok, err)
+	}
+	if diff := cmp.Diff(vuln, got); diff != "" {
+		t.Errorf("GetFile() returned diff (-want, +got): %s", diff)
+	}
+	if got, ok, err := c.GetFile("/opt/a/notajar.zip", "key1"); err != nil || !ok || got != nil {
+		t.Errorf("GetFile() of a file that isn't a JAR returned %v, %t, %v, want a nil hit", got, ok, err)
+	}
+	if _, ok, err := c.GetFile("/opt/a/vuln.jar", "key2"); err != nil || ok {
+		t.Errorf("GetFile() with a different key returned %t, %v, want a miss", ok, err)
+	}
+}
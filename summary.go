@@ -0,0 +1,222 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"log4jscanner/jar"
+)
+
+// Exit reasons of --summary-json.
+const (
+	exitSuccess     = "success"
+	exitMaxFindings = "max-findings"
+	exitCritical    = "abort-on-first-critical"
+	exitFailOn      = "fail-on"
+	exitErrors      = "fail-on-errors"
+)
+
+// runSummary is the line written to stderr by --summary-json when the scan
+// exits, so wrapper scripts get its status without parsing the results.
+type runSummary struct {
+	ExitCode   int    `json:"exitCode"`
+	ExitReason string `json:"exitReason"`
+	// Complete is false if the scan stopped early or a network filesystem
+	// stalled.
+	Complete bool `json:"complete"`
+
+	Findings   int            `json:"findings"`
+	Unresolved int            `json:"unresolved"`
+	Rewritten  int            `json:"rewritten"`
+	Severities map[string]int `json:"severities,omitempty"`
+
+	Roots           int `json:"roots"`
+	ArchivesScanned int `json:"archivesScanned"`
+	Errors          int `json:"errors"`
+	// Truncated counts the archives among Errors that were cut short, such
+	// as partially written JARs.
+	Truncated int `json:"truncated"`
+	// TimedOut counts the archives among Errors whose scan exceeded
+	// --archive-timeout.
+	TimedOut int `json:"timedOut"`
+	// ZipBombs counts the archives among Errors that are suspected zip
+	// bombs, see --max-ratio.
+	ZipBombs int `json:"zipBombs"`
+	// Locked counts the archives among Errors that another process held
+	// open exclusively, such as the JARs of running Windows services.
+	Locked int `json:"locked"`
+	// Suppressed counts the findings muted by --suppress, which aren't
+	// counted by Findings.
+	Suppressed int `json:"suppressed"`
+	// Mitigated counts the scanned archives whose copies of log4j-core in
+	// vulnerable versions were all mitigated, such as by removing
+	// JndiLookup, see jar.Report.Mitigated.
+	Mitigated     int      `json:"mitigated"`
+	Skipped       int      `json:"skipped"`
+	StalledMounts []string `json:"stalledMounts,omitempty"`
+
+	// FilesWalked, BytesScanned, and DecompressedBytes are taken from the
+	// walker's jar.WalkStats.
+	FilesWalked       int64 `json:"filesWalked"`
+	BytesScanned      int64 `json:"bytesScanned"`
+	DecompressedBytes int64 `json:"decompressedBytes"`
+
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// summaryCounter counts the events of a scan for --summary-json. Its
+// methods are safe for concurrent use.
+type summaryCounter struct {
+	start time.Time
+
+	mu         sync.Mutex
+	scanned    int
+	errors     int
+	truncated  int
+	timedOut   int
+	zipBombs   int
+	locked     int
+	suppressed int
+	mitigated  int
+	skipped    int
+	rewritten  int
+	severities map[string]int
+}
+
+func newSummaryCounter() *summaryCounter {
+	return &summaryCounter{start: time.Now(), severities: map[string]int{}}
+}
+
+// scannedArchive counts an archive scanned with report r, nil if it isn't a
+// JAR.
+func (c *summaryCounter) scannedArchive(r *jar.Report) {
+	c.mu.Lock()
+	c.scanned++
+	if r != nil && r.Mitigated() {
+		c.mitigated++
+	}
+	c.mu.Unlock()
+}
+
+func (c *summaryCounter) failed(err error) {
+	var (
+		te *jar.TruncatedError
+		to *jar.TimeoutError
+	)
+	c.mu.Lock()
+	c.errors++
+	if errors.As(err, &te) {
+		c.truncated++
+	}
+	if errors.As(err, &to) {
+		c.timedOut++
+	}
+	if errors.Is(err, jar.ErrZipBomb) {
+		c.zipBombs++
+	}
+	if errors.Is(err, jar.ErrLocked) {
+		c.locked++
+	}
+	c.mu.Unlock()
+}
+
+func (c *summaryCounter) suppressedFinding() {
+	c.mu.Lock()
+	c.suppressed++
+	c.mu.Unlock()
+}
+
+// failures returns the number of archives that couldn't be scanned.
+func (c *summaryCounter) failures() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.errors
+}
+
+func (c *summaryCounter) skippedPath() {
+	c.mu.Lock()
+	c.skipped++
+	c.mu.Unlock()
+}
+
+func (c *summaryCounter) rewrote() {
+	c.mu.Lock()
+	c.rewritten++
+	c.mu.Unlock()
+}
+
+func (c *summaryCounter) found(sev jar.Severity) {
+	c.mu.Lock()
+	c.severities[sev.String()]++
+	c.mu.Unlock()
+}
+
+// summary returns the summary of the scan, given its outcome.
+func (c *summaryCounter) summary(exitCode int, reason string, complete bool, roots, unresolved int, stalled []string) *runSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &runSummary{
+		ExitCode:        exitCode,
+		ExitReason:      reason,
+		Complete:        complete && len(stalled) == 0,
+		Unresolved:      unresolved,
+		Rewritten:       c.rewritten,
+		Roots:           roots,
+		ArchivesScanned: c.scanned,
+		Errors:          c.errors,
+		Truncated:       c.truncated,
+		TimedOut:        c.timedOut,
+		ZipBombs:        c.zipBombs,
+		Locked:          c.locked,
+		Suppressed:      c.suppressed,
+		Mitigated:       c.mitigated,
+		Skipped:         c.skipped,
+		StalledMounts:   stalled,
+		DurationSeconds: time.Since(c.start).Seconds(),
+	}
+	if len(c.severities) > 0 {
+		s.Severities = map[string]int{}
+		for sev, n := range c.severities {
+			s.Severities[sev] = n
+			s.Findings += n
+		}
+	}
+	return s
+}
+
+// addWalkStats adds the statistics of the walks to the summary.
+func (s *runSummary) addWalkStats(ws jar.WalkStats) {
+	s.FilesWalked = ws.Files
+	s.BytesScanned = ws.Bytes
+	s.DecompressedBytes = ws.DecompressedBytes
+}
+
+// write writes s to w as a single line of JSON.
+func (s *runSummary) write(w io.Writer) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encoding summary: %v", err)
+	}
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("writing summary: %v", err)
+	}
+	return nil
+}
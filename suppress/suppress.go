@@ -0,0 +1,169 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package suppress mutes findings that were reviewed and accepted, such as
+// vulnerable JARs whose lookups are disabled by log4j2.formatMsgNoLookups, so
+// reports only show what still needs attention.
+//
+// A suppression file holds one rule per line:
+//
+//	# comment              Blank lines and lines starting with "#" are ignored.
+//	path /opt/legacy/**    Suppresses the JARs at paths matching a pattern, in
+//	                       the gitignore syntax of the ignore package.
+//	sha256 9f3c...         Suppresses the JARs with a SHA-256, wherever they are.
+//
+// The rest of a rule's line is the reason the findings were accepted, such as
+// a ticket, which is reported with them. Patterns can't hold whitespace, "?"
+// matches it instead.
+package suppress
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"log4jscanner/ignore"
+)
+
+// Rule suppresses the findings at matching paths, or of JARs with a
+// SHA-256.
+type Rule struct {
+	// Path is the pattern of a path rule, and SHA256 the lowercase hex
+	// encoded hash of a hash rule. Only one of them is set.
+	Path   string
+	SHA256 string
+	// Reason explains why the findings were accepted, or is empty.
+	Reason string
+	// Source is the file and line the rule was read from, such as
+	// "suppress.txt:3".
+	Source string
+
+	m *ignore.Matcher
+}
+
+// List holds suppression rules. A nil List suppresses nothing.
+type List struct {
+	rules []*Rule
+}
+
+// Parse reads the rules of a suppression file, named name in errors and
+// rule sources.
+func Parse(r io.Reader, name string) (*List, error) {
+	l := &List{}
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, n, err)
+		}
+		rule.Source = fmt.Sprintf("%s:%d", name, n)
+		l.rules = append(l.rules, rule)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", name, err)
+	}
+	return l, nil
+}
+
+// parseRule parses the line of a rule.
+func parseRule(line string) (*Rule, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid rule %q, expected path or sha256 followed by a value", line)
+	}
+	kind, value := fields[0], fields[1]
+	r := &Rule{Reason: strings.Join(fields[2:], " ")}
+	switch kind {
+	case "path":
+		m, err := ignore.New(value)
+		if err != nil {
+			return nil, err
+		}
+		r.Path, r.m = value, m
+	case "sha256":
+		if b, err := hex.DecodeString(value); err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("invalid SHA-256 %q", value)
+		}
+		r.SHA256 = strings.ToLower(value)
+	default:
+		return nil, fmt.Errorf("unknown rule %q, expected path or sha256", kind)
+	}
+	return r, nil
+}
+
+// Load reads the rules of the suppression file at path.
+func Load(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, path)
+}
+
+// Extend appends the rules of another list.
+func (l *List) Extend(other *List) {
+	if other != nil {
+		l.rules = append(l.rules, other.rules...)
+	}
+}
+
+// Hashes reports if any rule matches JARs by their SHA-256, which must be
+// computed to match them.
+func (l *List) Hashes() bool {
+	if l == nil {
+		return false
+	}
+	for _, r := range l.rules {
+		if r.SHA256 != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the first rule suppressing the finding of the JAR at path,
+// whose SHA-256 is sha256, or empty if unknown.
+func (l *List) Match(path, sha256 string) (*Rule, bool) {
+	if l == nil {
+		return nil, false
+	}
+	for _, r := range l.rules {
+		if r.m != nil && r.m.Match(path, false) {
+			return r, true
+		}
+		if r.SHA256 != "" && strings.EqualFold(r.SHA256, sha256) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// String describes the rule, for logs.
+func (r *Rule) String() string {
+	s := r.Source
+	if r.Reason != "" {
+		s += " (" + r.Reason + ")"
+	}
+	return s
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package suppress
+
+import (
+	"strings"
+	"testing"
+)
+
+const testFile = `# Lookups are disabled by log4j2.formatMsgNoLookups.
+path /opt/legacy/**   TICKET-123 formatMsgNoLookups enforced
+
+path vendor-*.jar
+sha256 9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08 appliance, accepted until 2025
+`
+
+func TestMatch(t *testing.T) {
+	l, err := Parse(strings.NewReader(testFile), "suppress.txt")
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if !l.Hashes() {
+		t.Errorf("Hashes() = false, want true")
+	}
+	const hash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	tests := []struct {
+		path   string
+		sha256 string
+		want   string
+	}{
+		{"/opt/legacy/app/log4j-core-2.14.1.jar", "", "suppress.txt:2 (TICKET-123 formatMsgNoLookups enforced)"},
+		{"/srv/opt/legacy/log4j.jar", "", ""},
+		{"/srv/lib/vendor-agent.jar", "", "suppress.txt:4"},
+		{"/srv/lib/agent.jar", hash, "suppress.txt:5 (appliance, accepted until 2025)"},
+		{"/srv/lib/agent.jar", "", ""},
+	}
+	for _, tc := range tests {
+		r, ok := l.Match(tc.path, tc.sha256)
+		var got string
+		if ok {
+			got = r.String()
+		}
+		if got != tc.want {
+			t.Errorf("Match(%q, %q) = %q, want %q", tc.path, tc.sha256, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, line := range []string{
+		"path",
+		"sha256 abc",
+		"file /opt/app.jar",
+		"path [a",
+	} {
+		if _, err := Parse(strings.NewReader(line), "suppress.txt"); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", line)
+		} else if !strings.HasPrefix(err.Error(), "suppress.txt:1: ") {
+			t.Errorf("Parse(%q) returned error %q, want its line", line, err)
+		}
+	}
+}
+
+func TestNil(t *testing.T) {
+	var l *List
+	if _, ok := l.Match("/opt/app.jar", ""); ok {
+		t.Errorf("nil List matched, want no match")
+	}
+	if l.Hashes() {
+		t.Errorf("nil List has hashes, want none")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testjar
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Entry is a file of an archive built by Zip or Tar. Regular files have
+// Contents, and links a Link target.
+type Entry struct {
+	Name     string
+	Contents string
+	// Type is the tar type flag of the entry, such as tar.TypeDir or
+	// tar.TypeSymlink, defaulting to a regular file. Zip ignores it.
+	Type byte
+	Link string
+}
+
+// File returns a regular file entry.
+func File(name, contents string) Entry {
+	return Entry{Name: name, Contents: contents}
+}
+
+// Zip returns a ZIP archive holding the given entries, in order, written
+// with the given compression method, such as zip.Deflate. Unlike Archive, it
+// adds no manifest, so tests control every entry.
+func Zip(t testing.TB, method uint16, entries ...Entry) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.Name, Method: method})
+		if err != nil {
+			t.Fatalf("creating %s: %v", e.Name, err)
+		}
+		if _, err := io.WriteString(w, e.Contents); err != nil {
+			t.Fatalf("writing %s: %v", e.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	return b.Bytes()
+}
+
+// Tar returns a tar archive holding the given entries, in order.
+func Tar(t testing.TB, entries ...Entry) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.Name, Mode: 0644, Typeflag: e.Type, Linkname: e.Link}
+		switch e.Type {
+		case 0, tar.TypeReg:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.Contents))
+		case tar.TypeDir:
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("writing header of %s: %v", e.Name, err)
+		}
+		if _, err := io.WriteString(tw, e.Contents); err != nil {
+			t.Fatalf("writing %s: %v", e.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar: %v", err)
+	}
+	return b.Bytes()
+}
+
+// Gzip returns data compressed with gzip.
+func Gzip(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing gzip: %v", err)
+	}
+	return b.Bytes()
+}
+
+// WriteFile writes data to a file, creating its parent directories.
+func WriteFile(t testing.TB, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("creating directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+}
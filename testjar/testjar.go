@@ -0,0 +1,289 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testjar builds JAR, WAR, and EAR fixtures for tests, so integrators
+// can test code built on the jar package without committing binary files.
+//
+// Fixtures contain synthetic log4j classes that reproduce what the scanner
+// matches for a given log4j version. They aren't valid Java classes.
+//
+//	war := testjar.WAR(testjar.Log4jCore("2.14.1"))
+//	b, err := war.Bytes()
+package testjar
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Corruption damages a generated archive.
+type Corruption int
+
+const (
+	// NotCorrupted leaves the archive intact.
+	NotCorrupted Corruption = iota
+	// Truncated cuts the archive short, removing its central directory so
+	// it's no longer a valid ZIP.
+	Truncated
+	// BadChecksum alters the stored contents of the manifest without
+	// updating its CRC-32, so reading it fails.
+	BadChecksum
+	// InvalidNested adds an entry with a ".jar" extension that isn't a ZIP.
+	InvalidNested
+)
+
+const log4jPackage = "org/apache/logging/log4j/"
+
+// Archive describes a JAR, WAR, or EAR to generate. The zero value is an
+// empty JAR with a manifest.
+type Archive struct {
+	// Name is the archive's path when nested within another archive, such as
+	// "WEB-INF/lib/app.jar".
+	Name string
+
+	// Log4j is the version of log4j-core whose classes are included, such as
+	// "2.14.1". If empty, no log4j classes are included.
+	Log4j string
+	// Patched removes JndiLookup.class from the log4j classes, the
+	// recommended mitigation for vulnerable versions.
+	Patched bool
+	// ShadePrefix relocates the log4j classes under a package, as the Maven
+	// Shade plugin does (e.g. "com/example/shaded/").
+	ShadePrefix string
+
+	// MainClass and Version set the manifest's Main-Class and
+	// Implementation-Version attributes.
+	MainClass string
+	Version   string
+	// Signed adds signature files to META-INF. The signatures aren't
+	// cryptographically valid, but exercise code handling signed JARs.
+	Signed bool
+
+	// Files holds additional entries, keyed by path.
+	Files map[string][]byte
+	// Nested holds archives stored within this one at their Name.
+	Nested []*Archive
+
+	// Corruption damages the archive after it's generated.
+	Corruption Corruption
+}
+
+// Log4jCore returns a log4j-core JAR of the given version, named like the
+// Maven artifact.
+func Log4jCore(version string) *Archive {
+	return &Archive{
+		Name:    "log4j-core-" + version + ".jar",
+		Log4j:   version,
+		Version: version,
+	}
+}
+
+// WAR returns a web application holding libs in WEB-INF/lib. Libraries without
+// a directory in their name are moved there.
+func WAR(libs ...*Archive) *Archive {
+	return &Archive{Name: "app.war", Nested: nestUnder("WEB-INF/lib/", libs)}
+}
+
+// EAR returns an enterprise application holding modules in its lib directory,
+// or at the root for WARs.
+func EAR(modules ...*Archive) *Archive {
+	var nested []*Archive
+	for _, m := range modules {
+		if path.Ext(m.Name) == ".war" {
+			nested = append(nested, m)
+		} else {
+			nested = append(nested, nestUnder("lib/", []*Archive{m})...)
+		}
+	}
+	return &Archive{Name: "app.ear", Nested: nested}
+}
+
+func nestUnder(dir string, archives []*Archive) []*Archive {
+	var nested []*Archive
+	for i, a := range archives {
+		c := *a
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("lib%d.jar", i)
+		}
+		if !strings.Contains(c.Name, "/") {
+			c.Name = dir + c.Name
+		}
+		nested = append(nested, &c)
+	}
+	return nested
+}
+
+// WriteFile writes the archive to a file.
+func (a *Archive) WriteFile(name string) error {
+	b, err := a.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0644)
+}
+
+// Bytes generates the archive.
+func (a *Archive) Bytes() ([]byte, error) {
+	files, err := a.files()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s: %v", f.name, err)
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return nil, fmt.Errorf("writing %s: %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return corrupt(buf.Bytes(), a.Corruption)
+}
+
+type file struct {
+	name string
+	data []byte
+}
+
+// files returns the entries of the archive, manifest first.
+func (a *Archive) files() ([]file, error) {
+	manifest := "Manifest-Version: 1.0\r\n"
+	if a.MainClass != "" {
+		manifest += "Main-Class: " + a.MainClass + "\r\n"
+	}
+	if a.Version != "" {
+		manifest += "Implementation-Version: " + a.Version + "\r\n"
+	}
+	files := []file{{"META-INF/MANIFEST.MF", []byte(manifest + "\r\n")}}
+	if a.Signed {
+		files = append(files,
+			file{"META-INF/FIXTURE.SF", []byte("Signature-Version: 1.0\r\n\r\n")},
+			file{"META-INF/FIXTURE.RSA", []byte("not a real signature")})
+	}
+	if a.Log4j != "" {
+		classes, err := log4jClasses(a.Log4j)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range classes {
+			if a.Patched && path.Base(f.name) == "JndiLookup.class" {
+				continue
+			}
+			f.name = a.ShadePrefix + f.name
+			files = append(files, f)
+		}
+	}
+
+	var names []string
+	for name := range a.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files = append(files, file{name, a.Files[name]})
+	}
+
+	for i, n := range a.Nested {
+		b, err := n.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("generating nested archive %s: %v", n.Name, err)
+		}
+		name := n.Name
+		if name == "" {
+			name = fmt.Sprintf("nested%d.jar", i)
+		}
+		files = append(files, file{name, b})
+	}
+	if a.Corruption == InvalidNested {
+		files = append(files, file{"lib/invalid.jar", []byte("not a zip file")})
+	}
+	return files, nil
+}
+
+// log4jClasses returns synthetic log4j-core classes for a version.
+func log4jClasses(version string) ([]file, error) {
+	minor, err := log4jMinor(version)
+	if err != nil {
+		return nil, err
+	}
+	// The JndiManager constructor changed in 2.15.0, 2.16.0 added the
+	// isJndiEnabled method, and 2.17.1 isJndiJdbcEnabled. These are what
+	// the scanner matches.
+	manager := "<init>\x00\x00\x00(Ljava/lang/String;Ljavax/naming/Context;)V"
+	if minor >= 15 {
+		manager = "<init>\x00\x00\x00(Ljava/lang/String;Ljava/util/Properties;)V"
+	}
+	if minor >= 16 {
+		manager += "\x00isJndiEnabled"
+	}
+	if minor > 17 || minor == 17 && !strings.HasPrefix(version, "2.17.0") {
+		manager += "\x00isJndiJdbcEnabled"
+	}
+	return []file{
+		{"META-INF/maven/org.apache.logging.log4j/log4j-core/pom.properties",
+			[]byte("groupId=org.apache.logging.log4j\nartifactId=log4j-core\nversion=" + version + "\n")},
+		{log4jPackage + "core/Logger.class", []byte("synthetic class")},
+		{log4jPackage + "core/lookup/JndiLookup.class", []byte("synthetic class")},
+		{log4jPackage + "core/net/JndiManager.class", []byte("synthetic class\x00" + manager)},
+		{log4jPackage + "core/appender/db/jdbc/DataSourceConnectionSource.class", []byte("synthetic class")},
+	}, nil
+}
+
+// log4jMinor returns the minor version of a log4j 2 version, such as 14 for
+// "2.14.1" or 0 for "2.0-beta9".
+func log4jMinor(version string) (int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 || parts[0] != "2" {
+		return 0, fmt.Errorf("unsupported log4j version %q, expected 2.x", version)
+	}
+	minor := parts[1]
+	if i := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minor = minor[:i]
+	}
+	n, err := strconv.Atoi(minor)
+	if err != nil {
+		return 0, fmt.Errorf("unsupported log4j version %q, expected 2.x", version)
+	}
+	return n, nil
+}
+
+func corrupt(b []byte, c Corruption) ([]byte, error) {
+	switch c {
+	case NotCorrupted, InvalidNested:
+		return b, nil
+	case Truncated:
+		return b[:len(b)/2], nil
+	case BadChecksum:
+		// The first local file header is 30 bytes, followed by the name of
+		// the manifest. Flip the first byte of its contents.
+		i := 30 + len("META-INF/MANIFEST.MF")
+		if i >= len(b) {
+			return nil, fmt.Errorf("archive too small to corrupt")
+		}
+		b[i] ^= 0xff
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown corruption %d", c)
+}
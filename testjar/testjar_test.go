@@ -0,0 +1,168 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testjar
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+func parse(t *testing.T, a *Archive) (*jar.Report, *zip.Reader) {
+	t.Helper()
+	b, err := a.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	r, err := jar.Parse(zr)
+	if err != nil {
+		t.Fatalf("jar.Parse() failed: %v", err)
+	}
+	return r, zr
+}
+
+func TestArchive(t *testing.T) {
+	shaded := Log4jCore("2.14.1")
+	shaded.ShadePrefix = "com/example/shaded/"
+	patched := Log4jCore("2.14.1")
+	patched.Patched = true
+	invalid := Log4jCore("2.14.1")
+	invalid.Corruption = InvalidNested
+
+	testCases := []struct {
+		name     string
+		archive  *Archive
+		wantCVEs []string
+	}{
+		{"empty", &Archive{}, nil},
+		{"2.0-beta9", Log4jCore("2.0-beta9"), []string{jar.CVE202144228, jar.CVE202145046}},
+		{"2.14.1", Log4jCore("2.14.1"), []string{jar.CVE202144228, jar.CVE202145046}},
+		{"2.15.0", Log4jCore("2.15.0"), []string{jar.CVE202145046}},
+		{"2.16.0", Log4jCore("2.16.0"), nil},
+		{"2.17.1", Log4jCore("2.17.1"), nil},
+		{"patched", patched, nil},
+		{"shaded", shaded, []string{jar.CVE202144228, jar.CVE202145046}},
+		{"war", WAR(Log4jCore("2.15.0")), []string{jar.CVE202145046}},
+		{"ear", EAR(WAR(Log4jCore("2.14.1"))), []string{jar.CVE202144228, jar.CVE202145046}},
+		{"safe ear", EAR(WAR(Log4jCore("2.17.1")), &Archive{Name: "util.jar"}), nil},
+		{"invalid nested", invalid, []string{jar.CVE202144228, jar.CVE202145046}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := parse(t, tc.archive)
+			if diff := cmp.Diff(tc.wantCVEs, r.CVEs); diff != "" {
+				t.Errorf("jar.Parse() returned unexpected CVEs (-want, +got): %s", diff)
+			}
+			if want := len(tc.wantCVEs) > 0; r.Vulnerable != want {
+				t.Errorf("jar.Parse() returned vulnerable=%t, want %t", r.Vulnerable, want)
+			}
+		})
+	}
+}
+
+func TestArchiveCVE44832(t *testing.T) {
+	cfg := &jar.Config{CVEs: []string{jar.CVE202144832}}
+	for _, tc := range []struct {
+		version string
+		want    bool
+	}{
+		{"2.14.1", true},
+		{"2.16.0", true},
+		{"2.17.0", true},
+		{"2.17.1", false},
+		{"2.17.2", false},
+	} {
+		b, err := Log4jCore(tc.version).Bytes()
+		if err != nil {
+			t.Fatalf("generating %s: %v", tc.version, err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatalf("reading %s: %v", tc.version, err)
+		}
+		r, err := cfg.Parse(zr)
+		if err != nil {
+			t.Fatalf("jar.Parse() of %s failed: %v", tc.version, err)
+		}
+		if r.Vulnerable != tc.want {
+			t.Errorf("jar.Parse() of %s returned vulnerable=%t to %s, want %t", tc.version, r.Vulnerable, jar.CVE202144832, tc.want)
+		}
+	}
+}
+
+func TestArchiveManifest(t *testing.T) {
+	r, _ := parse(t, &Archive{MainClass: "com.example.Main", Version: "1.2.3"})
+	if r.MainClass != "com.example.Main" || r.Version != "1.2.3" {
+		t.Errorf("jar.Parse() returned main class %q, version %q, want com.example.Main, 1.2.3", r.MainClass, r.Version)
+	}
+}
+
+func TestArchiveSigned(t *testing.T) {
+	a := Log4jCore("2.14.1")
+	a.Signed = true
+	_, zr := parse(t, a)
+	var buf bytes.Buffer
+	if err := jar.Rewrite(&buf, zr); err != nil {
+		t.Fatalf("jar.Rewrite() failed: %v", err)
+	}
+	rr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("reading rewritten archive: %v", err)
+	}
+	for _, f := range rr.File {
+		if strings.HasSuffix(f.Name, ".SF") || strings.HasSuffix(f.Name, ".RSA") {
+			t.Errorf("rewritten archive contains signature file %s", f.Name)
+		}
+	}
+}
+
+func TestArchiveCorruption(t *testing.T) {
+	b, err := (&Archive{Corruption: Truncated}).Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() failed: %v", err)
+	}
+	if _, err := zip.NewReader(bytes.NewReader(b), int64(len(b))); err == nil {
+		t.Errorf("reading truncated archive succeeded, expected error")
+	}
+
+	b, err = (&Archive{Corruption: BadChecksum}).Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	if _, err := jar.Parse(zr); err == nil {
+		t.Errorf("jar.Parse() of archive with bad checksum succeeded, expected error")
+	}
+}
+
+func TestLog4jVersionInvalid(t *testing.T) {
+	for _, v := range []string{"1.2.17", "2", "2.x"} {
+		if _, err := Log4jCore(v).Bytes(); err == nil {
+			t.Errorf("Bytes() of log4j %q succeeded, expected error", v)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package throttle limits the CPU and IO used by a scan and lets operators
+// pause and resume it.
+//
+// Scans call Wait between units of work, such as before every file. Wait
+// blocks while the throttle is paused, and otherwise sleeps long enough for
+// the time spent working since the previous call to stay under the
+// configured share of a CPU. WaitFile and WaitBytes are called as files are
+// opened and read, and sleep long enough to stay under the configured rates.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// minSleep batches short sleeps, which are dominated by scheduling overhead.
+const minSleep = 10 * time.Millisecond
+
+// Throttle paces a single goroutine doing CPU bound work with Wait, and
+// the IO of any number of goroutines with WaitFile and WaitBytes. The zero
+// value never sleeps.
+type Throttle struct {
+	// MaxPercent is the share of a single CPU the work may use, between 0
+	// and 100. Zero or 100 disables limiting.
+	MaxPercent float64
+	// MaxBytesPerSecond and MaxFilesPerSecond limit the rates bytes are
+	// read and files opened at, allowing bursts of up to a second's worth
+	// after a pause in the work. Zero disables limiting.
+	MaxBytesPerSecond float64
+	MaxFilesPerSecond float64
+
+	// now and sleep are replaced by tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+	// last is when work last started.
+	last time.Time
+	// owed is sleep that has accrued but not been taken yet.
+	owed time.Duration
+	// bytes and files pace WaitBytes and WaitFile.
+	bytes rate
+	files rate
+}
+
+// rate paces events to a number per second.
+type rate struct {
+	// next is when the events so far would have been paced to.
+	next time.Time
+}
+
+// reserve accounts for n events at now, returning how long to wait for them.
+func (r *rate) reserve(now time.Time, perSecond, n float64) time.Duration {
+	if perSecond <= 0 {
+		return 0
+	}
+	// Time left unused past a second isn't saved up.
+	if floor := now.Add(-time.Second); r.next.Before(floor) {
+		r.next = floor
+	}
+	r.next = r.next.Add(time.Duration(n / perSecond * float64(time.Second)))
+	return r.next.Sub(now)
+}
+
+func (t *Throttle) init() {
+	if t.cond == nil {
+		t.cond = sync.NewCond(&t.mu)
+	}
+	if t.now == nil {
+		t.now = time.Now
+	}
+	if t.sleep == nil {
+		t.sleep = time.Sleep
+	}
+}
+
+// Pause causes calls to Wait to block until Resume is called.
+func (t *Throttle) Pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	t.paused = true
+}
+
+// Resume unblocks calls to Wait.
+func (t *Throttle) Resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	t.paused = false
+	t.cond.Broadcast()
+}
+
+// Paused reports if the throttle is paused.
+func (t *Throttle) Paused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.paused
+}
+
+// Wait blocks while the throttle is paused, then sleeps if the work done since
+// the previous call exceeded MaxPercent.
+func (t *Throttle) Wait() {
+	t.mu.Lock()
+	t.init()
+	if t.paused {
+		for t.paused {
+			t.cond.Wait()
+		}
+		// Time spent paused isn't work.
+		t.last = time.Time{}
+	}
+	now := t.now()
+	limited := t.MaxPercent > 0 && t.MaxPercent < 100
+	if limited && !t.last.IsZero() {
+		worked := now.Sub(t.last)
+		t.owed += time.Duration(float64(worked) * (100 - t.MaxPercent) / t.MaxPercent)
+	}
+	var sleep time.Duration
+	if t.owed >= minSleep {
+		sleep, t.owed = t.owed, 0
+	}
+	t.mu.Unlock()
+
+	if sleep > 0 {
+		t.sleep(sleep)
+	}
+
+	t.mu.Lock()
+	t.last = t.now()
+	t.mu.Unlock()
+}
+
+// WaitFile blocks while the throttle is paused, and otherwise sleeps long
+// enough for files to be opened at no more than MaxFilesPerSecond. It's
+// called before opening each file.
+func (t *Throttle) WaitFile() {
+	t.waitRate(&t.files, t.MaxFilesPerSecond, 1)
+}
+
+// WaitBytes blocks while the throttle is paused, and otherwise sleeps long
+// enough for bytes to be read at no more than MaxBytesPerSecond. It's called
+// with the number of bytes of each read.
+func (t *Throttle) WaitBytes(n int) {
+	t.waitRate(&t.bytes, t.MaxBytesPerSecond, float64(n))
+}
+
+func (t *Throttle) waitRate(r *rate, perSecond, n float64) {
+	t.mu.Lock()
+	t.init()
+	for t.paused {
+		t.cond.Wait()
+	}
+	sleep := r.reserve(t.now(), perSecond, n)
+	t.mu.Unlock()
+
+	// Shorter sleeps stay owed until the next call.
+	if sleep >= minSleep {
+		t.sleep(sleep)
+	}
+}
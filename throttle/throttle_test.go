@@ -0,0 +1,194 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeClock advances only when work is simulated or the throttle sleeps.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) install(t *Throttle) {
+	t.now = func() time.Time { return c.now }
+	t.sleep = func(d time.Duration) {
+		c.sleeps = append(c.sleeps, d)
+		c.now = c.now.Add(d)
+	}
+}
+
+func TestWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPercent float64
+		work       []time.Duration
+		want       []time.Duration
+	}{
+		{
+			name:       "Unlimited",
+			maxPercent: 0,
+			work:       []time.Duration{time.Second, time.Second},
+		},
+		{
+			name:       "Full",
+			maxPercent: 100,
+			work:       []time.Duration{time.Second, time.Second},
+		},
+		{
+			name:       "Half",
+			maxPercent: 50,
+			work:       []time.Duration{time.Second, 2 * time.Second},
+			want:       []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:       "Quarter",
+			maxPercent: 25,
+			work:       []time.Duration{100 * time.Millisecond},
+			want:       []time.Duration{300 * time.Millisecond},
+		},
+		{
+			name:       "Batched",
+			maxPercent: 50,
+			work: []time.Duration{
+				4 * time.Millisecond,
+				4 * time.Millisecond,
+				4 * time.Millisecond,
+			},
+			want: []time.Duration{12 * time.Millisecond},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &fakeClock{now: time.Unix(0, 0)}
+			th := &Throttle{MaxPercent: tc.maxPercent}
+			c.install(th)
+			th.Wait()
+			for _, w := range tc.work {
+				c.now = c.now.Add(w)
+				th.Wait()
+			}
+			if diff := cmp.Diff(tc.want, c.sleeps); diff != "" {
+				t.Errorf("Wait() slept diff (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestPause(t *testing.T) {
+	c := &fakeClock{now: time.Unix(0, 0)}
+	th := &Throttle{MaxPercent: 50}
+	c.install(th)
+	th.Wait()
+	th.Pause()
+	if !th.Paused() {
+		t.Fatalf("Paused() = false after Pause()")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		th.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Wait() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	th.Resume()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Wait() didn't return after Resume()")
+	}
+	if th.Paused() {
+		t.Errorf("Paused() = true after Resume()")
+	}
+	// The clock didn't advance, but time spent paused must not count as
+	// work regardless.
+	if len(c.sleeps) != 0 {
+		t.Errorf("Wait() slept %v after being paused, want no sleep", c.sleeps)
+	}
+}
+
+func TestWaitRate(t *testing.T) {
+	type read struct {
+		// idle is the time passed before the read.
+		idle time.Duration
+		n    int
+	}
+	tests := []struct {
+		name string
+		// bytes and files are the rates per second, reads are of files
+		// if files is set.
+		bytes float64
+		files float64
+		reads []read
+		want  []time.Duration
+	}{
+		{
+			name:  "Unlimited",
+			reads: []read{{n: 1 << 30}, {n: 1 << 30}},
+		},
+		{
+			name:  "Bytes",
+			bytes: 1000,
+			reads: []read{{n: 1000}, {n: 500}, {n: 500}},
+			want:  []time.Duration{500 * time.Millisecond, 500 * time.Millisecond},
+		},
+		{
+			name:  "Batched",
+			bytes: 1000,
+			reads: []read{{n: 1000}, {n: 4}, {n: 4}, {n: 4}},
+			want:  []time.Duration{12 * time.Millisecond},
+		},
+		{
+			name:  "Idle",
+			bytes: 1000,
+			reads: []read{{n: 1000}, {idle: 5 * time.Second, n: 1000}, {n: 1000}},
+			want:  []time.Duration{time.Second},
+		},
+		{
+			name:  "Files",
+			files: 2,
+			reads: []read{{}, {}, {}, {}},
+			want:  []time.Duration{500 * time.Millisecond, 500 * time.Millisecond},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &fakeClock{now: time.Unix(0, 0)}
+			th := &Throttle{MaxBytesPerSecond: tc.bytes, MaxFilesPerSecond: tc.files}
+			c.install(th)
+			for _, r := range tc.reads {
+				c.now = c.now.Add(r.idle)
+				if tc.files > 0 {
+					th.WaitFile()
+				} else {
+					th.WaitBytes(r.n)
+				}
+			}
+			if diff := cmp.Diff(tc.want, c.sleeps); diff != "" {
+				t.Errorf("waiting slept diff (-want, +got): %s", diff)
+			}
+		})
+	}
+}
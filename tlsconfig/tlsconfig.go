@@ -0,0 +1,134 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tlsconfig builds TLS configurations for the scanner's network modes,
+// such as the scanning service, distributed workers, and result sinks, so they
+// all support custom CAs and mutual TLS the same way.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Options holds paths to PEM encoded files.
+type Options struct {
+	// CertFile and KeyFile are the certificate presented to the peer. Servers
+	// require them. For clients they're optional, and enable mutual TLS.
+	CertFile string
+	KeyFile  string
+	// CAFile, for clients, holds the CAs used to verify the server instead of
+	// the system roots.
+	CAFile string
+	// ClientCAFile, for servers, holds the CAs used to verify client
+	// certificates.
+	ClientCAFile string
+	// RequireClientCert causes servers to reject clients without a valid
+	// certificate. Otherwise certificates are only verified if presented.
+	RequireClientCert bool
+}
+
+// Enabled reports if any TLS options are set.
+func (o *Options) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.CAFile != "" || o.ClientCAFile != "" || o.RequireClientCert
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+func (o *Options) keyPair() ([]tls.Certificate, error) {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, fmt.Errorf("certificate and key must be provided together")
+	}
+	if o.CertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading key pair: %v", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// Server returns a configuration for serving TLS.
+func Server(o Options) (*tls.Config, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, fmt.Errorf("serving TLS requires a certificate and key")
+	}
+	certs, err := o.keyPair()
+	if err != nil {
+		return nil, err
+	}
+	c := &tls.Config{
+		Certificates: certs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if o.ClientCAFile != "" {
+		pool, err := loadPool(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+		if o.RequireClientCert {
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if o.RequireClientCert {
+		return nil, fmt.Errorf("requiring client certificates requires a client CA")
+	}
+	return c, nil
+}
+
+// Client returns a configuration for connecting to a TLS server.
+func Client(o Options) (*tls.Config, error) {
+	certs, err := o.keyPair()
+	if err != nil {
+		return nil, err
+	}
+	c := &tls.Config{
+		Certificates: certs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if o.CAFile != "" {
+		pool, err := loadPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = pool
+	}
+	return c, nil
+}
+
+// HTTPClient returns an HTTP client using the client configuration.
+func HTTPClient(o Options) (*http.Client, error) {
+	c, err := Client(o)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = c
+	return &http.Client{Transport: t}, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type certs struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	serial int64
+}
+
+func (c *certs) writePEM(t *testing.T, name, typ string, b []byte) string {
+	t.Helper()
+	p := filepath.Join(c.dir, name)
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+	return p
+}
+
+func newCerts(t *testing.T) (*certs, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating CA: %v", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing CA: %v", err)
+	}
+	c := &certs{dir: t.TempDir(), ca: ca, caKey: key, serial: 1}
+	return c, c.writePEM(t, "ca.pem", "CERTIFICATE", der)
+}
+
+// issue returns the paths of a certificate and key signed by the CA.
+func (c *certs) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	c.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(c.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.ca, &key.PublicKey, c.caKey)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+	return c.writePEM(t, name+".pem", "CERTIFICATE", der), c.writePEM(t, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestMutualTLS(t *testing.T) {
+	c, caFile := newCerts(t)
+	serverCert, serverKey := c.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := c.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	serverConf, err := Server(Options{
+		CertFile:          serverCert,
+		KeyFile:           serverKey,
+		ClientCAFile:      caFile,
+		RequireClientCert: true,
+	})
+	if err != nil {
+		t.Fatalf("Server() failed: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = serverConf
+	srv.StartTLS()
+	defer srv.Close()
+
+	client, err := HTTPClient(Options{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("HTTPClient() failed: %v", err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with client certificate failed: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "client" {
+		t.Errorf("server saw client %q, want %q", b, "client")
+	}
+
+	noCert, err := HTTPClient(Options{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("HTTPClient() failed: %v", err)
+	}
+	if resp, err := noCert.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("request without client certificate succeeded")
+	}
+
+	systemRoots, err := HTTPClient(Options{CertFile: clientCert, KeyFile: clientKey})
+	if err != nil {
+		t.Fatalf("HTTPClient() failed: %v", err)
+	}
+	if resp, err := systemRoots.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("request without custom CA succeeded")
+	}
+}
+
+func TestOptionsErrors(t *testing.T) {
+	if _, err := Server(Options{}); err == nil {
+		t.Errorf("Server() without certificate succeeded")
+	}
+	if _, err := Client(Options{CertFile: "cert.pem"}); err == nil {
+		t.Errorf("Client() with certificate but no key succeeded")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+
+	"log4jscanner/tlsconfig"
+)
+
+// serverTLSUsage documents the flags registered by serverTLSFlags.
+const serverTLSUsage = `    --tls-cert     PEM encoded certificate to serve TLS with.
+    --tls-key      PEM encoded private key for --tls-cert.
+    --client-ca    PEM encoded CA used to verify client certificates.
+    --require-client-cert
+                   Reject clients without a certificate signed by
+                   --client-ca (mutual TLS).
+`
+
+// clientTLSUsage documents the flags registered by clientTLSFlags.
+const clientTLSUsage = `    --tls-ca       PEM encoded CA used to verify the server, instead of the
+                   system roots.
+    --tls-cert     PEM encoded client certificate, for mutual TLS.
+    --tls-key      PEM encoded private key for --tls-cert.
+`
+
+func serverTLSFlags(flags *flag.FlagSet, o *tlsconfig.Options) {
+	flags.StringVar(&o.CertFile, "tls-cert", "", "")
+	flags.StringVar(&o.KeyFile, "tls-key", "", "")
+	flags.StringVar(&o.ClientCAFile, "client-ca", "", "")
+	flags.BoolVar(&o.RequireClientCert, "require-client-cert", false, "")
+}
+
+func clientTLSFlags(flags *flag.FlagSet, o *tlsconfig.Options) {
+	flags.StringVar(&o.CAFile, "tls-ca", "", "")
+	flags.StringVar(&o.CertFile, "tls-cert", "", "")
+	flags.StringVar(&o.KeyFile, "tls-key", "", "")
+}
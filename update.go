@@ -0,0 +1,283 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"log4jscanner/tlsconfig"
+	"log4jscanner/vulndb"
+)
+
+// Defaults for self-update, intended to be set at build time with:
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.updateURL=https://... -X main.updatePublicKey=..."
+//
+// A binary built without a version accepts any signed release.
+var (
+	version         = ""
+	updateURL       = ""
+	updatePublicKey = ""
+)
+
+// maxUpdateSize bounds the size of a downloaded binary.
+const maxUpdateSize = 256 << 20 // 256MiB
+
+func selfUpdateUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner self-update [flag]
+
+Downloads the latest scanner for this platform, verifies it against an
+ed25519 signed manifest, and atomically replaces the running binary.
+
+The release endpoint must serve binaries using the same names as the dist/
+directory (e.g. log4jscanner_linux_amd64). Each binary is described by a
+manifest with a ".json" suffix:
+
+    {"version": "1.2.3", "goos": "linux", "goarch": "amd64", "sha256": "..."}
+
+alongside a base64 encoded signature of the manifest with a ".json.sig"
+suffix. Releases for another platform, or that aren't newer than the
+running binary, are refused.
+
+Flags:
+
+    --url         Release endpoint. Defaults to $LOG4JSCANNER_UPDATE_URL.
+    --public-key  Base64 encoded ed25519 public key used to verify releases.
+                  Defaults to $LOG4JSCANNER_UPDATE_PUBLIC_KEY.
+`+clientTLSUsage+`
+`)
+}
+
+func selfUpdate(args []string) {
+	var (
+		endpoint  string
+		publicKey string
+		tlsOpts   tlsconfig.Options
+	)
+	flags := flag.NewFlagSet("self-update", flag.ExitOnError)
+	flags.StringVar(&endpoint, "url", envOr("LOG4JSCANNER_UPDATE_URL", updateURL), "")
+	flags.StringVar(&publicKey, "public-key", envOr("LOG4JSCANNER_UPDATE_PUBLIC_KEY", updatePublicKey), "")
+	clientTLSFlags(flags, &tlsOpts)
+	flags.Usage = selfUpdateUsage
+	flags.Parse(args)
+	if endpoint == "" || publicKey == "" || flags.NArg() != 0 {
+		selfUpdateUsage()
+		os.Exit(1)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		log.Fatalf("Error: invalid public key: expected base64 encoded %d byte ed25519 key", ed25519.PublicKeySize)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Error: determining path of running binary: %v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		log.Fatalf("Error: resolving path of running binary: %v", err)
+	}
+
+	client, err := tlsconfig.HTTPClient(tlsOpts)
+	if err != nil {
+		log.Fatalf("Error: configuring TLS: %v", err)
+	}
+	client.Timeout = 5 * time.Minute
+
+	updated, err := update(client, endpoint, ed25519.PublicKey(key), exe)
+	if err != nil {
+		log.Fatalf("Error: updating %s: %v", exe, err)
+	}
+	if updated {
+		fmt.Printf("Updated %s\n", exe)
+	} else {
+		fmt.Printf("%s is already up to date\n", exe)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// releaseName returns the name of the binary for the current platform, matching
+// the layout of the dist/ directory.
+func releaseName() string {
+	name := "log4jscanner_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// manifest describes a release binary. The manifest, rather than the binary,
+// is signed so that a valid signature can't be replayed for an older release
+// or another platform.
+type manifest struct {
+	Version string `json:"version"`
+	GOOS    string `json:"goos"`
+	GOARCH  string `json:"goarch"`
+	SHA256  string `json:"sha256"`
+}
+
+// update replaces the binary at exe with the release served by endpoint. It
+// returns false if the release is the same version as the running binary, or
+// the binary is already identical to the release.
+func update(client *http.Client, endpoint string, key ed25519.PublicKey, exe string) (bool, error) {
+	url := strings.TrimSuffix(endpoint, "/") + "/" + releaseName()
+
+	m, err := fetchManifest(client, url+".json", key)
+	if err != nil {
+		return false, err
+	}
+	if m.GOOS != runtime.GOOS || m.GOARCH != runtime.GOARCH {
+		return false, fmt.Errorf("release is for %s/%s, not %s/%s", m.GOOS, m.GOARCH, runtime.GOOS, runtime.GOARCH)
+	}
+	if version != "" {
+		switch c := vulndb.CompareVersions(m.Version, version); {
+		case c == 0:
+			return false, nil
+		case c < 0:
+			return false, fmt.Errorf("refusing to downgrade from %s to %s", version, m.Version)
+		}
+	}
+
+	bin, err := fetch(client, url)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(bin)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), m.SHA256) {
+		return false, fmt.Errorf("sha256 of %s doesn't match manifest", url)
+	}
+
+	current, err := os.ReadFile(exe)
+	if err != nil {
+		return false, fmt.Errorf("reading current binary: %v", err)
+	}
+	if bytes.Equal(current, bin) {
+		return false, nil
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return false, fmt.Errorf("stat current binary: %v", err)
+	}
+
+	// Create the temporary file in the same directory so the final rename
+	// doesn't cross filesystems.
+	tf, err := os.CreateTemp(filepath.Dir(exe), ".log4jscanner-update-")
+	if err != nil {
+		return false, fmt.Errorf("creating temp file: %v", err)
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+	if _, err := tf.Write(bin); err != nil {
+		return false, fmt.Errorf("writing temp file: %v", err)
+	}
+	if err := tf.Sync(); err != nil {
+		return false, fmt.Errorf("syncing temp file: %v", err)
+	}
+	if err := tf.Close(); err != nil {
+		return false, fmt.Errorf("closing temp file: %v", err)
+	}
+	if err := os.Chmod(tf.Name(), info.Mode()); err != nil {
+		return false, fmt.Errorf("chmod file: %v", err)
+	}
+
+	var old string
+	if runtime.GOOS == "windows" {
+		// Windows doesn't allow replacing a running executable, but does
+		// allow renaming it out of the way.
+		old = exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return false, fmt.Errorf("moving current binary: %v", err)
+		}
+	}
+	if err := os.Rename(tf.Name(), exe); err != nil {
+		if old != "" {
+			// Put the current binary back rather than leaving nothing
+			// at exe.
+			if rerr := os.Rename(old, exe); rerr != nil {
+				return false, fmt.Errorf("replacing binary: %v (restoring %s: %v)", err, old, rerr)
+			}
+		}
+		return false, fmt.Errorf("replacing binary: %v", err)
+	}
+	return true, nil
+}
+
+// fetchManifest downloads the manifest at url and verifies its signature,
+// served alongside it with a ".sig" suffix.
+func fetchManifest(client *http.Client, url string, key ed25519.PublicKey) (*manifest, error) {
+	b, err := fetch(client, url)
+	if err != nil {
+		return nil, err
+	}
+	encSig, err := fetch(client, url+".sig")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encSig)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %v", err)
+	}
+	if !ed25519.Verify(key, b, sig) {
+		return nil, fmt.Errorf("signature verification failed for %s", url)
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", url, err)
+	}
+	if m.Version == "" || m.SHA256 == "" {
+		return nil, fmt.Errorf("parsing %s: missing version or sha256", url)
+	}
+	return &m, nil
+}
+
+func fetch(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", url, err)
+	}
+	if len(b) > maxUpdateSize {
+		return nil, fmt.Errorf("fetching %s: response exceeds %d bytes", url, maxUpdateSize)
+	}
+	return b, nil
+}
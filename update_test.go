@@ -0,0 +1,170 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	bin := []byte("new binary")
+	sum := sha256.Sum256(bin)
+	valid := manifest{
+		Version: "1.3.0",
+		GOOS:    runtime.GOOS,
+		GOARCH:  runtime.GOARCH,
+		SHA256:  hex.EncodeToString(sum[:]),
+	}
+
+	tests := []struct {
+		name    string
+		current string
+		// modify edits the manifest served for the test.
+		modify  func(m *manifest)
+		signer  ed25519.PrivateKey
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "ValidSignature",
+			current: "1.2.0",
+			signer:  priv,
+			want:    true,
+		},
+		{
+			name:   "NoCurrentVersion",
+			signer: priv,
+			want:   true,
+		},
+		{
+			name:    "BadSignature",
+			current: "1.2.0",
+			signer:  otherPriv,
+			wantErr: true,
+		},
+		{
+			name:    "PlatformMismatch",
+			current: "1.2.0",
+			modify:  func(m *manifest) { m.GOOS = "plan9" },
+			signer:  priv,
+			wantErr: true,
+		},
+		{
+			name:    "ArchMismatch",
+			current: "1.2.0",
+			modify:  func(m *manifest) { m.GOARCH = "mips" },
+			signer:  priv,
+			wantErr: true,
+		},
+		{
+			name:    "SameVersion",
+			current: "1.3.0",
+			signer:  priv,
+			want:    false,
+		},
+		{
+			name:    "OlderVersion",
+			current: "1.10.0",
+			signer:  priv,
+			wantErr: true,
+		},
+		{
+			name:    "HashMismatch",
+			current: "1.2.0",
+			modify:  func(m *manifest) { m.SHA256 = hex.EncodeToString(make([]byte, sha256.Size)) },
+			signer:  priv,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := valid
+			if tc.modify != nil {
+				tc.modify(&m)
+			}
+			b, err := json.Marshal(m)
+			if err != nil {
+				t.Fatalf("marshaling manifest: %v", err)
+			}
+			sig := base64.StdEncoding.EncodeToString(ed25519.Sign(tc.signer, b))
+			files := map[string][]byte{
+				"/" + releaseName():               bin,
+				"/" + releaseName() + ".json":     b,
+				"/" + releaseName() + ".json.sig": []byte(sig),
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, ok := files[r.URL.Path]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write(data)
+			}))
+			defer srv.Close()
+
+			defer func(v string) { version = v }(version)
+			version = tc.current
+
+			exe := filepath.Join(t.TempDir(), "log4jscanner")
+			if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+				t.Fatalf("writing binary: %v", err)
+			}
+
+			got, err := update(srv.Client(), srv.URL, pub, exe)
+			if err != nil {
+				if !tc.wantErr {
+					t.Fatalf("update() returned unexpected error: %v", err)
+				}
+			} else if tc.wantErr {
+				t.Fatalf("update() expected error")
+			}
+			if got != tc.want {
+				t.Errorf("update() = %v, want %v", got, tc.want)
+			}
+
+			data, err := os.ReadFile(exe)
+			if err != nil {
+				t.Fatalf("reading binary: %v", err)
+			}
+			wantData := "old binary"
+			if tc.want {
+				wantData = string(bin)
+			}
+			if string(data) != wantData {
+				t.Errorf("binary contains %q, want %q", data, wantData)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"log4jscanner/jar"
+	"log4jscanner/results"
+)
+
+func verifyUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner verify --from FILE [flag]
+
+Re-scans only the JARs a previous scan reported vulnerable, and reports the
+status of each:
+
+    vulnerable  The JAR still matches the rules it matched before.
+    fixed       The JAR no longer matches, or is no longer a JAR.
+    missing     The JAR was removed.
+    error       The JAR couldn't be re-scanned.
+    unverified  The JAR wasn't re-scanned before --timeout, or was read
+                from stdin.
+
+Each JAR is re-scanned with the rules of its finding, so opt-in rules that
+matched are evaluated again. Findings must hold paths as written by default,
+not rewritten by --relative-paths or --hash-paths.
+
+Exits with status 3 if any JAR is still vulnerable.
+
+Flags:
+
+    --from     Findings written by --format json, or "-" for stdin
+               (required). May be provided multiple times.
+    --timeout  Stop re-scanning after the given duration (e.g. 30m),
+               reporting the remaining JARs as unverified.
+    --format   Output format, "text" (default) for a status and path per
+               line, or "json".
+
+`)
+}
+
+// Statuses of re-verified JARs.
+const (
+	verifyVulnerable = "vulnerable"
+	verifyFixed      = "fixed"
+	verifyMissing    = "missing"
+	verifyError      = "error"
+	verifyUnverified = "unverified"
+)
+
+// verifyStatuses orders the statuses in the summary.
+var verifyStatuses = []string{verifyVulnerable, verifyFixed, verifyMissing, verifyError, verifyUnverified}
+
+// verification is the outcome of re-scanning a finding.
+type verification struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	// Rules lists the rules the JAR matched before, and still matches if
+	// it's vulnerable.
+	Rules []string `json:"rules,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+func verifyCmd(args []string) {
+	var (
+		from    []string
+		timeout time.Duration
+		format  = "text"
+	)
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Func("from", "", func(path string) error {
+		from = append(from, path)
+		return nil
+	})
+	flags.DurationVar(&timeout, "timeout", 0, "")
+	flags.StringVar(&format, "format", format, "")
+	flags.Usage = verifyUsage
+	flags.Parse(args)
+	if len(from) == 0 || flags.NArg() != 0 {
+		verifyUsage()
+		os.Exit(1)
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("Error: unknown --format %q, expected text or json", format)
+	}
+
+	var findings []results.Finding
+	for _, path := range from {
+		f, err := readFindings(path)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		findings = results.Merge(findings, f)
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	counts := map[string]int{}
+	enc := json.NewEncoder(os.Stdout)
+	for _, f := range findings {
+		v := verification{Path: f.Path, Status: verifyUnverified, Rules: f.Rules}
+		if f.Path != "-" && (deadline.IsZero() || time.Now().Before(deadline)) {
+			v = verifyFinding(f)
+		}
+		counts[v.Status]++
+		if format == "json" {
+			if err := enc.Encode(v); err != nil {
+				log.Fatalf("Error: writing output: %v", err)
+			}
+			continue
+		}
+		if v.Error != "" {
+			fmt.Printf("%-10s  %s: %s\n", v.Status, v.Path, v.Error)
+		} else {
+			fmt.Printf("%-10s  %s\n", v.Status, v.Path)
+		}
+	}
+
+	var summary []string
+	for _, s := range verifyStatuses {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[s], s))
+	}
+	fmt.Fprintf(os.Stderr, "Verified %d JARs: %s\n", len(findings), strings.Join(summary, ", "))
+	if counts[verifyVulnerable] > 0 {
+		os.Exit(3)
+	}
+}
+
+// readFindings reads the findings of a file, or stdin if path is "-".
+func readFindings(path string) ([]results.Finding, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	findings, err := results.ReadJSON(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return findings, nil
+}
+
+// verifyFinding re-scans the JAR of a finding with the rules it matched, or
+// the default rules if none of them are known.
+func verifyFinding(f results.Finding) verification {
+	v := verification{Path: f.Path}
+	cfg := &jar.Config{}
+	for _, id := range f.Rules {
+		if _, ok := jar.LookupRule(id); ok {
+			cfg.EnableRules = append(cfg.EnableRules, id)
+		}
+	}
+	r, err := scanFileConfig(cfg, f.Path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		v.Status = verifyMissing
+	case err != nil:
+		v.Status, v.Error = verifyError, err.Error()
+	case r == nil || !r.Vulnerable:
+		v.Status = verifyFixed
+	default:
+		v.Status, v.Rules = verifyVulnerable, r.Rules
+	}
+	return v
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulndb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares Maven versions, returning -1, 0 or 1. Like Maven,
+// versions are split into numbers and qualifiers at dots, hyphens, and
+// transitions between digits and letters, which are compared in turn.
+// Numbers compare numerically and are newer than qualifiers. Qualifiers are
+// ordered alpha, beta, milestone, rc, snapshot, a release, then sp, with
+// unknown qualifiers newest, compared lexically. Missing parts count as 0 or
+// a release, so "1.0" equals "1.0.0" and is newer than "1.0-rc1".
+func CompareVersions(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y versionPart
+		switch {
+		case i >= len(pa):
+			y = pb[i]
+			x = versionPart{numeric: y.numeric}
+		case i >= len(pb):
+			x = pa[i]
+			y = versionPart{numeric: x.numeric}
+		default:
+			x, y = pa[i], pb[i]
+		}
+		if c := x.compare(y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// versionPart is a number or qualifier of a version.
+type versionPart struct {
+	numeric bool
+	n       uint64
+	q       string
+}
+
+// qualifierOrder ranks the known qualifiers, with "" for releases.
+var qualifierOrder = map[string]int{
+	"alpha":     0,
+	"beta":      1,
+	"milestone": 2,
+	"rc":        3,
+	"snapshot":  4,
+	"":          5,
+	"sp":        6,
+}
+
+// qualifierAliases maps qualifiers to those of qualifierOrder.
+var qualifierAliases = map[string]string{
+	"a":       "alpha",
+	"b":       "beta",
+	"m":       "milestone",
+	"cr":      "rc",
+	"ga":      "",
+	"final":   "",
+	"release": "",
+}
+
+func (x versionPart) compare(y versionPart) int {
+	switch {
+	case x.numeric && y.numeric:
+		switch {
+		case x.n < y.n:
+			return -1
+		case x.n > y.n:
+			return 1
+		}
+		return 0
+	case x.numeric:
+		return 1
+	case y.numeric:
+		return -1
+	}
+	rx, okx := qualifierOrder[x.q]
+	ry, oky := qualifierOrder[y.q]
+	if !okx {
+		rx = len(qualifierOrder)
+	}
+	if !oky {
+		ry = len(qualifierOrder)
+	}
+	switch {
+	case rx < ry:
+		return -1
+	case rx > ry:
+		return 1
+	}
+	return strings.Compare(x.q, y.q)
+}
+
+// parseVersion splits a version into its parts.
+func parseVersion(v string) []versionPart {
+	var parts []versionPart
+	v = strings.ToLower(v)
+	for len(v) > 0 {
+		if isSeparator(v[0]) {
+			v = v[1:]
+			continue
+		}
+		digit := isDigit(v[0])
+		end := 1
+		for end < len(v) && !isSeparator(v[end]) && isDigit(v[end]) == digit {
+			end++
+		}
+		parts = append(parts, newVersionPart(v[:end]))
+		v = v[end:]
+	}
+	return parts
+}
+
+func newVersionPart(s string) versionPart {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return versionPart{numeric: true, n: n}
+	}
+	if q, ok := qualifierAliases[s]; ok {
+		s = q
+	}
+	return versionPart{q: s}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSeparator(c byte) bool {
+	return c == '.' || c == '-' || c == '_' || c == '+'
+}
@@ -0,0 +1,356 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vulndb loads vulnerability definitions at runtime as rules of the
+// jar package, so the scanner can detect vulnerabilities of libraries other
+// than log4j, such as Spring4Shell or Text4Shell, without changes to the
+// scanner.
+//
+// A database is a JSON document listing vulnerabilities. Each is detected by
+// the Maven coordinates and affected versions of the packages it affects,
+// read from their pom.properties, by fingerprints of its classes, or both:
+//
+//	{
+//	  "vulnerabilities": [
+//	    {
+//	      "id": "TEXT4SHELL",
+//	      "cve": "CVE-2022-42889",
+//	      "severity": "critical",
+//	      "description": "Apache Commons Text interpolation with script lookups",
+//	      "packages": [
+//	        {
+//	          "group": "org.apache.commons",
+//	          "artifact": "commons-text",
+//	          "ranges": [{"introduced": "1.5", "fixed": "1.10.0"}]
+//	        }
+//	      ]
+//	    },
+//	    {
+//	      "id": "ACME-LOGGING-JNDI",
+//	      "cve": "ACME-2022-0001",
+//	      "severity": "high",
+//	      "classes": [
+//	        {
+//	          "path": "com/acme/logging/JndiLookup.class",
+//	          "contains": ["javax/naming/InitialContext"]
+//	        }
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// The fields of a vulnerability are:
+//
+//   - id: the ID of the rule detecting it, unique across rules.
+//   - cve: the vulnerability reported, such as "CVE-2022-42889".
+//   - severity: one of "low", "medium", "high", or "critical". Required
+//     unless the CVE is one the jar package already knows.
+//   - description: what the rule matches.
+//   - optIn: if true, the rule is only evaluated if enabled, like the jar
+//     package's opt-in rules.
+//   - packages: the affected Maven packages, by group and artifact. A
+//     version is affected if it's listed in versions, or within any of the
+//     ranges. A range covers the versions from introduced, inclusive, or
+//     every version if it's omitted, up to fixed, exclusive, or
+//     lastAffected, inclusive, or every later version if both are omitted.
+//     A package without versions or ranges is affected at every version.
+//   - classes: fingerprints of affected classes, any of which matches. A
+//     fingerprint matches a class at path, if set, whose SHA-256 is sha256,
+//     if set, and that contains every string of contains, and every hex
+//     encoded byte string of hex. At least one of them must be set.
+//
+// Versions are compared the way Maven does, see CompareVersions.
+package vulndb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"log4jscanner/jar"
+)
+
+// Database holds vulnerability definitions.
+type Database struct {
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// Vulnerability defines a vulnerability and how to detect it.
+type Vulnerability struct {
+	ID          string       `json:"id"`
+	CVE         string       `json:"cve"`
+	Severity    jar.Severity `json:"severity"`
+	Description string       `json:"description"`
+	OptIn       bool         `json:"optIn"`
+	Packages    []Package    `json:"packages"`
+	Classes     []Class      `json:"classes"`
+}
+
+// Package is a Maven package affected by a vulnerability.
+type Package struct {
+	Group    string   `json:"group"`
+	Artifact string   `json:"artifact"`
+	Versions []string `json:"versions"`
+	Ranges   []Range  `json:"ranges"`
+}
+
+// Range is a range of affected versions.
+type Range struct {
+	Introduced   string `json:"introduced"`
+	Fixed        string `json:"fixed"`
+	LastAffected string `json:"lastAffected"`
+}
+
+// Class is a fingerprint of an affected class.
+type Class struct {
+	Path     string   `json:"path"`
+	SHA256   string   `json:"sha256"`
+	Contains []string `json:"contains"`
+	Hex      []string `json:"hex"`
+}
+
+// Read reads and validates a database.
+func Read(r io.Reader) (*Database, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	var db Database
+	if err := d.Decode(&db); err != nil {
+		return nil, fmt.Errorf("parsing vulnerability database: %v", err)
+	}
+	if err := db.Validate(); err != nil {
+		return nil, err
+	}
+	return &db, nil
+}
+
+// Load reads and validates the database of a file.
+func Load(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading vulnerability database: %v", err)
+	}
+	defer f.Close()
+	db, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return db, nil
+}
+
+// Validate returns an error if a definition is incomplete or malformed.
+func (db *Database) Validate() error {
+	ids := map[string]bool{}
+	for i, v := range db.Vulnerabilities {
+		if v.ID == "" {
+			return fmt.Errorf("vulnerability %d has no id", i)
+		}
+		if ids[v.ID] {
+			return fmt.Errorf("duplicate vulnerability %s", v.ID)
+		}
+		ids[v.ID] = true
+		if err := v.validate(); err != nil {
+			return fmt.Errorf("vulnerability %s: %v", v.ID, err)
+		}
+	}
+	return nil
+}
+
+func (v *Vulnerability) validate() error {
+	if v.CVE == "" {
+		return fmt.Errorf("no cve")
+	}
+	if len(v.Packages) == 0 && len(v.Classes) == 0 {
+		return fmt.Errorf("no packages or classes")
+	}
+	for _, p := range v.Packages {
+		if p.Group == "" || p.Artifact == "" {
+			return fmt.Errorf("package without group and artifact")
+		}
+		for _, r := range p.Ranges {
+			if r.Fixed != "" && r.LastAffected != "" {
+				return fmt.Errorf("package %s:%s: range with both fixed and lastAffected", p.Group, p.Artifact)
+			}
+		}
+	}
+	for _, c := range v.Classes {
+		if c.Path == "" && c.SHA256 == "" && len(c.Contains) == 0 && len(c.Hex) == 0 {
+			return fmt.Errorf("empty class fingerprint")
+		}
+		if c.SHA256 != "" {
+			if b, err := hex.DecodeString(c.SHA256); err != nil || len(b) != sha256.Size {
+				return fmt.Errorf("class %s: invalid sha256 %q", c.Path, c.SHA256)
+			}
+		}
+		for _, h := range c.Hex {
+			if _, err := hex.DecodeString(h); err != nil || h == "" {
+				return fmt.Errorf("class %s: invalid hex %q", c.Path, h)
+			}
+		}
+	}
+	return nil
+}
+
+// Rules returns the rules detecting the vulnerabilities of the database, to
+// be registered with jar.RegisterRule.
+func (db *Database) Rules() []jar.Rule {
+	var rules []jar.Rule
+	for _, v := range db.Vulnerabilities {
+		r := jar.Rule{
+			ID:          v.ID,
+			CVE:         v.CVE,
+			Description: v.Description,
+			OptIn:       v.OptIn,
+			Severity:    v.Severity,
+		}
+		if len(v.Packages) > 0 {
+			r.ComponentMatcher = packageMatcher(v.Packages)
+		}
+		if len(v.Classes) > 0 {
+			r.Matcher = newClassMatcher(v.Classes)
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// Register registers the rules of the database with jar.RegisterRule.
+func (db *Database) Register() error {
+	for _, r := range db.Rules() {
+		if err := jar.RegisterRule(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Affects reports if the package at version v is affected.
+func (p *Package) Affects(v string) bool {
+	if len(p.Versions) == 0 && len(p.Ranges) == 0 {
+		return true
+	}
+	for _, av := range p.Versions {
+		if CompareVersions(av, v) == 0 {
+			return true
+		}
+	}
+	for _, r := range p.Ranges {
+		if r.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports if version v is within the range.
+func (r *Range) Contains(v string) bool {
+	if r.Introduced != "" && CompareVersions(v, r.Introduced) < 0 {
+		return false
+	}
+	if r.Fixed != "" && CompareVersions(v, r.Fixed) >= 0 {
+		return false
+	}
+	if r.LastAffected != "" && CompareVersions(v, r.LastAffected) > 0 {
+		return false
+	}
+	return true
+}
+
+// packageMatcher matches components of affected packages.
+type packageMatcher []Package
+
+func (m packageMatcher) MatchComponent(c jar.Component) bool {
+	for i := range m {
+		p := &m[i]
+		if p.Group != c.Group || p.Artifact != c.Artifact {
+			continue
+		}
+		// Components without a version can't be told apart from
+		// fixed ones.
+		if c.Version != "" && p.Affects(c.Version) {
+			return true
+		}
+	}
+	return false
+}
+
+// classMatcher matches classes by their fingerprints.
+type classMatcher []fingerprint
+
+// fingerprint is the compiled form of a Class.
+type fingerprint struct {
+	path    string
+	sha256  []byte
+	strings [][]byte
+}
+
+func newClassMatcher(classes []Class) classMatcher {
+	var m classMatcher
+	for _, c := range classes {
+		// Fingerprints were validated by Read.
+		f := fingerprint{path: c.Path}
+		if c.SHA256 != "" {
+			f.sha256, _ = hex.DecodeString(c.SHA256)
+		}
+		for _, s := range c.Contains {
+			f.strings = append(f.strings, []byte(s))
+		}
+		for _, h := range c.Hex {
+			b, _ := hex.DecodeString(h)
+			f.strings = append(f.strings, b)
+		}
+		m = append(m, f)
+	}
+	return m
+}
+
+func (m classMatcher) Match(p string, content []byte) int {
+	for _, f := range m {
+		if i := f.match(p, content); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// match returns the offset of the fingerprint's first string in the class, 0
+// if it has none, or -1 if the class doesn't match.
+func (f *fingerprint) match(p string, content []byte) int {
+	if f.path != "" && p != f.path {
+		return -1
+	}
+	if f.sha256 != nil {
+		sum := sha256.Sum256(content)
+		if !bytes.Equal(sum[:], f.sha256) {
+			return -1
+		}
+	}
+	first := -1
+	for _, s := range f.strings {
+		i := bytes.Index(content, s)
+		if i < 0 {
+			return -1
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return 0
+	}
+	return first
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulndb
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+
+	"log4jscanner/jar"
+)
+
+const testDB = `{
+  "vulnerabilities": [
+    {
+      "id": "TEST-TEXT4SHELL",
+      "cve": "TEST-2022-42889",
+      "severity": "critical",
+      "description": "commons-text script lookups",
+      "packages": [
+        {
+          "group": "org.apache.commons",
+          "artifact": "commons-text",
+          "ranges": [{"introduced": "1.5", "fixed": "1.10.0"}]
+        }
+      ]
+    },
+    {
+      "id": "TEST-ACME",
+      "cve": "TEST-2022-0101",
+      "severity": "high",
+      "classes": [
+        {"path": "com/acme/Lookup.class", "contains": ["InitialContext"]},
+        {"sha256": "40a49ac0e30921f98cee59e8ab2ee1eb06e6b80ac2178fa33c59e74a8f9bc9ca"}
+      ]
+    }
+  ]
+}`
+
+func pomJAR(t *testing.T, version string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.Create("META-INF/maven/org.apache.commons/commons-text/pom.properties")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("groupId=org.apache.commons\nartifactId=commons-text\nversion=" + version + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestRegister(t *testing.T) {
+	defer func(rules []jar.Rule) { jar.Rules = rules }(jar.Rules)
+
+	db, err := Read(strings.NewReader(testDB))
+	if err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if err := db.Register(); err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+	cfg := &jar.Config{EnableRules: []string{"TEST-TEXT4SHELL", "TEST-ACME"}}
+
+	tests := []struct {
+		name      string
+		fsys      fstest.MapFS
+		wantRules []string
+		wantPaths []string
+	}{
+		{
+			name:      "vulnerable package",
+			fsys:      fstest.MapFS{"WEB-INF/lib/commons-text-1.9.jar": &fstest.MapFile{Data: pomJAR(t, "1.9")}},
+			wantRules: []string{"TEST-TEXT4SHELL"},
+			wantPaths: []string{"WEB-INF/lib/commons-text-1.9.jar!META-INF/maven/org.apache.commons/commons-text/pom.properties"},
+		},
+		{
+			name: "fixed package",
+			fsys: fstest.MapFS{"WEB-INF/lib/commons-text-1.10.0.jar": &fstest.MapFile{Data: pomJAR(t, "1.10.0")}},
+		},
+		{
+			name: "class",
+			fsys: fstest.MapFS{
+				"com/acme/Lookup.class": &fstest.MapFile{Data: []byte("\xca\xfe\xba\xbejavax/naming/InitialContext")},
+			},
+			wantRules: []string{"TEST-ACME"},
+			wantPaths: []string{"com/acme/Lookup.class"},
+		},
+		{
+			name: "class by hash",
+			fsys: fstest.MapFS{
+				"com/acme/shaded/Lookup.class": &fstest.MapFile{Data: []byte("hashed class")},
+			},
+			wantRules: []string{"TEST-ACME"},
+			wantPaths: []string{"com/acme/shaded/Lookup.class"},
+		},
+		{
+			name: "other class",
+			fsys: fstest.MapFS{
+				"com/acme/Other.class": &fstest.MapFile{Data: []byte("\xca\xfe\xba\xbejavax/naming/InitialContext")},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := cfg.Parse(tc.fsys)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantRules, r.Rules); diff != "" {
+				t.Errorf("Parse() returned unexpected rules (-want, +got):\n%s", diff)
+			}
+			var paths []string
+			for _, m := range r.Matches {
+				paths = append(paths, m.Path)
+			}
+			if diff := cmp.Diff(tc.wantPaths, paths); diff != "" {
+				t.Errorf("Parse() returned unexpected matches (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		db   string
+	}{
+		{"syntax", `{"vulnerabilities": [`},
+		{"unknown field", `{"vulnerabilities": [{"id": "X", "cve": "X-1", "package": []}]}`},
+		{"no id", `{"vulnerabilities": [{"cve": "X-1", "classes": [{"path": "a.class"}]}]}`},
+		{"duplicate id", `{"vulnerabilities": [{"id": "X", "cve": "X-1", "classes": [{"path": "a.class"}]}, {"id": "X", "cve": "X-1", "classes": [{"path": "a.class"}]}]}`},
+		{"no cve", `{"vulnerabilities": [{"id": "X", "classes": [{"path": "a.class"}]}]}`},
+		{"nothing to match", `{"vulnerabilities": [{"id": "X", "cve": "X-1"}]}`},
+		{"package without artifact", `{"vulnerabilities": [{"id": "X", "cve": "X-1", "packages": [{"group": "g"}]}]}`},
+		{"fixed and last affected", `{"vulnerabilities": [{"id": "X", "cve": "X-1", "packages": [{"group": "g", "artifact": "a", "ranges": [{"fixed": "1", "lastAffected": "1"}]}]}]}`},
+		{"empty fingerprint", `{"vulnerabilities": [{"id": "X", "cve": "X-1", "classes": [{}]}]}`},
+		{"invalid sha256", `{"vulnerabilities": [{"id": "X", "cve": "X-1", "classes": [{"sha256": "abc"}]}]}`},
+		{"invalid hex", `{"vulnerabilities": [{"id": "X", "cve": "X-1", "classes": [{"hex": ["zz"]}]}]}`},
+		{"unknown severity", `{"vulnerabilities": [{"id": "X", "cve": "X-1", "severity": "urgent", "classes": [{"path": "a.class"}]}]}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(tc.db)); err == nil {
+				t.Errorf("Read() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestPackageAffects(t *testing.T) {
+	p := Package{
+		Versions: []string{"0.9"},
+		Ranges: []Range{
+			{Introduced: "1.5", Fixed: "1.10.0"},
+			{Introduced: "2.0", LastAffected: "2.1"},
+			{Introduced: "3.0"},
+		},
+	}
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"0.9", true},
+		{"0.9.0", true},
+		{"1.4", false},
+		{"1.5", true},
+		{"1.9", true},
+		{"1.10.0-rc1", true},
+		{"1.10", false},
+		{"1.10.0", false},
+		{"2.1", true},
+		{"2.1.1", false},
+		{"3.0-beta", false},
+		{"4.2", true},
+	}
+	for _, tc := range tests {
+		if got := p.Affects(tc.version); got != tc.want {
+			t.Errorf("Affects(%q) = %v, want %v", tc.version, got, tc.want)
+		}
+	}
+	if all := (&Package{}); !all.Affects("1.0") {
+		t.Errorf("Affects() of a package without versions = false, want true")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0.0", 0},
+		{"1.0.RELEASE", "1.0", 0},
+		{"1.0-final", "1.0-GA", 0},
+		{"1.9", "1.10", -1},
+		{"1.0-alpha1", "1.0-beta1", -1},
+		{"1.0-a1", "1.0-alpha2", -1},
+		{"1.0-M2", "1.0-RC1", -1},
+		{"1.0-rc1", "1.0-cr2", -1},
+		{"1.0-RC1", "1.0-SNAPSHOT", -1},
+		{"1.0-SNAPSHOT", "1.0", -1},
+		{"1.0", "1.0-sp1", -1},
+		{"1.0-sp1", "1.0-custom", -1},
+		{"1.0-custom", "1.0.1", -1},
+		{"5.3.18.RELEASE", "5.3.17", 1},
+		{"2.12.7.1", "2.12.7", 1},
+		{"31.0.1-jre", "31.0.1-android", 1},
+	}
+	for _, tc := range tests {
+		if got := CompareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := CompareVersions(tc.b, tc.a); got != -tc.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// log4jscanner.js wraps the WebAssembly build of the jar package. It requires
+// Go's wasm_exec.js to be loaded first.
+//
+//   const scanner = await Log4jScanner.load("log4jscanner.wasm");
+//   const report = await scanner.scan(file); // File, Blob, ArrayBuffer or Uint8Array
+//   if (report.vulnerable) { ... }
+
+(function (global) {
+  "use strict";
+
+  async function toBytes(input) {
+    if (input instanceof Uint8Array) {
+      return input;
+    }
+    if (input instanceof ArrayBuffer) {
+      return new Uint8Array(input);
+    }
+    if (typeof Blob !== "undefined" && input instanceof Blob) {
+      return new Uint8Array(await input.arrayBuffer());
+    }
+    throw new TypeError("expected a File, Blob, ArrayBuffer or Uint8Array");
+  }
+
+  async function load(url) {
+    if (typeof global.Go === "undefined") {
+      throw new Error("wasm_exec.js must be loaded before log4jscanner.js");
+    }
+    const go = new global.Go();
+    const resp = await fetch(url);
+    let result;
+    if (WebAssembly.instantiateStreaming) {
+      result = await WebAssembly.instantiateStreaming(resp, go.importObject);
+    } else {
+      result = await WebAssembly.instantiate(await resp.arrayBuffer(), go.importObject);
+    }
+    // The Go program registers log4jscannerParse then blocks forever.
+    go.run(result.instance);
+
+    return {
+      // scan resolves to {jar, vulnerable, mainClass, version}, or rejects if
+      // the archive couldn't be parsed.
+      async scan(input) {
+        const report = global.log4jscannerParse(await toBytes(input));
+        if (report.error) {
+          throw new Error(report.error);
+        }
+        return report;
+      },
+    };
+  }
+
+  global.Log4jScanner = { load: load };
+})(typeof globalThis !== "undefined" ? globalThis : self);
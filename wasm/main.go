@@ -0,0 +1,76 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build js && wasm
+
+// The wasm tool exposes the jar package to JavaScript. It's intended to be
+// loaded through log4jscanner.js, which wraps the raw Go bindings in a
+// promise based API.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"syscall/js"
+
+	"log4jscanner/jar"
+)
+
+// parse is exposed to JavaScript as log4jscannerParse(Uint8Array). It returns
+// an object with either an "error" key, or the fields of the jar.Report.
+func parse(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return errorValue(fmt.Errorf("expected 1 argument, got %d", len(args)))
+	}
+	b := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(b, args[0])
+
+	br := bytes.NewReader(b)
+	zr, err := zip.NewReader(br, br.Size())
+	if err != nil {
+		if err == zip.ErrFormat {
+			// Not a JAR.
+			return map[string]interface{}{"jar": false, "vulnerable": false}
+		}
+		return errorValue(fmt.Errorf("opening file as a ZIP archive: %v", err))
+	}
+	if !jar.IsJAR(zr) {
+		return map[string]interface{}{"jar": false, "vulnerable": false}
+	}
+	r, err := jar.Parse(zr)
+	if err != nil {
+		return errorValue(fmt.Errorf("scanning jar: %v", err))
+	}
+	return map[string]interface{}{
+		"jar":        true,
+		"vulnerable": r.Vulnerable,
+		"mainClass":  r.MainClass,
+		"version":    r.Version,
+		"bundle": map[string]interface{}{
+			"symbolicName": r.Bundle.SymbolicName,
+			"version":      r.Bundle.Version,
+		},
+	}
+}
+
+func errorValue(err error) interface{} {
+	return map[string]interface{}{"error": err.Error()}
+}
+
+func main() {
+	js.Global().Set("log4jscannerParse", js.FuncOf(parse))
+	// Block forever so the callback remains available.
+	select {}
+}
@@ -0,0 +1,298 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"log4jscanner/auditd"
+	"log4jscanner/fswatch"
+	"log4jscanner/jar"
+	"log4jscanner/logging"
+	"log4jscanner/metrics"
+	"log4jscanner/results"
+)
+
+func watchUsage() {
+	fmt.Fprint(os.Stderr, `Usage: log4jscanner watch [flag] [directories]
+
+Rescans archives as they're created or modified within the directories, using
+file events of the Linux audit subsystem. Watching is supported on Linux only;
+elsewhere, only --print-rules works. Unlike watching every directory with
+inotify, audit rules cost nothing per directory, so millions of directories
+can be covered. Paths of vulnerable archives are printed to stdout as they're
+found.
+
+Each directory must be watched by an audit rule with the --key, for example in
+/etc/audit/rules.d/log4jscanner.rules:
+
+    -w /opt -p wa -k log4jscanner
+
+With --events inotify, every directory within the directories is watched with
+inotify instead, which needs no audit rules and works in containers, but is
+limited to the fs.inotify.max_user_watches sysctl's number of directories.
+
+Flags:
+
+    --events       Source of file events, audit or inotify (default audit).
+    --audit-log    Audit log to follow (default /var/log/audit/audit.log).
+                   If "-", raw records are read from stdin, so the scanner
+                   can run as an audisp plugin.
+    --key          Key of the audit rules (default log4jscanner).
+    --settle       Time an archive must go unmodified before it's rescanned,
+                   so archives aren't scanned while being written (default
+                   5s).
+    --print-rules  Print audit rules for the directories and exit.
+    --format       Output format of findings, text or json (default text).
+    --webhook      Also POST findings as JSON to the given URL.
+    --webhook-header
+                   Header to send with --webhook requests (e.g.
+                   "Authorization: Bearer TOKEN"). May be provided multiple
+                   times.
+`+clientTLSUsage+`    --metrics      Serve Prometheus metrics of the archives rescanned, their
+                   findings by severity, errors, and latency, under /metrics
+                   on the given address, such as :9090.
+    `+logFormatHelp+`
+
+`)
+}
+
+func watch(args []string) {
+	var (
+		auditLog   string
+		key        string
+		settle     time.Duration
+		printRules bool
+		format     string
+		metricAddr string
+		logFmt     string
+		events     string
+		webhook    webhookFlags
+	)
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	flags.StringVar(&auditLog, "audit-log", "/var/log/audit/audit.log", "")
+	flags.StringVar(&key, "key", "log4jscanner", "")
+	flags.DurationVar(&settle, "settle", 5*time.Second, "")
+	flags.BoolVar(&printRules, "print-rules", false, "")
+	flags.StringVar(&format, "format", "text", "")
+	flags.StringVar(&metricAddr, "metrics", "", "")
+	flags.StringVar(&events, "events", "audit", "")
+	webhook.register(flags)
+	logFormatFlag(flags, &logFmt)
+	flags.Usage = watchUsage
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		watchUsage()
+		os.Exit(1)
+	}
+	setupLogging(logFmt)
+	var dirs []string
+	for _, d := range flags.Args() {
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		dirs = append(dirs, abs)
+	}
+	if events != "audit" && events != "inotify" {
+		log.Fatalf("Error: unknown --events %q, expected audit or inotify", events)
+	}
+	if printRules {
+		if events != "audit" {
+			log.Fatalf("Error: --print-rules requires --events audit")
+		}
+		for _, d := range dirs {
+			fmt.Println(auditd.Rule(d, key))
+		}
+		return
+	}
+	if runtime.GOOS != "linux" {
+		log.Fatalf("Error: watch is only supported on Linux, %s has no audit or inotify file events", runtime.GOOS)
+	}
+
+	var sink results.Sink
+	switch format {
+	case "text":
+		sink = results.NewText(os.Stdout)
+	case "json":
+		sink = results.NewJSON(os.Stdout)
+	default:
+		log.Fatalf("Error: unknown --format %q, expected text or json", format)
+	}
+	if ws := webhook.sink(); ws != nil {
+		sink = results.Multi(sink, ws)
+	}
+	defer sink.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	changed := make(chan string)
+	done := make(chan error, 1)
+	if events == "inotify" {
+		fw := &fswatch.Watcher{
+			HandleChange: func(p string) { changed <- p },
+			HandleError: func(p string, err error) {
+				logging.With("path", p, "error", err).Printf("Error: watching %s: %v", p, err)
+			},
+		}
+		go func() { done <- fw.Watch(ctx, dirs...) }()
+	} else {
+		var src io.Reader = os.Stdin
+		if auditLog != "-" {
+			f, err := auditd.Follow(ctx, auditLog, time.Second)
+			if err != nil {
+				log.Fatalf("Error: following audit log: %v", err)
+			}
+			defer f.Close()
+			src = f
+		}
+		go func() {
+			done <- auditd.Read(src, key, func(e *auditd.Event) {
+				for _, p := range e.Paths {
+					if inDirs(p, dirs) {
+						changed <- p
+					}
+				}
+			})
+		}()
+	}
+
+	w := &watcher{sink: sink, pending: map[string]time.Time{}}
+	if metricAddr != "" {
+		reg := &metrics.Registry{}
+		w.scans = metrics.NewScans(reg)
+		serveMetrics(metricAddr, reg)
+	}
+	tick := settle / 5
+	if tick < 100*time.Millisecond {
+		tick = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case p := <-changed:
+			w.pending[p] = time.Now().Add(settle)
+		case now := <-ticker.C:
+			w.scanDue(now)
+		case err := <-done:
+			// Scan what's pending before exiting, the input ended.
+			w.scanDue(time.Now().Add(settle))
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// inDirs reports if path is one of dirs or inside one.
+func inDirs(path string, dirs []string) bool {
+	for _, d := range dirs {
+		if path == d || strings.HasPrefix(path, strings.TrimSuffix(d, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// watcher rescans changed paths once they've settled.
+type watcher struct {
+	sink results.Sink
+	// pending holds changed paths and when to scan them.
+	pending map[string]time.Time
+	// scans, if set, records the scans.
+	scans *metrics.Scans
+}
+
+// scanDue scans the pending paths due before now.
+func (w *watcher) scanDue(now time.Time) {
+	for p, due := range w.pending {
+		if due.After(now) {
+			continue
+		}
+		delete(w.pending, p)
+		w.scan(p)
+	}
+	if err := w.sink.Flush(); err != nil {
+		log.Printf("Error: writing results: %v", err)
+	}
+}
+
+// scan scans a changed path. Directories, such as ones moved into a watched
+// directory, are walked.
+func (w *watcher) scan(p string) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.error(p, err)
+		}
+		return
+	}
+	report := func(path string, r *jar.Report) {
+		if err := w.sink.Write(results.FromReport(path, r)); err != nil {
+			log.Printf("Error: writing results: %v", err)
+		}
+	}
+	if fi.IsDir() {
+		walker := jar.Walker{
+			Config:       scanConfig,
+			HandleReport: report,
+			HandleError:  w.error,
+		}
+		if w.scans != nil {
+			walker.HandleScanned = func(path string, r *jar.Report) {
+				w.scans.Record(r.Stats.Duration, r, nil)
+			}
+		}
+		if err := walker.Walk(p); err != nil {
+			log.Printf("Error: walking %s: %v", p, err)
+		}
+		return
+	}
+	if !fi.Mode().IsRegular() || !jar.HasArchiveExt(p) {
+		return
+	}
+	start := time.Now()
+	r, err := scanFile(p)
+	if w.scans != nil {
+		w.scans.Record(time.Since(start), r, err)
+	}
+	if err != nil {
+		logging.With("path", p, "error", err).Printf("Error: scanning %s: %v", p, err)
+		return
+	}
+	if r != nil && r.Vulnerable {
+		report(p, r)
+	}
+}
+
+// error logs and records an error scanning a path.
+func (w *watcher) error(p string, err error) {
+	logging.With("path", p, "error", err).Printf("Error: scanning %s: %v", p, err)
+	if w.scans != nil {
+		w.scans.RecordError(err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"log4jscanner/results"
+	"log4jscanner/tlsconfig"
+)
+
+// webhookFlags defines the --webhook flags, and the client TLS flags used
+// for its requests.
+type webhookFlags struct {
+	url    string
+	header http.Header
+	tls    tlsconfig.Options
+}
+
+func (w *webhookFlags) register(flags *flag.FlagSet) {
+	w.header = http.Header{}
+	flags.StringVar(&w.url, "webhook", "", "")
+	flags.Func("webhook-header", "", func(h string) error {
+		i := strings.IndexByte(h, ':')
+		if i <= 0 {
+			return fmt.Errorf("invalid header %q, expected \"Name: value\"", h)
+		}
+		w.header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+		return nil
+	})
+	clientTLSFlags(flags, &w.tls)
+}
+
+// sink returns the webhook sink of the flags, or nil if --webhook isn't
+// set.
+func (w *webhookFlags) sink() results.Sink {
+	if w.url == "" {
+		return nil
+	}
+	client, err := tlsconfig.HTTPClient(w.tls)
+	if err != nil {
+		log.Fatalf("Error: configuring TLS: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	return &results.Webhook{
+		URL:    w.url,
+		Host:   hostname,
+		Header: w.header,
+		Client: client,
+	}
+}
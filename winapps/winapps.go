@@ -0,0 +1,289 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package winapps derives scan roots from the Java applications registered
+// on a Windows host, so servers can be scanned where Java is deployed rather
+// than drive by drive.
+//
+// Applications are found through the installed services, whose command lines
+// name the java.exe or service wrapper they run, the Procrun parameters of
+// services such as Tomcat, the JavaSoft keys of installed runtimes, and the
+// install locations of uninstallable programs that bundle Java. Roots are
+// the install directories and classpath entries of those applications,
+// wherever they live, including network shares and mapped drives that a
+// drive scan would miss.
+package winapps
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// App is a Java application registered on the host.
+type App struct {
+	// Name is the service name, runtime version, or program name.
+	Name string
+	// Source is where the application was registered: SourceService,
+	// SourceProcrun, SourceJavaSoft, or SourceUninstall.
+	Source string
+	// Roots are the directories to scan for the application.
+	Roots []string
+}
+
+// Sources of applications.
+const (
+	SourceService   = "service"
+	SourceProcrun   = "procrun"
+	SourceJavaSoft  = "javasoft"
+	SourceUninstall = "uninstall"
+)
+
+// SplitCommandLine splits a Windows command line into arguments, following
+// the quoting rules of the Microsoft C runtime.
+func SplitCommandLine(cmd string) []string {
+	var (
+		args    []string
+		arg     strings.Builder
+		inArg   bool
+		quoted  bool
+		slashes int
+	)
+	for _, r := range cmd {
+		switch {
+		case r == '\\':
+			slashes++
+			inArg = true
+			continue
+		case r == '"':
+			arg.WriteString(strings.Repeat(`\`, slashes/2))
+			if slashes%2 == 1 {
+				arg.WriteRune('"')
+			} else {
+				quoted = !quoted
+			}
+			slashes = 0
+			inArg = true
+			continue
+		}
+		arg.WriteString(strings.Repeat(`\`, slashes))
+		slashes = 0
+		if (r == ' ' || r == '\t') && !quoted {
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+			continue
+		}
+		arg.WriteRune(r)
+		inArg = true
+	}
+	arg.WriteString(strings.Repeat(`\`, slashes))
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
+
+// javaExes are the executables that run Java directly.
+var javaExes = map[string]bool{"java.exe": true, "javaw.exe": true, "java": true, "javaw": true}
+
+// wrapperExes are service wrappers whose install directory holds the JARs of
+// the application they run, such as the Java Service Wrapper and WinSW.
+var wrapperExes = map[string]bool{"wrapper.exe": true, "winsw.exe": true, "prunsrv.exe": true}
+
+// CommandRoots returns the roots of the Java application run by a service
+// command line, and whether the command runs Java at all. The roots are the
+// classpath and -jar arguments of java.exe, and the install directory of
+// java.exe or a service wrapper.
+func CommandRoots(cmd string) ([]string, bool) {
+	args := SplitCommandLine(cmd)
+	if len(args) == 0 {
+		return nil, false
+	}
+	exe := strings.ToLower(base(args[0]))
+	switch {
+	case javaExes[exe]:
+	case wrapperExes[exe]:
+		return []string{installDir(args[0])}, true
+	default:
+		return nil, false
+	}
+	var roots []string
+	if d := installDir(args[0]); d != "" {
+		roots = append(roots, d)
+	}
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case (a == "-cp" || a == "-classpath" || a == "--class-path") && i+1 < len(args):
+			i++
+			roots = append(roots, ClasspathRoots(args[i])...)
+		case strings.HasPrefix(a, "--class-path="):
+			roots = append(roots, ClasspathRoots(strings.TrimPrefix(a, "--class-path="))...)
+		case strings.HasPrefix(a, "-Djava.class.path="):
+			roots = append(roots, ClasspathRoots(strings.TrimPrefix(a, "-Djava.class.path="))...)
+		case a == "-jar" && i+1 < len(args):
+			roots = append(roots, dir(args[i+1]))
+			return roots, true
+		case !strings.HasPrefix(a, "-"):
+			// The main class, the remaining arguments belong to the
+			// application.
+			return roots, true
+		}
+	}
+	return roots, true
+}
+
+// ClasspathRoots returns the directories of the entries of a ";" separated
+// classpath. JARs are scanned through their directory, and wildcard entries
+// such as "lib\*" through the directory they list.
+func ClasspathRoots(cp string) []string {
+	var roots []string
+	for _, e := range strings.Split(cp, ";") {
+		e = strings.TrimSpace(e)
+		if e == "" || e == "." {
+			continue
+		}
+		lower := strings.ToLower(e)
+		switch {
+		case strings.HasSuffix(e, "*"):
+			e = dir(e)
+		case strings.HasSuffix(lower, ".jar"), strings.HasSuffix(lower, ".zip"):
+			e = dir(e)
+		}
+		if e != "" {
+			roots = append(roots, trimSep(e))
+		}
+	}
+	return roots
+}
+
+// Roots returns the roots of all apps, sorted, without duplicates and without
+// directories within other roots. Windows paths are compared ignoring case.
+func Roots(apps []App) []string {
+	seen := map[string]string{}
+	for _, a := range apps {
+		for _, r := range a.Roots {
+			if r == "" || !absolute(r) {
+				continue
+			}
+			r = trimSep(r)
+			seen[strings.ToLower(strings.ReplaceAll(r, "/", `\`))] = r
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var roots []string
+	last := ""
+	for _, k := range keys {
+		if last != "" && (k == last || strings.HasPrefix(k, strings.TrimSuffix(last, `\`)+`\`)) {
+			continue
+		}
+		last = k
+		roots = append(roots, seen[k])
+	}
+	return roots
+}
+
+// bundleDepth is how deep BundlesJava looks for Java in an install
+// directory, enough for "lib\app.jar" and "jre\bin\java.exe".
+const bundleDepth = 3
+
+// BundlesJava reports whether the install directory fsys holds Java: JARs,
+// WARs, or a java.exe, within its top levels. Unreadable directories are
+// ignored.
+func BundlesJava(fsys fs.FS) bool {
+	return bundlesJava(fsys, ".", 1)
+}
+
+func bundlesJava(fsys fs.FS, dir string, depth int) bool {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		name := strings.ToLower(e.Name())
+		if e.IsDir() {
+			if depth < bundleDepth && bundlesJava(fsys, path.Join(dir, e.Name()), depth+1) {
+				return true
+			}
+			continue
+		}
+		if javaExes[name] || strings.HasSuffix(name, ".jar") || strings.HasSuffix(name, ".war") {
+			return true
+		}
+	}
+	return false
+}
+
+// installDir returns the install directory of an executable: the parent of
+// its directory if that is a "bin" directory, such as the JRE of
+// "C:\app\jre\bin\java.exe", and its directory otherwise.
+func installDir(exe string) string {
+	d := dir(exe)
+	if strings.EqualFold(base(d), "bin") {
+		return dir(d)
+	}
+	return d
+}
+
+// absolute reports whether p is an absolute Windows path, with a drive letter
+// or a UNC share.
+func absolute(p string) bool {
+	if strings.HasPrefix(p, `\\`) || strings.HasPrefix(p, "//") {
+		return true
+	}
+	return len(p) >= 3 && p[1] == ':' && (p[2] == '\\' || p[2] == '/')
+}
+
+func isSep(c byte) bool { return c == '\\' || c == '/' }
+
+// trimSep removes trailing separators of p, keeping the root of a drive.
+func trimSep(p string) string {
+	for len(p) > 3 && isSep(p[len(p)-1]) {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// base and dir split Windows paths on both separators, independently of the
+// platform the scanner was built for.
+func base(p string) string {
+	p = trimSep(p)
+	for i := len(p) - 1; i >= 0; i-- {
+		if isSep(p[i]) {
+			return p[i+1:]
+		}
+	}
+	return p
+}
+
+func dir(p string) string {
+	p = trimSep(p)
+	for i := len(p) - 1; i >= 0; i-- {
+		if isSep(p[i]) {
+			if i == 2 && p[1] == ':' {
+				return p[:3]
+			}
+			return p[:i]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winapps
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want []string
+	}{
+		{`C:\app\app.exe`, []string{`C:\app\app.exe`}},
+		{`"C:\Program Files\App\app.exe" -run  fast`, []string{`C:\Program Files\App\app.exe`, "-run", "fast"}},
+		{`a "b c"d e`, []string{"a", "b cd", "e"}},
+		{`a \"b\" c`, []string{"a", `"b"`, "c"}},
+		{`a "C:\dir\\" b`, []string{"a", `C:\dir\`, "b"}},
+		{`a ""`, []string{"a", ""}},
+	}
+	for _, tc := range tests {
+		if diff := cmp.Diff(tc.want, SplitCommandLine(tc.cmd)); diff != "" {
+			t.Errorf("SplitCommandLine(%q) returned diff (-want, +got): %s", tc.cmd, diff)
+		}
+	}
+}
+
+func TestCommandRoots(t *testing.T) {
+	tests := []struct {
+		cmd    string
+		want   []string
+		isJava bool
+	}{
+		{
+			cmd:    `C:\Windows\system32\svchost.exe -k netsvcs`,
+			isJava: false,
+		},
+		{
+			cmd:    `"C:\App\jre\bin\java.exe" -Xmx1g -cp "C:\App\lib\*;C:\App\conf;D:\shared\util.jar" com.example.Main -cp ignored`,
+			want:   []string{`C:\App\jre`, `C:\App\lib`, `C:\App\conf`, `D:\shared`},
+			isJava: true,
+		},
+		{
+			cmd:    `C:\Java\bin\javaw.exe -jar \\fileserver\apps\svc\svc.jar`,
+			want:   []string{`C:\Java`, `\\fileserver\apps\svc`},
+			isJava: true,
+		},
+		{
+			cmd:    `java.exe --class-path=X:\lib\a.jar Main`,
+			want:   []string{`X:\lib`},
+			isJava: true,
+		},
+		{
+			cmd:    `"C:\Tomcat\bin\Tomcat9.exe" //RS//Tomcat9`,
+			isJava: false,
+		},
+		{
+			cmd:    `"C:\Apps\Svc\wrapper.exe" -s "C:\Apps\Svc\conf\wrapper.conf"`,
+			want:   []string{`C:\Apps\Svc`},
+			isJava: true,
+		},
+	}
+	for _, tc := range tests {
+		got, isJava := CommandRoots(tc.cmd)
+		if isJava != tc.isJava {
+			t.Errorf("CommandRoots(%q) returned Java %v, want %v", tc.cmd, isJava, tc.isJava)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("CommandRoots(%q) returned diff (-want, +got): %s", tc.cmd, diff)
+		}
+	}
+}
+
+func TestRoots(t *testing.T) {
+	apps := []App{
+		{Name: "a", Roots: []string{`C:\App\lib`, `C:\App\`, "relative", ""}},
+		{Name: "b", Roots: []string{`c:\app\conf`, `C:\Application`, `\\srv\share\x`}},
+		{Name: "c", Roots: []string{`D:\`, `D:\x`, `\\SRV\share\x\lib`}},
+	}
+	want := []string{`\\srv\share\x`, `C:\App`, `C:\Application`, `D:\`}
+	if diff := cmp.Diff(want, Roots(apps)); diff != "" {
+		t.Errorf("Roots() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestBundlesJava(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want bool
+	}{
+		{"jar", fstest.MapFS{"lib/app.jar": {}}, true},
+		{"bundled jre", fstest.MapFS{"jre/bin/java.exe": {}}, true},
+		{"war", fstest.MapFS{"webapps/ROOT.WAR": {}}, true},
+		{"native", fstest.MapFS{"bin/app.exe": {}, "app.dll": {}}, false},
+		{"too deep", fstest.MapFS{"a/b/c/app.jar": {}}, false},
+	}
+	for _, tc := range tests {
+		if got := BundlesJava(tc.fsys); got != tc.want {
+			t.Errorf("BundlesJava(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winapps
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// servicesKey holds a subkey for every installed service.
+	servicesKey = `SYSTEM\CurrentControlSet\Services`
+	// procrunKeys hold the parameters of services run by Apache Commons
+	// Daemon (Procrun), such as Tomcat, on 64 and 32 bit installs.
+	procrunKey      = `SOFTWARE\Apache Software Foundation\Procrun 2.0`
+	procrunKeyWow64 = `SOFTWARE\WOW6432Node\Apache Software Foundation\Procrun 2.0`
+	// javaSoftKeys hold a subkey for every installed JRE and JDK.
+	javaSoftKey      = `SOFTWARE\JavaSoft`
+	javaSoftKeyWow64 = `SOFTWARE\WOW6432Node\JavaSoft`
+	// uninstallKeys hold a subkey for every installed program.
+	uninstallKey      = `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`
+	uninstallKeyWow64 = `SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`
+)
+
+// Discover returns the Java applications registered on the host, sorted by
+// source and name. Keys that can't be read are logged and skipped, so one
+// broken service doesn't hide the others.
+func Discover() ([]App, error) {
+	var apps []App
+	svcs, err := services()
+	if err != nil {
+		return nil, err
+	}
+	apps = append(apps, svcs...)
+	for _, key := range []string{procrunKey, procrunKeyWow64} {
+		apps = append(apps, procrun(key)...)
+	}
+	for _, key := range []string{javaSoftKey, javaSoftKeyWow64} {
+		apps = append(apps, javaSoft(key)...)
+	}
+	for _, key := range []string{uninstallKey, uninstallKeyWow64} {
+		apps = append(apps, uninstall(key)...)
+	}
+	sort.SliceStable(apps, func(i, j int) bool {
+		if apps[i].Source != apps[j].Source {
+			return apps[i].Source < apps[j].Source
+		}
+		return apps[i].Name < apps[j].Name
+	})
+	return apps, nil
+}
+
+// subKeys returns the names of the subkeys of an HKLM key, or nothing if the
+// key doesn't exist.
+func subKeys(path string) ([]string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	defer k.Close()
+	names, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %v", path, err)
+	}
+	return names, nil
+}
+
+// stringValue returns a string value of an HKLM key with environment
+// variables expanded, or "" if the key or value doesn't exist.
+func stringValue(path, name string) string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+	v, typ, err := k.GetStringValue(name)
+	if err != nil {
+		return ""
+	}
+	if typ == registry.EXPAND_SZ {
+		if expanded, err := registry.ExpandString(v); err == nil {
+			v = expanded
+		}
+	}
+	return v
+}
+
+// services returns the services whose command line runs Java.
+func services() ([]App, error) {
+	names, err := subKeys(servicesKey)
+	if err != nil {
+		return nil, err
+	}
+	var apps []App
+	for _, name := range names {
+		cmd := stringValue(servicesKey+`\`+name, "ImagePath")
+		if roots, ok := CommandRoots(cmd); ok {
+			apps = append(apps, App{Name: name, Source: SourceService, Roots: roots})
+		}
+	}
+	return apps, nil
+}
+
+// procrun returns the services run by Procrun, with their classpath, JVM and
+// working directory.
+func procrun(key string) []App {
+	names, err := subKeys(key)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return nil
+	}
+	var apps []App
+	for _, name := range names {
+		params := key + `\` + name + `\Parameters`
+		roots := ClasspathRoots(stringValue(params+`\Java`, "Classpath"))
+		if jvm := stringValue(params+`\Java`, "Jvm"); jvm != "" && !strings.EqualFold(jvm, "auto") {
+			roots = append(roots, installDir(dir(jvm)))
+		}
+		if wd := stringValue(params+`\Start`, "WorkingPath"); wd != "" {
+			roots = append(roots, wd)
+		}
+		if len(roots) > 0 {
+			apps = append(apps, App{Name: name, Source: SourceProcrun, Roots: roots})
+		}
+	}
+	return apps
+}
+
+// javaSoft returns the installed JREs and JDKs, whose JavaHome may hold
+// libraries of their own.
+func javaSoft(key string) []App {
+	products, err := subKeys(key)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return nil
+	}
+	var apps []App
+	for _, product := range products {
+		versions, err := subKeys(key + `\` + product)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		for _, version := range versions {
+			home := stringValue(key+`\`+product+`\`+version, "JavaHome")
+			if home != "" {
+				apps = append(apps, App{Name: product + " " + version, Source: SourceJavaSoft, Roots: []string{home}})
+			}
+		}
+	}
+	return apps
+}
+
+// uninstall returns the installed programs whose install location bundles
+// Java.
+func uninstall(key string) []App {
+	ids, err := subKeys(key)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return nil
+	}
+	var apps []App
+	for _, id := range ids {
+		loc := stringValue(key+`\`+id, "InstallLocation")
+		loc = strings.Trim(loc, `"`)
+		if loc == "" || !absolute(loc) || !BundlesJava(os.DirFS(loc)) {
+			continue
+		}
+		name := stringValue(key+`\`+id, "DisplayName")
+		if name == "" {
+			name = id
+		}
+		apps = append(apps, App{Name: name, Source: SourceUninstall, Roots: []string{loc}})
+	}
+	return apps
+}
@@ -0,0 +1,40 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"strings"
+
+	"log4jscanner/winapps"
+)
+
+// winAppRoots returns the install directories and classpaths of the Java
+// applications registered on a Windows host.
+func winAppRoots(verbose bool) []string {
+	apps, err := winapps.Discover()
+	if err != nil {
+		log.Fatalf("Error: --windows-apps: %v", err)
+	}
+	if len(apps) == 0 {
+		log.Printf("Warning: no Java applications registered on this host")
+	}
+	if verbose {
+		for _, a := range apps {
+			log.Printf("Found %s %s: %s", a.Source, a.Name, strings.Join(a.Roots, ", "))
+		}
+	}
+	return winapps.Roots(apps)
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wsl finds the filesystems shared between Windows and the Windows
+// Subsystem for Linux (WSL), so hybrid machines can be scanned from either
+// side without missing a distribution or scanning a drive twice.
+//
+// From Windows, the root filesystem of every installed distribution is
+// reachable through the \\wsl$ share. From inside a distribution, the
+// Windows drives are mounted through drvfs, usually under /mnt.
+package wsl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Distribution is a WSL distribution installed for the current Windows user.
+type Distribution struct {
+	// Name of the distribution, such as "Ubuntu".
+	Name string
+	// BasePath is the directory holding the distribution's files on the
+	// Windows host.
+	BasePath string
+	// Version is 1 or 2, the version of WSL that runs the distribution.
+	Version int
+}
+
+// Root returns the path of the distribution's root filesystem, as seen from
+// Windows.
+func (d Distribution) Root() string {
+	return `\\wsl$\` + d.Name + `\`
+}
+
+// parseMounts returns the mount points of Windows drives listed in the format
+// of /proc/self/mounts.
+func parseMounts(r io.Reader) ([]string, error) {
+	var mounts []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		target, fstype, options := fields[1], fields[2], fields[3]
+		// WSL 1 mounts drives as drvfs, WSL 2 over 9p with drvfs as the
+		// attach name.
+		if fstype != "drvfs" && !(fstype == "9p" && strings.Contains(options, "aname=drvfs")) {
+			continue
+		}
+		target, err := unescapeMount(target)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, target)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading mounts: %v", err)
+	}
+	return mounts, nil
+}
+
+// unescapeMount decodes the octal escapes the kernel uses for whitespace and
+// backslashes in mount points (e.g. "\040" for a space).
+func unescapeMount(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+4 > len(s) {
+			return "", fmt.Errorf("invalid escape in mount point %q", s)
+		}
+		n, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in mount point %q", s)
+		}
+		b.WriteByte(byte(n))
+		i += 3
+	}
+	return b.String(), nil
+}
+
+// isWSL reports if a kernel release string, as found in
+// /proc/sys/kernel/osrelease, belongs to a WSL kernel.
+func isWSL(release string) bool {
+	release = strings.ToLower(release)
+	return strings.Contains(release, "microsoft") || strings.Contains(release, "wsl")
+}
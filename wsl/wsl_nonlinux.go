@@ -0,0 +1,28 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package wsl
+
+// InWSL reports if the current process runs inside a WSL distribution.
+func InWSL() bool {
+	return false
+}
+
+// WindowsMounts returns the mount points of Windows drives, such as /mnt/c,
+// when running inside WSL.
+func WindowsMounts() ([]string, error) {
+	return nil, nil
+}
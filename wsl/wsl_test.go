@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMounts(t *testing.T) {
+	mounts := `/dev/sdc / ext4 rw,relatime,discard,errors=remount-ro,data=ordered 0 0
+none /mnt/wslg tmpfs rw,relatime 0 0
+C:\134 /mnt/c 9p rw,noatime,dirsync,aname=drvfs;path=C:\;uid=1000;gid=1000;symlinkroot=/mnt/,mmap,access=client,msize=262144,trans=virtio 0 0
+D:\134 /mnt/d 9p rw,noatime,dirsync,aname=drvfs;path=D:\;uid=1000;gid=1000,trans=fd,rfdno=8,wfdno=8 0 0
+E: /mnt/my\040drive drvfs rw,noatime,uid=1000,gid=1000 0 0
+drvfs /mnt/wsl 9p rw,relatime,aname=wsl 0 0
+`
+	got, err := parseMounts(strings.NewReader(mounts))
+	if err != nil {
+		t.Fatalf("parseMounts() failed: %v", err)
+	}
+	want := []string{"/mnt/c", "/mnt/d", "/mnt/my drive"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseMounts() returned diff (-want, +got): %s", diff)
+	}
+}
+
+func TestUnescapeMount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "/mnt/c", want: "/mnt/c"},
+		{in: `/mnt/a\040b`, want: "/mnt/a b"},
+		{in: `/mnt/a\134b\011`, want: "/mnt/a\\b\t"},
+		{in: `/mnt/a\04`, wantErr: true},
+		{in: `/mnt/a\xyz`, wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := unescapeMount(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("unescapeMount(%q) returned error %v, want error %t", tc.in, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("unescapeMount(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestIsWSL(t *testing.T) {
+	tests := []struct {
+		release string
+		want    bool
+	}{
+		{"5.15.90.1-microsoft-standard-WSL2", true},
+		{"4.4.0-19041-Microsoft", true},
+		{"5.10.0-21-amd64", false},
+	}
+	for _, tc := range tests {
+		if got := isWSL(tc.release); got != tc.want {
+			t.Errorf("isWSL(%q) = %t, want %t", tc.release, got, tc.want)
+		}
+	}
+}
+
+func TestRoot(t *testing.T) {
+	d := Distribution{Name: "Ubuntu-22.04"}
+	if got, want := d.Root(), `\\wsl$\Ubuntu-22.04\`; got != want {
+		t.Errorf("Root() = %q, want %q", got, want)
+	}
+}
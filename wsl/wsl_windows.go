@@ -0,0 +1,83 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsl
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// lxssKey holds a subkey for every distribution registered by the user.
+const lxssKey = `Software\Microsoft\Windows\CurrentVersion\Lxss`
+
+// flagVMMode is set in the Flags of distributions run by WSL 2.
+const flagVMMode = 0x8
+
+// stateInstalled is the State of a distribution that's fully installed, as
+// opposed to one being installed or uninstalled.
+const stateInstalled = 1
+
+// Distributions returns the WSL distributions installed for the current user,
+// sorted by name.
+func Distributions() ([]Distribution, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, lxssKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening %s: %v", lxssKey, err)
+	}
+	defer k.Close()
+	ids, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %v", lxssKey, err)
+	}
+
+	var dists []Distribution
+	for _, id := range ids {
+		d, ok, err := readDistribution(k, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			dists = append(dists, d)
+		}
+	}
+	sort.Slice(dists, func(i, j int) bool { return dists[i].Name < dists[j].Name })
+	return dists, nil
+}
+
+func readDistribution(parent registry.Key, id string) (Distribution, bool, error) {
+	k, err := registry.OpenKey(parent, id, registry.QUERY_VALUE)
+	if err != nil {
+		return Distribution{}, false, fmt.Errorf("opening %s\\%s: %v", lxssKey, id, err)
+	}
+	defer k.Close()
+	if state, _, err := k.GetIntegerValue("State"); err == nil && state != stateInstalled {
+		return Distribution{}, false, nil
+	}
+	name, _, err := k.GetStringValue("DistributionName")
+	if err != nil {
+		return Distribution{}, false, fmt.Errorf("reading name of distribution %s: %v", id, err)
+	}
+	d := Distribution{Name: name, Version: 1}
+	d.BasePath, _, _ = k.GetStringValue("BasePath")
+	if flags, _, err := k.GetIntegerValue("Flags"); err == nil && flags&flagVMMode != 0 {
+		d.Version = 2
+	}
+	return d, true, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+
+	"log4jscanner/wsl"
+)
+
+// wslRoots returns the root filesystems of the WSL distributions installed
+// for the current user.
+func wslRoots() []string {
+	dists, err := wsl.Distributions()
+	if err != nil {
+		log.Fatalf("Error: --wsl: %v", err)
+	}
+	if len(dists) == 0 {
+		log.Printf("Warning: no WSL distributions found")
+	}
+	var roots []string
+	for _, d := range dists {
+		roots = append(roots, d.Root())
+	}
+	return roots
+}
+
+// skipWindowsDrives wraps skipDir to also skip the Windows drives mounted in
+// a WSL distribution, which are better scanned from Windows itself. Drives
+// that are being scanned explicitly are still walked.
+func skipWindowsDrives(dirs []string, skipDir func(path string, d fs.DirEntry) bool, skipped func(path, reason string)) func(path string, d fs.DirEntry) bool {
+	if !wsl.InWSL() {
+		return skipDir
+	}
+	mounts, err := wsl.WindowsMounts()
+	if err != nil {
+		log.Printf("Error: finding Windows drives: %v", err)
+		return skipDir
+	}
+	drives := map[string]bool{}
+	for _, m := range mounts {
+		drives[m] = true
+	}
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			delete(drives, abs)
+		}
+	}
+	if len(drives) == 0 {
+		return skipDir
+	}
+	return func(path string, d fs.DirEntry) bool {
+		if d.IsDir() && drives[path] {
+			if skipped != nil {
+				skipped(path, "windows drive")
+			}
+			return true
+		}
+		return skipDir(path, d)
+	}
+}